@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"buchhalter/lib/archive"
+)
+
+// archiveDuplicatesCmd represents the `archive duplicates` command
+var archiveDuplicatesCmd = &cobra.Command{
+	Use:   "duplicates",
+	Short: "Lists invoices that are likely duplicates",
+	Long: `Lists PDF invoices of the same supplier with the same content, but different bytes.
+E.g. the same invoice re-issued with another creation date in its metadata.
+
+Duplicates by checksum are never downloaded twice. This check compares the page contents of all PDF invoices instead.
+It is best-effort and only lists the invoices for a review: Nothing is deleted.`,
+	Run: RunArchiveDuplicatesCommand,
+}
+
+func init() {
+	archiveDuplicatesCmd.Flags().Bool("json", false, "output the duplicates as JSON")
+	archiveCmd.AddCommand(archiveDuplicatesCmd)
+}
+
+func RunArchiveDuplicatesCommand(cmd *cobra.Command, cmdArgs []string) {
+	// Init logging
+	buchhalterDirectory := viper.GetString("buchhalter_directory")
+	developmentMode := viper.GetBool("dev")
+	logSetting, err := cmd.Flags().GetBool("log")
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error reading log flag: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	jsonOutput, err := cmd.Flags().GetBool("json")
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error reading json flag: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	logger, err := initializeLogger(logSetting, developmentMode, buchhalterDirectory)
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error on initializing logging: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	logger.Info("Booting up", "development_mode", developmentMode)
+	defer logger.Info("Shutting down")
+
+	// All vaults are checked, the documents of each vault are stored in a separate archive (sub directory)
+	vaultDocumentDirectories, err := getVaultDocumentDirectories(viper.GetString("buchhalter_documents_directory"))
+	if err != nil {
+		exitWithLogo(capitalizeFirstLetter(err.Error()))
+	}
+
+	numDocuments := 0
+	duplicates := []archive.DuplicateGroup{}
+	for _, vaultDocumentDirectory := range vaultDocumentDirectories {
+		documentArchive := archive.NewDocumentArchive(logger, vaultDocumentDirectory, viper.GetString("buchhalter_document_layout"))
+		if err := documentArchive.BuildArchiveIndex(); err != nil {
+			logger.Error("Error building document archive index", "error", err)
+			exitMessage := fmt.Sprintf("Error building document archive index: %s", err)
+			exitWithLogo(exitMessage)
+		}
+
+		numDocuments += len(documentArchive.GetFileIndex())
+		duplicates = append(duplicates, documentArchive.FindContentDuplicates()...)
+	}
+	logger.Info("Searched document archives for duplicates", "num_documents", numDocuments, "num_duplicate_groups", len(duplicates))
+
+	if jsonOutput {
+		duplicatesJSON, err := json.MarshalIndent(duplicates, "", "  ")
+		if err != nil {
+			fmt.Printf("Error encoding duplicates as JSON: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(duplicatesJSON))
+		return
+	}
+
+	fmt.Println(renderDuplicates(numDocuments, duplicates))
+}
+
+func renderDuplicates(numDocuments int, duplicates []archive.DuplicateGroup) string {
+	s := strings.Builder{}
+	s.WriteString(headerStyle(LogoText) + "\n\n")
+
+	if len(duplicates) == 0 {
+		s.WriteString(checkMark.Render() + " " + textStyleBold(fmt.Sprintf("Checked %d invoices, no duplicates found", numDocuments)) + "\n")
+		return s.String()
+	}
+
+	for _, group := range duplicates {
+		s.WriteString(textStyleBold(fmt.Sprintf("%s: %d invoices with the same content", group.Supplier, len(group.Files))) + "\n")
+		for _, file := range group.Files {
+			s.WriteString("  - " + file + "\n")
+		}
+	}
+	s.WriteString(fmt.Sprintf("\nChecked %d invoices, %d groups of likely duplicates. Please review them, nothing was deleted.\n", numDocuments, len(duplicates)))
+
+	return s.String()
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"buchhalter/lib/archive"
+)
+
+// archiveMigrateCmd represents the `archive migrate` command
+var archiveMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Moves the invoices into the configured document layout",
+	Long: `Moves all invoices into the directories of the configured document layout (` + "`buchhalter_document_layout`" + `),
+e.g. after switching from ` + "`supplier`" + ` to ` + "`supplier/year`" + `.
+
+Existing files are never overwritten. Use --dry-run to only list the moves.`,
+	Run: RunArchiveMigrateCommand,
+}
+
+func init() {
+	archiveMigrateCmd.Flags().Bool("dry-run", false, "only list the moves, don't move any invoice")
+	archiveCmd.AddCommand(archiveMigrateCmd)
+}
+
+func RunArchiveMigrateCommand(cmd *cobra.Command, cmdArgs []string) {
+	// Init logging
+	buchhalterDirectory := viper.GetString("buchhalter_directory")
+	developmentMode := viper.GetBool("dev")
+	logSetting, err := cmd.Flags().GetBool("log")
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error reading log flag: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error reading dry-run flag: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	logger, err := initializeLogger(logSetting, developmentMode, buchhalterDirectory)
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error on initializing logging: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	logger.Info("Booting up", "development_mode", developmentMode)
+	defer logger.Info("Shutting down")
+
+	documentLayout := viper.GetString("buchhalter_document_layout")
+	if !archive.IsSupportedLayout(documentLayout) {
+		exitMessage := fmt.Sprintf("Unsupported value `%s` for `buchhalter_document_layout` (supported: %s)", documentLayout, strings.Join(archive.Layouts, ", "))
+		exitWithLogo(exitMessage)
+	}
+
+	// The documents of each vault are stored in a separate archive (sub directory)
+	vaultDocumentDirectories, err := getVaultDocumentDirectories(viper.GetString("buchhalter_documents_directory"))
+	if err != nil {
+		exitWithLogo(capitalizeFirstLetter(err.Error()))
+	}
+
+	s := strings.Builder{}
+	s.WriteString(headerStyle(LogoText) + "\n\n")
+	numMigrations := 0
+	numMoved := 0
+	var migrationErr error
+	for _, vaultDocumentDirectory := range vaultDocumentDirectories {
+		documentArchive := archive.NewDocumentArchive(logger, vaultDocumentDirectory, documentLayout)
+		if err := documentArchive.BuildArchiveIndex(); err != nil {
+			logger.Error("Error building document archive index", "error", err)
+			exitMessage := fmt.Sprintf("Error building document archive index: %s", err)
+			exitWithLogo(exitMessage)
+		}
+		migrations, err := documentArchive.PlanMigration()
+		if err != nil {
+			exitMessage := fmt.Sprintf("Error planning the migration: %s", err)
+			exitWithLogo(exitMessage)
+		}
+		numMigrations += len(migrations)
+
+		for _, migration := range migrations {
+			s.WriteString(fmt.Sprintf("%s -> %s\n", migration.From, migration.To))
+		}
+		if dryRun {
+			continue
+		}
+
+		moved, err := documentArchive.Migrate(migrations)
+		numMoved += moved
+		if err != nil {
+			logger.Error("Error migrating documents", "error", err)
+			migrationErr = err
+		}
+	}
+
+	switch {
+	case numMigrations == 0:
+		s.WriteString(checkMark.Render() + " " + textStyleBold(fmt.Sprintf("All invoices are stored in the layout `%s` already", documentLayout)) + "\n")
+	case dryRun:
+		s.WriteString(fmt.Sprintf("\n%d invoices would be moved into the layout `%s`.\n", numMigrations, documentLayout))
+	default:
+		s.WriteString(fmt.Sprintf("\nMoved %d of %d invoices into the layout `%s`.\n", numMoved, numMigrations, documentLayout))
+	}
+	fmt.Print(s.String())
+
+	if migrationErr != nil {
+		fmt.Println(errorStyle.Render(migrationErr.Error()))
+		os.Exit(1)
+	}
+}
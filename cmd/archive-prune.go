@@ -0,0 +1,226 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"buchhalter/lib/archive"
+	"buchhalter/lib/repository"
+	"buchhalter/lib/settings"
+	"buchhalter/lib/utils"
+)
+
+// archivePruneCmd represents the `archive prune` command
+var archivePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Deletes old invoices from the local document archive",
+	Long: `Deletes old invoices from the local document archive, e.g. the invoices older than three years (` + "`--older-than 3y`" + `),
+the oldest invoices until the archive fits into a size (` + "`--max-size 500`" + `) or all but the newest invoices of each supplier (` + "`--keep 12`" + `).
+With several options, the newest invoices of ` + "`--keep`" + ` are never deleted.
+
+Nothing is deleted without --confirm, the invoices that would be deleted are only listed.
+Deleted invoices are remembered by the archive, so they are not downloaded again.
+With a premium subscription, only invoices that exist in Buchhalter API are deleted.`,
+	Run: RunArchivePruneCommand,
+}
+
+func init() {
+	archivePruneCmd.Flags().String("older-than", "", "delete the invoices older than this age (e.g. 3y, 6m, 2w or 30d)")
+	archivePruneCmd.Flags().Int64("max-size", 0, "delete the oldest invoices until the archive of each vault fits into this size (in MB)")
+	archivePruneCmd.Flags().Int("keep", 0, "number of the newest invoices per supplier that are never deleted")
+	archivePruneCmd.Flags().Bool("confirm", false, "delete the invoices, otherwise they are only listed")
+	archiveCmd.AddCommand(archivePruneCmd)
+}
+
+func RunArchivePruneCommand(cmd *cobra.Command, cmdArgs []string) {
+	buchhalterConfig := loadConfig()
+
+	// Init logging
+	buchhalterDirectory := buchhalterConfig.Directory
+	developmentMode := buchhalterConfig.Dev
+	logSetting, err := cmd.Flags().GetBool("log")
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error reading log flag: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	olderThan, err := cmd.Flags().GetString("older-than")
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error reading older-than flag: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	maxSize, err := cmd.Flags().GetInt64("max-size")
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error reading max-size flag: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	keep, err := cmd.Flags().GetInt("keep")
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error reading keep flag: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	confirm, err := cmd.Flags().GetBool("confirm")
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error reading confirm flag: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	logger, err := initializeLogger(logSetting, developmentMode, buchhalterDirectory)
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error on initializing logging: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	logger.Info("Booting up", "development_mode", developmentMode)
+	defer logger.Info("Shutting down")
+
+	if maxSize < 0 || keep < 0 {
+		exitWithLogo("The values of `--max-size` and `--keep` must not be negative")
+	}
+	pruneOptions := archive.PruneOptions{MaxSizeMB: maxSize, Keep: keep}
+	if len(strings.TrimSpace(olderThan)) > 0 {
+		pruneOptions.OlderThan, err = archive.RetentionCutoff(olderThan, time.Now())
+		if err != nil {
+			exitWithLogo(capitalizeFirstLetter(err.Error()))
+		}
+	}
+	if pruneOptions.OlderThan.IsZero() && maxSize == 0 && keep == 0 {
+		exitWithLogo("Please select the invoices to delete, e.g. `--older-than 3y`, `--max-size 500` or `--keep 12`")
+	}
+
+	// The documents of each vault are stored in a separate archive (sub directory)
+	vaultDocumentDirectories, err := getVaultDocumentDirectories(buchhalterConfig.DocumentsDirectory)
+	if err != nil {
+		exitWithLogo(capitalizeFirstLetter(err.Error()))
+	}
+
+	s := strings.Builder{}
+	s.WriteString(headerStyle(LogoText) + "\n\n")
+	numCandidates := 0
+	numPruned := 0
+	numNotUploaded := 0
+	var pruneErrs []error
+	for _, vaultDocumentDirectory := range vaultDocumentDirectories {
+		documentArchive := archive.NewDocumentArchive(logger, vaultDocumentDirectory, buchhalterConfig.DocumentLayout)
+		if err := documentArchive.BuildArchiveIndex(); err != nil {
+			logger.Error("Error building document archive index", "error", err)
+			exitMessage := fmt.Sprintf("Error building document archive index: %s", err)
+			exitWithLogo(exitMessage)
+		}
+		candidates, err := documentArchive.PlanPrune(pruneOptions)
+		if err != nil {
+			exitMessage := fmt.Sprintf("Error selecting the invoices to delete: %s", err)
+			exitWithLogo(exitMessage)
+		}
+		if len(candidates) == 0 {
+			continue
+		}
+
+		// Invoices of premium subscriptions are only deleted, if they exist in Buchhalter API
+		candidates, notUploaded, err := uploadedPruneCandidates(logger, buchhalterConfig, filepath.Base(vaultDocumentDirectory), candidates)
+		if err != nil {
+			logger.Error("Error checking if the invoices exist in Buchhalter API", "directory", vaultDocumentDirectory, "error", err)
+			pruneErrs = append(pruneErrs, err)
+		}
+		numNotUploaded += len(notUploaded)
+		for _, candidate := range notUploaded {
+			s.WriteString(fmt.Sprintf("%s (kept, not uploaded to Buchhalter API)\n", candidate.Path))
+		}
+		numCandidates += len(candidates)
+		for _, candidate := range candidates {
+			s.WriteString(fmt.Sprintf("%s (%s)\n", candidate.Path, candidate.ModTime.Format("2006-01-02")))
+		}
+		if !confirm {
+			continue
+		}
+
+		pruned, err := documentArchive.Prune(candidates)
+		numPruned += pruned
+		logger.Info("Pruned document archive", "directory", vaultDocumentDirectory, "num_pruned", pruned, "num_candidates", len(candidates))
+		if err != nil {
+			logger.Error("Error pruning documents", "error", err)
+			pruneErrs = append(pruneErrs, err)
+		}
+	}
+
+	switch {
+	case numCandidates == 0:
+		s.WriteString(checkMark.Render() + " " + textStyleBold("No invoices to delete") + "\n")
+	case !confirm:
+		s.WriteString(fmt.Sprintf("\n%d invoices would be deleted. Run again with --confirm to delete them.\n", numCandidates))
+	default:
+		s.WriteString(fmt.Sprintf("\nDeleted %d of %d invoices.\n", numPruned, numCandidates))
+	}
+	if numNotUploaded > 0 {
+		s.WriteString(fmt.Sprintf("%d invoices were kept, because they don't exist in Buchhalter API (yet). Run `buchhalter sync` to upload them.\n", numNotUploaded))
+	}
+	fmt.Print(s.String())
+
+	if err := errors.Join(pruneErrs...); err != nil {
+		fmt.Println(errorStyle.Render(err.Error()))
+		os.Exit(1)
+	}
+}
+
+// uploadedPruneCandidates splits candidates of the vault vaultID into the invoices that may be deleted and the ones that don't exist in Buchhalter API.
+// Without a premium subscription for the vault, all invoices may be deleted.
+// If the subscription or the existence of invoices can't be checked, these invoices are kept and an error is returned.
+func uploadedPruneCandidates(logger *slog.Logger, buchhalterConfig *settings.Config, vaultID string, candidates []archive.PruneCandidate) ([]archive.PruneCandidate, []archive.PruneCandidate, error) {
+	selectedVault := getVaultFromVaultListByVaultID(buchhalterConfig.Vaults, vaultID)
+	// The profile only applies to its own vault (or to all vaults, if it doesn't select one)
+	if profiledVault := profileVault(buchhalterConfig); selectedVault != nil && (profiledVault == nil || profiledVault.ID == selectedVault.ID) {
+		selectedVault = applyProfileToVault(buchhalterConfig, selectedVault)
+	}
+	if selectedVault == nil || len(selectedVault.BuchhalterAPIKey) == 0 {
+		return candidates, nil, nil
+	}
+	utils.RegisterSecret(selectedVault.BuchhalterAPIKey)
+
+	buchhalterAPIClient, err := repository.NewBuchhalterAPIClient(logger, buchhalterConfig.APIHost, buchhalterConfig.ConfigDirectory, selectedVault.BuchhalterAPIKey, cliVersion)
+	if err != nil {
+		return nil, candidates, fmt.Errorf("error initializing Buchhalter API client for vault `%s`: %w", selectedVault.Name, err)
+	}
+	buchhalterAPIClient.SetTeam(selectedVault.BuchhalterTeam)
+	user, err := buchhalterAPIClient.GetAuthenticatedUser()
+	if err != nil {
+		return nil, candidates, fmt.Errorf("error retrieving a premium subscription to Buchhalter API for vault `%s`: %w", selectedVault.Name, err)
+	}
+	if user == nil || len(user.User.ID) == 0 {
+		logger.Info("No premium subscription for vault, skipping the existence check of pruned documents", "vault", selectedVault.Name)
+		return candidates, nil, nil
+	}
+
+	checksums := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		checksums = append(checksums, candidate.Hash)
+	}
+	chunkSize := buchhalterConfig.UploadExistenceChunkSize
+	concurrency := buchhalterConfig.UploadExistenceConcurrency
+	if err := repository.ValidateExistenceCheckOptions(chunkSize, concurrency); err != nil {
+		chunkSize, concurrency = repository.DefaultExistenceCheckChunkSize, repository.DefaultExistenceCheckConcurrency
+	}
+	if existenceTimeout, err := time.ParseDuration(buchhalterConfig.UploadExistenceTimeout); err == nil {
+		buchhalterAPIClient.SetExistenceCheckTimeout(existenceTimeout)
+	}
+	buchhalterAPIClient.SetExistenceCheckAttempts(buchhalterConfig.UploadExistenceAttempts)
+	existence, existenceErr := buchhalterAPIClient.DocumentsExist(checksums, chunkSize, concurrency)
+
+	uploaded := []archive.PruneCandidate{}
+	notUploaded := []archive.PruneCandidate{}
+	for _, candidate := range candidates {
+		if existence[candidate.Hash] {
+			uploaded = append(uploaded, candidate)
+			continue
+		}
+		notUploaded = append(notUploaded, candidate)
+	}
+	if existenceErr != nil {
+		existenceErr = fmt.Errorf("error checking if the invoices of vault `%s` exist in Buchhalter API: %w", selectedVault.Name, existenceErr)
+	}
+
+	return uploaded, notUploaded, existenceErr
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// archiveCmd represents the archive command
+var archiveCmd = &cobra.Command{
+	Use:   "archive",
+	Short: "Sub-Commands to work with the local document archive",
+	Long:  `Sub-Commands to work with the local document archive (the invoices in the buchhalter directory).`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println("Nothing to see here. Try `buchhalter help archive`.")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(archiveCmd)
+}
+
+// getVaultDocumentDirectories returns the document directories of all vaults.
+// The documents of each vault are stored in a separate sub directory (archive) of buchhalterDocumentsDirectory.
+func getVaultDocumentDirectories(buchhalterDocumentsDirectory string) ([]string, error) {
+	entries, err := os.ReadDir(buchhalterDocumentsDirectory)
+	if err != nil {
+		return nil, fmt.Errorf("error reading documents directory %s: %w", buchhalterDocumentsDirectory, err)
+	}
+
+	directories := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), "_") || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		directories = append(directories, filepath.Join(buchhalterDocumentsDirectory, entry.Name()))
+	}
+
+	return directories, nil
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"buchhalter/lib/utils"
+)
+
+// configExportCmd represents the `config export` command
+var configExportCmd = &cobra.Command{
+	Use:   "export <file>",
+	Short: "Exports the configuration into an encrypted bundle",
+	Long: `Exports the configuration directory (~/.buchhalter) into a single bundle encrypted with a passphrase, e.g. to move to a new machine.
+The bundle contains the configuration file (incl. vaults and API keys) and the secrets (e.g. OAuth2 tokens), but no documents.
+Restore it with ` + "`buchhalter config import <file>`" + `.
+
+The passphrase is prompted or read from ` + configBundlePassphraseEnv + `.`,
+	Args: cobra.ExactArgs(1),
+	Run:  RunConfigExportCommand,
+}
+
+func init() {
+	configCmd.AddCommand(configExportCmd)
+}
+
+func RunConfigExportCommand(cmd *cobra.Command, cmdArgs []string) {
+	bundleFile := strings.TrimSpace(cmdArgs[0])
+	buchhalterConfigDirectory := viper.GetString("buchhalter_config_directory")
+
+	// The bundle would contain itself on the next export
+	if absoluteBundleFile, err := filepath.Abs(bundleFile); err == nil {
+		if absoluteConfigDirectory, err := filepath.Abs(buchhalterConfigDirectory); err == nil && strings.HasPrefix(absoluteBundleFile, absoluteConfigDirectory+string(filepath.Separator)) {
+			exitWithLogo(fmt.Sprintf("The bundle can't be written into the configuration directory %s", buchhalterConfigDirectory))
+		}
+	}
+
+	homeDirectory, _ := os.UserHomeDir()
+	bundle, err := utils.NewConfigBundle(buchhalterConfigDirectory, homeDirectory, cliVersion, time.Now())
+	if err != nil {
+		exitWithLogo(capitalizeFirstLetter(err.Error()))
+	}
+
+	passphrase, err := readConfigBundlePassphrase(true)
+	if err != nil {
+		exitWithLogo(capitalizeFirstLetter(err.Error()))
+	}
+	encrypted, err := utils.EncryptConfigBundle(bundle, passphrase)
+	if err != nil {
+		exitWithLogo(capitalizeFirstLetter(err.Error()))
+	}
+	if err := os.WriteFile(bundleFile, encrypted, 0600); err != nil {
+		exitWithLogo(fmt.Sprintf("Error writing configuration bundle %s: %s", bundleFile, err))
+	}
+
+	fmt.Println(checkMark.Render() + " " + textStyleBold(fmt.Sprintf("Exported %d files of %s into %s", len(bundle.Files), buchhalterConfigDirectory, bundleFile)))
+	for _, name := range bundle.FileNames() {
+		fmt.Println("   - " + name)
+	}
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"buchhalter/lib/utils"
+)
+
+// configGetCmd represents the `config get` command
+var configGetCmd = &cobra.Command{
+	Use:   "get [key]",
+	Short: "Prints the value of a setting",
+	Long: `Prints the value of a setting, e.g. ` + "`buchhalter config get buchhalter_document_layout`" + `.
+Without a key, all known settings are printed (one ` + "`key: value`" + ` per line).
+Lists and structured values are printed as JSON.`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  RunConfigGetCommand,
+}
+
+func init() {
+	configCmd.AddCommand(configGetCmd)
+}
+
+func RunConfigGetCommand(cmd *cobra.Command, cmdArgs []string) {
+	if len(cmdArgs) == 1 {
+		key, _, err := lookupConfigKey(cmdArgs[0])
+		if err != nil {
+			exitWithLogo(capitalizeFirstLetter(err.Error()))
+		}
+		fmt.Println(utils.FormatConfigValue(viper.Get(key)))
+		return
+	}
+
+	for _, key := range knownConfigKeys() {
+		fmt.Printf("%s: %s\n", key, utils.FormatConfigValue(viper.Get(key)))
+	}
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"buchhalter/lib/utils"
+)
+
+// configBundlePathSettings are the settings with paths, moved to the home directory of the importing user
+var configBundlePathSettings = []string{
+	"buchhalter_directory",
+	"buchhalter_config_directory",
+	"buchhalter_config_file",
+	"buchhalter_staging_directory",
+	"buchhalter_status_file",
+	"credential_provider_keepass_file",
+	"credential_provider_keepass_key_file",
+	"credential_provider_file",
+}
+
+// configImportCmd represents the `config import` command
+var configImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Restores the configuration from an encrypted bundle",
+	Long: `Restores the configuration directory (~/.buchhalter) from a bundle of ` + "`buchhalter config export`" + `.
+Existing files with a different content are kept as backup (` + "`<file>.bak`" + `).
+Paths in the home directory of the exporting user (e.g. ` + "`buchhalter_directory`" + `) are moved to the home directory of the current user.
+
+The passphrase is prompted or read from ` + configBundlePassphraseEnv + `.`,
+	Args: cobra.ExactArgs(1),
+	Run:  RunConfigImportCommand,
+}
+
+func init() {
+	configCmd.AddCommand(configImportCmd)
+}
+
+func RunConfigImportCommand(cmd *cobra.Command, cmdArgs []string) {
+	bundleFile := cmdArgs[0]
+	buchhalterConfigDirectory := viper.GetString("buchhalter_config_directory")
+
+	encrypted, err := os.ReadFile(bundleFile)
+	if err != nil {
+		exitWithLogo(fmt.Sprintf("Error reading configuration bundle %s: %s", bundleFile, err))
+	}
+	passphrase, err := readConfigBundlePassphrase(false)
+	if err != nil {
+		exitWithLogo(capitalizeFirstLetter(err.Error()))
+	}
+	bundle, err := utils.DecryptConfigBundle(encrypted, passphrase)
+	if err != nil {
+		exitWithLogo(capitalizeFirstLetter(err.Error()))
+	}
+
+	restoredFiles, err := bundle.Restore(buchhalterConfigDirectory)
+	if err != nil {
+		exitWithLogo(capitalizeFirstLetter(err.Error()))
+	}
+
+	// The restored configuration file replaces the configuration of this run
+	configFile := viper.GetString("buchhalter_config_file")
+	if err := viper.ReadInConfig(); err != nil {
+		exitWithLogo(fmt.Sprintf("Error reading restored config file %s: %s", configFile, err))
+	}
+	homeDirectory, _ := os.UserHomeDir()
+	if homeDirectory != bundle.HomeDirectory {
+		for _, key := range configBundlePathSettings {
+			if path := viper.GetString(key); len(path) > 0 {
+				viper.Set(key, utils.RebaseHomeDirectory(path, bundle.HomeDirectory, homeDirectory))
+			}
+		}
+		if err := viper.WriteConfigAs(configFile); err != nil {
+			exitWithLogo(fmt.Sprintf("Error writing config file %s: %s", configFile, err))
+		}
+	}
+
+	fmt.Println(checkMark.Render() + " " + textStyleBold(fmt.Sprintf("Imported %d files (exported %s with buchhalter-cli %s) into %s", len(restoredFiles), bundle.CreatedAt.Local().Format("2006-01-02 15:04"), bundle.CliVersion, buchhalterConfigDirectory)))
+	for _, file := range restoredFiles {
+		fmt.Println("   - " + file)
+	}
+}
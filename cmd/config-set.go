@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"buchhalter/lib/utils"
+)
+
+// configSetCmd represents the `config set` command
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Changes the value of a setting",
+	Long: `Changes the value of a setting in the configuration file, e.g. ` + "`buchhalter config set buchhalter_max_download_files_per_receipt 5`" + `.
+Only known settings are accepted and the value is checked against the type of the setting.
+Lists are set comma separated (e.g. ` + "`buchhalter config set buchhalter_suppliers_exclude aws,hetzner`" + `).
+Structured settings (e.g. ` + "`credential_provider_vaults`" + `) can only be changed in the configuration file.`,
+	Args: cobra.ExactArgs(2),
+	Run:  RunConfigSetCommand,
+}
+
+func init() {
+	configCmd.AddCommand(configSetCmd)
+}
+
+func RunConfigSetCommand(cmd *cobra.Command, cmdArgs []string) {
+	key, defaultValue, err := lookupConfigKey(cmdArgs[0])
+	if err != nil {
+		exitWithLogo(capitalizeFirstLetter(err.Error()))
+	}
+	value, err := utils.ParseConfigValue(key, defaultValue, cmdArgs[1])
+	if err != nil {
+		exitWithLogo(capitalizeFirstLetter(err.Error()))
+	}
+	if err := validateConfigValue(key, value); err != nil {
+		exitWithLogo(capitalizeFirstLetter(err.Error()))
+	}
+
+	viper.Set(key, value)
+	configFile := viper.GetString("buchhalter_config_file")
+	if err := viper.WriteConfigAs(configFile); err != nil {
+		exitMessage := fmt.Sprintf("Error writing config file %s: %s", configFile, err)
+		exitWithLogo(exitMessage)
+	}
+
+	fmt.Println(checkMark.Render() + " " + textStyleBold(fmt.Sprintf("Set `%s` to `%s`", key, utils.FormatConfigValue(value))))
+}
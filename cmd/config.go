@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/x/term"
+	"github.com/mattn/go-isatty"
+	"github.com/spf13/cobra"
+
+	"buchhalter/lib/archive"
+	"buchhalter/lib/parser"
+	"buchhalter/lib/postprocess"
+	"buchhalter/lib/repository"
+	"buchhalter/lib/vault"
+)
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Sub-Commands to read and change the configuration",
+	Long:  `Sub-Commands to read and change the settings of the configuration file (~/.buchhalter/.buchhalter.yaml).`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println("Nothing to see here. Try `buchhalter help config`.")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+}
+
+// knownConfigKeys returns the sorted keys of all known settings.
+func knownConfigKeys() []string {
+	keys := make([]string, 0, len(configDefaults))
+	for key := range configDefaults {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// lookupConfigKey returns the normalized key and the default value of a known setting.
+func lookupConfigKey(key string) (string, interface{}, error) {
+	key = strings.ToLower(strings.TrimSpace(key))
+	defaultValue, ok := configDefaults[key]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown setting `%s` (known settings: %s)", key, strings.Join(knownConfigKeys(), ", "))
+	}
+
+	return key, defaultValue, nil
+}
+
+// validateConfigValue checks the value of settings with a restricted set of values.
+func validateConfigValue(key string, value interface{}) error {
+	switch key {
+	case "buchhalter_document_layout":
+		if !archive.IsSupportedLayout(value.(string)) {
+			return fmt.Errorf("unsupported value `%s` for `%s` (supported: %s)", value, key, strings.Join(archive.Layouts, ", "))
+		}
+	case "buchhalter_dedup_scope":
+		if !archive.IsSupportedDedupScope(value.(string)) {
+			return fmt.Errorf("unsupported value `%s` for `%s` (supported: %s)", value, key, strings.Join(archive.DedupScopes, ", "))
+		}
+	case "buchhalter_pdf_merge":
+		if !postprocess.IsSupportedMergeMode(value.(string)) {
+			return fmt.Errorf("unsupported value `%s` for `%s`", value, key)
+		}
+	case "buchhalter_staging_cleanup_age":
+		if _, err := time.ParseDuration(value.(string)); err != nil {
+			return fmt.Errorf("invalid value `%s` for `%s` (expected a duration like `24h`): %w", value, key, err)
+		}
+	case "buchhalter_oicdb_update_timeout":
+		if timeout, err := time.ParseDuration(value.(string)); err != nil || timeout <= 0 {
+			return fmt.Errorf("invalid value `%s` for `%s` (expected a duration like `30s`)", value, key)
+		}
+	case "buchhalter_oicdb_update_attempts":
+		if value.(int) < 1 {
+			return fmt.Errorf("invalid value `%d` for `%s`: must be at least 1", value, key)
+		}
+	case "buchhalter_status_interval":
+		if len(value.(string)) == 0 {
+			break
+		}
+		if interval, err := time.ParseDuration(value.(string)); err != nil || interval < 0 {
+			return fmt.Errorf("invalid value `%s` for `%s` (expected a duration like `24h`)", value, key)
+		}
+	case "buchhalter_totp_clock_skew":
+		skew, err := time.ParseDuration(value.(string))
+		if err != nil {
+			return fmt.Errorf("invalid value `%s` for `%s` (expected a duration like `3s`): %w", value, key, err)
+		}
+		if err := vault.ValidateTotpClockSkew(skew); err != nil {
+			return fmt.Errorf("invalid value `%s` for `%s`: %w", value, key, err)
+		}
+	case "buchhalter_webhook_url":
+		if len(value.(string)) == 0 {
+			break
+		}
+		if webhookUrl, err := url.Parse(value.(string)); err != nil || (webhookUrl.Scheme != "http" && webhookUrl.Scheme != "https") || len(webhookUrl.Host) == 0 {
+			return fmt.Errorf("invalid value `%s` for `%s` (expected an http or https URL)", value, key)
+		}
+	case "buchhalter_download_concurrency":
+		if err := parser.ValidateDownloadConcurrency(value.(int)); err != nil {
+			return fmt.Errorf("invalid value `%d` for `%s`: %w", value, key, err)
+		}
+	case "buchhalter_max_download_files_per_receipt":
+		if value.(int) < 0 {
+			return fmt.Errorf("invalid value `%d` for `%s`: must not be negative", value, key)
+		}
+	case "buchhalter_upload_existence_chunk_size":
+		if err := repository.ValidateExistenceCheckOptions(value.(int), repository.DefaultExistenceCheckConcurrency); err != nil {
+			return fmt.Errorf("invalid value `%d` for `%s`: %w", value, key, err)
+		}
+	case "buchhalter_upload_existence_concurrency":
+		if err := repository.ValidateExistenceCheckOptions(repository.DefaultExistenceCheckChunkSize, value.(int)); err != nil {
+			return fmt.Errorf("invalid value `%d` for `%s`: %w", value, key, err)
+		}
+	case "buchhalter_upload_existence_timeout":
+		if timeout, err := time.ParseDuration(value.(string)); err != nil || timeout <= 0 {
+			return fmt.Errorf("invalid value `%s` for `%s` (expected a duration like `10s`)", value, key)
+		}
+	case "buchhalter_upload_existence_attempts":
+		if value.(int) < 1 {
+			return fmt.Errorf("invalid value `%d` for `%s`: must be at least 1", value, key)
+		}
+	}
+
+	return nil
+}
+
+// configBundlePassphraseEnv is the environment variable with the passphrase of a configuration bundle (e.g. for scripts).
+const configBundlePassphraseEnv = "BUCHHALTER_BUNDLE_PASSPHRASE"
+
+// readConfigBundlePassphrase reads the passphrase of a configuration bundle from BUCHHALTER_BUNDLE_PASSPHRASE
+// or prompts it on the terminal (without echo). With confirm, the passphrase is prompted twice.
+func readConfigBundlePassphrase(confirm bool) (string, error) {
+	if passphrase, ok := os.LookupEnv(configBundlePassphraseEnv); ok {
+		return passphrase, nil
+	}
+	if !isatty.IsTerminal(os.Stdin.Fd()) {
+		return "", fmt.Errorf("no terminal to prompt for the passphrase of the configuration bundle, set %s", configBundlePassphraseEnv)
+	}
+
+	fmt.Fprint(os.Stderr, "Passphrase of the configuration bundle: ")
+	passphrase, err := term.ReadPassword(os.Stdin.Fd())
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("error reading passphrase: %w", err)
+	}
+	if confirm {
+		fmt.Fprint(os.Stderr, "Repeat the passphrase: ")
+		repeated, err := term.ReadPassword(os.Stdin.Fd())
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("error reading passphrase: %w", err)
+		}
+		if string(repeated) != string(passphrase) {
+			return "", errors.New("the passphrases don't match")
+		}
+	}
+
+	return string(passphrase), nil
+}
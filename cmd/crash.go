@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"buchhalter/lib/repository"
+	"buchhalter/lib/utils"
+)
+
+// handleCrash writes the redacted crash report of a recovered panic into `<buchhalter_directory>/crash-reports/`
+// and sends it to Buchhalter API, if the user opted in (`buchhalter_send_crash_reports`) and `DO_NOT_TRACK` isn't set.
+// It returns the message for the user.
+func handleCrash(recovered interface{}, stackTrace []byte, command string) string {
+	report := utils.NewCrashReport(recovered, stackTrace, cliVersion, cliCommitHash, cliBuildTime, command, time.Now())
+
+	message := strings.Builder{}
+	message.WriteString("buchhalter-cli crashed unexpectedly.")
+	crashReportDirectory := filepath.Join(viper.GetString("buchhalter_directory"), "crash-reports")
+	reportFile, err := utils.WriteCrashReport(crashReportDirectory, report)
+	if err != nil {
+		message.WriteString(fmt.Sprintf(" The crash report couldn't be written: %s", err))
+	} else {
+		message.WriteString(fmt.Sprintf(" A crash report (without credentials) was written to %s, please attach it to an issue at https://github.com/buchhalter-ai/buchhalter-ai-cli/issues", reportFile))
+	}
+
+	if viper.GetBool("buchhalter_send_crash_reports") && !viper.GetBool("dev") && !repository.DoNotTrack() {
+		// The log file can't be used anymore, the crash might come from the logger
+		logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+		buchhalterAPIClient, err := repository.NewBuchhalterAPIClient(logger, viper.GetString("buchhalter_api_host"), viper.GetString("buchhalter_config_directory"), "", cliVersion)
+		if err == nil {
+			err = buchhalterAPIClient.SendCrashReport(report)
+		}
+		if err != nil {
+			message.WriteString(fmt.Sprintf("\nThe crash report couldn't be sent to Buchhalter API: %s", err))
+		} else {
+			message.WriteString("\nThe crash report was sent to Buchhalter API, thank you!")
+		}
+	}
+
+	return message.String()
+}
+
+// exitOnCrash handles a panic of the main goroutine, it must be deferred.
+func exitOnCrash() {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+
+	command := rootCmd.Name()
+	if cmd, _, err := rootCmd.Find(os.Args[1:]); err == nil {
+		command = cmd.CommandPath()
+	}
+	fmt.Println(handleCrash(recovered, debug.Stack(), command))
+	os.Exit(2)
+}
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"buchhalter/lib/parser"
+)
+
+// recipesLintCmd represents the `recipes lint` command
+var recipesLintCmd = &cobra.Command{
+	Use:   "lint [supplier]",
+	Short: "Checks recipes for brittle selectors and timing patterns",
+	Long: `Checks all loaded recipes (or only the one of a specific supplier) for patterns that break often:
+very long absolute XPaths, selectors without a selectorType, clicks without a preceding waitFor and sleep-based timing.
+
+Local recipes are included when running with --dev.`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  RunRecipesLintCommand,
+}
+
+func init() {
+	recipesLintCmd.Flags().Bool("json", false, "output the findings as JSON")
+	recipesCmd.AddCommand(recipesLintCmd)
+}
+
+func RunRecipesLintCommand(cmd *cobra.Command, args []string) {
+	supplier := ""
+	if len(args) > 0 {
+		supplier = args[0]
+	}
+
+	// Init logging
+	buchhalterDirectory := viper.GetString("buchhalter_directory")
+	buchhalterConfigDirectory := viper.GetString("buchhalter_config_directory")
+	developmentMode := viper.GetBool("dev")
+	logSetting, err := cmd.Flags().GetBool("log")
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error reading log flag: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	jsonOutput, err := cmd.Flags().GetBool("json")
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error reading json flag: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	logger, err := initializeLogger(logSetting, developmentMode, buchhalterDirectory)
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error on initializing logging: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	logger.Info("Booting up", "development_mode", developmentMode)
+	defer logger.Info("Shutting down")
+
+	recipeParser := parser.NewRecipeParser(logger, buchhalterConfigDirectory, buchhalterDirectory)
+	if _, err := recipeParser.LoadRecipes(developmentMode); err != nil {
+		logger.Error("Error loading recipes for suppliers", "error", err)
+		exitMessage := fmt.Sprintf("Error loading recipes: %s", err)
+		exitWithLogo(exitMessage)
+	}
+
+	findings := []parser.LintFinding{}
+	lintedRecipes := 0
+	for _, recipe := range recipeParser.GetRecipes() {
+		if len(supplier) > 0 && recipe.Supplier != supplier {
+			continue
+		}
+		lintedRecipes++
+		findings = append(findings, parser.LintRecipe(recipe)...)
+	}
+	logger.Info("Linted recipes", "num_recipes", lintedRecipes, "num_findings", len(findings))
+
+	if len(supplier) > 0 && lintedRecipes == 0 {
+		exitMessage := fmt.Sprintf("No recipe found for supplier `%s`", supplier)
+		exitWithLogo(exitMessage)
+	}
+
+	if jsonOutput {
+		findingsJSON, err := json.MarshalIndent(findings, "", "  ")
+		if err != nil {
+			fmt.Printf("Error encoding findings as JSON: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(findingsJSON))
+	} else {
+		fmt.Println(renderLintFindings(lintedRecipes, findings))
+	}
+
+	// Findings with severity error make the recipe unusable
+	for _, finding := range findings {
+		if finding.Severity == parser.LintSeverityError {
+			os.Exit(1)
+		}
+	}
+}
+
+func renderLintFindings(lintedRecipes int, findings []parser.LintFinding) string {
+	s := strings.Builder{}
+	s.WriteString(headerStyle(LogoText) + "\n\n")
+
+	if len(findings) == 0 {
+		s.WriteString(checkMark.Render() + " " + textStyleBold(fmt.Sprintf("Linted %d recipes, no findings", lintedRecipes)) + "\n")
+		return s.String()
+	}
+
+	for _, finding := range findings {
+		switch finding.Severity {
+		case parser.LintSeverityError:
+			s.WriteString(errorStyle.Render(finding.String()) + "\n")
+		case parser.LintSeverityWarning:
+			s.WriteString(textStyleBold(finding.String()) + "\n")
+		default:
+			s.WriteString(finding.String() + "\n")
+		}
+	}
+	s.WriteString(fmt.Sprintf("\nLinted %d recipes, %d findings\n", lintedRecipes, len(findings)))
+
+	return s.String()
+}
@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"buchhalter/lib/parser"
+)
+
+// recipesListCmd represents the `recipes list` command
+var recipesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists the loaded recipes with their tags",
+	Long: `Lists all loaded recipes (supplier, version, type and tags).
+With --tag, only the recipes with one of the tags are listed, like the suppliers ` + "`buchhalter sync --tag`" + ` runs.
+
+Local recipes are included when running with --dev.`,
+	Args: cobra.NoArgs,
+	Run:  RunRecipesListCommand,
+}
+
+func init() {
+	recipesListCmd.Flags().StringSlice("tag", []string{}, "List only the recipes with one of these tags (e.g. --tag hosting,saas)")
+	recipesListCmd.Flags().Bool("json", false, "output the recipes as JSON")
+	recipesCmd.AddCommand(recipesListCmd)
+}
+
+// recipeListEntry is a recipe of `recipes list --json`.
+type recipeListEntry struct {
+	Supplier string   `json:"supplier"`
+	Version  string   `json:"version"`
+	Type     string   `json:"type"`
+	Tags     []string `json:"tags"`
+}
+
+func RunRecipesListCommand(cmd *cobra.Command, args []string) {
+	// Init logging
+	buchhalterDirectory := viper.GetString("buchhalter_directory")
+	buchhalterConfigDirectory := viper.GetString("buchhalter_config_directory")
+	developmentMode := viper.GetBool("dev")
+	logSetting, err := cmd.Flags().GetBool("log")
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error reading log flag: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	tags, err := cmd.Flags().GetStringSlice("tag")
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error reading tag flag: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	jsonOutput, err := cmd.Flags().GetBool("json")
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error reading json flag: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	logger, err := initializeLogger(logSetting, developmentMode, buchhalterDirectory)
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error on initializing logging: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	logger.Info("Booting up", "development_mode", developmentMode)
+	defer logger.Info("Shutting down")
+
+	recipeParser := parser.NewRecipeParser(logger, buchhalterConfigDirectory, buchhalterDirectory)
+	if _, err := recipeParser.LoadRecipes(developmentMode); err != nil {
+		logger.Error("Error loading recipes for suppliers", "error", err)
+		exitMessage := fmt.Sprintf("Error loading recipes: %s", err)
+		exitWithLogo(exitMessage)
+	}
+
+	tagFilter := parser.NewTagFilter(tags)
+	entries := []recipeListEntry{}
+	for _, recipe := range recipeParser.GetRecipes() {
+		if !tagFilter.Allows(recipe) {
+			continue
+		}
+		recipeTags := recipe.Tags
+		if recipeTags == nil {
+			recipeTags = []string{}
+		}
+		entries = append(entries, recipeListEntry{Supplier: recipe.Supplier, Version: recipe.Version, Type: recipe.Type, Tags: recipeTags})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return strings.ToLower(entries[i].Supplier) < strings.ToLower(entries[j].Supplier)
+	})
+	logger.Info("Listed recipes", "num_recipes", len(entries), "tags", tags)
+
+	if jsonOutput {
+		entriesJSON, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			fmt.Printf("Error encoding recipes as JSON: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(entriesJSON))
+		return
+	}
+	fmt.Println(renderRecipeList(entries, tagFilter.IsEmpty()))
+}
+
+func renderRecipeList(entries []recipeListEntry, allRecipes bool) string {
+	s := strings.Builder{}
+	s.WriteString(headerStyle(LogoText) + "\n\n")
+
+	if len(entries) == 0 {
+		if allRecipes {
+			s.WriteString(inactiveMark.Render() + " No recipes loaded\n")
+		} else {
+			s.WriteString(inactiveMark.Render() + " No recipes with these tags\n")
+		}
+		return s.String()
+	}
+
+	for _, entry := range entries {
+		s.WriteString(fmt.Sprintf("%s %s (%s, %s)", checkMark.Render(), textStyleBold(entry.Supplier), entry.Type, entry.Version))
+		if len(entry.Tags) > 0 {
+			s.WriteString(" " + strings.Join(entry.Tags, ", "))
+		}
+		s.WriteString("\n")
+	}
+	s.WriteString(fmt.Sprintf("\n%d recipes\n", len(entries)))
+
+	return s.String()
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"buchhalter/lib/parser"
+)
+
+// recipesNewCmd represents the `recipes new` command
+var recipesNewCmd = &cobra.Command{
+	Use:   "new <supplier>",
+	Short: "Creates a skeleton recipe for a supplier in the local recipes",
+	Long: `Creates a browser recipe for a supplier in the local recipes (` + "`_local/recipes/<supplier>.json`" + ` of the buchhalter directory).
+The recipe logs in (open, type, type, click) and downloads the invoices (downloadAll, move).
+Its selectors and urls are placeholders, adapt them to the portal of the supplier.
+
+The recipe is validated against the OICDB schema. Run it with ` + "`buchhalter sync <supplier> --dev`" + `.`,
+	Args: cobra.ExactArgs(1),
+	Run:  RunRecipesNewCommand,
+}
+
+func init() {
+	recipesNewCmd.Flags().String("domain", "", "Domain of the supplier to match the vault items with (default: <supplier>.com)")
+	recipesNewCmd.Flags().Bool("force", false, "Replace an existing local recipe of the supplier")
+	recipesCmd.AddCommand(recipesNewCmd)
+}
+
+func RunRecipesNewCommand(cmd *cobra.Command, args []string) {
+	supplier := strings.TrimSpace(args[0])
+	buchhalterConfig := loadConfig()
+
+	domain, err := cmd.Flags().GetString("domain")
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error reading domain flag: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	force, err := cmd.Flags().GetBool("force")
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error reading force flag: %s", err)
+		exitWithLogo(exitMessage)
+	}
+
+	file, err := parser.ScaffoldRecipe(buchhalterConfig.Directory, buchhalterConfig.ConfigDirectory, supplier, domain, force)
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error creating recipe for supplier `%s`: %s", supplier, err)
+		if errors.Is(err, parser.ErrRecipeExists) {
+			exitMessage += " (use `--force` to replace it)"
+		}
+		exitWithLogo(exitMessage)
+	}
+
+	fmt.Println(headerStyle(LogoText))
+	fmt.Println()
+	fmt.Println(checkMark.Render() + " " + textStyleBold(fmt.Sprintf("Created recipe %s", file)))
+	fmt.Println()
+	fmt.Printf("Adapt the urls and selectors to the portal of %s, then check and run the recipe:\n", supplier)
+	fmt.Printf("  buchhalter recipes lint %s --dev\n", supplier)
+	fmt.Printf("  buchhalter sync %s --dev\n", supplier)
+}
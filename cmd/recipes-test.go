@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"buchhalter/lib/browser"
+	"buchhalter/lib/parser"
+)
+
+// recipeTestsDirectory is the directory of the diagnostics of `recipes test` within the buchhalter directory
+const recipeTestsDirectory = "_local/recipe-tests"
+
+// recipesTestCmd represents the `recipes test` command
+var recipesTestCmd = &cobra.Command{
+	Use:   "test <supplier>",
+	Short: "Runs the recipe of a single supplier with diagnostics",
+	Long: `Runs the recipe of a single supplier in isolation, e.g. while writing a recipe.
+The local recipe (` + "`_local/recipes/<supplier>.json`" + `) is preferred over the recipe of the OICDB.
+
+The recipe runs like ` + "`buchhalter sync --recipe-file`" + ` with the debug options:
+the console messages of the pages are logged (` + "`--verbose-browser`" + `), the downloads are kept (` + "`--keep-downloads`" + `)
+and the transcript and a screenshot of each step are written into ` + "`_local/recipe-tests`" + ` of the buchhalter directory.
+Documents are not uploaded to Buchhalter API and no usage metrics are sent.
+Afterwards, the result of each step is printed.
+
+Without --vault-item, the vault items are matched by the domains of the recipe.`,
+	Args: cobra.ExactArgs(1),
+	Run:  RunRecipesTestCommand,
+}
+
+func init() {
+	recipesTestCmd.Flags().String("vault-item", "", "ID or title of the vault item to run the recipe with")
+	recipesCmd.AddCommand(recipesTestCmd)
+}
+
+func RunRecipesTestCommand(cmd *cobra.Command, args []string) {
+	supplier := strings.TrimSpace(args[0])
+
+	buchhalterConfig := loadConfig()
+	vaultItem, err := cmd.Flags().GetString("vault-item")
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error reading vault-item flag: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	// Like `--verbose-browser` of the sync, the test logs at debug level into the log file
+	logger, err := initializeLogger(true, true, buchhalterConfig.Directory)
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error on initializing logging: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	logger.Info("Booting up", "development_mode", buchhalterConfig.Dev)
+	defer logger.Info("Shutting down")
+
+	diagnosticsDirectory := filepath.Join(buchhalterConfig.Directory, recipeTestsDirectory, fmt.Sprintf("%s-%s", supplier, time.Now().Format("20060102-150405")))
+	if err := os.MkdirAll(diagnosticsDirectory, 0755); err != nil {
+		exitMessage := fmt.Sprintf("Error creating directory for the diagnostics: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	recipeParser := parser.NewRecipeParser(logger, buchhalterConfig.ConfigDirectory, buchhalterConfig.Directory)
+	recipeFile, err := recipeParser.RecipeTestFile(supplier, diagnosticsDirectory)
+	if err != nil {
+		logger.Error("Error finding the recipe to test", "supplier", supplier, "error", err)
+		exitWithLogo(capitalizeFirstLetter(err.Error()))
+	}
+
+	// The test is a sync of the recipe file with the debug options
+	viper.Set("cmd-arg-recipe-file", recipeFile)
+	viper.Set("cmd-arg-verbose-browser", true)
+	viper.Set("cmd-arg-keep-downloads", true)
+	viper.Set("cmd-arg-transcript", diagnosticsDirectory)
+	viper.Set("cmd-arg-screenshots", diagnosticsDirectory)
+	viper.Set("cmd-arg-no-upload", true)
+	viper.Set("cmd-arg-no-metrics", true)
+	result := runSync(cmd, []string{strings.TrimSpace(vaultItem)})
+
+	fmt.Print(renderRecipeTest(logger, diagnosticsDirectory, filepath.Join(buchhalterConfig.Directory, "buchhalter-cli.log")))
+	if exitCode := result.ExitCode(); exitCode != 0 {
+		os.Exit(exitCode)
+	}
+}
+
+// renderRecipeTest renders the steps of the transcripts in diagnosticsDirectory (one per vault item the recipe ran with).
+// Client and http recipes have no transcript, their result is shown by the sync only.
+func renderRecipeTest(logger *slog.Logger, diagnosticsDirectory, logFile string) string {
+	s := strings.Builder{}
+	s.WriteString("\n")
+
+	transcriptFiles, err := filepath.Glob(filepath.Join(diagnosticsDirectory, "*.transcript.json"))
+	if err != nil {
+		logger.Error("Error listing the transcripts of the recipe test", "directory", diagnosticsDirectory, "error", err)
+	}
+	if len(transcriptFiles) == 0 {
+		s.WriteString(inactiveMark.Render() + " No steps recorded (only browser recipes record their steps)\n")
+	}
+	for _, transcriptFile := range transcriptFiles {
+		transcript, err := browser.ReadTranscript(transcriptFile)
+		if err != nil {
+			logger.Error("Error reading the transcript of the recipe test", "transcript_file", transcriptFile, "error", err)
+			s.WriteString(errorStyle.Render(err.Error()) + "\n")
+			continue
+		}
+		s.WriteString(textStyleBold(fmt.Sprintf("%s %s: %s in %s", transcript.Supplier, transcript.Version, transcript.Transcript.Status, time.Duration(transcript.Transcript.DurationMs)*time.Millisecond)) + "\n\n")
+		s.WriteString(renderRecipeTestSteps(transcript.Transcript.Steps))
+		s.WriteString("\n")
+	}
+	s.WriteString(fmt.Sprintf("Transcripts and screenshots are in %s, the log is %s\n", diagnosticsDirectory, logFile))
+
+	return s.String()
+}
+
+// renderRecipeTestSteps renders the steps as table of the action, duration, status and message.
+func renderRecipeTestSteps(steps []browser.TranscriptStep) string {
+	s := strings.Builder{}
+	w := tabwriter.NewWriter(&s, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STEP\tACTION\tDURATION\tSTATUS\tMESSAGE")
+	for _, step := range steps {
+		message := strings.Join(strings.Fields(step.Message), " ")
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", step.Index, step.Action, time.Duration(step.DurationMs)*time.Millisecond, step.Status, message)
+	}
+	_ = w.Flush()
+
+	return s.String()
+}
@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// recipesCmd represents the recipes command
+var recipesCmd = &cobra.Command{
+	Use:     "recipes",
+	Aliases: []string{"recipe"},
+	Short:   "Sub-Commands to work with OICDB recipes",
+	Long:    `Sub-Commands to work with OICDB recipes (official and local ones).`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println("Nothing to see here. Try `buchhalter help recipes`.")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(recipesCmd)
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	"buchhalter/lib/settings"
 	"buchhalter/lib/utils"
 )
 
@@ -60,13 +61,6 @@ var errorMark = lipgloss.NewStyle().Foreground(lipgloss.Color("212")).SetString(
 var thanksMark = lipgloss.NewStyle().SetString("🙏")
 var inactiveMark = lipgloss.NewStyle().SetString("🔳")
 
-type vaultConfiguration struct {
-	ID               string `json:"id" mapstructure:"id"`
-	Name             string `json:"name" mapstructure:"name"`
-	BuchhalterAPIKey string `json:"buchhalterAPIKey" mapstructure:"buchhalterAPIKey"`
-	Selected         bool   `json:"selected" mapstructure:"selected"`
-}
-
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "buchhalter",
@@ -79,6 +73,7 @@ func Execute(version, commitHash, buildTime string) {
 	cliVersion = version
 	cliCommitHash = commitHash
 	cliBuildTime = buildTime
+	defer exitOnCrash()
 
 	err := rootCmd.Execute()
 	if err != nil {
@@ -106,6 +101,13 @@ func init() {
 		fmt.Printf("Failed to bind 'log' flag: %v\n", err)
 		os.Exit(1)
 	}
+
+	rootCmd.PersistentFlags().String("profile", "", "named profile of the configuration (profiles) to use")
+	err = viper.BindPFlag("cmd-arg-profile", rootCmd.PersistentFlags().Lookup("profile"))
+	if err != nil {
+		fmt.Printf("Failed to bind 'profile' flag: %v\n", err)
+		os.Exit(1)
+	}
 }
 
 func initConfig() {
@@ -115,17 +117,10 @@ func initConfig() {
 	configFile := filepath.Join(buchhalterConfigDir, ".buchhalter.yaml")
 
 	// Set default values for viper config
-	// Documented settings
-	viper.SetDefault("credential_provider_cli_command", "")
-	viper.SetDefault("credential_provider_item_tag", "buchhalter-ai")
-	viper.SetDefault("credential_provider_vaults", []vaultConfiguration{})
-	viper.SetDefault("buchhalter_directory", buchhalterDir)
-	viper.SetDefault("buchhalter_config_directory", buchhalterConfigDir)
-	viper.SetDefault("buchhalter_config_file", configFile)
-	viper.SetDefault("buchhalter_max_download_files_per_receipt", 2)
-	viper.SetDefault("buchhalter_api_host", "https://app.buchhalter.ai/")
-	viper.SetDefault("buchhalter_always_send_metrics", false)
-	viper.SetDefault("dev", false)
+	// The settings with defaults are the known settings of `buchhalter config get/set`
+	for _, setting := range settings.Defaults(homeDir) {
+		setConfigDefault(setting.Key, setting.Default)
+	}
 
 	// Non documented settings (on purpose)
 	// - buchhalter_documents_directory
@@ -203,6 +198,29 @@ func initializeLogger(logSetting, developmentMode bool, buchhalterDir string) (*
 	return logger, nil
 }
 
+// configDefaults are the default values of the known settings (see setConfigDefault).
+var configDefaults = map[string]interface{}{}
+
+// setConfigDefault sets the default value of a setting and registers it as a known setting.
+func setConfigDefault(key string, value interface{}) {
+	configDefaults[key] = value
+	viper.SetDefault(key, value)
+}
+
+// loadConfig reads the typed configuration of a command, it exits on an invalid configuration.
+// Flags of the command (`cmd-arg-*`) are read via viper.
+func loadConfig() *settings.Config {
+	buchhalterConfig, err := settings.Load(viper.GetViper())
+	if err != nil {
+		exitWithLogo(capitalizeFirstLetter(err.Error()))
+	}
+	// The profile overlays the base configuration (`--profile`)
+	if err := buchhalterConfig.ApplyProfile(viper.GetString("cmd-arg-profile")); err != nil {
+		exitWithLogo(capitalizeFirstLetter(err.Error()))
+	}
+	return buchhalterConfig
+}
+
 func exitWithLogo(message string) {
 	s := fmt.Sprintf(
 		"%s\n%s\n%s%s\n%s\n\n%s",
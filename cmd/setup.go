@@ -0,0 +1,497 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"buchhalter/lib/repository"
+	"buchhalter/lib/settings"
+	"buchhalter/lib/setup"
+	"buchhalter/lib/utils"
+	"buchhalter/lib/vault"
+)
+
+// setupCmd represents the `setup` command
+var setupCmd = &cobra.Command{
+	Use:   "setup",
+	Short: "Set up buchhalter-cli step by step (credential provider, vault, API key and directory)",
+	Long: `Walks through the setup of buchhalter-cli: choose the credential provider, select the vault (e.g. the 1Password vault or the pass subtree),
+enter and verify a buchhalter SaaS API key (optional) and confirm the directory of the invoices.
+
+The configuration file is only written at the end, after the setup was confirmed.
+The single steps are available as separate commands as well, e.g. ` + "`buchhalter vault add`" + `.`,
+	Run: RunSetupCommand,
+}
+
+func init() {
+	rootCmd.AddCommand(setupCmd)
+}
+
+func RunSetupCommand(cmd *cobra.Command, args []string) {
+	buchhalterConfig := loadConfig()
+
+	// Init logging
+	buchhalterDirectory := buchhalterConfig.Directory
+	developmentMode := buchhalterConfig.Dev
+	logSetting, err := cmd.Flags().GetBool("log")
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error reading log flag: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	logger, err := initializeLogger(logSetting, developmentMode, buchhalterDirectory)
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error on initializing logging: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	logger.Info("Booting up", "development_mode", developmentMode)
+	defer logger.Info("Shutting down")
+
+	// Init UI
+	spinnerModel := spinner.New()
+	spinnerModel.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("63"))
+
+	textInput := textinput.New()
+	textInput.Width = 64
+
+	wizard := setup.New(setupEnvironment{logger: logger, buchhalterConfig: buchhalterConfig}, buchhalterConfig)
+	viewModel := ViewModelSetup{
+		// UI
+		actionsCompleted: []utils.UIAction{},
+		spinner:          spinnerModel,
+		textInput:        textInput,
+
+		// Wizard
+		wizard: wizard,
+
+		// Cmd
+		logger:           logger,
+		buchhalterConfig: buchhalterConfig,
+	}
+	viewModel = viewModel.prepareStep()
+
+	// Run the program
+	p := tea.NewProgram(&viewModel)
+	if _, err := p.Run(); err != nil {
+		logger.Error("Error running program", "error", err)
+		exitMessage := fmt.Sprintf("Error running program: %s", err)
+		exitWithLogo(exitMessage)
+	}
+}
+
+// setupEnvironment detects the credential providers and verifies API keys for the setup wizard.
+type setupEnvironment struct {
+	logger           *slog.Logger
+	buchhalterConfig *settings.Config
+}
+
+// DetectProvider looks for the CLI of provider, the configured CLI command is only used for the configured provider.
+// KeePass and the credentials file are read by buchhalter-cli itself, they are always available.
+func (e setupEnvironment) DetectProvider(provider string) error {
+	binary := ""
+	if provider == e.buchhalterConfig.CredentialProvider {
+		binary = e.buchhalterConfig.CredentialProviderCliCommand
+	}
+
+	var err error
+	switch provider {
+	case vault.PROVIDER_1PASSWORD:
+		_, err = vault.DetermineBinary(binary, vault.BINARY_NAME_1PASSWORD)
+	case vault.PROVIDER_PASS:
+		_, err = vault.DetermineBinary(binary, vault.BINARY_NAME_PASS)
+	}
+	if err != nil {
+		e.logger.Info("Credential provider not installed", "provider", provider, "error", err)
+	}
+	return err
+}
+
+func (e setupEnvironment) Vaults(provider string, keePassConfig vault.KeePassConfig) ([]vault.Vault, error) {
+	utils.RegisterSecret(keePassConfig.Password)
+	msg := vaultSelectInitCmd(e.logger, e.buchhalterConfig, provider, keePassConfig)
+	if errMsg, ok := msg.(vaultSelectErrorMsg); ok {
+		return nil, errMsg.err
+	}
+	return msg.(vaultSelectInitSuccessMsg).vaults, nil
+}
+
+func (e setupEnvironment) VerifyAPIKey(apiKey string) (bool, string, []repository.Team) {
+	return verifyBuchhalterAPIKey(e.logger, e.buchhalterConfig, apiKey)
+}
+
+type ViewModelSetup struct {
+	// UI
+	actionsCompleted []utils.UIAction
+	actionInProgress string
+	spinner          spinner.Model
+	// busy is set while a step calls a credential provider or Buchhalter API, the wizard must not be read meanwhile
+	busy      bool
+	cursor    int
+	textInput textinput.Model
+	quitting  bool
+
+	// Wizard
+	wizard *setup.Wizard
+
+	// Cmd
+	logger           *slog.Logger
+	buchhalterConfig *settings.Config
+}
+
+// setupStepResultMsg is the result of a step of the setup wizard.
+type setupStepResultMsg struct {
+	message string
+	err     error
+}
+
+// setupWriteConfigMsg is the result of writing the configuration file.
+type setupWriteConfigMsg struct {
+	err error
+}
+
+func (m ViewModelSetup) Init() tea.Cmd {
+	return tea.Batch(m.spinner.Tick, textinput.Blink)
+}
+
+func (m ViewModelSetup) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			return m, tea.Quit
+		}
+		if m.busy || m.quitting {
+			return m, nil
+		}
+
+		switch msg.String() {
+		case "q":
+			// q is a character of the text inputs
+			if !m.showsTextInput() {
+				return m, tea.Quit
+			}
+
+		case "enter":
+			return m.submitStep()
+
+		case "down", "j":
+			if !m.showsTextInput() {
+				m.cursor++
+				if m.cursor >= m.choiceCount() {
+					m.cursor = 0
+				}
+				return m, nil
+			}
+
+		case "up", "k":
+			if !m.showsTextInput() {
+				m.cursor--
+				if m.cursor < 0 {
+					m.cursor = m.choiceCount() - 1
+				}
+				return m, nil
+			}
+		}
+
+	case spinner.TickMsg:
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+
+	case setupStepResultMsg:
+		m.busy = false
+		return m.completeStep(msg.message, msg.err), nil
+
+	case setupWriteConfigMsg:
+		m.busy = false
+		m.actionInProgress = ""
+		if msg.err != nil {
+			m.actionsCompleted = append(m.actionsCompleted, utils.UIAction{
+				Message: fmt.Sprintf("Error writing config file: %s", msg.err),
+				Style:   utils.UIActionStyleError,
+			})
+		} else {
+			m.actionsCompleted = append(m.actionsCompleted, utils.UIAction{
+				Message: fmt.Sprintf("Wrote the configuration to %s. Run `buchhalter sync` to download your invoices", m.buchhalterConfig.ConfigFile),
+				Style:   utils.UIActionStyleSuccess,
+			})
+		}
+		m.quitting = true
+		return m, tea.Quit
+	}
+
+	if m.showsTextInput() {
+		var cmd tea.Cmd
+		m.textInput, cmd = m.textInput.Update(msg)
+		return m, cmd
+	}
+
+	return m, nil
+}
+
+// submitStep submits the selection or the input of the current step.
+// Steps calling a credential provider or Buchhalter API run as command, their result is a setupStepResultMsg.
+func (m ViewModelSetup) submitStep() (tea.Model, tea.Cmd) {
+	w := m.wizard
+	input := strings.TrimSpace(m.textInput.Value())
+
+	switch w.Step() {
+	case setup.StepProvider:
+		choice := w.Providers[m.cursor]
+		m.busy = true
+		m.actionInProgress = fmt.Sprintf("Initializing connection to %s", choice.Name)
+		return m, func() tea.Msg {
+			err := w.ChooseProvider(choice.Provider)
+			return setupStepResultMsg{message: fmt.Sprintf("Selected the credential provider %s", choice.Name), err: err}
+		}
+
+	case setup.StepVault:
+		selectedVault := w.Vaults[m.cursor]
+		err := w.ChooseVault(selectedVault.ID)
+		return m.completeStep(fmt.Sprintf("Selected the %s vault %s", vault.GetProviderName(w.Provider), setupVaultName(selectedVault)), err), nil
+
+	case setup.StepProviderFile:
+		err := w.SetProviderFile(input)
+		return m.completeStep(fmt.Sprintf("Reading credentials from %s", w.ProviderFile), err), nil
+
+	case setup.StepProviderPassword:
+		// The passphrase may contain spaces at its ends
+		password := m.textInput.Value()
+		m.busy = true
+		m.actionInProgress = fmt.Sprintf("Opening the KeePass database %s", w.ProviderFile)
+		return m, func() tea.Msg {
+			err := w.SetProviderPassword(password)
+			return setupStepResultMsg{message: fmt.Sprintf("Opened the KeePass database %s", w.ProviderFile), err: err}
+		}
+
+	case setup.StepAPIKey:
+		if len(input) == 0 {
+			message := "Skipping. No buchhalter SaaS API Key added to buchhalter-cli configuration"
+			if len(w.APIKey) > 0 {
+				message = fmt.Sprintf("Keeping the buchhalter SaaS API Key %s of the vault", maskString(w.APIKey))
+			}
+			return m.completeStep(message, w.SetAPIKey("")), nil
+		}
+		m.busy = true
+		m.actionInProgress = "Validating buchhalter SaaS API Key ..."
+		return m, func() tea.Msg {
+			err := w.SetAPIKey(input)
+			return setupStepResultMsg{message: fmt.Sprintf("buchhalter SaaS API Key %s is valid", maskString(input)), err: err}
+		}
+
+	case setup.StepTeam:
+		team := w.Teams[m.cursor]
+		err := w.ChooseTeam(team.Slug)
+		return m.completeStep(fmt.Sprintf("Selected the team %s to upload documents to", team.Name), err), nil
+
+	case setup.StepDirectory:
+		err := w.SetDirectory(input)
+		return m.completeStep(fmt.Sprintf("Storing the invoices in %s", w.Directory), err), nil
+
+	case setup.StepConfirm:
+		if err := w.Confirm(); err != nil {
+			return m.completeStep("", err), nil
+		}
+		m.busy = true
+		m.actionInProgress = "Writing configuration ..."
+		return m, func() tea.Msg {
+			for key, value := range w.Settings() {
+				viper.Set(key, value)
+			}
+			if err := viper.WriteConfigAs(m.buchhalterConfig.ConfigFile); err != nil {
+				return setupWriteConfigMsg{err: err}
+			}
+			m.logger.Info("Wrote configuration of setup", "provider", w.Provider, "with_api_key", len(w.APIKey) > 0, "team", w.Team)
+			return setupWriteConfigMsg{}
+		}
+	}
+
+	return m, nil
+}
+
+// completeStep shows the result of a step and prepares the next one.
+// On errors, the step is shown again.
+func (m ViewModelSetup) completeStep(message string, err error) ViewModelSetup {
+	if err != nil {
+		m.logger.Error("Error in setup step", "step", m.wizard.Step(), "error", err)
+		m.actionsCompleted = append(m.actionsCompleted, utils.UIAction{
+			Message: err.Error(),
+			Style:   utils.UIActionStyleError,
+		})
+	} else {
+		m.actionsCompleted = append(m.actionsCompleted, utils.UIAction{
+			Message: message,
+			Style:   utils.UIActionStyleSuccess,
+		})
+	}
+	return m.prepareStep()
+}
+
+// prepareStep sets the prompt, the cursor and the text input of the current step.
+func (m ViewModelSetup) prepareStep() ViewModelSetup {
+	w := m.wizard
+	m.cursor = 0
+	m.textInput.Reset()
+	m.textInput.Blur()
+	m.textInput.CharLimit = 0
+	m.textInput.EchoMode = textinput.EchoNormal
+
+	switch w.Step() {
+	case setup.StepProvider:
+		m.actionInProgress = "Select the credential provider buchhalter-cli reads the credentials of your suppliers from"
+		for i, choice := range w.Providers {
+			if choice.Provider == w.Provider {
+				m.cursor = i
+			}
+		}
+	case setup.StepVault:
+		m.actionInProgress = fmt.Sprintf("Select the %s vault that should be used with buchhalter-cli", vault.GetProviderName(w.Provider))
+		for i, v := range w.Vaults {
+			if selectedVault := getSelectedVaultConfiguration(m.buchhalterConfig.Vaults); selectedVault != nil && selectedVault.ID == v.ID {
+				m.cursor = i
+			}
+		}
+	case setup.StepProviderFile:
+		m.actionInProgress = "Enter the path of the KeePass database"
+		if w.Provider == vault.PROVIDER_FILE {
+			m.actionInProgress = "Enter the path of the credentials file (JSON or YAML)"
+		}
+		m.textInput.Placeholder = "~/passwords.kdbx"
+		m.textInput.SetValue(w.ProviderFile)
+		m.textInput.Focus()
+	case setup.StepProviderPassword:
+		m.actionInProgress = fmt.Sprintf("Enter the passphrase of the KeePass database %s (it is not stored)", w.ProviderFile)
+		m.textInput.Placeholder = "Press enter if the database is opened with the key file only"
+		m.textInput.EchoMode = textinput.EchoPassword
+		m.textInput.Focus()
+	case setup.StepAPIKey:
+		m.actionInProgress = "Enter the buchhalter SaaS-API Key that should be used with buchhalter-cli (optional)"
+		m.textInput.Placeholder = "Your buchhalter SaaS API key"
+		if len(w.APIKey) > 0 {
+			m.textInput.Placeholder = "Press enter to keep the API key of the vault"
+		}
+		m.textInput.CharLimit = 64
+		m.textInput.Focus()
+	case setup.StepTeam:
+		m.actionInProgress = "Select the team documents should be uploaded to"
+	case setup.StepDirectory:
+		m.actionInProgress = "Confirm the directory to store the invoices into"
+		m.textInput.Placeholder = w.Directory
+		m.textInput.SetValue(w.Directory)
+		m.textInput.Focus()
+	case setup.StepConfirm:
+		m.actionInProgress = fmt.Sprintf("Press enter to write the configuration to %s", m.buchhalterConfig.ConfigFile)
+	}
+	return m
+}
+
+func (m ViewModelSetup) showsTextInput() bool {
+	step := m.wizard.Step()
+	return step == setup.StepProviderFile || step == setup.StepProviderPassword || step == setup.StepAPIKey || step == setup.StepDirectory
+}
+
+func (m ViewModelSetup) choiceCount() int {
+	switch m.wizard.Step() {
+	case setup.StepProvider:
+		return len(m.wizard.Providers)
+	case setup.StepVault:
+		return len(m.wizard.Vaults)
+	case setup.StepTeam:
+		return len(m.wizard.Teams)
+	}
+	return 1
+}
+
+func (m ViewModelSetup) View() string {
+	s := strings.Builder{}
+	s.WriteString(headerStyle(LogoText) + "\n\n")
+
+	for _, actionCompleted := range m.actionsCompleted {
+		switch actionCompleted.Style {
+		case utils.UIActionStyleSuccess:
+			s.WriteString(checkMark.Render() + " " + textStyleBold(actionCompleted.Message) + "\n")
+		case utils.UIActionStyleError:
+			s.WriteString(errorMark.Render() + " " + errorStyle.Render(capitalizeFirstLetter(actionCompleted.Message)) + "\n")
+		}
+	}
+
+	if len(m.actionInProgress) > 0 {
+		s.WriteString(m.spinner.View() + " " + textStyleBold(m.actionInProgress) + "\n")
+	}
+
+	// The wizard is changed by the running step
+	if m.busy || m.quitting {
+		return s.String()
+	}
+
+	w := m.wizard
+	s.WriteString("\n")
+	switch w.Step() {
+	case setup.StepProvider:
+		for i, choice := range w.Providers {
+			s.WriteString(renderSetupChoice(choice.Name, i == m.cursor))
+			if choice.Err != nil {
+				s.WriteString(" (" + textStyleBold("not installed") + ")")
+			} else if choice.Provider == m.buchhalterConfig.CredentialProvider {
+				s.WriteString(" (" + textStyleBold("currently configured") + ")")
+			}
+			s.WriteString("\n")
+		}
+	case setup.StepVault:
+		for i, v := range w.Vaults {
+			s.WriteString(renderSetupChoice(setupVaultName(v), i == m.cursor))
+			if getVaultFromVaultListByVaultID(m.buchhalterConfig.Vaults, v.ID) != nil {
+				s.WriteString(" (" + textStyleBold("already configured") + ")")
+			}
+			s.WriteString("\n")
+		}
+	case setup.StepTeam:
+		s.WriteString(renderTeamChoices(w.Teams, m.cursor, w.Team))
+	case setup.StepProviderFile, setup.StepProviderPassword, setup.StepAPIKey, setup.StepDirectory:
+		s.WriteString(m.textInput.View() + "\n")
+	case setup.StepConfirm:
+		s.WriteString(fmt.Sprintf("Credential provider: %s\n", vault.GetProviderName(w.Provider)))
+		if len(w.ProviderFile) > 0 {
+			s.WriteString(fmt.Sprintf("File:                %s\n", w.ProviderFile))
+		}
+		if w.Vault != nil {
+			s.WriteString(fmt.Sprintf("Vault:               %s\n", setupVaultName(*w.Vault)))
+		}
+		if len(w.APIKey) > 0 {
+			s.WriteString(fmt.Sprintf("API key:             %s\n", maskString(w.APIKey)))
+		}
+		if len(w.Team) > 0 {
+			s.WriteString(fmt.Sprintf("Team:                %s\n", w.Team))
+		}
+		s.WriteString(fmt.Sprintf("Directory:           %s\n", w.Directory))
+	}
+
+	if m.showsTextInput() {
+		s.WriteString("\n(press ctrl+c to quit)\n")
+	} else {
+		s.WriteString("\n(press q to quit)\n")
+	}
+
+	return s.String()
+}
+
+// setupVaultName returns the name of v, the root vault (an empty base) has all items of the provider.
+func setupVaultName(v vault.Vault) string {
+	if len(v.Name) == 0 {
+		return "All items"
+	}
+	return v.Name
+}
+
+func renderSetupChoice(name string, selected bool) string {
+	if selected {
+		return "(•) " + name
+	}
+	return "( ) " + name
+}
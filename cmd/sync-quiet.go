@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"buchhalter/lib/browser"
+	"buchhalter/lib/utils"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+/**
+ * Quiet (non-interactive) UI
+ *
+ * Used if stdout is not a terminal (e.g. CI) or `--quiet` is set.
+ * The sync logic stays the same, only the rendering differs:
+ * Every status update is printed as a single log line.
+ */
+
+// viewModelSyncQuiet is the bubbletea model for the quiet mode.
+// It runs without a renderer and writes plain lines to out.
+type viewModelSyncQuiet struct {
+	out    io.Writer
+	logger *slog.Logger
+	result *syncResult
+
+	// Browser
+	browserCtx context.Context
+}
+
+func initViewModelSyncQuiet(logger *slog.Logger, out io.Writer, result *syncResult) *viewModelSyncQuiet {
+	return &viewModelSyncQuiet{
+		out:    out,
+		logger: logger,
+		result: result,
+	}
+}
+
+// quietProgramOptions returns the bubbletea options for the quiet mode.
+// No input is read, interrupts (SIGINT and SIGTERM) shut down gracefully via forwardShutdownSignals, so the browser gets stopped.
+func quietProgramOptions() []tea.ProgramOption {
+	return []tea.ProgramOption{
+		tea.WithoutRenderer(),
+		tea.WithInput(nil),
+		tea.WithoutSignalHandler(),
+	}
+}
+
+func (m *viewModelSyncQuiet) Init() tea.Cmd {
+	return nil
+}
+
+func (m *viewModelSyncQuiet) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case utils.ViewStatusUpdateMsg:
+		switch {
+		case msg.Err != nil:
+			m.printLine("ERROR", capitalizeFirstLetter(msg.Err.Error()))
+		case msg.Completed:
+			m.printLine("OK", msg.Message)
+		case len(msg.Message) > 0:
+			m.printLine("INFO", msg.Message+" ...")
+		}
+
+		if msg.ShouldQuit {
+			return m, m.quit
+		}
+		return m, nil
+
+	case newRecipeRunDataRecordMsg:
+		m.printLine("INFO", fmt.Sprintf("%s (%.0fs)", msg.record.Status, msg.record.Duration))
+		switch {
+		case len(msg.record.LastErrorMessage) > 0 && len(msg.record.ErrorCode) > 0:
+			m.printLine("ERROR", fmt.Sprintf("%s (%s)", msg.record.LastErrorMessage, msg.record.ErrorCode))
+		case len(msg.record.LastErrorMessage) > 0:
+			m.printLine("ERROR", msg.record.LastErrorMessage)
+		}
+		return m, nil
+
+	case viewMsgNewFilesMsg:
+		for _, file := range msg.files {
+			if len(msg.supplier) == 0 {
+				m.printLine("INFO", file)
+				continue
+			}
+			m.printLine("INFO", fmt.Sprintf("New file of `%s`: %s", msg.supplier, file))
+		}
+		return m, nil
+
+	case viewMsgModeUpdate:
+		// The metrics prompt is never shown in quiet mode (see repository.MetricsDecisionDecline)
+		return m, nil
+
+	case updateBrowserContext:
+		m.logger.Info("Updating browser context")
+		m.browserCtx = msg.ctx
+		return m, nil
+
+	case viewQuitMsg:
+		m.logger.Info("Initiating shutdown sequence")
+
+		// Stopping the browser instance
+		m.logger.Info("Stopping browser instance")
+		if m.browserCtx != nil {
+			err := browser.Quit(m.browserCtx)
+			if err != nil {
+				m.logger.Error("Error cancelling browser", "error", err)
+			}
+		}
+
+		if m.result.ExitCode() == ExitCodeFatalError {
+			m.printLine("ERROR", "Sync aborted")
+		} else if failedSuppliers := m.result.FailedSuppliers(); len(failedSuppliers) > 0 {
+			m.printLine("ERROR", fmt.Sprintf("Sync finished with %d failed suppliers: %s", len(failedSuppliers), strings.Join(failedSuppliers, ", ")))
+		} else {
+			m.printLine("OK", "Thanks for using buchhalter.ai!")
+		}
+		return m, tea.Quit
+	}
+
+	// Progress updates, metrics records and download results are not printed.
+	// The information is part of the status updates and run data records already.
+	return m, nil
+}
+
+func (m *viewModelSyncQuiet) View() string {
+	return ""
+}
+
+func (m *viewModelSyncQuiet) quit() tea.Msg {
+	return viewQuitMsg{}
+}
+
+func (m *viewModelSyncQuiet) printLine(level, message string) {
+	fmt.Fprintf(m.out, "%s %-5s %s\n", time.Now().Format(time.RFC3339), level, message)
+}
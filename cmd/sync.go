@@ -4,37 +4,52 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"runtime/debug"
+	"sort"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"buchhalter/lib/archive"
 	"buchhalter/lib/browser"
 	"buchhalter/lib/parser"
+	"buchhalter/lib/postprocess"
 	"buchhalter/lib/repository"
+	"buchhalter/lib/settings"
 	"buchhalter/lib/utils"
 	"buchhalter/lib/vault"
 
 	"github.com/charmbracelet/bubbles/progress"
 	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-isatty"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 type recipeToExecute struct {
-	recipe      *parser.Recipe
-	vaultItemId string
+	recipe         *parser.Recipe
+	vaultItemId    string
+	vaultItemTitle string
+	// labeled runs name the vault item, if the recipe runs for multiple vault items (`--on-ambiguous all`)
+	labeled bool
 }
 
-type buchhalterMetricsRecord struct {
-	CliVersion    string `json:"cliVersion,omitempty"`
-	OicdbVersion  string `json:"oicdbVersion,omitempty"`
-	VaultVersion  string `json:"vaultVersion,omitempty"`
-	ChromeVersion string `json:"chromeVersion,omitempty"`
+// supplierLabel returns the supplier of the recipe (incl. the vault item for labeled runs) for status messages.
+func (r recipeToExecute) supplierLabel() string {
+	if r.labeled {
+		return fmt.Sprintf("`%s` (vault item `%s`)", r.recipe.Supplier, r.vaultItemTitle)
+	}
+	return fmt.Sprintf("`%s`", r.recipe.Supplier)
 }
 
 type syncCommandConfig struct {
@@ -42,23 +57,251 @@ type syncCommandConfig struct {
 	buchhalterDirectory          string
 	buchhalterConfigDirectory    string
 	buchhalterDocumentsDirectory string
+	buchhalterStagingDirectory   string
 
 	// Vault
+	vaultProvider     string
 	vaultConfigBinary string
-	vaultConfig       vaultConfiguration
+	vaultConfig       settings.Vault
 	vaultConfigTag    string
+	keePassConfig     vault.KeePassConfig
+	// credentialsFile is the credentials file of the file provider (`credential_provider_file` or `--credentials-file`)
+	credentialsFile string
+	// totpClockSkew is the tolerated clock skew of the portals for TOTP codes (`buchhalter_totp_clock_skew`)
+	totpClockSkew time.Duration
+
+	// recipeFile is a single recipe to run instead of the OICDB recipes (`--recipe-file`).
+	// recipeFileItem is the vault item (ID or title) to run it with, without it the item is matched by the domains of the recipe.
+	recipeFile     string
+	recipeFileItem string
+	// onAmbiguous is the mode for recipes matched by multiple vault items (`--on-ambiguous`, see parser.AmbiguousModes)
+	onAmbiguous string
+	// chromePath is the Chrome binary of the recipes (`--chrome-binary` or `buchhalter_chrome_path`), empty for the Chrome chromedp finds
+	chromePath string
+	// headless runs Chrome without a visible window (`--headless` or `buchhalter_headless`), except for `buchhalter_headful_suppliers`
+	headless bool
+	// forceUpload uploads all documents, even if they exist in Buchhalter API already (`--force-upload`)
+	forceUpload bool
+	// noUpload skips the upload of documents to Buchhalter API, also for premium subscriptions (`--no-upload`)
+	noUpload bool
+	// transcriptDirectory is the directory the transcripts of browser recipes are written to (`--transcript`), empty for none
+	transcriptDirectory string
+	// screenshotDirectory is the directory the screenshots of the steps of browser recipes are written to (`--screenshots`), empty for none
+	screenshotDirectory string
+	// harFile is the HAR file the HTTP traffic of client and http recipes is recorded into (`--har`), empty for none
+	harFile string
+	// supplierTimeout is the total time the recipe of a supplier may take (`--timeout-per-supplier`), zero for no limit
+	supplierTimeout time.Duration
+	// keepDownloads keeps the downloads directories of the suppliers in the staging directory (`--keep-downloads` or `buchhalter_keep_downloads`)
+	keepDownloads bool
+	// verboseBrowser logs the console messages and exceptions of the pages of browser recipes (`--verbose-browser`)
+	verboseBrowser bool
+	// sinceLastRun only syncs the documents since the last successful sync of each supplier (`--since-last-run`)
+	sinceLastRun bool
+	// loginOnly only runs the steps up to the login of the recipe, without downloading or uploading documents (`--login-only`)
+	loginOnly bool
+	// stdinCredentials replace the vault for a recipe file (`--credentials-stdin`, development only)
+	stdinCredentials *vault.StdinCredentials
+	// pause pauses the recipes before their next step (`p` in the interactive UI), nil in quiet mode
+	pause *utils.Pause
+	// totpPrompt asks for the 2FA code of suppliers without a TOTP in the vault (interactive UI), nil in quiet mode
+	totpPrompt *utils.TotpPrompt
 
 	// Vault Selection mode
 	vaultSelectionMode  int
 	vaultSelectionValue string
+
+	// buchhalterConfig is the configuration file, incl. the defaults
+	buchhalterConfig *settings.Config
 }
 
 const (
 	VaultSelectionModeCliFlag = iota
 	VaultSelectionModeDefaultConfig
 	VaultSelectionNothingConfigured
+	VaultSelectionModeProfile
 )
 
+// Exit codes of the sync command
+const (
+	// ExitCodeFatalError is used if the sync was aborted (e.g. no vault configured or recipes couldn't be loaded)
+	ExitCodeFatalError = 1
+	// ExitCodeSupplierFailures is the base exit code if recipes of suppliers failed.
+	// The number of failed suppliers is added (e.g. 12 = two suppliers failed), capped at ExitCodeSupplierFailuresMax.
+	ExitCodeSupplierFailures    = 10
+	ExitCodeSupplierFailuresMax = 125
+)
+
+// syncResult is the aggregated result of a sync run.
+// It is written by the sync logic (running in a goroutine) and read after the bubbletea program has finished.
+type syncResult struct {
+	mu              sync.Mutex
+	fatal           bool
+	failedSuppliers []string
+	runData         repository.RunData
+	newFiles        map[string][]string
+	// missingCredentials are the suppliers skipped because their vault items miss credentials, with the missing fields
+	missingCredentials map[string][]string
+}
+
+// MarkFatal marks the sync as aborted.
+func (r *syncResult) MarkFatal() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.fatal = true
+}
+
+// MarkSupplierFailed registers a supplier whose recipe failed.
+func (r *syncResult) MarkSupplierFailed(supplier string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.failedSuppliers = append(r.failedSuppliers, supplier)
+}
+
+// MarkSupplierMissingCredentials registers a supplier that was skipped, because its vault item misses the credential fields of its recipe.
+// A skipped supplier isn't a failed supplier.
+func (r *syncResult) MarkSupplierMissingCredentials(supplier string, fields []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.missingCredentials == nil {
+		r.missingCredentials = map[string][]string{}
+	}
+	r.missingCredentials[supplier] = append([]string{}, fields...)
+}
+
+// MissingCredentials returns the missing credential fields of the skipped suppliers by supplier.
+func (r *syncResult) MissingCredentials() map[string][]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	missingCredentials := make(map[string][]string, len(r.missingCredentials))
+	for supplier, fields := range r.missingCredentials {
+		missingCredentials[supplier] = append([]string{}, fields...)
+	}
+	return missingCredentials
+}
+
+// AddRunData registers the run data of a supplier whose recipe was executed.
+func (r *syncResult) AddRunData(record repository.RunDataSupplier) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.runData = append(r.runData, record)
+}
+
+// AddNewFiles registers the paths of the new documents of a supplier.
+func (r *syncResult) AddNewFiles(supplier string, files []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.newFiles == nil {
+		r.newFiles = map[string][]string{}
+	}
+	r.newFiles[supplier] = append(r.newFiles[supplier], files...)
+}
+
+// NewFiles returns the paths of the new documents by supplier.
+func (r *syncResult) NewFiles() map[string][]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	newFiles := make(map[string][]string, len(r.newFiles))
+	for supplier, files := range r.newFiles {
+		newFiles[supplier] = append([]string{}, files...)
+	}
+	return newFiles
+}
+
+// NewFilesCount returns the number of new documents of all suppliers.
+func (r *syncResult) NewFilesCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	count := 0
+	for _, record := range r.runData {
+		count += record.NewFilesCount
+	}
+	return count
+}
+
+// SupplierMetrics returns the results of all suppliers, incl. the suppliers that failed before their recipe was executed.
+func (r *syncResult) SupplierMetrics() []utils.SupplierRunMetrics {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	failed := map[string]bool{}
+	for _, supplier := range r.failedSuppliers {
+		failed[supplier] = true
+	}
+
+	metrics := []utils.SupplierRunMetrics{}
+	executed := map[string]bool{}
+	for _, record := range r.runData {
+		executed[record.Supplier] = true
+		metrics = append(metrics, utils.SupplierRunMetrics{
+			Supplier:      record.Supplier,
+			NewFilesCount: record.NewFilesCount,
+			Duration:      record.Duration,
+			Failed:        failed[record.Supplier],
+		})
+	}
+	for _, supplier := range r.failedSuppliers {
+		if !executed[supplier] {
+			metrics = append(metrics, utils.SupplierRunMetrics{Supplier: supplier, Failed: true})
+		}
+	}
+
+	return metrics
+}
+
+// FailedSuppliers returns the suppliers whose recipes failed.
+func (r *syncResult) FailedSuppliers() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string{}, r.failedSuppliers...)
+}
+
+// RunData returns the run data of all executed recipes.
+func (r *syncResult) RunData() repository.RunData {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append(repository.RunData{}, r.runData...)
+}
+
+// ErrorCodes returns the error codes of the failed recipes by supplier.
+func (r *syncResult) ErrorCodes() map[string]utils.ErrorCode {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	errorCodes := map[string]utils.ErrorCode{}
+	for _, record := range r.runData {
+		if len(record.ErrorCode) > 0 {
+			errorCodes[record.Supplier] = record.ErrorCode
+		}
+	}
+	return errorCodes
+}
+
+// ExitCode returns the exit code of the sync command.
+// A fatal error has precedence over failed suppliers.
+func (r *syncResult) ExitCode() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.fatal {
+		return ExitCodeFatalError
+	}
+	if len(r.failedSuppliers) == 0 {
+		return 0
+	}
+	return min(ExitCodeSupplierFailures+len(r.failedSuppliers), ExitCodeSupplierFailuresMax)
+}
+
 var syncCmd = &cobra.Command{
 	Use:   "sync",
 	Short: "Synchronize all invoices from your suppliers",
@@ -73,37 +316,201 @@ func init() {
 		fmt.Printf("Failed to bind 'vault' flag: %v\n", err)
 		os.Exit(1)
 	}
+	syncCmd.Flags().BoolP("quiet", "q", false, "Non-interactive mode: print plain log lines instead of the interactive UI (default if stdout is not a terminal)")
+	err = viper.BindPFlag("cmd-arg-quiet", syncCmd.Flags().Lookup("quiet"))
+	if err != nil {
+		fmt.Printf("Failed to bind 'quiet' flag: %v\n", err)
+		os.Exit(1)
+	}
+	syncCmd.Flags().String("output-dir", "", "Directory to store the invoices of this run into (instead of the documents directory of the vault)")
+	err = viper.BindPFlag("cmd-arg-output-dir", syncCmd.Flags().Lookup("output-dir"))
+	if err != nil {
+		fmt.Printf("Failed to bind 'output-dir' flag: %v\n", err)
+		os.Exit(1)
+	}
+
+	syncCmd.Flags().Bool("resume", false, "Resume an interrupted sync: skip the suppliers the previous run completed")
+	err = viper.BindPFlag("cmd-arg-resume", syncCmd.Flags().Lookup("resume"))
+	if err != nil {
+		fmt.Printf("Failed to bind 'resume' flag: %v\n", err)
+		os.Exit(1)
+	}
+	syncCmd.Flags().String("metrics-file", "", "Write Prometheus metrics of the run into this file (textfile format, e.g. for the node exporter)")
+	err = viper.BindPFlag("cmd-arg-metrics-file", syncCmd.Flags().Lookup("metrics-file"))
+	if err != nil {
+		fmt.Printf("Failed to bind 'metrics-file' flag: %v\n", err)
+		os.Exit(1)
+	}
+	syncCmd.Flags().Bool("verbose", false, "List the new files of each supplier (also in the status file)")
+	err = viper.BindPFlag("cmd-arg-verbose", syncCmd.Flags().Lookup("verbose"))
+	if err != nil {
+		fmt.Printf("Failed to bind 'verbose' flag: %v\n", err)
+		os.Exit(1)
+	}
+	syncCmd.Flags().Bool("credentials-stdin", false, "Read the credentials for --recipe-file as JSON from stdin instead of the vault (for the development of recipes)")
+	err = viper.BindPFlag("cmd-arg-credentials-stdin", syncCmd.Flags().Lookup("credentials-stdin"))
+	if err != nil {
+		fmt.Printf("Failed to bind 'credentials-stdin' flag: %v\n", err)
+		os.Exit(1)
+	}
+	syncCmd.Flags().String("credentials-file", "", "Read the credentials from a local JSON or YAML file instead of the vault (for the development of recipes and CI)")
+	err = viper.BindPFlag("cmd-arg-credentials-file", syncCmd.Flags().Lookup("credentials-file"))
+	if err != nil {
+		fmt.Printf("Failed to bind 'credentials-file' flag: %v\n", err)
+		os.Exit(1)
+	}
+	syncCmd.Flags().String("recipe-file", "", "Run a single recipe from a JSON or YAML file (instead of the OICDB). The argument selects the vault item (ID or title)")
+	err = viper.BindPFlag("cmd-arg-recipe-file", syncCmd.Flags().Lookup("recipe-file"))
+	if err != nil {
+		fmt.Printf("Failed to bind 'recipe-file' flag: %v\n", err)
+		os.Exit(1)
+	}
+
+	syncCmd.Flags().StringSlice("tag", []string{}, "Sync only the suppliers whose recipes have one of these tags (e.g. --tag hosting,saas)")
+	err = viper.BindPFlag("cmd-arg-tag", syncCmd.Flags().Lookup("tag"))
+	if err != nil {
+		fmt.Printf("Failed to bind 'tag' flag: %v\n", err)
+		os.Exit(1)
+	}
+
+	syncCmd.Flags().String("chrome-binary", "", "Chrome binary to run the recipes with (e.g. Chromium or Brave), overrides `buchhalter_chrome_path`")
+	err = viper.BindPFlag("cmd-arg-chrome-binary", syncCmd.Flags().Lookup("chrome-binary"))
+	if err != nil {
+		fmt.Printf("Failed to bind 'chrome-binary' flag: %v\n", err)
+		os.Exit(1)
+	}
+
+	syncCmd.Flags().Bool("headless", false, "Run Chrome without a visible window, except for the suppliers of `buchhalter_headful_suppliers` (see `buchhalter_headless`)")
+	err = viper.BindPFlag("cmd-arg-headless", syncCmd.Flags().Lookup("headless"))
+	if err != nil {
+		fmt.Printf("Failed to bind 'headless' flag: %v\n", err)
+		os.Exit(1)
+	}
+
+	syncCmd.Flags().Bool("verbose-browser", false, "Log the console messages and JavaScript exceptions of the pages of browser recipes (debug level, enables --log)")
+	err = viper.BindPFlag("cmd-arg-verbose-browser", syncCmd.Flags().Lookup("verbose-browser"))
+	if err != nil {
+		fmt.Printf("Failed to bind 'verbose-browser' flag: %v\n", err)
+		os.Exit(1)
+	}
+
+	syncCmd.Flags().Bool("keep-downloads", false, "Keep the downloads of the suppliers in the staging directory after their recipes (e.g. to inspect a failed recipe)")
+	err = viper.BindPFlag("cmd-arg-keep-downloads", syncCmd.Flags().Lookup("keep-downloads"))
+	if err != nil {
+		fmt.Printf("Failed to bind 'keep-downloads' flag: %v\n", err)
+		os.Exit(1)
+	}
+
+	syncCmd.Flags().String("transcript", "", "Write a transcript of the executed steps of each browser recipe (redacted, replayable with --recipe-file) into this directory, e.g. for bug reports")
+	err = viper.BindPFlag("cmd-arg-transcript", syncCmd.Flags().Lookup("transcript"))
+	if err != nil {
+		fmt.Printf("Failed to bind 'transcript' flag: %v\n", err)
+		os.Exit(1)
+	}
+
+	syncCmd.Flags().String("screenshots", "", "Write a screenshot of the page after each step of browser recipes into this directory (referenced in the transcript), e.g. to debug a recipe")
+	err = viper.BindPFlag("cmd-arg-screenshots", syncCmd.Flags().Lookup("screenshots"))
+	if err != nil {
+		fmt.Printf("Failed to bind 'screenshots' flag: %v\n", err)
+		os.Exit(1)
+	}
+
+	syncCmd.Flags().String("har", "", "Record the HTTP traffic of client and http recipes into this HAR file (Authorization and cookie headers redacted), e.g. to fix the extraction paths of a recipe")
+	err = viper.BindPFlag("cmd-arg-har", syncCmd.Flags().Lookup("har"))
+	if err != nil {
+		fmt.Printf("Failed to bind 'har' flag: %v\n", err)
+		os.Exit(1)
+	}
+
+	syncCmd.Flags().Duration("timeout-per-supplier", 0, "Total time the recipe of a supplier may take (e.g. 10m), afterwards the sync moves on to the next supplier (default no limit)")
+	err = viper.BindPFlag("cmd-arg-timeout-per-supplier", syncCmd.Flags().Lookup("timeout-per-supplier"))
+	if err != nil {
+		fmt.Printf("Failed to bind 'timeout-per-supplier' flag: %v\n", err)
+		os.Exit(1)
+	}
+
+	syncCmd.Flags().String("on-ambiguous", parser.AmbiguousModeAll, "What to do if multiple vault items match the same recipe: run the recipe for each item (all), only for the first item (first) or not at all (skip)")
+	err = viper.BindPFlag("cmd-arg-on-ambiguous", syncCmd.Flags().Lookup("on-ambiguous"))
+	if err != nil {
+		fmt.Printf("Failed to bind 'on-ambiguous' flag: %v\n", err)
+		os.Exit(1)
+	}
+
+	syncCmd.Flags().Bool("login-only", false, "Only check the login of a supplier: run its recipe up to the login step, without downloading invoices")
+	err = viper.BindPFlag("cmd-arg-login-only", syncCmd.Flags().Lookup("login-only"))
+	if err != nil {
+		fmt.Printf("Failed to bind 'login-only' flag: %v\n", err)
+		os.Exit(1)
+	}
+
+	syncCmd.Flags().Bool("since-last-run", false, "Only sync the invoices since the last successful sync of each supplier")
+	err = viper.BindPFlag("cmd-arg-since-last-run", syncCmd.Flags().Lookup("since-last-run"))
+	if err != nil {
+		fmt.Printf("Failed to bind 'since-last-run' flag: %v\n", err)
+		os.Exit(1)
+	}
+
+	syncCmd.Flags().Bool("no-metrics", false, "Don't send usage metrics to Buchhalter API for this run, regardless of `buchhalter_always_send_metrics` (also via DO_NOT_TRACK=1)")
+	err = viper.BindPFlag("cmd-arg-no-metrics", syncCmd.Flags().Lookup("no-metrics"))
+	if err != nil {
+		fmt.Printf("Failed to bind 'no-metrics' flag: %v\n", err)
+		os.Exit(1)
+	}
+
+	syncCmd.Flags().Bool("force-upload", false, "Upload all documents to Buchhalter API, even if they exist there already (e.g. to replace a corrupt copy)")
+	err = viper.BindPFlag("cmd-arg-force-upload", syncCmd.Flags().Lookup("force-upload"))
+	if err != nil {
+		fmt.Printf("Failed to bind 'force-upload' flag: %v\n", err)
+		os.Exit(1)
+	}
+	syncCmd.Flags().Bool("no-upload", false, "Only download the invoices, without uploading them to Buchhalter API")
+	err = viper.BindPFlag("cmd-arg-no-upload", syncCmd.Flags().Lookup("no-upload"))
+	if err != nil {
+		fmt.Printf("Failed to bind 'no-upload' flag: %v\n", err)
+		os.Exit(1)
+	}
 
 	rootCmd.AddCommand(syncCmd)
 }
 
 func RunSyncCommand(cmd *cobra.Command, cmdArgs []string) {
+	result := runSync(cmd, cmdArgs)
+
+	// Scripts should be able to detect failed suppliers
+	if exitCode := result.ExitCode(); exitCode != 0 {
+		os.Exit(exitCode)
+	}
+}
+
+// runSync runs the sync with the flags of the sync command (also set by `recipes test`) and returns its result.
+func runSync(cmd *cobra.Command, cmdArgs []string) *syncResult {
 	supplier := ""
 	if len(cmdArgs) > 0 {
 		supplier = cmdArgs[0]
 	}
 
 	// Init vaults from configuration
-	credentialProviderVaults := []vaultConfiguration{}
-	if err := viper.UnmarshalKey("credential_provider_vaults", &credentialProviderVaults); err != nil {
-		exitMessage := fmt.Sprintf("Error reading configuration field `credential_provider_vaults`: %s", err)
-		exitWithLogo(exitMessage)
-	}
+	buchhalterConfig := loadConfig()
+	credentialProviderVaults := buchhalterConfig.Vaults
 
 	// We have two options to get the right vault configuration:
 	// 1. The user has selected a vault configuration via the CLI flag
 	// 2. We try to get the (default) selected vault configuration from the configuration file
 	//
-	// The CLI flag has precedence over the configuration file.
+	// The CLI flag has precedence over the vault of the profile (`--profile`) and the configuration file.
 	var vaultSelectionMode int
 	var vaultSelectionValue string
-	var selectedVault *vaultConfiguration
+	var selectedVault *settings.Vault
 	cmdArgSelectedVault := viper.GetString("cmd-arg-selected-vault")
 	cmdArgSelectedVault = strings.TrimSpace(cmdArgSelectedVault)
 	if len(cmdArgSelectedVault) > 0 {
 		vaultSelectionMode = VaultSelectionModeCliFlag
 		vaultSelectionValue = cmdArgSelectedVault
 		selectedVault = getVaultFromVaultListByVaultName(credentialProviderVaults, cmdArgSelectedVault)
+	} else if profileSelectedVault := profileVault(buchhalterConfig); profileSelectedVault != nil {
+		vaultSelectionMode = VaultSelectionModeProfile
+		vaultSelectionValue = buchhalterConfig.Profile.Vault
+		selectedVault = profileSelectedVault
 	} else {
 		vaultSelectionMode = VaultSelectionModeDefaultConfig
 		selectedVault = getSelectedVaultConfiguration(credentialProviderVaults)
@@ -115,68 +522,242 @@ func RunSyncCommand(cmd *cobra.Command, cmdArgs []string) {
 	}
 
 	if selectedVault == nil {
-		selectedVault = &vaultConfiguration{
+		selectedVault = &settings.Vault{
 			ID:               "default",
 			Name:             "buchhalter-default",
 			BuchhalterAPIKey: "",
 			Selected:         true,
 		}
 	}
+	selectedVault = applyProfileToVault(buchhalterConfig, selectedVault)
+
+	utils.RegisterSecret(selectedVault.BuchhalterAPIKey)
 
 	// Craft documents directory with Vault ID
 	// By this, we split the documents into different directories based on the vault ID
-	buchhalterDocumentsDirectory := viper.GetString("buchhalter_documents_directory")
+	buchhalterDocumentsDirectory := buchhalterConfig.DocumentsDirectory
 	buchhalterDocumentsDirectory = filepath.Join(buchhalterDocumentsDirectory, selectedVault.ID)
 
+	// The output directory overrides the documents directory for this run (e.g. a client-specific folder)
+	cmdArgOutputDirectory := strings.TrimSpace(viper.GetString("cmd-arg-output-dir"))
+	if len(cmdArgOutputDirectory) > 0 {
+		outputDirectory, err := filepath.Abs(cmdArgOutputDirectory)
+		if err != nil {
+			exitMessage := fmt.Sprintf("Error resolving output directory `%s`: %s", cmdArgOutputDirectory, err)
+			exitWithLogo(exitMessage)
+		}
+		buchhalterDocumentsDirectory = outputDirectory
+	}
+
 	// Create documents directory if not exists
 	if err := utils.CreateDirectoryIfNotExists(buchhalterDocumentsDirectory); err != nil {
 		exitMessage := fmt.Sprintf("Error creating main document directory: %s", err)
 		exitWithLogo(exitMessage)
 	}
 
+	// Downloads are staged in a separate directory (of the vault) before they are moved into the documents directory
+	buchhalterStagingDirectory, err := utils.StagingDirectory(buchhalterConfig.StagingDirectory, buchhalterDocumentsDirectory, selectedVault.ID)
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error resolving staging directory: %s", err)
+		exitWithLogo(exitMessage)
+	}
+
+	vaultProvider := selectedVault.ProviderOr(buchhalterConfig.CredentialProvider)
 	config := &syncCommandConfig{
-		buchhalterDirectory:          viper.GetString("buchhalter_directory"),
-		buchhalterConfigDirectory:    viper.GetString("buchhalter_config_directory"),
+		buchhalterDirectory:          buchhalterConfig.Directory,
+		buchhalterConfigDirectory:    buchhalterConfig.ConfigDirectory,
 		buchhalterDocumentsDirectory: buchhalterDocumentsDirectory,
-		vaultConfigBinary:            viper.GetString("credential_provider_cli_command"),
+		buchhalterStagingDirectory:   buchhalterStagingDirectory,
+		vaultProvider:                vaultProvider,
+		vaultConfigBinary:            vaultProviderBinary(buchhalterConfig, vaultProvider),
 		vaultConfig:                  *selectedVault,
-		vaultConfigTag:               viper.GetString("credential_provider_item_tag"),
+		vaultConfigTag:               buchhalterConfig.CredentialProviderItemTag,
+		recipeFile:                   strings.TrimSpace(viper.GetString("cmd-arg-recipe-file")),
+		chromePath:                   buchhalterConfig.ChromePath,
+		onAmbiguous:                  strings.ToLower(strings.TrimSpace(viper.GetString("cmd-arg-on-ambiguous"))),
+		headless:                     buchhalterConfig.Headless || viper.GetBool("cmd-arg-headless"),
+		forceUpload:                  viper.GetBool("cmd-arg-force-upload"),
+		noUpload:                     viper.GetBool("cmd-arg-no-upload"),
+		keepDownloads:                buchhalterConfig.KeepDownloads || viper.GetBool("cmd-arg-keep-downloads"),
+		verboseBrowser:               viper.GetBool("cmd-arg-verbose-browser"),
+		transcriptDirectory:          strings.TrimSpace(viper.GetString("cmd-arg-transcript")),
+		screenshotDirectory:          strings.TrimSpace(viper.GetString("cmd-arg-screenshots")),
+		harFile:                      strings.TrimSpace(viper.GetString("cmd-arg-har")),
+		supplierTimeout:              viper.GetDuration("cmd-arg-timeout-per-supplier"),
+		loginOnly:                    viper.GetBool("cmd-arg-login-only"),
+		sinceLastRun:                 viper.GetBool("cmd-arg-since-last-run"),
 
 		// Vault Selection mode
 		vaultSelectionMode:  vaultSelectionMode,
 		vaultSelectionValue: vaultSelectionValue,
+
+		buchhalterConfig: buchhalterConfig,
+	}
+
+	if !parser.IsSupportedAmbiguousMode(config.onAmbiguous) {
+		exitWithLogo(fmt.Sprintf("Unsupported value `%s` for `--on-ambiguous` (supported: %s)", config.onAmbiguous, strings.Join(parser.AmbiguousModes, ", ")))
+	}
+	if config.forceUpload && config.noUpload {
+		exitWithLogo("`--force-upload` and `--no-upload` can't be combined")
+	}
+	if config.forceUpload && config.sinceLastRun {
+		exitWithLogo("`--force-upload` and `--since-last-run` can't be combined")
+	}
+	if config.loginOnly {
+		switch {
+		case len(supplier) == 0 && len(config.recipeFile) == 0:
+			exitWithLogo("`--login-only` requires a supplier (e.g. `buchhalter sync --login-only <supplier>`) or `--recipe-file`")
+		case config.forceUpload || viper.GetBool("cmd-arg-resume"):
+			exitWithLogo("`--login-only` can't be combined with `--force-upload` or `--resume`")
+		}
+	}
+	totpClockSkew, err := time.ParseDuration(buchhalterConfig.TotpClockSkew)
+	if err == nil {
+		err = vault.ValidateTotpClockSkew(totpClockSkew)
+	}
+	if err != nil {
+		exitWithLogo(fmt.Sprintf("Invalid value `%s` for `buchhalter_totp_clock_skew`: %s", buchhalterConfig.TotpClockSkew, err))
+	}
+	config.totpClockSkew = totpClockSkew
+
+	// The CLI flag has precedence over the configuration file
+	if cmdArgChromeBinary := strings.TrimSpace(viper.GetString("cmd-arg-chrome-binary")); len(cmdArgChromeBinary) > 0 {
+		config.chromePath = cmdArgChromeBinary
+	}
+
+	// With a recipe file, the argument selects the vault item instead of the supplier
+	if len(config.recipeFile) > 0 {
+		config.recipeFileItem = supplier
+		supplier = ""
+	}
+
+	// Credentials on stdin replace the vault, they are read before the interactive UI starts
+	if viper.GetBool("cmd-arg-credentials-stdin") {
+		if len(config.recipeFile) == 0 {
+			exitWithLogo("`--credentials-stdin` is only supported together with `--recipe-file`")
+		}
+		stdinCredentials, err := vault.ParseStdinCredentials(os.Stdin)
+		if err != nil {
+			exitWithLogo(capitalizeFirstLetter(err.Error()))
+		}
+		utils.RegisterSecret(stdinCredentials.Username)
+		utils.RegisterSecret(stdinCredentials.Password)
+		utils.RegisterSecret(stdinCredentials.Totp)
+		config.stdinCredentials = &stdinCredentials
+		config.recipeFileItem = vault.StdinItemId
+	}
+
+	// A credentials file replaces the configured credential provider
+	if credentialsFile := strings.TrimSpace(viper.GetString("cmd-arg-credentials-file")); len(credentialsFile) > 0 {
+		if config.stdinCredentials != nil {
+			exitWithLogo("`--credentials-file` can't be combined with `--credentials-stdin`")
+		}
+		config.vaultProvider = vault.PROVIDER_FILE
+		config.credentialsFile = credentialsFile
+	} else if config.vaultProvider == vault.PROVIDER_FILE {
+		config.credentialsFile = strings.TrimSpace(buchhalterConfig.CredentialProviderFile)
+	}
+
+	if config.stdinCredentials == nil && !vault.IsSupportedProvider(config.vaultProvider) {
+		exitMessage := fmt.Sprintf("Credential provider `%s` of vault `%s` is not supported (supported: %s, %s, %s, %s)", config.vaultProvider, selectedVault.Name, vault.PROVIDER_1PASSWORD, vault.PROVIDER_PASS, vault.PROVIDER_KEEPASS, vault.PROVIDER_FILE)
+		exitWithLogo(exitMessage)
+	}
+
+	// The passphrase of a KeePass database is prompted before the interactive UI starts
+	if config.stdinCredentials == nil && config.vaultProvider == vault.PROVIDER_KEEPASS {
+		keePassConfig, err := readKeePassConfig(buchhalterConfig)
+		if err != nil {
+			exitWithLogo(capitalizeFirstLetter(err.Error()))
+		}
+		utils.RegisterSecret(keePassConfig.Password)
+		config.keePassConfig = keePassConfig
 	}
 
 	// Init logging
-	developmentMode := viper.GetBool("dev")
+	developmentMode := buchhalterConfig.Dev
 	logSetting, err := cmd.Flags().GetBool("log")
 	if err != nil {
 		exitMessage := fmt.Sprintf("Error reading log flag: %s", err)
 		exitWithLogo(exitMessage)
 	}
-	logger, err := initializeLogger(logSetting, developmentMode, config.buchhalterDirectory)
+	// The console messages of `--verbose-browser` are logged at debug level into the log file
+	logger, err := initializeLogger(logSetting || config.verboseBrowser, developmentMode || config.verboseBrowser, config.buchhalterDirectory)
 	if err != nil {
 		exitMessage := fmt.Sprintf("Error on initializing logging: %s", err)
 		exitWithLogo(exitMessage)
 	}
+
+	// Without a terminal (e.g. in CI), we fall back to the quiet mode with plain log lines.
+	// In the interactive UI, the log records are shown in the log pane (`l`).
+	quietMode := viper.GetBool("cmd-arg-quiet") || !isatty.IsTerminal(os.Stdout.Fd())
+	var logRecords chan utils.LogRecord
+	if !quietMode {
+		logRecords = make(chan utils.LogRecord, logPaneBufferSize)
+		logger = slog.New(utils.NewLogForwarder(logger.Handler(), logRecords))
+		config.pause = utils.NewPause()
+	}
+
 	logger.Info("Booting up", "development_mode", developmentMode)
 	defer logger.Info("Shutting down")
+	for _, warning := range buchhalterConfig.Warnings {
+		logger.Warn(warning.Message, "setting", warning.Key, "value", warning.Value)
+	}
+	runStartTime := time.Now()
+
+	// Downloads of crashed runs are left over in the staging directory.
+	// They are only cleaned up if no other run uses the staging directory.
+	stagingLock := lockAndCleanupStagingDirectory(logger, config.buchhalterStagingDirectory, buchhalterConfig.StagingCleanupAge)
 
 	// Init Buchhalter API client
-	apiHost := viper.GetString("buchhalter_api_host")
+	apiHost := buchhalterConfig.APIHost
 	buchhalterAPIClient, err := repository.NewBuchhalterAPIClient(logger, apiHost, config.buchhalterConfigDirectory, selectedVault.BuchhalterAPIKey, cliVersion)
 	if err != nil {
 		logger.Error("Error initializing Buchhalter API client", "error", err)
 		exitMessage := fmt.Sprintf("Error initializing Buchhalter API client: %s", err)
 		exitWithLogo(exitMessage)
 	}
+	buchhalterAPIClient.SetTeam(selectedVault.BuchhalterTeam)
+
+	// Canceled on shutdown (e.g. q or CTRL+C), pending requests like sending the usage metrics must not delay the exit
+	shutdownCtx, shutdown := context.WithCancel(context.Background())
+	defer shutdown()
 
 	// Init the bubbletea program
-	viewModelSync := initviewModelSync(logger, buchhalterAPIClient)
-	p := tea.NewProgram(viewModelSync)
+	result := &syncResult{}
+	metricsReporter := repository.NewMetricsReporter(buchhalterAPIClient, repository.MetricsReporterConfig{
+		AlwaysSend:      buchhalterConfig.AlwaysSendMetrics,
+		DevelopmentMode: developmentMode,
+		RecipeFile:      len(config.recipeFile) > 0,
+		Interactive:     !quietMode,
+		OptOut:          viper.GetBool("cmd-arg-no-metrics") || repository.DoNotTrack(),
+	}, storeMetricsConsent)
+	// The metrics are collected by the sync and read by the UI to send them
+	metrics := repository.NewMetricsAccumulator()
+	var p *tea.Program
+	if quietMode {
+		logger.Info("Running in quiet mode")
+		viewModelQuiet := initViewModelSyncQuiet(logger, os.Stdout, result)
+		p = tea.NewProgram(viewModelQuiet, quietProgramOptions()...)
+	} else {
+		viewModelSync := initviewModelSync(shutdownCtx, shutdown, logger, metricsReporter, metrics, logRecords, config.pause)
+		// Signals are handled by forwardShutdownSignals
+		programOptions := []tea.ProgramOption{tea.WithoutSignalHandler()}
+		if config.stdinCredentials != nil {
+			// Stdin was consumed by the credentials, key presses are read from the terminal
+			programOptions = append(programOptions, tea.WithInputTTY())
+		}
+		p = tea.NewProgram(viewModelSync, programOptions...)
+		config.totpPrompt = utils.NewTotpPrompt(utils.DefaultTotpPromptTimeout, func(msg utils.ViewTotpPromptMsg) {
+			p.Send(msg)
+		})
+	}
+
+	// SIGINT and SIGTERM (e.g. of a process manager) quit like q or CTRL+C, so the browser is stopped and cleaned up
+	stopForwardingSignals := forwardShutdownSignals(logger, p)
+	defer stopForwardingSignals()
 
 	// Run the primary logic
-	go runSyncCommandLogic(p, logger, config, supplier, buchhalterAPIClient)
+	go runSyncCommandLogic(shutdownCtx, p, logger, config, supplier, buchhalterAPIClient, metricsReporter, metrics, result)
 
 	// Run the bubbletea program
 	if _, err := p.Run(); err != nil {
@@ -184,9 +765,243 @@ func RunSyncCommand(cmd *cobra.Command, cmdArgs []string) {
 		exitMessage := fmt.Sprintf("Error running program: %s", err)
 		exitWithLogo(exitMessage)
 	}
+	shutdown()
+	stopForwardingSignals()
+
+	if stagingLock != nil {
+		if err := stagingLock.Release(); err != nil {
+			logger.Error("Error releasing lock of staging directory", "error", err)
+		}
+	}
+
+	writeRunStatus(logger, buchhalterConfig, runStartTime, result)
+	writePrometheusMetrics(logger, runStartTime, result)
+	sendWebhookNotification(logger, buchhalterConfig, result)
+
+	if exitCode := result.ExitCode(); exitCode != 0 {
+		logger.Info("Shutting down with errors", "exit_code", exitCode, "failed_suppliers", result.FailedSuppliers())
+	}
+
+	return result
+}
+
+// oicdbUpdateTimeout returns the maximum duration of the OICDB update phase (`buchhalter_oicdb_update_timeout`).
+// Invalid values fall back to the default.
+func oicdbUpdateTimeout(logger *slog.Logger, configuredTimeout string) time.Duration {
+	timeout, err := time.ParseDuration(configuredTimeout)
+	if err != nil || timeout <= 0 {
+		logger.Warn("Invalid `buchhalter_oicdb_update_timeout`, using the default", "buchhalter_oicdb_update_timeout", configuredTimeout, "default", repository.DefaultOICDBUpdateTimeout, "error", err)
+		return repository.DefaultOICDBUpdateTimeout
+	}
+	return timeout
+}
+
+// forwardShutdownSignals sends a viewQuitMsg to p on SIGINT or SIGTERM, to shut down gracefully via quit (incl. stopping the browser).
+// Bubbletea's own signal handler quits the program without an update of the model, which leaves the Chrome processes behind.
+// The handler only forwards the first signal, a second signal terminates the process immediately.
+func forwardShutdownSignals(logger *slog.Logger, p *tea.Program) (stop func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-signals:
+			signal.Stop(signals)
+			logger.Info("Received shutdown signal", "signal", sig.String())
+			p.Send(viewQuitMsg{})
+		case <-done:
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(signals)
+			close(done)
+		})
+	}
+}
+
+// skipCompletedRecipes removes the recipes of suppliers the checkpoint of an interrupted run completed (with the same recipe version).
+func skipCompletedRecipes(logger *slog.Logger, p *tea.Program, checkpoint *utils.SyncCheckpoint, recipesToExecute []recipeToExecute) []recipeToExecute {
+	remaining := []recipeToExecute{}
+	skipped := []string{}
+	for _, r := range recipesToExecute {
+		if checkpoint.IsCompleted(r.recipe.Supplier, r.recipe.Version) {
+			skipped = append(skipped, r.recipe.Supplier)
+			continue
+		}
+		remaining = append(remaining, r)
+	}
+	if len(skipped) > 0 {
+		logger.Info("Resuming interrupted sync, skipping completed suppliers", "skipped_suppliers", skipped)
+		p.Send(utils.ViewStatusUpdateMsg{
+			Message:   fmt.Sprintf("Resuming interrupted sync: skipping %d suppliers completed in the previous run", len(skipped)),
+			Completed: true,
+		})
+	}
+
+	return remaining
+}
+
+// writeRunStatus writes the status file for external monitoring (see `buchhalter_status_file`).
+// Errors are logged only, the status file must not change the result of the run.
+func writeRunStatus(logger *slog.Logger, buchhalterConfig *settings.Config, startTime time.Time, result *syncResult) {
+	statusFile := strings.TrimSpace(buchhalterConfig.StatusFile)
+	if len(statusFile) == 0 {
+		statusFile = filepath.Join(buchhalterConfig.Directory, "status.json")
+	}
+
+	var interval time.Duration
+	if statusInterval := strings.TrimSpace(buchhalterConfig.StatusInterval); len(statusInterval) > 0 {
+		parsedInterval, err := time.ParseDuration(statusInterval)
+		if err != nil || parsedInterval < 0 {
+			logger.Warn("Invalid `buchhalter_status_interval`, no next run is expected in the status file", "buchhalter_status_interval", statusInterval, "error", err)
+		} else {
+			interval = parsedInterval
+		}
+	}
+
+	previous, err := utils.ReadRunStatus(statusFile)
+	if err != nil {
+		logger.Warn("Error reading status file of the previous run", "status_file", statusFile, "error", err)
+	}
+	status := utils.NewRunStatus(previous, cliVersion, startTime, time.Now(), result.ExitCode(), result.NewFilesCount(), result.FailedSuppliers(), interval)
+	status.ErrorCodes = result.ErrorCodes()
+	if missingCredentials := result.MissingCredentials(); len(missingCredentials) > 0 {
+		status.MissingCredentials = missingCredentials
+	}
+	if viper.GetBool("cmd-arg-verbose") {
+		status.NewFiles = result.NewFiles()
+	}
+	if err := utils.WriteRunStatus(statusFile, status); err != nil {
+		logger.Error("Error writing status file", "status_file", statusFile, "error", err)
+		return
+	}
+	logger.Info("Status file written", "status_file", statusFile, "result", status.LastResult)
+}
+
+// writePrometheusMetrics writes the metrics of the run into the file of the `--metrics-file` flag.
+// The metrics are a local export only, they are not related to the usage metrics sent to Buchhalter API.
+func writePrometheusMetrics(logger *slog.Logger, startTime time.Time, result *syncResult) {
+	metricsFile := strings.TrimSpace(viper.GetString("cmd-arg-metrics-file"))
+	if len(metricsFile) == 0 {
+		return
+	}
+
+	now := time.Now()
+	metrics := utils.PrometheusMetrics(result.SupplierMetrics(), now, now.Sub(startTime))
+	if err := utils.WritePrometheusMetrics(metricsFile, metrics); err != nil {
+		logger.Error("Error writing Prometheus metrics", "metrics_file", metricsFile, "error", err)
+		fmt.Fprintf(os.Stderr, "Error writing Prometheus metrics: %s\n", err)
+		return
+	}
+	logger.Info("Prometheus metrics written", "metrics_file", metricsFile)
+}
+
+// writeRecipeTranscript writes the transcript of a browser recipe into directory (`--transcript`).
+// Errors are shown, but don't fail the supplier.
+func writeRecipeTranscript(logger *slog.Logger, p *tea.Program, directory string, transcript *browser.Transcript) {
+	if transcript == nil {
+		return
+	}
+
+	file := filepath.Join(directory, fmt.Sprintf("%s-%s.transcript.json", transcript.Supplier, transcript.Transcript.StartedAt.Format("20060102-150405")))
+	if err := transcript.Write(file); err != nil {
+		logger.Error("Error writing transcript", "supplier", transcript.Supplier, "transcript_file", file, "error", err)
+		p.Send(utils.ViewStatusUpdateMsg{
+			Err:       fmt.Errorf("error writing transcript for supplier `%s`: %w", transcript.Supplier, err),
+			Completed: true,
+		})
+		return
+	}
+	logger.Info("Transcript written", "supplier", transcript.Supplier, "transcript_file", file, "steps", len(transcript.Transcript.Steps), "status", transcript.Transcript.Status)
+	p.Send(utils.ViewStatusUpdateMsg{
+		Message:   fmt.Sprintf("Transcript of %s written to %s", transcript.Supplier, file),
+		Completed: true,
+	})
+}
+
+// writeHARFile writes the recorded HTTP traffic of the client and http recipes into file (`--har`).
+// It is written after each client recipe, with the traffic of all client recipes so far. Errors are shown, but don't fail the supplier.
+func writeHARFile(logger *slog.Logger, p *tea.Program, file, supplier string, recorder *browser.HARRecorder) {
+	if err := recorder.Write(file); err != nil {
+		logger.Error("Error writing HAR file", "supplier", supplier, "har_file", file, "error", err)
+		p.Send(utils.ViewStatusUpdateMsg{
+			Err:       fmt.Errorf("error writing HAR file for supplier `%s`: %w", supplier, err),
+			Completed: true,
+		})
+		return
+	}
+	logger.Info("HAR file written", "supplier", supplier, "har_file", file)
+	p.Send(utils.ViewStatusUpdateMsg{
+		Message:   fmt.Sprintf("HTTP traffic of %s written to %s", supplier, file),
+		Completed: true,
+	})
+}
+
+// sendWebhookNotification posts the result of the run to `buchhalter_webhook_url` (e.g. to trigger an automation).
+// Like the status file, errors are logged only and don't change the exit code.
+func sendWebhookNotification(logger *slog.Logger, buchhalterConfig *settings.Config, result *syncResult) {
+	webhookUrl := strings.TrimSpace(buchhalterConfig.WebhookURL)
+	if len(webhookUrl) == 0 {
+		return
+	}
+	webhookSecret := buchhalterConfig.WebhookSecret
+	utils.RegisterSecret(webhookSecret)
+	// The path and query of the url may contain a token (e.g. of a chat webhook), only the host is logged
+	utils.RegisterSecret(webhookUrl)
+	webhookHost := ""
+	if parsedUrl, err := url.Parse(webhookUrl); err == nil {
+		webhookHost = parsedUrl.Host
+	}
+
+	payload := repository.NewWebhookPayload(cliVersion, time.Now(), result.ExitCode(), result.FailedSuppliers(), result.RunData())
+	if err := repository.SendWebhook(context.Background(), http.DefaultClient, webhookUrl, webhookSecret, payload); err != nil {
+		logger.Error("Error sending webhook notification", "webhook_host", webhookHost, "error", err)
+		fmt.Fprintf(os.Stderr, "Error sending webhook notification: %s\n", err)
+		return
+	}
+	logger.Info("Webhook notification sent", "webhook_host", webhookHost, "success", payload.Success, "new_files", payload.NewFilesCount, "signed", len(webhookSecret) > 0)
+}
+
+// lockAndCleanupStagingDirectory locks the staging directory for this run and removes stale downloads of previous runs.
+// If another run uses the staging directory, nothing is removed and no lock is returned.
+func lockAndCleanupStagingDirectory(logger *slog.Logger, stagingDirectory, cleanupAge string) *utils.StagingLock {
+	stagingLock, err := utils.LockStagingDirectory(stagingDirectory)
+	if errors.Is(err, utils.ErrStagingDirectoryLocked) {
+		logger.Warn("Skipping cleanup of staging directory, it is in use by another run", "staging_directory", stagingDirectory, "error", err)
+		return nil
+	}
+	if err != nil {
+		logger.Error("Error locking staging directory", "staging_directory", stagingDirectory, "error", err)
+		exitMessage := fmt.Sprintf("Error locking staging directory: %s", err)
+		exitWithLogo(exitMessage)
+	}
+
+	maxAge, err := time.ParseDuration(cleanupAge)
+	if err != nil {
+		exitMessage := fmt.Sprintf("Invalid value `%s` for `buchhalter_staging_cleanup_age` (expected a duration like `24h`): %s", cleanupAge, err)
+		exitWithLogo(exitMessage)
+	}
+	if maxAge <= 0 {
+		logger.Info("Cleanup of staging directory is disabled", "staging_directory", stagingDirectory)
+		return stagingLock
+	}
+
+	removed, err := utils.CleanupStagingDirectory(stagingDirectory, maxAge, time.Now())
+	for _, path := range removed {
+		logger.Info("Removed stale download of a previous run from staging directory", "path", path, "max_age", maxAge.String())
+	}
+	if err != nil {
+		logger.Error("Error cleaning up staging directory", "staging_directory", stagingDirectory, "error", err)
+	}
+
+	return stagingLock
 }
 
-func getSelectedVaultConfiguration(entries []vaultConfiguration) *vaultConfiguration {
+func getSelectedVaultConfiguration(entries []settings.Vault) *settings.Vault {
 	// If we have only one vault configured, use this one
 	if len(entries) == 1 {
 		return &entries[0]
@@ -201,7 +1016,7 @@ func getSelectedVaultConfiguration(entries []vaultConfiguration) *vaultConfigura
 	return nil
 }
 
-func getVaultFromVaultListByVaultName(vaults []vaultConfiguration, vaultName string) *vaultConfiguration {
+func getVaultFromVaultListByVaultName(vaults []settings.Vault, vaultName string) *settings.Vault {
 	lowerName := strings.ToLower(vaultName)
 	for _, vault := range vaults {
 		if strings.ToLower(vault.Name) == lowerName {
@@ -212,20 +1027,36 @@ func getVaultFromVaultListByVaultName(vaults []vaultConfiguration, vaultName str
 	return nil
 }
 
-func runSyncCommandLogic(p *tea.Program, logger *slog.Logger, config *syncCommandConfig, supplier string, buchhalterAPIClient *repository.BuchhalterAPIClient) {
+func runSyncCommandLogic(shutdownCtx context.Context, p *tea.Program, logger *slog.Logger, config *syncCommandConfig, supplier string, buchhalterAPIClient *repository.BuchhalterAPIClient, metricsReporter *repository.MetricsReporter, metrics *repository.MetricsAccumulator, result *syncResult) {
+	// The sync runs in its own goroutine, a crash must end the bubbletea program (to reset the terminal)
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			logger.Error("Crashed unexpectedly", "panic", utils.Redact(fmt.Sprint(recovered)))
+			result.MarkFatal()
+			p.Send(utils.ViewStatusUpdateMsg{
+				Err:        errors.New(handleCrash(recovered, debug.Stack(), "buchhalter sync")),
+				ShouldQuit: true,
+			})
+		}
+	}()
+
 	// Checking if we have a vault configuration
 	// This can happen if the user has not selected a vault configuration yet or starts it for the first time
-	if len(config.vaultConfig.Name) == 0 || len(config.vaultConfig.ID) == 0 {
+	// Except for 1Password, an empty name is the root vault with all items of the provider (e.g. the whole password store)
+	if len(config.vaultConfig.ID) == 0 || (len(config.vaultConfig.Name) == 0 && config.vaultProvider == vault.PROVIDER_1PASSWORD) {
 		errorMessage := ""
 		switch config.vaultSelectionMode {
 		case VaultSelectionModeCliFlag:
 			errorMessage = fmt.Sprintf("no default vault configuration found based on your input `%s`. Please run `buchhalter vault list` to see all configured vaults.", config.vaultSelectionValue)
 		case VaultSelectionModeDefaultConfig:
 			errorMessage = "no default vault configuration found. Please run `buchhalter vault select` first to select one 1Password vault as default."
+		case VaultSelectionModeProfile:
+			errorMessage = fmt.Sprintf("no vault configuration found for `%s` of the profile. Please run `buchhalter vault list` to see all configured vaults.", config.vaultSelectionValue)
 		case VaultSelectionNothingConfigured:
 			errorMessage = "no vault configuration found. Please run `buchhalter vault add` to add a new 1Password vault to buchhalter-cli."
 		}
 		logger.Error("No vault configuration found", "vault_selection_mode", config.vaultSelectionMode, "vault_selection_value", config.vaultSelectionValue)
+		result.MarkFatal()
 		p.Send(utils.ViewStatusUpdateMsg{
 			Err:        errors.New(errorMessage),
 			Completed:  true,
@@ -234,15 +1065,63 @@ func runSyncCommandLogic(p *tea.Program, logger *slog.Logger, config *syncComman
 		return
 	}
 
+	// The chrome binary is checked up front, instead of failing every recipe
+	chromePath, err := browser.ResolveChromePath(config.chromePath)
+	if err != nil {
+		logger.Error("Invalid chrome binary configured", "chrome_path", config.chromePath, "error", err)
+		result.MarkFatal()
+		p.Send(utils.ViewStatusUpdateMsg{
+			Err:        fmt.Errorf("invalid `--chrome-binary` / `buchhalter_chrome_path`: %w", err),
+			Completed:  true,
+			ShouldQuit: true,
+		})
+		return
+	}
+	if len(chromePath) > 0 {
+		logger.Debug("Using configured chrome binary", "chrome_path", chromePath)
+	} else {
+		logger.Debug("Using the chrome binary found by chromedp")
+	}
+	// Anti-bot portals may only work with a visible window, even if the sync runs headless
+	headlessPolicy := browser.NewHeadlessPolicy(config.headless, config.buchhalterConfig.HeadfulSuppliers)
+	domainPolicyConfig := browser.DomainPolicyConfig{
+		Restrict: config.buchhalterConfig.RestrictDomains,
+		Allowed:  config.buchhalterConfig.AllowedDomains,
+		Denied:   config.buchhalterConfig.DeniedDomains,
+	}
+	// The HTTP traffic of all client and http recipes of the run is recorded into one HAR file, a page per supplier
+	var harRecorder *browser.HARRecorder
+	if len(config.harFile) > 0 {
+		harRecorder = browser.NewHARRecorder(cliVersion)
+	}
+
 	// Init vault provider
-	logger.Info("Initializing credential provider", "provider", "1Password", "cli_command", config.vaultConfigBinary, "vault", config.vaultConfig.Name, "tag", config.vaultConfigTag)
-	statusUpdateMessage := fmt.Sprintf("Initializing credential provider 1Password with vault '%s' and tag '%s'", config.vaultConfig.Name, config.vaultConfigTag)
-	p.Send(utils.ViewStatusUpdateMsg{Message: statusUpdateMessage})
-	vaultProvider, err := vault.GetProvider(vault.PROVIDER_1PASSWORD, config.vaultConfigBinary, config.vaultConfig.Name, config.vaultConfigTag, logger)
+	var vaultProvider vault.Provider
+	providerName := vault.GetProviderName(config.vaultProvider)
+	statusUpdateMessage := fmt.Sprintf("Initializing credential provider %s with vault '%s' and tag '%s'", providerName, config.vaultConfig.Name, config.vaultConfigTag)
+	if config.vaultProvider == vault.PROVIDER_FILE {
+		statusUpdateMessage = fmt.Sprintf("Reading credentials from %s", config.credentialsFile)
+	}
+	if config.stdinCredentials != nil {
+		providerName = vault.PROVIDER_STDIN
+		statusUpdateMessage = "Reading credentials from stdin"
+		logger.Warn("Using credentials from stdin instead of the vault, this is meant for the development of recipes only")
+		p.Send(utils.ViewStatusUpdateMsg{
+			Err:       errors.New("using credentials from stdin instead of the vault. This is meant for the development of recipes only"),
+			Completed: true,
+		})
+		p.Send(utils.ViewStatusUpdateMsg{Message: statusUpdateMessage})
+		vaultProvider = vault.NewStdinProvider(*config.stdinCredentials, logger)
+	} else {
+		logger.Info("Initializing credential provider", "provider", providerName, "cli_command", config.vaultConfigBinary, "vault", config.vaultConfig.Name, "tag", config.vaultConfigTag)
+		p.Send(utils.ViewStatusUpdateMsg{Message: statusUpdateMessage})
+		vaultProvider, err = vault.GetProvider(config.vaultProvider, config.vaultConfigBinary, config.vaultConfig.Name, config.vaultConfigTag, config.keePassConfig, config.credentialsFile, logger)
+	}
 	if err != nil {
-		logger.Error("error initializing credential provider 1Password: %s", "error", err)
+		logger.Error("error initializing credential provider", "provider", providerName, "error", err)
+		result.MarkFatal()
 		p.Send(utils.ViewStatusUpdateMsg{
-			Err:        fmt.Errorf("error initializing credential provider 1Password: %s", vaultProvider.GetHumanReadableErrorMessage(err)),
+			Err:        fmt.Errorf("error initializing credential provider %s: %s", providerName, vaultProvider.GetHumanReadableErrorMessage(err)),
 			Completed:  true,
 			ShouldQuit: true,
 		})
@@ -252,9 +1131,10 @@ func runSyncCommandLogic(p *tea.Program, logger *slog.Logger, config *syncComman
 	// Load vault items/try to connect to vault
 	vaultItems, err := vaultProvider.LoadVaultItems()
 	if err != nil {
-		logger.Error("error initializing credential provider 1Password", "error", err)
+		logger.Error("error initializing credential provider", "provider", providerName, "error", err)
+		result.MarkFatal()
 		p.Send(utils.ViewStatusUpdateMsg{
-			Err:        fmt.Errorf("error initializing credential provider 1Password: %s", vaultProvider.GetHumanReadableErrorMessage(err)),
+			Err:        fmt.Errorf("error initializing credential provider %s: %s", providerName, vaultProvider.GetHumanReadableErrorMessage(err)),
 			Completed:  true,
 			ShouldQuit: true,
 		})
@@ -267,16 +1147,17 @@ func runSyncCommandLogic(p *tea.Program, logger *slog.Logger, config *syncComman
 
 	// Check if vault items are available
 	if len(vaultItems) == 0 {
-		logger.Error("No credential items loaded from vault", "provider", "1Password", "cli_command", config.vaultConfigBinary, "vault", config.vaultConfig.Name, "tag", config.vaultConfigTag)
-		exitMessage := fmt.Sprintf("No credential items found in vault '%s' with tag '%s'. Please check your 1password vault items.", config.vaultConfig.Name, config.vaultConfigTag)
+		logger.Error("No credential items loaded from vault", "provider", providerName, "cli_command", config.vaultConfigBinary, "vault", config.vaultConfig.Name, "tag", config.vaultConfigTag)
+		exitMessage := fmt.Sprintf("No credential items found in vault '%s' with tag '%s'. Please check your %s vault items.", config.vaultConfig.Name, config.vaultConfigTag, providerName)
+		result.MarkFatal()
 		p.Send(utils.ViewStatusUpdateMsg{
-			Err:        fmt.Errorf("error initializing credential provider 1Password: %s", exitMessage),
+			Err:        fmt.Errorf("error initializing credential provider %s: %s", providerName, exitMessage),
 			Completed:  true,
 			ShouldQuit: true,
 		})
 		return
 	}
-	logger.Info("Credential items loaded from vault", "num_items", len(vaultItems), "provider", "1Password", "cli_command", config.vaultConfigBinary, "vault", config.vaultConfig.Name, "tag", config.vaultConfigTag)
+	logger.Info("Credential items loaded from vault", "num_items", len(vaultItems), "provider", providerName, "cli_command", config.vaultConfigBinary, "vault", config.vaultConfig.Name, "tag", config.vaultConfigTag)
 	p.Send(utils.ViewStatusUpdateMsg{
 		Message:   fmt.Sprintf("Loaded %d credential items from vault '%s' with tag '%s'", len(vaultItems), config.vaultConfig.Name, config.vaultConfigTag),
 		Completed: true,
@@ -288,6 +1169,7 @@ func runSyncCommandLogic(p *tea.Program, logger *slog.Logger, config *syncComman
 	localOICDBChecksum, err := recipeParser.GetChecksumOfLocalOICDB()
 	if err != nil {
 		logger.Error("Error calculating checksum of local Open Invoice Collector Database", "error", err)
+		result.MarkFatal()
 		p.Send(utils.ViewStatusUpdateMsg{
 			Err:        fmt.Errorf("error calculating checksum of local Open Invoice Collector Database: %w", err),
 			Completed:  true,
@@ -299,6 +1181,7 @@ func runSyncCommandLogic(p *tea.Program, logger *slog.Logger, config *syncComman
 	localOICDBSchemaChecksum, err := recipeParser.GetChecksumOfLocalOICDBSchema()
 	if err != nil {
 		logger.Error("Error calculating checksum of local Open Invoice Collector Database Schema", "error", err)
+		result.MarkFatal()
 		p.Send(utils.ViewStatusUpdateMsg{
 			Err:        fmt.Errorf("error calculating checksum of local Open Invoice Collector Database Schema: %w", err),
 			Completed:  true,
@@ -315,7 +1198,26 @@ func runSyncCommandLogic(p *tea.Program, logger *slog.Logger, config *syncComman
 	logger.Info("Building document archive index ...")
 
 	// Init document archive
-	documentArchive := archive.NewDocumentArchive(logger, config.buchhalterDocumentsDirectory)
+	documentLayout := config.buchhalterConfig.DocumentLayout
+	if !archive.IsSupportedLayout(documentLayout) {
+		logger.Warn("Unsupported document layout configured, falling back to supplier layout", "document_layout", documentLayout)
+		p.Send(utils.ViewStatusUpdateMsg{
+			Err:       fmt.Errorf("unsupported value `%s` for `buchhalter_document_layout`, using `%s` instead", documentLayout, archive.LayoutSupplier),
+			Completed: true,
+		})
+		documentLayout = archive.LayoutSupplier
+	}
+	documentArchive := archive.NewDocumentArchive(logger, config.buchhalterDocumentsDirectory, documentLayout)
+	dedupScope := config.buchhalterConfig.DedupScope
+	if !archive.IsSupportedDedupScope(dedupScope) {
+		logger.Warn("Unsupported dedup scope configured, falling back to global scope", "dedup_scope", dedupScope)
+		p.Send(utils.ViewStatusUpdateMsg{
+			Err:       fmt.Errorf("unsupported value `%s` for `buchhalter_dedup_scope`, using `%s` instead", dedupScope, archive.DedupScopeGlobal),
+			Completed: true,
+		})
+		dedupScope = archive.DedupScopeGlobal
+	}
+	documentArchive.SetDedupScope(dedupScope)
 	err = documentArchive.BuildArchiveIndex()
 	if err != nil {
 		logger.Error("Error building document archive index", "error", err)
@@ -328,58 +1230,108 @@ func runSyncCommandLogic(p *tea.Program, logger *slog.Logger, config *syncComman
 			Message:   "Building archive index",
 			Completed: true,
 		})
-	}
 
-	// Check for OICDB schema updates
-	p.Send(utils.ViewStatusUpdateMsg{Message: "Checking for OICDB schema updates"})
-	logger.Info("Checking for OICDB schema updates ...", "local_checksum", localOICDBSchemaChecksum)
+		// Offer a migration, if the layout was changed
+		migrations, err := documentArchive.PlanMigration()
+		if err != nil {
+			logger.Error("Error checking the document layout of the archive", "error", err)
+		} else if len(migrations) > 0 {
+			logger.Info("Documents are not stored in the configured layout", "document_layout", documentArchive.Layout(), "num_documents", len(migrations))
+			p.Send(utils.ViewStatusUpdateMsg{
+				Message:   fmt.Sprintf("%d invoices are not stored in the layout `%s`. Run `buchhalter archive migrate` to move them", len(migrations), documentArchive.Layout()),
+				Completed: true,
+			})
+		}
+	}
 
-	err = buchhalterAPIClient.UpdateOpenInvoiceCollectorDBSchemaIfAvailable(localOICDBSchemaChecksum)
-	if err != nil {
-		logger.Error("Error checking for OICDB schema updates", "error", err)
+	// Init post-processors for new documents
+	postProcessors := []postprocess.PostProcessor{}
+	pdfMergeMode := config.buchhalterConfig.PdfMerge
+	if !postprocess.IsSupportedMergeMode(pdfMergeMode) {
+		logger.Warn("Unsupported PDF merge mode configured, PDF documents are not merged", "pdf_merge", pdfMergeMode)
 		p.Send(utils.ViewStatusUpdateMsg{
-			Err:       fmt.Errorf("error checking for OICDB schema updates: %w", err),
-			Completed: true,
-		})
-	} else {
-		p.Send(utils.ViewStatusUpdateMsg{
-			Message:   "Checking for OICDB schema updates",
+			Err:       fmt.Errorf("unsupported value `%s` for `buchhalter_pdf_merge`, using `%s` instead", pdfMergeMode, postprocess.MergeModeOff),
 			Completed: true,
 		})
+		pdfMergeMode = postprocess.MergeModeOff
+	}
+	if pdfMergeMode != postprocess.MergeModeOff {
+		postProcessors = append(postProcessors, postprocess.NewPDFMerger(logger, documentArchive, pdfMergeMode))
 	}
 
-	developmentMode := viper.GetBool("dev")
-	if !developmentMode {
-		// Check for OICDB repository updates
-		p.Send(utils.ViewStatusUpdateMsg{Message: "Checking for OICDB repository updates"})
-		logger.Info("Checking for OICDB repository updates ...", "local_checksum", localOICDBChecksum)
+	// Check for OICDB updates
+	// The update phase is bounded and not fatal: if the API isn't reachable, the local OICDB is used.
+	// A recipe file bypasses the OICDB, no updates are needed.
+	developmentMode := config.buchhalterConfig.Dev
+	if len(config.recipeFile) == 0 {
+		oicdbUpdateCtx, cancelOICDBUpdate := context.WithTimeout(context.Background(), oicdbUpdateTimeout(logger, config.buchhalterConfig.OICDBUpdateTimeout))
+		defer cancelOICDBUpdate()
+		buchhalterAPIClient.SetUpdateAttempts(config.buchhalterConfig.OICDBUpdateAttempts)
+
+		p.Send(utils.ViewStatusUpdateMsg{Message: "Checking for OICDB schema updates"})
+		logger.Info("Checking for OICDB schema updates ...", "local_checksum", localOICDBSchemaChecksum)
 
-		err = buchhalterAPIClient.UpdateOpenInvoiceCollectorDBIfAvailable(localOICDBChecksum)
+		err = buchhalterAPIClient.UpdateOpenInvoiceCollectorDBSchemaIfAvailable(oicdbUpdateCtx, localOICDBSchemaChecksum)
 		if err != nil {
-			logger.Error("Error checking for OICDB repository updates", "error", err)
+			logger.Warn("Error checking for OICDB schema updates, using the local OICDB schema", "error", err)
 			p.Send(utils.ViewStatusUpdateMsg{
-				Err:       fmt.Errorf("error for OICDB repository updates: %w", err),
+				Message:   "Couldn't check for OICDB schema updates, using the local OICDB schema",
 				Completed: true,
 			})
 		} else {
 			p.Send(utils.ViewStatusUpdateMsg{
-				Message:   "Checking for OICDB repository updates",
+				Message:   "Checking for OICDB schema updates",
 				Completed: true,
 			})
 		}
+
+		if !developmentMode {
+			// Check for OICDB repository updates
+			p.Send(utils.ViewStatusUpdateMsg{Message: "Checking for OICDB repository updates"})
+			logger.Info("Checking for OICDB repository updates ...", "local_checksum", localOICDBChecksum)
+
+			err = buchhalterAPIClient.UpdateOpenInvoiceCollectorDBIfAvailable(oicdbUpdateCtx, localOICDBChecksum)
+			if err != nil {
+				logger.Warn("Error checking for OICDB repository updates, using the local OICDB", "error", err)
+				p.Send(utils.ViewStatusUpdateMsg{
+					Message:   "Couldn't check for OICDB repository updates, using the local OICDB",
+					Completed: true,
+				})
+			} else {
+				p.Send(utils.ViewStatusUpdateMsg{
+					Message:   "Checking for OICDB repository updates",
+					Completed: true,
+				})
+			}
+		}
+		cancelOICDBUpdate()
 	}
 
 	statusUpdateMessage = "Loading recipes and credentials for suppliers"
 	if len(supplier) > 0 {
 		statusUpdateMessage = fmt.Sprintf("Loading recipe and credentials for supplier `%s`", supplier)
 	}
+	if len(config.recipeFile) > 0 {
+		statusUpdateMessage = fmt.Sprintf("Loading recipe file `%s` and credentials", config.recipeFile)
+	}
 	p.Send(utils.ViewStatusUpdateMsg{
 		Message: statusUpdateMessage,
 	})
-	recipesToExecute, err := loadRecipesAndMatchingVaultItems(logger, supplier, vaultProvider, recipeParser)
+	var recipesToExecute []recipeToExecute
+	if len(config.recipeFile) > 0 {
+		recipesToExecute, err = loadRecipeFileAndMatchingVaultItems(logger, config.buchhalterConfig, config.recipeFile, config.recipeFileItem, vaultProvider, recipeParser)
+		if err == nil {
+			// Only the documents of the recipe's supplier are uploaded
+			supplier = recipesToExecute[0].recipe.Supplier
+		}
+	} else {
+		matchCacheFile := filepath.Join(config.buchhalterDirectory, "cache", fmt.Sprintf("matches-%s.json", config.vaultConfig.ID))
+		recipesToExecute, err = loadRecipesAndMatchingVaultItems(p, logger, config.buchhalterConfig, supplier, vaultProvider, recipeParser, matchCacheFile)
+	}
 	if err != nil {
 		// No error logging needed. This is done in `loadRecipesAndMatchingVaultItems`
 		// If an error occurs, this means the recipes could not be loaded.
+		result.MarkFatal()
 		p.Send(utils.ViewStatusUpdateMsg{
 			Err:        fmt.Errorf("error loading recipes: %w", err),
 			ShouldQuit: true,
@@ -387,32 +1339,74 @@ func runSyncCommandLogic(p *tea.Program, logger *slog.Logger, config *syncComman
 		return
 	}
 
+	// Multiple vault items for the same recipe would run it multiple times, this is only done on purpose (`--on-ambiguous all`)
+	recipesToExecute = resolveAmbiguousRecipes(p, logger, recipesToExecute, config.onAmbiguous)
+
 	// At this point in time, we have all the information we need to send metrics
-	p.Send(buchhalterMetricsRecord{
-		CliVersion:   cliVersion,
-		VaultVersion: vaultProvider.Version,
-		OicdbVersion: recipeParser.OicdbVersion,
-	})
+	metrics.SetCliVersion(cliVersion)
+	metrics.SetVaultVersion(vaultProvider.GetVersion())
+	metrics.SetOicdbVersion(recipeParser.OicdbVersion)
 
 	// No pair of credentials found for supplier/recipes
 	if len(recipesToExecute) == 0 {
 		loggingErrorMessage := "No matching pair of recipes <--> credentials found for suppliers"
 		if len(supplier) > 0 {
 			loggingErrorMessage = fmt.Sprintf("No matching pair of recipes <--> credentials found for supplier `%s`", supplier)
+			if !parser.NewSupplierFilter(config.buchhalterConfig.SuppliersInclude, config.buchhalterConfig.SuppliersExclude).Allows(supplier) {
+				loggingErrorMessage = fmt.Sprintf("Supplier `%s` is not selected by `buchhalter_suppliers_include` / `buchhalter_suppliers_exclude`", supplier)
+			}
 		}
 		logger.Error(loggingErrorMessage, "supplier", supplier, "error", err)
+		result.MarkFatal()
 		p.Send(utils.ViewStatusUpdateMsg{
 			Err:        errors.New(loggingErrorMessage),
 			ShouldQuit: true,
 		})
 		return
 	}
+	// Login checks only run the steps up to the login (`--login-only`)
+	if config.loginOnly {
+		for i := range recipesToExecute {
+			loginRecipe, err := parser.LoginRecipe(recipesToExecute[i].recipe)
+			if err != nil {
+				logger.Error("Recipe has no login step", "supplier", recipesToExecute[i].recipe.Supplier, "error", err)
+				result.MarkFatal()
+				p.Send(utils.ViewStatusUpdateMsg{
+					Err:        fmt.Errorf("can't check the login: %w", err),
+					ShouldQuit: true,
+				})
+				return
+			}
+			recipesToExecute[i].recipe = loginRecipe
+		}
+	}
 	statusUpdateMessage = fmt.Sprintf("%s (OICDB %s)", statusUpdateMessage, recipeParser.OicdbVersion)
 	p.Send(utils.ViewStatusUpdateMsg{
 		Message:   statusUpdateMessage,
 		Completed: true,
 	})
 
+	// Completed suppliers are recorded, to resume the run if it is interrupted.
+	// Without `--resume`, all suppliers run and a new checkpoint is started.
+	checkpointFile := filepath.Join(config.buchhalterDirectory, "checkpoints", fmt.Sprintf("sync-%s.json", config.vaultConfig.ID))
+	checkpoint := utils.NewSyncCheckpoint(checkpointFile, config.buchhalterDocumentsDirectory)
+	if viper.GetBool("cmd-arg-resume") {
+		checkpoint, err = utils.LoadSyncCheckpoint(checkpointFile, config.buchhalterDocumentsDirectory)
+		if err != nil {
+			logger.Warn("Error loading sync checkpoint, running all suppliers", "checkpoint_file", checkpointFile, "error", err)
+		}
+		recipesToExecute = skipCompletedRecipes(logger, p, checkpoint, recipesToExecute)
+	}
+
+	// The start of the last successful sync per supplier is recorded for incremental runs (`--since-last-run`),
+	// after the recipes finished and the documents of the supplier were uploaded to Buchhalter API (if they are uploaded)
+	lastRunsFile := filepath.Join(config.buchhalterConfigDirectory, fmt.Sprintf("last-runs-%s.json", config.vaultConfig.ID))
+	lastRuns, err := utils.LoadLastRuns(lastRunsFile)
+	if err != nil {
+		logger.Warn("Error loading last runs, syncing all documents", "last_runs_file", lastRunsFile, "error", err)
+	}
+	successfulRuns := map[string]time.Time{}
+
 	recipeCount := len(recipesToExecute)
 	if recipeCount == 1 {
 		statusUpdateMessage = fmt.Sprintf("Running one recipe for supplier `%s` ...", recipesToExecute[0].recipe.Supplier)
@@ -424,46 +1418,110 @@ func runSyncCommandLogic(p *tea.Program, logger *slog.Logger, config *syncComman
 	p.Send(utils.ViewStatusUpdateMsg{Message: statusUpdateMessage})
 	p.Send(utils.ViewProgressUpdateMsg{Percent: 0.001})
 
-	buchhalterConfigDirectory := viper.GetString("buchhalter_config_directory")
-	buchhalterMaxDownloadFilesPerReceipt := viper.GetInt("buchhalter_max_download_files_per_receipt")
+	buchhalterConfigDirectory := config.buchhalterConfig.ConfigDirectory
+	buchhalterMaxDownloadFilesPerReceipt := config.buchhalterConfig.MaxDownloadFilesPerReceipt
+	// Certificate errors are only relaxed for the hosts of an explicit allowlist
+	tlsOverrides, err := browser.NewTLSOverrides(config.buchhalterConfig.TLSOverrides)
+	if err != nil {
+		logger.Error("Invalid TLS overrides configured", "error", err)
+		result.MarkFatal()
+		p.Send(utils.ViewStatusUpdateMsg{
+			Err:        fmt.Errorf("invalid `buchhalter_tls_overrides`: %w", err),
+			Completed:  true,
+			ShouldQuit: true,
+		})
+		return
+	}
+	// Client certificates of supplier APIs with mutual TLS (client recipes only)
+	clientCertificateConfigs := config.buchhalterConfig.ClientCertificates
+	for _, clientCertificateConfig := range clientCertificateConfigs {
+		utils.RegisterSecret(clientCertificateConfig.Passphrase)
+	}
+	clientCertificates, err := browser.NewClientCertificates(clientCertificateConfigs, buchhalterConfigDirectory)
+	if err != nil {
+		logger.Error("Invalid client certificates configured", "error", err)
+		result.MarkFatal()
+		p.Send(utils.ViewStatusUpdateMsg{
+			Err:        fmt.Errorf("invalid `buchhalter_client_certificates`: %w", err),
+			Completed:  true,
+			ShouldQuit: true,
+		})
+		return
+	}
+	buchhalterDownloadConcurrency := config.buchhalterConfig.DownloadConcurrency
+	if err := parser.ValidateDownloadConcurrency(buchhalterDownloadConcurrency); err != nil {
+		logger.Warn("Invalid download concurrency configured, using the default", "download_concurrency", buchhalterDownloadConcurrency, "default", parser.DefaultDownloadConcurrency)
+		p.Send(utils.ViewStatusUpdateMsg{
+			Err:       fmt.Errorf("invalid value `%d` for `buchhalter_download_concurrency` (%w), using `%d` instead", buchhalterDownloadConcurrency, err, parser.DefaultDownloadConcurrency),
+			Completed: true,
+		})
+		buchhalterDownloadConcurrency = parser.DefaultDownloadConcurrency
+	}
 
+	verboseMode := viper.GetBool("cmd-arg-verbose")
 	totalStepCount := 0
-	stepCountInCurrentRecipe := 0
-	baseCountStep := 0
 	chromeVersion := ""
-	recipeRunData := make(repository.RunData, 0)
 	recipeResult := utils.RecipeResult{}
 	for i := range recipesToExecute {
 		totalStepCount += len(recipesToExecute[i].recipe.Steps)
 	}
+	progressTracker := utils.NewProgressTracker(totalStepCount, func(msg utils.ViewProgressUpdateMsg) {
+		p.Send(msg)
+	})
+	progressTracker.SetPause(config.pause)
 	for i := range recipesToExecute {
 		startTime := time.Now()
-		stepCountInCurrentRecipe = len(recipesToExecute[i].recipe.Steps)
+		recipeProgress := progressTracker.Recipe(len(recipesToExecute[i].recipe.Steps))
 
 		// Load username, password, totp from vault
 		p.Send(utils.ViewStatusUpdateMsg{
-			Message: fmt.Sprintf("Requesting credentials from vault for supplier `%s`", recipesToExecute[i].recipe.Supplier),
+			Message: fmt.Sprintf("Requesting credentials from vault for supplier %s", recipesToExecute[i].supplierLabel()),
+		})
+		logger.Info("Requesting credentials from vault", "supplier", recipesToExecute[i].recipe.Supplier, "credentials_id", recipesToExecute[i].vaultItemId)
+		recipeCredentials, err := vaultProvider.GetCredentialsByItemId(recipesToExecute[i].vaultItemId, vault.CredentialFields{
+			Username: recipesToExecute[i].recipe.UsernameField,
+			Password: recipesToExecute[i].recipe.PasswordField,
+			Totp:     recipesToExecute[i].recipe.TotpField,
+			TotpWindow: vault.TotpWindow{
+				ClockSkew:       config.totpClockSkew,
+				AcceptsAdjacent: recipesToExecute[i].recipe.TotpAdjacentWindow,
+			},
 		})
-		logger.Info("Requesting credentials from vault", "supplier", recipesToExecute[i].recipe.Supplier)
-		recipeCredentials, err := vaultProvider.GetCredentialsByItemId(recipesToExecute[i].vaultItemId)
 		if err != nil {
 			logger.Error("error while requesting credentials from vault", "supplier", recipesToExecute[i].recipe.Supplier, "error", err)
 			p.Send(utils.ViewStatusUpdateMsg{
 				Err:       vaultProvider.GetHumanReadableErrorMessage(err),
 				Completed: true,
 			})
+			result.MarkSupplierFailed(recipesToExecute[i].recipe.Supplier)
+			recipeProgress.Finish()
+			continue
+		}
+		utils.RegisterSecret(recipeCredentials.Username)
+		utils.RegisterSecret(recipeCredentials.Password)
+		utils.RegisterSecret(recipeCredentials.Totp)
+
+		// A recipe without the credentials it types can't log in, we skip it instead of starting a browser for it
+		if missingFields := parser.MissingCredentials(*recipesToExecute[i].recipe, recipeCredentials); len(missingFields) > 0 {
+			logger.Warn("Skipping supplier due to missing credentials", "supplier", recipesToExecute[i].recipe.Supplier, "credentials_id", recipesToExecute[i].vaultItemId, "missing_fields", missingFields)
+			p.Send(utils.ViewStatusUpdateMsg{
+				Message:   fmt.Sprintf("Skipped supplier %s: missing credentials (the vault item has no %s)", recipesToExecute[i].supplierLabel(), strings.Join(missingFields, " and ")),
+				Completed: true,
+			})
+			result.MarkSupplierMissingCredentials(recipesToExecute[i].recipe.Supplier, missingFields)
+			recipeProgress.Finish()
 			continue
 		}
 		p.Send(utils.ViewStatusUpdateMsg{
-			Message:   fmt.Sprintf("Requested credentials from vault for supplier `%s`", recipesToExecute[i].recipe.Supplier),
+			Message:   fmt.Sprintf("Requested credentials from vault for supplier %s", recipesToExecute[i].supplierLabel()),
 			Completed: true,
 		})
 
-		p.Send(utils.ViewStatusUpdateMsg{Message: fmt.Sprintf("Downloading invoices from `%s`", recipesToExecute[i].recipe.Supplier)})
-		logger.Info("Downloading invoices ...", "supplier", recipesToExecute[i].recipe.Supplier, "supplier_type", recipesToExecute[i].recipe.Type)
+		p.Send(utils.ViewStatusUpdateMsg{Message: fmt.Sprintf("Downloading invoices from %s", recipesToExecute[i].supplierLabel())})
+		logger.Info("Downloading invoices ...", "supplier", recipesToExecute[i].recipe.Supplier, "supplier_type", recipesToExecute[i].recipe.Type, "headless", headlessPolicy.Headless(recipesToExecute[i].recipe.Supplier))
 		switch recipesToExecute[i].recipe.Type {
 		case "browser":
-			browserDriver, err := browser.NewBrowserDriver(logger, recipeCredentials, config.buchhalterDocumentsDirectory, documentArchive, buchhalterMaxDownloadFilesPerReceipt)
+			browserDriver, err := browser.NewBrowserDriver(logger, recipeCredentials, config.buchhalterStagingDirectory, documentArchive, buchhalterMaxDownloadFilesPerReceipt, buchhalterDownloadConcurrency, tlsOverrides, chromePath, headlessPolicy.Headless(recipesToExecute[i].recipe.Supplier), config.keepDownloads, browser.NewDomainPolicy(recipesToExecute[i].recipe, domainPolicyConfig))
 			if err != nil {
 				logger.Error("Error initializing a new browser driver", "error", err, "supplier", recipesToExecute[i].recipe.Supplier)
 				p.Send(utils.ViewStatusUpdateMsg{
@@ -471,6 +1529,8 @@ func runSyncCommandLogic(p *tea.Program, logger *slog.Logger, config *syncComman
 					Completed: true,
 				})
 				// We skip this supplier and continue with the next one
+				result.MarkSupplierFailed(recipesToExecute[i].recipe.Supplier)
+				recipeProgress.Finish()
 				continue
 			}
 
@@ -478,7 +1538,15 @@ func runSyncCommandLogic(p *tea.Program, logger *slog.Logger, config *syncComman
 			// This is needed in case of an external abort signal (e.g. CTRL+C).
 			p.Send(updateBrowserContext{ctx: browserDriver.GetContext()})
 
-			recipeResult, err = browserDriver.RunRecipe(p, totalStepCount, stepCountInCurrentRecipe, baseCountStep, recipesToExecute[i].recipe)
+			browserDriver.SetSupplierTimeout(config.supplierTimeout)
+			browserDriver.SetVerboseBrowser(config.verboseBrowser)
+			browserDriver.SetUnzipLimits(utils.UnzipLimits{MaxSizeMB: config.buchhalterConfig.UnzipMaxSizeMB, MaxFiles: config.buchhalterConfig.UnzipMaxFiles})
+			browserDriver.SetTotpPrompt(config.totpPrompt)
+			browserDriver.SetScreenshotDirectory(config.screenshotDirectory)
+			recipeResult, err = browserDriver.RunRecipe(p, recipeProgress, recipesToExecute[i].recipe)
+			if len(config.transcriptDirectory) > 0 {
+				writeRecipeTranscript(logger, p, config.transcriptDirectory, browserDriver.Transcript())
+			}
 			if err != nil {
 				logger.Error("Error running browser recipe", "error", err, "supplier", recipesToExecute[i].recipe.Supplier)
 				p.Send(utils.ViewStatusUpdateMsg{
@@ -486,16 +1554,35 @@ func runSyncCommandLogic(p *tea.Program, logger *slog.Logger, config *syncComman
 					Completed: true,
 				})
 				// We skip this supplier and continue with the next one
+				result.MarkSupplierFailed(recipesToExecute[i].recipe.Supplier)
 				continue
 			}
 			chromeVersion = browserDriver.ChromeVersion
+			if config.keepDownloads && recipeResult.Status == "error" {
+				p.Send(utils.ViewStatusUpdateMsg{
+					Message:   fmt.Sprintf("Downloads of %s kept in %s", recipesToExecute[i].supplierLabel(), filepath.Join(config.buchhalterStagingDirectory, recipesToExecute[i].recipe.Supplier)),
+					Completed: true,
+				})
+			}
 
 			// We don't need to call `chromedp.Cancel()` here.
 			// The browserDriver will be closed gracefully when the recipe is finished.
 			// In case of an external abort signal (e.g. CTRL+C), bubbletea will call `chromedp.Cancel()`.
 
 		case "client":
-			clientDriver, err := browser.NewClientAuthBrowserDriver(logger, recipeCredentials, buchhalterConfigDirectory, config.buchhalterDocumentsDirectory, documentArchive)
+			clientCertificate := clientCertificates.ForSupplier(recipesToExecute[i].recipe.Supplier)
+			if recipesToExecute[i].recipe.ClientCertificate && clientCertificate == nil {
+				logger.Error("Recipe requires a client certificate, but none is configured", "supplier", recipesToExecute[i].recipe.Supplier)
+				p.Send(utils.ViewStatusUpdateMsg{
+					Err:       fmt.Errorf("supplier `%s` requires a client certificate, configure it in `buchhalter_client_certificates`", recipesToExecute[i].recipe.Supplier),
+					Completed: true,
+				})
+				// We skip this supplier and continue with the next one
+				result.MarkSupplierFailed(recipesToExecute[i].recipe.Supplier)
+				recipeProgress.Finish()
+				continue
+			}
+			clientDriver, err := browser.NewClientAuthBrowserDriver(logger, recipeCredentials, buchhalterConfigDirectory, config.buchhalterStagingDirectory, documentArchive, tlsOverrides, clientCertificate, chromePath, headlessPolicy.Headless(recipesToExecute[i].recipe.Supplier))
 			if err != nil {
 
 				logger.Error("Error initializing a new client auth browser driver", "error", err, "supplier", recipesToExecute[i].recipe.Supplier)
@@ -504,6 +1591,8 @@ func runSyncCommandLogic(p *tea.Program, logger *slog.Logger, config *syncComman
 					Completed: true,
 				})
 				// We skip this supplier and continue with the next one
+				result.MarkSupplierFailed(recipesToExecute[i].recipe.Supplier)
+				recipeProgress.Finish()
 				continue
 			}
 
@@ -511,7 +1600,18 @@ func runSyncCommandLogic(p *tea.Program, logger *slog.Logger, config *syncComman
 			// This is needed in case of an external abort signal (e.g. CTRL+C).
 			p.Send(updateBrowserContext{ctx: clientDriver.GetContext()})
 
-			recipeResult, err = clientDriver.RunRecipe(p, totalStepCount, stepCountInCurrentRecipe, baseCountStep, recipesToExecute[i].recipe)
+			if harRecorder != nil {
+				clientDriver.SetHARRecorder(harRecorder)
+			}
+			clientDriver.SetSupplierTimeout(config.supplierTimeout)
+			clientDriver.SetTotpPrompt(config.totpPrompt)
+			if lastRun, ok := lastRuns.Since(recipesToExecute[i].recipe.Supplier); ok && config.sinceLastRun {
+				clientDriver.SetLastRun(lastRun)
+			}
+			recipeResult, err = clientDriver.RunRecipe(p, recipeProgress, recipesToExecute[i].recipe)
+			if harRecorder != nil {
+				writeHARFile(logger, p, config.harFile, recipesToExecute[i].recipe.Supplier, harRecorder)
+			}
 			if err != nil {
 				logger.Error("Error running browser recipe", "error", err, "supplier", recipesToExecute[i].recipe.Supplier)
 				p.Send(utils.ViewStatusUpdateMsg{
@@ -519,19 +1619,51 @@ func runSyncCommandLogic(p *tea.Program, logger *slog.Logger, config *syncComman
 					Completed: true,
 				})
 				// We skip this supplier and continue with the next one
+				result.MarkSupplierFailed(recipesToExecute[i].recipe.Supplier)
+				continue
+			}
+			chromeVersion = clientDriver.ChromeVersion
+
+			// We don't need to call `chromedp.Cancel()` here.
+			// The browserDriver will be closed gracefully when the recipe is finished.
+			// In case of an external abort signal (e.g. CTRL+C), bubbletea will call `chromedp.Cancel()`.
+
+		case "http":
+			// HTTP recipes run without a browser, so there is no browser context for the view layer
+			httpDriver, err := browser.NewHTTPDriver(logger, recipeCredentials, config.buchhalterStagingDirectory, documentArchive, tlsOverrides, browser.NewDomainPolicy(recipesToExecute[i].recipe, domainPolicyConfig))
+			if err != nil {
+				logger.Error("Error initializing a new http driver", "error", err, "supplier", recipesToExecute[i].recipe.Supplier)
+				p.Send(utils.ViewStatusUpdateMsg{
+					Err:       fmt.Errorf("error initializing a new http driver for supplier `%s`: %w", recipesToExecute[i].recipe.Supplier, err),
+					Completed: true,
+				})
+				// We skip this supplier and continue with the next one
+				result.MarkSupplierFailed(recipesToExecute[i].recipe.Supplier)
+				recipeProgress.Finish()
+				continue
+			}
+
+			if harRecorder != nil {
+				httpDriver.SetHARRecorder(harRecorder)
+			}
+			httpDriver.SetSupplierTimeout(config.supplierTimeout)
+			recipeResult, err = httpDriver.RunRecipe(p, recipeProgress, recipesToExecute[i].recipe)
+			if harRecorder != nil {
+				writeHARFile(logger, p, config.harFile, recipesToExecute[i].recipe.Supplier, harRecorder)
+			}
+			if err != nil {
+				logger.Error("Error running http recipe", "error", err, "supplier", recipesToExecute[i].recipe.Supplier)
+				p.Send(utils.ViewStatusUpdateMsg{
+					Err:       fmt.Errorf("error running http recipe for supplier `%s`: %w", recipesToExecute[i].recipe.Supplier, err),
+					Completed: true,
+				})
+				// We skip this supplier and continue with the next one
+				result.MarkSupplierFailed(recipesToExecute[i].recipe.Supplier)
 				continue
 			}
-			chromeVersion = clientDriver.ChromeVersion
-
-			// We don't need to call `chromedp.Cancel()` here.
-			// The browserDriver will be closed gracefully when the recipe is finished.
-			// In case of an external abort signal (e.g. CTRL+C), bubbletea will call `chromedp.Cancel()`.
 		}
 
-		// Send Chrome Version into metrics
-		if len(chromeVersion) > 0 {
-			p.Send(buchhalterMetricsRecord{ChromeVersion: chromeVersion})
-		}
+		metrics.SetChromeVersion(chromeVersion)
 
 		runDataSupplierRecord := repository.RunDataSupplier{
 			// Recipe
@@ -541,12 +1673,23 @@ func runSyncCommandLogic(p *tea.Program, logger *slog.Logger, config *syncComman
 			// Run result
 			Status:           recipeResult.StatusText,
 			LastErrorMessage: recipeResult.LastErrorMessage,
+			ErrorCode:        recipeResult.ErrorCode,
 			NewFilesCount:    recipeResult.NewFilesCount,
 			Duration:         time.Since(startTime).Seconds(),
 		}
 
 		p.Send(newRecipeRunDataRecordMsg{record: runDataSupplierRecord})
-		recipeRunData = append(recipeRunData, runDataSupplierRecord)
+		result.AddRunData(runDataSupplierRecord)
+		if recipeResult.Status == "error" {
+			result.MarkSupplierFailed(recipesToExecute[i].recipe.Supplier)
+		}
+		if recipeResult.Status == "success" && !config.loginOnly {
+			if err := checkpoint.MarkCompleted(recipesToExecute[i].recipe.Supplier, recipesToExecute[i].recipe.Version); err != nil {
+				logger.Error("Error writing sync checkpoint", "checkpoint_file", checkpointFile, "error", err)
+			}
+			successfulRuns[recipesToExecute[i].recipe.Supplier] = startTime
+		}
+		metrics.AddRunData(runDataSupplierRecord)
 
 		// We send the recipeResult in a separate message to the view layer
 		// This could be optimized (and bundled together with newRecipeRunDataRecordMsg),
@@ -568,183 +1711,451 @@ func runSyncCommandLogic(p *tea.Program, logger *slog.Logger, config *syncComman
 		if recipeResult.NewFilesCount == 1 {
 			invoiceLabel = "invoice"
 		}
-		p.Send(utils.ViewStatusUpdateMsg{
-			Message:   fmt.Sprintf("Downloaded %d %s from `%s`", recipeResult.NewFilesCount, invoiceLabel, recipesToExecute[i].recipe.Supplier),
-			Completed: true,
-		})
+		switch {
+		case config.loginOnly && recipeResult.Status == "success":
+			p.Send(utils.ViewStatusUpdateMsg{
+				Message:   fmt.Sprintf("Logged in to %s successfully", recipesToExecute[i].supplierLabel()),
+				Completed: true,
+			})
+		case config.loginOnly:
+			p.Send(utils.ViewStatusUpdateMsg{
+				Err:       fmt.Errorf("login to %s failed: %s", recipesToExecute[i].supplierLabel(), recipeResult.LastErrorMessage),
+				Completed: true,
+			})
+		default:
+			p.Send(utils.ViewStatusUpdateMsg{
+				Message:   fmt.Sprintf("Downloaded %d %s from `%s`", recipeResult.NewFilesCount, invoiceLabel, recipesToExecute[i].recipe.Supplier),
+				Completed: true,
+			})
+		}
+		result.AddNewFiles(recipesToExecute[i].recipe.Supplier, recipeResult.NewFiles)
+		if verboseMode && len(recipeResult.NewFiles) > 0 {
+			p.Send(viewMsgNewFilesMsg{
+				supplier: recipesToExecute[i].recipe.Supplier,
+				files:    relativeDocumentPaths(config.buchhalterDocumentsDirectory, recipeResult.NewFiles),
+			})
+		}
 
-		baseCountStep += stepCountInCurrentRecipe
+		// Post-process the new documents
+		if recipeResult.Status == "success" && len(recipeResult.NewFiles) > 0 {
+			for _, postProcessor := range postProcessors {
+				processedFiles, err := postProcessor.Process(recipesToExecute[i].recipe.Supplier, recipeResult.NewFiles)
+				if err != nil {
+					logger.Error("Error post-processing new documents", "error", err, "supplier", recipesToExecute[i].recipe.Supplier, "post_processor", postProcessor.Name())
+					p.Send(utils.ViewStatusUpdateMsg{
+						Err:       fmt.Errorf("error post-processing (%s) new documents of supplier `%s`: %w", postProcessor.Name(), recipesToExecute[i].recipe.Supplier, err),
+						Completed: true,
+					})
+					continue
+				}
+				if len(processedFiles) > 0 {
+					logger.Info("Post-processing new documents ... completed", "supplier", recipesToExecute[i].recipe.Supplier, "post_processor", postProcessor.Name(), "files", processedFiles)
+				}
+			}
+		}
+	}
+
+	reportCrossSupplierDuplicates(p, config.buchhalterDocumentsDirectory, documentArchive, verboseMode)
+	reportMissingCredentials(p, result)
+
+	// All suppliers ran, a checkpoint is only needed to retry failed suppliers
+	if len(result.FailedSuppliers()) == 0 && !config.loginOnly {
+		if err := checkpoint.Clear(); err != nil {
+			logger.Error("Error clearing sync checkpoint", "checkpoint_file", checkpointFile, "error", err)
+		}
 	}
 
 	// If we have a premium user run, upload the documents to the buchhalter API
-	logger.Info("Checking if we have a premium subscription to Buchhalter API ...")
-	p.Send(utils.ViewStatusUpdateMsg{
-		Message: "Checking if a premium subscription to Buchhalter API exists",
-	})
-	user, err := buchhalterAPIClient.GetAuthenticatedUser()
-	if err != nil {
-		logger.Error("Error retrieving authenticated user", "error", err)
+	// Download-only runs (`--no-upload`) don't check the subscription at all
+	// incompleteSuppliers are the suppliers whose documents failed to upload (or couldn't be checked), empty without an upload
+	incompleteSuppliers := map[string]bool{}
+	if config.loginOnly {
+		logger.Info("Skipping document upload to Buchhalter API due to --login-only")
+	} else if config.noUpload {
+		logger.Info("Skipping document upload to Buchhalter API due to --no-upload")
 		p.Send(utils.ViewStatusUpdateMsg{
-			Err:       fmt.Errorf("error retrieving a premium subscription to Buchhalter API: %w", err),
+			Message:   "Skipping document upload to Buchhalter API (`--no-upload`)",
 			Completed: true,
 		})
-	}
-	if user != nil && len(user.User.ID) > 0 {
-		statusUpdateMessage = "Uploading documents to Buchhalter API"
-		if len(supplier) > 0 {
-			statusUpdateMessage = fmt.Sprintf("Uploading documents of supplier `%s` to Buchhalter API", supplier)
+	} else {
+		logger.Info("Checking if we have a premium subscription to Buchhalter API ...")
+		p.Send(utils.ViewStatusUpdateMsg{
+			Message: "Checking if a premium subscription to Buchhalter API exists",
+		})
+		user, err := buchhalterAPIClient.GetAuthenticatedUser()
+		if err != nil {
+			logger.Error("Error retrieving authenticated user", "error", err)
+			p.Send(utils.ViewStatusUpdateMsg{
+				Err:       fmt.Errorf("error retrieving a premium subscription to Buchhalter API: %w", err),
+				Completed: true,
+			})
 		}
-		p.Send(utils.ViewStatusUpdateMsg{Message: statusUpdateMessage})
+		if user != nil && len(user.User.ID) > 0 {
+			statusUpdateMessage = "Uploading documents to Buchhalter API"
+			if len(supplier) > 0 {
+				statusUpdateMessage = fmt.Sprintf("Uploading documents of supplier `%s` to Buchhalter API", supplier)
+			}
+			p.Send(utils.ViewStatusUpdateMsg{Message: statusUpdateMessage})
 
-		countUploadedFiles := 0
-		countSkippedExistFiles := 0
-		fileIndex := documentArchive.GetFileIndex()
-		for fileChecksum, fileInfo := range fileIndex {
 			// If the user is only working on a specific supplier, skip the upload of documents for other suppliers
-			if len(supplier) > 0 && fileInfo.Supplier != supplier {
-				logger.Info("Skipping document upload to Buchhalter API due to mismatch in supplier", "file", fileInfo.Path, "selected_supplier", supplier, "file_supplier", fileInfo.Supplier)
-				continue
+			// With `--since-last-run`, the documents archived before the last run of their supplier are skipped as well
+			fileIndex := map[string]archive.File{}
+			for fileChecksum, fileInfo := range documentArchive.GetFileIndex() {
+				if len(supplier) > 0 && fileInfo.Supplier != supplier {
+					logger.Info("Skipping document upload to Buchhalter API due to mismatch in supplier", "file", fileInfo.Path, "selected_supplier", supplier, "file_supplier", fileInfo.Supplier)
+					continue
+				}
+				if config.sinceLastRun && lastRuns.ArchivedBefore(fileInfo.Supplier, fileInfo.Path) {
+					logger.Debug("Skipping document upload to Buchhalter API, because it was archived before the last run", "file", fileInfo.Path, "supplier", fileInfo.Supplier)
+					continue
+				}
+				fileIndex[fileChecksum] = fileInfo
 			}
 
-			logger.Info("Uploading document to Buchhalter API ...", "file", fileInfo.Path, "checksum", fileChecksum)
-			result, err := buchhalterAPIClient.DoesDocumentExist(fileChecksum)
-			if err != nil {
-				// Skip the file if we can't check the existence of the document in the API
-				logger.Error("Error checking if document exists already in Buchhalter API", "file", fileInfo.Path, "checksum", fileChecksum, "error", err)
-				continue
+			uploadResult := uploadDocuments(logger, config.buchhalterConfig, buchhalterAPIClient, fileIndex, config.forceUpload, func(err error) {
+				p.Send(utils.ViewStatusUpdateMsg{
+					Err:       err,
+					Completed: true,
+				})
+			})
+			documentsLabel := "documents"
+			if uploadResult.uploaded == 1 {
+				documentsLabel = "document"
 			}
-			// If the file exists already, skip it
-			if result {
-				logger.Info("Uploading document to Buchhalter API ... exists already", "file", fileInfo.Path, "checksum", fileChecksum)
-				countSkippedExistFiles++
-				continue
+			statusUpdateMessage = fmt.Sprintf("Uploaded %d %s to Buchhalter API (%d skipped, because they already exist)", uploadResult.uploaded, documentsLabel, uploadResult.skippedExists)
+			if len(supplier) > 0 {
+				statusUpdateMessage = fmt.Sprintf("Uploaded %d %s of supplier `%s` to Buchhalter API (%d skipped, because they already exist)", uploadResult.uploaded, documentsLabel, supplier, uploadResult.skippedExists)
 			}
-			logger.Info("Uploading document to Buchhalter API ... does not exist already", "file", fileInfo.Path, "checksum", fileChecksum)
-
-			err = buchhalterAPIClient.UploadDocument(fileInfo.Path, fileInfo.Supplier)
-			if err != nil {
+			if config.forceUpload {
+				statusUpdateMessage = fmt.Sprintf("Uploaded %d %s to Buchhalter API (`--force-upload`, existing documents not skipped)", uploadResult.uploaded, documentsLabel)
+				if len(supplier) > 0 {
+					statusUpdateMessage = fmt.Sprintf("Uploaded %d %s of supplier `%s` to Buchhalter API (`--force-upload`, existing documents not skipped)", uploadResult.uploaded, documentsLabel, supplier)
+				}
+			}
+			p.Send(utils.ViewStatusUpdateMsg{
+				Message:   statusUpdateMessage,
+				Completed: true,
+			})
+			if uploadResult.unchecked > 0 {
 				p.Send(utils.ViewStatusUpdateMsg{
-					Err:       fmt.Errorf("error uploading document `%s` from `%s` to Buchhalter API: %w", fileInfo.Path, fileInfo.Supplier, err),
+					Err:       errors.New(uncheckedDocumentsMessage(uploadResult.unchecked)),
 					Completed: true,
 				})
-				logger.Error("Error uploading document to Buchhalter API", "file", fileInfo.Path, "supplier", fileInfo.Supplier, "error", err)
-				continue
 			}
-			countUploadedFiles++
-		}
-		documentsLabel := "documents"
-		if countUploadedFiles == 1 {
-			documentsLabel = "document"
-		}
-		statusUpdateMessage = fmt.Sprintf("Uploaded %d %s to Buchhalter API (%d skipped, because they already exist)", countUploadedFiles, documentsLabel, countSkippedExistFiles)
-		if len(supplier) > 0 {
-			statusUpdateMessage = fmt.Sprintf("Uploaded %d %s of supplier `%s` to Buchhalter API (%d skipped, because they already exist)", countUploadedFiles, documentsLabel, supplier, countSkippedExistFiles)
+			incompleteSuppliers = uploadResult.incompleteSuppliers
+		} else {
+			logger.Info("Skipping document upload to Buchhalter API due to missing premium subscription")
+			p.Send(utils.ViewStatusUpdateMsg{
+				Message:   "Skipping document upload to Buchhalter API due to missing premium subscription",
+				Completed: true,
+			})
 		}
-		p.Send(utils.ViewStatusUpdateMsg{
-			Message:   statusUpdateMessage,
-			Completed: true,
-		})
-	} else {
-		logger.Info("Skipping document upload to Buchhalter API due to missing premium subscription")
-		p.Send(utils.ViewStatusUpdateMsg{
-			Message:   "Skipping document upload to Buchhalter API due to missing premium subscription",
-			Completed: true,
-		})
+	}
+	// The recipes finished, without an upload (e.g. `--no-upload` or without a premium subscription) all successful runs are recorded
+	// The login check (`--login-only`) doesn't sync any documents
+	if !config.loginOnly {
+		recordLastRuns(logger, lastRuns, successfulRuns, incompleteSuppliers)
 	}
 
 	// Send metrics to Buchhalter API
-	alwaysSendMetrics := viper.GetBool("buchhalter_always_send_metrics")
-	if !developmentMode && alwaysSendMetrics {
-		logger.Info("Sending usage metrics to Buchhalter API", "always_send_metrics", alwaysSendMetrics, "development_mode", developmentMode)
+	switch metricsReporter.Decide() {
+	case repository.MetricsDecisionSend:
+		logger.Info("Sending usage metrics to Buchhalter API", "always_send_metrics", true)
 		p.Send(utils.ViewStatusUpdateMsg{Message: "Sending usage metrics to Buchhalter API"})
-		err = buchhalterAPIClient.SendMetrics(recipeRunData, cliVersion, chromeVersion, vaultProvider.Version, recipeParser.OicdbVersion)
-		if err != nil {
+		snapshot := metrics.Snapshot()
+		err = metricsReporter.Send(shutdownCtx, snapshot.RunData, snapshot.CliVersion, snapshot.ChromeVersion, snapshot.VaultVersion, snapshot.OicdbVersion)
+		if err != nil && !errors.Is(err, repository.ErrMetricsTimeout) && !errors.Is(err, repository.ErrMetricsCanceled) {
 			logger.Error("Error sending usage metrics to Buchhalter API", "error", err)
 			p.Send(utils.ViewStatusUpdateMsg{
-				Err:        fmt.Errorf("error sending usage metrics to Buchhalter API: %w", err),
+				Err:        err,
 				ShouldQuit: true,
 			})
 			return
 		}
 
+		p.Send(metricsStatusUpdateMsg(err))
+
+	case repository.MetricsDecisionPrompt:
+		p.Send(viewMsgModeUpdate{
+			mode:    "sendMetrics",
+			title:   "Let's improve buchhalter-cli together!",
+			details: "Allow buchhalter-cli to send anonymized usage data to our api?",
+		})
+
+	case repository.MetricsDecisionOptOut:
+		logger.Info("Skipping usage metrics", "no_metrics", viper.GetBool("cmd-arg-no-metrics"), "do_not_track", repository.DoNotTrack())
+		p.Send(utils.ViewStatusUpdateMsg{
+			Message:    "No usage metrics sent to Buchhalter API (`--no-metrics` or `DO_NOT_TRACK`)",
+			Completed:  true,
+			ShouldQuit: true,
+		})
+
+	case repository.MetricsDecisionDecline:
 		p.Send(utils.ViewStatusUpdateMsg{
-			Message:    "Sent usage metrics to Buchhalter API",
+			Message:    "No usage metrics sent to Buchhalter API (set `buchhalter_always_send_metrics: true` to send them in quiet mode)",
 			Completed:  true,
 			ShouldQuit: true,
 		})
 
-	} else if developmentMode {
+	default:
 		p.Send(viewQuitMsg{})
+	}
+}
 
-	} else {
-		p.Send(viewMsgModeUpdate{
-			mode:    "sendMetrics",
-			title:   "Let's improve buchhalter-cli together!",
-			details: "Allow buchhalter-cli to send anonymized usage data to our api?",
-		})
+// recordLastRuns records the start of the successful runs (supplier => start) as their last run (see `--since-last-run`).
+// Suppliers with documents that failed to upload (incompleteSuppliers) are not recorded, their next run uploads them again.
+func recordLastRuns(logger *slog.Logger, lastRuns *utils.LastRuns, successfulRuns map[string]time.Time, incompleteSuppliers map[string]bool) {
+	for supplier, startTime := range successfulRuns {
+		if incompleteSuppliers[supplier] {
+			logger.Info("Not recording last run, documents of the supplier failed to upload", "supplier", supplier)
+			continue
+		}
+		if err := lastRuns.Record(supplier, startTime); err != nil {
+			logger.Error("Error writing last runs", "supplier", supplier, "error", err)
+		}
+	}
+}
+
+// reportCrossSupplierDuplicates reports the downloaded documents that exist for another supplier (see `buchhalter_dedup_scope`).
+// In verbose mode, the documents are listed.
+func reportCrossSupplierDuplicates(p *tea.Program, documentsDirectory string, documentArchive *archive.DocumentArchive, verbose bool) {
+	duplicates := documentArchive.CrossSupplierDuplicates()
+	if len(duplicates) == 0 {
+		return
+	}
+
+	message := fmt.Sprintf("%d downloaded invoices exist for another supplier and were skipped", len(duplicates))
+	if documentArchive.DedupScope() == archive.DedupScopeSupplier {
+		message = fmt.Sprintf("%d downloaded invoices exist for another supplier as well", len(duplicates))
+	}
+	p.Send(utils.ViewStatusUpdateMsg{Message: message, Completed: true})
+
+	if verbose {
+		files := make([]string, 0, len(duplicates))
+		for _, duplicate := range duplicates {
+			existing := relativeDocumentPaths(documentsDirectory, []string{duplicate.Existing.Path})[0]
+			files = append(files, fmt.Sprintf("%s of `%s` = %s", duplicate.File, duplicate.Supplier, existing))
+		}
+		p.Send(viewMsgNewFilesMsg{files: files})
+	}
+}
+
+// reportMissingCredentials sends a summary of the suppliers skipped due to missing credentials (see MarkSupplierMissingCredentials).
+func reportMissingCredentials(p *tea.Program, result *syncResult) {
+	missingCredentials := result.MissingCredentials()
+	if len(missingCredentials) == 0 {
+		return
+	}
+
+	suppliers := make([]string, 0, len(missingCredentials))
+	for supplier := range missingCredentials {
+		suppliers = append(suppliers, supplier)
+	}
+	sort.Strings(suppliers)
+	p.Send(utils.ViewStatusUpdateMsg{
+		Message:   fmt.Sprintf("Skipped %d suppliers with missing credentials (complete their vault items): %s", len(suppliers), strings.Join(suppliers, ", ")),
+		Completed: true,
+	})
+}
+
+// relativeDocumentPaths returns the paths of files relative to the documents directory, for a shorter output.
+// Files outside of the documents directory keep their absolute path.
+func relativeDocumentPaths(documentsDirectory string, files []string) []string {
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		relativePath, err := filepath.Rel(documentsDirectory, file)
+		if err != nil || strings.HasPrefix(relativePath, "..") {
+			relativePath = file
+		}
+		paths = append(paths, relativePath)
 	}
+	return paths
 }
 
 // loadRecipesAndMatchingVaultItems loads all recipes (or only the one for a specific supplier if `supplier` is set)
 // and tries to find matching pairs of credentials in the vault.
-func loadRecipesAndMatchingVaultItems(logger *slog.Logger, supplier string, vaultProvider *vault.Provider1Password, recipeParser *parser.RecipeParser) ([]recipeToExecute, error) {
+// Suppliers with a pinned vault item (`buchhalter_supplier_items`) run only with this item.
+// The recipes matched with the vault items by their urls are cached in matchCacheFile, except in development mode (local recipes change without a new OICDB version).
+func loadRecipesAndMatchingVaultItems(p *tea.Program, logger *slog.Logger, buchhalterConfig *settings.Config, supplier string, vaultProvider vault.Provider, recipeParser *parser.RecipeParser, matchCacheFile string) ([]recipeToExecute, error) {
 	var recipeVaultItemPairs []recipeToExecute
 
 	// Load recipes
-	developmentMode := viper.GetBool("dev")
+	developmentMode := buchhalterConfig.Dev
 	logger.Info("Loading recipes for suppliers ...", "development_mode", developmentMode)
 	loadRecipeResult, err := recipeParser.LoadRecipes(developmentMode)
 	if err != nil {
 		logger.Error("Error loading recipes for suppliers", "error", err, "load_recipe_result", loadRecipeResult)
 		return recipeVaultItemPairs, err
 	}
+	if rejectedUpdate := recipeParser.RejectedUpdate(); rejectedUpdate != nil {
+		logger.Warn("OICDB update rejected, using the previous version", "error", rejectedUpdate)
+		p.Send(utils.ViewStatusUpdateMsg{
+			Err:       fmt.Errorf("the OICDB update failed the validation and was rejected, using the previous version of the recipes (see the log for details)"),
+			Completed: true,
+		})
+	}
 
-	// Search for credential pairs matching the recipe(s)
-	stepCount := 0
-	vaultItems := vaultProvider.VaultItems
+	// The configured supplier lists apply to all runs, a supplier argument narrows them further
+	supplierFilter := parser.NewSupplierFilter(buchhalterConfig.SuppliersInclude, buchhalterConfig.SuppliersExclude)
+	tagFilter := parser.NewTagFilter(viper.GetStringSlice("cmd-arg-tag"))
+
+	// Search for credential pairs matching the recipe(s), pinned vault items (`buchhalter_supplier_items`) take precedence over matching by urls
 	if len(supplier) > 0 {
 		logger.Info("Search for credentials for suppliers recipe ...", "supplier", supplier)
-		for i := range vaultItems {
-			// Check if a recipe exists for the item
-			recipe := recipeParser.GetRecipeForItem(vaultItems[i], vaultProvider.UrlsByItemId)
-			if recipe != nil && supplier == recipe.Supplier {
-				recipeVaultItemPairs = append(recipeVaultItemPairs, recipeToExecute{recipe, vaultItems[i].ID})
-				logger.Info("Search for credentials for suppliers recipe ... found", "supplier", supplier, "credentials_id", vaultItems[i].ID)
-			}
-		}
-
 	} else {
 		logger.Info("Search for matching pairs of recipes for supplier recipes and credentials ...")
-
-		// Run all recipes
-		for i := range vaultItems {
-			// Check if a recipe exists for the item
-			recipe := recipeParser.GetRecipeForItem(vaultItems[i], vaultProvider.UrlsByItemId)
-			if recipe != nil {
-				stepCount = stepCount + len(recipe.Steps)
-				recipeVaultItemPairs = append(recipeVaultItemPairs, recipeToExecute{recipe, vaultItems[i].ID})
-				logger.Info("Search for matching pairs of recipes for supplier recipes and credentials ... found", "supplier", recipe.Supplier, "credentials_id", vaultItems[i].ID)
-			}
+	}
+	var matchCache *parser.MatchCache
+	if !developmentMode {
+		matchCache, err = parser.LoadMatchCache(matchCacheFile, recipeParser.OicdbVersion)
+		if err != nil {
+			// A broken cache is replaced, all vault items are matched again
+			logger.Warn("Error loading the match cache, matching all vault items", "match_cache_file", matchCacheFile, "error", err)
+		}
+		recipeParser.SetMatchCache(matchCache)
+	}
+	pins := parser.NewItemPins(buchhalterConfig.SupplierItems)
+	matches, warnings := recipeParser.MatchRecipesWithPins(vaultProvider.GetVaultItems(), vaultProvider.GetUrlsByItemId(), pins)
+	if matchCache != nil {
+		if err := matchCache.Save(); err != nil {
+			logger.Error("Error writing the match cache", "match_cache_file", matchCacheFile, "error", err)
+		}
+	}
+	for _, warning := range warnings {
+		logger.Warn("Ignoring vault item pin", "error", warning)
+		p.Send(utils.ViewStatusUpdateMsg{
+			Err:       fmt.Errorf("buchhalter_supplier_items: %w", warning),
+			Completed: true,
+		})
+	}
+	for _, match := range matches {
+		if len(supplier) > 0 && supplier != match.Recipe.Supplier {
+			continue
+		}
+		if !supplierFilter.Allows(match.Recipe.Supplier) {
+			logger.Debug("Skipping supplier due to buchhalter_suppliers_include/buchhalter_suppliers_exclude", "supplier", match.Recipe.Supplier, "credentials_id", match.ItemId)
+			continue
+		}
+		if !tagFilter.Allows(*match.Recipe) {
+			logger.Debug("Skipping supplier due to --tag", "supplier", match.Recipe.Supplier, "recipe_tags", match.Recipe.Tags, "credentials_id", match.ItemId)
+			continue
 		}
+		_, pinned := pins.ItemFor(match.Recipe.Supplier)
+		recipeVaultItemPairs = append(recipeVaultItemPairs, recipeToExecute{recipe: match.Recipe, vaultItemId: match.ItemId, vaultItemTitle: match.ItemTitle})
+		logger.Info("Search for matching pairs of recipes for supplier recipes and credentials ... found", "supplier", match.Recipe.Supplier, "credentials_id", match.ItemId, "pinned", pinned)
 	}
 
 	return recipeVaultItemPairs, nil
 }
 
-func sendMetrics(buchhalterAPIClient *repository.BuchhalterAPIClient, a bool, runData repository.RunData, cliVersion, chromeVersion, vaultVersion, oicdbVersion string) error {
-	err := buchhalterAPIClient.SendMetrics(runData, cliVersion, chromeVersion, vaultVersion, oicdbVersion)
+// loadRecipeFileAndMatchingVaultItems loads a single recipe from a file and pairs it with the vault item `item` (ID or title).
+// Without an item, the vault item pinned to the supplier (`buchhalter_supplier_items`) or all vault items matching the domains of the recipe are used.
+// The supplier lists (`buchhalter_suppliers_include` / `buchhalter_suppliers_exclude`) and `--tag` don't apply to a recipe file.
+func loadRecipeFileAndMatchingVaultItems(logger *slog.Logger, buchhalterConfig *settings.Config, recipeFile, item string, vaultProvider vault.Provider, recipeParser *parser.RecipeParser) ([]recipeToExecute, error) {
+	logger.Info("Loading recipe from file ...", "file", recipeFile)
+	recipe, err := recipeParser.LoadRecipeFile(recipeFile)
 	if err != nil {
-		return fmt.Errorf("error sending usage metrics to Buchhalter API: %w", err)
+		logger.Error("Error loading recipe from file", "file", recipeFile, "error", err)
+		return nil, err
 	}
-	if a {
-		viper.Set("buchhalter_always_send_metrics", true)
-		err = viper.WriteConfig()
-		if err != nil {
-			return fmt.Errorf("error writing config file with value buchhalter_always_send_metrics=true: %w", err)
+
+	// Without an item argument, a vault item pinned to the supplier is used
+	if pinnedItem, pinned := parser.NewItemPins(buchhalterConfig.SupplierItems).ItemFor(recipe.Supplier); pinned && len(strings.TrimSpace(item)) == 0 {
+		item = pinnedItem
+	}
+	itemIds, err := parser.MatchRecipeItems(*recipe, vaultProvider.GetVaultItems(), vaultProvider.GetUrlsByItemId(), item)
+	if err != nil {
+		logger.Error("Error matching recipe file with vault items", "file", recipeFile, "item", item, "error", err)
+		return nil, err
+	}
+	if len(itemIds) == 0 {
+		logger.Error("No vault item matches the domains of the recipe file", "file", recipeFile, "supplier", recipe.Supplier, "domains", recipe.Domains)
+		return nil, fmt.Errorf("no vault item matches the domains of recipe `%s` (%s), pass the vault item (ID or title) as argument", recipe.Supplier, strings.Join(recipe.Domains, ", "))
+	}
+
+	itemTitles := map[string]string{}
+	for _, vaultItem := range vaultProvider.GetVaultItems() {
+		itemTitles[vaultItem.ID] = vaultItem.Title
+	}
+	recipeVaultItemPairs := make([]recipeToExecute, 0, len(itemIds))
+	for _, itemId := range itemIds {
+		recipeVaultItemPairs = append(recipeVaultItemPairs, recipeToExecute{recipe: recipe, vaultItemId: itemId, vaultItemTitle: itemTitles[itemId]})
+		logger.Info("Search for credentials for recipe file ... found", "supplier", recipe.Supplier, "credentials_id", itemId)
+	}
+
+	return recipeVaultItemPairs, nil
+}
+
+// resolveAmbiguousRecipes applies mode (see parser.AmbiguousModes) to the recipes matched by multiple vault items and warns about them.
+// With parser.AmbiguousModeAll, the runs are labeled with their vault item.
+func resolveAmbiguousRecipes(p *tea.Program, logger *slog.Logger, recipesToExecute []recipeToExecute, mode string) []recipeToExecute {
+	matches := make([]parser.RecipeMatch, 0, len(recipesToExecute))
+	for _, r := range recipesToExecute {
+		matches = append(matches, parser.RecipeMatch{Recipe: r.recipe, ItemId: r.vaultItemId, ItemTitle: r.vaultItemTitle})
+	}
+	resolved, ambiguousMatches := parser.ResolveAmbiguousMatches(matches, mode)
+
+	ambiguousSuppliers := map[string]bool{}
+	for _, ambiguous := range ambiguousMatches {
+		ambiguousSuppliers[ambiguous.Supplier] = true
+		itemTitles := make([]string, 0, len(ambiguous.Items))
+		itemIds := make([]string, 0, len(ambiguous.Items))
+		for _, item := range ambiguous.Items {
+			itemTitles = append(itemTitles, fmt.Sprintf("`%s`", item.ItemTitle))
+			itemIds = append(itemIds, item.ItemId)
 		}
+		logger.Warn("Multiple vault items match the same recipe", "supplier", ambiguous.Supplier, "credentials_ids", itemIds, "on_ambiguous", mode)
+
+		var consequence string
+		switch mode {
+		case parser.AmbiguousModeAll:
+			consequence = "running the recipe for each of them"
+		case parser.AmbiguousModeFirst:
+			consequence = fmt.Sprintf("running the recipe only for %s", itemTitles[0])
+		case parser.AmbiguousModeSkip:
+			consequence = "skipping the supplier. Keep only one matching item (e.g. via `credential_provider_item_tag`) or use `--on-ambiguous all|first`"
+		}
+		p.Send(utils.ViewStatusUpdateMsg{
+			Err:       fmt.Errorf("%d vault items match supplier `%s` (%s), %s", len(ambiguous.Items), ambiguous.Supplier, strings.Join(itemTitles, ", "), consequence),
+			Completed: true,
+		})
 	}
 
-	return nil
+	resolvedRecipes := make([]recipeToExecute, 0, len(resolved))
+	for _, match := range resolved {
+		resolvedRecipes = append(resolvedRecipes, recipeToExecute{
+			recipe:         match.Recipe,
+			vaultItemId:    match.ItemId,
+			vaultItemTitle: match.ItemTitle,
+			labeled:        mode == parser.AmbiguousModeAll && ambiguousSuppliers[match.Recipe.Supplier],
+		})
+	}
+	return resolvedRecipes
+}
+
+// storeMetricsConsent stores the consent to always send the usage metrics in the configuration file.
+func storeMetricsConsent() error {
+	viper.Set(settings.KeyAlwaysSendMetrics, true)
+	return viper.WriteConfig()
+}
+
+// metricsStatusUpdateMsg returns the final status update after sending the usage metrics.
+// The sync is completed anyway, so a timeout of the metrics endpoint is no error.
+func metricsStatusUpdateMsg(err error) utils.ViewStatusUpdateMsg {
+	msg := utils.ViewStatusUpdateMsg{
+		Message:    "Sent usage metrics to Buchhalter API",
+		Completed:  true,
+		ShouldQuit: true,
+	}
+	if errors.Is(err, repository.ErrMetricsTimeout) {
+		msg.Message = "Skipped sending usage metrics, Buchhalter API didn't respond in time"
+	} else if errors.Is(err, repository.ErrMetricsCanceled) {
+		msg.Message = "Skipped sending usage metrics"
+	} else if err != nil {
+		msg.Err = err
+	}
+
+	return msg
 }
 
 /**
@@ -753,6 +2164,12 @@ func sendMetrics(buchhalterAPIClient *repository.BuchhalterAPIClient, a bool, ru
 const (
 	padding  = 2
 	maxWidth = 80
+
+	// logPaneHeight is the number of log lines shown in the log pane (`l`), logPaneMaxLines the number of lines kept for scrolling
+	logPaneHeight   = 10
+	logPaneMaxLines = 500
+	// logPaneBufferSize is the number of log records buffered for the view, further records are dropped
+	logPaneBufferSize = 100
 )
 
 var (
@@ -762,6 +2179,7 @@ var (
 	durationStyle = dotStyle
 	spinnerStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("#D6D58E"))
 	appStyle      = lipgloss.NewStyle().Margin(1, 2, 0, 2)
+	logPaneStyle  = lipgloss.NewStyle().Border(lipgloss.NormalBorder()).BorderForeground(lipgloss.Color("#626262")).Padding(0, 1)
 )
 
 // viewModelSync is the bubbletea application main view model
@@ -782,19 +2200,36 @@ type viewModelSync struct {
 	results       []viewMsgRecipeDownloadResultMsg
 	quitting      bool
 	hasError      bool
+	width         int
+
+	// Log pane (`l`), logScroll is the number of lines scrolled up from the latest line
+	logRecords  <-chan utils.LogRecord
+	logLines    []string
+	showLogPane bool
+	logScroll   int
 
-	// Recipe runs
-	recipeRunData repository.RunData
+	// pause pauses the recipes before their next step (`p`)
+	pause  *utils.Pause
+	paused bool
+
+	// totpPrompt is the open prompt for a 2FA code, nil if none is open. The keys go to totpInput while it is open.
+	totpPrompt *utils.ViewTotpPromptMsg
+	totpInput  textinput.Model
 
 	// sendMetrics selection
 	selectionCursor  int
 	selectionChoice  string
 	selectionChoices []string
-	metricsRecord    *buchhalterMetricsRecord
+	// metrics are collected by the sync, they are read as a snapshot to send them
+	metrics *repository.MetricsAccumulator
 
 	// Buchhalter
-	buchhalterAPIClient *repository.BuchhalterAPIClient
-	logger              *slog.Logger
+	metricsReporter *repository.MetricsReporter
+	logger          *slog.Logger
+
+	// shutdownCtx is canceled by shutdown when the application quits, e.g. to cancel sending the usage metrics
+	shutdownCtx context.Context
+	shutdown    context.CancelFunc
 
 	// Browser
 	browserCtx context.Context
@@ -834,6 +2269,13 @@ func (r viewMsgRecipeDownloadResultMsg) String() string {
 	return fmt.Sprintf("%s %s%s", r.step, fill, durationStyle.Render(d))
 }
 
+// viewMsgNewFilesMsg lists the new files of a supplier (verbose mode).
+// Without a supplier, the files are details of the previous message (e.g. the cross-supplier duplicates).
+type viewMsgNewFilesMsg struct {
+	supplier string
+	files    []string
+}
+
 // viewMsgModeUpdate updates the mode of the bubbletea application.
 // "Mode" represents special code pathed of the applications.
 //
@@ -844,16 +2286,41 @@ type viewMsgModeUpdate struct {
 	details string
 }
 
+// viewMsgLogRecord adds a record of the logger to the log pane.
+type viewMsgLogRecord struct {
+	record utils.LogRecord
+}
+
+// waitForLogRecord returns a command that waits for the next record of the logger.
+func waitForLogRecord(records <-chan utils.LogRecord) tea.Cmd {
+	if records == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		record, ok := <-records
+		if !ok {
+			return nil
+		}
+		return viewMsgLogRecord{record: record}
+	}
+}
+
 type tickMsg time.Time
 
 // initviewModelSync returns the model for the bubbletea application.
-func initviewModelSync(logger *slog.Logger, buchhalterAPIClient *repository.BuchhalterAPIClient) viewModelSync {
+// The records of logRecords are shown in the log pane, pause is toggled by `p`.
+func initviewModelSync(shutdownCtx context.Context, shutdown context.CancelFunc, logger *slog.Logger, metricsReporter *repository.MetricsReporter, metrics *repository.MetricsAccumulator, logRecords <-chan utils.LogRecord, pause *utils.Pause) viewModelSync {
 	const numLastResults = 5
 
 	s := spinner.New()
 	s.Spinner = spinner.Dot
 	s.Style = spinnerStyle
 
+	totpInput := textinput.New()
+	totpInput.Placeholder = "123456"
+	totpInput.CharLimit = 16
+	totpInput.Width = 20
+
 	m := viewModelSync{
 		actionsCompleted: []utils.UIAction{},
 
@@ -863,16 +2330,22 @@ func initviewModelSync(logger *slog.Logger, buchhalterAPIClient *repository.Buch
 		spinner:      s,
 		results:      make([]viewMsgRecipeDownloadResultMsg, numLastResults),
 		hasError:     false,
+		width:        maxWidth,
 
-		// Recipe runs
-		recipeRunData: make(repository.RunData, 0),
+		// Log pane and pause
+		logRecords: logRecords,
+		logLines:   []string{},
+		pause:      pause,
+		totpInput:  totpInput,
 
 		// sendMetrics selection
-		selectionChoices: []string{"Yes", "No", "Always yes (don't ask again)"},
-		metricsRecord:    &buchhalterMetricsRecord{},
+		selectionChoices: repository.MetricsAnswers,
+		metrics:          metrics,
 
-		buchhalterAPIClient: buchhalterAPIClient,
-		logger:              logger,
+		metricsReporter: metricsReporter,
+		logger:          logger,
+		shutdownCtx:     shutdownCtx,
+		shutdown:        shutdown,
 
 		// Browser
 		browserCtx: nil,
@@ -884,7 +2357,7 @@ func initviewModelSync(logger *slog.Logger, buchhalterAPIClient *repository.Buch
 // Init initializes the bubbletea application.
 // Returns an initial command for the application to run.
 func (m viewModelSync) Init() tea.Cmd {
-	return m.spinner.Tick
+	return tea.Batch(m.spinner.Tick, waitForLogRecord(m.logRecords))
 }
 
 // Update updates the bubbletea application model.
@@ -893,6 +2366,9 @@ func (m viewModelSync) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 
 	case tea.KeyMsg:
+		if m.totpPrompt != nil {
+			return m.updateTotpPrompt(msg)
+		}
 		switch msg.String() {
 		case "q", "esc", "ctrl+c":
 			m.logger.Info("Initiating shutdown sequence", "key_hit", msg.String())
@@ -901,42 +2377,24 @@ func (m viewModelSync) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return mn, tea.Quit
 
 		case "enter":
+			// Only the metrics prompt has a selection to confirm
+			if m.mode != "sendMetrics" {
+				return m, nil
+			}
 			// Send the choice on the channel and exit.
 			m.selectionChoice = m.selectionChoices[m.selectionCursor]
 			m.mode = "sync"
-			switch m.selectionChoice {
-			case "Yes":
-				return m, func() tea.Msg {
-					metrics := m.metricsRecord
-					err := sendMetrics(m.buchhalterAPIClient, false, m.recipeRunData, metrics.CliVersion, metrics.ChromeVersion, metrics.VaultVersion, metrics.OicdbVersion)
-					return utils.ViewStatusUpdateMsg{
-						Message:    "Sent usage metrics to Buchhalter API",
-						Err:        err,
-						Completed:  true,
-						ShouldQuit: true,
-					}
-				}
-
-			case "No":
-				return m, func() tea.Msg {
+			return m, func() tea.Msg {
+				snapshot := m.metrics.Snapshot()
+				sent, err := m.metricsReporter.Answer(m.shutdownCtx, m.selectionChoice, snapshot.RunData, snapshot.CliVersion, snapshot.ChromeVersion, snapshot.VaultVersion, snapshot.OicdbVersion)
+				if !sent && err == nil {
 					return utils.ViewStatusUpdateMsg{
 						Message:    "No usage metrics sent to Buchhalter API",
 						Completed:  true,
 						ShouldQuit: true,
 					}
 				}
-
-			case "Always yes (don't ask again)":
-				return m, func() tea.Msg {
-					metrics := m.metricsRecord
-					err := sendMetrics(m.buchhalterAPIClient, true, m.recipeRunData, metrics.CliVersion, metrics.ChromeVersion, metrics.VaultVersion, metrics.OicdbVersion)
-					return utils.ViewStatusUpdateMsg{
-						Message:    "Sent usage metrics to Buchhalter API",
-						Err:        err,
-						Completed:  true,
-						ShouldQuit: true,
-					}
-				}
+				return metricsStatusUpdateMsg(err)
 			}
 
 		case "down", "j":
@@ -950,10 +2408,42 @@ func (m viewModelSync) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if m.selectionCursor < 0 {
 				m.selectionCursor = len(m.selectionChoices) - 1
 			}
+
+		case "l":
+			m.showLogPane = !m.showLogPane
+			m.logScroll = 0
+
+		case "p":
+			if m.pause == nil || m.mode != "sync" || m.quitting {
+				return m, nil
+			}
+			m.paused = m.pause.Toggle()
+			m.logger.Info("Toggling pause of the sync", "paused", m.paused)
+
+		case "pgup":
+			if m.showLogPane {
+				m.logScroll = min(m.logScroll+logPaneHeight, max(len(m.logLines)-logPaneHeight, 0))
+			}
+
+		case "pgdown":
+			if m.showLogPane {
+				m.logScroll = max(m.logScroll-logPaneHeight, 0)
+			}
 		}
 
 		return m, nil
 
+	case viewMsgLogRecord:
+		m.logLines = append(m.logLines, msg.record.String())
+		if len(m.logLines) > logPaneMaxLines {
+			m.logLines = m.logLines[len(m.logLines)-logPaneMaxLines:]
+		}
+		if m.logScroll > 0 {
+			// Keep the scrolled lines in place
+			m.logScroll = min(m.logScroll+1, max(len(m.logLines)-logPaneHeight, 0))
+		}
+		return m, waitForLogRecord(m.logRecords)
+
 	case utils.ViewStatusUpdateMsg:
 		m.actionInProgress = msg.Message
 		m.actionDetails = msg.Details
@@ -983,25 +2473,15 @@ func (m viewModelSync) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 		return m, nil
 
-	case buchhalterMetricsRecord:
-		if len(msg.CliVersion) > 0 {
-			m.metricsRecord.CliVersion = msg.CliVersion
-		}
-		if len(msg.ChromeVersion) > 0 {
-			m.metricsRecord.ChromeVersion = msg.ChromeVersion
-		}
-		if len(msg.OicdbVersion) > 0 {
-			m.metricsRecord.OicdbVersion = msg.OicdbVersion
-		}
-		if len(msg.VaultVersion) > 0 {
-			m.metricsRecord.VaultVersion = msg.VaultVersion
+	case viewMsgNewFilesMsg:
+		for _, file := range msg.files {
+			m.actionsCompleted = append(m.actionsCompleted, utils.UIAction{
+				Message: file,
+				Style:   utils.UIActionStyleDetail,
+			})
 		}
 		return m, nil
 
-	case newRecipeRunDataRecordMsg:
-		m.recipeRunData = append(m.recipeRunData, msg.record)
-		return m, nil
-
 	case updateBrowserContext:
 		m.logger.Info("Updating browser context")
 		m.browserCtx = msg.ctx
@@ -1014,6 +2494,7 @@ func (m viewModelSync) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return mn, tea.Quit
 
 	case tea.WindowSizeMsg:
+		m.width = msg.Width
 		m.progress.Width = msg.Width - padding*2 - 4
 		if m.progress.Width > maxWidth {
 			m.progress.Width = maxWidth
@@ -1030,6 +2511,16 @@ func (m viewModelSync) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		return m, nil
 
+	case utils.ViewTotpPromptMsg:
+		if msg.Closed {
+			m.totpPrompt = nil
+			m.totpInput.Blur()
+			return m, nil
+		}
+		m.totpPrompt = &msg
+		m.totpInput.Reset()
+		return m, m.totpInput.Focus()
+
 	case viewMsgModeUpdate:
 		m.actionInProgress = msg.title
 		m.actionDetails = msg.details
@@ -1084,6 +2575,8 @@ func (m viewModelSync) View() string {
 			s.WriteString(errorMark.Render() + " " + errorStyle.Render(capitalizeFirstLetter(actionCompleted.Message)) + "\n")
 		case utils.UIActionStyleThanks:
 			s.WriteString(thanksMark.Render() + " " + textStyleBold(actionCompleted.Message) + "\n")
+		case utils.UIActionStyleDetail:
+			s.WriteString(dotStyle.Render("   - "+actionCompleted.Message) + "\n")
 		}
 	}
 
@@ -1115,12 +2608,25 @@ func (m viewModelSync) View() string {
 		s.WriteString(m.progress.View() + "\n\n")
 	}
 
+	if m.paused && !m.quitting {
+		s.WriteString(textStyleBold("Paused after the running step. Press p to resume.") + "\n\n")
+	}
+
+	if m.totpPrompt != nil && !m.quitting {
+		s.WriteString(textStyleBold(fmt.Sprintf("Enter the current 2FA code of `%s` (within %s):", m.totpPrompt.Supplier, m.totpPrompt.Timeout)) + "\n")
+		s.WriteString(m.totpInput.View() + "\n\n")
+	}
+
 	if !m.hasError && m.mode == "sync" {
 		for _, res := range m.results {
 			s.WriteString(res.String() + "\n")
 		}
 	}
 
+	if m.showLogPane && !m.quitting {
+		s.WriteString(m.logPaneView() + "\n")
+	}
+
 	if m.mode == "sendMetrics" && !m.quitting {
 		for i := 0; i < len(m.selectionChoices); i++ {
 			if m.selectionCursor == i {
@@ -1137,12 +2643,75 @@ func (m viewModelSync) View() string {
 
 	// Quitting or not?
 	if !m.quitting {
-		s.WriteString(helpStyle.Render("Press q to exit"))
+		help := "Press q to exit"
+		if m.totpPrompt != nil {
+			help = "Press enter to confirm the 2FA code, esc to skip it, ctrl+c to exit"
+		} else if m.mode == "sync" && m.logRecords != nil {
+			help += ", l to toggle the log"
+			if m.showLogPane {
+				help += " (pgup/pgdown to scroll)"
+			}
+		}
+		if m.mode == "sync" && m.pause != nil {
+			help += ", p to pause"
+		}
+		s.WriteString(helpStyle.Render(help))
 	}
 
 	return appStyle.Render(s.String())
 }
 
+// updateTotpPrompt handles the keys while the prompt for a 2FA code is open.
+// The code is confirmed with enter, esc cancels the prompt (the recipe fails) and ctrl+c exits.
+func (m viewModelSync) updateTotpPrompt(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter", "esc", "ctrl+c":
+		code := ""
+		if msg.String() == "enter" {
+			code = m.totpInput.Value()
+		}
+		// The code channel is buffered, the prompt may have timed out in the meantime
+		select {
+		case m.totpPrompt.Code <- code:
+		default:
+		}
+		m.totpPrompt = nil
+		m.totpInput.Reset()
+		m.totpInput.Blur()
+		if msg.String() != "ctrl+c" {
+			return m, nil
+		}
+
+		m.logger.Info("Initiating shutdown sequence", "key_hit", msg.String())
+		mn := quit(m)
+		return mn, tea.Quit
+	}
+
+	var cmd tea.Cmd
+	m.totpInput, cmd = m.totpInput.Update(msg)
+	return m, cmd
+}
+
+// logPaneView renders the latest lines of the log pane, scrolled up by logScroll lines.
+// Lines are cut at the width of the terminal.
+func (m viewModelSync) logPaneView() string {
+	end := len(m.logLines) - m.logScroll
+	start := max(end-logPaneHeight, 0)
+	lineWidth := max(m.width-padding*2-4, 20)
+
+	lines := make([]string, 0, logPaneHeight)
+	for _, line := range m.logLines[start:end] {
+		if runes := []rune(line); len(runes) > lineWidth {
+			line = string(runes[:lineWidth-1]) + "…"
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "No log records yet")
+	}
+	return logPaneStyle.Render(strings.Join(lines, "\n"))
+}
+
 func tickCmd() tea.Cmd {
 	return tea.Tick(time.Second*1, func(t time.Time) tea.Msg {
 		return tickMsg(t)
@@ -1173,5 +2742,10 @@ func quit(m viewModelSync) viewModelSync {
 		}
 	}
 
+	// Pending requests (e.g. sending the usage metrics) are canceled
+	if m.shutdown != nil {
+		m.shutdown()
+	}
+
 	return m
 }
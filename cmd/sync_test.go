@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"buchhalter/lib/utils"
+)
+
+func TestRecordLastRuns(t *testing.T) {
+	start := time.Date(2024, time.May, 10, 12, 0, 0, 0, time.UTC)
+	successfulRuns := map[string]time.Time{"hetzner": start, "aws": start}
+
+	tests := []struct {
+		name                string
+		incompleteSuppliers map[string]bool
+		expected            map[string]bool
+	}{
+		// Without an upload, all successful runs are recorded
+		{"no upload", map[string]bool{}, map[string]bool{"hetzner": true, "aws": true}},
+		{"missing premium subscription", map[string]bool{}, map[string]bool{"hetzner": true, "aws": true}},
+		{"uploaded", map[string]bool{}, map[string]bool{"hetzner": true, "aws": true}},
+		// The documents of a supplier failed to upload, its next run uploads them again
+		{"failed upload", map[string]bool{"aws": true}, map[string]bool{"hetzner": true}},
+	}
+
+	for _, test := range tests {
+		file := filepath.Join(t.TempDir(), "last-runs-default.json")
+		lastRuns, err := utils.LoadLastRuns(file)
+		if err != nil {
+			t.Fatalf("%s: LoadLastRuns() returned error: %s", test.name, err)
+		}
+		recordLastRuns(slog.Default(), lastRuns, successfulRuns, test.incompleteSuppliers)
+
+		// The next run reads the recorded suppliers (`--since-last-run`)
+		next, err := utils.LoadLastRuns(file)
+		if err != nil {
+			t.Fatalf("%s: LoadLastRuns() returned error: %s", test.name, err)
+		}
+		for supplier := range successfulRuns {
+			if since, ok := next.Since(supplier); ok != test.expected[supplier] || (ok && !since.Equal(start)) {
+				t.Errorf("%s: Since(%s) = %s, %t; want recorded %t", test.name, supplier, since, ok, test.expected[supplier])
+			}
+		}
+	}
+}
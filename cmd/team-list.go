@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"buchhalter/lib/repository"
+	"buchhalter/lib/settings"
+
+	"github.com/spf13/cobra"
+)
+
+// teamListCmd represents the `team list` command
+var teamListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists the teams of the buchhalter SaaS API key of the selected vault",
+	Long: `A buchhalter SaaS API key can belong to several teams.
+This command lists the teams of the API key of the selected vault and marks the team documents are uploaded to.`,
+	Run: RunTeamListCommand,
+}
+
+func init() {
+	teamCmd.AddCommand(teamListCmd)
+}
+
+func RunTeamListCommand(cmd *cobra.Command, args []string) {
+	buchhalterConfig := loadConfig()
+
+	// Init logging
+	buchhalterDirectory := buchhalterConfig.Directory
+	developmentMode := buchhalterConfig.Dev
+	logSetting, err := cmd.Flags().GetBool("log")
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error reading log flag: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	logger, err := initializeLogger(logSetting, developmentMode, buchhalterDirectory)
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error on initializing logging: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	logger.Info("Booting up", "development_mode", developmentMode)
+	defer logger.Info("Shutting down")
+
+	_, selectedVault, err := getSelectedVaultWithAPIKey(buchhalterConfig)
+	if err != nil {
+		exitWithLogo(capitalizeFirstLetter(err.Error()))
+	}
+	teams, err := getTeamsOfAPIKey(logger, buchhalterConfig, selectedVault.BuchhalterAPIKey)
+	if err != nil {
+		logger.Error("Error retrieving teams", "error", err)
+		exitWithLogo(capitalizeFirstLetter(err.Error()))
+	}
+
+	// UI
+	fmt.Printf("%s\n", renderTeams(teams, selectedVault))
+}
+
+func renderTeams(teams []repository.Team, selectedVault *settings.Vault) string {
+	s := strings.Builder{}
+	s.WriteString(headerStyle(LogoText))
+
+	if len(teams) == 0 {
+		s.WriteString(textStyleBold(fmt.Sprintf("\nThe buchhalter SaaS API key of vault `%s` doesn't belong to a team.\n", selectedVault.Name)))
+		return s.String()
+	}
+
+	// Without a configured team, the first team is used
+	activeTeam, err := repository.SelectTeam(teams, selectedVault.BuchhalterTeam)
+	if err != nil {
+		activeTeam = repository.Team{}
+	}
+
+	s.WriteString(fmt.Sprintf("\nTeams of the buchhalter SaaS API key of vault `%s`:\n\n", selectedVault.Name))
+	for _, team := range teams {
+		emojy := inactiveMark.Render()
+		if team.ID == activeTeam.ID {
+			emojy = checkMark.Render()
+		}
+		s.WriteString(fmt.Sprintf("%s %s (%s)", emojy, team.Name, team.Slug))
+		if team.ID == activeTeam.ID {
+			s.WriteString(textStyleBold(" (currently selected)"))
+		}
+		s.WriteString("\n")
+	}
+
+	if len(activeTeam.ID) == 0 {
+		s.WriteString("\n")
+		s.WriteString(errorStyle.Render(fmt.Sprintf("The configured team `%s` was not found, uploads fail until another team is selected.", selectedVault.BuchhalterTeam)))
+		s.WriteString("\n")
+	}
+
+	s.WriteString("\n")
+	s.WriteString("Want to upload documents to another team?\n")
+	s.WriteString("• `buchhalter team select` to select the team of the selected vault\n")
+
+	return s.String()
+}
@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"buchhalter/lib/repository"
+	"buchhalter/lib/settings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/spf13/cobra"
+)
+
+// teamSelectCmd represents the `team select` command
+var teamSelectCmd = &cobra.Command{
+	Use:   "select [team-slug]",
+	Short: "Select the team documents are uploaded to",
+	Long: `A buchhalter SaaS API key can belong to several teams.
+The selected team is stored in the configuration of the selected vault, documents are checked and uploaded for this team.
+Without a team slug, the team is selected interactively.`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  RunTeamSelectCommand,
+}
+
+func init() {
+	teamCmd.AddCommand(teamSelectCmd)
+}
+
+func RunTeamSelectCommand(cmd *cobra.Command, args []string) {
+	buchhalterConfig := loadConfig()
+
+	// Init logging
+	buchhalterDirectory := buchhalterConfig.Directory
+	developmentMode := buchhalterConfig.Dev
+	logSetting, err := cmd.Flags().GetBool("log")
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error reading log flag: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	logger, err := initializeLogger(logSetting, developmentMode, buchhalterDirectory)
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error on initializing logging: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	logger.Info("Booting up", "development_mode", developmentMode)
+	defer logger.Info("Shutting down")
+
+	credentialProviderVaults, selectedVault, err := getSelectedVaultWithAPIKey(buchhalterConfig)
+	if err != nil {
+		exitWithLogo(capitalizeFirstLetter(err.Error()))
+	}
+	teams, err := getTeamsOfAPIKey(logger, buchhalterConfig, selectedVault.BuchhalterAPIKey)
+	if err != nil {
+		logger.Error("Error retrieving teams", "error", err)
+		exitWithLogo(capitalizeFirstLetter(err.Error()))
+	}
+
+	if len(args) > 0 {
+		team, err := repository.SelectTeam(teams, strings.TrimSpace(args[0]))
+		if err != nil {
+			exitWithLogo(capitalizeFirstLetter(err.Error()))
+		}
+		if err := writeVaultTeam(buchhalterConfig.ConfigFile, credentialProviderVaults, *selectedVault, team); err != nil {
+			exitWithLogo(capitalizeFirstLetter(err.Error()))
+		}
+		logger.Info("Selected team", "vault_id", selectedVault.ID, "team", team.Slug)
+		printVaultActionCompleted(fmt.Sprintf("Selected team '%s' for vault '%s'", team.Name, selectedVault.Name))
+		return
+	}
+	if len(teams) == 0 {
+		exitWithLogo(fmt.Sprintf("The buchhalter SaaS API key of vault `%s` doesn't belong to a team.", selectedVault.Name))
+	}
+
+	viewModel := ViewModelTeamSelect{
+		// UI
+		actionsCompleted: []string{},
+
+		// Teams
+		vaults:        credentialProviderVaults,
+		selectedVault: *selectedVault,
+		teams:         teams,
+		configFile:    buchhalterConfig.ConfigFile,
+
+		// Team selection
+		showSelection: true,
+	}
+
+	// Run the program
+	p := tea.NewProgram(&viewModel)
+	if _, err := p.Run(); err != nil {
+		logger.Error("Error running program", "error", err)
+		exitMessage := fmt.Sprintf("Error running program: %s", err)
+		exitWithLogo(exitMessage)
+	}
+}
+
+// writeVaultTeam stores team as the team of selectedVault in configFile.
+func writeVaultTeam(configFile string, vaults []settings.Vault, selectedVault settings.Vault, team repository.Team) error {
+	selectedVault.BuchhalterTeam = team.Slug
+	return writeVaultConfigurations(configFile, replaceOrAddVaultByIDInVaultConfigList(vaults, selectedVault))
+}
+
+type ViewModelTeamSelect struct {
+	// UI
+	actionsCompleted []string
+	actionError      string
+
+	// Teams
+	vaults        []settings.Vault
+	selectedVault settings.Vault
+	teams         []repository.Team
+	configFile    string
+
+	// Team selection
+	showSelection   bool
+	selectionCursor int
+}
+
+type writeTeamConfigMsg struct {
+	teamName string
+	err      error
+}
+
+func (m ViewModelTeamSelect) Init() tea.Cmd {
+	return nil
+}
+
+func (m ViewModelTeamSelect) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+c", "q":
+			return m, tea.Quit
+
+		case "enter":
+			// We only allow enter if the team selection is shown
+			if !m.showSelection {
+				return m, nil
+			}
+
+			team := m.teams[m.selectionCursor]
+
+			// Deactivate selection
+			m.showSelection = false
+			m.actionsCompleted = append(m.actionsCompleted, fmt.Sprintf("Selected team `%s` to upload documents to", team.Name))
+
+			return m, func() tea.Msg {
+				err := writeVaultTeam(m.configFile, m.vaults, m.selectedVault, team)
+				return writeTeamConfigMsg{teamName: team.Name, err: err}
+			}
+
+		case "down", "j":
+			if !m.showSelection {
+				return m, nil
+			}
+
+			m.selectionCursor++
+			if m.selectionCursor >= len(m.teams) {
+				m.selectionCursor = 0
+			}
+
+		case "up", "k":
+			if !m.showSelection {
+				return m, nil
+			}
+
+			m.selectionCursor--
+			if m.selectionCursor < 0 {
+				m.selectionCursor = len(m.teams) - 1
+			}
+		}
+
+	case writeTeamConfigMsg:
+		if msg.err != nil {
+			m.actionError = msg.err.Error()
+			return m, tea.Quit
+		}
+
+		m.actionsCompleted = append(m.actionsCompleted, fmt.Sprintf("Selected team '%s' for vault '%s'", msg.teamName, m.selectedVault.Name))
+		return m, tea.Quit
+	}
+
+	return m, nil
+}
+
+func (m ViewModelTeamSelect) View() string {
+	s := strings.Builder{}
+	s.WriteString(headerStyle(LogoText) + "\n\n")
+
+	for _, actionCompleted := range m.actionsCompleted {
+		s.WriteString(checkMark.Render() + " " + textStyleBold(actionCompleted) + "\n")
+	}
+
+	if len(m.actionError) > 0 {
+		s.WriteString(errorMark.Render() + " " + textStyleBold(capitalizeFirstLetter(m.actionError)) + "\n")
+	}
+
+	if m.showSelection {
+		s.WriteString(fmt.Sprintf("The buchhalter SaaS API key of vault `%s` belongs to the following teams.\n", m.selectedVault.Name))
+		s.WriteString("Select the team documents should be uploaded to and press ENTER:\n\n")
+		activeSlug := m.selectedVault.BuchhalterTeam
+		if len(activeSlug) == 0 {
+			activeSlug = m.teams[0].Slug
+		}
+		s.WriteString(renderTeamChoices(m.teams, m.selectionCursor, activeSlug))
+	}
+
+	s.WriteString("\n(press q to quit)\n")
+
+	return s.String()
+}
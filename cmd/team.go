@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"buchhalter/lib/repository"
+	"buchhalter/lib/settings"
+	"buchhalter/lib/utils"
+
+	"github.com/spf13/cobra"
+)
+
+// teamCmd represents the team command
+var teamCmd = &cobra.Command{
+	Use:   "team",
+	Short: "Sub-Commands to manage the team documents are uploaded to",
+	Long: `Sub-Commands to manage the team documents are uploaded to.
+A buchhalter SaaS API key can belong to several teams, the team is stored in the configuration of the selected vault.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println("Nothing to see here. Try `buchhalter help team`.")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(teamCmd)
+}
+
+// getSelectedVaultWithAPIKey returns the configured vaults and the selected vault, the selected vault requires an API key.
+func getSelectedVaultWithAPIKey(buchhalterConfig *settings.Config) ([]settings.Vault, *settings.Vault, error) {
+	credentialProviderVaults := buchhalterConfig.Vaults
+	selectedVault := getSelectedVaultConfiguration(credentialProviderVaults)
+	if selectedVault == nil {
+		return nil, nil, fmt.Errorf("no vault selected, select one via `buchhalter vault select` first")
+	}
+	if len(selectedVault.BuchhalterAPIKey) == 0 {
+		return nil, nil, fmt.Errorf("vault `%s` has no buchhalter SaaS API key, add it via `buchhalter vault add` first", selectedVault.Name)
+	}
+	return credentialProviderVaults, selectedVault, nil
+}
+
+// getTeamsOfAPIKey returns the teams the API key belongs to.
+func getTeamsOfAPIKey(logger *slog.Logger, buchhalterConfig *settings.Config, apiKey string) ([]repository.Team, error) {
+	utils.RegisterSecret(apiKey)
+	buchhalterAPIClient, err := repository.NewBuchhalterAPIClient(logger, buchhalterConfig.APIHost, buchhalterConfig.ConfigDirectory, apiKey, cliVersion)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing Buchhalter API client: %w", err)
+	}
+	user, err := buchhalterAPIClient.GetAuthenticatedUser()
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving the teams of the API key: %w", err)
+	}
+	if user == nil || len(user.User.ID) == 0 {
+		return nil, fmt.Errorf("the buchhalter SaaS API key %s is not valid", maskString(apiKey))
+	}
+	return user.User.Teams, nil
+}
+
+// teamSlugs returns the slugs of teams.
+func teamSlugs(teams []repository.Team) []string {
+	slugs := make([]string, 0, len(teams))
+	for _, team := range teams {
+		slugs = append(slugs, team.Slug)
+	}
+	return slugs
+}
+
+// renderTeamChoices renders the selection of a team, the team with activeSlug is marked as currently selected.
+func renderTeamChoices(teams []repository.Team, cursor int, activeSlug string) string {
+	s := strings.Builder{}
+	for i, team := range teams {
+		if cursor == i {
+			s.WriteString("(•) ")
+		} else {
+			s.WriteString("( ) ")
+		}
+		s.WriteString(fmt.Sprintf("%s (%s)", team.Name, team.Slug))
+		if len(activeSlug) > 0 && strings.EqualFold(team.Slug, activeSlug) {
+			s.WriteString(textStyleBold(" (currently selected)"))
+		}
+		s.WriteString("\n")
+	}
+	return s.String()
+}
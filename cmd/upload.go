@@ -0,0 +1,256 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"buchhalter/lib/archive"
+	"buchhalter/lib/repository"
+	"buchhalter/lib/settings"
+	"buchhalter/lib/utils"
+)
+
+// uploadCmd represents the upload command
+var uploadCmd = &cobra.Command{
+	Use:   "upload <directory>",
+	Short: "Uploads the invoices of a local directory to Buchhalter API",
+	Long: `Uploads all invoices of a local directory (e.g. manually downloaded invoices) of a supplier to Buchhalter API.
+
+Invoices that exist in Buchhalter API already (compared by checksum) are skipped.
+A premium subscription (API key of the vault) is required.`,
+	Args: cobra.ExactArgs(1),
+	Run:  RunUploadCommand,
+}
+
+func init() {
+	uploadCmd.Flags().String("supplier", "", "Supplier of the invoices (e.g. hetzner)")
+	uploadCmd.Flags().StringP("vault", "v", "", "Vault to use the Buchhalter API key of")
+	if err := uploadCmd.MarkFlagRequired("supplier"); err != nil {
+		fmt.Printf("Failed to mark 'supplier' flag as required: %v\n", err)
+		os.Exit(1)
+	}
+
+	rootCmd.AddCommand(uploadCmd)
+}
+
+func RunUploadCommand(cmd *cobra.Command, cmdArgs []string) {
+	buchhalterConfig := loadConfig()
+
+	// Init logging
+	buchhalterDirectory := buchhalterConfig.Directory
+	developmentMode := buchhalterConfig.Dev
+	logSetting, err := cmd.Flags().GetBool("log")
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error reading log flag: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	supplier, err := cmd.Flags().GetString("supplier")
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error reading supplier flag: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	supplier = strings.TrimSpace(supplier)
+	if len(supplier) == 0 {
+		exitWithLogo("The supplier of the invoices is required, e.g. `--supplier hetzner`")
+	}
+	vaultName, err := cmd.Flags().GetString("vault")
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error reading vault flag: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	logger, err := initializeLogger(logSetting, developmentMode, buchhalterDirectory)
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error on initializing logging: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	logger.Info("Booting up", "development_mode", developmentMode)
+	defer logger.Info("Shutting down")
+
+	uploadDirectory, err := filepath.Abs(cmdArgs[0])
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error resolving directory `%s`: %s", cmdArgs[0], err)
+		exitWithLogo(exitMessage)
+	}
+	if fileInfo, err := os.Stat(uploadDirectory); err != nil || !fileInfo.IsDir() {
+		exitMessage := fmt.Sprintf("Directory `%s` does not exist", uploadDirectory)
+		exitWithLogo(exitMessage)
+	}
+
+	// The Buchhalter API key is configured per vault
+	credentialProviderVaults := buchhalterConfig.Vaults
+	var selectedVault *settings.Vault
+	if vaultName = strings.TrimSpace(vaultName); len(vaultName) > 0 {
+		selectedVault = getVaultFromVaultListByVaultName(credentialProviderVaults, vaultName)
+	} else if selectedVault = profileVault(buchhalterConfig); selectedVault == nil {
+		selectedVault = getSelectedVaultConfiguration(credentialProviderVaults)
+	}
+	if selectedVault != nil {
+		selectedVault = applyProfileToVault(buchhalterConfig, selectedVault)
+	}
+	if selectedVault == nil || len(selectedVault.BuchhalterAPIKey) == 0 {
+		exitWithLogo("Uploading invoices requires a premium subscription. Please add the API key of your vault via `buchhalter vault add` first.")
+	}
+	utils.RegisterSecret(selectedVault.BuchhalterAPIKey)
+
+	// Init Buchhalter API client
+	buchhalterAPIClient, err := repository.NewBuchhalterAPIClient(logger, buchhalterConfig.APIHost, buchhalterConfig.ConfigDirectory, selectedVault.BuchhalterAPIKey, cliVersion)
+	if err != nil {
+		logger.Error("Error initializing Buchhalter API client", "error", err)
+		exitMessage := fmt.Sprintf("Error initializing Buchhalter API client: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	buchhalterAPIClient.SetTeam(selectedVault.BuchhalterTeam)
+	user, err := buchhalterAPIClient.GetAuthenticatedUser()
+	if err != nil {
+		logger.Error("Error retrieving authenticated user", "error", err)
+		exitMessage := fmt.Sprintf("Error retrieving a premium subscription to Buchhalter API: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	if user == nil || len(user.User.ID) == 0 {
+		exitWithLogo(fmt.Sprintf("Uploading invoices requires a premium subscription. The API key of vault `%s` is not valid.", selectedVault.Name))
+	}
+
+	// Index the directory like a document archive, all documents belong to the given supplier
+	documentArchive := archive.NewDocumentArchive(logger, uploadDirectory, buchhalterConfig.DocumentLayout)
+	if err := documentArchive.BuildArchiveIndex(); err != nil {
+		logger.Error("Error building document archive index", "error", err, "directory", uploadDirectory)
+		exitMessage := fmt.Sprintf("Error reading invoices from `%s`: %s", uploadDirectory, err)
+		exitWithLogo(exitMessage)
+	}
+	fileIndex := documentArchive.GetFileIndex()
+	for fileChecksum, fileInfo := range fileIndex {
+		fileInfo.Supplier = supplier
+		fileIndex[fileChecksum] = fileInfo
+	}
+	logger.Info("Uploading documents to Buchhalter API", "directory", uploadDirectory, "supplier", supplier, "num_documents", len(fileIndex))
+
+	uploadErrors := []error{}
+	uploadResult := uploadDocuments(logger, buchhalterConfig, buchhalterAPIClient, fileIndex, false, func(err error) {
+		uploadErrors = append(uploadErrors, err)
+	})
+
+	fmt.Print(renderUploadResult(supplier, uploadResult, uploadErrors))
+	if uploadResult.failed > 0 || uploadResult.unchecked > 0 {
+		os.Exit(1)
+	}
+}
+
+func renderUploadResult(supplier string, result documentUploadResult, uploadErrors []error) string {
+	s := strings.Builder{}
+	s.WriteString(headerStyle(LogoText) + "\n\n")
+
+	for _, err := range uploadErrors {
+		s.WriteString(errorMark.Render() + " " + errorStyle.Render(capitalizeFirstLetter(err.Error())) + "\n")
+	}
+
+	documentsLabel := "documents"
+	if result.uploaded == 1 {
+		documentsLabel = "document"
+	}
+	s.WriteString(checkMark.Render() + " " + textStyleBold(fmt.Sprintf("Uploaded %d %s of supplier `%s` to Buchhalter API (%d skipped, because they already exist)", result.uploaded, documentsLabel, supplier, result.skippedExists)) + "\n")
+	if result.failed > 0 {
+		s.WriteString(errorMark.Render() + " " + textStyleBold(fmt.Sprintf("%d documents failed", result.failed)) + "\n")
+	}
+	if result.unchecked > 0 {
+		s.WriteString(errorMark.Render() + " " + textStyleBold(uncheckedDocumentsMessage(result.unchecked)) + "\n")
+	}
+
+	return s.String()
+}
+
+// uncheckedDocumentsMessage returns the warning of the summary of documents, whose existence couldn't be checked.
+func uncheckedDocumentsMessage(unchecked int) string {
+	if unchecked == 1 {
+		return "1 document could not be checked and was not uploaded"
+	}
+	return fmt.Sprintf("%d documents could not be checked and were not uploaded", unchecked)
+}
+
+// documentUploadResult counts the documents of an upload to Buchhalter API.
+type documentUploadResult struct {
+	uploaded      int
+	skippedExists int
+	failed        int
+	// unchecked are the documents not uploaded, because their existence couldn't be checked
+	unchecked int
+	// incompleteSuppliers are the suppliers with failed or unchecked documents
+	incompleteSuppliers map[string]bool
+}
+
+// uploadDocuments uploads the documents of fileIndex (checksum => file) that don't exist in Buchhalter API already.
+// With force, the existence check is bypassed and all documents are uploaded (e.g. to replace a corrupt copy).
+// Failed uploads are reported via onError and don't abort the upload of the other documents.
+func uploadDocuments(logger *slog.Logger, buchhalterConfig *settings.Config, buchhalterAPIClient *repository.BuchhalterAPIClient, fileIndex map[string]archive.File, force bool, onError func(error)) documentUploadResult {
+	result := documentUploadResult{incompleteSuppliers: map[string]bool{}}
+
+	// Check the existence of all documents up front, the documents are uploaded in order of their checksums
+	fileChecksums := make([]string, 0, len(fileIndex))
+	for fileChecksum := range fileIndex {
+		fileChecksums = append(fileChecksums, fileChecksum)
+	}
+	sort.Strings(fileChecksums)
+	chunkSize := buchhalterConfig.UploadExistenceChunkSize
+	concurrency := buchhalterConfig.UploadExistenceConcurrency
+	if err := repository.ValidateExistenceCheckOptions(chunkSize, concurrency); err != nil {
+		logger.Warn("Invalid existence check options configured, using the defaults", "chunk_size", chunkSize, "concurrency", concurrency, "error", err)
+		chunkSize, concurrency = repository.DefaultExistenceCheckChunkSize, repository.DefaultExistenceCheckConcurrency
+	}
+	existenceTimeout, err := time.ParseDuration(buchhalterConfig.UploadExistenceTimeout)
+	if err != nil || existenceTimeout <= 0 {
+		logger.Warn("Invalid `buchhalter_upload_existence_timeout`, using the default", "buchhalter_upload_existence_timeout", buchhalterConfig.UploadExistenceTimeout, "default", repository.DefaultExistenceCheckTimeout, "error", err)
+		existenceTimeout = repository.DefaultExistenceCheckTimeout
+	}
+	buchhalterAPIClient.SetExistenceCheckTimeout(existenceTimeout)
+	buchhalterAPIClient.SetExistenceCheckAttempts(buchhalterConfig.UploadExistenceAttempts)
+	existence := map[string]bool{}
+	if force {
+		logger.Info("Skipping the existence check of documents in Buchhalter API due to --force-upload", "num_documents", len(fileChecksums))
+		for _, fileChecksum := range fileChecksums {
+			existence[fileChecksum] = false
+		}
+	} else {
+		existence, err = buchhalterAPIClient.DocumentsExist(fileChecksums, chunkSize, concurrency)
+		if err != nil {
+			logger.Error("Error checking if documents exist already in Buchhalter API", "error", err)
+		}
+	}
+
+	for _, fileChecksum := range fileChecksums {
+		fileInfo := fileIndex[fileChecksum]
+		logger.Info("Uploading document to Buchhalter API ...", "file", fileInfo.Path, "checksum", fileChecksum)
+		exists, checked := existence[fileChecksum]
+		if !checked {
+			// Skip the file if we can't check the existence of the document in the API (after all retries), it is counted as unchecked
+			logger.Error("Error checking if document exists already in Buchhalter API", "file", fileInfo.Path, "checksum", fileChecksum)
+			result.unchecked++
+			result.incompleteSuppliers[fileInfo.Supplier] = true
+			continue
+		}
+		// If the file exists already, skip it
+		if exists {
+			logger.Info("Uploading document to Buchhalter API ... exists already", "file", fileInfo.Path, "checksum", fileChecksum)
+			result.skippedExists++
+			continue
+		}
+		logger.Info("Uploading document to Buchhalter API ... does not exist already", "file", fileInfo.Path, "checksum", fileChecksum)
+
+		err := buchhalterAPIClient.UploadDocument(fileInfo.Path, fileInfo.Supplier)
+		if err != nil {
+			onError(fmt.Errorf("error uploading document `%s` from `%s` to Buchhalter API: %w", fileInfo.Path, fileInfo.Supplier, err))
+			logger.Error("Error uploading document to Buchhalter API", "file", fileInfo.Path, "supplier", fileInfo.Supplier, "error", err)
+			result.failed++
+			result.incompleteSuppliers[fileInfo.Supplier] = true
+			continue
+		}
+		result.uploaded++
+	}
+
+	return result
+}
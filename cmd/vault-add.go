@@ -13,6 +13,7 @@ import (
 	"github.com/spf13/viper"
 
 	"buchhalter/lib/repository"
+	"buchhalter/lib/settings"
 	"buchhalter/lib/utils"
 	"buchhalter/lib/vault"
 )
@@ -20,22 +21,38 @@ import (
 // vaultAddCmd represents the `vault add` command
 var vaultAddCmd = &cobra.Command{
 	Use:   "add",
-	Short: "Configure a (new) 1Password vault to buchhalter-cli configuration",
-	Long: `To use a 1Password vault inside buchhalter, you need to allow buchhalter to use the vault by configuring this.
+	Short: "Configure a (new) vault of the credential provider to buchhalter-cli configuration",
+	Long: `To use a vault inside buchhalter, you need to allow buchhalter to use the vault by configuring this.
 During configuration you can add a buchhalter SaaS API key to the vault configuration.
 
-Vaults that have been configured already will be overwritten.`,
+The vaults are listed from the credential provider configured in ` + "`credential_provider`" + ` (default: 1Password) or the one set via --provider.
+The provider is stored with the vault, so vaults of different providers can be configured side by side.
+Vaults of pass are the top level directories of the password store, vaults of KeePass are the groups of the database.
+
+Vaults that have been configured already will be overwritten.
+
+With --vault-id, the vault is added without interaction (e.g. for provisioning).
+An API key of an existing vault configuration is kept, unless a new one is set via --api-key.
+
+If the API key belongs to several teams, the team documents are uploaded to is selected during configuration or via --team.
+The team can be switched later via ` + "`buchhalter team select`" + `.`,
 	Run: RunVaultAddCommand,
 }
 
 func init() {
+	vaultAddCmd.Flags().String("vault-id", "", "ID of the vault to add (non-interactive)")
+	vaultAddCmd.Flags().String("api-key", "", "buchhalter SaaS API key of the vault (non-interactive, requires --vault-id)")
+	vaultAddCmd.Flags().String("team", "", "Slug of the team of the API key documents are uploaded to")
+	vaultAddCmd.Flags().String("provider", "", "Credential provider of the vault: 1password, pass, keepass or file (default: credential_provider)")
 	vaultCmd.AddCommand(vaultAddCmd)
 }
 
 func RunVaultAddCommand(cmd *cobra.Command, args []string) {
+	buchhalterConfig := loadConfig()
+
 	// Init logging
-	buchhalterDirectory := viper.GetString("buchhalter_directory")
-	developmentMode := viper.GetBool("dev")
+	buchhalterDirectory := buchhalterConfig.Directory
+	developmentMode := buchhalterConfig.Dev
 	logSetting, err := cmd.Flags().GetBool("log")
 	if err != nil {
 		exitMessage := fmt.Sprintf("Error reading log flag: %s", err)
@@ -49,16 +66,60 @@ func RunVaultAddCommand(cmd *cobra.Command, args []string) {
 	logger.Info("Booting up", "development_mode", developmentMode)
 	defer logger.Info("Shutting down")
 
+	vaultID, err := cmd.Flags().GetString("vault-id")
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error reading vault-id flag: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	apiKey, err := cmd.Flags().GetString("api-key")
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error reading api-key flag: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	team, err := cmd.Flags().GetString("team")
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error reading team flag: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	vaultID = strings.TrimSpace(vaultID)
+	apiKey = strings.TrimSpace(apiKey)
+	team = strings.TrimSpace(team)
+	if len(vaultID) == 0 && len(apiKey) > 0 {
+		exitWithLogo("The flag --api-key requires --vault-id")
+	}
+	if len(vaultID) > 0 && len(team) > 0 && len(apiKey) == 0 {
+		exitWithLogo("The flag --team requires --api-key. Use `buchhalter team select` to switch the team of a configured vault.")
+	}
+
+	provider := vaultProviderFromFlag(cmd, buchhalterConfig.CredentialProvider)
+	providerName := vault.GetProviderName(provider)
+
+	// The passphrase is prompted before the UI starts
+	var keePassConfig vault.KeePassConfig
+	if provider == vault.PROVIDER_KEEPASS {
+		keePassConfig, err = readKeePassConfig(buchhalterConfig)
+		if err != nil {
+			exitWithLogo(capitalizeFirstLetter(err.Error()))
+		}
+		utils.RegisterSecret(keePassConfig.Password)
+	}
+
+	// Init vaults from configuration
+	credentialProviderVaults := buchhalterConfig.Vaults
+
+	if len(vaultID) > 0 {
+		vaultName, err := addVaultNonInteractive(logger, buchhalterConfig, provider, keePassConfig, vaultID, apiKey, team)
+		if err != nil {
+			exitWithLogo(capitalizeFirstLetter(err.Error()))
+		}
+		printVaultActionCompleted(fmt.Sprintf("Added %s vault '%s' to buchhalter configuration", providerName, vaultName))
+		return
+	}
+
 	// Init UI
 	spinnerModel := spinner.New()
 	spinnerModel.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("63"))
 
-	// Init vaults from configuration
-	credentialProviderVaults := []vaultConfiguration{}
-	if err := viper.UnmarshalKey("credential_provider_vaults", &credentialProviderVaults); err != nil {
-		exitMessage := fmt.Sprintf("Error reading configuration field `credential_provider_vaults`: %s", err)
-		exitWithLogo(exitMessage)
-	}
 	selectedVault := getSelectedVaultConfiguration(credentialProviderVaults)
 	selectedVaultName := ""
 	if selectedVault != nil {
@@ -90,8 +151,16 @@ func RunVaultAddCommand(cmd *cobra.Command, args []string) {
 		apiKeyTextInput: apiKeyTextInput,
 		apiKey:          "",
 
+		// Team selection
+		team: team,
+
+		// Credential provider
+		provider:      provider,
+		keePassConfig: keePassConfig,
+
 		// Cmd
-		logger: logger,
+		logger:           logger,
+		buchhalterConfig: buchhalterConfig,
 	}
 
 	// Run the program
@@ -103,7 +172,62 @@ func RunVaultAddCommand(cmd *cobra.Command, args []string) {
 	}
 }
 
-func getVaultFromVaultListByVaultID(vaults []vaultConfiguration, vaultID string) *vaultConfiguration {
+// addVaultNonInteractive adds the vault vaultID of provider (with the API key and its team, if set) to the configuration and returns the name of the vault.
+// If the API key belongs to several teams, the team is required.
+func addVaultNonInteractive(logger *slog.Logger, buchhalterConfig *settings.Config, provider string, keePassConfig vault.KeePassConfig, vaultID, apiKey, team string) (string, error) {
+	vaults := buchhalterConfig.Vaults
+
+	// API keys are 64 characters long
+	if len(apiKey) > 0 && len(apiKey) != 64 {
+		return "", fmt.Errorf("buchhalter SaaS API Key has not the correct length (%d chars, expected a 64 char key)", len(apiKey))
+	}
+
+	msg := vaultSelectInitCmd(logger, buchhalterConfig, provider, keePassConfig)
+	if errMsg, ok := msg.(vaultSelectErrorMsg); ok {
+		return "", errMsg.err
+	}
+	var vaultToWrite *settings.Vault
+	for _, v := range msg.(vaultSelectInitSuccessMsg).vaults {
+		if v.ID == vaultID {
+			vaultToWrite = &settings.Vault{ID: v.ID, Name: v.Name, Provider: provider}
+			break
+		}
+	}
+	if vaultToWrite == nil {
+		return "", fmt.Errorf("vault `%s` not found in %s", vaultID, vault.GetProviderName(provider))
+	}
+
+	// Keep the API key, its team and the selection of an existing vault configuration
+	if existingVault := getVaultFromVaultListByVaultID(vaults, vaultID); existingVault != nil {
+		vaultToWrite.BuchhalterAPIKey = existingVault.BuchhalterAPIKey
+		vaultToWrite.BuchhalterTeam = existingVault.BuchhalterTeam
+		vaultToWrite.Selected = existingVault.Selected
+	}
+	if len(apiKey) > 0 {
+		valid, message, teams := verifyBuchhalterAPIKey(logger, buchhalterConfig, apiKey)
+		if !valid {
+			return "", fmt.Errorf("buchhalter SaaS API Key %s: %s", maskString(apiKey), message)
+		}
+		if len(team) == 0 && len(teams) > 1 {
+			return "", fmt.Errorf("buchhalter SaaS API Key %s belongs to several teams, select one via --team (%s)", maskString(apiKey), strings.Join(teamSlugs(teams), ", "))
+		}
+		selectedTeam, err := repository.SelectTeam(teams, team)
+		if err != nil {
+			return "", err
+		}
+		vaultToWrite.BuchhalterAPIKey = apiKey
+		vaultToWrite.BuchhalterTeam = selectedTeam.Slug
+	}
+
+	if err := writeVaultConfigurations(buchhalterConfig.ConfigFile, replaceOrAddVaultByIDInVaultConfigList(vaults, *vaultToWrite)); err != nil {
+		return "", err
+	}
+	logger.Info("Added vault", "provider", provider, "vault_id", vaultToWrite.ID, "vault_name", vaultToWrite.Name, "with_api_key", len(vaultToWrite.BuchhalterAPIKey) > 0, "team", vaultToWrite.BuchhalterTeam)
+
+	return vaultToWrite.Name, nil
+}
+
+func getVaultFromVaultListByVaultID(vaults []settings.Vault, vaultID string) *settings.Vault {
 	for _, vault := range vaults {
 		if vault.ID == vaultID {
 			return &vault
@@ -120,7 +244,7 @@ type ViewModelVaultAdd struct {
 	spinner          spinner.Model
 
 	// Vaults
-	vaults []vaultConfiguration
+	vaults []settings.Vault
 
 	// Vault selection
 	showSelection        bool
@@ -133,8 +257,19 @@ type ViewModelVaultAdd struct {
 	apiKeyTextInput textinput.Model
 	apiKey          string
 
+	// Team selection (if the API key belongs to several teams)
+	showTeamSelection bool
+	teamCursor        int
+	teamChoices       []repository.Team
+	team              string
+
+	// Credential provider of the vaults (and the KeePass database)
+	provider      string
+	keePassConfig vault.KeePassConfig
+
 	// Cmd
-	logger *slog.Logger
+	logger           *slog.Logger
+	buchhalterConfig *settings.Config
 }
 
 type vaultSelectErrorMsg struct {
@@ -148,21 +283,33 @@ type vaultSelectInitSuccessMsg struct {
 type verifySaaSAPIKeyResultMsg struct {
 	success bool
 	message string
+	teams   []repository.Team
 }
 
 type triggerConfigurationWriteMsg struct {
 }
 
-func vaultSelectInitCmd(logger *slog.Logger) tea.Msg {
+// vaultSelectInitCmd lists the vaults of provider.
+// A provider without vaults (the credentials file) has a single vault named after the provider.
+func vaultSelectInitCmd(logger *slog.Logger, buchhalterConfig *settings.Config, provider string, keePassConfig vault.KeePassConfig) tea.Msg {
 	// Init vault provider
-	vaultConfigBinary := viper.GetString("credential_provider_cli_command")
-	vaultProvider, err := vault.GetProvider(vault.PROVIDER_1PASSWORD, vaultConfigBinary, "", "", logger)
+	binary := vaultProviderBinary(buchhalterConfig, provider)
+	vaultProvider, err := vault.GetProvider(provider, binary, "", "", keePassConfig, strings.TrimSpace(buchhalterConfig.CredentialProviderFile), logger)
 	if err != nil {
-		return vaultSelectErrorMsg{err: vaultProvider.GetHumanReadableErrorMessage(err)}
+		if vaultProvider != nil {
+			err = vaultProvider.GetHumanReadableErrorMessage(err)
+		}
+		return vaultSelectErrorMsg{err: err}
 	}
 
 	// Get vaults
-	vaults, err := vaultProvider.GetVaults()
+	vaultLister, ok := vaultProvider.(vault.VaultLister)
+	if !ok {
+		return vaultSelectInitSuccessMsg{
+			vaults: []vault.Vault{{ID: provider, Name: provider}},
+		}
+	}
+	vaults, err := vaultLister.GetVaults()
 	if err != nil {
 		return vaultSelectErrorMsg{err: vaultProvider.GetHumanReadableErrorMessage(err)}
 	}
@@ -176,7 +323,7 @@ func (m ViewModelVaultAdd) Init() tea.Cmd {
 	// vaultSelectInitCmd needs to be adapted to return a Cmd, or we wrap it
 	// For now, let's create a command that calls it with the logger
 	initCmd := func() tea.Msg {
-		return vaultSelectInitCmd(m.logger)
+		return vaultSelectInitCmd(m.logger, m.buchhalterConfig, m.provider, m.keePassConfig)
 	}
 	return tea.Batch(initCmd, m.spinner.Tick, textinput.Blink)
 }
@@ -189,11 +336,28 @@ func (m ViewModelVaultAdd) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, tea.Quit
 
 		case "enter":
-			// We only allow enter if the vault selection OR the API key input field is shown
-			if !m.showSelection && !m.showAPIKeyInput {
+			// We only allow enter if the vault selection, the API key input field OR the team selection is shown
+			if !m.showSelection && !m.showAPIKeyInput && !m.showTeamSelection {
 				return m, nil
 			}
 
+			// Team selection
+			if m.showTeamSelection {
+				m.team = m.teamChoices[m.teamCursor].Slug
+
+				// Deactivate selection
+				m.showTeamSelection = false
+				m.actionInProgress = ""
+				m.actionsCompleted = append(m.actionsCompleted, utils.UIAction{
+					Message: fmt.Sprintf("Selected the team %s to upload documents to", m.teamChoices[m.teamCursor].Name),
+					Style:   utils.UIActionStyleSuccess,
+				})
+
+				return m, func() tea.Msg {
+					return triggerConfigurationWriteMsg{}
+				}
+			}
+
 			// Vault selection
 			if m.showSelection {
 				selectedVaultName := m.selectionChoices[m.selectionCursor].Name
@@ -202,7 +366,7 @@ func (m ViewModelVaultAdd) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.showSelection = false
 				m.actionInProgress = ""
 				m.actionsCompleted = append(m.actionsCompleted, utils.UIAction{
-					Message: fmt.Sprintf("Selected the 1Password vault %s to be added to buchhalter-cli configuration", selectedVaultName),
+					Message: fmt.Sprintf("Selected the %s vault %s to be added to buchhalter-cli configuration", vault.GetProviderName(m.provider), selectedVaultName),
 					Style:   utils.UIActionStyleSuccess,
 				})
 
@@ -236,10 +400,11 @@ func (m ViewModelVaultAdd) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					m.actionInProgress = "Validating buchhalter SaaS API Key ..."
 					return m, func() tea.Msg {
 						// Validating API key
-						verifyResult, verifyMessage := verifyBuchhalterAPIKey(m.logger, m.apiKey)
+						verifyResult, verifyMessage, teams := verifyBuchhalterAPIKey(m.logger, m.buchhalterConfig, m.apiKey)
 						return verifySaaSAPIKeyResultMsg{
 							success: verifyResult,
 							message: verifyMessage,
+							teams:   teams,
 						}
 					}
 				case len(apiKey) == 0:
@@ -260,6 +425,14 @@ func (m ViewModelVaultAdd) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 
 		case "down", "j":
+			if m.showTeamSelection {
+				m.teamCursor++
+				if m.teamCursor >= len(m.teamChoices) {
+					m.teamCursor = 0
+				}
+				return m, nil
+			}
+
 			// We only allow enter if the vault selection is shown
 			if !m.showSelection {
 				return m, nil
@@ -271,6 +444,14 @@ func (m ViewModelVaultAdd) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 
 		case "up", "k":
+			if m.showTeamSelection {
+				m.teamCursor--
+				if m.teamCursor < 0 {
+					m.teamCursor = len(m.teamChoices) - 1
+				}
+				return m, nil
+			}
+
 			// We only allow enter if the vault selection is shown
 			if !m.showSelection {
 				return m, nil
@@ -297,10 +478,10 @@ func (m ViewModelVaultAdd) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.selectionChoices = msg.vaults
 		m.actionInProgress = ""
 
-		// No vaults found in 1Password
+		// No vaults found in the credential provider
 		if len(msg.vaults) == 0 {
 			m.actionsCompleted = append(m.actionsCompleted, utils.UIAction{
-				Message: "No vaults found in 1Password",
+				Message: fmt.Sprintf("No vaults found in %s", vault.GetProviderName(m.provider)),
 				Style:   utils.UIActionStyleError,
 			})
 			return m, tea.Quit
@@ -312,7 +493,7 @@ func (m ViewModelVaultAdd) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		})
 
 		// Show Vault selection
-		m.actionInProgress = "Select the 1Password vault that should be used with buchhalter-cli"
+		m.actionInProgress = fmt.Sprintf("Select the %s vault that should be used with buchhalter-cli", vault.GetProviderName(m.provider))
 		m.showSelection = true
 
 	case verifySaaSAPIKeyResultMsg:
@@ -330,6 +511,29 @@ func (m ViewModelVaultAdd) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				Message: msg.message,
 				Style:   utils.UIActionStyleSuccess,
 			})
+
+			switch {
+			// Team set via --team
+			case len(m.team) > 0:
+				team, err := repository.SelectTeam(msg.teams, m.team)
+				if err != nil {
+					m.actionsCompleted = append(m.actionsCompleted, utils.UIAction{
+						Message: err.Error(),
+						Style:   utils.UIActionStyleError,
+					})
+					m.apiKey = ""
+					m.team = ""
+				} else {
+					m.team = team.Slug
+				}
+			case len(msg.teams) > 1:
+				m.teamChoices = msg.teams
+				m.showTeamSelection = true
+				m.actionInProgress = "Select the team documents should be uploaded to"
+				return m, nil
+			case len(msg.teams) == 1:
+				m.team = msg.teams[0].Slug
+			}
 		}
 
 		return m, func() tea.Msg {
@@ -348,24 +552,27 @@ func (m ViewModelVaultAdd) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				existingSelectedValue = existingVault.Selected
 			}
 
-			// If the API key is not 64 characters long, we invalidate it
+			// If the API key is not 64 characters long, we invalidate it (and its team)
 			configAPIKey := m.apiKey
+			configTeam := m.team
 			if len(configAPIKey) != 64 {
 				configAPIKey = ""
+				configTeam = ""
 			}
 
 			// Craft new vault configuration
-			vaultToWrite := vaultConfiguration{
+			vaultToWrite := settings.Vault{
 				ID:               vaultID,
 				Name:             vaultName,
 				BuchhalterAPIKey: configAPIKey,
+				BuchhalterTeam:   configTeam,
 				Selected:         existingSelectedValue,
+				Provider:         m.provider,
 			}
 			vaultsToWriteList := replaceOrAddVaultByIDInVaultConfigList(m.vaults, vaultToWrite)
 
-			viper.Set("credential_provider_vaults", vaultsToWriteList)
-			configFile := viper.GetString("buchhalter_config_file")
-			err := viper.WriteConfigAs(configFile)
+			viper.Set(settings.KeyCredentialProviderVaults, vaultsToWriteList)
+			err := viper.WriteConfigAs(m.buchhalterConfig.ConfigFile)
 			if err != nil {
 				return writeConfigFileMsg{
 					vaultName: vaultName,
@@ -385,7 +592,7 @@ func (m ViewModelVaultAdd) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 
 		m.actionsCompleted = append(m.actionsCompleted, utils.UIAction{
-			Message: fmt.Sprintf("Added 1Password vault '%s' to buchhalter configuration", msg.vaultName),
+			Message: fmt.Sprintf("Added %s vault '%s' to buchhalter configuration", vault.GetProviderName(m.provider), msg.vaultName),
 			Style:   utils.UIActionStyleSuccess,
 		})
 		return m, tea.Quit
@@ -452,6 +659,11 @@ func (m ViewModelVaultAdd) View() string {
 		s.WriteString("\n")
 	}
 
+	if m.showTeamSelection {
+		s.WriteString("\n")
+		s.WriteString(renderTeamChoices(m.teamChoices, m.teamCursor, ""))
+	}
+
 	s.WriteString("\n(press q to quit)\n")
 
 	return s.String()
@@ -465,23 +677,22 @@ func maskString(input string) string {
 	return start + masked + end
 }
 
-func verifyBuchhalterAPIKey(logger *slog.Logger, apiKey string) (bool, string) {
-	buchhalterConfigDirectory := viper.GetString("buchhalter_config_directory")
-	apiHost := viper.GetString("buchhalter_api_host")
-	buchhalterAPIClient, err := repository.NewBuchhalterAPIClient(logger, apiHost, buchhalterConfigDirectory, apiKey, cliVersion)
+// verifyBuchhalterAPIKey checks apiKey against Buchhalter API and returns the teams of a valid key.
+func verifyBuchhalterAPIKey(logger *slog.Logger, buchhalterConfig *settings.Config, apiKey string) (bool, string, []repository.Team) {
+	buchhalterAPIClient, err := repository.NewBuchhalterAPIClient(logger, buchhalterConfig.APIHost, buchhalterConfig.ConfigDirectory, apiKey, cliVersion)
 	if err != nil {
-		return false, "Error initializing API client"
+		return false, "Error initializing API client", nil
 	}
 
 	logger.Info("Making API call")
 	cliSyncResponse, err := buchhalterAPIClient.GetAuthenticatedUser()
 	if err != nil {
-		return false, "API call not successful, response could not be read"
+		return false, "API call not successful, response could not be read", nil
 	}
 
 	if cliSyncResponse == nil {
-		return false, "API Key is not valid"
+		return false, "API Key is not valid", nil
 	}
 
-	return true, "API Key is valid"
+	return true, "API Key is valid", cliSyncResponse.User.Teams
 }
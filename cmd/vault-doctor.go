@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"buchhalter/lib/parser"
+	"buchhalter/lib/settings"
+	"buchhalter/lib/utils"
+	"buchhalter/lib/vault"
+
+	"github.com/spf13/cobra"
+)
+
+// vaultDoctorCmd represents the `vault doctor` command
+var vaultDoctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Lists the vault items without a matching recipe and the recipes without a matching vault item",
+	Long: `A vault item is matched with a recipe if one of its URLs matches a domain of the recipe (see ` + "`domainMatch`" + ` of the recipe).
+Items whose URLs match no recipe are skipped by ` + "`buchhalter sync`" + ` without a message.
+This command lists them with their URLs and the domains of recipes for the same site, so you can fix the URL of the item in your vault.
+It also lists the recipes that match no vault item.
+
+Vault items pinned to a supplier (` + "`buchhalter_supplier_items`" + `) are matched with its recipe regardless of their URLs.`,
+	Args: cobra.NoArgs,
+	Run:  RunVaultDoctorCommand,
+}
+
+func init() {
+	vaultDoctorCmd.Flags().StringP("vault", "v", "", "Vault to check (default: the selected vault)")
+	vaultDoctorCmd.Flags().Bool("json", false, "output the unmatched vault items and recipes as JSON")
+	vaultCmd.AddCommand(vaultDoctorCmd)
+}
+
+func RunVaultDoctorCommand(cmd *cobra.Command, args []string) {
+	buchhalterConfig := loadConfig()
+
+	// Init logging
+	buchhalterDirectory := buchhalterConfig.Directory
+	developmentMode := buchhalterConfig.Dev
+	logSetting, err := cmd.Flags().GetBool("log")
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error reading log flag: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	vaultName, err := cmd.Flags().GetString("vault")
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error reading vault flag: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	jsonOutput, err := cmd.Flags().GetBool("json")
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error reading json flag: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	logger, err := initializeLogger(logSetting, developmentMode, buchhalterDirectory)
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error on initializing logging: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	logger.Info("Booting up", "development_mode", developmentMode)
+	defer logger.Info("Shutting down")
+
+	// The vault is selected like `buchhalter sync` does
+	var selectedVault *settings.Vault
+	if vaultName = strings.TrimSpace(vaultName); len(vaultName) > 0 {
+		selectedVault = getVaultFromVaultListByVaultName(buchhalterConfig.Vaults, vaultName)
+		if selectedVault == nil {
+			exitWithLogo(fmt.Sprintf("No vault configuration found for `%s`. Please run `buchhalter vault list` to see all configured vaults.", vaultName))
+		}
+	} else if selectedVault = profileVault(buchhalterConfig); selectedVault == nil {
+		selectedVault = getSelectedVaultConfiguration(buchhalterConfig.Vaults)
+	}
+	if selectedVault == nil {
+		selectedVault = &settings.Vault{ID: "default", Name: "buchhalter-default", Selected: true}
+	}
+
+	provider := selectedVault.ProviderOr(buchhalterConfig.CredentialProvider)
+	if !vault.IsSupportedProvider(provider) {
+		exitMessage := fmt.Sprintf("Credential provider `%s` of vault `%s` is not supported (supported: %s, %s, %s, %s)", provider, selectedVault.Name, vault.PROVIDER_1PASSWORD, vault.PROVIDER_PASS, vault.PROVIDER_KEEPASS, vault.PROVIDER_FILE)
+		exitWithLogo(exitMessage)
+	}
+	var keePassConfig vault.KeePassConfig
+	if provider == vault.PROVIDER_KEEPASS {
+		keePassConfig, err = readKeePassConfig(buchhalterConfig)
+		if err != nil {
+			exitWithLogo(capitalizeFirstLetter(err.Error()))
+		}
+		utils.RegisterSecret(keePassConfig.Password)
+	}
+
+	providerName := vault.GetProviderName(provider)
+	logger.Info("Initializing credential provider", "provider", providerName, "vault", selectedVault.Name, "tag", buchhalterConfig.CredentialProviderItemTag)
+	vaultProvider, err := vault.GetProvider(provider, vaultProviderBinary(buchhalterConfig, provider), selectedVault.Name, buchhalterConfig.CredentialProviderItemTag, keePassConfig, strings.TrimSpace(buchhalterConfig.CredentialProviderFile), logger)
+	if err == nil {
+		_, err = vaultProvider.LoadVaultItems()
+	}
+	if err != nil {
+		logger.Error("error initializing credential provider", "provider", providerName, "error", err)
+		if vaultProvider != nil {
+			err = vaultProvider.GetHumanReadableErrorMessage(err)
+		}
+		exitWithLogo(fmt.Sprintf("Error initializing credential provider %s: %s", providerName, err))
+	}
+
+	recipeParser := parser.NewRecipeParser(logger, buchhalterConfig.ConfigDirectory, buchhalterDirectory)
+	if _, err := recipeParser.LoadRecipes(developmentMode); err != nil {
+		logger.Error("Error loading recipes for suppliers", "error", err)
+		exitMessage := fmt.Sprintf("Error loading recipes: %s", err)
+		exitWithLogo(exitMessage)
+	}
+
+	diagnosis := recipeParser.DiagnoseMatches(vaultProvider.GetVaultItems(), vaultProvider.GetUrlsByItemId(), parser.NewItemPins(buchhalterConfig.SupplierItems))
+	logger.Info("Diagnosed matches of vault items and recipes", "num_items", len(vaultProvider.GetVaultItems()), "unmatched_items", len(diagnosis.UnmatchedItems), "unmatched_recipes", len(diagnosis.UnmatchedRecipes))
+
+	if jsonOutput {
+		diagnosisJSON, err := json.MarshalIndent(diagnosis, "", "  ")
+		if err != nil {
+			fmt.Printf("Error encoding diagnosis as JSON: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(diagnosisJSON))
+		return
+	}
+	fmt.Println(renderMatchDiagnosis(diagnosis, providerName, recipeParser.GetRecipes()))
+}
+
+func renderMatchDiagnosis(diagnosis parser.MatchDiagnosis, providerName string, recipes []parser.Recipe) string {
+	domainsBySupplier := map[string][]string{}
+	for _, recipe := range recipes {
+		domainsBySupplier[recipe.Supplier] = recipe.Domains
+	}
+
+	s := strings.Builder{}
+	s.WriteString(headerStyle(LogoText) + "\n\n")
+
+	if len(diagnosis.UnmatchedItems) == 0 {
+		s.WriteString(checkMark.Render() + " All vault items match a recipe\n")
+	} else {
+		s.WriteString(textStyleBold("Vault items without a matching recipe (skipped by `buchhalter sync`):") + "\n\n")
+		for _, item := range diagnosis.UnmatchedItems {
+			s.WriteString(fmt.Sprintf("%s %s (%s)\n", errorMark.Render(), textStyleBold(item.ItemTitle), item.ItemId))
+			if len(item.Urls) == 0 {
+				s.WriteString("   URLs: none\n")
+			} else {
+				s.WriteString("   URLs: " + strings.Join(item.Urls, ", ") + "\n")
+			}
+			for _, supplier := range item.Candidates {
+				s.WriteString(fmt.Sprintf("   Domains of the recipe %s: %s\n", supplier, strings.Join(domainsBySupplier[supplier], ", ")))
+			}
+		}
+		s.WriteString(fmt.Sprintf("\nChange the URL of these items in %s to a domain of their recipe (or pin them to the supplier in `buchhalter_supplier_items`).\n", providerName))
+	}
+
+	s.WriteString("\n")
+	if len(diagnosis.UnmatchedRecipes) == 0 {
+		s.WriteString(checkMark.Render() + " All recipes match a vault item\n")
+		return s.String()
+	}
+	s.WriteString(textStyleBold("Recipes without a matching vault item:") + "\n\n")
+	for _, recipe := range diagnosis.UnmatchedRecipes {
+		s.WriteString(fmt.Sprintf("%s %s: %s\n", inactiveMark.Render(), recipe.Supplier, strings.Join(recipe.Domains, ", ")))
+	}
+
+	return s.String()
+}
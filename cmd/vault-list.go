@@ -4,27 +4,33 @@ import (
 	"fmt"
 	"strings"
 
+	"buchhalter/lib/settings"
+	"buchhalter/lib/vault"
+
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 // vaultListCmd represents the `vault list` command
 var vaultListCmd = &cobra.Command{
 	Use:   "list",
-	Short: "Lists the configured 1Password vaults that are used by buchhalter-cli",
-	Long: `To use a 1Password vault inside buchhalter, you need to configure this.
-This command provides you an overview about the configured 1Password vaults that are used by buchhalter-cli.`,
+	Short: "Lists the configured vaults that are used by buchhalter-cli",
+	Long: `To use a vault inside buchhalter, you need to configure this.
+This command provides you an overview about the configured vaults (and their credential provider) that are used by buchhalter-cli.
+With --provider, only the vaults of this credential provider are listed.`,
 	Run: RunVaultListCommand,
 }
 
 func init() {
+	vaultListCmd.Flags().String("provider", "", "Only list the vaults of this credential provider: 1password, pass, keepass or file")
 	vaultCmd.AddCommand(vaultListCmd)
 }
 
 func RunVaultListCommand(cmd *cobra.Command, args []string) {
+	buchhalterConfig := loadConfig()
+
 	// Init logging
-	buchhalterDirectory := viper.GetString("buchhalter_directory")
-	developmentMode := viper.GetBool("dev")
+	buchhalterDirectory := buchhalterConfig.Directory
+	developmentMode := buchhalterConfig.Dev
 	logSetting, err := cmd.Flags().GetBool("log")
 	if err != nil {
 		exitMessage := fmt.Sprintf("Error reading log flag: %s", err)
@@ -39,22 +45,20 @@ func RunVaultListCommand(cmd *cobra.Command, args []string) {
 	defer logger.Info("Shutting down")
 
 	// Init vaults from configuration
-	credentialProviderVaults := []vaultConfiguration{}
-	if err := viper.UnmarshalKey("credential_provider_vaults", &credentialProviderVaults); err != nil {
-		exitMessage := fmt.Sprintf("Error reading configuration field `credential_provider_vaults`: %s", err)
-		exitWithLogo(exitMessage)
-	}
+	provider := vaultProviderFromFlag(cmd, "")
+	credentialProviderVaults := filterVaultsByProvider(buchhalterConfig.Vaults, provider, buchhalterConfig.CredentialProvider)
 
 	// UI
-	fmt.Printf("%s\n", renderConfiguredVaults(credentialProviderVaults))
+	fmt.Printf("%s\n", renderConfiguredVaults(credentialProviderVaults, buchhalterConfig.CredentialProvider))
 }
 
-func renderConfiguredVaults(vaults []vaultConfiguration) string {
+// renderConfiguredVaults renders the vaults with their credential provider, vaults without a provider are vaults of defaultProvider.
+func renderConfiguredVaults(vaults []settings.Vault, defaultProvider string) string {
 	s := strings.Builder{}
 	s.WriteString(headerStyle(LogoText))
 
 	if len(vaults) > 0 {
-		s.WriteString("\nConfigured 1Password vaults for buchhalter.ai:\n\n")
+		s.WriteString("\nConfigured vaults for buchhalter.ai:\n\n")
 		for _, vault := range vaults {
 			// API Key or not?
 			emojy := inactiveMark.Render()
@@ -62,7 +66,7 @@ func renderConfiguredVaults(vaults []vaultConfiguration) string {
 				emojy = checkMark.Render()
 			}
 
-			s.WriteString(fmt.Sprintf("%s %s", emojy, vault.Name))
+			s.WriteString(fmt.Sprintf("%s %s (%s)", emojy, vault.Name, vaultProviderName(vault, defaultProvider)))
 			if vault.Selected {
 				s.WriteString(textStyleBold(" (currently configured)"))
 			}
@@ -88,3 +92,8 @@ func renderConfiguredVaults(vaults []vaultConfiguration) string {
 
 	return s.String()
 }
+
+// vaultProviderName returns the human readable name of the credential provider of v.
+func vaultProviderName(v settings.Vault, defaultProvider string) string {
+	return vault.GetProviderName(v.ProviderOr(defaultProvider))
+}
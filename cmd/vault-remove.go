@@ -5,6 +5,8 @@ import (
 	"strings"
 	"time"
 
+	"buchhalter/lib/settings"
+
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -20,13 +22,16 @@ This command provides you the tooling to remove a configured vault from buchhalt
 }
 
 func init() {
+	vaultRemoveCmd.Flags().String("vault-id", "", "ID of the configured vault to remove (non-interactive)")
 	vaultCmd.AddCommand(vaultRemoveCmd)
 }
 
 func RunVaultRemoveCommand(cmd *cobra.Command, args []string) {
+	buchhalterConfig := loadConfig()
+
 	// Init logging
-	buchhalterDirectory := viper.GetString("buchhalter_directory")
-	developmentMode := viper.GetBool("dev")
+	buchhalterDirectory := buchhalterConfig.Directory
+	developmentMode := buchhalterConfig.Dev
 	logSetting, err := cmd.Flags().GetBool("log")
 	if err != nil {
 		exitMessage := fmt.Sprintf("Error reading log flag: %s", err)
@@ -41,18 +46,33 @@ func RunVaultRemoveCommand(cmd *cobra.Command, args []string) {
 	defer logger.Info("Shutting down")
 
 	// Init vaults from configuration
-	credentialProviderVaults := []vaultConfiguration{}
-	if err := viper.UnmarshalKey("credential_provider_vaults", &credentialProviderVaults); err != nil {
-		exitMessage := fmt.Sprintf("Error reading configuration field `credential_provider_vaults`: %s", err)
+	credentialProviderVaults := buchhalterConfig.Vaults
+
+	vaultID, err := cmd.Flags().GetString("vault-id")
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error reading vault-id flag: %s", err)
 		exitWithLogo(exitMessage)
 	}
+	if vaultID = strings.TrimSpace(vaultID); len(vaultID) > 0 {
+		existingVault := getVaultFromVaultListByVaultID(credentialProviderVaults, vaultID)
+		if existingVault == nil {
+			exitWithLogo(fmt.Sprintf("Vault `%s` is not configured.", vaultID))
+		}
+		if err := writeVaultConfigurations(buchhalterConfig.ConfigFile, removeVaultFromListByVaultID(credentialProviderVaults, vaultID)); err != nil {
+			exitWithLogo(capitalizeFirstLetter(err.Error()))
+		}
+		logger.Info("Removed vault", "vault_id", existingVault.ID, "vault_name", existingVault.Name)
+		printVaultActionCompleted(fmt.Sprintf("Removed 1Password vault '%s' from buchhalter-cli configuration", existingVault.Name))
+		return
+	}
 
 	viewModel := ViewModelVaultRemove{
 		// UI
 		actionsCompleted: []string{},
 
 		// Vaults
-		vaults: credentialProviderVaults,
+		vaults:     credentialProviderVaults,
+		configFile: buchhalterConfig.ConfigFile,
 
 		// Vault selection
 		showSelection: true,
@@ -73,15 +93,16 @@ type ViewModelVaultRemove struct {
 	actionError      string
 
 	// Vaults
-	vaults []vaultConfiguration
+	vaults     []settings.Vault
+	configFile string
 
 	// Vault selection
 	showSelection   bool
 	selectionCursor int
 }
 
-func removeVaultFromListByVaultID(vaults []vaultConfiguration, vaultID string) []vaultConfiguration {
-	var newVaults []vaultConfiguration
+func removeVaultFromListByVaultID(vaults []settings.Vault, vaultID string) []settings.Vault {
+	var newVaults []settings.Vault
 	for _, vault := range vaults {
 		if vault.ID != vaultID {
 			newVaults = append(newVaults, vault)
@@ -118,9 +139,8 @@ func (m ViewModelVaultRemove) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				vaultName := m.vaults[m.selectionCursor].Name
 
 				vaultsToWriteList := removeVaultFromListByVaultID(m.vaults, vaultID)
-				viper.Set("credential_provider_vaults", vaultsToWriteList)
-				configFile := viper.GetString("buchhalter_config_file")
-				err := viper.WriteConfigAs(configFile)
+				viper.Set(settings.KeyCredentialProviderVaults, vaultsToWriteList)
+				err := viper.WriteConfigAs(m.configFile)
 				if err != nil {
 					return writeConfigFileMsg{
 						vaultName: vaultName,
@@ -5,6 +5,9 @@ import (
 	"strings"
 	"time"
 
+	"buchhalter/lib/settings"
+	"buchhalter/lib/vault"
+
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -13,20 +16,25 @@ import (
 // vaultSelectCmd represents the `vault select` command
 var vaultSelectCmd = &cobra.Command{
 	Use:   "select",
-	Short: "Select the default 1Password vault that should be used with buchhalter-cli",
-	Long: `Your secrets can be organized via vaults inside 1Password. buchhalter-cli is respecting these vaults to only retrieve items from a single vault. To know which vault should be used, the vault need to be selected.
-The chosen Vault name will be stores inside a local configuration for later use`,
+	Short: "Select the default vault that should be used with buchhalter-cli",
+	Long: `Your secrets can be organized via vaults inside your password manager (e.g. 1Password). buchhalter-cli is respecting these vaults to only retrieve items from a single vault. To know which vault should be used, the vault need to be selected.
+The chosen Vault name will be stores inside a local configuration for later use.
+With --provider, only the vaults of this credential provider can be selected.`,
 	Run: RunVaultSelectCommand,
 }
 
 func init() {
+	vaultSelectCmd.Flags().String("vault-id", "", "ID of the configured vault to select as default (non-interactive)")
+	vaultSelectCmd.Flags().String("provider", "", "Only select from the vaults of this credential provider: 1password, pass, keepass or file")
 	vaultCmd.AddCommand(vaultSelectCmd)
 }
 
 func RunVaultSelectCommand(cmd *cobra.Command, args []string) {
+	buchhalterConfig := loadConfig()
+
 	// Init logging
-	buchhalterDirectory := viper.GetString("buchhalter_directory")
-	developmentMode := viper.GetBool("dev")
+	buchhalterDirectory := buchhalterConfig.Directory
+	developmentMode := buchhalterConfig.Dev
 	logSetting, err := cmd.Flags().GetBool("log")
 	if err != nil {
 		exitMessage := fmt.Sprintf("Error reading log flag: %s", err)
@@ -41,18 +49,44 @@ func RunVaultSelectCommand(cmd *cobra.Command, args []string) {
 	defer logger.Info("Shutting down")
 
 	// Init vaults from configuration
-	credentialProviderVaults := []vaultConfiguration{}
-	if err := viper.UnmarshalKey("credential_provider_vaults", &credentialProviderVaults); err != nil {
-		exitMessage := fmt.Sprintf("Error reading configuration field `credential_provider_vaults`: %s", err)
+	credentialProviderVaults := buchhalterConfig.Vaults
+	provider := vaultProviderFromFlag(cmd, "")
+	vaultChoices := filterVaultsByProvider(credentialProviderVaults, provider, buchhalterConfig.CredentialProvider)
+
+	vaultID, err := cmd.Flags().GetString("vault-id")
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error reading vault-id flag: %s", err)
 		exitWithLogo(exitMessage)
 	}
+	if vaultID = strings.TrimSpace(vaultID); len(vaultID) > 0 {
+		existingVault := getVaultFromVaultListByVaultID(vaultChoices, vaultID)
+		if existingVault == nil {
+			if len(provider) > 0 && getVaultFromVaultListByVaultID(credentialProviderVaults, vaultID) != nil {
+				exitWithLogo(fmt.Sprintf("Vault `%s` is no %s vault.", vaultID, vault.GetProviderName(provider)))
+			}
+			exitWithLogo(fmt.Sprintf("Vault `%s` is not configured. Add it via `buchhalter vault add` first.", vaultID))
+		}
+		vaultToWrite := *existingVault
+		vaultToWrite.Selected = true
+		vaultsToWriteList := resetSelectedVaultInVaultConfigList(credentialProviderVaults)
+		vaultsToWriteList = replaceOrAddVaultByIDInVaultConfigList(vaultsToWriteList, vaultToWrite)
+		if err := writeVaultConfigurations(buchhalterConfig.ConfigFile, vaultsToWriteList); err != nil {
+			exitWithLogo(capitalizeFirstLetter(err.Error()))
+		}
+		logger.Info("Selected vault as default", "vault_id", vaultToWrite.ID, "vault_name", vaultToWrite.Name, "provider", vaultToWrite.ProviderOr(buchhalterConfig.CredentialProvider))
+		printVaultActionCompleted(fmt.Sprintf("Configured %s vault '%s' as new default in buchhalter-cli configuration", vaultProviderName(vaultToWrite, buchhalterConfig.CredentialProvider), vaultToWrite.Name))
+		return
+	}
 
 	viewModel := ViewModelVaultSelect{
 		// UI
 		actionsCompleted: []string{},
 
 		// Vaults
-		vaults: credentialProviderVaults,
+		vaults:          credentialProviderVaults,
+		choices:         vaultChoices,
+		defaultProvider: buchhalterConfig.CredentialProvider,
+		configFile:      buchhalterConfig.ConfigFile,
 
 		// Vault selection
 		showSelection: true,
@@ -67,7 +101,7 @@ func RunVaultSelectCommand(cmd *cobra.Command, args []string) {
 	}
 }
 
-func replaceOrAddVaultByIDInVaultConfigList(entries []vaultConfiguration, newVault vaultConfiguration) []vaultConfiguration {
+func replaceOrAddVaultByIDInVaultConfigList(entries []settings.Vault, newVault settings.Vault) []settings.Vault {
 	for i, entry := range entries {
 		if entry.ID == newVault.ID {
 			entries[i] = newVault
@@ -78,7 +112,7 @@ func replaceOrAddVaultByIDInVaultConfigList(entries []vaultConfiguration, newVau
 	return append(entries, newVault)
 }
 
-func resetSelectedVaultInVaultConfigList(entries []vaultConfiguration) []vaultConfiguration {
+func resetSelectedVaultInVaultConfigList(entries []settings.Vault) []settings.Vault {
 	for i := range entries {
 		entries[i].Selected = false
 	}
@@ -91,8 +125,11 @@ type ViewModelVaultSelect struct {
 	actionsCompleted []string
 	actionError      string
 
-	// Vaults
-	vaults []vaultConfiguration
+	// Vaults (choices are the vaults of the `--provider` flag)
+	vaults          []settings.Vault
+	choices         []settings.Vault
+	defaultProvider string
+	configFile      string
 
 	// Vault selection
 	showSelection   bool
@@ -121,29 +158,23 @@ func (m ViewModelVaultSelect) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return m, nil
 			}
 
-			selectedVaultName := m.vaults[m.selectionCursor].Name
+			selectedVaultName := m.choices[m.selectionCursor].Name
 
 			// Deactivate selection
 			m.showSelection = false
 			m.actionsCompleted = append(m.actionsCompleted, fmt.Sprintf("Selected vault `%s` to mark as new default in buchhalter-cli configuration", selectedVaultName))
 
 			return m, func() tea.Msg {
-				vaultID := m.vaults[m.selectionCursor].ID
-				vaultName := m.vaults[m.selectionCursor].Name
-
-				vaultToWrite := vaultConfiguration{
-					ID:               vaultID,
-					Name:             vaultName,
-					BuchhalterAPIKey: m.vaults[m.selectionCursor].BuchhalterAPIKey,
-					Selected:         true,
-				}
+				vaultName := m.choices[m.selectionCursor].Name
+
+				vaultToWrite := m.choices[m.selectionCursor]
+				vaultToWrite.Selected = true
 
 				vaultsToWriteList := resetSelectedVaultInVaultConfigList(m.vaults)
 				vaultsToWriteList = replaceOrAddVaultByIDInVaultConfigList(vaultsToWriteList, vaultToWrite)
 
-				viper.Set("credential_provider_vaults", vaultsToWriteList)
-				configFile := viper.GetString("buchhalter_config_file")
-				err := viper.WriteConfigAs(configFile)
+				viper.Set(settings.KeyCredentialProviderVaults, vaultsToWriteList)
+				err := viper.WriteConfigAs(m.configFile)
 				if err != nil {
 					return writeConfigFileMsg{
 						vaultName: vaultName,
@@ -160,7 +191,7 @@ func (m ViewModelVaultSelect) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 
 			m.selectionCursor++
-			if m.selectionCursor >= len(m.vaults) {
+			if m.selectionCursor >= len(m.choices) {
 				m.selectionCursor = 0
 			}
 
@@ -172,7 +203,7 @@ func (m ViewModelVaultSelect) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 			m.selectionCursor--
 			if m.selectionCursor < 0 {
-				m.selectionCursor = len(m.vaults) - 1
+				m.selectionCursor = len(m.choices) - 1
 			}
 		}
 
@@ -182,13 +213,13 @@ func (m ViewModelVaultSelect) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, tea.Quit
 		}
 
-		m.actionsCompleted = append(m.actionsCompleted, fmt.Sprintf("Configured 1Password vault '%s' as new default in buchhalter-cli configuration", msg.vaultName))
+		m.actionsCompleted = append(m.actionsCompleted, fmt.Sprintf("Configured %s vault '%s' as new default in buchhalter-cli configuration", vaultProviderName(m.choices[m.selectionCursor], m.defaultProvider), msg.vaultName))
 		return m, tea.Quit
 	}
 
 	// If we don't have any vaults, we quit
 	// Why sleeping at all? Because we want to output the "No vaults for buchhalter configured yet." message
-	if len(m.vaults) == 0 {
+	if len(m.choices) == 0 {
 		return m, func() tea.Msg {
 			time.Sleep(100 * time.Millisecond)
 			return tea.QuitMsg{}
@@ -210,13 +241,13 @@ func (m ViewModelVaultSelect) View() string {
 		s.WriteString(errorMark.Render() + " " + textStyleBold(capitalizeFirstLetter(m.actionError)) + "\n")
 	}
 
-	if m.showSelection && len(m.vaults) > 0 {
+	if m.showSelection && len(m.choices) > 0 {
 		s.WriteString("The following vaults have been found in the buchhalter.ai configuration.\n")
 		s.WriteString("Select the one you want to select as a new default vault and press ENTER:\n\n")
 
-		for i := 0; i < len(m.vaults); i++ {
+		for i := 0; i < len(m.choices); i++ {
 			currentConfigValue := ""
-			if m.vaults[i].Selected {
+			if m.choices[i].Selected {
 				currentConfigValue = textStyleBold(" (currently set as default)")
 			}
 			if m.selectionCursor == i {
@@ -224,13 +255,13 @@ func (m ViewModelVaultSelect) View() string {
 			} else {
 				s.WriteString("( ) ")
 			}
-			s.WriteString(m.vaults[i].Name)
+			s.WriteString(fmt.Sprintf("%s (%s)", m.choices[i].Name, vaultProviderName(m.choices[i], m.defaultProvider)))
 			s.WriteString(currentConfigValue)
 			s.WriteString("\n")
 		}
 	}
 
-	if len(m.vaults) == 0 {
+	if len(m.choices) == 0 {
 		s.WriteString(textStyleBold("No vaults for buchhalter configured yet.\nUse `buchhalter vault add` to add a new vault for buchhalter.\n"))
 	} else {
 		s.WriteString("\n(press q to quit)\n")
@@ -1,11 +1,23 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"strings"
 
+	"buchhalter/lib/settings"
+	"buchhalter/lib/vault"
+
+	"github.com/charmbracelet/x/term"
+	"github.com/mattn/go-isatty"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
+// keePassPasswordEnv is the environment variable with the passphrase of the KeePass database (e.g. for scheduled runs).
+const keePassPasswordEnv = "BUCHHALTER_KEEPASS_PASSWORD"
+
 // vaultCmd represents the vault command
 var vaultCmd = &cobra.Command{
 	Use:   "vault",
@@ -19,3 +31,118 @@ var vaultCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(vaultCmd)
 }
+
+// writeVaultConfigurations writes the vault configurations into configFile.
+func writeVaultConfigurations(configFile string, vaults []settings.Vault) error {
+	viper.Set(settings.KeyCredentialProviderVaults, vaults)
+	if err := viper.WriteConfigAs(configFile); err != nil {
+		return fmt.Errorf("error writing config file %s: %w", configFile, err)
+	}
+	return nil
+}
+
+// vaultProviderFromFlag returns the credential provider of the `--provider` flag, defaultProvider without the flag.
+func vaultProviderFromFlag(cmd *cobra.Command, defaultProvider string) string {
+	provider, err := cmd.Flags().GetString("provider")
+	if err != nil {
+		exitMessage := fmt.Sprintf("Error reading provider flag: %s", err)
+		exitWithLogo(exitMessage)
+	}
+	if provider = strings.TrimSpace(provider); len(provider) == 0 {
+		return defaultProvider
+	}
+	if !vault.IsSupportedProvider(provider) {
+		exitMessage := fmt.Sprintf("Credential provider `%s` is not supported (supported: %s, %s, %s, %s)", provider, vault.PROVIDER_1PASSWORD, vault.PROVIDER_PASS, vault.PROVIDER_KEEPASS, vault.PROVIDER_FILE)
+		exitWithLogo(exitMessage)
+	}
+	return provider
+}
+
+// vaultProviderBinary returns the CLI command of provider, `credential_provider_cli_command` is only used for the configured provider.
+func vaultProviderBinary(buchhalterConfig *settings.Config, provider string) string {
+	if provider == buchhalterConfig.CredentialProvider {
+		return buchhalterConfig.CredentialProviderCliCommand
+	}
+	return ""
+}
+
+// filterVaultsByProvider returns the vaults of provider, vaults without a provider are vaults of defaultProvider.
+// Without a provider, all vaults are returned.
+func filterVaultsByProvider(vaults []settings.Vault, provider, defaultProvider string) []settings.Vault {
+	if len(provider) == 0 {
+		return vaults
+	}
+	filtered := []settings.Vault{}
+	for _, v := range vaults {
+		if v.ProviderOr(defaultProvider) == provider {
+			filtered = append(filtered, v)
+		}
+	}
+	return filtered
+}
+
+// profileVault returns the vault of the profile (`--profile`), nil without a profile or a vault of the profile.
+// It exits, if the vault of the profile is not configured.
+func profileVault(buchhalterConfig *settings.Config) *settings.Vault {
+	if buchhalterConfig.Profile == nil || len(strings.TrimSpace(buchhalterConfig.Profile.Vault)) == 0 {
+		return nil
+	}
+	selectedVault := buchhalterConfig.Profile.FindVault(buchhalterConfig.Vaults)
+	if selectedVault == nil {
+		exitWithLogo(fmt.Sprintf("No vault configuration found for `%s` of profile `%s`. Please run `buchhalter vault list` to see all configured vaults.", buchhalterConfig.Profile.Vault, buchhalterConfig.Profile.Name))
+	}
+	return selectedVault
+}
+
+// applyProfileToVault returns selectedVault with the team and the API key of the profile (`--profile`).
+func applyProfileToVault(buchhalterConfig *settings.Config, selectedVault *settings.Vault) *settings.Vault {
+	if buchhalterConfig.Profile == nil {
+		return selectedVault
+	}
+	profiledVault, err := buchhalterConfig.Profile.ApplyToVault(*selectedVault, os.LookupEnv)
+	if err != nil {
+		exitWithLogo(capitalizeFirstLetter(err.Error()))
+	}
+	return &profiledVault
+}
+
+// printVaultActionCompleted prints the result of a non-interactive vault command.
+func printVaultActionCompleted(message string) {
+	fmt.Println(headerStyle(LogoText) + "\n")
+	fmt.Println(checkMark.Render() + " " + textStyleBold(message))
+}
+
+// readKeePassConfig reads the configuration of the KeePass database.
+// The passphrase is read from BUCHHALTER_KEEPASS_PASSWORD or prompted on the terminal (without echo), it is never stored.
+// Without a terminal, a key file is required if the environment variable is not set.
+// It must be called before the bubbletea program starts, the program owns the terminal afterwards.
+func readKeePassConfig(buchhalterConfig *settings.Config) (vault.KeePassConfig, error) {
+	keePassConfig := vault.KeePassConfig{
+		File:    strings.TrimSpace(buchhalterConfig.CredentialProviderKeePassFile),
+		KeyFile: strings.TrimSpace(buchhalterConfig.CredentialProviderKeePassKeyFile),
+	}
+	if len(keePassConfig.File) == 0 {
+		return keePassConfig, errors.New("no KeePass database configured, set `credential_provider_keepass_file` to the path of your .kdbx file")
+	}
+
+	if password, ok := os.LookupEnv(keePassPasswordEnv); ok {
+		keePassConfig.Password = password
+		return keePassConfig, nil
+	}
+	if !isatty.IsTerminal(os.Stdin.Fd()) {
+		if len(keePassConfig.KeyFile) > 0 {
+			return keePassConfig, nil
+		}
+		return keePassConfig, fmt.Errorf("no terminal to prompt for the passphrase of the KeePass database, set %s", keePassPasswordEnv)
+	}
+
+	fmt.Fprintf(os.Stderr, "Passphrase for KeePass database %s: ", keePassConfig.File)
+	password, err := term.ReadPassword(os.Stdin.Fd())
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return keePassConfig, fmt.Errorf("error reading passphrase of the KeePass database: %w", err)
+	}
+	keePassConfig.Password = string(password)
+
+	return keePassConfig, nil
+}
@@ -9,14 +9,67 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"time"
 )
 
+// Layouts of the document archive
+const (
+	// LayoutSupplier stores all documents directly in the supplier directory (<supplier>/<file>)
+	LayoutSupplier = "supplier"
+	// LayoutSupplierYear stores documents by supplier and year (<supplier>/<YYYY>/<file>)
+	LayoutSupplierYear = "supplier/year"
+	// LayoutYearSupplier stores documents by year and supplier (<YYYY>/<supplier>/<file>)
+	LayoutYearSupplier = "year/supplier"
+	// LayoutSupplierYearMonth stores documents by supplier, year and month (<supplier>/<YYYY>/<MM>/<file>)
+	LayoutSupplierYearMonth = "supplier/year/month"
+)
+
+// layoutAliases are former names of the layouts, still accepted in the configuration
+var layoutAliases = map[string]string{
+	"flat":       LayoutSupplier,
+	"year":       LayoutSupplierYear,
+	"year-month": LayoutSupplierYearMonth,
+}
+
+// Layouts are all supported layouts of the document archive
+var Layouts = []string{LayoutSupplier, LayoutSupplierYear, LayoutYearSupplier, LayoutSupplierYearMonth}
+
+var yearDirectoryPattern = regexp.MustCompile(`^\d{4}$`)
+
+// monthDirectoryPattern matches the month directories of the `supplier/year/month` layout
+var monthDirectoryPattern = regexp.MustCompile(`^(0[1-9]|1[0-2])$`)
+
+// Scopes of the deduplication of downloaded documents (`buchhalter_dedup_scope`)
+const (
+	// DedupScopeGlobal skips a downloaded document if it exists anywhere in the archive, also for another supplier
+	DedupScopeGlobal = "global"
+	// DedupScopeSupplier skips a downloaded document only if it exists for the same supplier
+	DedupScopeSupplier = "supplier"
+)
+
+// DedupScopes are all supported scopes of the deduplication
+var DedupScopes = []string{DedupScopeGlobal, DedupScopeSupplier}
+
 type DocumentArchive struct {
 	logger *slog.Logger
 
 	storageDirectory string
+	layout           string
 	fileIndex        map[string]File
+
+	// mergedPartHashes are the hashes of documents that were merged into another document and removed afterwards.
+	// They are known to the archive (to not download them again), but not part of the file index.
+	mergedPartHashes map[string]string
+	// prunedHashes are the hashes of documents removed by Prune, they are known to the archive like the merged parts
+	prunedHashes map[string]string
+
+	dedupScope string
+	// supplierHashes are the hashes of the documents of each supplier, the file index only has one document per hash
+	supplierHashes map[string]map[string]bool
+	// crossSupplierDuplicates are the downloaded documents that exist for another supplier
+	crossSupplierDuplicates []CrossSupplierDuplicate
 }
 
 type File struct {
@@ -24,13 +77,103 @@ type File struct {
 	Supplier string
 }
 
-func NewDocumentArchive(logger *slog.Logger, archiveDirectory string) *DocumentArchive {
+// CrossSupplierDuplicate is a downloaded document of Supplier that exists in the archive for another supplier already.
+// File is the name of the downloaded document, Existing the document in the archive.
+// With the dedup scope `global`, the downloaded document was skipped.
+type CrossSupplierDuplicate struct {
+	Supplier string
+	File     string
+	Existing File
+}
+
+func NewDocumentArchive(logger *slog.Logger, archiveDirectory, layout string) *DocumentArchive {
+	if alias, ok := layoutAliases[layout]; ok {
+		layout = alias
+	}
+	if !IsSupportedLayout(layout) {
+		layout = LayoutSupplier
+	}
+
 	return &DocumentArchive{
 		logger:           logger,
 		storageDirectory: archiveDirectory,
+		layout:           layout,
+
+		fileIndex:        map[string]File{},
+		mergedPartHashes: map[string]string{},
+		prunedHashes:     map[string]string{},
+
+		dedupScope:              DedupScopeGlobal,
+		supplierHashes:          map[string]map[string]bool{},
+		crossSupplierDuplicates: []CrossSupplierDuplicate{},
+	}
+}
+
+// IsSupportedDedupScope returns true if scope is a known scope of the deduplication.
+func IsSupportedDedupScope(scope string) bool {
+	for _, supportedScope := range DedupScopes {
+		if scope == supportedScope {
+			return true
+		}
+	}
+	return false
+}
+
+// SetDedupScope sets the scope of DocumentExists, unsupported scopes are ignored (the default is DedupScopeGlobal).
+func (a *DocumentArchive) SetDedupScope(scope string) {
+	if IsSupportedDedupScope(scope) {
+		a.dedupScope = scope
+	}
+}
+
+// DedupScope returns the scope of the deduplication.
+func (a *DocumentArchive) DedupScope() string {
+	return a.dedupScope
+}
+
+// IsSupportedLayout returns true if layout is a known document layout (or a former name of one).
+func IsSupportedLayout(layout string) bool {
+	if _, ok := layoutAliases[layout]; ok {
+		return true
+	}
+	for _, supportedLayout := range Layouts {
+		if layout == supportedLayout {
+			return true
+		}
+	}
+	return false
+}
+
+// Layout returns the layout of the archive.
+func (a *DocumentArchive) Layout() string {
+	return a.layout
+}
+
+// DocumentDirectory returns the directory where a document of supplier dated documentTime is stored.
+// The directory is created if it doesn't exist.
+//
+// Right now, documentTime is the modification time of the downloaded file.
+func (a *DocumentArchive) DocumentDirectory(supplier string, documentTime time.Time) (string, error) {
+	documentDirectory := documentDirectoryForLayout(a.layout, a.storageDirectory, supplier, documentTime)
+	if err := os.MkdirAll(documentDirectory, os.ModePerm); err != nil {
+		return "", fmt.Errorf("error creating document directory %s: %w", documentDirectory, err)
+	}
+
+	return documentDirectory, nil
+}
 
-		fileIndex: map[string]File{},
+func documentDirectoryForLayout(layout, storageDirectory, supplier string, documentTime time.Time) string {
+	year := documentTime.Format("2006")
+	switch layout {
+	case LayoutSupplierYear:
+		return filepath.Join(storageDirectory, supplier, year)
+	case LayoutYearSupplier:
+		return filepath.Join(storageDirectory, year, supplier)
+	case LayoutSupplierYearMonth:
+		return filepath.Join(storageDirectory, supplier, year, documentTime.Format("01"))
 	}
+
+	return filepath.Join(storageDirectory, supplier)
 }
 
 func (a *DocumentArchive) BuildArchiveIndex() error {
@@ -47,16 +190,22 @@ func (a *DocumentArchive) BuildArchiveIndex() error {
 			return nil
 		}
 
+		// Merge manifests contain the hashes of removed documents
+		if !info.IsDir() && info.Name() == mergeManifestFileName {
+			return a.loadMergeManifest(filePath)
+		}
+		// The prune manifest contains the hashes of pruned documents
+		if !info.IsDir() && info.Name() == pruneManifestFileName {
+			return a.loadPruneManifest(filePath)
+		}
+
 		// Exclude directories, hidden files and log files
 		if !info.IsDir() && info.Name()[0:1] != "_" && info.Name()[0:1] != "." && path.Ext(info.Name()) != ".log" {
 			hash, err := computeHash(filePath)
 			if err != nil {
 				return fmt.Errorf("error computing hash for %s: %w", filePath, err)
 			}
-			a.fileIndex[hash] = File{
-				Path:     filePath,
-				Supplier: a.determineSupplierFromPath(filePath),
-			}
+			a.indexFile(hash, filePath)
 		}
 		return nil
 	})
@@ -74,6 +223,45 @@ func (a *DocumentArchive) FileExists(filePath string) bool {
 	return a.fileHashExists(hash)
 }
 
+// DocumentExists returns true if the document filePath downloaded for supplier exists in the archive.
+// With the dedup scope `global`, the documents of all suppliers are checked, with `supplier` only the documents of supplier.
+// A document that exists for another supplier is recorded as cross-supplier duplicate (see CrossSupplierDuplicates).
+func (a *DocumentArchive) DocumentExists(filePath, supplier string) bool {
+	hash, _ := computeHash(filePath)
+	if !a.fileHashExists(hash) {
+		return false
+	}
+	if a.supplierHashes[supplier][hash] {
+		return true
+	}
+
+	existing, ok := a.fileIndex[hash]
+	if !ok {
+		// Merged and pruned documents are only known by their hash
+		knownFile, merged := a.mergedPartHashes[hash]
+		if !merged {
+			knownFile = a.prunedHashes[hash]
+		}
+		existing = File{Path: knownFile, Supplier: a.determineSupplierFromPath(knownFile)}
+	}
+	if existing.Supplier == supplier {
+		return true
+	}
+	a.crossSupplierDuplicates = append(a.crossSupplierDuplicates, CrossSupplierDuplicate{
+		Supplier: supplier,
+		File:     filepath.Base(filePath),
+		Existing: existing,
+	})
+	a.logger.Info("Downloaded document exists for another supplier", "supplier", supplier, "file", filePath, "existing_file", existing.Path, "existing_supplier", existing.Supplier, "dedup_scope", a.dedupScope)
+
+	return a.dedupScope == DedupScopeGlobal
+}
+
+// CrossSupplierDuplicates returns the downloaded documents that exist for another supplier (see DocumentExists).
+func (a *DocumentArchive) CrossSupplierDuplicates() []CrossSupplierDuplicate {
+	return a.crossSupplierDuplicates
+}
+
 func (a *DocumentArchive) AddFile(filePath string) error {
 	// Right now, we overwrite the file if it exists already
 	// if a.fileHashExists(filePath) {
@@ -85,11 +273,35 @@ func (a *DocumentArchive) AddFile(filePath string) error {
 		return err
 	}
 
+	a.indexFile(hash, filePath)
+	return nil
+}
+
+func (a *DocumentArchive) indexFile(hash, filePath string) {
+	supplier := a.determineSupplierFromPath(filePath)
 	a.fileIndex[hash] = File{
 		Path:     filePath,
-		Supplier: a.determineSupplierFromPath(filePath),
+		Supplier: supplier,
 	}
-	return nil
+	if _, ok := a.supplierHashes[supplier]; !ok {
+		a.supplierHashes[supplier] = map[string]bool{}
+	}
+	a.supplierHashes[supplier][hash] = true
+}
+
+// RemoveFile removes all index entries of filePath, e.g. if the file was replaced or deleted.
+func (a *DocumentArchive) RemoveFile(filePath string) {
+	for hash, file := range a.fileIndex {
+		if file.Path == filePath {
+			delete(a.fileIndex, hash)
+			delete(a.supplierHashes[file.Supplier], hash)
+		}
+	}
+}
+
+// ComputeHash returns the hash the archive uses to identify the document filePath.
+func ComputeHash(filePath string) (string, error) {
+	return computeHash(filePath)
 }
 
 func computeHash(filePath string) (string, error) {
@@ -130,6 +342,12 @@ func (a *DocumentArchive) fileHashExists(hash string) bool {
 	if _, ok := a.fileIndex[hash]; ok {
 		return true
 	}
+	if _, ok := a.mergedPartHashes[hash]; ok {
+		return true
+	}
+	if _, ok := a.prunedHashes[hash]; ok {
+		return true
+	}
 
 	return false
 }
@@ -138,8 +356,52 @@ func (a *DocumentArchive) GetFileIndex() map[string]File {
 	return a.fileIndex
 }
 
+// LatestDocumentTime returns the modification time of the newest document of supplier in the archive.
+// It returns false, if the archive contains no document of supplier.
+func (a *DocumentArchive) LatestDocumentTime(supplier string) (time.Time, bool) {
+	var latest time.Time
+	found := false
+	for _, file := range a.fileIndex {
+		if file.Supplier != supplier {
+			continue
+		}
+		fileInfo, err := os.Stat(file.Path)
+		if err != nil {
+			continue
+		}
+		if !found || fileInfo.ModTime().After(latest) {
+			latest = fileInfo.ModTime()
+			found = true
+		}
+	}
+
+	return latest, found
+}
+
+// determineSupplierFromPath returns the supplier of a document, based on its path relative to the storage directory.
+// The supplier is the first directory below the storage directory, independent of the depth of further directories.
+// Only a document in the position of the `year/supplier` layout (a year directory with a directory below it, that is neither a year nor a month)
+// skips the year, e.g. `2024/2023` is the year 2023 of the supplier `2024`, unless the archive uses the `year/supplier` layout.
+// The detection is otherwise independent of the configured layout, because the archive
+// can contain documents of several layouts (e.g. after switching the layout).
 func (a *DocumentArchive) determineSupplierFromPath(filePath string) string {
-	p := path.Dir(filePath)
-	_, file := filepath.Split(p)
-	return file
+	relativePath, err := filepath.Rel(a.storageDirectory, filePath)
+	if err != nil || relativePath == ".." || strings.HasPrefix(relativePath, ".."+string(os.PathSeparator)) {
+		// Documents outside of the storage directory are assigned by their directory
+		return filepath.Base(filepath.Dir(filePath))
+	}
+
+	directories := strings.Split(filepath.ToSlash(filepath.Dir(relativePath)), "/")
+	if directories[0] == "." {
+		// Documents directly in the storage directory don't belong to a supplier
+		return ""
+	}
+	if len(directories) == 2 && yearDirectoryPattern.MatchString(directories[0]) {
+		nestedDate := yearDirectoryPattern.MatchString(directories[1]) || monthDirectoryPattern.MatchString(directories[1])
+		if a.layout == LayoutYearSupplier || !nestedDate {
+			return directories[1]
+		}
+	}
+
+	return directories[0]
 }
@@ -0,0 +1,192 @@
+package archive
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDocumentDirectory(t *testing.T) {
+	documentTime := time.Date(2024, time.March, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		layout   string
+		expected string
+	}{
+		{LayoutSupplier, "aws"},
+		{LayoutSupplierYear, filepath.Join("aws", "2024")},
+		{LayoutYearSupplier, filepath.Join("2024", "aws")},
+		{LayoutSupplierYearMonth, filepath.Join("aws", "2024", "03")},
+		// Former names of the layouts
+		{"flat", "aws"},
+		{"year", filepath.Join("aws", "2024")},
+		{"year-month", filepath.Join("aws", "2024", "03")},
+		{"unknown", "aws"},
+	}
+
+	for _, test := range tests {
+		storageDirectory := t.TempDir()
+		a := NewDocumentArchive(slog.Default(), storageDirectory, test.layout)
+
+		documentDirectory, err := a.DocumentDirectory("aws", documentTime)
+		if err != nil {
+			t.Errorf("%s: DocumentDirectory() returned error: %s", test.layout, err)
+			continue
+		}
+		if expected := filepath.Join(storageDirectory, test.expected); documentDirectory != expected {
+			t.Errorf("%s: DocumentDirectory() = %s; want %s", test.layout, documentDirectory, expected)
+		}
+
+		// Documents stored in the layout are assigned to their supplier again
+		if supplier := a.determineSupplierFromPath(filepath.Join(documentDirectory, "invoice.pdf")); supplier != "aws" {
+			t.Errorf("%s: determineSupplierFromPath() = %s; want aws", test.layout, supplier)
+		}
+	}
+}
+
+func TestDetermineSupplierFromPath(t *testing.T) {
+	tests := []struct {
+		filePath string
+		expected string
+	}{
+		// Flat layout
+		{"/documents/aws/invoice.pdf", "aws"},
+		// Nested layouts
+		{"/documents/aws/2024/invoice.pdf", "aws"},
+		{"/documents/aws/2024/03/invoice.pdf", "aws"},
+		{"/documents/2024/aws/invoice.pdf", "aws"},
+		{"/documents/aws/03/invoice.pdf", "aws"},
+		{"/documents/aws/2024/Q1/statements/invoice.pdf", "aws"},
+		// Suppliers named like a year keep their name in the supplier layouts
+		{"/documents/2024/invoice.pdf", "2024"},
+		{"/documents/2024/2023/invoice.pdf", "2024"},
+		{"/documents/2024/2023/03/invoice.pdf", "2024"},
+		{"/documents/2024/03/invoice.pdf", "2024"},
+		{"/documents/1und1/2024/invoice.pdf", "1und1"},
+		// Documents without supplier directory or outside of the archive
+		{"/documents/invoice.pdf", ""},
+		{"/elsewhere/hetzner/invoice.pdf", "hetzner"},
+	}
+
+	a := NewDocumentArchive(slog.Default(), "/documents", LayoutSupplier)
+	for _, test := range tests {
+		if supplier := a.determineSupplierFromPath(test.filePath); supplier != test.expected {
+			t.Errorf("determineSupplierFromPath(%s) = %s; want %s", test.filePath, supplier, test.expected)
+		}
+	}
+
+	// With the `year/supplier` layout, the second directory is the supplier, even if it is named like a year
+	a = NewDocumentArchive(slog.Default(), "/documents", LayoutYearSupplier)
+	if supplier := a.determineSupplierFromPath("/documents/2024/2023/invoice.pdf"); supplier != "2023" {
+		t.Errorf("determineSupplierFromPath() with layout %s = %s; want 2023", LayoutYearSupplier, supplier)
+	}
+}
+
+func TestLatestDocumentTime(t *testing.T) {
+	storageDirectory := t.TempDir()
+	a := NewDocumentArchive(slog.Default(), storageDirectory, LayoutSupplier)
+
+	documents := []struct {
+		path    string
+		modTime time.Time
+	}{
+		{filepath.Join(storageDirectory, "aws", "invoice-1.pdf"), time.Date(2024, time.January, 10, 0, 0, 0, 0, time.UTC)},
+		{filepath.Join(storageDirectory, "aws", "invoice-2.pdf"), time.Date(2024, time.March, 10, 0, 0, 0, 0, time.UTC)},
+		{filepath.Join(storageDirectory, "hetzner", "invoice.pdf"), time.Date(2024, time.May, 10, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, document := range documents {
+		if err := os.MkdirAll(filepath.Dir(document.path), 0755); err != nil {
+			t.Fatalf("error creating directory: %s", err)
+		}
+		if err := os.WriteFile(document.path, []byte(document.path), 0644); err != nil {
+			t.Fatalf("error writing document: %s", err)
+		}
+		if err := os.Chtimes(document.path, document.modTime, document.modTime); err != nil {
+			t.Fatalf("error setting modification time: %s", err)
+		}
+	}
+	if err := a.BuildArchiveIndex(); err != nil {
+		t.Fatalf("BuildArchiveIndex() returned error: %s", err)
+	}
+
+	if latest, ok := a.LatestDocumentTime("aws"); !ok || !latest.Equal(documents[1].modTime) {
+		t.Errorf("LatestDocumentTime(aws) = %s, %t; want %s", latest, ok, documents[1].modTime)
+	}
+	if _, ok := a.LatestDocumentTime("digitalocean"); ok {
+		t.Errorf("LatestDocumentTime(digitalocean) found a document; want none")
+	}
+}
+
+func TestDocumentExistsDedupScope(t *testing.T) {
+	tests := []struct {
+		scope             string
+		expectedAWS       bool
+		expectedDuplicate bool
+	}{
+		{DedupScopeGlobal, true, true},
+		{DedupScopeSupplier, false, true},
+	}
+
+	for _, test := range tests {
+		storageDirectory := t.TempDir()
+		if err := os.MkdirAll(filepath.Join(storageDirectory, "hetzner"), 0755); err != nil {
+			t.Fatalf("error creating directory: %s", err)
+		}
+		if err := os.WriteFile(filepath.Join(storageDirectory, "hetzner", "invoice.pdf"), []byte("invoice"), 0644); err != nil {
+			t.Fatalf("error writing document: %s", err)
+		}
+		a := NewDocumentArchive(slog.Default(), storageDirectory, LayoutSupplier)
+		a.SetDedupScope(test.scope)
+		if err := a.BuildArchiveIndex(); err != nil {
+			t.Fatalf("BuildArchiveIndex() returned error: %s", err)
+		}
+
+		// The same invoice downloaded for two suppliers, and a new invoice
+		downloadsDirectory := t.TempDir()
+		download := filepath.Join(downloadsDirectory, "download.pdf")
+		if err := os.WriteFile(download, []byte("invoice"), 0644); err != nil {
+			t.Fatalf("error writing download: %s", err)
+		}
+		newDownload := filepath.Join(downloadsDirectory, "new.pdf")
+		if err := os.WriteFile(newDownload, []byte("new invoice"), 0644); err != nil {
+			t.Fatalf("error writing download: %s", err)
+		}
+
+		if !a.DocumentExists(download, "hetzner") {
+			t.Errorf("%s: DocumentExists() for the same supplier = false; want true", test.scope)
+		}
+		if exists := a.DocumentExists(download, "aws"); exists != test.expectedAWS {
+			t.Errorf("%s: DocumentExists() for another supplier = %t; want %t", test.scope, exists, test.expectedAWS)
+		}
+		if a.DocumentExists(newDownload, "aws") {
+			t.Errorf("%s: DocumentExists() of a new document = true; want false", test.scope)
+		}
+
+		duplicates := a.CrossSupplierDuplicates()
+		if len(duplicates) != 1 {
+			t.Fatalf("%s: CrossSupplierDuplicates() = %+v; want one duplicate", test.scope, duplicates)
+		}
+		if duplicates[0].Supplier != "aws" || duplicates[0].File != "download.pdf" || duplicates[0].Existing.Supplier != "hetzner" {
+			t.Errorf("%s: CrossSupplierDuplicates() = %+v; want the download of aws existing for hetzner", test.scope, duplicates[0])
+		}
+
+		// With the supplier scope, the document is stored for both suppliers
+		if test.scope == DedupScopeSupplier {
+			stored := filepath.Join(storageDirectory, "aws", "invoice.pdf")
+			if err := os.MkdirAll(filepath.Dir(stored), 0755); err != nil {
+				t.Fatalf("error creating directory: %s", err)
+			}
+			if err := os.WriteFile(stored, []byte("invoice"), 0644); err != nil {
+				t.Fatalf("error writing document: %s", err)
+			}
+			if err := a.AddFile(stored); err != nil {
+				t.Fatalf("AddFile() returned error: %s", err)
+			}
+			if !a.DocumentExists(download, "aws") || !a.DocumentExists(download, "hetzner") {
+				t.Errorf("%s: DocumentExists() after storing for aws = false; want true for both suppliers", test.scope)
+			}
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package archive
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"buchhalter/lib/utils"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+)
+
+// DuplicateGroup are documents of a supplier with different bytes, but (likely) the same content.
+// E.g. the same invoice downloaded twice with a different creation date in its metadata.
+type DuplicateGroup struct {
+	Supplier string   `json:"supplier"`
+	Files    []string `json:"files"`
+}
+
+// FindContentDuplicates returns groups of indexed PDF documents with the same page content.
+// The detection is best-effort: Documents that can't be parsed are skipped and nothing is deleted.
+func (a *DocumentArchive) FindContentDuplicates() []DuplicateGroup {
+	filesByFingerprint := map[string][]File{}
+	for _, file := range a.fileIndex {
+		if strings.ToLower(filepath.Ext(file.Path)) != ".pdf" {
+			continue
+		}
+
+		fingerprint, err := ContentFingerprint(file.Path)
+		if err != nil {
+			a.logger.Debug("Skipping document in duplicate detection", "file", file.Path, "error", err)
+			continue
+		}
+		if len(fingerprint) == 0 {
+			continue
+		}
+
+		key := file.Supplier + "/" + fingerprint
+		filesByFingerprint[key] = append(filesByFingerprint[key], file)
+	}
+
+	duplicates := []DuplicateGroup{}
+	for _, files := range filesByFingerprint {
+		if len(files) < 2 {
+			continue
+		}
+
+		group := DuplicateGroup{Supplier: files[0].Supplier}
+		for _, file := range files {
+			group.Files = append(group.Files, file.Path)
+		}
+		sort.Strings(group.Files)
+		duplicates = append(duplicates, group)
+	}
+	sort.Slice(duplicates, func(i, j int) bool {
+		return duplicates[i].Files[0] < duplicates[j].Files[0]
+	})
+
+	return duplicates
+}
+
+// ContentFingerprint returns a hash of the (whitespace normalized) page contents of the PDF document filePath.
+// Metadata like the creation date or the document ID is not part of the fingerprint.
+// The fingerprint is empty if the document has no page content.
+func ContentFingerprint(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	ctx, err := api.ReadContext(f, utils.PDFConfiguration())
+	if err != nil {
+		return "", fmt.Errorf("error reading PDF document %s: %w", filePath, err)
+	}
+	if err := ctx.EnsurePageCount(); err != nil {
+		return "", fmt.Errorf("error reading pages of PDF document %s: %w", filePath, err)
+	}
+
+	hash := sha256.New()
+	hasContent := false
+	for pageNr := 1; pageNr <= ctx.PageCount; pageNr++ {
+		content, err := pdfcpu.ExtractPageContent(ctx, pageNr)
+		if err != nil {
+			return "", fmt.Errorf("error extracting page %d of PDF document %s: %w", pageNr, filePath, err)
+		}
+		data, err := io.ReadAll(content)
+		if err != nil {
+			return "", fmt.Errorf("error extracting page %d of PDF document %s: %w", pageNr, filePath, err)
+		}
+
+		normalized := strings.Join(strings.Fields(string(data)), " ")
+		if len(normalized) > 0 {
+			hasContent = true
+		}
+		fmt.Fprintf(hash, "page %d\n%s\n", pageNr, normalized)
+	}
+	if !hasContent {
+		return "", nil
+	}
+
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
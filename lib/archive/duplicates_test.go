@@ -0,0 +1,117 @@
+package archive
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestPDF writes a single page PDF document showing text, with creationDate in its metadata.
+func writeTestPDF(t *testing.T, path, text, creationDate string) {
+	t.Helper()
+
+	content := fmt.Sprintf("BT /F1 12 Tf 20 100 Td (%s) Tj ET", text)
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 200 200] /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> >> >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+		fmt.Sprintf("<< /Producer (buchhalter test) /CreationDate (D:%s) >>", creationDate),
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xrefOffset := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info 6 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xrefOffset)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("error creating directory: %s", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("error writing PDF: %s", err)
+	}
+}
+
+func TestContentFingerprint(t *testing.T) {
+	directory := t.TempDir()
+	original := filepath.Join(directory, "original.pdf")
+	reissued := filepath.Join(directory, "reissued.pdf")
+	other := filepath.Join(directory, "other.pdf")
+	writeTestPDF(t, original, "Invoice 2024-0042", "20240501120000")
+	writeTestPDF(t, reissued, "Invoice 2024-0042", "20240612083000")
+	writeTestPDF(t, other, "Invoice 2024-0043", "20240501120000")
+
+	originalHash, _ := computeHash(original)
+	reissuedHash, _ := computeHash(reissued)
+	if originalHash == reissuedHash {
+		t.Fatalf("test documents must have different bytes")
+	}
+
+	fingerprints := map[string]string{}
+	for _, file := range []string{original, reissued, other} {
+		fingerprint, err := ContentFingerprint(file)
+		if err != nil {
+			t.Fatalf("ContentFingerprint(%s) returned error: %s", filepath.Base(file), err)
+		}
+		if len(fingerprint) == 0 {
+			t.Fatalf("ContentFingerprint(%s) is empty", filepath.Base(file))
+		}
+		fingerprints[file] = fingerprint
+	}
+
+	if fingerprints[original] != fingerprints[reissued] {
+		t.Errorf("documents with the same content have different fingerprints")
+	}
+	if fingerprints[original] == fingerprints[other] {
+		t.Errorf("documents with different content have the same fingerprint")
+	}
+}
+
+func TestFindContentDuplicates(t *testing.T) {
+	documentsDirectory := t.TempDir()
+	writeTestPDF(t, filepath.Join(documentsDirectory, "hetzner", "invoice.pdf"), "Invoice 2024-0042", "20240501120000")
+	writeTestPDF(t, filepath.Join(documentsDirectory, "hetzner", "invoice (1).pdf"), "Invoice 2024-0042", "20240612083000")
+	writeTestPDF(t, filepath.Join(documentsDirectory, "hetzner", "invoice-0043.pdf"), "Invoice 2024-0043", "20240501120000")
+	// Same content, but another supplier
+	writeTestPDF(t, filepath.Join(documentsDirectory, "aws", "invoice.pdf"), "Invoice 2024-0042", "20240701120000")
+	if err := os.WriteFile(filepath.Join(documentsDirectory, "hetzner", "broken.pdf"), []byte("not a PDF"), 0644); err != nil {
+		t.Fatalf("error writing file: %s", err)
+	}
+
+	a := NewDocumentArchive(slog.Default(), documentsDirectory, LayoutSupplier)
+	if err := a.BuildArchiveIndex(); err != nil {
+		t.Fatalf("BuildArchiveIndex() returned error: %s", err)
+	}
+
+	duplicates := a.FindContentDuplicates()
+	if len(duplicates) != 1 {
+		t.Fatalf("FindContentDuplicates() = %+v; want one group", duplicates)
+	}
+	expected := []string{
+		filepath.Join(documentsDirectory, "hetzner", "invoice (1).pdf"),
+		filepath.Join(documentsDirectory, "hetzner", "invoice.pdf"),
+	}
+	if duplicates[0].Supplier != "hetzner" || fmt.Sprint(duplicates[0].Files) != fmt.Sprint(expected) {
+		t.Errorf("FindContentDuplicates() = %+v; want hetzner with %v", duplicates[0], expected)
+	}
+
+	// All documents are kept
+	for _, file := range expected {
+		if _, err := os.Stat(file); err != nil {
+			t.Errorf("duplicate %s was removed", file)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package archive
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// mergeManifestFileName is the (hidden) file in a document directory that records documents merged into another one.
+const mergeManifestFileName = ".buchhalter-merged.json"
+
+// mergeManifest maps the file name of a merged document to the hashes of its (removed) parts.
+type mergeManifest map[string][]string
+
+// RecordMergedParts records the hashes of documents that were merged into mergedFile and removed afterwards.
+// The archive still knows the parts after a restart, so they are not downloaded again.
+func (a *DocumentArchive) RecordMergedParts(mergedFile string, partHashes []string) error {
+	manifestFile := filepath.Join(filepath.Dir(mergedFile), mergeManifestFileName)
+	manifest, err := readMergeManifest(manifestFile)
+	if err != nil {
+		return err
+	}
+
+	mergedFileName := filepath.Base(mergedFile)
+	manifest[mergedFileName] = append(manifest[mergedFileName], partHashes...)
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding merge manifest %s: %w", manifestFile, err)
+	}
+	if err := os.WriteFile(manifestFile, data, 0644); err != nil {
+		return fmt.Errorf("error writing merge manifest %s: %w", manifestFile, err)
+	}
+
+	for _, hash := range partHashes {
+		delete(a.fileIndex, hash)
+		a.mergedPartHashes[hash] = mergedFile
+	}
+
+	return nil
+}
+
+func (a *DocumentArchive) loadMergeManifest(manifestFile string) error {
+	manifest, err := readMergeManifest(manifestFile)
+	if err != nil {
+		return err
+	}
+
+	for mergedFileName, partHashes := range manifest {
+		for _, hash := range partHashes {
+			a.mergedPartHashes[hash] = filepath.Join(filepath.Dir(manifestFile), mergedFileName)
+		}
+	}
+
+	return nil
+}
+
+func readMergeManifest(manifestFile string) (mergeManifest, error) {
+	manifest := mergeManifest{}
+
+	data, err := os.ReadFile(manifestFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return manifest, nil
+	}
+	if err != nil {
+		return manifest, fmt.Errorf("error reading merge manifest %s: %w", manifestFile, err)
+	}
+
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return manifest, fmt.Errorf("error parsing merge manifest %s: %w", manifestFile, err)
+	}
+
+	return manifest, nil
+}
@@ -0,0 +1,98 @@
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Migration is the move of a document into its directory of the configured layout.
+type Migration struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// PlanMigration returns the moves needed to store all indexed documents in the layout of the archive.
+// Documents directly in the storage directory and in internal directories (e.g. `_tmp`) are not moved.
+func (a *DocumentArchive) PlanMigration() ([]Migration, error) {
+	migrations := []Migration{}
+	for _, file := range a.fileIndex {
+		relativePath, err := filepath.Rel(a.storageDirectory, file.Path)
+		if err != nil {
+			return nil, fmt.Errorf("error determining path of %s in document archive: %w", file.Path, err)
+		}
+		firstComponent := strings.Split(filepath.ToSlash(relativePath), "/")[0]
+		if filepath.Dir(relativePath) == "." || strings.HasPrefix(firstComponent, "_") || strings.HasPrefix(firstComponent, ".") {
+			continue
+		}
+
+		fileInfo, err := os.Stat(file.Path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading file info of %s: %w", file.Path, err)
+		}
+
+		documentDirectory := documentDirectoryForLayout(a.layout, a.storageDirectory, file.Supplier, fileInfo.ModTime())
+		destination := filepath.Join(documentDirectory, filepath.Base(file.Path))
+		if destination != file.Path {
+			migrations = append(migrations, Migration{From: file.Path, To: destination})
+		}
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].From < migrations[j].From
+	})
+
+	return migrations, nil
+}
+
+// Migrate moves the documents of migrations and updates the archive index.
+// Existing files are never overwritten: Those documents are skipped and returned as error at the end.
+// Directories that are empty after the moves are removed.
+func (a *DocumentArchive) Migrate(migrations []Migration) (int, error) {
+	moved := 0
+	var errs []error
+	for _, migration := range migrations {
+		if _, err := os.Stat(migration.To); err == nil {
+			errs = append(errs, fmt.Errorf("not moving %s, %s exists already", migration.From, migration.To))
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(migration.To), os.ModePerm); err != nil {
+			errs = append(errs, fmt.Errorf("error creating document directory %s: %w", filepath.Dir(migration.To), err))
+			continue
+		}
+		// The modification time is kept, so the document stays in the same year and month
+		if err := os.Rename(migration.From, migration.To); err != nil {
+			errs = append(errs, fmt.Errorf("error moving %s to %s: %w", migration.From, migration.To, err))
+			continue
+		}
+		a.logger.Debug("Moved document", "source", migration.From, "destination", migration.To)
+		moved++
+
+		for hash, file := range a.fileIndex {
+			if file.Path == migration.From {
+				file.Path = migration.To
+				a.fileIndex[hash] = file
+			}
+		}
+		a.removeEmptyDirectories(filepath.Dir(migration.From))
+	}
+
+	return moved, errors.Join(errs...)
+}
+
+// removeEmptyDirectories removes directory and its parents, as long as they are empty and inside the storage directory.
+func (a *DocumentArchive) removeEmptyDirectories(directory string) {
+	for directory != a.storageDirectory && strings.HasPrefix(directory, a.storageDirectory) {
+		entries, err := os.ReadDir(directory)
+		if err != nil || len(entries) > 0 {
+			return
+		}
+		if err := os.Remove(directory); err != nil {
+			return
+		}
+		directory = filepath.Dir(directory)
+	}
+}
@@ -0,0 +1,105 @@
+package archive
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMigrate(t *testing.T) {
+	documentTime := time.Date(2024, time.March, 15, 12, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		layout   string
+		expected []string
+	}{
+		{LayoutSupplier, []string{"aws/invoice-1.pdf", "aws/invoice-2.pdf", "hetzner/invoice.pdf"}},
+		{LayoutSupplierYear, []string{"aws/2024/invoice-1.pdf", "aws/2024/invoice-2.pdf", "hetzner/2024/invoice.pdf"}},
+		{LayoutYearSupplier, []string{"2024/aws/invoice-1.pdf", "2024/aws/invoice-2.pdf", "2024/hetzner/invoice.pdf"}},
+		{LayoutSupplierYearMonth, []string{"aws/2024/03/invoice-1.pdf", "aws/2024/03/invoice-2.pdf", "hetzner/2024/03/invoice.pdf"}},
+	}
+
+	for _, test := range tests {
+		storageDirectory := t.TempDir()
+		// Documents in several layouts, plus files that are never moved
+		files := map[string]string{
+			"aws/invoice-1.pdf":           "aws 1",
+			"aws/2024/invoice-2.pdf":      "aws 2",
+			"hetzner/2024/03/invoice.pdf": "hetzner",
+			"_tmp/aws/download.pdf":       "download",
+			"notes.pdf":                   "notes",
+		}
+		for name, content := range files {
+			writeTestFile(t, filepath.Join(storageDirectory, filepath.FromSlash(name)), content, documentTime)
+		}
+
+		a := NewDocumentArchive(slog.Default(), storageDirectory, test.layout)
+		if err := a.BuildArchiveIndex(); err != nil {
+			t.Fatalf("%s: BuildArchiveIndex() returned error: %s", test.layout, err)
+		}
+		migrations, err := a.PlanMigration()
+		if err != nil {
+			t.Fatalf("%s: PlanMigration() returned error: %s", test.layout, err)
+		}
+		if _, err := a.Migrate(migrations); err != nil {
+			t.Fatalf("%s: Migrate() returned error: %s", test.layout, err)
+		}
+
+		for _, expected := range append(test.expected, "_tmp/aws/download.pdf", "notes.pdf") {
+			if _, err := os.Stat(filepath.Join(storageDirectory, filepath.FromSlash(expected))); err != nil {
+				t.Errorf("%s: %s doesn't exist after the migration", test.layout, expected)
+			}
+		}
+
+		// The index follows the moves and nothing is left to migrate
+		for _, file := range a.GetFileIndex() {
+			if _, err := os.Stat(file.Path); err != nil {
+				t.Errorf("%s: indexed file %s doesn't exist", test.layout, file.Path)
+			}
+		}
+		if migrations, _ := a.PlanMigration(); len(migrations) > 0 {
+			t.Errorf("%s: PlanMigration() after the migration = %v; want no migrations", test.layout, migrations)
+		}
+	}
+}
+
+func TestMigrateDoesNotOverwrite(t *testing.T) {
+	documentTime := time.Date(2024, time.March, 15, 12, 0, 0, 0, time.Local)
+	storageDirectory := t.TempDir()
+	writeTestFile(t, filepath.Join(storageDirectory, "aws", "invoice.pdf"), "flat", documentTime)
+	writeTestFile(t, filepath.Join(storageDirectory, "aws", "2024", "invoice.pdf"), "by year", documentTime)
+
+	a := NewDocumentArchive(slog.Default(), storageDirectory, LayoutSupplierYear)
+	if err := a.BuildArchiveIndex(); err != nil {
+		t.Fatalf("BuildArchiveIndex() returned error: %s", err)
+	}
+	migrations, err := a.PlanMigration()
+	if err != nil {
+		t.Fatalf("PlanMigration() returned error: %s", err)
+	}
+	moved, err := a.Migrate(migrations)
+	if err == nil || moved != 0 {
+		t.Errorf("Migrate() = %d, %v; want 0 moved documents and an error", moved, err)
+	}
+
+	content, _ := os.ReadFile(filepath.Join(storageDirectory, "aws", "2024", "invoice.pdf"))
+	if string(content) != "by year" {
+		t.Errorf("existing document was overwritten")
+	}
+}
+
+func writeTestFile(t *testing.T, path, content string, modTime time.Time) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("error creating directory: %s", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("error writing file: %s", err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("error setting modification time: %s", err)
+	}
+}
@@ -0,0 +1,220 @@
+package archive
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pruneManifestFileName is the (hidden) file in the storage directory that records the pruned documents.
+const pruneManifestFileName = ".buchhalter-pruned.json"
+
+// pruneManifest maps the hashes of pruned documents to their former path, relative to the storage directory.
+type pruneManifest map[string]string
+
+var retentionAgePattern = regexp.MustCompile(`^(\d+)([ymwd])$`)
+
+// PruneOptions select the documents removed by PlanPrune.
+type PruneOptions struct {
+	// OlderThan prunes the documents modified before it, the zero time doesn't prune by age
+	OlderThan time.Time
+	// MaxSizeMB prunes the oldest documents until the archive fits into it, 0 doesn't limit the size
+	MaxSizeMB int64
+	// Keep is the number of the newest documents per supplier that are never pruned, 0 doesn't keep any.
+	// Without another option, all other documents are pruned.
+	Keep int
+}
+
+// PruneCandidate is a document selected by PlanPrune.
+type PruneCandidate struct {
+	Path     string    `json:"path"`
+	Supplier string    `json:"supplier"`
+	Hash     string    `json:"hash"`
+	ModTime  time.Time `json:"modTime"`
+	Size     int64     `json:"size"`
+}
+
+// RetentionCutoff returns the time before now by age, e.g. `3y`, `6m`, `2w` or `30d` (years, months, weeks, days).
+func RetentionCutoff(age string, now time.Time) (time.Time, error) {
+	matches := retentionAgePattern.FindStringSubmatch(strings.TrimSpace(age))
+	if matches == nil {
+		return time.Time{}, fmt.Errorf("invalid age `%s`, expected a number with the unit y, m, w or d (e.g. `3y`)", age)
+	}
+	value, err := strconv.Atoi(matches[1])
+	if err != nil || value < 1 {
+		return time.Time{}, fmt.Errorf("invalid age `%s`, the number must be at least 1", age)
+	}
+
+	switch matches[2] {
+	case "y":
+		return now.AddDate(-value, 0, 0), nil
+	case "m":
+		return now.AddDate(0, -value, 0), nil
+	case "w":
+		return now.AddDate(0, 0, -7*value), nil
+	}
+	return now.AddDate(0, 0, -value), nil
+}
+
+// PlanPrune returns the indexed documents to remove with options, ordered by supplier and age (oldest first).
+// The newest Keep documents of each supplier are never returned, also not to fit the archive into MaxSizeMB.
+// Documents directly in the storage directory and in internal directories (e.g. `_tmp`) are never pruned.
+func (a *DocumentArchive) PlanPrune(options PruneOptions) ([]PruneCandidate, error) {
+	if options.OlderThan.IsZero() && options.MaxSizeMB <= 0 && options.Keep <= 0 {
+		return nil, errors.New("either an age, a maximum size or the number of documents to keep is required")
+	}
+
+	documentsBySupplier := map[string][]PruneCandidate{}
+	for hash, file := range a.fileIndex {
+		if len(file.Supplier) == 0 || strings.HasPrefix(file.Supplier, "_") || strings.HasPrefix(file.Supplier, ".") {
+			continue
+		}
+		fileInfo, err := os.Stat(file.Path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading file info of %s: %w", file.Path, err)
+		}
+		documentsBySupplier[file.Supplier] = append(documentsBySupplier[file.Supplier], PruneCandidate{
+			Path:     file.Path,
+			Supplier: file.Supplier,
+			Hash:     hash,
+			ModTime:  fileInfo.ModTime(),
+			Size:     fileInfo.Size(),
+		})
+	}
+
+	candidates := []PruneCandidate{}
+	// remaining are the documents that may be pruned to fit the archive into MaxSizeMB
+	remaining := []PruneCandidate{}
+	var remainingSize int64
+	onlyKeep := options.OlderThan.IsZero() && options.MaxSizeMB <= 0
+	for _, documents := range documentsBySupplier {
+		sort.Slice(documents, func(i, j int) bool {
+			return newerDocument(documents[i], documents[j])
+		})
+		for i, document := range documents {
+			if i < options.Keep {
+				remainingSize += document.Size
+				continue
+			}
+			if onlyKeep || (!options.OlderThan.IsZero() && document.ModTime.Before(options.OlderThan)) {
+				candidates = append(candidates, document)
+				continue
+			}
+			remaining = append(remaining, document)
+			remainingSize += document.Size
+		}
+	}
+
+	if options.MaxSizeMB > 0 {
+		maxSize := options.MaxSizeMB * 1024 * 1024
+		sort.Slice(remaining, func(i, j int) bool {
+			return newerDocument(remaining[j], remaining[i])
+		})
+		for _, document := range remaining {
+			if remainingSize <= maxSize {
+				break
+			}
+			candidates = append(candidates, document)
+			remainingSize -= document.Size
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Supplier != candidates[j].Supplier {
+			return candidates[i].Supplier < candidates[j].Supplier
+		}
+		return newerDocument(candidates[j], candidates[i])
+	})
+
+	return candidates, nil
+}
+
+// newerDocument returns true if document a was modified after b, the path makes the order stable for documents of the same time.
+func newerDocument(a, b PruneCandidate) bool {
+	if !a.ModTime.Equal(b.ModTime) {
+		return a.ModTime.After(b.ModTime)
+	}
+	return a.Path > b.Path
+}
+
+// Prune deletes the documents of candidates and removes them from the archive index.
+// The hashes of the deleted documents are recorded in the prune manifest, so they are not downloaded again.
+// Failed deletions don't stop the other ones, they are returned as error at the end.
+// Directories that are empty afterwards are removed.
+func (a *DocumentArchive) Prune(candidates []PruneCandidate) (int, error) {
+	manifestFile := filepath.Join(a.storageDirectory, pruneManifestFileName)
+	manifest, err := readPruneManifest(manifestFile)
+	if err != nil {
+		return 0, err
+	}
+
+	pruned := 0
+	var errs []error
+	for _, candidate := range candidates {
+		if err := os.Remove(candidate.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("error deleting %s: %w", candidate.Path, err))
+			continue
+		}
+		a.logger.Debug("Pruned document", "file", candidate.Path, "supplier", candidate.Supplier)
+		pruned++
+
+		relativePath, err := filepath.Rel(a.storageDirectory, candidate.Path)
+		if err != nil {
+			relativePath = candidate.Path
+		}
+		manifest[candidate.Hash] = filepath.ToSlash(relativePath)
+		a.RemoveFile(candidate.Path)
+		a.prunedHashes[candidate.Hash] = candidate.Path
+		a.removeEmptyDirectories(filepath.Dir(candidate.Path))
+	}
+
+	if pruned > 0 {
+		data, err := json.MarshalIndent(manifest, "", "  ")
+		if err != nil {
+			return pruned, errors.Join(append(errs, fmt.Errorf("error encoding prune manifest %s: %w", manifestFile, err))...)
+		}
+		if err := os.WriteFile(manifestFile, data, 0644); err != nil {
+			errs = append(errs, fmt.Errorf("error writing prune manifest %s: %w", manifestFile, err))
+		}
+	}
+
+	return pruned, errors.Join(errs...)
+}
+
+func (a *DocumentArchive) loadPruneManifest(manifestFile string) error {
+	manifest, err := readPruneManifest(manifestFile)
+	if err != nil {
+		return err
+	}
+
+	for hash, relativePath := range manifest {
+		a.prunedHashes[hash] = filepath.Join(filepath.Dir(manifestFile), filepath.FromSlash(relativePath))
+	}
+
+	return nil
+}
+
+func readPruneManifest(manifestFile string) (pruneManifest, error) {
+	manifest := pruneManifest{}
+
+	data, err := os.ReadFile(manifestFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return manifest, nil
+	}
+	if err != nil {
+		return manifest, fmt.Errorf("error reading prune manifest %s: %w", manifestFile, err)
+	}
+
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return manifest, fmt.Errorf("error parsing prune manifest %s: %w", manifestFile, err)
+	}
+
+	return manifest, nil
+}
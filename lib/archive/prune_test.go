@@ -0,0 +1,200 @@
+package archive
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetentionCutoff(t *testing.T) {
+	now := time.Date(2025, time.June, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		age       string
+		expected  time.Time
+		expectErr bool
+	}{
+		{"3y", time.Date(2022, time.June, 15, 12, 0, 0, 0, time.UTC), false},
+		{"6m", time.Date(2024, time.December, 15, 12, 0, 0, 0, time.UTC), false},
+		{"2w", time.Date(2025, time.June, 1, 12, 0, 0, 0, time.UTC), false},
+		{"30d", time.Date(2025, time.May, 16, 12, 0, 0, 0, time.UTC), false},
+		{" 1y ", time.Date(2024, time.June, 15, 12, 0, 0, 0, time.UTC), false},
+		{"0d", time.Time{}, true},
+		{"3", time.Time{}, true},
+		{"3h", time.Time{}, true},
+		{"-1y", time.Time{}, true},
+		{"", time.Time{}, true},
+	}
+
+	for _, test := range tests {
+		cutoff, err := RetentionCutoff(test.age, now)
+		if test.expectErr {
+			if err == nil {
+				t.Errorf("RetentionCutoff(%q) expected an error, got %s", test.age, cutoff)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("RetentionCutoff(%q) returned error: %s", test.age, err)
+			continue
+		}
+		if !cutoff.Equal(test.expected) {
+			t.Errorf("RetentionCutoff(%q) = %s, expected %s", test.age, cutoff, test.expected)
+		}
+	}
+}
+
+func TestPlanPrune(t *testing.T) {
+	storageDirectory := t.TempDir()
+	now := time.Date(2025, time.June, 15, 12, 0, 0, 0, time.Local)
+	files := map[string]time.Time{
+		"aws/2020/invoice-1.pdf":     now.AddDate(-5, 0, 0),
+		"aws/2021/invoice-2.pdf":     now.AddDate(-4, 0, 0),
+		"aws/2025/invoice-3.pdf":     now.AddDate(0, -1, 0),
+		"hetzner/2021/invoice-1.pdf": now.AddDate(-4, 0, 0),
+		"hetzner/2022/invoice-2.pdf": now.AddDate(-3, -1, 0),
+		"_tmp/aws/download.pdf":      now.AddDate(-5, 0, 0),
+		"notes.pdf":                  now.AddDate(-5, 0, 0),
+	}
+	for name, modTime := range files {
+		writeTestFile(t, filepath.Join(storageDirectory, filepath.FromSlash(name)), name, modTime)
+	}
+
+	a := NewDocumentArchive(slog.Default(), storageDirectory, LayoutSupplierYear)
+	if err := a.BuildArchiveIndex(); err != nil {
+		t.Fatalf("BuildArchiveIndex() returned error: %s", err)
+	}
+
+	tests := []struct {
+		name     string
+		options  PruneOptions
+		expected []string
+	}{
+		{"older than", PruneOptions{OlderThan: now.AddDate(-3, 0, 0)}, []string{"aws/2020/invoice-1.pdf", "aws/2021/invoice-2.pdf", "hetzner/2021/invoice-1.pdf", "hetzner/2022/invoice-2.pdf"}},
+		{"keep", PruneOptions{Keep: 2}, []string{"aws/2020/invoice-1.pdf"}},
+		{"older than and keep", PruneOptions{OlderThan: now.AddDate(-3, 0, 0), Keep: 1}, []string{"aws/2020/invoice-1.pdf", "aws/2021/invoice-2.pdf", "hetzner/2021/invoice-1.pdf"}},
+		{"nothing to prune", PruneOptions{OlderThan: now.AddDate(-10, 0, 0)}, []string{}},
+	}
+
+	for _, test := range tests {
+		candidates, err := a.PlanPrune(test.options)
+		if err != nil {
+			t.Errorf("%s: PlanPrune() returned error: %s", test.name, err)
+			continue
+		}
+		if len(candidates) != len(test.expected) {
+			t.Errorf("%s: PlanPrune() returned %d documents, expected %d: %v", test.name, len(candidates), len(test.expected), candidates)
+			continue
+		}
+		for i, candidate := range candidates {
+			expected := filepath.Join(storageDirectory, filepath.FromSlash(test.expected[i]))
+			if candidate.Path != expected {
+				t.Errorf("%s: document %d is %s, expected %s", test.name, i, candidate.Path, expected)
+			}
+		}
+	}
+
+	if _, err := a.PlanPrune(PruneOptions{}); err == nil {
+		t.Errorf("PlanPrune() without options expected an error")
+	}
+}
+
+func TestPlanPruneMaxSize(t *testing.T) {
+	storageDirectory := t.TempDir()
+	now := time.Now()
+	// Three documents of 400 KB, the archive fits into 1 MB without the oldest one
+	for i, name := range []string{"aws/invoice-1.pdf", "hetzner/invoice-2.pdf", "aws/invoice-3.pdf"} {
+		content := strings.Repeat(strconv.Itoa(i), 400*1024)
+		writeTestFile(t, filepath.Join(storageDirectory, filepath.FromSlash(name)), content, now.AddDate(0, -3+i, 0))
+	}
+
+	a := NewDocumentArchive(slog.Default(), storageDirectory, LayoutSupplier)
+	if err := a.BuildArchiveIndex(); err != nil {
+		t.Fatalf("BuildArchiveIndex() returned error: %s", err)
+	}
+
+	tests := []struct {
+		name     string
+		options  PruneOptions
+		expected []string
+	}{
+		{"max size", PruneOptions{MaxSizeMB: 1}, []string{"aws/invoice-1.pdf"}},
+		{"max size below the newest documents", PruneOptions{MaxSizeMB: 1, Keep: 1}, []string{"aws/invoice-1.pdf"}},
+		{"max size with kept documents", PruneOptions{MaxSizeMB: 1, Keep: 2}, []string{}},
+		{"max size fits", PruneOptions{MaxSizeMB: 2}, []string{}},
+	}
+
+	for _, test := range tests {
+		candidates, err := a.PlanPrune(test.options)
+		if err != nil {
+			t.Errorf("%s: PlanPrune() returned error: %s", test.name, err)
+			continue
+		}
+		if len(candidates) != len(test.expected) {
+			t.Errorf("%s: PlanPrune() returned %d documents, expected %d: %v", test.name, len(candidates), len(test.expected), candidates)
+			continue
+		}
+		for i, candidate := range candidates {
+			expected := filepath.Join(storageDirectory, filepath.FromSlash(test.expected[i]))
+			if candidate.Path != expected {
+				t.Errorf("%s: document %d is %s, expected %s", test.name, i, candidate.Path, expected)
+			}
+		}
+	}
+}
+
+func TestPrune(t *testing.T) {
+	storageDirectory := t.TempDir()
+	now := time.Now()
+	prunedFile := filepath.Join(storageDirectory, "aws", "2020", "invoice-1.pdf")
+	keptFile := filepath.Join(storageDirectory, "aws", "2025", "invoice-2.pdf")
+	writeTestFile(t, prunedFile, "old invoice", now.AddDate(-5, 0, 0))
+	writeTestFile(t, keptFile, "new invoice", now)
+
+	a := NewDocumentArchive(slog.Default(), storageDirectory, LayoutSupplierYear)
+	if err := a.BuildArchiveIndex(); err != nil {
+		t.Fatalf("BuildArchiveIndex() returned error: %s", err)
+	}
+	candidates, err := a.PlanPrune(PruneOptions{OlderThan: now.AddDate(-1, 0, 0)})
+	if err != nil {
+		t.Fatalf("PlanPrune() returned error: %s", err)
+	}
+	pruned, err := a.Prune(candidates)
+	if err != nil {
+		t.Fatalf("Prune() returned error: %s", err)
+	}
+	if pruned != 1 {
+		t.Errorf("Prune() pruned %d documents, expected 1", pruned)
+	}
+
+	if _, err := os.Stat(prunedFile); !os.IsNotExist(err) {
+		t.Errorf("pruned document %s still exists", prunedFile)
+	}
+	if _, err := os.Stat(filepath.Dir(prunedFile)); !os.IsNotExist(err) {
+		t.Errorf("empty directory %s was not removed", filepath.Dir(prunedFile))
+	}
+	if _, err := os.Stat(keptFile); err != nil {
+		t.Errorf("kept document %s doesn't exist: %s", keptFile, err)
+	}
+	if len(a.GetFileIndex()) != 1 {
+		t.Errorf("index has %d documents after pruning, expected 1", len(a.GetFileIndex()))
+	}
+
+	// A new archive knows the pruned document, so it isn't downloaded again
+	download := filepath.Join(t.TempDir(), "invoice.pdf")
+	writeTestFile(t, download, "old invoice", now)
+	restarted := NewDocumentArchive(slog.Default(), storageDirectory, LayoutSupplierYear)
+	if err := restarted.BuildArchiveIndex(); err != nil {
+		t.Fatalf("BuildArchiveIndex() returned error: %s", err)
+	}
+	if !restarted.DocumentExists(download, "aws") {
+		t.Errorf("pruned document is not known to the archive after a restart")
+	}
+	if len(restarted.CrossSupplierDuplicates()) != 0 {
+		t.Errorf("pruned document was reported as cross-supplier duplicate: %v", restarted.CrossSupplierDuplicates())
+	}
+}
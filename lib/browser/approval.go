@@ -0,0 +1,90 @@
+package browser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"buchhalter/lib/parser"
+	"buchhalter/lib/utils"
+
+	"github.com/chromedp/chromedp"
+)
+
+// stepTimeout returns the time a step may take before the recipe is aborted.
+// A `waitForApproval` step gets the time of its approval timeout on top, for its fallback steps, a `pollFor` step the time of its poll timeout.
+// Steps typing the TOTP get the time of the prompt on top, the user may have to enter the 2FA code (see SetTotpPrompt).
+func (b *BrowserDriver) stepTimeout(step parser.Step) time.Duration {
+	timeout := b.recipeTimeout
+	if stepUsesTotp(step) {
+		timeout += b.totpPrompt.Timeout()
+	}
+	switch step.Action {
+	case "waitForApproval":
+		if approvalTimeout, err := parser.ParseApprovalTimeout(step.Value); err == nil {
+			timeout += approvalTimeout
+		}
+	case "pollFor":
+		if pollTimeout, err := parser.ParsePollTimeout(step.Value); err == nil {
+			timeout += pollTimeout
+		}
+	}
+	return timeout
+}
+
+// stepUsesTotp returns true if step or one of its fallback steps types the `{{ totp }}` placeholder.
+func stepUsesTotp(step parser.Step) bool {
+	if step.Action == "type" && strings.Contains(step.Value, "{{ totp }}") {
+		return true
+	}
+	for _, fallbackStep := range step.Fallback {
+		if stepUsesTotp(fallbackStep) {
+			return true
+		}
+	}
+	return false
+}
+
+// stepWaitForApproval waits for the push approval of a multi-factor login (e.g. in a mobile app), until the element of step.Selector is shown.
+// If the approval isn't confirmed within the timeout (step.Value in seconds), the fallback steps run instead (e.g. entering a TOTP code).
+func (b *BrowserDriver) stepWaitForApproval(ctx context.Context, step parser.Step) utils.StepResult {
+	b.logger.Debug("Executing recipe step", "action", step.Action, "selector", step.Selector, "timeout", step.Value, "fallback_steps", len(step.Fallback))
+
+	timeout, err := parser.ParseApprovalTimeout(step.Value)
+	if err != nil {
+		return utils.StepResult{Status: "error", Message: err.Error(), ErrorCode: utils.ErrorCodeInvalidRecipe}
+	}
+	opts := []chromedp.QueryOption{}
+	selector, opts := b.getSelectorTypeQueryOptions(step, opts)
+	opts, err = b.getFrameQueryOptions(ctx, step, opts)
+	if err != nil {
+		return utils.StepResult{Status: "error", Message: err.Error(), ErrorCode: utils.ErrorCodeSelectorNotFound}
+	}
+
+	// WaitReady polls the page until the element is shown
+	approvalCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err = chromedp.Run(approvalCtx, chromedp.WaitReady(selector, opts...))
+	if err == nil {
+		b.logger.Info("Push approval confirmed", "action", step.Action, "selector", step.Selector)
+		return utils.StepResult{Status: "success"}
+	}
+	if !errors.Is(err, context.DeadlineExceeded) || ctx.Err() != nil {
+		return utils.StepResult{Status: "error", Message: err.Error()}
+	}
+	if len(step.Fallback) == 0 {
+		return utils.StepResult{Status: "error", Message: fmt.Sprintf("push approval was not confirmed within %s", timeout), ErrorCode: utils.ErrorCodeTwoFactorRequired}
+	}
+
+	b.logger.Info("Push approval not confirmed in time, running fallback steps", "action", step.Action, "timeout", timeout, "fallback_steps", len(step.Fallback))
+	for i, fallbackStep := range step.Fallback {
+		result := b.runStep(ctx, fallbackStep)
+		if result.Status != "success" {
+			return utils.StepResult{Status: "error", Message: fmt.Sprintf("fallback step %d (%s) failed: %s", i+1, fallbackStep.Action, result.Message), ErrorCode: result.ErrorCode}
+		}
+	}
+
+	return utils.StepResult{Status: "success"}
+}
@@ -0,0 +1,96 @@
+package browser
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"buchhalter/lib/parser"
+	"buchhalter/lib/utils"
+	"buchhalter/lib/vault"
+
+	"github.com/chromedp/chromedp"
+)
+
+func TestStepWaitForApproval(t *testing.T) {
+	ctx := newFixtureBrowserContext(t)
+
+	server := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer server.Close()
+
+	fallback := []parser.Step{
+		{Action: "click", Selector: "#use-code", SelectorType: parser.SelectorTypeQuery},
+		{Action: "type", Selector: "#code", SelectorType: parser.SelectorTypeQuery, Value: "123456"},
+		{Action: "click", Selector: "#submit-code", SelectorType: parser.SelectorTypeQuery},
+		{Action: "waitFor", Selector: "#dashboard", SelectorType: parser.SelectorTypeQuery},
+	}
+	tests := []struct {
+		name           string
+		page           string
+		fallback       []parser.Step
+		expectedStatus string
+	}{
+		{"approval detected", "/push-approval.html?approveAfter=300", fallback, "success"},
+		{"fallback to code", "/push-approval.html", fallback, "success"},
+		{"no approval without fallback", "/push-approval.html", nil, "error"},
+		{"failing fallback", "/push-approval.html", []parser.Step{{Action: "click", Selector: "#missing-link", SelectorType: parser.SelectorTypeQuery, Frame: "missing"}}, "error"},
+	}
+
+	for _, test := range tests {
+		if err := chromedp.Run(ctx, chromedp.Navigate(server.URL+test.page)); err != nil {
+			t.Fatalf("%s: error opening fixture: %s", test.name, err)
+		}
+
+		b := &BrowserDriver{logger: slog.Default(), credentials: &vault.Credentials{}, recipeTimeout: 5 * time.Second}
+		step := parser.Step{Action: "waitForApproval", Selector: "#dashboard", SelectorType: parser.SelectorTypeQuery, Value: "2", Fallback: test.fallback}
+		start := time.Now()
+		result := b.stepWaitForApproval(ctx, step)
+		if result.Status != test.expectedStatus {
+			t.Errorf("%s: stepWaitForApproval() = %s (%s); want %s", test.name, result.Status, result.Message, test.expectedStatus)
+		}
+		if test.name == "approval detected" && time.Since(start) >= 2*time.Second {
+			t.Errorf("%s: stepWaitForApproval() waited for the timeout; want to continue after the approval", test.name)
+		}
+	}
+}
+
+func TestStepTimeout(t *testing.T) {
+	b := &BrowserDriver{recipeTimeout: 60 * time.Second}
+	tests := []struct {
+		step     parser.Step
+		expected time.Duration
+	}{
+		{parser.Step{Action: "click"}, 60 * time.Second},
+		{parser.Step{Action: "waitForApproval"}, 60*time.Second + parser.DefaultApprovalTimeout},
+		{parser.Step{Action: "waitForApproval", Value: "90"}, 150 * time.Second},
+		{parser.Step{Action: "waitForApproval", Value: "invalid"}, 60 * time.Second},
+		{parser.Step{Action: "type", Value: "{{ totp }}"}, 60 * time.Second},
+		{parser.Step{Action: "pollFor"}, 60*time.Second + parser.DefaultPollTimeout},
+		{parser.Step{Action: "pollFor", Value: "120"}, 180 * time.Second},
+	}
+
+	for _, test := range tests {
+		if timeout := b.stepTimeout(test.step); timeout != test.expected {
+			t.Errorf("stepTimeout(%s, %s) = %s; want %s", test.step.Action, test.step.Value, timeout, test.expected)
+		}
+	}
+
+	// With a prompt for the 2FA code, the user gets the time of the prompt to enter it
+	b.SetTotpPrompt(utils.NewTotpPrompt(2*time.Minute, func(utils.ViewTotpPromptMsg) {}))
+	promptTests := []struct {
+		step     parser.Step
+		expected time.Duration
+	}{
+		{parser.Step{Action: "click"}, 60 * time.Second},
+		{parser.Step{Action: "type", Value: "{{ username }}"}, 60 * time.Second},
+		{parser.Step{Action: "type", Value: "{{ totp }}"}, 180 * time.Second},
+		{parser.Step{Action: "waitForApproval", Value: "90", Fallback: []parser.Step{{Action: "type", Value: "{{ totp }}"}}}, 270 * time.Second},
+	}
+	for _, test := range promptTests {
+		if timeout := b.stepTimeout(test.step); timeout != test.expected {
+			t.Errorf("stepTimeout(%s, %s) with prompt = %s; want %s", test.step.Action, test.step.Value, timeout, test.expected)
+		}
+	}
+}
@@ -4,7 +4,9 @@ package browser
 // Selectors in this context are xpath, css, etc.
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/fs"
@@ -14,6 +16,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"buchhalter/lib/archive"
@@ -28,6 +31,8 @@ import (
 	"github.com/chromedp/cdproto/fetch"
 	"github.com/chromedp/cdproto/network"
 	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/cdproto/storage"
+	"github.com/chromedp/cdproto/target"
 	"github.com/chromedp/chromedp"
 )
 
@@ -36,38 +41,70 @@ type BrowserDriver struct {
 	credentials     *vault.Credentials
 	documentArchive *archive.DocumentArchive
 
-	buchhalterDocumentsDirectory string
-	downloadsDirectory           string
-	documentsDirectory           string
+	buchhalterStagingDirectory string
+	downloadsDirectory         string
+	// supplier of the running recipe, the document archive determines the directories of its documents
+	supplier string
+	// expectedMimeType is the type of the documents of the running recipe (see utils.ValidateFileType)
+	expectedMimeType string
 
 	ChromeVersion string
 
-	browserCtx         context.Context
-	browserCancel      context.CancelFunc
-	recipeTimeout      time.Duration
+	browserCtx    context.Context
+	browserCancel context.CancelFunc
+	recipeTimeout time.Duration
+	// supplierTimeout is the total time the recipe may take (`--timeout-per-supplier`), zero for no limit
+	supplierTimeout    time.Duration
 	maxFilesDownloaded int
-
-	// downloadedFilesCount is used to count the number of files that have been downloaded in the `downloadAll` step
-	downloadedFilesCount int
+	// recipeMaxFiles is the option `maxFiles` of the running recipe, nil for maxFilesDownloaded
+	recipeMaxFiles *int
+	// storageOrigins are the origins of the domains of the running recipe, their storage is cleared by `clearStorage` steps
+	storageOrigins []string
+	// downloadConcurrency is the default number of parallel downloads of `downloadAll` steps
+	downloadConcurrency int
+	// domainPolicy blocks requests to domains the recipe may not contact, nil allows all requests
+	domainPolicy *DomainPolicy
+	// keepDownloads keeps the downloads directory of the supplier after the recipe, e.g. to inspect the downloads of a failed recipe
+	keepDownloads bool
+	// unzipLimits limit the archives extracted by `transform` steps (`buchhalter_unzip_max_size_mb` and `buchhalter_unzip_max_files`)
+	unzipLimits utils.UnzipLimits
+
+	// downloadedFilesCount is used to count the number of files that have been downloaded in the `downloadAll` step.
+	// It is atomic, the downloads complete in the listener of the browser events and the recipe reads it on a timeout.
+	downloadedFilesCount atomic.Int32
 
 	// newFilesCount is used to count the number of new files that have been moved to the local storage
 	// Incl. a check if we had this document already
 	newFilesCount int
+	// newFiles are the paths of the new files in the local storage
+	newFiles []string
+
+	// transcript records the executed steps of the recipe
+	transcript *Transcript
+	// verboseBrowser logs the console messages and exceptions of the pages (`--verbose-browser`)
+	verboseBrowser bool
+	// totpPrompt asks the user for the 2FA code, if the vault has no TOTP for the credentials (nil in quiet mode)
+	totpPrompt *utils.TotpPrompt
+	// screenshotDirectory is the directory the screenshots of the steps are written to (`--screenshots`), empty for none
+	screenshotDirectory string
 }
 
-func NewBrowserDriver(logger *slog.Logger, credentials *vault.Credentials, buchhalterDocumentsDirectory string, documentArchive *archive.DocumentArchive, maxFilesDownloaded int) (*BrowserDriver, error) {
+func NewBrowserDriver(logger *slog.Logger, credentials *vault.Credentials, buchhalterStagingDirectory string, documentArchive *archive.DocumentArchive, maxFilesDownloaded, downloadConcurrency int, tlsOverrides *TLSOverrides, chromePath string, headless, keepDownloads bool, domainPolicy *DomainPolicy) (*BrowserDriver, error) {
 	driver := &BrowserDriver{
 		logger:          logger,
 		credentials:     credentials,
 		documentArchive: documentArchive,
 
-		buchhalterDocumentsDirectory: buchhalterDocumentsDirectory,
+		buchhalterStagingDirectory: buchhalterStagingDirectory,
 
-		browserCtx:         nil,
-		browserCancel:      nil,
-		recipeTimeout:      60 * time.Second,
-		maxFilesDownloaded: maxFilesDownloaded,
-		newFilesCount:      0,
+		browserCtx:          nil,
+		browserCancel:       nil,
+		recipeTimeout:       60 * time.Second,
+		maxFilesDownloaded:  maxFilesDownloaded,
+		downloadConcurrency: downloadConcurrency,
+		keepDownloads:       keepDownloads,
+		domainPolicy:        domainPolicy,
+		newFilesCount:       0,
 	}
 
 	// Setting chrome flags
@@ -75,8 +112,10 @@ func NewBrowserDriver(logger *slog.Logger, credentials *vault.Credentials, buchh
 	opts := append(chromedp.DefaultExecAllocatorOptions[:],
 		chromedp.Flag("disable-search-engine-choice-screen", true),
 		chromedp.Flag("enable-automation", false),
-		chromedp.Flag("headless", false),
 	)
+	opts = append(opts, headlessFlags(headless)...)
+	opts = append(opts, tlsOverrides.ChromeFlags(logger)...)
+	opts = append(opts, chromeExecPathFlags(chromePath)...)
 
 	var err error
 	driver.browserCtx, driver.browserCancel, err = cu.New(cu.NewConfig(
@@ -92,15 +131,32 @@ func NewBrowserDriver(logger *slog.Logger, credentials *vault.Credentials, buchh
 	return driver, nil
 }
 
+// SetSupplierTimeout limits the total time of the recipe to timeout (`--timeout-per-supplier`), zero for no limit.
+func (b *BrowserDriver) SetSupplierTimeout(timeout time.Duration) {
+	b.supplierTimeout = timeout
+}
+
+// SetUnzipLimits limits the number of files and the uncompressed size of the archives extracted by `transform` steps.
+func (b *BrowserDriver) SetUnzipLimits(limits utils.UnzipLimits) {
+	b.unzipLimits = limits
+}
+
+// SetTotpPrompt sets the prompt for the 2FA code of recipes, whose vault item has no TOTP.
+func (b *BrowserDriver) SetTotpPrompt(prompt *utils.TotpPrompt) {
+	b.totpPrompt = prompt
+}
+
 func (b *BrowserDriver) GetContext() context.Context {
 	return b.browserCtx
 }
 
-func (b *BrowserDriver) RunRecipe(p *tea.Program, totalStepCount int, stepCountInCurrentRecipe int, baseCountStep int, recipe *parser.Recipe) (utils.RecipeResult, error) {
+func (b *BrowserDriver) RunRecipe(p *tea.Program, progress *utils.RecipeProgress, recipe *parser.Recipe) (utils.RecipeResult, error) {
 	b.logger.Info("Starting chrome browser driver ...", "recipe", recipe.Supplier, "recipe_version", recipe.Version)
 
-	ctx := b.browserCtx
 	defer b.browserCancel()
+	defer progress.Finish()
+	ctx, cancelSupplierTimeout := supplierTimeoutContext(b.browserCtx, b.supplierTimeout)
+	defer cancelSupplierTimeout()
 
 	// Get chrome version for metrics
 	b.ChromeVersion = strings.TrimSpace(b.ChromeVersion)
@@ -125,12 +181,22 @@ func (b *BrowserDriver) RunRecipe(p *tea.Program, totalStepCount int, stepCountI
 
 	// Create download directories
 	var err error
-	b.downloadsDirectory, b.documentsDirectory, err = utils.InitSupplierDirectories(b.buchhalterDocumentsDirectory, recipe.Supplier)
+	b.supplier = recipe.Supplier
+	b.expectedMimeType = recipe.ExpectedMimeType
+	b.recipeMaxFiles = recipe.MaxFiles
+	b.storageOrigins = storageOrigins(recipe)
+	// Downloads kept by a previous run (`--keep-downloads`) must not be added to the archive again
+	err = utils.TruncateDirectory(filepath.Join(b.buchhalterStagingDirectory, recipe.Supplier))
 	if err != nil {
-		b.logger.Error("Error while creating download directory", "error", err.Error(), "documents_directory", b.buchhalterDocumentsDirectory, "supplier", recipe.Supplier)
+		b.logger.Error("Error while truncating the download directory", "error", err.Error(), "staging_directory", b.buchhalterStagingDirectory, "supplier", recipe.Supplier)
+		return result, fmt.Errorf("error while truncating the download directory: %w", err)
+	}
+	b.downloadsDirectory, err = utils.InitSupplierDirectories(b.buchhalterStagingDirectory, recipe.Supplier)
+	if err != nil {
+		b.logger.Error("Error while creating download directory", "error", err.Error(), "staging_directory", b.buchhalterStagingDirectory, "supplier", recipe.Supplier)
 		return result, fmt.Errorf("error while creating download directory: %w", err)
 	}
-	b.logger.Info("Download directories created", "downloads_directory", b.downloadsDirectory, "documents_directory", b.documentsDirectory)
+	b.logger.Info("Download directories created", "downloads_directory", b.downloadsDirectory, "documents_layout", b.documentArchive.Layout())
 
 	err = chromedp.Run(ctx, chromedp.Tasks{
 		browser.
@@ -147,18 +213,55 @@ func (b *BrowserDriver) RunRecipe(p *tea.Program, totalStepCount int, stepCountI
 		return result, fmt.Errorf("error while configuring the download behavior of chrome: %w", err)
 	}
 
-	// Disable downloading images for performance reasons
-	chromedp.ListenTarget(ctx, b.disableImages(ctx))
+	// Emulate the viewport (e.g. a mobile device) if the recipe requires it
+	if recipe.Viewport != nil {
+		b.logger.Info("Emulating viewport", "width", recipe.Viewport.Width, "height", recipe.Viewport.Height, "mobile", recipe.Viewport.Mobile)
+		if err := chromedp.Run(ctx, viewportTasks(recipe.Viewport)); err != nil {
+			b.logger.Error("Error while emulating the viewport", "error", err.Error())
+			return result, fmt.Errorf("error while emulating the viewport: %w", err)
+		}
+	}
+
+	// Disable downloading images for performance reasons and block the domains of the domain policy
+	chromedp.ListenTarget(ctx, b.interceptRequests(ctx))
+	if b.domainPolicy != nil {
+		// Without a domain policy, requests are only intercepted while downloading
+		if err := chromedp.Run(ctx, fetch.Enable()); err != nil {
+			b.logger.Error("Error while enabling the request interception", "error", err.Error())
+			return result, fmt.Errorf("error while enabling the request interception: %w", err)
+		}
+		// The requests of new tabs (e.g. popups) aren't paused in the tab of the recipe
+		b.restrictNewTabs(ctx)
+	}
+
+	if b.verboseBrowser {
+		if err := listenForConsoleEvents(ctx, b.logger, recipe.Supplier); err != nil {
+			// The console messages only help diagnosing the recipe, it runs without them
+			b.logger.Warn("Error while enabling the browser log", "error", err.Error())
+		}
+	}
 
 	_ = b.enableLifeCycleEvents()
 
-	var cs float64
+	b.transcript = NewTranscript(*recipe, time.Now())
+	defer func() {
+		b.transcript.Finish(time.Now(), b.ChromeVersion)
+	}()
+
 	n := 1
-	for _, step := range recipe.Steps {
+	for i, step := range recipe.Steps {
+		// The browser keeps running while the sync is paused (`p`), the step timeout starts after the pause
+		if err := progress.WaitWhilePaused(ctx); err != nil {
+			if supplierTimeoutExceeded(ctx) {
+				return b.abortWithSupplierTimeout(recipe, n, step, recipe.Steps[i:])
+			}
+			return result, err
+		}
 		p.Send(utils.ViewStatusUpdateMsg{
-			Message: fmt.Sprintf("Downloading invoices from `%s` (%d/%d):", recipe.Supplier, n, stepCountInCurrentRecipe),
+			Message: fmt.Sprintf("Downloading invoices from `%s` (%d/%d):", recipe.Supplier, n, len(recipe.Steps)),
 			Details: step.Description,
 		})
+		utils.SetLastStep(fmt.Sprintf("%s %s, step %d/%d (%s)", recipe.Supplier, recipe.Version, n, len(recipe.Steps), step.Action))
 
 		stepResultChan := make(chan utils.StepResult, 1)
 
@@ -181,35 +284,19 @@ func (b *BrowserDriver) RunRecipe(p *tea.Program, totalStepCount int, stepCountI
 		}
 
 		// Timeout recipe if something goes wrong
+		stepStartTime := time.Now()
 		go func() {
-			switch action := step.Action; action {
-			case "open":
-				stepResultChan <- b.stepOpen(ctx, step)
-			case "removeElement":
-				stepResultChan <- b.stepRemoveElement(ctx, step)
-			case "click":
-				stepResultChan <- b.stepClick(ctx, step)
-			case "type":
-				stepResultChan <- b.stepType(ctx, step, b.credentials)
-			case "sleep":
-				stepResultChan <- b.stepSleep(ctx, step)
-			case "waitFor":
-				stepResultChan <- b.stepWaitFor(ctx, step)
-			case "downloadAll":
-				stepResultChan <- b.stepDownloadAll(ctx, step)
-			case "transform":
-				stepResultChan <- b.stepTransform(step)
-			case "move":
-				stepResultChan <- b.stepMove(step, b.documentArchive)
-			case "runScript":
-				stepResultChan <- b.stepRunScript(ctx, step)
-			case "runScriptDownloadUrls":
-				stepResultChan <- b.stepRunScriptDownloadUrls(ctx, step)
-			}
+			stepResultChan <- b.runStep(ctx, step)
 		}()
 
 		select {
 		case lastStepResult := <-stepResultChan:
+			// A step failing because the supplier timeout canceled the browser is a timeout, not an error of the step
+			if lastStepResult.Status != "success" && supplierTimeoutExceeded(ctx) {
+				b.recordStep(n, step, stepStartTime, "timeout", fmt.Sprintf("supplier timed out after %s", b.supplierTimeout))
+				return b.abortWithSupplierTimeout(recipe, n, step, recipe.Steps[i+1:])
+			}
+			b.recordStep(n, step, stepStartTime, lastStepResult.Status, lastStepResult.Message)
 			newDocumentsText := fmt.Sprintf("%d new documents", b.newFilesCount)
 			if b.newFilesCount == 1 {
 				newDocumentsText = "One new document"
@@ -225,6 +312,7 @@ func (b *BrowserDriver) RunRecipe(p *tea.Program, totalStepCount int, stepCountI
 					LastStepId:          fmt.Sprintf("%s-%s-%d-%s", recipe.Supplier, recipe.Version, n, step.Action),
 					LastStepDescription: step.Description,
 					NewFilesCount:       b.newFilesCount,
+					NewFiles:            b.newFiles,
 				}
 			} else {
 				result = utils.RecipeResult{
@@ -234,17 +322,26 @@ func (b *BrowserDriver) RunRecipe(p *tea.Program, totalStepCount int, stepCountI
 					LastStepId:          fmt.Sprintf("%s-%s-%d-%s", recipe.Supplier, recipe.Version, n, step.Action),
 					LastStepDescription: step.Description,
 					LastErrorMessage:    lastStepResult.Message,
+					ErrorCode:           lastStepResult.ErrorCodeOrUnknown(),
 					NewFilesCount:       b.newFilesCount,
+					NewFiles:            b.newFiles,
 				}
-				err = utils.TruncateDirectory(b.downloadsDirectory)
+				err = b.cleanupDownloads()
 				if err != nil {
-					b.logger.Error("Error while truncating the download directory", "error", err.Error(), "downloads_directory", b.downloadsDirectory)
-					return result, fmt.Errorf("error while truncating the download directory: %w", err)
+					return result, err
 				}
 				return result, nil
 			}
 
-		case <-time.After(b.recipeTimeout):
+		case <-ctx.Done():
+			if !supplierTimeoutExceeded(ctx) {
+				return result, ctx.Err()
+			}
+			b.recordStep(n, step, stepStartTime, "timeout", fmt.Sprintf("supplier timed out after %s", b.supplierTimeout))
+			return b.abortWithSupplierTimeout(recipe, n, step, recipe.Steps[i+1:])
+
+		case <-time.After(b.stepTimeout(step)):
+			b.recordStep(n, step, stepStartTime, "timeout", fmt.Sprintf("step timed out after %s", b.stepTimeout(step)))
 			result = utils.RecipeResult{
 				Status:              "error",
 				StatusText:          fmt.Sprintf("%s aborted with timeout.", recipe.Supplier),
@@ -252,35 +349,118 @@ func (b *BrowserDriver) RunRecipe(p *tea.Program, totalStepCount int, stepCountI
 				LastStepId:          fmt.Sprintf("%s-%s-%d-%s", recipe.Supplier, recipe.Version, n, step.Action),
 				LastStepDescription: step.Description,
 				// LastErrorMessage is not set here, because we don't have an error message
+				ErrorCode:     utils.ErrorCodeTimeout,
 				NewFilesCount: b.newFilesCount,
+				NewFiles:      b.newFiles,
 			}
-			err = utils.TruncateDirectory(b.downloadsDirectory)
+			err = b.cleanupDownloads()
 			if err != nil {
-				b.logger.Error("Error while truncating the download directory", "error", err.Error(), "downloads_directory", b.downloadsDirectory)
-				return result, fmt.Errorf("error while truncating the download directory: %w", err)
+				return result, err
 			}
 
 			// Imagine we run the `downloadAll` step, we download 2 files and then the recipe times out.
 			// It is bad that the recipe timed out, however, we still want to process with the 2 new downloaded documents.
 			// Process in this context means to move the files to the documents directory and add them to the document archive.
 			// Thats why we don't abort if the recipe timed out in this stage.
-			if !(step.Action == "downloadAll" && b.downloadedFilesCount > 0) {
+			if !(step.Action == "downloadAll" && b.downloadedFilesCount.Load() > 0) {
 				return result, nil
 			}
 		}
-		cs = (float64(baseCountStep) + float64(n)) / float64(totalStepCount)
-		p.Send(utils.ViewProgressUpdateMsg{Percent: cs})
+		progress.StepCompleted()
 		n++
 	}
 
-	err = utils.TruncateDirectory(b.downloadsDirectory)
+	err = b.cleanupDownloads()
 	if err != nil {
-		b.logger.Error("Error while truncating the download directory", "error", err.Error(), "downloads_directory", b.downloadsDirectory)
-		return result, fmt.Errorf("error while truncating the download directory: %w", err)
+		return result, err
 	}
 	return result, nil
 }
 
+// abortWithSupplierTimeout ends the recipe after the supplier timeout in step n.
+// Like a timed out `downloadAll` step, the files downloaded so far are still moved to the local storage:
+// the remaining steps run if they don't need the browser (see isLocalStep).
+func (b *BrowserDriver) abortWithSupplierTimeout(recipe *parser.Recipe, n int, step parser.Step, remainingSteps []parser.Step) (utils.RecipeResult, error) {
+	b.logger.Warn("Supplier timeout exceeded, aborting the recipe", "supplier", recipe.Supplier, "timeout", b.supplierTimeout, "step", n, "action", step.Action, "downloaded_files", b.downloadedFilesCount.Load())
+	if b.downloadedFilesCount.Load() > 0 {
+		for _, remainingStep := range remainingSteps {
+			if !isLocalStep(remainingStep) {
+				continue
+			}
+			if stepResult := b.runStep(context.Background(), remainingStep); stepResult.Status != "success" {
+				b.logger.Error("Error processing the downloaded files after the supplier timeout", "action", remainingStep.Action, "error", stepResult.Message)
+				break
+			}
+		}
+	}
+	result := supplierTimeoutResult(recipe, n, step, b.supplierTimeout, b.newFilesCount, b.newFiles)
+	if err := b.cleanupDownloads(); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// Transcript returns the transcript of the executed steps, nil if the recipe didn't start the steps.
+func (b *BrowserDriver) Transcript() *Transcript {
+	return b.transcript
+}
+
+// cleanupDownloads removes the downloads directory of the supplier at the end of a recipe, unless the downloads are kept (`--keep-downloads`).
+func (b *BrowserDriver) cleanupDownloads() error {
+	if b.keepDownloads {
+		b.logger.Info("Keeping the download directory", "downloads_directory", b.downloadsDirectory)
+		return nil
+	}
+
+	err := utils.TruncateDirectory(b.downloadsDirectory)
+	if err != nil {
+		b.logger.Error("Error while truncating the download directory", "error", err.Error(), "downloads_directory", b.downloadsDirectory)
+		return fmt.Errorf("error while truncating the download directory: %w", err)
+	}
+	return nil
+}
+
+// runStep executes a single recipe step (incl. the fallback steps of a `waitForApproval` step).
+func (b *BrowserDriver) runStep(ctx context.Context, step parser.Step) utils.StepResult {
+	switch step.Action {
+	case "open":
+		return b.stepOpen(ctx, step)
+	case "removeElement":
+		return b.stepRemoveElement(ctx, step)
+	case "clearStorage":
+		return b.stepClearStorage(ctx, step)
+	case "click":
+		return b.stepClick(ctx, step)
+	case "type":
+		return b.stepType(ctx, step, b.credentials)
+	case "sleep":
+		return b.stepSleep(ctx, step)
+	case "waitFor":
+		return b.stepWaitFor(ctx, step)
+	case "waitForNetworkIdle":
+		return b.stepWaitForNetworkIdle(ctx, step)
+	case "downloadAll":
+		return b.stepDownloadAll(ctx, step)
+	case "downloadHrefs":
+		return b.stepDownloadHrefs(ctx, step)
+	case "transform":
+		return b.stepTransform(step)
+	case "move":
+		return b.stepMove(step, b.documentArchive)
+	case "runScript":
+		return b.stepRunScript(ctx, step)
+	case "runScriptDownloadUrls":
+		return b.stepRunScriptDownloadUrls(ctx, step)
+	case "fetchDownload":
+		return b.stepFetchDownload(ctx, step)
+	case "waitForApproval":
+		return b.stepWaitForApproval(ctx, step)
+	case "pollFor":
+		return b.stepPollFor(ctx, step)
+	}
+	return utils.StepResult{Status: "error", Message: fmt.Sprintf("unsupported action `%s`", step.Action), ErrorCode: utils.ErrorCodeInvalidRecipe}
+}
+
 func (b *BrowserDriver) stepOpen(ctx context.Context, step parser.Step) utils.StepResult {
 	b.logger.Debug("Executing recipe step", "action", step.Action, "url", step.URL)
 
@@ -292,7 +472,7 @@ func (b *BrowserDriver) stepOpen(ctx context.Context, step parser.Step) utils.St
 			return nil
 		}),
 	); err != nil {
-		return utils.StepResult{Status: "error", Message: err.Error()}
+		return utils.StepResult{Status: "error", Message: err.Error(), ErrorCode: utils.ErrorCodeNetwork}
 	}
 	return utils.StepResult{Status: "success"}
 }
@@ -303,24 +483,71 @@ func (b *BrowserDriver) stepRemoveElement(ctx context.Context, step parser.Step)
 	nodeName := "node" + strconv.FormatInt(time.Now().UnixNano(), 10)
 	if err := chromedp.Run(ctx,
 		chromedp.Evaluate("let "+nodeName+" = document.querySelector('"+step.Selector+"'); "+nodeName+".parentNode.removeChild("+nodeName+")", nil),
+	); err != nil {
+		return utils.StepResult{Status: "error", Message: err.Error(), ErrorCode: utils.ErrorCodeSelectorNotFound}
+	}
+	return utils.StepResult{Status: "success"}
+}
+
+// clearStorageScript clears the sessionStorage of the current page (it isn't stored per origin) and returns the origin of the page.
+// Pages without a storage (e.g. about:blank) throw a SecurityError, which is ignored.
+const clearStorageScript = `(() => {
+	try { window.sessionStorage.clear(); } catch (e) {}
+	return window.location.origin;
+})()`
+
+// stepClearStorage clears all cookies and the storage (e.g. localStorage, IndexedDB and service workers) of the domains of the recipe
+// and of the current page to force a fresh login. The storage is cleared via the Storage domain,
+// so the step also works before the first `open` (e.g. with the session of a previous run in the browser profile).
+func (b *BrowserDriver) stepClearStorage(ctx context.Context, step parser.Step) utils.StepResult {
+	b.logger.Debug("Executing recipe step", "action", step.Action, "origins", b.storageOrigins)
+
+	var pageOrigin string
+	if err := chromedp.Run(ctx,
+		network.ClearBrowserCookies(),
+		chromedp.Evaluate(clearStorageScript, &pageOrigin),
 	); err != nil {
 		return utils.StepResult{Status: "error", Message: err.Error()}
 	}
+
+	origins := b.storageOrigins
+	if strings.HasPrefix(pageOrigin, "http://") || strings.HasPrefix(pageOrigin, "https://") {
+		origins = append([]string{pageOrigin}, origins...)
+	}
+	for _, origin := range origins {
+		if err := chromedp.Run(ctx, storage.ClearDataForOrigin(origin, "all")); err != nil {
+			return utils.StepResult{Status: "error", Message: fmt.Sprintf("error clearing the storage of %s: %s", origin, err)}
+		}
+	}
 	return utils.StepResult{Status: "success"}
 }
 
+// storageOrigins returns the origins of the domains of recipe, with and without `www.` (e.g. `https://example.com` and `https://www.example.com`).
+// Wildcard domains only contribute their parent domain, the origins of their subdomains are unknown.
+func storageOrigins(recipe *parser.Recipe) []string {
+	origins := []string{}
+	for _, domain := range normalizeDomains(recipe.Domains) {
+		origins = append(origins, "https://"+domain, "https://www."+domain)
+	}
+	return origins
+}
+
 func (b *BrowserDriver) stepClick(ctx context.Context, step parser.Step) utils.StepResult {
 	b.logger.Debug("Executing recipe step", "action", step.Action, "selector", step.Selector)
 
 	opts := []chromedp.QueryOption{
 		chromedp.NodeReady,
 	}
-	opts = b.getSelectorTypeQueryOptions(step.SelectorType, opts)
+	selector, opts := b.getSelectorTypeQueryOptions(step, opts)
+	opts, err := b.getFrameQueryOptions(ctx, step, opts)
+	if err != nil {
+		return utils.StepResult{Status: "error", Message: err.Error(), ErrorCode: utils.ErrorCodeSelectorNotFound}
+	}
 
 	if err := chromedp.Run(ctx,
-		chromedp.Click(step.Selector, opts...),
+		chromedp.Click(selector, opts...),
 	); err != nil {
-		return utils.StepResult{Status: "error", Message: err.Error()}
+		return utils.StepResult{Status: "error", Message: err.Error(), ErrorCode: utils.ErrorCodeSelectorNotFound}
 	}
 	return utils.StepResult{Status: "success"}
 }
@@ -328,22 +555,30 @@ func (b *BrowserDriver) stepClick(ctx context.Context, step parser.Step) utils.S
 func (b *BrowserDriver) stepType(ctx context.Context, step parser.Step, credentials *vault.Credentials) utils.StepResult {
 	b.logger.Debug("Executing recipe step", "action", step.Action, "selector", step.Selector, "value", step.Value)
 
-	parsedValue, err := b.parseCredentialPlaceholders(step.Value, credentials)
+	parsedValue, err := b.parseCredentialPlaceholders(ctx, step.Value, credentials)
 	if err != nil {
 		b.logger.Error("Failed to parse credential placeholders for stepType", "error", err.Error())
-		return utils.StepResult{Status: "error", Message: fmt.Sprintf("Error processing credentials: %v", err)}
+		errorCode := utils.ErrorCodeAuthFailed
+		if errors.Is(err, vault.ErrTotpMissing) || errors.Is(err, utils.ErrTotpPromptUnavailable) || errors.Is(err, utils.ErrTotpPromptCanceled) || errors.Is(err, utils.ErrTotpPromptTimeout) {
+			errorCode = utils.ErrorCodeTwoFactorRequired
+		}
+		return utils.StepResult{Status: "error", Message: fmt.Sprintf("Error processing credentials: %v", err), ErrorCode: errorCode}
 	}
 	step.Value = parsedValue
 
 	opts := []chromedp.QueryOption{
 		chromedp.NodeReady,
 	}
-	opts = b.getSelectorTypeQueryOptions(step.SelectorType, opts)
+	selector, opts := b.getSelectorTypeQueryOptions(step, opts)
+	opts, err = b.getFrameQueryOptions(ctx, step, opts)
+	if err != nil {
+		return utils.StepResult{Status: "error", Message: err.Error(), ErrorCode: utils.ErrorCodeSelectorNotFound}
+	}
 
 	if err := chromedp.Run(ctx,
-		chromedp.SendKeys(step.Selector, step.Value, opts...),
+		chromedp.SendKeys(selector, step.Value, opts...),
 	); err != nil {
-		return utils.StepResult{Status: "error", Message: err.Error()}
+		return utils.StepResult{Status: "error", Message: err.Error(), ErrorCode: utils.ErrorCodeSelectorNotFound}
 	}
 	return utils.StepResult{Status: "success"}
 }
@@ -360,73 +595,164 @@ func (b *BrowserDriver) stepSleep(ctx context.Context, step parser.Step) utils.S
 	return utils.StepResult{Status: "success"}
 }
 
+// stepWaitForNetworkIdle waits until the page has no pending network requests, e.g. after a click in a single page application.
+// If the network doesn't become idle within the timeout (step.Value in seconds), the recipe continues.
+func (b *BrowserDriver) stepWaitForNetworkIdle(ctx context.Context, step parser.Step) utils.StepResult {
+	b.logger.Debug("Executing recipe step", "action", step.Action, "timeout", step.Value)
+
+	timeout, err := parser.ParseNetworkIdleTimeout(step.Value)
+	if err != nil {
+		return utils.StepResult{Status: "error", Message: err.Error(), ErrorCode: utils.ErrorCodeInvalidRecipe}
+	}
+
+	idleCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if err := waitForNetworkIdle(idleCtx, true); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			b.logger.Warn("Network did not become idle within the timeout, continuing", "action", step.Action, "timeout", timeout)
+			return utils.StepResult{Status: "success"}
+		}
+		return utils.StepResult{Status: "error", Message: err.Error(), ErrorCode: utils.ErrorCodeNetwork}
+	}
+
+	return utils.StepResult{Status: "success"}
+}
+
 func (b *BrowserDriver) stepWaitFor(ctx context.Context, step parser.Step) utils.StepResult {
 	b.logger.Debug("Executing recipe step", "action", step.Action, "selector", step.Selector)
 
 	opts := []chromedp.QueryOption{}
-	opts = b.getSelectorTypeQueryOptions(step.SelectorType, opts)
+	selector, opts := b.getSelectorTypeQueryOptions(step, opts)
+	opts, err := b.getFrameQueryOptions(ctx, step, opts)
+	if err != nil {
+		return utils.StepResult{Status: "error", Message: err.Error(), ErrorCode: utils.ErrorCodeSelectorNotFound}
+	}
 	if err := chromedp.Run(ctx,
-		chromedp.WaitReady(step.Selector, opts...),
+		chromedp.WaitReady(selector, opts...),
 	); err != nil {
-		return utils.StepResult{Status: "error", Message: err.Error()}
+		return utils.StepResult{Status: "error", Message: err.Error(), ErrorCode: utils.ErrorCodeSelectorNotFound}
 	}
 	return utils.StepResult{Status: "success"}
 }
 
+// getDownloadConcurrency returns the number of parallel downloads of a `downloadAll` step.
+// The option of the step has precedence over the configured default (`buchhalter_download_concurrency`).
+func (b *BrowserDriver) getDownloadConcurrency(step parser.Step) int {
+	if step.Concurrency > 0 {
+		return step.Concurrency
+	}
+	if b.downloadConcurrency > 0 {
+		return b.downloadConcurrency
+	}
+	return parser.DefaultDownloadConcurrency
+}
+
+// getMaxFiles returns the maximum number of documents a download step downloads, `0` for all of them.
+// The option `maxFiles` of the step has precedence over the one of the recipe and the configured default (`buchhalter_max_download_files_per_receipt`).
+func (b *BrowserDriver) getMaxFiles(step parser.Step) int {
+	if step.MaxFiles != nil {
+		return *step.MaxFiles
+	}
+	if b.recipeMaxFiles != nil {
+		return *b.recipeMaxFiles
+	}
+	return b.maxFilesDownloaded
+}
+
+// maxDownloads returns how many of the available downloads of a step are downloaded (`buchhalter_max_download_files_per_receipt`).
+// A maxFiles of `0` downloads all of them, negative values are treated as `0`.
+func maxDownloads(available, maxFiles int) int {
+	if maxFiles <= 0 || maxFiles > available {
+		return available
+	}
+	return maxFiles
+}
+
 func (b *BrowserDriver) stepDownloadAll(ctx context.Context, step parser.Step) utils.StepResult {
-	b.logger.Debug("Executing recipe step", "action", step.Action, "selector", step.Selector, "buchhalter_max_download_files_per_receipt", b.maxFilesDownloaded)
+	maxFiles := b.getMaxFiles(step)
+	b.logger.Debug("Executing recipe step", "action", step.Action, "selector", step.Selector, "max_files", maxFiles)
 
 	opts := []chromedp.QueryOption{}
-	opts = b.getSelectorTypeQueryOptions(step.SelectorType, opts)
+	selector, opts := b.getSelectorTypeQueryOptions(step, opts)
+	// The nodes are queried with the default search, except for converted selectors (e.g. shadow DOM JS expressions)
+	nodesOpts := []chromedp.QueryOption{}
+	if selector != step.Selector {
+		nodesOpts = opts
+	}
+	// Nodes inside an iframe are queried from the iframe content document
+	frameOpts, err := b.getFrameQueryOptions(ctx, step, []chromedp.QueryOption{})
+	if err != nil {
+		return utils.StepResult{Status: "error", Message: err.Error(), ErrorCode: utils.ErrorCodeSelectorNotFound}
+	}
+	opts = append(opts, frameOpts...)
+	nodesOpts = append(nodesOpts, frameOpts...)
 	var nodes []*cdp.Node
-	err := chromedp.Run(ctx, chromedp.Tasks{
-		chromedp.WaitReady(step.Selector, opts...),
-		chromedp.Nodes(step.Selector, &nodes),
+	err = chromedp.Run(ctx, chromedp.Tasks{
+		chromedp.WaitReady(selector, opts...),
+		chromedp.Nodes(selector, &nodes, nodesOpts...),
 	})
 	if err != nil {
-		return utils.StepResult{Status: "error", Message: err.Error()}
+		return utils.StepResult{Status: "error", Message: err.Error(), ErrorCode: utils.ErrorCodeSelectorNotFound}
 	}
 
-	b.downloadedFilesCount = 0
-
-	// Limit nodes to 2 to prevent too many downloads at once/rate limiting
-	concurrentDownloadsPool := make(chan struct{}, 2)
+	b.downloadedFilesCount.Store(0)
+
+	// Limit concurrent downloads to prevent too many downloads at once/rate limiting
+	concurrency := b.getDownloadConcurrency(step)
+	b.logger.Debug("Executing recipe step ... limiting concurrent downloads", "action", step.Action, "concurrency", concurrency)
+	concurrentDownloadsPool := make(chan struct{}, concurrency)
+	// clicks assigns the downloads to the clicks, each click is completed once (by its download or a fallback)
+	clicks := newDownloadClicks()
+	// newTabs are the tabs the clicks opened (`viaNewTab`), e.g. portals that show the PDF in a new tab instead of downloading it
+	newTabs := make(chan newTab, len(nodes))
+	var opener target.ID
+	if c := chromedp.FromContext(ctx); c != nil && c.Target != nil {
+		opener = c.Target.TargetID
+	}
+	seenTabs := map[target.ID]bool{}
 	wg := &sync.WaitGroup{}
 	chromedp.ListenTarget(ctx, func(v interface{}) {
 		switch ev := v.(type) {
+		case *target.EventTargetCreated:
+			b.queueNewTab(step, ev.TargetInfo, opener, seenTabs, newTabs)
+		case *target.EventTargetInfoChanged:
+			b.queueNewTab(step, ev.TargetInfo, opener, seenTabs, newTabs)
 		case *browser.EventDownloadWillBegin:
 			b.logger.Debug("Executing recipe step ... download begins", "action", step.Action, "guid", ev.GUID, "url", ev.URL)
+			clicks.begin(ev.GUID)
 		case *browser.EventDownloadProgress:
 			switch ev.State {
 			case browser.DownloadProgressStateCompleted:
 				b.logger.Debug("Executing recipe step ... download completed", "action", step.Action, "guid", ev.GUID, "received_bytes", ev.ReceivedBytes)
-				b.downloadedFilesCount++
-				<-concurrentDownloadsPool
-				wg.Done()
+				b.downloadedFilesCount.Add(1)
+				clicks.end(ev.GUID)
 			case browser.DownloadProgressStateCanceled:
 				b.logger.Debug("Executing recipe step ... download cancelled", "action", step.Action, "guid", ev.GUID, "received_bytes", ev.ReceivedBytes)
-				<-concurrentDownloadsPool
-				wg.Done()
+				clicks.end(ev.GUID)
 			}
 		}
 	})
 
 	// Click on download link (for client-side js stuff)
 	x := 0
-	sleepTime := 1500 * time.Millisecond
+	sleepTime := parser.DefaultDownloadSleepDuration
 	if step.SleepDuration > 0 {
 		sleepTime = time.Duration(step.SleepDuration) * time.Millisecond
 	}
 	for _, n := range nodes {
-		// Only download maxFilesDownloaded files
-		if b.maxFilesDownloaded > 0 && x >= b.maxFilesDownloaded {
-			b.logger.Debug("Breaking download loop, because max_files_downloaded is reached", "action", step.Action, "max_files_downloaded", b.maxFilesDownloaded, "loop", x)
+		// Only download maxFiles files
+		if x >= maxDownloads(len(nodes), maxFiles) {
+			b.logger.Debug("Breaking download loop, because max_files_downloaded is reached", "action", step.Action, "max_files_downloaded", maxFiles, "loop", x)
 			break
 		}
 
-		b.logger.Debug("Executing recipe step ... trigger download click", "action", step.Action, "selector", n.FullXPath()+step.Value, "loop", x, "max_files_downloaded", b.maxFilesDownloaded, "len(nodes)", len(nodes))
+		b.logger.Debug("Executing recipe step ... trigger download click", "action", step.Action, "selector", n.FullXPath()+step.Value, "loop", x, "max_files_downloaded", maxFiles, "len(nodes)", len(nodes))
 		wg.Add(1)
 		concurrentDownloadsPool <- struct{}{}
+		click := clicks.add(func() {
+			<-concurrentDownloadsPool
+			wg.Done()
+		})
 		if err := chromedp.Run(ctx, fetch.Enable(), chromedp.Tasks{
 			chromedp.MouseClickNode(n),
 		}); err != nil {
@@ -437,15 +763,47 @@ func (b *BrowserDriver) stepDownloadAll(ctx context.Context, step parser.Step) u
 			// - Use a more specific selector
 			// - Use a different selector type
 			// See https://pkg.go.dev/github.com/chromedp/chromedp#hdr-Query_Options for more information
-			return utils.StepResult{Status: "error", Message: err.Error()}
+			return utils.StepResult{Status: "error", Message: err.Error(), ErrorCode: utils.ErrorCodeSelectorNotFound}
 		}
 
 		if step.Value != "" {
 			if err := chromedp.Run(ctx, fetch.Enable(), chromedp.Tasks{
-				chromedp.WaitVisible(n.FullXPath() + step.Value),
-				chromedp.Click(n.FullXPath() + step.Value),
+				chromedp.WaitVisible(n.FullXPath()+step.Value, frameOpts...),
+				chromedp.Click(n.FullXPath()+step.Value, frameOpts...),
 			}); err != nil {
-				return utils.StepResult{Status: "error", Message: err.Error()}
+				return utils.StepResult{Status: "error", Message: err.Error(), ErrorCode: utils.ErrorCodeSelectorNotFound}
+			}
+		}
+
+		// Some portals only offer a print preview of the invoice (or open it in a new tab), without a download
+		if step.PrintFallback || step.ViaNewTab {
+			timeout := printFallbackTimeout
+			if step.ViaNewTab {
+				timeout = newTabTimeout
+			}
+			select {
+			case <-click.began:
+			case tab := <-newTabs:
+				b.logger.Debug("Executing recipe step ... new tab opened, downloading its document", "action", step.Action, "loop", x, "url", tab.url)
+				file, err := b.downloadNewTab(ctx, tab, x+1)
+				if err != nil {
+					return utils.StepResult{Status: "error", Message: err.Error(), ErrorCode: utils.ErrorCodeDownloadFailed}
+				}
+				b.logger.Debug("Executing recipe step ... downloaded document of new tab", "action", step.Action, "file", file)
+				b.downloadedFilesCount.Add(1)
+				clicks.fallback(click)
+			case <-time.After(timeout):
+				if !step.PrintFallback {
+					return utils.StepResult{Status: "error", Message: fmt.Sprintf("neither a download started nor a new tab opened within %s after the click", timeout), ErrorCode: utils.ErrorCodeDownloadFailed}
+				}
+				b.logger.Info("No download started, printing the page to PDF instead", "action", step.Action, "loop", x, "timeout", timeout.String())
+				pdfFile, err := b.printPageToPDF(ctx, x+1)
+				if err != nil {
+					return utils.StepResult{Status: "error", Message: err.Error(), ErrorCode: utils.ErrorCodeDownloadFailed}
+				}
+				b.logger.Debug("Executing recipe step ... printed page to PDF", "action", step.Action, "file", pdfFile)
+				b.downloadedFilesCount.Add(1)
+				clicks.fallback(click)
 			}
 		}
 
@@ -464,6 +822,18 @@ func (b *BrowserDriver) stepDownloadAll(ctx context.Context, step parser.Step) u
 	return utils.StepResult{Status: "success"}
 }
 
+// queueNewTab sends a new tab opened by a click of a `viaNewTab` step to newTabs, each tab only once.
+func (b *BrowserDriver) queueNewTab(step parser.Step, info *target.Info, opener target.ID, seenTabs map[target.ID]bool, newTabs chan<- newTab) {
+	if !step.ViaNewTab || !isNewTabOf(info, opener) || seenTabs[info.TargetID] {
+		return
+	}
+	seenTabs[info.TargetID] = true
+	select {
+	case newTabs <- newTab{id: info.TargetID, url: info.URL}:
+	default:
+	}
+}
+
 func (b *BrowserDriver) stepTransform(step parser.Step) utils.StepResult {
 	b.logger.Debug("Executing recipe step", "action", step.Action, "value", step.Value)
 
@@ -471,14 +841,14 @@ func (b *BrowserDriver) stepTransform(step parser.Step) utils.StepResult {
 	case "unzip":
 		zipFiles, err := utils.FindFiles(b.downloadsDirectory, ".zip")
 		if err != nil {
-			return utils.StepResult{Status: "error", Message: fmt.Sprintf("Error while finding zip files: %s", err)}
+			return utils.StepResult{Status: "error", Message: fmt.Sprintf("Error while finding zip files: %s", err), ErrorCode: utils.ErrorCodeDownloadFailed}
 		}
 		for _, s := range zipFiles {
 			b.logger.Debug("Executing recipe step ... unzipping file", "action", step.Action, "source", s, "destination", b.downloadsDirectory)
 			b.logger.Info("Unzipping file", "source", s, "destination", b.downloadsDirectory)
-			err := utils.UnzipFile(s, b.downloadsDirectory)
+			err := utils.UnzipFile(s, b.downloadsDirectory, b.unzipLimits)
 			if err != nil {
-				return utils.StepResult{Status: "error", Message: err.Error()}
+				return utils.StepResult{Status: "error", Message: err.Error(), ErrorCode: utils.ErrorCodeDownloadFailed}
 			}
 		}
 	}
@@ -489,55 +859,123 @@ func (b *BrowserDriver) stepTransform(step parser.Step) utils.StepResult {
 func (b *BrowserDriver) stepMove(step parser.Step, documentArchive *archive.DocumentArchive) utils.StepResult {
 	b.logger.Debug("Executing recipe step", "action", step.Action, "value", step.Value)
 
-	b.newFilesCount = 0
-	err := filepath.WalkDir(b.downloadsDirectory, func(s string, d fs.DirEntry, e error) error {
+	var err error
+	b.newFiles, err = moveDownloads(b.logger, b.downloadsDirectory, step.Value, b.supplier, b.expectedMimeType, documentArchive)
+	b.newFilesCount = len(b.newFiles)
+	if err != nil {
+		return utils.StepResult{Status: "error", Message: err.Error(), ErrorCode: utils.ErrorCodeDownloadFailed}
+	}
+
+	return utils.StepResult{Status: "success"}
+}
+
+// moveDownloads moves the downloaded files of supplier matching pattern (the value of a `move` step) to the document archive.
+// Files that are no valid document (see utils.ValidateFileType) and documents already in the archive are skipped.
+// It returns the new files in the archive.
+func moveDownloads(logger *slog.Logger, downloadsDirectory, pattern, supplier, expectedMimeType string, documentArchive *archive.DocumentArchive) ([]string, error) {
+	var newFiles []string
+	err := filepath.WalkDir(downloadsDirectory, func(s string, d fs.DirEntry, e error) error {
 		if e != nil {
 			return e
 		}
-		b.logger.Debug("Matching filenames", "action", step.Action, "value", step.Value, "filename", d.Name())
-		match, e := regexp.MatchString(step.Value, d.Name())
+		// The files of extracted archives keep their directories, only files are moved
+		if d.IsDir() || d.Name() == utils.StagingMarkerFileName {
+			return nil
+		}
+		logger.Debug("Matching filenames", "action", "move", "value", pattern, "filename", d.Name())
+		match, e := regexp.MatchString(pattern, d.Name())
 		if e != nil {
 			return e
 		}
 		if match {
-			srcFile := filepath.Join(b.downloadsDirectory, d.Name())
+			srcFile := s
+			// Portals may serve an error page instead of the document
+			if err := utils.ValidateFileType(srcFile, expectedMimeType); err != nil {
+				logger.Warn("Rejecting downloaded file, it is not a valid document", "action", "move", "source", srcFile, "error", err)
+				return nil
+			}
 			// Check if file already exists
-			if !documentArchive.FileExists(srcFile) {
-				b.logger.Debug("Executing recipe step ... moving file", "action", step.Action, "source", srcFile, "destination", filepath.Join(b.documentsDirectory, d.Name()))
-				b.logger.Info("Moving file", "source", srcFile, "destination", filepath.Join(b.documentsDirectory, d.Name()))
-				b.newFilesCount++
-				dstFile := filepath.Join(b.documentsDirectory, d.Name())
-				_, err := utils.CopyFile(srcFile, dstFile)
+			if !documentArchive.DocumentExists(srcFile, supplier) {
+				fileInfo, err := d.Info()
+				if err != nil {
+					return err
+				}
+				dstDirectory, err := documentArchive.DocumentDirectory(supplier, fileInfo.ModTime())
+				if err != nil {
+					return err
+				}
+				dstFile := filepath.Join(dstDirectory, downloadFilename(downloadsDirectory, srcFile))
+				logger.Debug("Executing recipe step ... moving file", "action", "move", "source", srcFile, "destination", dstFile)
+				// Documents are never overwritten, e.g. the monthly `invoice.pdf` of a portal
+				dstFile, err = utils.CopyFileUnique(srcFile, dstFile)
 				if err != nil {
 					return err
 				}
+				logger.Info("Moving file", "source", srcFile, "destination", dstFile)
 				err = documentArchive.AddFile(dstFile)
 				if err != nil {
 					return err
 				}
+				newFiles = append(newFiles, dstFile)
 			}
 		}
 		return nil
 	})
-	if err != nil {
-		return utils.StepResult{Status: "error", Message: err.Error()}
-	}
+	return newFiles, err
+}
 
-	return utils.StepResult{Status: "success"}
+// downloadFilename returns the filename of the downloaded file in the document archive.
+// The files of extracted archives are named after their path in downloadsDirectory (e.g. `2024-03-invoice.pdf` for `2024/03/invoice.pdf`),
+// so the files of different directories with the same name don't collide.
+func downloadFilename(downloadsDirectory, file string) string {
+	relativePath, err := filepath.Rel(downloadsDirectory, file)
+	if err != nil || strings.HasPrefix(relativePath, "..") {
+		return filepath.Base(file)
+	}
+	return strings.Join(strings.Split(filepath.ToSlash(relativePath), "/"), "-")
 }
 
 func (b *BrowserDriver) stepRunScript(ctx context.Context, step parser.Step) utils.StepResult {
 	b.logger.Debug("Executing recipe step", "action", step.Action, "value", step.Value)
 
-	var res []string
+	// The raw JSON result supports all return types (incl. undefined)
+	var res []byte
 	if err := chromedp.Run(ctx,
 		chromedp.Evaluate(step.Value, &res),
 	); err != nil {
-		return utils.StepResult{Status: "error", Message: err.Error()}
+		return utils.StepResult{Status: "error", Message: err.Error(), ErrorCode: utils.ErrorCodeScriptFailed}
+	}
+	if step.Expect == nil {
+		return utils.StepResult{Status: "success"}
+	}
+
+	result := scriptResultString(res)
+	if result != *step.Expect {
+		b.logger.Debug("Executing recipe step ... unexpected script result", "action", step.Action, "result", result, "expect", *step.Expect)
+		return utils.StepResult{Status: "error", Message: fmt.Sprintf("script returned `%s`, expected `%s`", result, *step.Expect), ErrorCode: utils.ErrorCodeScriptFailed}
 	}
 	return utils.StepResult{Status: "success"}
 }
 
+// scriptResultString returns the result of a script (JSON encoded) as compared with the `expect` option:
+// strings as is, undefined and null as empty string and all other values in their JSON encoding.
+func scriptResultString(res []byte) string {
+	res = bytes.TrimSpace(res)
+	if len(res) == 0 || string(res) == "null" {
+		return ""
+	}
+
+	var str string
+	if err := json.Unmarshal(res, &str); err == nil {
+		return str
+	}
+	compacted := bytes.Buffer{}
+	if err := json.Compact(&compacted, res); err != nil {
+		return string(res)
+	}
+	return compacted.String()
+}
+
 func (b *BrowserDriver) stepRunScriptDownloadUrls(ctx context.Context, step parser.Step) utils.StepResult {
 	b.logger.Debug("Executing recipe step", "action", step.Action, "value", step.Value)
 
@@ -556,64 +994,84 @@ func (b *BrowserDriver) stepRunScriptDownloadUrls(ctx context.Context, step pars
 				return nil
 			}),
 		); err != nil {
-			return utils.StepResult{Status: "error", Message: err.Error()}
+			return utils.StepResult{Status: "error", Message: err.Error(), ErrorCode: utils.ErrorCodeDownloadFailed}
 		}
 	}
 
 	return utils.StepResult{Status: "success"}
 }
 
-func (b *BrowserDriver) parseCredentialPlaceholders(value string, credentials *vault.Credentials) (string, error) {
+func (b *BrowserDriver) parseCredentialPlaceholders(ctx context.Context, value string, credentials *vault.Credentials) (string, error) {
 	value = strings.Replace(value, "{{ username }}", credentials.Username, -1)
 	value = strings.Replace(value, "{{ password }}", credentials.Password, -1)
+	if !strings.Contains(value, "{{ totp }}") {
+		return value, nil
+	}
 
-	if strings.Contains(value, "{{ totp }}") {
-		if credentials != nil && credentials.VaultProvider != nil {
-			// Try to assert the type to *vault.Provider1Password
-			// In the future, this might need to be a more generic interface call
-			if provider, ok := credentials.VaultProvider.(interface{ GetTotpForItem(string) (string, error) }); ok {
-				totp, err := provider.GetTotpForItem(credentials.Id)
-				if err != nil {
-					b.logger.Error("Failed to fetch TOTP on demand", "credential_id", credentials.Id, "error", err.Error())
-					// Decide how to handle error: return original value, or empty string for totp, or propagate error
-					// For now, we'll log the error and proceed with an empty TOTP, which will likely cause the step to fail.
-					// This makes the failure explicit at the point of use.
-					value = strings.Replace(value, "{{ totp }}", "", -1) // Replace with empty if fetch fails
-					return value, err                                    // Propagate the error from GetTotpForItem
-				} else { // err == nil
-					if totp == "" { // Fetched TOTP is empty
-						errMsg := fmt.Sprintf("fetched TOTP for credential ID %s is empty. Please check the 1Password item", credentials.Id)
-						b.logger.Error(errMsg, "credential_id", credentials.Id) // Log as error
-						return value, errors.New(errMsg)                        // Return original value and the error
-					} else { // Fetched TOTP is not empty and fetch was successful
-						// Avoid logging the actual TOTP for security, log its presence or length
-						b.logger.Info("Successfully fetched TOTP on demand", "credential_id", credentials.Id, "totp_present", true)
-						value = strings.Replace(value, "{{ totp }}", totp, -1)
-						credentials.Totp = totp // Optionally update the credentials struct's Totp field
-						// Successful path, error is nil, will be returned by the function's main return path
-					}
-				}
-			} else {
-				b.logger.Warn("VaultProvider does not support GetTotpForItem or is not of expected type. {{totp}} placeholder will not be resolved.", "credential_id", credentials.Id)
-				return value, fmt.Errorf("VaultProvider for credential ID %s does not support GetTotpForItem or is not of expected type; {{totp}} placeholder could not be resolved", credentials.Id)
-			}
-		} else {
-			b.logger.Warn("Credentials or VaultProvider is nil, cannot fetch TOTP on demand. {{totp}} placeholder will not be resolved.", "credential_id", credentials.Id)
-			// Return an error because we expected to fetch a TOTP but couldn't due to missing provider/credentials info for it.
-			return value, fmt.Errorf("credentials or VaultProvider is nil for credential ID %s, cannot fetch TOTP on demand; {{totp}} placeholder could not be resolved", credentials.Id)
-		}
-	} // else, no {{ totp }} placeholder found, nothing to do for totp
+	totp, err := b.totp(ctx, credentials)
+	if err != nil {
+		return value, err
+	}
+	utils.RegisterSecret(totp)
+	credentials.Totp = totp
+	return strings.Replace(value, "{{ totp }}", totp, -1), nil
+}
+
+// totp returns the current TOTP code of credentials, fetched from the vault on demand.
+// If the vault has no TOTP for the item (e.g. the 2FA seed isn't stored there), the user is asked for the current code (see SetTotpPrompt).
+func (b *BrowserDriver) totp(ctx context.Context, credentials *vault.Credentials) (string, error) {
+	if credentials == nil || credentials.VaultProvider == nil {
+		b.logger.Warn("Credentials or VaultProvider is nil, cannot fetch TOTP on demand. {{totp}} placeholder will not be resolved.")
+		return "", errors.New("credentials or VaultProvider is nil, cannot fetch TOTP on demand; {{totp}} placeholder could not be resolved")
+	}
+	provider, ok := credentials.VaultProvider.(interface {
+		GetTotpForItem(string, vault.CredentialFields) (string, error)
+	})
+	if !ok {
+		b.logger.Warn("VaultProvider does not support GetTotpForItem or is not of expected type. {{totp}} placeholder will not be resolved.", "credential_id", credentials.Id)
+		return "", fmt.Errorf("VaultProvider for credential ID %s does not support GetTotpForItem or is not of expected type; {{totp}} placeholder could not be resolved", credentials.Id)
+	}
+
+	totp, err := provider.GetTotpForItem(credentials.Id, credentials.Fields)
+	if err != nil && !errors.Is(err, vault.ErrTotpMissing) {
+		b.logger.Error("Failed to fetch TOTP on demand", "credential_id", credentials.Id, "error", err.Error())
+		return "", err
+	}
+	if err == nil && len(totp) > 0 {
+		// Avoid logging the actual TOTP for security, log its presence
+		b.logger.Info("Successfully fetched TOTP on demand", "credential_id", credentials.Id, "totp_present", true)
+		return totp, nil
+	}
+	if err == nil {
+		err = fmt.Errorf("fetched TOTP for credential ID %s is empty. Please check the vault item", credentials.Id)
+	}
 
-	return value, nil
+	b.logger.Info("No TOTP in the vault, asking for the 2FA code", "credential_id", credentials.Id, "supplier", b.supplier, "timeout", b.totpPrompt.Timeout())
+	totp, promptErr := b.totpPrompt.Ask(ctx, b.supplier)
+	if promptErr != nil {
+		b.logger.Error("No 2FA code entered", "credential_id", credentials.Id, "supplier", b.supplier, "error", promptErr.Error())
+		return "", fmt.Errorf("%w: %w", err, promptErr)
+	}
+	b.logger.Info("2FA code entered", "credential_id", credentials.Id, "supplier", b.supplier)
+	return totp, nil
 }
 
-func (b *BrowserDriver) disableImages(ctx context.Context) func(event interface{}) {
+// interceptRequests handles the requests paused by the fetch domain: images and domains the domain policy doesn't allow are blocked.
+func (b *BrowserDriver) interceptRequests(ctx context.Context) func(event interface{}) {
 	return func(event interface{}) {
 		switch ev := event.(type) {
 		case *fetch.EventRequestPaused:
 			go func() {
 				c := chromedp.FromContext(ctx)
 				ctx := cdp.WithExecutor(ctx, c.Target)
+				if !b.domainPolicy.Allows(ev.Request.URL) {
+					b.logger.Debug("Blocked request to a domain the recipe may not contact", "url", ev.Request.URL, "resource_type", ev.ResourceType)
+					err := fetch.FailRequest(ev.RequestID, network.ErrorReasonBlockedByClient).Do(ctx)
+					if err != nil {
+						b.logger.Debug("Failed to block request", "error", err.Error())
+					}
+					return
+				}
 				if ev.ResourceType == network.ResourceTypeImage {
 					err := fetch.FailRequest(ev.RequestID, network.ErrorReasonBlockedByClient).Do(ctx)
 					if err != nil {
@@ -632,6 +1090,51 @@ func (b *BrowserDriver) disableImages(ctx context.Context) func(event interface{
 	}
 }
 
+// restrictNewTabs enforces the domain policy on the tabs opened by the tab of ctx (e.g. by `window.open` or a link with `target="_blank"`):
+// a tab navigating to a domain the policy doesn't allow is closed, the requests of the other tabs are intercepted like in the tab of ctx.
+func (b *BrowserDriver) restrictNewTabs(ctx context.Context) {
+	var opener target.ID
+	if c := chromedp.FromContext(ctx); c != nil && c.Target != nil {
+		opener = c.Target.TargetID
+	}
+	restrictedTabs := map[target.ID]bool{}
+	chromedp.ListenTarget(ctx, func(event interface{}) {
+		var info *target.Info
+		switch ev := event.(type) {
+		case *target.EventTargetCreated:
+			info = ev.TargetInfo
+		case *target.EventTargetInfoChanged:
+			info = ev.TargetInfo
+		}
+		if info == nil || info.Type != "page" || len(opener) == 0 || info.OpenerID != opener {
+			return
+		}
+
+		if !b.domainPolicy.Allows(info.URL) {
+			b.logger.Debug("Closing new tab of a domain the recipe may not contact", "url", info.URL)
+			go func() {
+				c := chromedp.FromContext(ctx)
+				if err := target.CloseTarget(info.TargetID).Do(cdp.WithExecutor(ctx, c.Browser)); err != nil {
+					b.logger.Debug("Failed to close new tab", "url", info.URL, "error", err.Error())
+				}
+			}()
+			return
+		}
+		if restrictedTabs[info.TargetID] {
+			return
+		}
+		restrictedTabs[info.TargetID] = true
+		go func() {
+			// The tab is closed with ctx, at the end of the recipe (or earlier, e.g. by `viaNewTab`)
+			tabCtx, _ := chromedp.NewContext(ctx, chromedp.WithTargetID(info.TargetID))
+			chromedp.ListenTarget(tabCtx, b.interceptRequests(tabCtx))
+			if err := chromedp.Run(tabCtx, fetch.Enable()); err != nil {
+				b.logger.Debug("Failed to enable the request interception of new tab", "url", info.URL, "error", err.Error())
+			}
+		}()
+	})
+}
+
 func (b *BrowserDriver) enableLifeCycleEvents() chromedp.ActionFunc {
 	return func(ctx context.Context) error {
 		err := page.Enable().Do(ctx)
@@ -646,46 +1149,141 @@ func (b *BrowserDriver) enableLifeCycleEvents() chromedp.ActionFunc {
 	}
 }
 
+// loadEventTimeout is the maximum time to wait for the `networkIdle` lifecycle event after a navigation.
+// Pages with long-polling or streaming requests never reach it.
+const loadEventTimeout = 30 * time.Second
+
+// waitForLoadEvent waits for the `networkIdle` lifecycle event, at most loadEventTimeout.
+// If the page doesn't become idle in time, it returns without an error: The page is usable anyway.
 func (b *BrowserDriver) waitForLoadEvent(ctx context.Context) error {
-	ch := make(chan struct{})
+	return b.waitForLoadEventWithin(ctx, loadEventTimeout)
+}
+
+func (b *BrowserDriver) waitForLoadEventWithin(ctx context.Context, timeout time.Duration) error {
+	idleCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := waitForNetworkIdle(idleCtx, false)
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		b.logger.Warn("Page did not reach networkIdle within the timeout, continuing", "timeout", timeout)
+		return nil
+	}
+	return err
+}
+
+// networkIdleQuietPeriod is the time without pending requests after which the network counts as idle.
+// Chrome uses the same period for its `networkIdle` lifecycle event.
+const networkIdleQuietPeriod = 500 * time.Millisecond
+
+// waitForNetworkIdle waits for the `networkIdle` lifecycle event of the page.
+// Chrome emits this event only for navigations. With trackRequests, a quiet period
+// without pending requests (started after the call) counts as idle as well, e.g. for single page applications.
+//
+// The listener is removed on return, also if the page never becomes idle and ctx is cancelled.
+func waitForNetworkIdle(ctx context.Context, trackRequests bool) error {
+	idle := make(chan struct{})
+	var idleOnce sync.Once
+	markIdle := func() {
+		idleOnce.Do(func() { close(idle) })
+	}
+
+	var mu sync.Mutex
+	pendingRequests := map[network.RequestID]bool{}
+	var quietTimer *time.Timer
+	// resetQuietTimer must be called with mu locked
+	resetQuietTimer := func() {
+		if quietTimer != nil {
+			quietTimer.Stop()
+		}
+		if len(pendingRequests) == 0 {
+			quietTimer = time.AfterFunc(networkIdleQuietPeriod, markIdle)
+		}
+	}
+	defer func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if quietTimer != nil {
+			quietTimer.Stop()
+		}
+	}()
+
 	cctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
 	chromedp.ListenTarget(cctx, func(ev interface{}) {
 		switch e := ev.(type) {
 		case *page.EventLifecycleEvent:
 			if e.Name == "networkIdle" {
-				cancel()
-				close(ch)
+				markIdle()
+			}
+		case *network.EventRequestWillBeSent:
+			if trackRequests {
+				mu.Lock()
+				pendingRequests[e.RequestID] = true
+				resetQuietTimer()
+				mu.Unlock()
+			}
+		case *network.EventLoadingFinished:
+			if trackRequests {
+				mu.Lock()
+				delete(pendingRequests, e.RequestID)
+				resetQuietTimer()
+				mu.Unlock()
+			}
+		case *network.EventLoadingFailed:
+			if trackRequests {
+				mu.Lock()
+				delete(pendingRequests, e.RequestID)
+				resetQuietTimer()
+				mu.Unlock()
 			}
 		}
 	})
+	if trackRequests {
+		mu.Lock()
+		resetQuietTimer()
+		mu.Unlock()
+	}
 
 	select {
-	case <-ch:
+	case <-idle:
 		return nil
 	case <-ctx.Done():
 		return ctx.Err()
 	}
 }
 
-func (b *BrowserDriver) getSelectorTypeQueryOptions(selectorType string, opts []chromedp.QueryOption) []chromedp.QueryOption {
+// getSelectorTypeQueryOptions returns the selector and query options for the selector type of step.
+// For most selector types, the selector is returned as is.
+// Shadow DOM piercing selectors are converted into a JS expression.
+func (b *BrowserDriver) getSelectorTypeQueryOptions(step parser.Step, opts []chromedp.QueryOption) (string, []chromedp.QueryOption) {
+	selectorType := step.SelectorType
+	if len(selectorType) == 0 {
+		selectorType = parser.InferSelectorType(step.Selector)
+		if len(selectorType) > 0 {
+			b.logger.Warn("Recipe step has no selector type, using inferred selector type", "action", step.Action, "selector", step.Selector, "selector_type", selectorType)
+		}
+	}
+
 	switch selectorType {
-	case "JSPath":
+	case parser.SelectorTypeJSPath:
 		opts = append(opts, chromedp.ByJSPath)
-	case "Search":
+	case parser.SelectorTypeSearch, parser.SelectorTypeXPath:
 		opts = append(opts, chromedp.BySearch)
-	case "Query":
+	case parser.SelectorTypeQuery:
 		opts = append(opts, chromedp.ByQuery)
 	// Possible future options - Not implemented right now, as they are not needed
 	// case "Func":
 	// 	opts = append(opts, chromedp.ByFunc)
-	case "ID":
+	case parser.SelectorTypeID:
 		opts = append(opts, chromedp.ByID)
-	case "NodeID":
+	case parser.SelectorTypeNodeID:
 		opts = append(opts, chromedp.ByNodeID)
-	case "QueryAll":
+	case parser.SelectorTypeQueryAll:
 		opts = append(opts, chromedp.ByQueryAll)
+	case parser.SelectorTypeShadow:
+		return shadowSelectorExpression(step.Selector), append(opts, chromedp.ByJSPath)
 	}
 
-	return opts
+	return step.Selector, opts
 }
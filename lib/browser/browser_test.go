@@ -0,0 +1,477 @@
+package browser
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"buchhalter/lib/archive"
+	"buchhalter/lib/parser"
+	"buchhalter/lib/utils"
+	"buchhalter/lib/vault"
+
+	"github.com/chromedp/chromedp"
+)
+
+// chromeExecutables are the binaries the fixture tests try to find on the PATH.
+var chromeExecutables = []string{"google-chrome", "google-chrome-stable", "chromium", "chromium-browser", "chrome"}
+
+// newFixtureBrowserContext starts a headless Chrome to run recipe steps against a local fixture.
+// The test is skipped if no Chrome is installed.
+func newFixtureBrowserContext(t *testing.T) context.Context {
+	t.Helper()
+
+	execPath := ""
+	for _, executable := range chromeExecutables {
+		if p, err := exec.LookPath(executable); err == nil {
+			execPath = p
+			break
+		}
+	}
+	if len(execPath) == 0 {
+		t.Skip("Chrome is not installed, skipping browser fixture test")
+	}
+
+	opts := append(chromedp.DefaultExecAllocatorOptions[:], chromedp.ExecPath(execPath))
+	allocatorCtx, allocatorCancel := chromedp.NewExecAllocator(context.Background(), opts...)
+	ctx, cancel := chromedp.NewContext(allocatorCtx)
+	ctx, timeoutCancel := context.WithTimeout(ctx, 30*time.Second)
+	t.Cleanup(func() {
+		timeoutCancel()
+		cancel()
+		allocatorCancel()
+	})
+
+	return ctx
+}
+
+func TestStepWaitForNetworkIdle(t *testing.T) {
+	ctx := newFixtureBrowserContext(t)
+
+	// A page loading its invoices with a slow request after a click (like a single page application)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><body>
+<button id="load" onclick="setTimeout(() => fetch('/invoices').then(r => r.text()).then(t => document.getElementById('result').textContent = t), 200)">Load</button>
+<div id="result"></div>
+</body></html>`)
+	})
+	mux.HandleFunc("/invoices", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Second)
+		fmt.Fprint(w, "invoices loaded")
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	if err := chromedp.Run(ctx, chromedp.Navigate(server.URL)); err != nil {
+		t.Fatalf("error opening fixture: %s", err)
+	}
+
+	b := &BrowserDriver{logger: slog.Default()}
+	if result := b.stepClick(ctx, parser.Step{Action: "click", Selector: "#load", SelectorType: parser.SelectorTypeQuery}); result.Status != "success" {
+		t.Fatalf("click failed: %s", result.Message)
+	}
+	if result := b.stepWaitForNetworkIdle(ctx, parser.Step{Action: "waitForNetworkIdle", Value: "5"}); result.Status != "success" {
+		t.Fatalf("waitForNetworkIdle failed: %s", result.Message)
+	}
+
+	var text string
+	if err := chromedp.Run(ctx, chromedp.Text("#result", &text, chromedp.ByQuery)); err != nil {
+		t.Fatalf("error reading result: %s", err)
+	}
+	if expected := "invoices loaded"; text != expected {
+		t.Errorf("result = %q; want %q", text, expected)
+	}
+}
+
+func TestWaitForLoadEventWithoutNetworkIdle(t *testing.T) {
+	ctx := newFixtureBrowserContext(t)
+
+	// A page with a request that never finishes (e.g. long-polling), so it never reaches networkIdle
+	release := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><body onload="fetch('/poll')">Invoices</body></html>`)
+	})
+	mux.HandleFunc("/poll", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	defer close(release)
+
+	if err := chromedp.Run(ctx, chromedp.Navigate(server.URL)); err != nil {
+		t.Fatalf("error opening fixture: %s", err)
+	}
+
+	b := &BrowserDriver{logger: slog.Default()}
+	start := time.Now()
+	if err := b.waitForLoadEventWithin(ctx, 2*time.Second); err != nil {
+		t.Errorf("waitForLoadEventWithin() returned error: %s", err)
+	}
+	if duration := time.Since(start); duration > 5*time.Second {
+		t.Errorf("waitForLoadEventWithin() returned after %s; want a bounded wait of 2s", duration)
+	}
+
+	idleCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if err := waitForNetworkIdle(idleCtx, true); err != context.DeadlineExceeded {
+		t.Errorf("waitForNetworkIdle() = %v; want %v", err, context.DeadlineExceeded)
+	}
+
+	// The browser is still usable after the listeners were removed
+	var title string
+	if err := chromedp.Run(ctx, chromedp.Text("body", &title, chromedp.ByQuery)); err != nil {
+		t.Fatalf("error reading page after waiting: %s", err)
+	}
+	if title != "Invoices" {
+		t.Errorf("body = %q; want %q", title, "Invoices")
+	}
+}
+
+func TestGetDownloadConcurrency(t *testing.T) {
+	tests := []struct {
+		name                string
+		downloadConcurrency int
+		stepConcurrency     int
+		expected            int
+	}{
+		{"defaults", 0, 0, parser.DefaultDownloadConcurrency},
+		{"configured", 4, 0, 4},
+		{"step has precedence", 4, 1, 1},
+		{"step without configuration", 0, 3, 3},
+	}
+
+	for _, test := range tests {
+		b := &BrowserDriver{logger: slog.Default(), downloadConcurrency: test.downloadConcurrency}
+		concurrency := b.getDownloadConcurrency(parser.Step{Action: "downloadAll", Concurrency: test.stepConcurrency})
+		if concurrency != test.expected {
+			t.Errorf("%s: getDownloadConcurrency() = %d; want %d", test.name, concurrency, test.expected)
+		}
+	}
+}
+
+func TestGetMaxFiles(t *testing.T) {
+	noLimit, one, five := 0, 1, 5
+	tests := []struct {
+		name           string
+		recipeMaxFiles *int
+		stepMaxFiles   *int
+		expected       int
+	}{
+		{"configured", nil, nil, 2},
+		{"recipe has precedence", &five, nil, 5},
+		{"recipe without limit", &noLimit, nil, 0},
+		{"step has precedence", &five, &one, 1},
+		{"step without limit", nil, &noLimit, 0},
+	}
+
+	for _, test := range tests {
+		b := &BrowserDriver{logger: slog.Default(), maxFilesDownloaded: 2, recipeMaxFiles: test.recipeMaxFiles}
+		if maxFiles := b.getMaxFiles(parser.Step{Action: "downloadAll", MaxFiles: test.stepMaxFiles}); maxFiles != test.expected {
+			t.Errorf("%s: getMaxFiles() = %d; want %d", test.name, maxFiles, test.expected)
+		}
+	}
+}
+
+func TestMaxDownloads(t *testing.T) {
+	tests := []struct {
+		name      string
+		available int
+		maxFiles  int
+		expected  int
+	}{
+		{"all invoices", 5, 0, 5},
+		{"negative is unlimited", 5, -1, 5},
+		{"limited", 5, 2, 2},
+		{"limit above available", 1, 2, 1},
+		{"nothing available", 0, 2, 0},
+	}
+
+	for _, test := range tests {
+		if downloads := maxDownloads(test.available, test.maxFiles); downloads != test.expected {
+			t.Errorf("%s: maxDownloads(%d, %d) = %d; want %d", test.name, test.available, test.maxFiles, downloads, test.expected)
+		}
+	}
+}
+
+func TestStepClearStorage(t *testing.T) {
+	ctx := newFixtureBrowserContext(t)
+	b := &BrowserDriver{logger: slog.Default()}
+
+	// Nothing to clear before the first page is opened
+	if result := b.stepClearStorage(ctx, parser.Step{Action: "clearStorage"}); result.Status != "success" {
+		t.Fatalf("stepClearStorage() on a blank page = %s (%s); want success", result.Status, result.Message)
+	}
+
+	// A page with a (stale) session in its cookies and storage
+	mux := http.NewServeMux()
+	mux.HandleFunc("/check", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><body></body></html>`)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "stale"})
+		fmt.Fprint(w, `<html><body><script>localStorage.setItem("token", "stale"); sessionStorage.setItem("token", "stale");</script></body></html>`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	if err := chromedp.Run(ctx, chromedp.Navigate(server.URL)); err != nil {
+		t.Fatalf("error opening fixture: %s", err)
+	}
+	if result := b.stepClearStorage(ctx, parser.Step{Action: "clearStorage"}); result.Status != "success" {
+		t.Fatalf("stepClearStorage() = %s (%s); want success", result.Status, result.Message)
+	}
+
+	var remaining string
+	if err := chromedp.Run(ctx, chromedp.Evaluate(`document.cookie + localStorage.length + sessionStorage.length`, &remaining)); err != nil {
+		t.Fatalf("error reading storage: %s", err)
+	}
+	if remaining != "00" {
+		t.Errorf("cookies and storage after stepClearStorage() = %q; want them cleared", remaining)
+	}
+
+	// Before the first `open`, the storage of the domains of the recipe is cleared
+	if err := chromedp.Run(ctx, chromedp.Navigate(server.URL), chromedp.Navigate("about:blank")); err != nil {
+		t.Fatalf("error opening fixture: %s", err)
+	}
+	b.storageOrigins = []string{server.URL}
+	if result := b.stepClearStorage(ctx, parser.Step{Action: "clearStorage"}); result.Status != "success" {
+		t.Fatalf("stepClearStorage() before the first open = %s (%s); want success", result.Status, result.Message)
+	}
+	if err := chromedp.Run(ctx, chromedp.Navigate(server.URL+"/check"), chromedp.Evaluate(`localStorage.length.toString()`, &remaining)); err != nil {
+		t.Fatalf("error reading storage: %s", err)
+	}
+	if remaining != "0" {
+		t.Errorf("localStorage after stepClearStorage() before the first open = %q; want it cleared", remaining)
+	}
+}
+
+func TestStorageOrigins(t *testing.T) {
+	recipe := &parser.Recipe{Domains: []string{"example.com", "www.portal.example.org/billing", "*.example.net"}}
+	expected := []string{"https://example.com", "https://www.example.com", "https://portal.example.org", "https://www.portal.example.org", "https://example.net", "https://www.example.net"}
+	if origins := storageOrigins(recipe); !reflect.DeepEqual(origins, expected) {
+		t.Errorf("storageOrigins() = %v; want %v", origins, expected)
+	}
+}
+
+func TestScriptResultString(t *testing.T) {
+	tests := []struct {
+		res      string
+		expected string
+	}{
+		{``, ""},
+		{`null`, ""},
+		{`"ok"`, "ok"},
+		{`"error: session expired"`, "error: session expired"},
+		{`42`, "42"},
+		{`true`, "true"},
+		{`["a", "b"]`, `["a","b"]`},
+		{`{"status": "ok"}`, `{"status":"ok"}`},
+	}
+
+	for _, test := range tests {
+		if result := scriptResultString([]byte(test.res)); result != test.expected {
+			t.Errorf("scriptResultString(%s) = %q; want %q", test.res, result, test.expected)
+		}
+	}
+}
+
+func TestStepRunScriptExpect(t *testing.T) {
+	ctx := newFixtureBrowserContext(t)
+	b := &BrowserDriver{logger: slog.Default()}
+	expectOk := "ok"
+
+	tests := []struct {
+		name     string
+		script   string
+		expect   *string
+		expected string
+	}{
+		{"no expectation", `"error"`, nil, "success"},
+		{"undefined result", `undefined`, nil, "success"},
+		{"expected result", `"ok"`, &expectOk, "success"},
+		{"unexpected result", `"error"`, &expectOk, "error"},
+		{"object result", `({status: "ok"})`, &expectOk, "error"},
+	}
+
+	for _, test := range tests {
+		result := b.stepRunScript(ctx, parser.Step{Action: "runScript", Value: test.script, Expect: test.expect})
+		if result.Status != test.expected {
+			t.Errorf("%s: stepRunScript() = %s (%s); want %s", test.name, result.Status, result.Message, test.expected)
+		}
+	}
+}
+
+func TestCleanupDownloads(t *testing.T) {
+	for _, keepDownloads := range []bool{false, true} {
+		downloadsDirectory := filepath.Join(t.TempDir(), "example")
+		if err := os.MkdirAll(downloadsDirectory, 0o755); err != nil {
+			t.Fatalf("error creating downloads directory: %s", err)
+		}
+		partialDownload := filepath.Join(downloadsDirectory, "invoice.pdf.crdownload")
+		if err := os.WriteFile(partialDownload, []byte("%PDF-"), 0o600); err != nil {
+			t.Fatalf("error writing download: %s", err)
+		}
+
+		b := &BrowserDriver{logger: slog.Default(), downloadsDirectory: downloadsDirectory, keepDownloads: keepDownloads}
+		if err := b.cleanupDownloads(); err != nil {
+			t.Errorf("keepDownloads=%t: cleanupDownloads() returned error: %s", keepDownloads, err)
+		}
+		if _, err := os.Stat(partialDownload); (err == nil) != keepDownloads {
+			t.Errorf("keepDownloads=%t: download exists after cleanupDownloads() = %t; want %t", keepDownloads, err == nil, keepDownloads)
+		}
+	}
+}
+
+func TestStepMoveRejectsInvalidDocuments(t *testing.T) {
+	downloadsDirectory := t.TempDir()
+	files := map[string]string{
+		"invoice-1.pdf": "%PDF-1.7\ninvoice",
+		"invoice-2.pdf": "<!DOCTYPE html><html><body>Session expired</body></html>",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(downloadsDirectory, name), []byte(content), 0o600); err != nil {
+			t.Fatalf("error writing download: %s", err)
+		}
+	}
+	documentArchive := archive.NewDocumentArchive(slog.Default(), filepath.Join(t.TempDir(), "documents"), archive.LayoutSupplier)
+
+	b := &BrowserDriver{logger: slog.Default(), downloadsDirectory: downloadsDirectory, supplier: "example"}
+	if result := b.stepMove(parser.Step{Action: "move", Value: `.*\.pdf`}, documentArchive); result.Status != "success" {
+		t.Fatalf("stepMove() failed: %s", result.Message)
+	}
+	if b.newFilesCount != 1 || len(b.newFiles) != 1 || filepath.Base(b.newFiles[0]) != "invoice-1.pdf" {
+		t.Errorf("stepMove() moved %d files %v; want only invoice-1.pdf", b.newFilesCount, b.newFiles)
+	}
+}
+
+func TestStepTransformAndMoveExtractedDocuments(t *testing.T) {
+	downloadsDirectory := t.TempDir()
+	zipFile, err := os.Create(filepath.Join(downloadsDirectory, "invoices.zip"))
+	if err != nil {
+		t.Fatalf("error creating zip file: %s", err)
+	}
+	zipWriter := zip.NewWriter(zipFile)
+	// The portal names the invoices of all months `invoice.pdf`
+	for _, name := range []string{"2024/03/invoice.pdf", "2024/04/invoice.pdf"} {
+		w, err := zipWriter.Create(name)
+		if err != nil {
+			t.Fatalf("error adding %s to zip file: %s", name, err)
+		}
+		if _, err := w.Write([]byte("%PDF-1.7\n" + name)); err != nil {
+			t.Fatalf("error writing %s to zip file: %s", name, err)
+		}
+	}
+	if err := errors.Join(zipWriter.Close(), zipFile.Close()); err != nil {
+		t.Fatalf("error closing zip file: %s", err)
+	}
+
+	documentsDirectory := filepath.Join(t.TempDir(), "documents")
+	documentArchive := archive.NewDocumentArchive(slog.Default(), documentsDirectory, archive.LayoutSupplier)
+	// A different document with the name of an extracted file exists already
+	existingFile := filepath.Join(documentsDirectory, "example", "2024-03-invoice.pdf")
+	if err := os.MkdirAll(filepath.Dir(existingFile), 0o755); err != nil {
+		t.Fatalf("error creating document directory: %s", err)
+	}
+	if err := os.WriteFile(existingFile, []byte("%PDF-1.7\nexisting"), 0o600); err != nil {
+		t.Fatalf("error writing existing document: %s", err)
+	}
+
+	b := &BrowserDriver{logger: slog.Default(), downloadsDirectory: downloadsDirectory, supplier: "example"}
+	if result := b.stepTransform(parser.Step{Action: "transform", Value: "unzip"}); result.Status != "success" {
+		t.Fatalf("stepTransform() failed: %s", result.Message)
+	}
+	if result := b.stepMove(parser.Step{Action: "move", Value: `.*\.pdf`}, documentArchive); result.Status != "success" {
+		t.Fatalf("stepMove() failed: %s", result.Message)
+	}
+
+	expected := map[string]string{
+		"2024-03-invoice-2.pdf": "%PDF-1.7\n2024/03/invoice.pdf",
+		"2024-04-invoice.pdf":   "%PDF-1.7\n2024/04/invoice.pdf",
+	}
+	if len(b.newFiles) != len(expected) {
+		t.Fatalf("stepMove() moved %v; want %d files", b.newFiles, len(expected))
+	}
+	for _, newFile := range b.newFiles {
+		content, err := os.ReadFile(newFile)
+		if err != nil || string(content) != expected[filepath.Base(newFile)] {
+			t.Errorf("moved file %s contains %q, %v; want %q", newFile, content, err, expected[filepath.Base(newFile)])
+		}
+	}
+	if content, _ := os.ReadFile(existingFile); string(content) != "%PDF-1.7\nexisting" {
+		t.Errorf("existing document %s was overwritten with %q", existingFile, content)
+	}
+}
+
+// totpProviderMock returns totp and err for every item, like a vault with or without the TOTP of the items.
+type totpProviderMock struct {
+	totp string
+	err  error
+}
+
+func (m totpProviderMock) GetTotpForItem(string, vault.CredentialFields) (string, error) {
+	return m.totp, m.err
+}
+
+func TestParseCredentialPlaceholdersTotp(t *testing.T) {
+	tests := []struct {
+		name        string
+		provider    totpProviderMock
+		answer      string
+		interactive bool
+		expected    string
+		expectedErr error
+	}{
+		{"totp of the vault", totpProviderMock{totp: "111111"}, "", true, "111111", nil},
+		{"entered code without totp", totpProviderMock{err: fmt.Errorf("entry has no TOTP secret: %w", vault.ErrTotpMissing)}, "222 222", true, "222222", nil},
+		{"entered code with empty totp", totpProviderMock{}, "333333", true, "333333", nil},
+		{"canceled prompt", totpProviderMock{err: vault.ErrTotpMissing}, "", true, "", utils.ErrTotpPromptCanceled},
+		{"non-interactive", totpProviderMock{err: vault.ErrTotpMissing}, "", false, "", utils.ErrTotpPromptUnavailable},
+		{"vault error", totpProviderMock{err: errors.New("vault locked")}, "444444", true, "", nil},
+	}
+
+	for _, test := range tests {
+		b := &BrowserDriver{logger: slog.Default(), supplier: "example"}
+		prompts := 0
+		if test.interactive {
+			b.SetTotpPrompt(utils.NewTotpPrompt(time.Second, func(msg utils.ViewTotpPromptMsg) {
+				prompts++
+				if msg.Code != nil {
+					msg.Code <- test.answer
+				}
+			}))
+		}
+		credentials := &vault.Credentials{Id: "item", VaultProvider: test.provider}
+
+		value, err := b.parseCredentialPlaceholders(context.Background(), "{{ totp }}", credentials)
+		if len(test.expected) > 0 {
+			if err != nil || value != test.expected {
+				t.Errorf("%s: parseCredentialPlaceholders() = %q, %v; want %q", test.name, value, err, test.expected)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: parseCredentialPlaceholders() = %q; want an error", test.name, value)
+		}
+		if test.expectedErr != nil && !errors.Is(err, test.expectedErr) {
+			t.Errorf("%s: parseCredentialPlaceholders() returned error %v; want %v", test.name, err, test.expectedErr)
+		}
+		if test.provider.err != nil && !errors.Is(test.provider.err, vault.ErrTotpMissing) && prompts > 0 {
+			t.Errorf("%s: the 2FA code was asked for after an error of the vault", test.name)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package browser
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/chromedp/chromedp"
+)
+
+// ResolveChromePath returns the absolute path of the Chrome binary to use (e.g. Chromium or Brave).
+// chromePath is either a path or a command in $PATH (e.g. `chromium`), an empty chromePath uses the Chrome chromedp finds.
+// On macOS, an application bundle (e.g. `/Applications/Brave Browser.app`) resolves to its binary.
+func ResolveChromePath(chromePath string) (string, error) {
+	chromePath = strings.TrimSpace(chromePath)
+	if len(chromePath) == 0 {
+		return "", nil
+	}
+
+	// A plain command name is looked up in $PATH
+	if filepath.Base(chromePath) == chromePath {
+		resolved, err := exec.LookPath(chromePath)
+		if err != nil {
+			return "", fmt.Errorf("chrome binary `%s` not found in $PATH", chromePath)
+		}
+		chromePath = resolved
+	}
+
+	resolved, err := filepath.Abs(chromePath)
+	if err != nil {
+		return "", fmt.Errorf("error resolving chrome binary `%s`: %w", chromePath, err)
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return "", fmt.Errorf("chrome binary `%s` does not exist", chromePath)
+	}
+	if info.IsDir() && runtime.GOOS == "darwin" && strings.HasSuffix(resolved, ".app") {
+		resolved = filepath.Join(resolved, "Contents", "MacOS", strings.TrimSuffix(filepath.Base(resolved), ".app"))
+		info, err = os.Stat(resolved)
+		if err != nil {
+			return "", fmt.Errorf("application bundle `%s` contains no binary %s", chromePath, resolved)
+		}
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("chrome binary `%s` is a directory", chromePath)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0111 == 0 {
+		return "", fmt.Errorf("chrome binary `%s` is not executable", chromePath)
+	}
+
+	return resolved, nil
+}
+
+// chromeExecPathFlags returns the exec allocator option to start the binary chromePath (see ResolveChromePath).
+func chromeExecPathFlags(chromePath string) []chromedp.ExecAllocatorOption {
+	if len(chromePath) == 0 {
+		return nil
+	}
+	return []chromedp.ExecAllocatorOption{chromedp.ExecPath(chromePath)}
+}
@@ -0,0 +1,52 @@
+package browser
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveChromePath(t *testing.T) {
+	directory := t.TempDir()
+	binary := filepath.Join(directory, "chromium")
+	if err := os.WriteFile(binary, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatalf("error writing binary: %s", err)
+	}
+	notExecutable := filepath.Join(directory, "chrome.txt")
+	if err := os.WriteFile(notExecutable, []byte("chrome"), 0644); err != nil {
+		t.Fatalf("error writing file: %s", err)
+	}
+	t.Setenv("PATH", directory)
+
+	tests := []struct {
+		name          string
+		chromePath    string
+		expected      string
+		expectedError bool
+	}{
+		{"not configured", " ", "", false},
+		{"absolute path", binary, binary, false},
+		{"command in PATH", "chromium", binary, false},
+		{"missing command", "brave-browser", "", true},
+		{"missing file", filepath.Join(directory, "chrome"), "", true},
+		{"directory", directory + string(filepath.Separator), "", true},
+		{"not executable", notExecutable, "", true},
+	}
+
+	for _, test := range tests {
+		resolved, err := ResolveChromePath(test.chromePath)
+		if (err != nil) != test.expectedError {
+			t.Errorf("%s: ResolveChromePath(%s) returned error %v; want error %t", test.name, test.chromePath, err, test.expectedError)
+		}
+		if resolved != test.expected {
+			t.Errorf("%s: ResolveChromePath(%s) = %s; want %s", test.name, test.chromePath, resolved, test.expected)
+		}
+	}
+
+	if flags := chromeExecPathFlags(""); len(flags) != 0 {
+		t.Errorf("chromeExecPathFlags() without a binary returned %d options; want none", len(flags))
+	}
+	if flags := chromeExecPathFlags(binary); len(flags) != 1 {
+		t.Errorf("chromeExecPathFlags() returned %d options; want 1", len(flags))
+	}
+}
@@ -0,0 +1,127 @@
+package browser
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/pkcs12"
+)
+
+// ClientCertificate is the client certificate of a supplier API that requires mutual TLS (`client` recipes only).
+// The certificate is either a PEM certificate (CertFile) with its PEM private key (KeyFile)
+// or a PKCS#12 file (PKCS12File, `.p12` / `.pfx`) protected by Passphrase.
+// Relative paths are resolved relative to the configuration directory.
+type ClientCertificate struct {
+	Supplier   string `mapstructure:"supplier"`
+	CertFile   string `mapstructure:"cert_file"`
+	KeyFile    string `mapstructure:"key_file"`
+	PKCS12File string `mapstructure:"pkcs12_file"`
+	Passphrase string `mapstructure:"passphrase"`
+}
+
+// ClientCertificates are the loaded client certificates per supplier.
+// A nil *ClientCertificates has no certificates.
+type ClientCertificates struct {
+	suppliers map[string]*tls.Certificate
+}
+
+// NewClientCertificates validates certificates and loads their files.
+func NewClientCertificates(certificates []ClientCertificate, buchhalterConfigDirectory string) (*ClientCertificates, error) {
+	if len(certificates) == 0 {
+		return nil, nil
+	}
+
+	c := &ClientCertificates{suppliers: map[string]*tls.Certificate{}}
+	for _, certificate := range certificates {
+		supplier := strings.TrimSpace(certificate.Supplier)
+		if len(supplier) == 0 {
+			return nil, errors.New("client certificate without a supplier")
+		}
+		if _, exists := c.suppliers[supplier]; exists {
+			return nil, fmt.Errorf("client certificate for supplier `%s` is configured twice", supplier)
+		}
+
+		hasPEM := len(strings.TrimSpace(certificate.CertFile)) > 0 || len(strings.TrimSpace(certificate.KeyFile)) > 0
+		hasPKCS12 := len(strings.TrimSpace(certificate.PKCS12File)) > 0
+		var tlsCertificate tls.Certificate
+		var err error
+		switch {
+		case hasPEM && hasPKCS12:
+			return nil, fmt.Errorf("client certificate for supplier `%s` requires either `cert_file` and `key_file` or `pkcs12_file`, not both", supplier)
+		case hasPEM:
+			if len(strings.TrimSpace(certificate.CertFile)) == 0 || len(strings.TrimSpace(certificate.KeyFile)) == 0 {
+				return nil, fmt.Errorf("client certificate for supplier `%s` requires both `cert_file` and `key_file`", supplier)
+			}
+			tlsCertificate, err = tls.LoadX509KeyPair(resolveConfigPath(certificate.CertFile, buchhalterConfigDirectory), resolveConfigPath(certificate.KeyFile, buchhalterConfigDirectory))
+		case hasPKCS12:
+			tlsCertificate, err = loadPKCS12Certificate(resolveConfigPath(certificate.PKCS12File, buchhalterConfigDirectory), certificate.Passphrase)
+		default:
+			return nil, fmt.Errorf("client certificate for supplier `%s` requires either `cert_file` and `key_file` or `pkcs12_file`", supplier)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("client certificate for supplier `%s`: %w", supplier, err)
+		}
+		c.suppliers[supplier] = &tlsCertificate
+	}
+
+	return c, nil
+}
+
+// ForSupplier returns the client certificate of supplier or nil, if none is configured.
+func (c *ClientCertificates) ForSupplier(supplier string) *tls.Certificate {
+	if c == nil {
+		return nil
+	}
+	return c.suppliers[supplier]
+}
+
+// resolveConfigPath resolves a relative path relative to the configuration directory.
+func resolveConfigPath(path, buchhalterConfigDirectory string) string {
+	path = strings.TrimSpace(path)
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(buchhalterConfigDirectory, path)
+}
+
+// loadPKCS12Certificate loads the certificate (incl. its chain) and the private key of a PKCS#12 file.
+func loadPKCS12Certificate(file, passphrase string) (tls.Certificate, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("error reading PKCS#12 file: %w", err)
+	}
+
+	blocks, err := pkcs12.ToPEM(content, passphrase)
+	if err != nil {
+		var notImplemented pkcs12.NotImplementedError
+		if errors.As(err, &notImplemented) {
+			// OpenSSL 3 encrypts with AES by default, only the legacy algorithms are supported
+			return tls.Certificate{}, fmt.Errorf("unsupported encryption of PKCS#12 file %s (%w), export it again with `openssl pkcs12 -export -legacy` or use PEM files", file, err)
+		}
+		if errors.Is(err, pkcs12.ErrIncorrectPassword) {
+			return tls.Certificate{}, fmt.Errorf("wrong passphrase of PKCS#12 file %s", file)
+		}
+		return tls.Certificate{}, fmt.Errorf("error decoding PKCS#12 file %s: %w", file, err)
+	}
+
+	var certificatesPEM, keyPEM []byte
+	for _, block := range blocks {
+		encoded := pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: block.Bytes})
+		if block.Type == "CERTIFICATE" {
+			certificatesPEM = append(certificatesPEM, encoded...)
+		} else {
+			keyPEM = append(keyPEM, encoded...)
+		}
+	}
+
+	certificate, err := tls.X509KeyPair(certificatesPEM, keyPEM)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("error loading certificate of PKCS#12 file %s: %w", file, err)
+	}
+	return certificate, nil
+}
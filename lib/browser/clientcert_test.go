@@ -0,0 +1,183 @@
+package browser
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testdata/client.p12 is a self-signed client certificate (CN buchhalter-test-client) with legacy encryption,
+// testdata/client-aes.p12 the same certificate with the AES encryption of OpenSSL 3.
+const clientCertificateTestPassphrase = "test-passphrase"
+
+// writeClientCertificatePEM writes a self-signed client certificate and its key into directory.
+func writeClientCertificatePEM(t *testing.T, directory, commonName string) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("error creating certificate: %s", err)
+	}
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("error encoding key: %s", err)
+	}
+
+	certFile := filepath.Join(directory, "client.pem")
+	keyFile := filepath.Join(directory, "client-key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate}), 0600); err != nil {
+		t.Fatalf("error writing certificate: %s", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}), 0600); err != nil {
+		t.Fatalf("error writing key: %s", err)
+	}
+	return certFile, keyFile
+}
+
+func TestNewClientCertificatesValidation(t *testing.T) {
+	configDirectory := t.TempDir()
+	certFile, keyFile := writeClientCertificatePEM(t, configDirectory, "buchhalter-test-client")
+	p12File, err := filepath.Abs(filepath.Join("testdata", "client.p12"))
+	if err != nil {
+		t.Fatalf("error resolving PKCS#12 file: %s", err)
+	}
+
+	tests := []struct {
+		name         string
+		certificates []ClientCertificate
+	}{
+		{"empty supplier", []ClientCertificate{{Supplier: " ", CertFile: certFile, KeyFile: keyFile}}},
+		{"no certificate", []ClientCertificate{{Supplier: "example"}}},
+		{"certificate without key", []ClientCertificate{{Supplier: "example", CertFile: certFile}}},
+		{"PEM and PKCS#12", []ClientCertificate{{Supplier: "example", CertFile: certFile, KeyFile: keyFile, PKCS12File: p12File}}},
+		{"missing certificate file", []ClientCertificate{{Supplier: "example", CertFile: certFile + ".missing", KeyFile: keyFile}}},
+		{"key as certificate", []ClientCertificate{{Supplier: "example", CertFile: keyFile, KeyFile: keyFile}}},
+		{"wrong PKCS#12 passphrase", []ClientCertificate{{Supplier: "example", PKCS12File: p12File, Passphrase: "wrong"}}},
+		{"duplicate supplier", []ClientCertificate{{Supplier: "example", CertFile: certFile, KeyFile: keyFile}, {Supplier: "example", PKCS12File: p12File, Passphrase: clientCertificateTestPassphrase}}},
+	}
+
+	for _, test := range tests {
+		if _, err := NewClientCertificates(test.certificates, configDirectory); err == nil {
+			t.Errorf("%s: NewClientCertificates() returned no error; want an error", test.name)
+		}
+	}
+
+	if certificates, err := NewClientCertificates(nil, configDirectory); err != nil || certificates != nil || certificates.ForSupplier("example") != nil {
+		t.Errorf("NewClientCertificates(nil) = %v, %v; want no certificates", certificates, err)
+	}
+	if _, err := NewClientCertificates([]ClientCertificate{{Supplier: "example", PKCS12File: filepath.Join("testdata", "client-aes.p12"), Passphrase: clientCertificateTestPassphrase}}, "."); err == nil || !strings.Contains(err.Error(), "-legacy") {
+		t.Errorf("NewClientCertificates() with an AES encrypted PKCS#12 file returned %v; want a hint to export it again", err)
+	}
+}
+
+func TestNewClientCertificatesLoadsFiles(t *testing.T) {
+	configDirectory := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(configDirectory, "certs"), 0700); err != nil {
+		t.Fatalf("error creating certs directory: %s", err)
+	}
+	writeClientCertificatePEM(t, filepath.Join(configDirectory, "certs"), "pem-client")
+	p12File, err := filepath.Abs(filepath.Join("testdata", "client.p12"))
+	if err != nil {
+		t.Fatalf("error resolving PKCS#12 file: %s", err)
+	}
+
+	// Relative paths are resolved relative to the configuration directory
+	certificates, err := NewClientCertificates([]ClientCertificate{
+		{Supplier: "pem-supplier", CertFile: "certs/client.pem", KeyFile: "certs/client-key.pem"},
+		{Supplier: "p12-supplier", PKCS12File: p12File, Passphrase: clientCertificateTestPassphrase},
+	}, configDirectory)
+	if err != nil {
+		t.Fatalf("NewClientCertificates() returned error: %s", err)
+	}
+
+	tests := []struct {
+		supplier           string
+		expectedCommonName string
+	}{
+		{"pem-supplier", "pem-client"},
+		{"p12-supplier", "buchhalter-test-client"},
+	}
+	for _, test := range tests {
+		certificate := certificates.ForSupplier(test.supplier)
+		if certificate == nil || certificate.Leaf == nil {
+			t.Errorf("ForSupplier(%s) = %v; want a certificate", test.supplier, certificate)
+			continue
+		}
+		if certificate.Leaf.Subject.CommonName != test.expectedCommonName {
+			t.Errorf("ForSupplier(%s) has the common name %s; want %s", test.supplier, certificate.Leaf.Subject.CommonName, test.expectedCommonName)
+		}
+	}
+	if certificate := certificates.ForSupplier("other"); certificate != nil {
+		t.Errorf("ForSupplier(other) = %v; want no certificate", certificate)
+	}
+}
+
+func TestTLSOverridesHTTPClientWithClientCertificate(t *testing.T) {
+	// The server requires a client certificate and responds with its common name
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	configDirectory := t.TempDir()
+	writeClientCertificatePEM(t, configDirectory, "mtls-client")
+	certificates, err := NewClientCertificates([]ClientCertificate{{Supplier: "example", CertFile: "client.pem", KeyFile: "client-key.pem"}}, configDirectory)
+	if err != nil {
+		t.Fatalf("NewClientCertificates() returned error: %s", err)
+	}
+	overrides, err := NewTLSOverrides([]TLSOverride{{Host: server.Listener.Addr().String(), Insecure: true}})
+	if err != nil {
+		t.Fatalf("NewTLSOverrides() returned error: %s", err)
+	}
+
+	resp, err := overrides.HTTPClient(certificates.ForSupplier("example")).Get(server.URL)
+	if err != nil {
+		t.Fatalf("Request with client certificate returned error: %s", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || string(body) != "mtls-client" {
+		t.Errorf("Server received the client certificate %q (%v); want mtls-client", body, err)
+	}
+
+	if resp, err := overrides.HTTPClient(nil).Get(server.URL); err == nil {
+		resp.Body.Close()
+		t.Errorf("Request without client certificate returned no error")
+	}
+
+	// Without overrides, the client certificate is presented to all hosts
+	var noOverrides *TLSOverrides
+	transport, ok := noOverrides.HTTPClient(certificates.ForSupplier("example")).Transport.(*http.Transport)
+	if !ok || len(transport.TLSClientConfig.Certificates) != 1 {
+		t.Errorf("HTTPClient() without overrides doesn't present the client certificate")
+	}
+	if client := noOverrides.HTTPClient(nil); client != http.DefaultClient {
+		t.Errorf("HTTPClient(nil) without overrides = %v; want the default client", client)
+	}
+}
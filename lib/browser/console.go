@@ -0,0 +1,85 @@
+package browser
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"buchhalter/lib/utils"
+
+	cdplog "github.com/chromedp/cdproto/log"
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+)
+
+// SetVerboseBrowser forwards the console messages, JavaScript exceptions and log entries of the pages to the logger (`--verbose-browser`).
+// They are logged at debug level with the supplier of the recipe, e.g. to find out why a `runScript` step returns nothing.
+func (b *BrowserDriver) SetVerboseBrowser(verbose bool) {
+	b.verboseBrowser = verbose
+}
+
+// listenForConsoleEvents logs the console messages, exceptions and log entries of the pages of ctx (see SetVerboseBrowser).
+// The messages are redacted (see utils.Redact), pages might log tokens or other secrets.
+func listenForConsoleEvents(ctx context.Context, logger *slog.Logger, supplier string) error {
+	chromedp.ListenTarget(ctx, func(event interface{}) {
+		switch ev := event.(type) {
+		case *runtime.EventConsoleAPICalled:
+			logger.Debug("Browser console message", "supplier", supplier, "type", ev.Type, "message", utils.Redact(consoleArgsText(ev.Args)))
+		case *runtime.EventExceptionThrown:
+			logger.Debug("Browser exception", "supplier", supplier, "message", utils.Redact(exceptionText(ev.ExceptionDetails)))
+		case *cdplog.EventEntryAdded:
+			if ev.Entry == nil {
+				return
+			}
+			logger.Debug("Browser log entry", "supplier", supplier, "source", ev.Entry.Source, "level", ev.Entry.Level, "message", utils.Redact(ev.Entry.Text), "url", utils.Redact(ev.Entry.URL))
+		}
+	})
+
+	// The runtime domain is enabled by chromedp, the log domain (e.g. network errors and violations) is not
+	return chromedp.Run(ctx, cdplog.Enable())
+}
+
+// consoleArgsText returns the arguments of a console call separated by spaces, like the console of the developer tools shows them.
+// Strings are shown without quotes, other primitive values in their JSON encoding and objects with their description (e.g. `Array(3)`).
+func consoleArgsText(args []*runtime.RemoteObject) string {
+	parts := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg == nil {
+			continue
+		}
+		switch {
+		case len(arg.Value) > 0:
+			var str string
+			if err := json.Unmarshal(arg.Value, &str); err == nil {
+				parts = append(parts, str)
+			} else {
+				parts = append(parts, string(arg.Value))
+			}
+		case len(arg.UnserializableValue) > 0:
+			parts = append(parts, string(arg.UnserializableValue))
+		case len(arg.Description) > 0:
+			parts = append(parts, arg.Description)
+		default:
+			parts = append(parts, string(arg.Type))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// exceptionText returns the message of an uncaught exception: the description of the exception (incl. its stack) or its text, with its location.
+func exceptionText(details *runtime.ExceptionDetails) string {
+	if details == nil {
+		return ""
+	}
+	text := details.Text
+	if details.Exception != nil && len(details.Exception.Description) > 0 {
+		text = details.Exception.Description
+	}
+	if len(details.URL) > 0 {
+		// The line number of the exception is zero-based
+		text = fmt.Sprintf("%s (%s:%d)", text, details.URL, details.LineNumber+1)
+	}
+	return text
+}
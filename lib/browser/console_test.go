@@ -0,0 +1,48 @@
+package browser
+
+import (
+	"testing"
+
+	"github.com/chromedp/cdproto/runtime"
+)
+
+func TestConsoleArgsText(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []*runtime.RemoteObject
+		expected string
+	}{
+		{"no arguments", nil, ""},
+		{"strings without quotes", []*runtime.RemoteObject{
+			{Type: runtime.TypeString, Value: []byte(`"Invoices loaded:"`)},
+			{Type: runtime.TypeNumber, Value: []byte(`3`)},
+			{Type: runtime.TypeBoolean, Value: []byte(`true`)},
+		}, "Invoices loaded: 3 true"},
+		{"objects by description", []*runtime.RemoteObject{
+			{Type: runtime.TypeObject, Subtype: runtime.SubtypeArray, Description: "Array(3)"},
+			{Type: runtime.TypeNumber, UnserializableValue: "NaN"},
+			{Type: runtime.TypeUndefined},
+		}, "Array(3) NaN undefined"},
+	}
+
+	for _, test := range tests {
+		if text := consoleArgsText(test.args); text != test.expected {
+			t.Errorf("%s: consoleArgsText() = %q; want %q", test.name, text, test.expected)
+		}
+	}
+}
+
+func TestExceptionText(t *testing.T) {
+	details := &runtime.ExceptionDetails{
+		Text:       "Uncaught",
+		LineNumber: 41,
+		URL:        "https://example.com/app.js",
+		Exception:  &runtime.RemoteObject{Type: runtime.TypeObject, Description: "TypeError: invoices is undefined"},
+	}
+	if text := exceptionText(details); text != "TypeError: invoices is undefined (https://example.com/app.js:42)" {
+		t.Errorf("exceptionText() = %q", text)
+	}
+	if text := exceptionText(&runtime.ExceptionDetails{Text: "Uncaught SyntaxError"}); text != "Uncaught SyntaxError" {
+		t.Errorf("exceptionText() without exception = %q", text)
+	}
+}
@@ -0,0 +1,102 @@
+package browser
+
+import (
+	"net/url"
+	"strings"
+
+	"buchhalter/lib/parser"
+)
+
+// DomainPolicyConfig are the global settings of the domains the browser may contact.
+type DomainPolicyConfig struct {
+	// Restrict allows only requests to the domains of the recipe and Allowed (`buchhalter_restrict_domains`)
+	Restrict bool
+	// Allowed are additional domains for restricted recipes (`buchhalter_allowed_domains`)
+	Allowed []string
+	// Denied are domains that are always blocked, e.g. trackers (`buchhalter_denied_domains`)
+	Denied []string
+}
+
+// DomainPolicy decides which requests of a browser (or http) recipe are blocked.
+// A domain matches the domain itself and all its subdomains.
+// A nil *DomainPolicy allows all requests.
+type DomainPolicy struct {
+	restrict bool
+	allowed  []string
+	denied   []string
+}
+
+// NewDomainPolicy returns the policy of recipe.
+// Requests are restricted if configured globally or by the recipe (`restrictDomains`), allowed are the domains of the recipe,
+// its `allowedDomains` and the allowed domains of config. Without a restriction and denied domains, nil is returned.
+func NewDomainPolicy(recipe *parser.Recipe, config DomainPolicyConfig) *DomainPolicy {
+	restrict := config.Restrict || recipe.RestrictDomains
+	denied := normalizeDomains(config.Denied)
+	if !restrict && len(denied) == 0 {
+		return nil
+	}
+
+	allowed := []string{}
+	if restrict {
+		allowed = append(allowed, normalizeDomains(recipe.Domains)...)
+		allowed = append(allowed, normalizeDomains(recipe.AllowedDomains)...)
+		allowed = append(allowed, normalizeDomains(config.Allowed)...)
+	}
+
+	return &DomainPolicy{restrict: restrict, allowed: allowed, denied: denied}
+}
+
+// Allows returns true if the browser may request rawURL.
+// Denied domains have precedence over allowed domains, URLs without a host (e.g. `data:` or `blob:`) are always allowed.
+func (p *DomainPolicy) Allows(rawURL string) bool {
+	if p == nil {
+		return true
+	}
+	requestUrl, err := url.Parse(rawURL)
+	if err != nil {
+		return !p.restrict
+	}
+	if requestUrl.Scheme != "http" && requestUrl.Scheme != "https" && requestUrl.Scheme != "ws" && requestUrl.Scheme != "wss" {
+		return true
+	}
+
+	host := strings.ToLower(requestUrl.Hostname())
+	if matchesDomains(host, p.denied) {
+		return false
+	}
+	if !p.restrict {
+		return true
+	}
+	return matchesDomains(host, p.allowed)
+}
+
+// normalizeDomains returns the lower case hostnames of domains, without scheme, path and `www.` prefix.
+func normalizeDomains(domains []string) []string {
+	normalized := []string{}
+	for _, domain := range domains {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if i := strings.Index(domain, "://"); i >= 0 {
+			domain = domain[i+3:]
+		}
+		if i := strings.IndexAny(domain, "/?#"); i >= 0 {
+			domain = domain[:i]
+		}
+		if host, _, found := strings.Cut(domain, ":"); found && !strings.HasPrefix(domain, "[") {
+			domain = host
+		}
+		domain = strings.TrimPrefix(strings.TrimPrefix(domain, "*."), "www.")
+		if len(domain) > 0 {
+			normalized = append(normalized, domain)
+		}
+	}
+	return normalized
+}
+
+func matchesDomains(host string, domains []string) bool {
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package browser
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"buchhalter/lib/parser"
+
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/chromedp"
+)
+
+func TestDomainPolicyAllows(t *testing.T) {
+	recipe := &parser.Recipe{Domains: []string{"www.example.com", "https://portal.example.org/login"}, AllowedDomains: []string{"cdn.example.net"}}
+	tests := []struct {
+		name     string
+		recipe   *parser.Recipe
+		config   DomainPolicyConfig
+		url      string
+		expected bool
+	}{
+		{"recipe domain", recipe, DomainPolicyConfig{Restrict: true}, "https://www.example.com/invoices", true},
+		{"subdomain of recipe domain", recipe, DomainPolicyConfig{Restrict: true}, "https://login.example.com/", true},
+		{"recipe domain with path", recipe, DomainPolicyConfig{Restrict: true}, "https://portal.example.org/api", true},
+		{"allowed domain of recipe", recipe, DomainPolicyConfig{Restrict: true}, "https://cdn.example.net/app.js", true},
+		{"allowed domain of config", recipe, DomainPolicyConfig{Restrict: true, Allowed: []string{"Auth.Example.IO"}}, "https://auth.example.io/", true},
+		{"third-party domain", recipe, DomainPolicyConfig{Restrict: true}, "https://www.googletagmanager.com/gtm.js", false},
+		{"similar domain", recipe, DomainPolicyConfig{Restrict: true}, "https://evilexample.com/", false},
+		{"data url", recipe, DomainPolicyConfig{Restrict: true}, "data:image/png;base64,iVBORw0KGgo=", true},
+		{"denied domain", recipe, DomainPolicyConfig{Denied: []string{"doubleclick.net"}}, "https://ad.doubleclick.net/pixel", false},
+		{"denied domain of restricted recipe", recipe, DomainPolicyConfig{Restrict: true, Denied: []string{"cdn.example.net"}}, "https://cdn.example.net/app.js", false},
+		{"not denied without restriction", recipe, DomainPolicyConfig{Denied: []string{"doubleclick.net"}}, "https://www.googletagmanager.com/gtm.js", true},
+		{"restricted by recipe", &parser.Recipe{Domains: []string{"example.com"}, RestrictDomains: true}, DomainPolicyConfig{}, "https://tracker.io/", false},
+	}
+
+	for _, test := range tests {
+		policy := NewDomainPolicy(test.recipe, test.config)
+		if allowed := policy.Allows(test.url); allowed != test.expected {
+			t.Errorf("%s: Allows(%s) = %t; want %t", test.name, test.url, allowed, test.expected)
+		}
+	}
+
+	// Without restriction and denied domains, all requests are allowed
+	if policy := NewDomainPolicy(recipe, DomainPolicyConfig{}); policy != nil || !policy.Allows("https://tracker.io/") {
+		t.Errorf("NewDomainPolicy() without restriction = %+v; want nil", policy)
+	}
+}
+
+func TestInterceptRequestsBlocksDisallowedDomain(t *testing.T) {
+	ctx := newFixtureBrowserContext(t)
+
+	// The tracker is served from `localhost`, the portal from `127.0.0.1`
+	var trackerRequests atomic.Int32
+	tracker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		trackerRequests.Add(1)
+		fmt.Fprint(w, "tracked")
+	}))
+	defer tracker.Close()
+	trackerUrl := strings.Replace(tracker.URL, "127.0.0.1", "localhost", 1)
+
+	portal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<html><body>
+<div id="result">pending</div>
+<script>fetch('%s/pixel').then(() => document.getElementById('result').textContent = 'tracked').catch(() => document.getElementById('result').textContent = 'blocked')</script>
+</body></html>`, trackerUrl)
+	}))
+	defer portal.Close()
+
+	b := &BrowserDriver{logger: slog.Default(), domainPolicy: NewDomainPolicy(&parser.Recipe{Domains: []string{"127.0.0.1"}}, DomainPolicyConfig{Restrict: true})}
+	chromedp.ListenTarget(ctx, b.interceptRequests(ctx))
+	if err := chromedp.Run(ctx, fetch.Enable(), chromedp.Navigate(portal.URL)); err != nil {
+		t.Fatalf("error opening fixture: %s", err)
+	}
+
+	var result string
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if err := chromedp.Run(ctx, chromedp.Text("#result", &result, chromedp.ByQuery)); err != nil {
+			t.Fatalf("error reading result: %s", err)
+		}
+		if result != "pending" {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if result != "blocked" {
+		t.Errorf("request to the tracker = %q; want %q", result, "blocked")
+	}
+	if requests := trackerRequests.Load(); requests != 0 {
+		t.Errorf("tracker received %d requests; want 0", requests)
+	}
+}
+
+func TestRestrictNewTabsBlocksDisallowedDomain(t *testing.T) {
+	ctx := newFixtureBrowserContext(t)
+
+	// The tracker is served from `localhost`, the portal from `127.0.0.1`
+	var trackerRequests atomic.Int32
+	tracker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		trackerRequests.Add(1)
+		fmt.Fprint(w, "tracked")
+	}))
+	defer tracker.Close()
+	trackerUrl := strings.Replace(tracker.URL, "127.0.0.1", "localhost", 1)
+
+	// The portal opens a popup of its own domain, which requests the tracker, and a popup of the tracker
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><body>
+<button id="popup" onclick="window.open('/popup')">Popup</button>
+<button id="tracker" onclick="window.open('`+trackerUrl+`/page')">Tracker</button>
+</body></html>`)
+	})
+	mux.HandleFunc("/popup", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<html><body><script>setInterval(() => fetch('%s/pixel'), 200)</script></body></html>`, trackerUrl)
+	})
+	portal := httptest.NewServer(mux)
+	defer portal.Close()
+
+	b := &BrowserDriver{logger: slog.Default(), domainPolicy: NewDomainPolicy(&parser.Recipe{Domains: []string{"127.0.0.1"}}, DomainPolicyConfig{Restrict: true})}
+	chromedp.ListenTarget(ctx, b.interceptRequests(ctx))
+	if err := chromedp.Run(ctx, fetch.Enable(), chromedp.Navigate(portal.URL)); err != nil {
+		t.Fatalf("error opening fixture: %s", err)
+	}
+	b.restrictNewTabs(ctx)
+
+	if err := chromedp.Run(ctx, chromedp.Click("#popup", chromedp.ByQuery), chromedp.Click("#tracker", chromedp.ByQuery)); err != nil {
+		t.Fatalf("error opening popups: %s", err)
+	}
+	// The first request of the popup may have been sent before its requests are intercepted
+	time.Sleep(2 * time.Second)
+	trackerRequests.Store(0)
+	time.Sleep(2 * time.Second)
+	if requests := trackerRequests.Load(); requests != 0 {
+		t.Errorf("tracker received %d requests of the popups; want 0", requests)
+	}
+
+	targets, err := chromedp.Targets(ctx)
+	if err != nil {
+		t.Fatalf("error listing the tabs: %s", err)
+	}
+	for _, info := range targets {
+		if info.Type == "page" && strings.HasPrefix(info.URL, trackerUrl) {
+			t.Errorf("popup of the tracker %s is open; want it closed", info.URL)
+		}
+	}
+}
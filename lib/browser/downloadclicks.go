@@ -0,0 +1,74 @@
+package browser
+
+import (
+	"sync"
+)
+
+// downloadClick is a click of a `downloadAll` step. It is completed exactly once:
+// by its download (completed or canceled), the document of a new tab (`viaNewTab`) or the printed page (`printFallback`).
+type downloadClick struct {
+	// began is closed, when the download of the click begins
+	began    chan struct{}
+	complete func()
+}
+
+// downloadClicks assigns the downloads of the browser to the clicks of a `downloadAll` step, in the order of the clicks.
+type downloadClicks struct {
+	mu      sync.Mutex
+	pending []*downloadClick
+	byGUID  map[string]*downloadClick
+}
+
+func newDownloadClicks() *downloadClicks {
+	return &downloadClicks{byGUID: map[string]*downloadClick{}}
+}
+
+// add registers a click waiting for its download, done is called once the click is completed.
+func (d *downloadClicks) add(done func()) *downloadClick {
+	click := &downloadClick{began: make(chan struct{}), complete: sync.OnceFunc(done)}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pending = append(d.pending, click)
+	return click
+}
+
+// begin assigns the download guid to the oldest click without a download.
+// Without such a click (e.g. a late download of a click completed by its fallback), the download isn't assigned.
+func (d *downloadClicks) begin(guid string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.pending) == 0 {
+		return
+	}
+	click := d.pending[0]
+	d.pending = d.pending[1:]
+	d.byGUID[guid] = click
+	close(click.began)
+}
+
+// end completes the click of the download guid, after the download completed or was canceled.
+func (d *downloadClicks) end(guid string) {
+	d.mu.Lock()
+	click, ok := d.byGUID[guid]
+	delete(d.byGUID, guid)
+	d.mu.Unlock()
+
+	if ok {
+		click.complete()
+	}
+}
+
+// fallback completes click without a download, e.g. with the printed page. A later download isn't assigned to it anymore.
+func (d *downloadClicks) fallback(click *downloadClick) {
+	d.mu.Lock()
+	for i, pending := range d.pending {
+		if pending == click {
+			d.pending = append(d.pending[:i], d.pending[i+1:]...)
+			break
+		}
+	}
+	d.mu.Unlock()
+
+	click.complete()
+}
@@ -0,0 +1,57 @@
+package browser
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDownloadClicks(t *testing.T) {
+	clicks := newDownloadClicks()
+	var completed [3]atomic.Int32
+	first := clicks.add(func() { completed[0].Add(1) })
+
+	// The print fallback and the late download of the click complete it once
+	clicks.fallback(first)
+	clicks.begin("late")
+	clicks.end("late")
+	if n := completed[0].Load(); n != 1 {
+		t.Errorf("click completed %d times; want once", n)
+	}
+
+	// Downloads are assigned in the order of the clicks
+	second := clicks.add(func() { completed[1].Add(1) })
+	third := clicks.add(func() { completed[2].Add(1) })
+	clicks.begin("guid-2")
+	select {
+	case <-second.began:
+	default:
+		t.Errorf("download of the second click didn't begin")
+	}
+	select {
+	case <-third.began:
+		t.Errorf("download of the third click began with the download of the second click")
+	default:
+	}
+	clicks.begin("guid-3")
+
+	// The download completes while the fallback runs, e.g. after the timeout of a `viaNewTab` click
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		clicks.end("guid-3")
+	}()
+	go func() {
+		defer wg.Done()
+		clicks.fallback(third)
+	}()
+	wg.Wait()
+	clicks.end("guid-2")
+
+	for i := range completed {
+		if n := completed[i].Load(); n != 1 {
+			t.Errorf("click %d completed %d times; want once", i+1, n)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package browser
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/url"
+	"strings"
+	"time"
+
+	"buchhalter/lib/parser"
+	"buchhalter/lib/utils"
+
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+)
+
+// fetchDownloadRequestsScript evaluates the script of a `fetchDownload` step (may return a promise) and returns its requests as array:
+// a single request (URL or request object) or the values of an array or object.
+const fetchDownloadRequestsScript = `(async () => {
+	const requests = await (%s);
+	if (requests === undefined || requests === null) {
+		return [];
+	}
+	if (typeof requests === 'string' || requests.url !== undefined) {
+		return [requests];
+	}
+	return Object.values(requests);
+})()`
+
+// fetchDownloadRequest is a request of a `fetchDownload` step.
+// The script of the step returns either URLs or objects with the URL and the options of the request,
+// e.g. `{"url": "/api/invoices/1/pdf", "headers": {"Authorization": "Bearer ..."}, "filename": "2024-05.pdf"}`.
+type fetchDownloadRequest struct {
+	URL      string            `json:"url"`
+	Method   string            `json:"method,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Body     string            `json:"body,omitempty"`
+	Filename string            `json:"filename,omitempty"`
+}
+
+// UnmarshalJSON accepts a URL (string) as request as well.
+func (r *fetchDownloadRequest) UnmarshalJSON(data []byte) error {
+	if data = bytes.TrimSpace(data); len(data) > 0 && data[0] == '"' {
+		return json.Unmarshal(data, &r.URL)
+	}
+	type plainRequest fetchDownloadRequest
+	return json.Unmarshal(data, (*plainRequest)(r))
+}
+
+// fetchInit returns the fetch options of the request.
+// The static headers of the step are sent with every request, the headers of the request take precedence.
+func (r fetchDownloadRequest) fetchInit(stepHeaders map[string]string) map[string]interface{} {
+	headers := map[string]string{}
+	for name, value := range stepHeaders {
+		headers[name] = value
+	}
+	for name, value := range r.Headers {
+		headers[name] = value
+	}
+
+	init := map[string]interface{}{"headers": headers}
+	if len(r.Method) > 0 {
+		init["method"] = strings.ToUpper(r.Method)
+	}
+	if len(r.Body) > 0 {
+		init["body"] = r.Body
+	}
+	return init
+}
+
+// parseFetchDownloadRequests parses the requests returned by the script of a `fetchDownload` step.
+// Relative URLs are resolved against the URL of the page, requests without URL are skipped.
+func parseFetchDownloadRequests(pageUrl string, res []byte) ([]fetchDownloadRequest, error) {
+	base, err := url.Parse(pageUrl)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing page URL %s: %w", pageUrl, err)
+	}
+	var requests []fetchDownloadRequest
+	if err := json.Unmarshal(res, &requests); err != nil {
+		return nil, fmt.Errorf("script returned no list of download requests: %w", err)
+	}
+
+	resolved := make([]fetchDownloadRequest, 0, len(requests))
+	for _, request := range requests {
+		request.URL = strings.TrimSpace(request.URL)
+		if len(request.URL) == 0 {
+			continue
+		}
+		reference, err := url.Parse(request.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid download URL %s: %w", request.URL, err)
+		}
+		request.URL = base.ResolveReference(reference).String()
+		resolved = append(resolved, request)
+	}
+
+	return resolved, nil
+}
+
+// stepFetchDownload downloads files with the fetch API of the page, like `downloadHrefs`.
+// The script of the step (value) returns the requests, so headers only available within the page
+// (e.g. an `Authorization` header with a token of the localStorage) can be sent along with the cookies of the session.
+// In contrast to `runScriptDownloadUrls`, the page is not navigated to the URLs.
+func (b *BrowserDriver) stepFetchDownload(ctx context.Context, step parser.Step) utils.StepResult {
+	maxFiles := b.getMaxFiles(step)
+	b.logger.Debug("Executing recipe step", "action", step.Action, "value", step.Value, "max_files", maxFiles)
+
+	awaitPromise := func(p *runtime.EvaluateParams) *runtime.EvaluateParams {
+		return p.WithAwaitPromise(true)
+	}
+	var res []byte
+	var pageUrl string
+	if err := chromedp.Run(ctx,
+		chromedp.Evaluate(fmt.Sprintf(fetchDownloadRequestsScript, step.Value), &res, awaitPromise),
+		chromedp.Location(&pageUrl),
+	); err != nil {
+		return utils.StepResult{Status: "error", Message: err.Error(), ErrorCode: utils.ErrorCodeScriptFailed}
+	}
+	requests, err := parseFetchDownloadRequests(pageUrl, res)
+	if err != nil {
+		return utils.StepResult{Status: "error", Message: err.Error(), ErrorCode: utils.ErrorCodeScriptFailed}
+	}
+	if limit := maxDownloads(len(requests), maxFiles); limit < len(requests) {
+		b.logger.Debug("Limiting downloads, because max_files_downloaded is reached", "action", step.Action, "max_files_downloaded", maxFiles, "num_requests", len(requests))
+		requests = requests[:limit]
+	}
+
+	b.downloadedFilesCount.Store(0)
+	for i, request := range requests {
+		b.logger.Debug("Executing recipe step ... download", "action", step.Action, "url", request.URL, "method", request.Method, "loop", i)
+
+		urlJson, err := json.Marshal(request.URL)
+		if err != nil {
+			return utils.StepResult{Status: "error", Message: err.Error()}
+		}
+		initJson, err := json.Marshal(request.fetchInit(step.Headers))
+		if err != nil {
+			return utils.StepResult{Status: "error", Message: err.Error()}
+		}
+		var download hrefDownload
+		if err := chromedp.Run(ctx, chromedp.Evaluate(fmt.Sprintf(fetchHrefScript, string(urlJson)+", "+string(initJson)), &download, awaitPromise)); err != nil {
+			return utils.StepResult{Status: "error", Message: fmt.Sprintf("error downloading %s: %s", request.URL, err), ErrorCode: utils.ErrorCodeNetwork}
+		}
+		if download.Status < 200 || download.Status > 299 {
+			return utils.StepResult{Status: "error", Message: fmt.Sprintf("error downloading %s: status code %d", request.URL, download.Status), ErrorCode: statusErrorCode(download.Status)}
+		}
+		// The filename of the request takes precedence over the Content-Disposition header
+		if len(request.Filename) > 0 {
+			download.ContentDisposition = mime.FormatMediaType("attachment", map[string]string{"filename": request.Filename})
+		}
+
+		filename, size, err := b.writeHrefDownload(download, request.URL, i+1)
+		if err != nil {
+			return utils.StepResult{Status: "error", Message: err.Error(), ErrorCode: utils.ErrorCodeDownloadFailed}
+		}
+		b.logger.Debug("Executing recipe step ... download completed", "action", step.Action, "url", request.URL, "file", filename, "received_bytes", size)
+		b.downloadedFilesCount.Add(1)
+
+		if step.SleepDuration > 0 && i < len(requests)-1 {
+			time.Sleep(time.Duration(step.SleepDuration) * time.Millisecond)
+		}
+	}
+	b.logger.Info("All downloads completed", "action", step.Action, "num_files", b.downloadedFilesCount.Load())
+
+	return utils.StepResult{Status: "success"}
+}
@@ -0,0 +1,105 @@
+package browser
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"buchhalter/lib/parser"
+
+	"github.com/chromedp/chromedp"
+)
+
+func TestParseFetchDownloadRequests(t *testing.T) {
+	res := []byte(`["/api/invoices/1/pdf", {"url": "2/pdf", "method": "post", "headers": {"Authorization": "Bearer abc"}, "filename": "2024-04.pdf"}, {"url": ""}, "https://cdn.example.com/3.pdf"]`)
+
+	requests, err := parseFetchDownloadRequests("https://portal.example.com/api/invoices/", res)
+	if err != nil {
+		t.Fatalf("parseFetchDownloadRequests() returned error: %s", err)
+	}
+	expected := []fetchDownloadRequest{
+		{URL: "https://portal.example.com/api/invoices/1/pdf"},
+		{URL: "https://portal.example.com/api/invoices/2/pdf", Method: "post", Headers: map[string]string{"Authorization": "Bearer abc"}, Filename: "2024-04.pdf"},
+		{URL: "https://cdn.example.com/3.pdf"},
+	}
+	if fmt.Sprint(requests) != fmt.Sprint(expected) {
+		t.Errorf("parseFetchDownloadRequests() = %v; want %v", requests, expected)
+	}
+
+	if _, err := parseFetchDownloadRequests("https://portal.example.com/", []byte(`42`)); err == nil {
+		t.Errorf("parseFetchDownloadRequests() of a number returned no error")
+	}
+}
+
+func TestFetchDownloadRequestInit(t *testing.T) {
+	request := fetchDownloadRequest{Method: "post", Body: `{"id":1}`, Headers: map[string]string{"Authorization": "Bearer token", "Accept": "application/octet-stream"}}
+	init := request.fetchInit(map[string]string{"Accept": "application/pdf", "X-Client": "buchhalter"})
+
+	headers := init["headers"].(map[string]string)
+	if headers["Accept"] != "application/octet-stream" || headers["X-Client"] != "buchhalter" || headers["Authorization"] != "Bearer token" {
+		t.Errorf("fetchInit() headers = %v; want the step headers, overridden by the request headers", headers)
+	}
+	if init["method"] != "POST" || init["body"] != `{"id":1}` {
+		t.Errorf("fetchInit() = %v; want method POST and the body", init)
+	}
+	if init := (fetchDownloadRequest{}).fetchInit(nil); init["method"] != nil || init["body"] != nil {
+		t.Errorf("fetchInit() of a plain URL = %v; want the defaults of fetch", init)
+	}
+}
+
+func TestStepFetchDownload(t *testing.T) {
+	ctx := newFixtureBrowserContext(t)
+
+	// A single page application storing its API token in the localStorage, the API requires it as Authorization header
+	mux := http.NewServeMux()
+	mux.HandleFunc("/app", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><body><script>localStorage.setItem('token', 'secret');</script></body></html>`)
+	})
+	mux.HandleFunc("/api/invoices/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" || r.Header.Get("Accept") != "application/pdf" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="invoice-%s.pdf"`, filepath.Base(filepath.Dir(r.URL.Path))))
+		fmt.Fprintf(w, "%%PDF-1.4 %s", r.URL.Path)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	if err := chromedp.Run(ctx, chromedp.Navigate(server.URL+"/app")); err != nil {
+		t.Fatalf("error opening fixture: %s", err)
+	}
+
+	script := `['1', '2'].map(id => ({url: '/api/invoices/' + id + '/pdf', headers: {Authorization: 'Bearer ' + localStorage.getItem('token')}}))`
+	b := &BrowserDriver{logger: slog.Default(), downloadsDirectory: t.TempDir(), supplier: "example"}
+	step := parser.Step{Action: "fetchDownload", Value: script, Headers: map[string]string{"Accept": "application/pdf"}}
+	result := b.stepFetchDownload(ctx, step)
+	if result.Status != "success" {
+		t.Fatalf("stepFetchDownload() = %s (%s); want success", result.Status, result.Message)
+	}
+	if b.downloadedFilesCount.Load() != 2 {
+		t.Errorf("stepFetchDownload() downloaded %d files; want 2", b.downloadedFilesCount.Load())
+	}
+	for _, id := range []string{"1", "2"} {
+		content, err := os.ReadFile(filepath.Join(b.downloadsDirectory, "invoice-"+id+".pdf"))
+		if err != nil {
+			t.Errorf("invoice %s was not downloaded: %s", id, err)
+			continue
+		}
+		if string(content) != "%PDF-1.4 /api/invoices/"+id+"/pdf" {
+			t.Errorf("invoice %s has the content %q; want the invoice", id, content)
+		}
+	}
+
+	// Without the token, the API rejects the download and the step fails
+	b = &BrowserDriver{logger: slog.Default(), downloadsDirectory: t.TempDir(), supplier: "example"}
+	step = parser.Step{Action: "fetchDownload", Value: `'/api/invoices/1/pdf'`, Headers: map[string]string{"Accept": "application/pdf"}}
+	if result := b.stepFetchDownload(ctx, step); result.Status != "error" {
+		t.Errorf("stepFetchDownload() without token = %s; want error", result.Status)
+	}
+}
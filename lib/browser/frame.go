@@ -0,0 +1,50 @@
+package browser
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"buchhalter/lib/parser"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/chromedp"
+)
+
+// getFrameQueryOptions restricts the query options to the iframe referenced by the `frame` option of step.
+// Without a `frame` option, opts are returned unchanged.
+//
+// Only same-origin iframes are supported, because chromedp can't query the content document of cross-origin iframes.
+func (b *BrowserDriver) getFrameQueryOptions(ctx context.Context, step parser.Step, opts []chromedp.QueryOption) ([]chromedp.QueryOption, error) {
+	if len(step.Frame) == 0 {
+		return opts, nil
+	}
+
+	frameReference, err := parser.ParseFrameReference(step.Frame)
+	if err != nil {
+		return opts, err
+	}
+
+	frameSelector := "iframe"
+	frameIndex := frameReference.Index
+	if len(frameReference.Name) > 0 {
+		quotedName := strconv.Quote(frameReference.Name)
+		frameSelector = fmt.Sprintf("iframe[name=%s], iframe[id=%s]", quotedName, quotedName)
+		frameIndex = 0
+	}
+
+	b.logger.Debug("Executing recipe step ... resolving frame", "action", step.Action, "frame", step.Frame, "frame_selector", frameSelector)
+
+	var frames []*cdp.Node
+	if err := chromedp.Run(ctx,
+		chromedp.WaitReady(frameSelector, chromedp.ByQuery),
+		chromedp.Nodes(frameSelector, &frames, chromedp.ByQueryAll),
+	); err != nil {
+		return opts, fmt.Errorf("error resolving frame `%s`: %w", step.Frame, err)
+	}
+	if frameIndex >= len(frames) {
+		return opts, fmt.Errorf("frame `%s` not found, the page has %d matching iframes", step.Frame, len(frames))
+	}
+
+	return append(opts, chromedp.FromNode(frames[frameIndex])), nil
+}
@@ -0,0 +1,64 @@
+package browser
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"buchhalter/lib/parser"
+	"buchhalter/lib/utils"
+
+	"github.com/chromedp/chromedp"
+)
+
+func TestFrameOption(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame string
+	}{
+		{"frame by name", "invoices"},
+		{"frame by index", "1"},
+	}
+
+	for _, test := range tests {
+		ctx := newFixtureBrowserContext(t)
+
+		server := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+		defer server.Close()
+
+		if err := chromedp.Run(ctx, chromedp.Navigate(server.URL+"/iframe.html")); err != nil {
+			t.Fatalf("%s: error opening fixture: %s", test.name, err)
+		}
+
+		b := &BrowserDriver{logger: slog.Default()}
+		steps := []parser.Step{
+			{Action: "waitFor", Selector: "button.download", SelectorType: parser.SelectorTypeQuery, Frame: test.frame},
+			{Action: "click", Selector: "button.download", SelectorType: parser.SelectorTypeQuery, Frame: test.frame},
+		}
+		for _, step := range steps {
+			var result utils.StepResult
+			switch step.Action {
+			case "waitFor":
+				result = b.stepWaitFor(ctx, step)
+			case "click":
+				result = b.stepClick(ctx, step)
+			}
+			if result.Status != "success" {
+				t.Fatalf("%s: step %s (%s) failed: %s", test.name, step.Action, step.Selector, result.Message)
+			}
+		}
+
+		frameOpts, err := b.getFrameQueryOptions(ctx, parser.Step{Action: "waitFor", Frame: test.frame}, []chromedp.QueryOption{chromedp.ByQuery})
+		if err != nil {
+			t.Fatalf("%s: error resolving frame: %s", test.name, err)
+		}
+		var text string
+		if err := chromedp.Run(ctx, chromedp.Text("#result", &text, frameOpts...)); err != nil {
+			t.Fatalf("%s: error reading result: %s", test.name, err)
+		}
+		if expected := "download started"; text != expected {
+			t.Errorf("%s: result = %q; want %q", test.name, text, expected)
+		}
+	}
+}
@@ -0,0 +1,426 @@
+package browser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"buchhalter/lib/utils"
+
+	"github.com/chromedp/cdproto/network"
+)
+
+// harMaxBodySize is the maximum size of a recorded request or response body, larger bodies are truncated.
+// Only text bodies (e.g. JSON) are recorded, binary bodies (e.g. PDFs) only with their size.
+const harMaxBodySize = 1 << 20
+
+// harRedactedHeaders are the headers whose values are never recorded.
+var harRedactedHeaders = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+	"set-cookie":          true,
+}
+
+// HARRecorder records the HTTP traffic of `client` recipes as HAR 1.2 file (`--har`), e.g. to fix the extraction paths of a recipe.
+// It records the requests of the HTTP client (see Transport) and the network events of the browser (bodies are only recorded for the HTTP client).
+// Authorization and cookie headers are redacted, as well as the secrets in URLs and bodies (see utils.Redact).
+type HARRecorder struct {
+	mu      sync.Mutex
+	creator harCreator
+	pages   []harPage
+	entries []*harEntry
+	// page is the page (supplier) of new entries, pending the requests of the browser without response yet
+	page    string
+	pending map[network.RequestID]*harEntry
+}
+
+// NewHARRecorder returns a recorder, cliVersion is the version of the creator of the HAR file.
+func NewHARRecorder(cliVersion string) *HARRecorder {
+	return &HARRecorder{
+		creator: harCreator{Name: "buchhalter-cli", Version: cliVersion},
+		pages:   []harPage{},
+		entries: []*harEntry{},
+		pending: map[network.RequestID]*harEntry{},
+	}
+}
+
+type harFile struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string      `json:"version"`
+	Creator harCreator  `json:"creator"`
+	Pages   []harPage   `json:"pages"`
+	Entries []*harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harPage struct {
+	StartedDateTime time.Time      `json:"startedDateTime"`
+	ID              string         `json:"id"`
+	Title           string         `json:"title"`
+	PageTimings     harPageTimings `json:"pageTimings"`
+}
+
+type harPageTimings struct {
+	OnLoad int `json:"onLoad"`
+}
+
+type harEntry struct {
+	Pageref         string      `json:"pageref,omitempty"`
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []struct{}     `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []struct{}     `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// StartPage starts the page of a recipe run, the following entries belong to it.
+func (r *HARRecorder) StartPage(supplier string, startedAt time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id := fmt.Sprintf("page_%d", len(r.pages)+1)
+	r.pages = append(r.pages, harPage{StartedDateTime: startedAt.UTC(), ID: id, Title: supplier, PageTimings: harPageTimings{OnLoad: -1}})
+	r.page = id
+}
+
+// Transport returns a round tripper recording the requests sent via next.
+func (r *HARRecorder) Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &harTransport{recorder: r, next: next}
+}
+
+type harTransport struct {
+	recorder *HARRecorder
+	next     http.RoundTripper
+}
+
+func (t *harTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	entry := &harEntry{
+		StartedDateTime: time.Now().UTC(),
+		Request: harRequest{
+			Method:      req.Method,
+			URL:         utils.Redact(req.URL.String()),
+			HTTPVersion: req.Proto,
+			Cookies:     []struct{}{},
+			Headers:     harHeaders(req.Header),
+			QueryString: harQueryString(req.URL),
+			HeadersSize: -1,
+			BodySize:    0,
+		},
+		Response: harResponse{Cookies: []struct{}{}, Headers: []harNameValue{}, HeadersSize: -1, BodySize: -1},
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		mimeType := req.Header.Get("Content-Type")
+		entry.Request.BodySize = len(body)
+		entry.Request.PostData = &harPostData{MimeType: mimeType, Text: harBodyText(mimeType, body)}
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	wait := time.Since(entry.StartedDateTime)
+	entry.Time = milliseconds(wait)
+	entry.Timings = harTimings{Wait: milliseconds(wait)}
+	if err != nil {
+		entry.Comment = utils.Redact(err.Error())
+		t.recorder.add(entry)
+		return resp, err
+	}
+
+	entry.Response.Status = resp.StatusCode
+	entry.Response.StatusText = strings.TrimSpace(strings.TrimPrefix(resp.Status, fmt.Sprint(resp.StatusCode)))
+	entry.Response.HTTPVersion = resp.Proto
+	entry.Response.Headers = harHeaders(resp.Header)
+	entry.Response.RedirectURL = utils.Redact(resp.Header.Get("Location"))
+	entry.Response.Content.MimeType = resp.Header.Get("Content-Type")
+	t.recorder.add(entry)
+
+	// The body is recorded while the caller reads it, the response is not buffered
+	resp.Body = &harBody{ReadCloser: resp.Body, recorder: t.recorder, entry: entry, startedAt: time.Now()}
+	return resp, nil
+}
+
+// harBody records a response body while it is read.
+type harBody struct {
+	io.ReadCloser
+	recorder  *HARRecorder
+	entry     *harEntry
+	startedAt time.Time
+	content   bytes.Buffer
+	size      int
+}
+
+func (b *harBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.size += n
+	if b.content.Len() < harMaxBodySize {
+		b.content.Write(p[:min(n, harMaxBodySize-b.content.Len())])
+	}
+	return n, err
+}
+
+func (b *harBody) Close() error {
+	receive := time.Since(b.startedAt)
+
+	b.recorder.mu.Lock()
+	b.entry.Response.BodySize = b.size
+	b.entry.Response.Content.Size = b.size
+	b.entry.Response.Content.Text = harBodyText(b.entry.Response.Content.MimeType, b.content.Bytes())
+	if b.size > harMaxBodySize && len(b.entry.Response.Content.Text) > 0 {
+		b.entry.Response.Content.Comment = fmt.Sprintf("truncated to %d bytes", harMaxBodySize)
+	}
+	b.entry.Timings.Receive = milliseconds(receive)
+	b.entry.Time += milliseconds(receive)
+	b.recorder.mu.Unlock()
+
+	return b.ReadCloser.Close()
+}
+
+// recordNetworkEvent records the requests of the browser (network events of chromedp), without their bodies.
+// An entry is added once its request finished or failed.
+func (r *HARRecorder) recordNetworkEvent(ev interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch ev := ev.(type) {
+	case *network.EventRequestWillBeSent:
+		if ev.Request == nil {
+			return
+		}
+		requestUrl := utils.Redact(ev.Request.URL)
+		parsedUrl, _ := url.Parse(ev.Request.URL)
+		entry := &harEntry{
+			Pageref:         r.page,
+			StartedDateTime: time.Now().UTC(),
+			Request: harRequest{
+				Method:      ev.Request.Method,
+				URL:         requestUrl,
+				HTTPVersion: "",
+				Cookies:     []struct{}{},
+				Headers:     harNetworkHeaders(ev.Request.Headers),
+				QueryString: harQueryString(parsedUrl),
+				HeadersSize: -1,
+				BodySize:    0,
+			},
+			Response: harResponse{Cookies: []struct{}{}, Headers: []harNameValue{}, HeadersSize: -1, BodySize: -1},
+			Comment:  "browser",
+		}
+		if ev.WallTime != nil {
+			entry.StartedDateTime = ev.WallTime.Time().UTC()
+		}
+		if previous, ok := r.pending[ev.RequestID]; ok && ev.RedirectResponse != nil {
+			// Redirects keep the request ID, the previous request is finished by the redirect
+			r.setNetworkResponse(previous, ev.RedirectResponse)
+			r.entries = append(r.entries, previous)
+		}
+		r.pending[ev.RequestID] = entry
+	case *network.EventResponseReceived:
+		if entry, ok := r.pending[ev.RequestID]; ok && ev.Response != nil {
+			r.setNetworkResponse(entry, ev.Response)
+		}
+	case *network.EventLoadingFinished:
+		if entry, ok := r.pending[ev.RequestID]; ok {
+			entry.Response.BodySize = int(ev.EncodedDataLength)
+			entry.Response.Content.Size = int(ev.EncodedDataLength)
+			entry.Time = milliseconds(time.Since(entry.StartedDateTime))
+			r.entries = append(r.entries, entry)
+			delete(r.pending, ev.RequestID)
+		}
+	case *network.EventLoadingFailed:
+		if entry, ok := r.pending[ev.RequestID]; ok {
+			entry.Comment = "browser: " + utils.Redact(ev.ErrorText)
+			entry.Time = milliseconds(time.Since(entry.StartedDateTime))
+			r.entries = append(r.entries, entry)
+			delete(r.pending, ev.RequestID)
+		}
+	}
+}
+
+// setNetworkResponse sets the response of a network event, r.mu must be locked.
+func (r *HARRecorder) setNetworkResponse(entry *harEntry, resp *network.Response) {
+	entry.Request.HTTPVersion = resp.Protocol
+	entry.Response.Status = int(resp.Status)
+	entry.Response.StatusText = resp.StatusText
+	entry.Response.HTTPVersion = resp.Protocol
+	entry.Response.Headers = harNetworkHeaders(resp.Headers)
+	entry.Response.Content.MimeType = resp.MimeType
+	if location, ok := resp.Headers["Location"].(string); ok {
+		entry.Response.RedirectURL = utils.Redact(location)
+	}
+}
+
+func (r *HARRecorder) add(entry *harEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry.Pageref = r.page
+	r.entries = append(r.entries, entry)
+}
+
+// Write writes the recorded traffic as HAR file, the entries are sorted by their start.
+// The file is only readable by the user, redaction may miss secrets it doesn't know.
+func (r *HARRecorder) Write(file string) error {
+	r.mu.Lock()
+	entries := append([]*harEntry{}, r.entries...)
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].StartedDateTime.Before(entries[j].StartedDateTime) })
+	content, err := json.MarshalIndent(harFile{Log: harLog{Version: "1.2", Creator: r.creator, Pages: r.pages, Entries: entries}}, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("error encoding HAR file: %w", err)
+	}
+	content = append(content, '\n')
+
+	if err := utils.CreateDirectoryIfNotExists(filepath.Dir(file)); err != nil {
+		return fmt.Errorf("error creating directory of HAR file %s: %w", file, err)
+	}
+	if err := os.WriteFile(file, content, 0600); err != nil {
+		return fmt.Errorf("error writing HAR file %s: %w", file, err)
+	}
+	return nil
+}
+
+// harHeaders returns the headers in the order of their names, with redacted values.
+func harHeaders(header http.Header) []harNameValue {
+	headers := []harNameValue{}
+	for name, values := range header {
+		for _, value := range values {
+			headers = append(headers, harHeader(name, value))
+		}
+	}
+	sort.SliceStable(headers, func(i, j int) bool { return headers[i].Name < headers[j].Name })
+	return headers
+}
+
+// harNetworkHeaders returns the headers of a network event, see harHeaders.
+func harNetworkHeaders(header network.Headers) []harNameValue {
+	headers := []harNameValue{}
+	for name, value := range header {
+		headers = append(headers, harHeader(name, fmt.Sprint(value)))
+	}
+	sort.SliceStable(headers, func(i, j int) bool { return headers[i].Name < headers[j].Name })
+	return headers
+}
+
+func harHeader(name, value string) harNameValue {
+	if harRedactedHeaders[strings.ToLower(name)] {
+		return harNameValue{Name: name, Value: "[REDACTED]"}
+	}
+	return harNameValue{Name: name, Value: utils.Redact(value)}
+}
+
+func harQueryString(u *url.URL) []harNameValue {
+	queryString := []harNameValue{}
+	if u == nil {
+		return queryString
+	}
+	for name, values := range u.Query() {
+		for _, value := range values {
+			// Redacted as parameter, the name tells whether the value is sensitive (e.g. `code_verifier`)
+			redacted := utils.Redact(name + "=" + value)
+			if !strings.HasPrefix(redacted, name+"=") {
+				redacted = name + "=" + utils.Redact(value)
+			}
+			queryString = append(queryString, harNameValue{Name: name, Value: strings.TrimPrefix(redacted, name+"=")})
+		}
+	}
+	sort.SliceStable(queryString, func(i, j int) bool { return queryString[i].Name < queryString[j].Name })
+	return queryString
+}
+
+// harBodyText returns the redacted body of a text mime type (e.g. JSON or forms), binary bodies are not recorded.
+// Bodies without mime type are recorded, if they are valid UTF-8.
+func harBodyText(mimeType string, body []byte) string {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil && len(mimeType) > 0 {
+		return ""
+	}
+	if len(mediaType) == 0 && !utf8.Valid(body) {
+		return ""
+	}
+	if len(mediaType) > 0 && !strings.HasPrefix(mediaType, "text/") && !strings.Contains(mediaType, "json") && !strings.Contains(mediaType, "xml") &&
+		!strings.Contains(mediaType, "javascript") && mediaType != "application/x-www-form-urlencoded" {
+		return ""
+	}
+	if len(body) > harMaxBodySize {
+		body = body[:harMaxBodySize]
+	}
+	return utils.Redact(string(body))
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,149 @@
+package browser
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chromedp/cdproto/network"
+)
+
+func TestHARRecorderTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/items":
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Set-Cookie", "session=secret-session")
+			fmt.Fprint(w, `{"items": [{"id": "1"}], "access_token": "secret-access-token"}`)
+		case "/documents/1":
+			w.Header().Set("Content-Type", "application/pdf")
+			fmt.Fprint(w, "%PDF-1.4 invoice")
+		}
+	}))
+	defer server.Close()
+
+	recorder := NewHARRecorder("1.2.3")
+	recorder.StartPage("example", time.Now())
+	b := &ClientAuthBrowserDriver{httpClient: http.DefaultClient}
+	b.SetHARRecorder(recorder)
+	if b.httpClient == http.DefaultClient || http.DefaultClient.Transport != nil {
+		t.Fatalf("SetHARRecorder() changed the default HTTP client")
+	}
+
+	for _, request := range []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{http.MethodPost, "/items?page=2&token=secret-query-token", `{"since": "2024-01-01"}`},
+		{http.MethodGet, "/documents/1", ""},
+	} {
+		req, err := http.NewRequest(request.method, server.URL+request.path, strings.NewReader(request.body))
+		if err != nil {
+			t.Fatalf("error creating request: %s", err)
+		}
+		req.Header.Set("Authorization", "Bearer secret-bearer-token")
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := b.httpClient.Do(req)
+		if err != nil {
+			t.Fatalf("error sending request: %s", err)
+		}
+		// The caller still gets the complete body
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if len(body) == 0 {
+			t.Errorf("%s returned an empty body", request.path)
+		}
+	}
+
+	file := filepath.Join(t.TempDir(), "traffic.har")
+	if err := recorder.Write(file); err != nil {
+		t.Fatalf("Write() returned error: %s", err)
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("error reading HAR file: %s", err)
+	}
+	for _, secret := range []string{"secret-bearer-token", "secret-session", "secret-access-token", "secret-query-token"} {
+		if strings.Contains(string(content), secret) {
+			t.Errorf("HAR file contains the secret %s", secret)
+		}
+	}
+
+	var har harFile
+	if err := json.Unmarshal(content, &har); err != nil {
+		t.Fatalf("HAR file is no valid JSON: %s", err)
+	}
+	if har.Log.Version != "1.2" || har.Log.Creator.Version != "1.2.3" || len(har.Log.Pages) != 1 || har.Log.Pages[0].Title != "example" {
+		t.Errorf("HAR file has the log %+v; want version 1.2 with the page of the supplier", har.Log)
+	}
+	if len(har.Log.Entries) != 2 {
+		t.Fatalf("HAR file has %d entries; want 2", len(har.Log.Entries))
+	}
+	items, document := har.Log.Entries[0], har.Log.Entries[1]
+	if items.Pageref != har.Log.Pages[0].ID || items.Request.Method != http.MethodPost || items.Response.Status != http.StatusOK {
+		t.Errorf("entry of the items = %+v; want the POST request of the page", items)
+	}
+	if items.Request.PostData == nil || items.Request.PostData.Text != `{"since": "2024-01-01"}` {
+		t.Errorf("entry of the items has the request body %+v; want the JSON body", items.Request.PostData)
+	}
+	if !strings.Contains(items.Response.Content.Text, `"items": [{"id": "1"}]`) {
+		t.Errorf("entry of the items has the response body %q; want the JSON body", items.Response.Content.Text)
+	}
+	if fmt.Sprint(items.Request.QueryString) != "[{page 2} {token [REDACTED]}]" {
+		t.Errorf("entry of the items has the query string %v; want the redacted parameters", items.Request.QueryString)
+	}
+	if document.Response.Content.Text != "" || document.Response.Content.Size != len("%PDF-1.4 invoice") {
+		t.Errorf("entry of the document has the content %+v; want only the size of the PDF", document.Response.Content)
+	}
+}
+
+func TestHARRecorderNetworkEvents(t *testing.T) {
+	recorder := NewHARRecorder("1.2.3")
+	recorder.StartPage("example", time.Now())
+
+	recorder.recordNetworkEvent(&network.EventRequestWillBeSent{
+		RequestID: "1",
+		Request:   &network.Request{URL: "https://login.example.com/authorize?code_verifier=secret-verifier", Method: http.MethodGet, Headers: network.Headers{"Cookie": "session=secret"}},
+	})
+	recorder.recordNetworkEvent(&network.EventRequestWillBeSent{
+		RequestID: "2",
+		Request:   &network.Request{URL: "https://login.example.com/blocked", Method: http.MethodGet},
+	})
+	// Redirects finish the previous request of the same request ID
+	recorder.recordNetworkEvent(&network.EventRequestWillBeSent{
+		RequestID:        "1",
+		Request:          &network.Request{URL: "https://login.example.com/callback", Method: http.MethodGet},
+		RedirectResponse: &network.Response{Status: http.StatusFound, Headers: network.Headers{"Location": "https://login.example.com/callback"}, Protocol: "h2"},
+	})
+	recorder.recordNetworkEvent(&network.EventResponseReceived{RequestID: "1", Response: &network.Response{Status: http.StatusOK, MimeType: "text/html", Protocol: "h2"}})
+	recorder.recordNetworkEvent(&network.EventLoadingFinished{RequestID: "1", EncodedDataLength: 42})
+	recorder.recordNetworkEvent(&network.EventLoadingFailed{RequestID: "2", ErrorText: "net::ERR_BLOCKED_BY_CLIENT"})
+	// Events of unknown requests are ignored
+	recorder.recordNetworkEvent(&network.EventLoadingFinished{RequestID: "3"})
+
+	if len(recorder.entries) != 3 || len(recorder.pending) != 0 {
+		t.Fatalf("recorded %d entries (%d pending); want 3 entries", len(recorder.entries), len(recorder.pending))
+	}
+	// Entries are added once finished, Write sorts them by their start
+	redirect, callback, failed := recorder.entries[0], recorder.entries[1], recorder.entries[2]
+	if redirect.Response.Status != http.StatusFound || redirect.Response.RedirectURL != "https://login.example.com/callback" {
+		t.Errorf("redirect entry = %+v; want the redirect response", redirect.Response)
+	}
+	if strings.Contains(redirect.Request.URL, "secret-verifier") || fmt.Sprint(redirect.Request.Headers) != "[{Cookie [REDACTED]}]" {
+		t.Errorf("redirect entry has the request %+v; want the secrets redacted", redirect.Request)
+	}
+	if failed.Comment != "browser: net::ERR_BLOCKED_BY_CLIENT" {
+		t.Errorf("failed entry has the comment %q; want the error", failed.Comment)
+	}
+	if callback.Response.Status != http.StatusOK || callback.Response.Content.Size != 42 || callback.Pageref != "page_1" {
+		t.Errorf("callback entry = %+v; want the response of the page", callback)
+	}
+}
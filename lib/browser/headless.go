@@ -0,0 +1,44 @@
+package browser
+
+import (
+	"strings"
+
+	"github.com/chromedp/chromedp"
+)
+
+// HeadlessPolicy decides per supplier whether Chrome runs headless (without a visible window).
+// Some portals detect headless browsers (anti-bot), so their suppliers can be forced to run headful in a headless sync.
+type HeadlessPolicy struct {
+	headless bool
+	headful  map[string]bool
+}
+
+// NewHeadlessPolicy returns a policy running all suppliers headless (if headless is set), except the headfulSuppliers.
+// Suppliers are compared case-insensitive (see `buchhalter_headful_suppliers`).
+func NewHeadlessPolicy(headless bool, headfulSuppliers []string) HeadlessPolicy {
+	headful := map[string]bool{}
+	for _, supplier := range headfulSuppliers {
+		supplier = strings.ToLower(strings.TrimSpace(supplier))
+		if len(supplier) > 0 {
+			headful[supplier] = true
+		}
+	}
+	return HeadlessPolicy{headless: headless, headful: headful}
+}
+
+// Headless returns true if the recipe of supplier runs in a headless Chrome.
+func (p HeadlessPolicy) Headless(supplier string) bool {
+	return p.headless && !p.headful[strings.ToLower(strings.TrimSpace(supplier))]
+}
+
+// headlessFlags returns the exec allocator options to start Chrome headless or with a visible window.
+// Headless, the window size of a common desktop is used, the default window of headless Chrome is a lot smaller.
+func headlessFlags(headless bool) []chromedp.ExecAllocatorOption {
+	if !headless {
+		return []chromedp.ExecAllocatorOption{chromedp.Flag("headless", false)}
+	}
+	return []chromedp.ExecAllocatorOption{
+		chromedp.Flag("headless", true),
+		chromedp.WindowSize(1920, 1080),
+	}
+}
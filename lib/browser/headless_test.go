@@ -0,0 +1,34 @@
+package browser
+
+import "testing"
+
+func TestHeadlessPolicy(t *testing.T) {
+	tests := []struct {
+		name             string
+		headless         bool
+		headfulSuppliers []string
+		supplier         string
+		expected         bool
+	}{
+		{"headful sync", false, nil, "hetzner", false},
+		{"headful sync with headful supplier", false, []string{"hetzner"}, "hetzner", false},
+		{"headless sync", true, nil, "hetzner", true},
+		{"headless sync with headful supplier", true, []string{" Hetzner "}, "hetzner", false},
+		{"headless sync with other headful supplier", true, []string{"aws", ""}, "hetzner", true},
+		{"supplier case-insensitive", true, []string{"digitalocean"}, "DigitalOcean", false},
+	}
+
+	for _, test := range tests {
+		policy := NewHeadlessPolicy(test.headless, test.headfulSuppliers)
+		if headless := policy.Headless(test.supplier); headless != test.expected {
+			t.Errorf("%s: Headless(%s) = %t; want %t", test.name, test.supplier, headless, test.expected)
+		}
+	}
+
+	if flags := headlessFlags(false); len(flags) != 1 {
+		t.Errorf("headlessFlags(false) returned %d options; want 1", len(flags))
+	}
+	if flags := headlessFlags(true); len(flags) != 2 {
+		t.Errorf("headlessFlags(true) returned %d options; want 2", len(flags))
+	}
+}
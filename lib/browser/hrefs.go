@@ -0,0 +1,236 @@
+package browser
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"buchhalter/lib/parser"
+	"buchhalter/lib/utils"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+)
+
+// fetchHrefScript downloads a URL with the fetch API of the page, incl. the cookies of the session.
+// The optional second argument are the fetch options of the request (e.g. method and headers of `fetchDownload` steps).
+// The content is returned base64 encoded, in chunks to not exceed the maximum number of function arguments.
+const fetchHrefScript = `(async (url, init) => {
+	const response = await fetch(url, Object.assign({credentials: 'include'}, init));
+	if (!response.ok) {
+		return {status: response.status};
+	}
+	const bytes = new Uint8Array(await response.arrayBuffer());
+	let binary = '';
+	for (let i = 0; i < bytes.length; i += 0x8000) {
+		binary += String.fromCharCode.apply(null, bytes.subarray(i, i + 0x8000));
+	}
+	return {status: response.status, contentDisposition: response.headers.get('Content-Disposition') || '', data: btoa(binary)};
+})(%s)`
+
+type hrefDownload struct {
+	Status             int    `json:"status"`
+	ContentDisposition string `json:"contentDisposition"`
+	Data               string `json:"data"`
+}
+
+// stepDownloadHrefs downloads the `href` targets of the links matching the selector directly, without clicking them.
+// The downloads run inside the page (fetch API), so the session of the portal is used.
+// Links to other origins must allow CORS requests. Links inside a same-origin iframe (`frame`) are resolved against the URL of the iframe.
+func (b *BrowserDriver) stepDownloadHrefs(ctx context.Context, step parser.Step) utils.StepResult {
+	maxFiles := b.getMaxFiles(step)
+	b.logger.Debug("Executing recipe step", "action", step.Action, "selector", step.Selector, "max_files", maxFiles)
+
+	opts := []chromedp.QueryOption{}
+	selector, opts := b.getSelectorTypeQueryOptions(step, opts)
+	// The nodes are queried with the default search, except for converted selectors (e.g. shadow DOM JS expressions)
+	nodesOpts := []chromedp.QueryOption{}
+	if selector != step.Selector {
+		nodesOpts = opts
+	}
+	// Nodes inside an iframe are queried from the iframe content document
+	frameOpts, err := b.getFrameQueryOptions(ctx, step, []chromedp.QueryOption{})
+	if err != nil {
+		return utils.StepResult{Status: "error", Message: err.Error(), ErrorCode: utils.ErrorCodeSelectorNotFound}
+	}
+	opts = append(opts, frameOpts...)
+	nodesOpts = append(nodesOpts, frameOpts...)
+	var nodes []*cdp.Node
+	var pageUrl string
+	err = chromedp.Run(ctx, chromedp.Tasks{
+		chromedp.WaitReady(selector, opts...),
+		chromedp.Nodes(selector, &nodes, nodesOpts...),
+		chromedp.Location(&pageUrl),
+	})
+	if err != nil {
+		return utils.StepResult{Status: "error", Message: err.Error(), ErrorCode: utils.ErrorCodeSelectorNotFound}
+	}
+
+	hrefs, err := resolveHrefs(pageUrl, nodes)
+	if err != nil {
+		return utils.StepResult{Status: "error", Message: err.Error(), ErrorCode: utils.ErrorCodeDownloadFailed}
+	}
+	if limit := maxDownloads(len(hrefs), maxFiles); limit < len(hrefs) {
+		b.logger.Debug("Limiting downloads, because max_files_downloaded is reached", "action", step.Action, "max_files_downloaded", maxFiles, "num_hrefs", len(hrefs))
+		hrefs = hrefs[:limit]
+	}
+
+	b.downloadedFilesCount.Store(0)
+	for i, href := range hrefs {
+		b.logger.Debug("Executing recipe step ... download", "action", step.Action, "url", href, "loop", i)
+
+		hrefJson, err := json.Marshal(href)
+		if err != nil {
+			return utils.StepResult{Status: "error", Message: err.Error()}
+		}
+		var download hrefDownload
+		if err := chromedp.Run(ctx, chromedp.Evaluate(fmt.Sprintf(fetchHrefScript, hrefJson), &download, func(p *runtime.EvaluateParams) *runtime.EvaluateParams {
+			return p.WithAwaitPromise(true)
+		})); err != nil {
+			return utils.StepResult{Status: "error", Message: fmt.Sprintf("error downloading %s: %s", href, err), ErrorCode: utils.ErrorCodeNetwork}
+		}
+		if download.Status < 200 || download.Status > 299 {
+			return utils.StepResult{Status: "error", Message: fmt.Sprintf("error downloading %s: status code %d", href, download.Status), ErrorCode: statusErrorCode(download.Status)}
+		}
+
+		filename, size, err := b.writeHrefDownload(download, href, i+1)
+		if err != nil {
+			return utils.StepResult{Status: "error", Message: err.Error(), ErrorCode: utils.ErrorCodeDownloadFailed}
+		}
+		b.logger.Debug("Executing recipe step ... download completed", "action", step.Action, "url", href, "file", filename, "received_bytes", size)
+		b.downloadedFilesCount.Add(1)
+
+		if step.SleepDuration > 0 && i < len(hrefs)-1 {
+			time.Sleep(time.Duration(step.SleepDuration) * time.Millisecond)
+		}
+	}
+	b.logger.Info("All downloads completed", "action", step.Action, "num_files", b.downloadedFilesCount.Load())
+
+	return utils.StepResult{Status: "success"}
+}
+
+// writeHrefDownload writes the content of a download into the downloads directory and returns its path and size.
+// The filename is taken from the Content-Disposition header or the URL (see hrefFilename), existing files are not overwritten.
+func (b *BrowserDriver) writeHrefDownload(download hrefDownload, href string, number int) (string, int, error) {
+	content, err := base64.StdEncoding.DecodeString(download.Data)
+	if err != nil {
+		return "", 0, fmt.Errorf("error decoding download %s: %w", href, err)
+	}
+	filename := filepath.Join(b.downloadsDirectory, hrefFilename(download.ContentDisposition, href, b.supplier, number))
+	if _, err := os.Stat(filename); err == nil {
+		filename = filepath.Join(b.downloadsDirectory, fmt.Sprintf("%d-%s", number, filepath.Base(filename)))
+	}
+	if err := os.WriteFile(filename, content, 0600); err != nil {
+		return "", 0, fmt.Errorf("error writing download %s: %w", filename, err)
+	}
+	return filename, len(content), nil
+}
+
+// statusErrorCode classifies a download rejected with the HTTP status code status:
+// the portal answers 401 and 403 if the session expired or the login failed.
+func statusErrorCode(status int) utils.ErrorCode {
+	if status == http.StatusUnauthorized || status == http.StatusForbidden {
+		return utils.ErrorCodeAuthFailed
+	}
+	return utils.ErrorCodeDownloadFailed
+}
+
+// resolveHrefs returns the absolute, unique `href` targets of nodes, in the order of the nodes.
+// The targets are resolved against the document of a node (e.g. an iframe), or pageUrl if it is unknown.
+// Nodes without an `href` attribute and non-HTTP(S) links (e.g. `javascript:`) are skipped.
+func resolveHrefs(pageUrl string, nodes []*cdp.Node) ([]string, error) {
+	pageBase, err := url.Parse(pageUrl)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing page URL %s: %w", pageUrl, err)
+	}
+
+	hrefs := []string{}
+	seen := map[string]bool{}
+	for _, node := range nodes {
+		href, ok := node.Attribute("href")
+		href = strings.TrimSpace(href)
+		if !ok || len(href) == 0 {
+			continue
+		}
+		reference, err := url.Parse(href)
+		if err != nil {
+			continue
+		}
+		base := pageBase
+		if documentBase, err := url.Parse(documentUrl(node)); err == nil && documentBase.IsAbs() {
+			base = documentBase
+		}
+		resolved := base.ResolveReference(reference)
+		if resolved.Scheme != "http" && resolved.Scheme != "https" {
+			continue
+		}
+		resolved.Fragment = ""
+		if seen[resolved.String()] {
+			continue
+		}
+		seen[resolved.String()] = true
+		hrefs = append(hrefs, resolved.String())
+	}
+
+	return hrefs, nil
+}
+
+// documentUrl returns the base URL of the document node belongs to, or an empty string if the document is unknown.
+func documentUrl(node *cdp.Node) string {
+	for parent := node.Parent; parent != nil; parent = parent.Parent {
+		if parent.NodeType != cdp.NodeTypeDocument {
+			continue
+		}
+		if len(parent.BaseURL) > 0 {
+			return parent.BaseURL
+		}
+		return parent.DocumentURL
+	}
+	return ""
+}
+
+// hrefFilename returns the filename of a download: the filename of the Content-Disposition header,
+// the last segment of the URL path or `<supplier>-<number>.pdf` as fallback.
+func hrefFilename(contentDisposition, href, supplier string, number int) string {
+	filename := contentDispositionFilename(contentDisposition)
+	if len(filename) == 0 {
+		if hrefUrl, err := url.Parse(href); err == nil {
+			filename = sanitizeFilename(path.Base(hrefUrl.Path))
+		}
+	}
+	if len(filename) == 0 {
+		filename = fmt.Sprintf("%s-%d.pdf", supplier, number)
+	}
+
+	return filename
+}
+
+// contentDispositionFilename returns the sanitized filename of a Content-Disposition header (see sanitizeFilename),
+// incl. RFC 5987 encoded filenames (`filename*`). It returns an empty string without a filename.
+func contentDispositionFilename(contentDisposition string) string {
+	_, params, err := mime.ParseMediaType(contentDisposition)
+	if err != nil {
+		return ""
+	}
+	return sanitizeFilename(params["filename"])
+}
+
+// sanitizeFilename returns the last path segment of filename, so it never points outside of the downloads directory.
+// It returns an empty string, if no filename is left.
+func sanitizeFilename(filename string) string {
+	filename = filepath.Base(filepath.Clean("/" + strings.ReplaceAll(filename, "\\", "/")))
+	if filename == "/" || filename == "." || filename == ".." {
+		return ""
+	}
+	return filename
+}
@@ -0,0 +1,173 @@
+package browser
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"buchhalter/lib/parser"
+	"buchhalter/lib/utils"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/chromedp"
+)
+
+func TestResolveHrefs(t *testing.T) {
+	nodes := []*cdp.Node{
+		{Attributes: []string{"href", "/invoices/2024-05.pdf"}},
+		{Attributes: []string{"href", "2024-04.pdf", "class", "invoice"}},
+		{Attributes: []string{"href", "https://cdn.example.com/2024-03.pdf#page=1"}},
+		{Attributes: []string{"href", "/invoices/2024-05.pdf"}},
+		{Attributes: []string{"href", "javascript:void(0)"}},
+		{Attributes: []string{"class", "no-link"}},
+	}
+
+	hrefs, err := resolveHrefs("https://portal.example.com/invoices/list?page=1", nodes)
+	if err != nil {
+		t.Fatalf("resolveHrefs() returned error: %s", err)
+	}
+	expected := []string{
+		"https://portal.example.com/invoices/2024-05.pdf",
+		"https://portal.example.com/invoices/2024-04.pdf",
+		"https://cdn.example.com/2024-03.pdf",
+	}
+	if fmt.Sprint(hrefs) != fmt.Sprint(expected) {
+		t.Errorf("resolveHrefs() = %v; want %v", hrefs, expected)
+	}
+
+	// Links of an iframe are resolved against the URL of the iframe document
+	frameDocument := &cdp.Node{NodeType: cdp.NodeTypeDocument, DocumentURL: "https://portal.example.com/frames/invoices.html"}
+	frameNodes := []*cdp.Node{{Attributes: []string{"href", "2024-02.pdf"}, Parent: &cdp.Node{NodeName: "BODY", Parent: frameDocument}}}
+	hrefs, err = resolveHrefs("https://portal.example.com/invoices/list?page=1", frameNodes)
+	if err != nil {
+		t.Fatalf("resolveHrefs() returned error: %s", err)
+	}
+	if expected := []string{"https://portal.example.com/frames/2024-02.pdf"}; fmt.Sprint(hrefs) != fmt.Sprint(expected) {
+		t.Errorf("resolveHrefs() of iframe links = %v; want %v", hrefs, expected)
+	}
+}
+
+func TestHrefFilename(t *testing.T) {
+	tests := []struct {
+		contentDisposition string
+		href               string
+		expected           string
+	}{
+		{"", "https://portal.example.com/invoices/2024-05.pdf", "2024-05.pdf"},
+		{`attachment; filename="Rechnung 2024-05.pdf"`, "https://portal.example.com/download?id=1", "Rechnung 2024-05.pdf"},
+		{`attachment; filename="../../etc/passwd"`, "https://portal.example.com/download?id=1", "passwd"},
+		{`attachment; filename="..\..\invoice.pdf"`, "https://portal.example.com/download?id=1", "invoice.pdf"},
+		{"", "https://portal.example.com/", "example-3.pdf"},
+	}
+
+	for _, test := range tests {
+		if filename := hrefFilename(test.contentDisposition, test.href, "example", 3); filename != test.expected {
+			t.Errorf("hrefFilename(%q, %q) = %q; want %q", test.contentDisposition, test.href, filename, test.expected)
+		}
+	}
+}
+
+func TestStatusErrorCode(t *testing.T) {
+	tests := []struct {
+		status   int
+		expected utils.ErrorCode
+	}{
+		{http.StatusUnauthorized, utils.ErrorCodeAuthFailed},
+		{http.StatusForbidden, utils.ErrorCodeAuthFailed},
+		{http.StatusNotFound, utils.ErrorCodeDownloadFailed},
+		{http.StatusInternalServerError, utils.ErrorCodeDownloadFailed},
+	}
+
+	for _, test := range tests {
+		if code := statusErrorCode(test.status); code != test.expected {
+			t.Errorf("statusErrorCode(%d) = %s; want %s", test.status, code, test.expected)
+		}
+	}
+}
+
+func TestStepDownloadHrefs(t *testing.T) {
+	ctx := newFixtureBrowserContext(t)
+
+	// An invoice list with static PDF links, the invoices are only available within the session
+	mux := http.NewServeMux()
+	mux.HandleFunc("/invoices", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "valid"})
+		fmt.Fprint(w, `<html><body>
+<a class="invoice" href="/files/2024-05.pdf">May</a>
+<a class="invoice" href="files/2024-04.pdf">April</a>
+<a class="help" href="/help">Help</a>
+</body></html>`)
+	})
+	// The invoice list of another page is embedded as iframe, its links are relative to the iframe
+	mux.HandleFunc("/framed", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><body><iframe name="invoices" src="/portal/invoices"></iframe></body></html>`)
+	})
+	mux.HandleFunc("/portal/invoices", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><body><a class="invoice" href="files/2024-03.pdf">March</a></body></html>`)
+	})
+	files := func(w http.ResponseWriter, r *http.Request) {
+		if cookie, err := r.Cookie("session"); err != nil || cookie.Value != "valid" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "application/pdf")
+		fmt.Fprintf(w, "%%PDF-1.4 %s", filepath.Base(r.URL.Path))
+	}
+	mux.HandleFunc("/files/", files)
+	mux.HandleFunc("/portal/files/", files)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	if err := chromedp.Run(ctx, chromedp.Navigate(server.URL+"/invoices")); err != nil {
+		t.Fatalf("error opening fixture: %s", err)
+	}
+
+	b := &BrowserDriver{logger: slog.Default(), downloadsDirectory: t.TempDir(), supplier: "example"}
+	step := parser.Step{Action: "downloadHrefs", Selector: "a.invoice", SelectorType: parser.SelectorTypeQuery}
+	result := b.stepDownloadHrefs(ctx, step)
+	if result.Status != "success" {
+		t.Fatalf("stepDownloadHrefs() = %s (%s); want success", result.Status, result.Message)
+	}
+	if b.downloadedFilesCount.Load() != 2 {
+		t.Errorf("stepDownloadHrefs() downloaded %d files; want 2", b.downloadedFilesCount.Load())
+	}
+
+	for _, filename := range []string{"2024-05.pdf", "2024-04.pdf"} {
+		content, err := os.ReadFile(filepath.Join(b.downloadsDirectory, filename))
+		if err != nil {
+			t.Errorf("%s was not downloaded: %s", filename, err)
+			continue
+		}
+		if string(content) != "%PDF-1.4 "+filename {
+			t.Errorf("%s has the content %q; want the invoice", filename, content)
+		}
+	}
+
+	// Only the latest invoices are downloaded with `buchhalter_max_download_files_per_receipt`, negative values download all
+	for maxFiles, expected := range map[int]int32{1: 1, 0: 2, -1: 2} {
+		b := &BrowserDriver{logger: slog.Default(), downloadsDirectory: t.TempDir(), supplier: "example", maxFilesDownloaded: maxFiles}
+		if result := b.stepDownloadHrefs(ctx, step); result.Status != "success" {
+			t.Errorf("stepDownloadHrefs() with max files %d = %s (%s); want success", maxFiles, result.Status, result.Message)
+		}
+		if b.downloadedFilesCount.Load() != expected {
+			t.Errorf("stepDownloadHrefs() with max files %d downloaded %d files; want %d", maxFiles, b.downloadedFilesCount.Load(), expected)
+		}
+	}
+
+	// The links inside the iframe are downloaded with the `frame` option
+	if err := chromedp.Run(ctx, chromedp.Navigate(server.URL+"/framed")); err != nil {
+		t.Fatalf("error opening fixture: %s", err)
+	}
+	b = &BrowserDriver{logger: slog.Default(), downloadsDirectory: t.TempDir(), supplier: "example"}
+	frameStep := parser.Step{Action: "downloadHrefs", Selector: "a.invoice", SelectorType: parser.SelectorTypeQuery, Frame: "invoices"}
+	if result := b.stepDownloadHrefs(ctx, frameStep); result.Status != "success" {
+		t.Fatalf("stepDownloadHrefs() in frame = %s (%s); want success", result.Status, result.Message)
+	}
+	if content, err := os.ReadFile(filepath.Join(b.downloadsDirectory, "2024-03.pdf")); err != nil || string(content) != "%PDF-1.4 2024-03.pdf" {
+		t.Errorf("2024-03.pdf of the iframe was not downloaded: %q, %v", content, err)
+	}
+}
@@ -0,0 +1,426 @@
+package browser
+
+// Driver of `http` recipes: plain HTTP requests without a browser, for portals with a simple login form or HTTP Basic auth.
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"buchhalter/lib/archive"
+	"buchhalter/lib/parser"
+	"buchhalter/lib/utils"
+	"buchhalter/lib/vault"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// httpMaxLoginResponseSize is the maximum size of a login response checked for the `expect` text of a httpLogin step.
+const httpMaxLoginResponseSize = 5 << 20
+
+type HTTPDriver struct {
+	logger          *slog.Logger
+	credentials     *vault.Credentials
+	documentArchive *archive.DocumentArchive
+
+	buchhalterStagingDirectory string
+
+	downloadsDirectory string
+	supplier           string
+	// expectedMimeType is the type of the documents of the running recipe (see utils.ValidateFileType)
+	expectedMimeType string
+
+	recipeTimeout time.Duration
+	// supplierTimeout is the total time the recipe may take (`--timeout-per-supplier`), zero for no limit
+	supplierTimeout time.Duration
+	newFilesCount   int
+	newFiles        []string
+	// httpClient sends the requests of the recipe, its cookie jar keeps the session of the login for the following steps
+	httpClient *http.Client
+	// domainPolicy blocks the requests to domains the recipe may not contact, nil allows all requests
+	domainPolicy *DomainPolicy
+	// har records the traffic of the HTTP client (`--har`), nil for none
+	har *HARRecorder
+	// basicAuth sends the credentials with HTTP Basic auth (a httpLogin step without a body)
+	basicAuth bool
+	// now is the current time of the templated urls of httpGet steps
+	now func() time.Time
+}
+
+func NewHTTPDriver(logger *slog.Logger, credentials *vault.Credentials, buchhalterStagingDirectory string, documentArchive *archive.DocumentArchive, tlsOverrides *TLSOverrides, domainPolicy *DomainPolicy) (*HTTPDriver, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	// The client of the TLS overrides might be shared (e.g. http.DefaultClient), the cookie jar is only set on a copy
+	httpClient := *tlsOverrides.HTTPClient(nil)
+	httpClient.Jar = jar
+
+	return &HTTPDriver{
+		logger:          logger,
+		credentials:     credentials,
+		documentArchive: documentArchive,
+
+		buchhalterStagingDirectory: buchhalterStagingDirectory,
+
+		recipeTimeout: 120 * time.Second,
+		httpClient:    &httpClient,
+		domainPolicy:  domainPolicy,
+		now:           time.Now,
+	}, nil
+}
+
+// SetSupplierTimeout limits the total time of the recipe to timeout (`--timeout-per-supplier`), zero for no limit.
+func (b *HTTPDriver) SetSupplierTimeout(timeout time.Duration) {
+	b.supplierTimeout = timeout
+}
+
+// SetHARRecorder records the HTTP traffic of the recipe with recorder (`--har`).
+func (b *HTTPDriver) SetHARRecorder(recorder *HARRecorder) {
+	b.har = recorder
+	client := *b.httpClient
+	client.Transport = recorder.Transport(client.Transport)
+	b.httpClient = &client
+}
+
+func (b *HTTPDriver) RunRecipe(p *tea.Program, progress *utils.RecipeProgress, recipe *parser.Recipe) (utils.RecipeResult, error) {
+	b.logger.Info("Starting http driver ...", "recipe", recipe.Supplier, "recipe_version", recipe.Version)
+
+	defer progress.Finish()
+	ctx, cancelSupplierTimeout := supplierTimeoutContext(context.Background(), b.supplierTimeout)
+	defer cancelSupplierTimeout()
+
+	var result utils.RecipeResult
+	if b.har != nil {
+		b.har.StartPage(recipe.Supplier, time.Now())
+	}
+
+	// Create download directories
+	var err error
+	b.supplier = recipe.Supplier
+	b.expectedMimeType = recipe.ExpectedMimeType
+	b.downloadsDirectory, err = utils.InitSupplierDirectories(b.buchhalterStagingDirectory, recipe.Supplier)
+	if err != nil {
+		b.logger.Error("Error while creating download directory", "error", err.Error(), "staging_directory", b.buchhalterStagingDirectory, "supplier", recipe.Supplier)
+		return result, err
+	}
+	b.logger.Info("Download directories created", "downloads_directory", b.downloadsDirectory, "documents_layout", b.documentArchive.Layout())
+
+	n := 1
+	for _, step := range recipe.Steps {
+		if err := progress.WaitWhilePaused(ctx); err != nil {
+			if supplierTimeoutExceeded(ctx) {
+				return b.abortWithSupplierTimeout(recipe, n, step), nil
+			}
+			return result, err
+		}
+		p.Send(utils.ViewStatusUpdateMsg{
+			Message: fmt.Sprintf("Downloading invoices from `%s` (%d/%d):", recipe.Supplier, n, len(recipe.Steps)),
+			Details: step.Description,
+		})
+		utils.SetLastStep(fmt.Sprintf("%s %s, step %d/%d (%s)", recipe.Supplier, recipe.Version, n, len(recipe.Steps), step.Action))
+
+		stepCtx, cancelStep := context.WithTimeout(ctx, b.recipeTimeout)
+		var lastStepResult utils.StepResult
+		switch step.Action {
+		case "httpLogin":
+			lastStepResult = b.stepHTTPLogin(stepCtx, step)
+		case "httpGet":
+			lastStepResult = b.stepHTTPGet(stepCtx, step)
+		case "move":
+			lastStepResult = b.stepMove(step)
+		}
+		stepTimeoutExceeded := stepCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil
+		cancelStep()
+
+		if lastStepResult.Status != "success" && supplierTimeoutExceeded(ctx) {
+			return b.abortWithSupplierTimeout(recipe, n, step), nil
+		}
+		if stepTimeoutExceeded {
+			return utils.RecipeResult{
+				Status:              "error",
+				StatusText:          fmt.Sprintf("%s aborted with timeout.", recipe.Supplier),
+				StatusTextFormatted: fmt.Sprintf("x %s aborted with timeout.", textStyleBold(recipe.Supplier)),
+				LastStepId:          fmt.Sprintf("%s-%s-%d-%s", recipe.Supplier, recipe.Version, n, step.Action),
+				LastStepDescription: step.Description,
+				ErrorCode:           utils.ErrorCodeTimeout,
+				NewFilesCount:       b.newFilesCount,
+				NewFiles:            b.newFiles,
+			}, nil
+		}
+
+		newDocumentsText := fmt.Sprintf("%d new documents", b.newFilesCount)
+		if b.newFilesCount == 1 {
+			newDocumentsText = "One new document"
+		}
+		if b.newFilesCount == 0 {
+			newDocumentsText = "No new documents"
+		}
+		if lastStepResult.Status == "success" {
+			result = utils.RecipeResult{
+				Status:              "success",
+				StatusText:          fmt.Sprintf("%s: %s", recipe.Supplier, newDocumentsText),
+				StatusTextFormatted: fmt.Sprintf("- %s: %s", textStyleBold(recipe.Supplier), newDocumentsText),
+				LastStepId:          fmt.Sprintf("%s-%s-%d-%s", recipe.Supplier, recipe.Version, n, step.Action),
+				LastStepDescription: step.Description,
+				NewFilesCount:       b.newFilesCount,
+				NewFiles:            b.newFiles,
+			}
+		} else {
+			// The steps of http recipes depend on each other (e.g. the login), the recipe ends with the first error
+			return utils.RecipeResult{
+				Status:              "error",
+				StatusText:          fmt.Sprintf("%s aborted with error.", recipe.Supplier),
+				StatusTextFormatted: fmt.Sprintf("x %s aborted with error.", textStyleBold(recipe.Supplier)),
+				LastStepId:          fmt.Sprintf("%s-%s-%d-%s", recipe.Supplier, recipe.Version, n, step.Action),
+				LastStepDescription: step.Description,
+				LastErrorMessage:    lastStepResult.Message,
+				ErrorCode:           lastStepResult.ErrorCodeOrUnknown(),
+				NewFilesCount:       b.newFilesCount,
+				NewFiles:            b.newFiles,
+			}, nil
+		}
+
+		progress.StepCompleted()
+		n++
+	}
+
+	return result, nil
+}
+
+// abortWithSupplierTimeout ends the recipe after the supplier timeout in step n.
+func (b *HTTPDriver) abortWithSupplierTimeout(recipe *parser.Recipe, n int, step parser.Step) utils.RecipeResult {
+	b.logger.Warn("Supplier timeout exceeded, aborting the recipe", "supplier", recipe.Supplier, "timeout", b.supplierTimeout, "step", n, "action", step.Action, "new_files", b.newFilesCount)
+	return supplierTimeoutResult(recipe, n, step, b.supplierTimeout, b.newFilesCount, b.newFiles)
+}
+
+// stepHTTPLogin sends the login form of the step (`body`, e.g. `user={{ username }}&pass={{ password }}`) to its url.
+// Without a body, the url is requested with HTTP Basic auth and all following requests use it as well.
+// The login fails with an error status or if the response doesn't contain the text of `expect` (e.g. `Logout`).
+func (b *HTTPDriver) stepHTTPLogin(ctx context.Context, step parser.Step) utils.StepResult {
+	b.logger.Debug("Executing recipe step", "action", step.Action, "url", step.URL)
+
+	method := strings.ToUpper(step.Method)
+	body := ""
+	if len(strings.TrimSpace(step.Body)) == 0 {
+		b.basicAuth = true
+		if len(method) == 0 {
+			method = http.MethodGet
+		}
+	} else {
+		body = httpCredentialPlaceholders(step.Body, b.credentials, isJSONContentType(step.Headers))
+		if len(method) == 0 {
+			method = http.MethodPost
+		}
+	}
+
+	resp, err := b.doRequest(ctx, method, step.URL, step.Headers, body)
+	if err != nil {
+		return utils.StepResult{Status: "error", Message: err.Error(), ErrorCode: utils.ErrorCodeNetwork}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return utils.StepResult{Status: "error", Message: fmt.Sprintf("login was rejected with status %d", resp.StatusCode), ErrorCode: utils.ErrorCodeAuthFailed}
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return utils.StepResult{Status: "error", Message: fmt.Sprintf("login failed with status %d", resp.StatusCode), ErrorCode: utils.ErrorCodeNetwork}
+	}
+	if step.Expect != nil {
+		content, err := io.ReadAll(io.LimitReader(resp.Body, httpMaxLoginResponseSize))
+		if err != nil {
+			return utils.StepResult{Status: "error", Message: err.Error(), ErrorCode: utils.ErrorCodeNetwork}
+		}
+		if !strings.Contains(string(content), *step.Expect) {
+			return utils.StepResult{Status: "error", Message: fmt.Sprintf("response of the login doesn't contain `%s`", *step.Expect), ErrorCode: utils.ErrorCodeAuthFailed}
+		}
+	}
+
+	return utils.StepResult{Status: "success"}
+}
+
+// stepHTTPGet downloads the document of the url of the step into the downloads directory.
+// A url with `{{ year }}` or `{{ month }}` is requested for the current month and the months before (see httpGetUrls),
+// months without a document (status 404) are skipped.
+func (b *HTTPDriver) stepHTTPGet(ctx context.Context, step parser.Step) utils.StepResult {
+	b.logger.Debug("Executing recipe step", "action", step.Action, "url", step.URL)
+
+	method := strings.ToUpper(step.Method)
+	if len(method) == 0 {
+		method = http.MethodGet
+	}
+	body := httpCredentialPlaceholders(step.Body, b.credentials, isJSONContentType(step.Headers))
+	for _, documentUrl := range httpGetUrls(step.URL, step.Months, b.now()) {
+		requestUrl := httpCredentialPlaceholders(documentUrl, b.credentials, false)
+		filename, err := b.download(ctx, method, requestUrl, step.Headers, body)
+		if err != nil {
+			return utils.StepResult{Status: "error", Message: err.Error(), ErrorCode: utils.ErrorCodeDownloadFailed}
+		}
+		if len(filename) == 0 {
+			b.logger.Debug("Executing recipe step ... no document", "action", step.Action, "url", documentUrl)
+			continue
+		}
+		b.logger.Debug("Executing recipe step ... downloaded document", "action", step.Action, "url", documentUrl, "filename", filename)
+	}
+
+	return utils.StepResult{Status: "success"}
+}
+
+func (b *HTTPDriver) stepMove(step parser.Step) utils.StepResult {
+	b.logger.Debug("Executing recipe step", "action", step.Action, "value", step.Value)
+
+	var err error
+	b.newFiles, err = moveDownloads(b.logger, b.downloadsDirectory, step.Value, b.supplier, b.expectedMimeType, b.documentArchive)
+	b.newFilesCount = len(b.newFiles)
+	if err != nil {
+		return utils.StepResult{Status: "error", Message: err.Error(), ErrorCode: utils.ErrorCodeDownloadFailed}
+	}
+
+	return utils.StepResult{Status: "success"}
+}
+
+// download requests requestUrl and writes the document into the downloads directory.
+// The filename is taken from the Content-Disposition header or the path of the url (see uniqueDownloadFilename).
+// It returns an empty filename for a 404 response.
+func (b *HTTPDriver) download(ctx context.Context, method, requestUrl string, headers map[string]string, body string) (string, error) {
+	resp, err := b.doRequest(ctx, method, requestUrl, headers, body)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("request of %s failed with status %d", utils.Redact(requestUrl), resp.StatusCode)
+	}
+
+	filename := documentFilename("", resp.Header.Get("Content-Disposition"), httpFallbackFilename(resp.Request.URL, b.supplier))
+	filename = uniqueDownloadFilename(b.downloadsDirectory, filename, resp.Request.URL)
+	out, err := os.Create(filepath.Join(b.downloadsDirectory, filename))
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		return "", err
+	}
+	return filename, nil
+}
+
+// doRequest sends a request of the recipe, with the session cookies of the login and HTTP Basic auth (if configured).
+func (b *HTTPDriver) doRequest(ctx context.Context, method, requestUrl string, headers map[string]string, body string) (*http.Response, error) {
+	if !b.domainPolicy.Allows(requestUrl) {
+		return nil, fmt.Errorf("request of %s is blocked, the recipe may not contact its domain", utils.Redact(requestUrl))
+	}
+
+	var payload io.Reader
+	if len(body) > 0 {
+		payload = strings.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, requestUrl, payload)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > 0 {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	if b.basicAuth && b.credentials != nil {
+		req.SetBasicAuth(b.credentials.Username, b.credentials.Password)
+	}
+
+	return b.httpClient.Do(req)
+}
+
+// httpGetUrls returns the urls of a httpGet step: the url itself or, with `{{ year }}` or `{{ month }}` (two digits),
+// the url of the current month and of the months before (months urls in total, DefaultHTTPGetMonths without months).
+func httpGetUrls(urlTemplate string, months int, now time.Time) []string {
+	if !strings.Contains(urlTemplate, "{{ year }}") && !strings.Contains(urlTemplate, "{{ month }}") {
+		return []string{urlTemplate}
+	}
+	if months <= 0 {
+		months = parser.DefaultHTTPGetMonths
+	}
+
+	urls := make([]string, 0, months)
+	// The first day of the month is the anchor, so months with less days are not skipped
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	for i := 0; i < months; i++ {
+		replacer := strings.NewReplacer("{{ year }}", month.Format("2006"), "{{ month }}", month.Format("01"))
+		urls = append(urls, replacer.Replace(urlTemplate))
+		month = month.AddDate(0, -1, 0)
+	}
+	return urls
+}
+
+// httpCredentialPlaceholders replaces `{{ username }}` and `{{ password }}` in value, encoded for a form (or url) or a JSON string.
+func httpCredentialPlaceholders(value string, credentials *vault.Credentials, jsonEncoded bool) string {
+	if credentials == nil {
+		return value
+	}
+	encode := url.QueryEscape
+	if jsonEncoded {
+		encode = func(s string) string {
+			encoded := strings.Builder{}
+			encoder := json.NewEncoder(&encoded)
+			encoder.SetEscapeHTML(false)
+			_ = encoder.Encode(s)
+			return strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(encoded.String()), `"`), `"`)
+		}
+	}
+	return strings.NewReplacer("{{ username }}", encode(credentials.Username), "{{ password }}", encode(credentials.Password)).Replace(value)
+}
+
+// isJSONContentType reports whether the headers of a step send a JSON body (instead of a form).
+func isJSONContentType(headers map[string]string) bool {
+	for name, value := range headers {
+		if strings.EqualFold(name, "Content-Type") && strings.Contains(strings.ToLower(value), "json") {
+			return true
+		}
+	}
+	return false
+}
+
+// httpFallbackFilename is the filename of a document without a Content-Disposition header:
+// the last segment of the path of documentUrl, or `<supplier>-<hash of the url>.pdf` for a path without a file extension
+// (e.g. `/invoice?month=2024-05`).
+func httpFallbackFilename(documentUrl *url.URL, supplier string) string {
+	if filename := sanitizeFilename(path.Base(documentUrl.Path)); len(path.Ext(filename)) > 0 {
+		return filename
+	}
+	return fmt.Sprintf("%s-%s.pdf", supplier, urlHash(documentUrl))
+}
+
+// uniqueDownloadFilename returns filename, or `<filename>-<hash of the url>.<extension>` if another document of the step
+// was downloaded as filename already, e.g. portals serving the documents of all months of a templated url as `invoice.pdf`.
+func uniqueDownloadFilename(downloadsDirectory, filename string, documentUrl *url.URL) string {
+	if _, err := os.Stat(filepath.Join(downloadsDirectory, filename)); errors.Is(err, fs.ErrNotExist) {
+		return filename
+	}
+	extension := filepath.Ext(filename)
+	return fmt.Sprintf("%s-%s%s", strings.TrimSuffix(filename, extension), urlHash(documentUrl), extension)
+}
+
+// urlHash returns a short hash of documentUrl for the filenames of its document.
+func urlHash(documentUrl *url.URL) string {
+	hash := sha256.Sum256([]byte(documentUrl.String()))
+	return fmt.Sprintf("%x", hash[:6])
+}
@@ -0,0 +1,214 @@
+package browser
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"buchhalter/lib/archive"
+	"buchhalter/lib/parser"
+	"buchhalter/lib/vault"
+)
+
+// newTestHTTPDriver returns a driver downloading into a temporary directory.
+func newTestHTTPDriver(t *testing.T, credentials *vault.Credentials) *HTTPDriver {
+	t.Helper()
+
+	driver, err := NewHTTPDriver(slog.Default(), credentials, t.TempDir(), nil, nil, nil)
+	if err != nil {
+		t.Fatalf("NewHTTPDriver() returned error: %s", err)
+	}
+	driver.supplier = "example"
+	driver.downloadsDirectory = t.TempDir()
+	driver.now = func() time.Time { return time.Date(2024, time.March, 31, 12, 0, 0, 0, time.UTC) }
+	return driver
+}
+
+func TestHTTPDriverFormLogin(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.FormValue("user") != "jane@example.com" || r.FormValue("pass") != "s3cret&more" {
+			http.Error(w, "wrong credentials", http.StatusUnauthorized)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", Path: "/"})
+		http.Redirect(w, r, "/dashboard", http.StatusFound)
+	})
+	mux.HandleFunc("/dashboard", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "Welcome Jane, Logout")
+	})
+	mux.HandleFunc("/invoices/", func(w http.ResponseWriter, r *http.Request) {
+		if cookie, err := r.Cookie("session"); err != nil || cookie.Value != "abc" {
+			http.Error(w, "not logged in", http.StatusForbidden)
+			return
+		}
+		if r.URL.Path == "/invoices/2024-02.pdf" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="invoice-%s"`, filepath.Base(r.URL.Path)))
+		fmt.Fprint(w, "%PDF-1.4")
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	driver := newTestHTTPDriver(t, &vault.Credentials{Username: "jane@example.com", Password: "s3cret&more"})
+	expect := "Logout"
+	result := driver.stepHTTPLogin(context.Background(), parser.Step{Action: "httpLogin", URL: server.URL + "/login", Body: "user={{ username }}&pass={{ password }}", Expect: &expect})
+	if result.Status != "success" {
+		t.Fatalf("stepHTTPLogin() = %+v; want success", result)
+	}
+
+	result = driver.stepHTTPGet(context.Background(), parser.Step{Action: "httpGet", URL: server.URL + "/invoices/{{ year }}-{{ month }}.pdf"})
+	if result.Status != "success" {
+		t.Fatalf("stepHTTPGet() = %+v; want success", result)
+	}
+	// The month without a document (404) is skipped
+	for _, filename := range []string{"invoice-2024-03.pdf", "invoice-2024-01.pdf"} {
+		if _, err := os.Stat(filepath.Join(driver.downloadsDirectory, filename)); err != nil {
+			t.Errorf("stepHTTPGet() didn't download %s: %s", filename, err)
+		}
+	}
+
+	wrongLogin := newTestHTTPDriver(t, &vault.Credentials{Username: "jane@example.com", Password: "wrong"})
+	result = wrongLogin.stepHTTPLogin(context.Background(), parser.Step{Action: "httpLogin", URL: server.URL + "/login", Body: "user={{ username }}&pass={{ password }}"})
+	if result.Status != "error" || result.ErrorCode != "auth_failed" {
+		t.Errorf("stepHTTPLogin() with wrong credentials = %+v; want auth_failed", result)
+	}
+	missingText := "Sign out"
+	result = driver.stepHTTPLogin(context.Background(), parser.Step{Action: "httpLogin", URL: server.URL + "/login", Body: "user={{ username }}&pass={{ password }}", Expect: &missingText})
+	if result.Status != "error" {
+		t.Errorf("stepHTTPLogin() without the expected text = %+v; want an error", result)
+	}
+}
+
+func TestHTTPDriverBasicAuth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "jane" || password != "s3cret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="invoices"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, "%PDF-1.4")
+	}))
+	defer server.Close()
+
+	driver := newTestHTTPDriver(t, &vault.Credentials{Username: "jane", Password: "s3cret"})
+	if result := driver.stepHTTPLogin(context.Background(), parser.Step{Action: "httpLogin", URL: server.URL + "/"}); result.Status != "success" {
+		t.Fatalf("stepHTTPLogin() = %+v; want success", result)
+	}
+	if result := driver.stepHTTPGet(context.Background(), parser.Step{Action: "httpGet", URL: server.URL + "/documents/latest.pdf"}); result.Status != "success" {
+		t.Fatalf("stepHTTPGet() = %+v; want success", result)
+	}
+	if _, err := os.Stat(filepath.Join(driver.downloadsDirectory, "latest.pdf")); err != nil {
+		t.Errorf("stepHTTPGet() didn't download latest.pdf: %s", err)
+	}
+
+	// Without a login, the document is rejected
+	withoutLogin := newTestHTTPDriver(t, &vault.Credentials{Username: "jane", Password: "s3cret"})
+	if result := withoutLogin.stepHTTPGet(context.Background(), parser.Step{Action: "httpGet", URL: server.URL + "/documents/latest.pdf"}); result.Status != "error" {
+		t.Errorf("stepHTTPGet() without login = %+v; want an error", result)
+	}
+}
+
+func TestHTTPDriverSameFilenameOfMonths(t *testing.T) {
+	// The portal serves the documents of all months as `invoice.pdf`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Disposition", `attachment; filename="invoice.pdf"`)
+		fmt.Fprint(w, "%PDF-1.4\n"+r.URL.Path)
+	}))
+	defer server.Close()
+
+	driver := newTestHTTPDriver(t, nil)
+	driver.documentArchive = archive.NewDocumentArchive(slog.Default(), filepath.Join(t.TempDir(), "documents"), archive.LayoutSupplier)
+	if result := driver.stepHTTPGet(context.Background(), parser.Step{Action: "httpGet", URL: server.URL + "/invoices/{{ year }}/{{ month }}/invoice.pdf"}); result.Status != "success" {
+		t.Fatalf("stepHTTPGet() = %+v; want success", result)
+	}
+	if result := driver.stepMove(parser.Step{Action: "move", Value: `.*\.pdf`}); result.Status != "success" {
+		t.Fatalf("stepMove() = %+v; want success", result)
+	}
+
+	// Each month is archived, none overwrites another
+	contents := map[string]bool{}
+	for _, newFile := range driver.newFiles {
+		content, err := os.ReadFile(newFile)
+		if err != nil {
+			t.Fatalf("error reading %s: %s", newFile, err)
+		}
+		contents[string(content)] = true
+	}
+	for _, month := range []string{"2024/03", "2024/02", "2024/01"} {
+		if !contents["%PDF-1.4\n/invoices/"+month+"/invoice.pdf"] {
+			t.Errorf("document of %s was not archived, archived %v", month, driver.newFiles)
+		}
+	}
+}
+
+func TestHTTPGetUrls(t *testing.T) {
+	now := time.Date(2024, time.March, 31, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		template string
+		months   int
+		expected []string
+	}{
+		{"no placeholder", "https://example.com/invoice.pdf", 5, []string{"https://example.com/invoice.pdf"}},
+		{"default months", "https://example.com/{{ year }}/{{ month }}.pdf", 0, []string{"https://example.com/2024/03.pdf", "https://example.com/2024/02.pdf", "https://example.com/2024/01.pdf"}},
+		{"over the turn of the year", "https://example.com/invoice?month={{ year }}-{{ month }}", 4, []string{
+			"https://example.com/invoice?month=2024-03",
+			"https://example.com/invoice?month=2024-02",
+			"https://example.com/invoice?month=2024-01",
+			"https://example.com/invoice?month=2023-12",
+		}},
+	}
+
+	for _, test := range tests {
+		if urls := httpGetUrls(test.template, test.months, now); !reflect.DeepEqual(urls, test.expected) {
+			t.Errorf("%s: httpGetUrls() = %v; want %v", test.name, urls, test.expected)
+		}
+	}
+}
+
+func TestHTTPCredentialPlaceholders(t *testing.T) {
+	credentials := &vault.Credentials{Username: "jane@example.com", Password: `pa"ss&word`}
+	tests := []struct {
+		value       string
+		jsonEncoded bool
+		expected    string
+	}{
+		{"user={{ username }}&pass={{ password }}", false, "user=jane%40example.com&pass=pa%22ss%26word"},
+		{`{"user":"{{ username }}","pass":"{{ password }}"}`, true, `{"user":"jane@example.com","pass":"pa\"ss&word"}`},
+	}
+
+	for _, test := range tests {
+		if value := httpCredentialPlaceholders(test.value, credentials, test.jsonEncoded); value != test.expected {
+			t.Errorf("httpCredentialPlaceholders(%q) = %s; want %s", test.value, value, test.expected)
+		}
+	}
+}
+
+func TestHTTPFallbackFilename(t *testing.T) {
+	withExtension, _ := url.Parse("https://example.com/documents/invoice-42.pdf")
+	if filename := httpFallbackFilename(withExtension, "example"); filename != "invoice-42.pdf" {
+		t.Errorf("httpFallbackFilename(%s) = %s; want invoice-42.pdf", withExtension, filename)
+	}
+
+	// Urls without a file extension get a filename per url
+	january, _ := url.Parse("https://example.com/invoice?month=2024-01")
+	february, _ := url.Parse("https://example.com/invoice?month=2024-02")
+	if httpFallbackFilename(january, "example") == httpFallbackFilename(february, "example") {
+		t.Errorf("httpFallbackFilename() returned the same filename for %s and %s", january, february)
+	}
+	if filepath.Ext(httpFallbackFilename(january, "example")) != ".pdf" {
+		t.Errorf("httpFallbackFilename(%s) = %s; want a .pdf filename", january, httpFallbackFilename(january, "example"))
+	}
+}
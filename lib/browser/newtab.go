@@ -0,0 +1,69 @@
+package browser
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/cdproto/target"
+	"github.com/chromedp/chromedp"
+)
+
+// newTabTimeout is the time a `downloadAll` step with `viaNewTab` waits for a download or a new tab after a click.
+const newTabTimeout = 10 * time.Second
+
+// newTab is a tab a click opened (e.g. with the PDF of an invoice).
+type newTab struct {
+	id  target.ID
+	url string
+}
+
+// isNewTabOf returns true if info is a page opened by the tab opener, that already navigated to its URL.
+func isNewTabOf(info *target.Info, opener target.ID) bool {
+	if info == nil || info.Type != "page" || len(opener) == 0 || info.OpenerID != opener {
+		return false
+	}
+	return len(info.URL) > 0 && info.URL != "about:blank"
+}
+
+// downloadNewTab downloads the document of a new tab into the downloads directory and closes the tab.
+// Like `downloadHrefs`, the document is fetched inside the tab, so the session of the portal is used (and the request is same-origin).
+// It returns the path of the downloaded file.
+func (b *BrowserDriver) downloadNewTab(ctx context.Context, tab newTab, number int) (string, error) {
+	tabCtx, cancel := chromedp.NewContext(ctx, chromedp.WithTargetID(tab.id))
+	// Canceling the context closes the tab, the next click opens another one
+	defer cancel()
+
+	urlJson, err := json.Marshal(tab.url)
+	if err != nil {
+		return "", err
+	}
+	var download hrefDownload
+	if err := chromedp.Run(tabCtx, chromedp.Evaluate(fmt.Sprintf(fetchHrefScript, urlJson), &download, func(p *runtime.EvaluateParams) *runtime.EvaluateParams {
+		return p.WithAwaitPromise(true)
+	})); err != nil {
+		return "", fmt.Errorf("error downloading document of new tab %s: %w", tab.url, err)
+	}
+	if download.Status < 200 || download.Status > 299 {
+		return "", fmt.Errorf("error downloading document of new tab %s: status code %d", tab.url, download.Status)
+	}
+
+	content, err := base64.StdEncoding.DecodeString(download.Data)
+	if err != nil {
+		return "", fmt.Errorf("error decoding document of new tab %s: %w", tab.url, err)
+	}
+	filename := filepath.Join(b.downloadsDirectory, hrefFilename(download.ContentDisposition, tab.url, b.supplier, number))
+	if _, err := os.Stat(filename); err == nil {
+		filename = filepath.Join(b.downloadsDirectory, fmt.Sprintf("%d-%s", number, filepath.Base(filename)))
+	}
+	if err := os.WriteFile(filename, content, 0600); err != nil {
+		return "", fmt.Errorf("error writing document of new tab %s: %w", filename, err)
+	}
+
+	return filename, nil
+}
@@ -0,0 +1,82 @@
+package browser
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"buchhalter/lib/parser"
+
+	"github.com/chromedp/cdproto/target"
+	"github.com/chromedp/chromedp"
+)
+
+func TestIsNewTabOf(t *testing.T) {
+	opener := target.ID("opener")
+	tests := []struct {
+		name     string
+		info     *target.Info
+		expected bool
+	}{
+		{"new tab with URL", &target.Info{Type: "page", OpenerID: opener, URL: "https://example.com/invoice.pdf"}, true},
+		{"new tab before navigation", &target.Info{Type: "page", OpenerID: opener, URL: "about:blank"}, false},
+		{"new tab without URL", &target.Info{Type: "page", OpenerID: opener}, false},
+		{"tab of another opener", &target.Info{Type: "page", OpenerID: "other", URL: "https://example.com/invoice.pdf"}, false},
+		{"tab without opener", &target.Info{Type: "page", URL: "https://example.com/invoice.pdf"}, false},
+		{"service worker", &target.Info{Type: "service_worker", OpenerID: opener, URL: "https://example.com/sw.js"}, false},
+		{"no info", nil, false},
+	}
+
+	for _, test := range tests {
+		if actual := isNewTabOf(test.info, opener); actual != test.expected {
+			t.Errorf("%s: isNewTabOf() = %t; want %t", test.name, actual, test.expected)
+		}
+	}
+	if isNewTabOf(&target.Info{Type: "page", URL: "https://example.com/invoice.pdf"}, "") {
+		t.Errorf("isNewTabOf() without an opener = true; want false")
+	}
+}
+
+func TestStepDownloadAllViaNewTab(t *testing.T) {
+	ctx := newFixtureBrowserContext(t)
+
+	server := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer server.Close()
+
+	if err := chromedp.Run(ctx, chromedp.Navigate(server.URL+"/new-tab.html")); err != nil {
+		t.Fatalf("error opening fixture: %s", err)
+	}
+
+	b := &BrowserDriver{logger: slog.Default(), downloadsDirectory: t.TempDir(), supplier: "example"}
+	step := parser.Step{Action: "downloadAll", Selector: "a.invoice", SelectorType: parser.SelectorTypeQuery, SleepDuration: 1, ViaNewTab: true}
+	result := b.stepDownloadAll(ctx, step)
+	if result.Status != "success" {
+		t.Fatalf("stepDownloadAll() = %s (%s); want success", result.Status, result.Message)
+	}
+	if b.downloadedFilesCount.Load() != 1 {
+		t.Errorf("stepDownloadAll() downloaded %d files; want 1", b.downloadedFilesCount.Load())
+	}
+
+	content, err := os.ReadFile(filepath.Join(b.downloadsDirectory, "new-tab-invoice.html"))
+	if err != nil {
+		t.Fatalf("document of the new tab was not written: %s", err)
+	}
+	if !bytes.Contains(content, []byte("Invoice 2024-0042")) {
+		t.Errorf("downloaded file is not the document of the new tab")
+	}
+
+	// The new tab was closed after the download
+	targets, err := chromedp.Targets(ctx)
+	if err != nil {
+		t.Fatalf("error listing targets: %s", err)
+	}
+	for _, info := range targets {
+		if info.Type == "page" && info.URL == server.URL+"/new-tab-invoice.html" {
+			t.Errorf("new tab %s is still open", info.URL)
+		}
+	}
+}
@@ -5,6 +5,7 @@ package browser
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -14,6 +15,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -30,27 +32,51 @@ import (
 	"github.com/chromedp/chromedp"
 )
 
+const (
+	// defaultMaxItemPages is the safety cap for paginated item requests if a recipe doesn't define `maxPages`.
+	defaultMaxItemPages = 50
+	// defaultItemsSince is the period `{{ since }}` covers, if the archive contains no document of the supplier yet.
+	defaultItemsSince = 365 * 24 * time.Hour
+)
+
 type HiddenInputFields struct {
 	Fields map[string]string
 }
 
+// itemDocument is a single document returned by an items request.
+type itemDocument struct {
+	id       string
+	filename string
+}
+
 type ClientAuthBrowserDriver struct {
 	logger          *slog.Logger
 	credentials     *vault.Credentials
 	documentArchive *archive.DocumentArchive
 
-	buchhalterConfigDirectory    string
-	buchhalterDocumentsDirectory string
+	buchhalterConfigDirectory  string
+	buchhalterStagingDirectory string
 
 	ChromeVersion string
 
 	downloadsDirectory string
-	documentsDirectory string
+	supplier           string
+	// expectedMimeType is the type of the documents of the running recipe (see utils.ValidateFileType)
+	expectedMimeType string
 
 	browserCtx    context.Context
 	browserCancel context.CancelFunc
 	recipeTimeout time.Duration
-	newFilesCount int
+	// supplierTimeout is the total time the recipe may take (`--timeout-per-supplier`), zero for no limit
+	supplierTimeout time.Duration
+	newFilesCount   int
+	newFiles        []string
+	// httpClient sends the requests to the supplier API (with the client certificate of the supplier, if configured)
+	httpClient *http.Client
+	// har records the traffic of the HTTP client and the browser (`--har`), nil for none
+	har *HARRecorder
+	// lastRun is the start of the last successful sync of the supplier (`--since-last-run`), zero for the newest document in the archive
+	lastRun time.Time
 
 	oauth2AuthToken          string
 	oauth2AuthUrl            string
@@ -60,21 +86,28 @@ type ClientAuthBrowserDriver struct {
 	oauth2Scope              string
 	oauth2PkceMethod         string
 	oauth2PkceVerifierLength int
+	// oauth2Flow is the OAuth2 flow of the oauth2-authenticate step (see parser.Oauth2Flows), empty for the authorization code flow
+	oauth2Flow          string
+	oauth2DeviceAuthUrl string
+
+	// totpPrompt asks the user for the 2FA code of the login form, if the vault has no TOTP for the credentials (nil in quiet mode)
+	totpPrompt *utils.TotpPrompt
 }
 
-func NewClientAuthBrowserDriver(logger *slog.Logger, credentials *vault.Credentials, buchhalterConfigDirectory, buchhalterDocumentsDirectory string, documentArchive *archive.DocumentArchive) (*ClientAuthBrowserDriver, error) {
+func NewClientAuthBrowserDriver(logger *slog.Logger, credentials *vault.Credentials, buchhalterConfigDirectory, buchhalterStagingDirectory string, documentArchive *archive.DocumentArchive, tlsOverrides *TLSOverrides, clientCertificate *tls.Certificate, chromePath string, headless bool) (*ClientAuthBrowserDriver, error) {
 	driver := &ClientAuthBrowserDriver{
 		logger:          logger,
 		credentials:     credentials,
 		documentArchive: documentArchive,
 
-		buchhalterConfigDirectory:    buchhalterConfigDirectory,
-		buchhalterDocumentsDirectory: buchhalterDocumentsDirectory,
+		buchhalterConfigDirectory:  buchhalterConfigDirectory,
+		buchhalterStagingDirectory: buchhalterStagingDirectory,
 
 		browserCtx:    nil,
 		browserCancel: nil,
 		recipeTimeout: 120 * time.Second,
 		newFilesCount: 0,
+		httpClient:    tlsOverrides.HTTPClient(clientCertificate),
 	}
 
 	// Setting chrome flags
@@ -82,8 +115,10 @@ func NewClientAuthBrowserDriver(logger *slog.Logger, credentials *vault.Credenti
 	opts := append(chromedp.DefaultExecAllocatorOptions[:],
 		chromedp.Flag("disable-search-engine-choice-screen", true),
 		chromedp.Flag("enable-automation", false),
-		chromedp.Flag("headless", false),
 	)
+	opts = append(opts, headlessFlags(headless)...)
+	opts = append(opts, tlsOverrides.ChromeFlags(logger)...)
+	opts = append(opts, chromeExecPathFlags(chromePath)...)
 
 	var err error
 	driver.browserCtx, driver.browserCancel, err = cu.New(cu.NewConfig(
@@ -99,15 +134,41 @@ func NewClientAuthBrowserDriver(logger *slog.Logger, credentials *vault.Credenti
 	return driver, nil
 }
 
+// SetSupplierTimeout limits the total time of the recipe to timeout (`--timeout-per-supplier`), zero for no limit.
+func (b *ClientAuthBrowserDriver) SetSupplierTimeout(timeout time.Duration) {
+	b.supplierTimeout = timeout
+}
+
+// SetTotpPrompt sets the prompt for the 2FA code of the login form, if the vault has no TOTP for the credentials.
+func (b *ClientAuthBrowserDriver) SetTotpPrompt(prompt *utils.TotpPrompt) {
+	b.totpPrompt = prompt
+}
+
+// SetLastRun sets `{{ since }}` of item requests to the start of the last successful sync of the supplier (`--since-last-run`).
+func (b *ClientAuthBrowserDriver) SetLastRun(lastRun time.Time) {
+	b.lastRun = lastRun
+}
+
+// SetHARRecorder records the HTTP traffic of the recipe with recorder (`--har`).
+// The requests of the HTTP client are recorded with their bodies, the requests of the browser (OAuth2 login) without.
+func (b *ClientAuthBrowserDriver) SetHARRecorder(recorder *HARRecorder) {
+	b.har = recorder
+	client := *b.httpClient
+	client.Transport = recorder.Transport(client.Transport)
+	b.httpClient = &client
+}
+
 func (b *ClientAuthBrowserDriver) GetContext() context.Context {
 	return b.browserCtx
 }
 
-func (b *ClientAuthBrowserDriver) RunRecipe(p *tea.Program, totalStepCount int, stepCountInCurrentRecipe int, baseCountStep int, recipe *parser.Recipe) (utils.RecipeResult, error) {
+func (b *ClientAuthBrowserDriver) RunRecipe(p *tea.Program, progress *utils.RecipeProgress, recipe *parser.Recipe) (utils.RecipeResult, error) {
 	b.logger.Info("Starting client auth chrome browser driver ...", "recipe", recipe.Supplier, "recipe_version", recipe.Version)
 
-	ctx := b.browserCtx
 	defer b.browserCancel()
+	defer progress.Finish()
+	ctx, cancelSupplierTimeout := supplierTimeoutContext(b.browserCtx, b.supplierTimeout)
+	defer cancelSupplierTimeout()
 
 	// Get chrome version for metrics
 	b.ChromeVersion = strings.TrimSpace(b.ChromeVersion)
@@ -129,25 +190,45 @@ func (b *ClientAuthBrowserDriver) RunRecipe(p *tea.Program, totalStepCount int,
 	b.logger.Info("Starting client auth chrome browser driver ... completed ", "recipe", recipe.Supplier, "recipe_version", recipe.Version, "chrome_version", b.ChromeVersion)
 
 	var result utils.RecipeResult
+	if b.har != nil {
+		b.har.StartPage(recipe.Supplier, time.Now())
+	}
 
 	// Create download directories
 	var err error
-	b.downloadsDirectory, b.documentsDirectory, err = utils.InitSupplierDirectories(b.buchhalterDocumentsDirectory, recipe.Supplier)
+	b.supplier = recipe.Supplier
+	b.expectedMimeType = recipe.ExpectedMimeType
+	b.downloadsDirectory, err = utils.InitSupplierDirectories(b.buchhalterStagingDirectory, recipe.Supplier)
 	if err != nil {
-		b.logger.Error("Error while creating download directory", "error", err.Error(), "documents_directory", b.buchhalterDocumentsDirectory, "supplier", recipe.Supplier)
+		b.logger.Error("Error while creating download directory", "error", err.Error(), "staging_directory", b.buchhalterStagingDirectory, "supplier", recipe.Supplier)
 		return result, err
 	}
-	b.logger.Info("Download directories created", "downloads_directory", b.downloadsDirectory, "documents_directory", b.documentsDirectory)
+	b.logger.Info("Download directories created", "downloads_directory", b.downloadsDirectory, "documents_layout", b.documentArchive.Layout())
 
-	var cs float64
 	n := 1
 	for _, step := range recipe.Steps {
+		// The browser keeps running while the sync is paused (`p`), the step timeout starts after the pause
+		if err := progress.WaitWhilePaused(ctx); err != nil {
+			if supplierTimeoutExceeded(ctx) {
+				return b.abortWithSupplierTimeout(recipe, n, step), nil
+			}
+			return result, err
+		}
 		p.Send(utils.ViewStatusUpdateMsg{
-			Message: fmt.Sprintf("Downloading invoices from `%s` (%d/%d):", recipe.Supplier, n, stepCountInCurrentRecipe),
+			Message: fmt.Sprintf("Downloading invoices from `%s` (%d/%d):", recipe.Supplier, n, len(recipe.Steps)),
 			Details: step.Description,
 		})
+		utils.SetLastStep(fmt.Sprintf("%s %s, step %d/%d (%s)", recipe.Supplier, recipe.Version, n, len(recipe.Steps), step.Action))
 
 		stepResultChan := make(chan utils.StepResult, 1)
+		// The user confirms the code of the device flow on another device, which takes longer than a step
+		stepTimeout := b.recipeTimeout
+		if step.Action == "oauth2-authenticate" && b.oauth2Flow == parser.Oauth2FlowDevice {
+			stepTimeout = oauth2DeviceFlowTimeout
+		} else if step.Action == "oauth2-authenticate" {
+			// The user may have to enter the 2FA code of the login form
+			stepTimeout += b.totpPrompt.Timeout()
+		}
 		// Timeout recipe if something goes wrong
 		go func() {
 			switch step.Action {
@@ -156,14 +237,22 @@ func (b *ClientAuthBrowserDriver) RunRecipe(p *tea.Program, totalStepCount int,
 			case "oauth2-check-tokens":
 				stepResultChan <- b.stepOauth2CheckTokens(ctx, recipe, step, b.credentials, b.buchhalterConfigDirectory)
 			case "oauth2-authenticate":
+				if b.oauth2Flow == parser.Oauth2FlowDevice {
+					stepResultChan <- b.stepOauth2DeviceAuthenticate(ctx, p, recipe, step, b.credentials, b.buchhalterConfigDirectory)
+					return
+				}
 				stepResultChan <- b.stepOauth2Authenticate(ctx, recipe, step, b.credentials, b.buchhalterConfigDirectory)
-			case "oauth2-post-and-get-items":
-				stepResultChan <- b.stepOauth2PostAndGetItems(ctx, step, b.documentArchive)
+			case "oauth2-request-items", "oauth2-post-and-get-items":
+				stepResultChan <- b.stepOauth2RequestItems(ctx, step, b.documentArchive)
 			}
 		}()
 
 		select {
 		case lastStepResult := <-stepResultChan:
+			// A step failing because the supplier timeout canceled its requests is a timeout, not an error of the step
+			if lastStepResult.Status != "success" && supplierTimeoutExceeded(ctx) {
+				return b.abortWithSupplierTimeout(recipe, n, step), nil
+			}
 			newDocumentsText := fmt.Sprintf("%d new documents", b.newFilesCount)
 			if b.newFilesCount == 1 {
 				newDocumentsText = "One new document"
@@ -179,6 +268,7 @@ func (b *ClientAuthBrowserDriver) RunRecipe(p *tea.Program, totalStepCount int,
 					LastStepId:          fmt.Sprintf("%s-%s-%d-%s", recipe.Supplier, recipe.Version, n, step.Action),
 					LastStepDescription: step.Description,
 					NewFilesCount:       b.newFilesCount,
+					NewFiles:            b.newFiles,
 				}
 			} else {
 				result = utils.RecipeResult{
@@ -188,14 +278,22 @@ func (b *ClientAuthBrowserDriver) RunRecipe(p *tea.Program, totalStepCount int,
 					LastStepId:          fmt.Sprintf("%s-%s-%d-%s", recipe.Supplier, recipe.Version, n, step.Action),
 					LastStepDescription: step.Description,
 					LastErrorMessage:    lastStepResult.Message,
+					ErrorCode:           lastStepResult.ErrorCodeOrUnknown(),
 					NewFilesCount:       b.newFilesCount,
+					NewFiles:            b.newFiles,
 				}
 				if lastStepResult.Break {
 					return result, nil
 				}
 			}
 
-		case <-time.After(b.recipeTimeout):
+		case <-ctx.Done():
+			if !supplierTimeoutExceeded(ctx) {
+				return result, ctx.Err()
+			}
+			return b.abortWithSupplierTimeout(recipe, n, step), nil
+
+		case <-time.After(stepTimeout):
 			result = utils.RecipeResult{
 				Status:              "error",
 				StatusText:          fmt.Sprintf("%s aborted with timeout.", recipe.Supplier),
@@ -203,19 +301,27 @@ func (b *ClientAuthBrowserDriver) RunRecipe(p *tea.Program, totalStepCount int,
 				LastStepId:          fmt.Sprintf("%s-%s-%d-%s", recipe.Supplier, recipe.Version, n, step.Action),
 				LastStepDescription: step.Description,
 				// LastErrorMessage is not set here, because we don't have an error message
+				ErrorCode:     utils.ErrorCodeTimeout,
 				NewFilesCount: b.newFilesCount,
+				NewFiles:      b.newFiles,
 			}
 			return result, nil
 		}
 
-		cs = (float64(baseCountStep) + float64(n)) / float64(totalStepCount)
-		p.Send(utils.ViewProgressUpdateMsg{Percent: cs})
+		progress.StepCompleted()
 		n++
 	}
 
 	return result, nil
 }
 
+// abortWithSupplierTimeout ends the recipe after the supplier timeout in step n.
+// The documents of the items requests are moved to the local storage while downloading, so they are kept.
+func (b *ClientAuthBrowserDriver) abortWithSupplierTimeout(recipe *parser.Recipe, n int, step parser.Step) utils.RecipeResult {
+	b.logger.Warn("Supplier timeout exceeded, aborting the recipe", "supplier", recipe.Supplier, "timeout", b.supplierTimeout, "step", n, "action", step.Action, "new_files", b.newFilesCount)
+	return supplierTimeoutResult(recipe, n, step, b.supplierTimeout, b.newFilesCount, b.newFiles)
+}
+
 func (b *ClientAuthBrowserDriver) stepOauth2Setup(step parser.Step) utils.StepResult {
 	b.logger.Debug("Executing recipe step", "action", step.Action, "auth_url", step.Oauth2.AuthUrl)
 
@@ -226,6 +332,8 @@ func (b *ClientAuthBrowserDriver) stepOauth2Setup(step parser.Step) utils.StepRe
 	b.oauth2Scope = step.Oauth2.Scope
 	b.oauth2PkceMethod = step.Oauth2.PkceMethod
 	b.oauth2PkceVerifierLength = step.Oauth2.PkceVerifierLength
+	b.oauth2Flow = step.Oauth2.Flow
+	b.oauth2DeviceAuthUrl = step.Oauth2.DeviceAuthUrl
 
 	return utils.StepResult{Status: "success", Message: "Successfully set up OAuth2 settings."}
 }
@@ -241,6 +349,7 @@ func (b *ClientAuthBrowserDriver) stepOauth2CheckTokens(ctx context.Context, rec
 		if b.validOauth2AuthToken(tokens) {
 			b.logger.Info("Found valid oauth2 access token in cache")
 			b.oauth2AuthToken = tokens.AccessToken
+			utils.RegisterSecret(tokens.AccessToken)
 			return utils.StepResult{Status: "success", Message: "Found valid oauth2 access token in cache"}
 		} else {
 			b.logger.Info("No valid oauth2 access token found in cache. Trying to get one with refresh token")
@@ -253,13 +362,14 @@ func (b *ClientAuthBrowserDriver) stepOauth2CheckTokens(ctx context.Context, rec
 			nt, err := b.getOauth2Tokens(ctx, payload, pii, buchhalterConfigDirectory)
 			if err == nil {
 				b.oauth2AuthToken = nt.AccessToken
+				utils.RegisterSecret(nt.AccessToken)
 				b.logger.Error("Error getting oauth2 access token with refresh token")
-				return utils.StepResult{Status: "error", Message: "Error getting oauth2 access token with refresh token", Break: true}
+				return utils.StepResult{Status: "error", Message: "Error getting oauth2 access token with refresh token", ErrorCode: utils.ErrorCodeAuthFailed, Break: true}
 			}
 		}
 	}
 
-	return utils.StepResult{Status: "error", Message: "No access token found. New OAuth2 login needed."}
+	return utils.StepResult{Status: "error", Message: "No access token found. New OAuth2 login needed.", ErrorCode: utils.ErrorCodeAuthFailed}
 }
 
 func (b *ClientAuthBrowserDriver) stepOauth2Authenticate(ctx context.Context, recipe *parser.Recipe, step parser.Step, credentials *vault.Credentials, buchhalterConfigDirectory string) utils.StepResult {
@@ -270,13 +380,43 @@ func (b *ClientAuthBrowserDriver) stepOauth2Authenticate(ctx context.Context, re
 		return utils.StepResult{Status: "success"}
 	}
 
-	verifier, challenge, err := utils.Oauth2Pkce(b.oauth2PkceVerifierLength)
+	// Resume the flow of an interrupted run: complete the token exchange if the redirect already happened
+	pii := recipe.Supplier + "|" + credentials.Id
+	flow, resumed, err := secrets.GetOauth2Flow(pii, buchhalterConfigDirectory, time.Now())
 	if err != nil {
-		b.logger.Error("Error while creating the OAuth2 Pkce", "error", err.Error())
-		return utils.StepResult{Status: "error", Message: fmt.Sprintf("error while creating the OAuth2 Pkce: %s", err.Error())}
+		b.logger.Warn("Error reading in-flight OAuth2 flow, starting a new login", "error", err)
+		resumed = false
+	}
+	if resumed && len(flow.Code) > 0 {
+		b.logger.Info("Resuming OAuth2 flow of an interrupted run", "started_at", flow.CreatedAt)
+		tokens, err := b.exchangeOauth2Code(ctx, flow.Verifier, flow.Code, pii, buchhalterConfigDirectory)
+		if err == nil {
+			b.logger.Info("Successfully retrieved new OAuth2 access tokens of a resumed flow.")
+			b.oauth2AuthToken = tokens.AccessToken
+			utils.RegisterSecret(tokens.AccessToken)
+			return utils.StepResult{Status: "success", Message: "Successfully retrieved OAuth2 tokens."}
+		}
+		// Authorization codes can only be used once
+		b.logger.Warn("Error completing resumed OAuth2 flow, starting a new login", "error", err)
+		resumed = false
+	}
+
+	verifier, state := flow.Verifier, flow.State
+	challenge := utils.Oauth2PkceChallenge(verifier)
+	if !resumed {
+		verifier, challenge, err = utils.Oauth2Pkce(b.oauth2PkceVerifierLength)
+		if err != nil {
+			b.logger.Error("Error while creating the OAuth2 Pkce", "error", err.Error())
+			return utils.StepResult{Status: "error", Message: fmt.Sprintf("error while creating the OAuth2 Pkce: %s", err.Error())}
+		}
+		state = utils.RandomString(20)
+		flow = secrets.Oauth2Flow{Verifier: verifier, State: state}
+		if err := secrets.SaveOauth2Flow(pii, flow, buchhalterConfigDirectory); err != nil {
+			b.logger.Warn("Error saving in-flight OAuth2 flow, the login can't be resumed", "error", err)
+		}
 	}
+	utils.RegisterSecret(verifier)
 
-	state := utils.RandomString(20)
 	params := url.Values{}
 	params.Add("client_id", b.oauth2ClientId)
 	params.Add("prompt", "login")
@@ -307,7 +447,7 @@ func (b *ClientAuthBrowserDriver) stepOauth2Authenticate(ctx context.Context, re
 
 	if err != nil {
 		b.logger.Error("Error while logging in", "error", err.Error())
-		return utils.StepResult{Status: "error", Message: "error while logging in: " + err.Error()}
+		return utils.StepResult{Status: "error", Message: "error while logging in: " + err.Error(), ErrorCode: utils.ErrorCodeAuthFailed}
 	}
 
 	// Check for 2FA authentication
@@ -318,18 +458,28 @@ func (b *ClientAuthBrowserDriver) stepOauth2Authenticate(ctx context.Context, re
 	)
 	if err != nil {
 		b.logger.Error("Error while logging in", "error", err.Error())
-		return utils.StepResult{Status: "error", Message: "error while logging in: " + err.Error()}
+		return utils.StepResult{Status: "error", Message: "error while logging in: " + err.Error(), ErrorCode: utils.ErrorCodeAuthFailed}
 	}
 
-	// Insert 2FA code
+	// Insert 2FA code, without a TOTP in the vault it is entered by the user
 	if len(faNodes) > 0 {
+		totp := credentials.Totp
+		if len(totp) == 0 {
+			b.logger.Info("No TOTP in the vault, asking for the 2FA code", "credential_id", credentials.Id, "supplier", recipe.Supplier, "timeout", b.totpPrompt.Timeout())
+			totp, err = b.totpPrompt.Ask(ctx, recipe.Supplier)
+			if err != nil {
+				b.logger.Error("No 2FA code entered", "credential_id", credentials.Id, "supplier", recipe.Supplier, "error", err.Error())
+				return utils.StepResult{Status: "error", Message: "error while logging in (2fa): " + err.Error(), ErrorCode: utils.ErrorCodeTwoFactorRequired}
+			}
+		}
+		utils.RegisterSecret(totp)
 		err = chromedp.Run(ctx,
-			chromedp.SendKeys("#form-input-passcode", credentials.Totp, chromedp.ByID),
+			chromedp.SendKeys("#form-input-passcode", totp, chromedp.ByID),
 			chromedp.Click("#form-submit", chromedp.ByID),
 		)
 		if err != nil {
 			b.logger.Error("Error while logging in (2FA)", "error", err.Error())
-			return utils.StepResult{Status: "error", Message: "error while logging in (2fa): " + err.Error()}
+			return utils.StepResult{Status: "error", Message: "error while logging in (2fa): " + err.Error(), ErrorCode: utils.ErrorCodeTwoFactorRequired}
 		}
 	}
 
@@ -341,129 +491,224 @@ func (b *ClientAuthBrowserDriver) stepOauth2Authenticate(ctx context.Context, re
 	)
 	if err != nil {
 		b.logger.Error("Error while requesting access token", "error", err.Error())
-		return utils.StepResult{Status: "error", Message: "error while logging in: " + err.Error()}
+		return utils.StepResult{Status: "error", Message: "error while logging in: " + err.Error(), ErrorCode: utils.ErrorCodeAuthFailed}
 	}
 
 	parsedURL, _ := url.Parse(u)
 	values := parsedURL.Query()
 	code := values.Get("code")
+	if returnedState := values.Get("state"); len(returnedState) > 0 && returnedState != state {
+		b.logger.Error("OAuth2 state of the redirect doesn't match")
+		return utils.StepResult{Status: "error", Message: "error while logging in: OAuth2 state of the redirect doesn't match", ErrorCode: utils.ErrorCodeAuthFailed}
+	}
 
-	payload := []byte(`{
-"grant_type": "authorization_code",
-"client_id": "` + b.oauth2ClientId + `",
-"code_verifier": "` + verifier + `",
-"code": "` + code + `",
-"redirect_uri": "` + b.oauth2RedirectUrl + `"
-}`)
+	// Store the code, an interrupted run can complete the token exchange
+	flow.Code = code
+	if err := secrets.SaveOauth2Flow(pii, flow, buchhalterConfigDirectory); err != nil {
+		b.logger.Warn("Error saving in-flight OAuth2 flow, the login can't be resumed", "error", err)
+	}
 
-	pii := recipe.Supplier + "|" + credentials.Id
-	tokens, err := b.getOauth2Tokens(ctx, payload, pii, buchhalterConfigDirectory)
+	tokens, err := b.exchangeOauth2Code(ctx, verifier, code, pii, buchhalterConfigDirectory)
 	if err != nil {
 		b.logger.Error("Error while getting fresh OAuth2 access token", "error", err.Error())
-		return utils.StepResult{Status: "error", Message: err.Error()}
+		return utils.StepResult{Status: "error", Message: err.Error(), ErrorCode: utils.ErrorCodeAuthFailed}
 	}
 	b.logger.Info("Successfully retrieved new OAuth2 access tokens.")
 	b.oauth2AuthToken = tokens.AccessToken
+	utils.RegisterSecret(tokens.AccessToken)
 	return utils.StepResult{Status: "success", Message: "Successfully retrieved OAuth2 tokens."}
 }
 
-func (b *ClientAuthBrowserDriver) stepOauth2PostAndGetItems(ctx context.Context, step parser.Step, documentArchive *archive.DocumentArchive) utils.StepResult {
-	b.logger.Debug("Executing recipe step", "action", step.Action, "url", step.URL)
-
-	payload := []byte(step.Body)
-	req, err := http.NewRequestWithContext(ctx, "POST", step.URL, bytes.NewBuffer(payload))
-	if err != nil {
-		return utils.StepResult{Status: "error", Message: "error creating post request", Break: true}
+// stepOauth2RequestItems requests the items (incl. pagination) and downloads the documents of the items.
+// The URLs, bodies and headers of the item requests are templates:
+// `{{ token }}` is replaced with the OAuth2 access token, `{{ since }}` with the date (YYYY-MM-DD) of the last run (`--since-last-run`)
+// or the newest document of the supplier in the archive and `{{ next }}` with the next page token.
+func (b *ClientAuthBrowserDriver) stepOauth2RequestItems(ctx context.Context, step parser.Step, documentArchive *archive.DocumentArchive) utils.StepResult {
+	since := itemsSince(documentArchive, b.supplier, b.lastRun, time.Now())
+	b.logger.Debug("Executing recipe step", "action", step.Action, "url", step.URL, "method", parser.ItemsRequestMethod(step), "since", since)
+
+	maxPages := step.MaxPages
+	if maxPages <= 0 {
+		maxPages = defaultMaxItemPages
 	}
-
-	// Set headers
-	req.Header.Set("Content-Type", "application/json")
-	for n, h := range step.Headers {
-		if n == "Authorization" {
-			h = strings.Replace(h, "{{ token }}", b.oauth2AuthToken, -1)
-		}
-		req.Header.Set(n, h)
+	nextPageUrl := step.NextPageUrl
+	if len(nextPageUrl) == 0 {
+		nextPageUrl = step.URL
 	}
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return utils.StepResult{Status: "error", Message: "error sending post request: " + err.Error(), Break: true}
+	nextPageBody := step.NextPageBody
+	if len(nextPageBody) == 0 {
+		nextPageBody = step.Body
 	}
 
-	// Read response body
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return utils.StepResult{Status: "error", Message: ""}
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode == 200 {
-		b.newFilesCount = 0
-		var jsr interface{}
-		err := json.Unmarshal(body, &jsr)
-		if err != nil {
-			return utils.StepResult{Status: "error", Message: fmt.Sprintf("Error while parsing JSON: %s", err), Break: true}
+	// Request all pages and collect the documents of each page
+	var documents []itemDocument
+	requestUrl := step.URL
+	payload := []byte(step.Body)
+	seenPageTokens := map[string]bool{}
+	for page := 1; ; page++ {
+		jsr, stepResult := b.requestItemsPage(ctx, step, requestUrl, payload, since)
+		if stepResult != nil {
+			return *stepResult
 		}
 
 		ids := extractJsonValue(jsr, step.ExtractDocumentIds)
-		if len(ids) == 0 {
-			return utils.StepResult{Status: "error", Message: "No content ids found", Break: true}
-		}
-
 		var filenames []string
 		if step.ExtractDocumentFilenames != "" {
 			filenames = extractJsonValue(jsr, step.ExtractDocumentFilenames)
 		}
+		for n, id := range ids {
+			document := itemDocument{id: id}
+			if n < len(filenames) {
+				document.filename = filenames[n]
+			}
+			documents = append(documents, document)
+		}
+		b.logger.Debug("Executing recipe step ... received items page", "action", step.Action, "page", page, "num_ids", len(ids))
 
-		// Get document
-		n := 0
-		var f string
-		var filename string
-		for _, id := range ids {
-			url := step.DocumentUrl
-			url = strings.Replace(url, "{{ id }}", id, -1)
-			if len(filenames) > 0 {
-				f = filepath.Join(b.downloadsDirectory, filenames[n])
-				filename = filenames[n]
-			} else {
-				f = filepath.Join(b.downloadsDirectory, id, ".pdf")
-				filename = filepath.Join(id, ".pdf")
+		// Single request mode, no pagination configured
+		if len(step.NextPagePath) == 0 {
+			break
+		}
+
+		nextPageTokens := extractJsonValue(jsr, step.NextPagePath)
+		if len(nextPageTokens) == 0 || len(nextPageTokens[0]) == 0 {
+			break
+		}
+		nextPageToken := nextPageTokens[0]
+		if seenPageTokens[nextPageToken] {
+			b.logger.Warn("Stopping pagination, because the next page token was returned before", "action", step.Action, "page", page)
+			break
+		}
+		if page >= maxPages {
+			b.logger.Warn("Stopping pagination, because the maximum number of pages is reached", "action", step.Action, "max_pages", maxPages)
+			break
+		}
+		seenPageTokens[nextPageToken] = true
+
+		requestUrl = strings.Replace(nextPageUrl, "{{ next }}", nextPageToken, -1)
+		payload = []byte(strings.Replace(nextPageBody, "{{ next }}", nextPageToken, -1))
+	}
+
+	if len(documents) == 0 {
+		return utils.StepResult{Status: "error", Message: "No content ids found", ErrorCode: utils.ErrorCodeDownloadFailed, Break: true}
+	}
 
+	// Get documents
+	b.newFilesCount = 0
+	b.newFiles = nil
+	for _, document := range documents {
+		url := step.DocumentUrl
+		url = strings.Replace(url, "{{ id }}", document.id, -1)
+		filename, downloadSuccessful, err := b.doRequest(ctx, url, step.DocumentRequestMethod, step.DocumentRequestHeaders, document.filename, document.id, nil)
+		if err != nil {
+			return utils.StepResult{Status: "error", Message: fmt.Sprintf("Error while downloading invoices: %s", err.Error()), ErrorCode: utils.ErrorCodeNetwork}
+		}
+		if !downloadSuccessful {
+			return utils.StepResult{Status: "error", Message: "Error while downloading invoices", ErrorCode: utils.ErrorCodeDownloadFailed}
+		}
+		f := filepath.Join(b.downloadsDirectory, filename)
+		// An API may answer with an error document (e.g. JSON or HTML) instead of the invoice
+		if err := utils.ValidateFileType(f, b.expectedMimeType); err != nil {
+			b.logger.Warn("Rejecting downloaded file, it is not a valid document", "action", step.Action, "document_id", document.id, "error", err)
+			if err := os.Remove(f); err != nil {
+				b.logger.Error("Error while removing rejected file", "file", f, "error", err)
 			}
-			downloadSuccessful, err := b.doRequest(ctx, url, step.DocumentRequestMethod, step.DocumentRequestHeaders, f, nil)
+			continue
+		}
+		if !documentArchive.DocumentExists(f, b.supplier) {
+			b.newFilesCount++
+			fileInfo, err := os.Stat(f)
 			if err != nil {
-				return utils.StepResult{Status: "error", Message: fmt.Sprintf("Error while downloading invoices: %s", err.Error())}
+				return utils.StepResult{Status: "error", Message: "Error while reading file info: " + err.Error(), ErrorCode: utils.ErrorCodeDownloadFailed}
 			}
-			if !downloadSuccessful {
-				return utils.StepResult{Status: "error", Message: "Error while downloading invoices"}
+			dstDirectory, err := documentArchive.DocumentDirectory(b.supplier, fileInfo.ModTime())
+			if err != nil {
+				return utils.StepResult{Status: "error", Message: "Error while creating document directory: " + err.Error(), ErrorCode: utils.ErrorCodeDownloadFailed}
 			}
-			if !documentArchive.FileExists(f) {
-				b.newFilesCount++
-				dstFile := filepath.Join(b.documentsDirectory, filename)
-				_, err := utils.CopyFile(f, dstFile)
-				if err != nil {
-					return utils.StepResult{Status: "error", Message: "Error while copying file: " + err.Error()}
-				}
-				err = documentArchive.AddFile(dstFile)
-				if err != nil {
-					return utils.StepResult{Status: "error", Message: "Error while adding file " + dstFile + " to document archive: " + err.Error()}
-				}
+			// Documents are never overwritten, e.g. an older document with the same name
+			dstFile, err := utils.CopyFileUnique(f, filepath.Join(dstDirectory, filename))
+			if err != nil {
+				return utils.StepResult{Status: "error", Message: "Error while copying file: " + err.Error(), ErrorCode: utils.ErrorCodeDownloadFailed}
+			}
+			err = documentArchive.AddFile(dstFile)
+			if err != nil {
+				return utils.StepResult{Status: "error", Message: "Error while adding file " + dstFile + " to document archive: " + err.Error(), ErrorCode: utils.ErrorCodeDownloadFailed}
 			}
-			n++
+			b.newFiles = append(b.newFiles, dstFile)
 		}
+	}
 
-		return utils.StepResult{Status: "success"}
-	} else if resp.StatusCode == 400 {
-		return utils.StepResult{Status: "error"}
+	return utils.StepResult{Status: "success"}
+}
+
+// requestItemsPage requests a single page of items and returns the parsed JSON response.
+// If the request failed, the step result to return is set.
+func (b *ClientAuthBrowserDriver) requestItemsPage(ctx context.Context, step parser.Step, requestUrl string, payload []byte, since string) (interface{}, *utils.StepResult) {
+	method := parser.ItemsRequestMethod(step)
+	replacer := strings.NewReplacer("{{ token }}", b.oauth2AuthToken, "{{ since }}", since)
+
+	var body io.Reader
+	if parser.ItemsRequestHasBody(step) {
+		body = strings.NewReader(replacer.Replace(string(payload)))
+	}
+	req, err := http.NewRequestWithContext(ctx, method, replacer.Replace(requestUrl), body)
+	if err != nil {
+		return nil, &utils.StepResult{Status: "error", Message: fmt.Sprintf("error creating %s request: %s", method, err), ErrorCode: utils.ErrorCodeInvalidRecipe, Break: true}
+	}
+
+	// Set headers
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for n, h := range step.Headers {
+		req.Header.Set(n, replacer.Replace(h))
+	}
+
+	resp, err := b.httpClient.Do(req)
+	if err != nil {
+		return nil, &utils.StepResult{Status: "error", Message: fmt.Sprintf("error sending %s request: %s", method, err), ErrorCode: utils.ErrorCodeNetwork, Break: true}
+	}
+	defer resp.Body.Close()
+
+	// Read response body
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &utils.StepResult{Status: "error", Message: "", ErrorCode: utils.ErrorCodeNetwork}
+	}
+
+	if resp.StatusCode != 200 {
+		return nil, &utils.StepResult{Status: "error", ErrorCode: statusErrorCode(resp.StatusCode)}
 	}
 
-	return utils.StepResult{Status: "error"}
+	var jsr interface{}
+	err = json.Unmarshal(responseBody, &jsr)
+	if err != nil {
+		return nil, &utils.StepResult{Status: "error", Message: fmt.Sprintf("Error while parsing JSON: %s", err), ErrorCode: utils.ErrorCodeDownloadFailed, Break: true}
+	}
+
+	return jsr, nil
 }
 
-func (b *ClientAuthBrowserDriver) doRequest(ctx context.Context, url string, method string, headers map[string]string, filename string, payload []byte) (bool, error) {
+// itemsSince returns the value of `{{ since }}`: the date of the last run of supplier (`--since-last-run`), the date of the newest document
+// of supplier in the archive or the date defaultItemsSince before now, if there is no document yet.
+func itemsSince(documentArchive *archive.DocumentArchive, supplier string, lastRun, now time.Time) string {
+	if !lastRun.IsZero() {
+		return lastRun.Format("2006-01-02")
+	}
+	since := now.Add(-defaultItemsSince)
+	if documentArchive != nil {
+		if latest, ok := documentArchive.LatestDocumentTime(supplier); ok {
+			since = latest
+		}
+	}
+	return since.Format("2006-01-02")
+}
+
+// doRequest downloads the document id from url into the downloads directory and returns the filename of the download (see itemFilename).
+func (b *ClientAuthBrowserDriver) doRequest(ctx context.Context, url string, method string, headers map[string]string, filename, id string, payload []byte) (string, bool, error) {
 	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(payload))
 	if err != nil {
-		return false, err
+		return "", false, err
 	}
 
 	// Set headers
@@ -475,24 +720,70 @@ func (b *ClientAuthBrowserDriver) doRequest(ctx context.Context, url string, met
 		req.Header.Set(n, h)
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := b.httpClient.Do(req)
 	if err != nil {
-		return false, err
+		return "", false, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == 200 {
-		out, err := os.Create(filename)
+		filename = itemFilename(filename, resp.Header.Get("Content-Disposition"), id)
+		out, err := os.Create(filepath.Join(b.downloadsDirectory, filename))
 		if err != nil {
-			return false, err
+			return filename, false, err
 		}
 		defer out.Close()
 
 		_, err = io.Copy(out, resp.Body)
-		return err == nil, err
+		return filename, err == nil, err
+	}
+
+	return "", false, nil
+}
+
+// documentFilename returns the sanitized filename of a document (see sanitizeFilename):
+// the extracted filename, the filename of the Content-Disposition header or fallbackFilename (e.g. `<id>.pdf`).
+func documentFilename(extractedFilename, contentDisposition, fallbackFilename string) string {
+	if filename := sanitizeFilename(extractedFilename); len(filename) > 0 {
+		return filename
 	}
+	if filename := contentDispositionFilename(contentDisposition); len(filename) > 0 {
+		return filename
+	}
+	return sanitizeFilename(fallbackFilename)
+}
 
-	return false, nil
+// itemFilename returns the filename of the document id of an items request.
+// The extracted filename (of `extractDocumentFilenames`) is used as is. APIs often serve all documents with the same
+// Content-Disposition filename (e.g. `invoice.pdf`), so its filename is prefixed with the id (`<id>-invoice.pdf`).
+// Without both, the document is named `<id>.pdf`.
+func itemFilename(extractedFilename, contentDisposition, id string) string {
+	if filename := sanitizeFilename(extractedFilename); len(filename) > 0 {
+		return filename
+	}
+	// Paths of ids (e.g. `2024/42`) are part of the name
+	id = strings.NewReplacer("/", "-", "\\", "-").Replace(id)
+	if filename := contentDispositionFilename(contentDisposition); len(filename) > 0 {
+		return sanitizeFilename(id + "-" + filename)
+	}
+	return sanitizeFilename(id + ".pdf")
+}
+
+// exchangeOauth2Code requests the tokens for an authorization code, the in-flight flow is removed once the code is used.
+func (b *ClientAuthBrowserDriver) exchangeOauth2Code(ctx context.Context, verifier, code, pii, buchhalterConfigDirectory string) (secrets.Oauth2Tokens, error) {
+	payload := []byte(`{
+"grant_type": "authorization_code",
+"client_id": "` + b.oauth2ClientId + `",
+"code_verifier": "` + verifier + `",
+"code": "` + code + `",
+"redirect_uri": "` + b.oauth2RedirectUrl + `"
+}`)
+
+	tokens, err := b.getOauth2Tokens(ctx, payload, pii, buchhalterConfigDirectory)
+	if deleteErr := secrets.DeleteOauth2Flow(pii, buchhalterConfigDirectory); deleteErr != nil {
+		b.logger.Warn("Error removing in-flight OAuth2 flow", "error", deleteErr)
+	}
+	return tokens, err
 }
 
 func (b *ClientAuthBrowserDriver) getOauth2Tokens(ctx context.Context, payload []byte, pii, buchhalterConfigDirectory string) (secrets.Oauth2Tokens, error) {
@@ -503,7 +794,7 @@ func (b *ClientAuthBrowserDriver) getOauth2Tokens(ctx context.Context, payload [
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := b.httpClient.Do(req)
 	if err != nil {
 		return tj, fmt.Errorf("failed to send oauth2 token request: %w", err)
 	}
@@ -554,6 +845,9 @@ func (b *ClientAuthBrowserDriver) runFunc(timeout time.Duration, task chromedp.A
 
 func (b *ClientAuthBrowserDriver) listenForNetworkEvent(ctx context.Context) {
 	chromedp.ListenTarget(ctx, func(ev interface{}) {
+		if b.har != nil {
+			b.har.recordNetworkEvent(ev)
+		}
 		switch ev := ev.(type) {
 
 		case *network.EventResponseReceived:
@@ -569,12 +863,44 @@ func (b *ClientAuthBrowserDriver) listenForNetworkEvent(ctx context.Context) {
 
 /**
  * Extracts a value from a json object by a given path (see extractDocumentIds property in OICDB recipes)
+ * Paths starting with `$` are JSONPath expressions (see parser.JSONPath), all other paths use the dot notation
  */
 func extractJsonValue(data interface{}, path string) []string {
+	if parser.IsJSONPath(path) {
+		return extractJsonPath(data, path)
+	}
 	keys := strings.Split(path, ".")
 	return extractJsonRecursive(data, keys)
 }
 
+/**
+ * Extracts the values of a JSONPath expression: strings as is, numbers in their JSON encoding (e.g. numeric IDs)
+ * The items of selected arrays are extracted, objects and invalid expressions (rejected when the recipe is validated) are skipped
+ */
+func extractJsonPath(data interface{}, path string) []string {
+	jsonPath, err := parser.ParseJSONPath(path)
+	if err != nil {
+		return nil
+	}
+
+	var results []string
+	for _, node := range jsonPath.Select(data) {
+		values := []interface{}{node}
+		if items, ok := node.([]interface{}); ok {
+			values = items
+		}
+		for _, value := range values {
+			switch v := value.(type) {
+			case string:
+				results = append(results, v)
+			case float64:
+				results = append(results, strconv.FormatFloat(v, 'f', -1, 64))
+			}
+		}
+	}
+	return results
+}
+
 /**
  * Child method to execute recursive value parsing for a given path provided by dot notation
  */
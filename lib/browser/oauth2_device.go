@@ -0,0 +1,212 @@
+package browser
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"buchhalter/lib/parser"
+	"buchhalter/lib/secrets"
+	"buchhalter/lib/utils"
+	"buchhalter/lib/vault"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	// oauth2DeviceGrantType is the grant type of the token requests of the device flow (RFC 8628)
+	oauth2DeviceGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+	// oauth2DeviceFlowTimeout is the longest time the user has to confirm the code of the device flow (the code may expire earlier).
+	// It replaces the timeout of the oauth2-authenticate step.
+	oauth2DeviceFlowTimeout = 5 * time.Minute
+	// defaultOauth2DevicePollInterval is the interval of the token requests, if the provider doesn't return one
+	defaultOauth2DevicePollInterval = 5 * time.Second
+	// oauth2DeviceSlowDown is added to the poll interval, if the provider asks to slow down
+	oauth2DeviceSlowDown = 5 * time.Second
+)
+
+// oauth2DeviceCode is the response of the device authorization endpoint.
+type oauth2DeviceCode struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationUri         string `json:"verification_uri"`
+	VerificationUriComplete string `json:"verification_uri_complete"`
+	// VerificationUrl is used by some providers instead of VerificationUri
+	VerificationUrl string `json:"verification_url"`
+	ExpiresIn       int    `json:"expires_in"`
+	Interval        int    `json:"interval"`
+}
+
+// oauth2TokenError is the error response of the token endpoint (e.g. `authorization_pending` while the user hasn't confirmed the code).
+type oauth2TokenError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// stepOauth2DeviceAuthenticate logs in with the device flow instead of the login form of the provider:
+// The verification url and the code are shown to the user, who confirms the code on the page of the provider (e.g. on a phone),
+// while the token endpoint is polled. The tokens are cached like the ones of the authorization code flow.
+func (b *ClientAuthBrowserDriver) stepOauth2DeviceAuthenticate(ctx context.Context, p *tea.Program, recipe *parser.Recipe, step parser.Step, credentials *vault.Credentials, buchhalterConfigDirectory string) utils.StepResult {
+	b.logger.Debug("Executing recipe step", "action", step.Action, "flow", parser.Oauth2FlowDevice)
+	b.logger.Info("Authenticating with OAuth2 device flow ...")
+
+	if len(b.oauth2AuthToken) > 0 {
+		return utils.StepResult{Status: "success"}
+	}
+
+	deviceCode, err := b.requestOauth2DeviceCode(ctx)
+	if err != nil {
+		b.logger.Error("Error while requesting the OAuth2 device code", "error", err.Error())
+		return utils.StepResult{Status: "error", Message: fmt.Sprintf("error while requesting the OAuth2 device code: %s", err.Error()), ErrorCode: utils.ErrorCodeAuthFailed}
+	}
+	utils.RegisterSecret(deviceCode.DeviceCode)
+
+	verificationUri := deviceCode.VerificationUri
+	if len(verificationUri) == 0 {
+		verificationUri = deviceCode.VerificationUrl
+	}
+	b.logger.Info("Waiting for the confirmation of the OAuth2 device code", "verification_uri", verificationUri, "expires_in", deviceCode.ExpiresIn)
+	details := fmt.Sprintf("Open %s and enter the code %s", verificationUri, deviceCode.UserCode)
+	if len(deviceCode.VerificationUriComplete) > 0 {
+		details = fmt.Sprintf("Open %s and confirm the code %s", deviceCode.VerificationUriComplete, deviceCode.UserCode)
+	}
+	p.Send(utils.ViewStatusUpdateMsg{
+		Message: fmt.Sprintf("Authorize buchhalter for `%s`:", recipe.Supplier),
+		Details: details,
+	})
+
+	interval := time.Duration(deviceCode.Interval) * time.Second
+	if interval <= 0 {
+		interval = defaultOauth2DevicePollInterval
+	}
+	expiresIn := time.Duration(deviceCode.ExpiresIn) * time.Second
+	if expiresIn <= 0 || expiresIn > oauth2DeviceFlowTimeout {
+		expiresIn = oauth2DeviceFlowTimeout
+	}
+
+	pii := recipe.Supplier + "|" + credentials.Id
+	tokens, err := b.pollOauth2DeviceToken(ctx, deviceCode.DeviceCode, interval, time.Now().Add(expiresIn), pii, buchhalterConfigDirectory)
+	if err != nil {
+		b.logger.Error("Error while getting OAuth2 access token with device code", "error", err.Error())
+		return utils.StepResult{Status: "error", Message: err.Error(), ErrorCode: utils.ErrorCodeAuthFailed}
+	}
+	b.logger.Info("Successfully retrieved new OAuth2 access tokens with device code.")
+	b.oauth2AuthToken = tokens.AccessToken
+	utils.RegisterSecret(tokens.AccessToken)
+	return utils.StepResult{Status: "success", Message: "Successfully retrieved OAuth2 tokens."}
+}
+
+// requestOauth2DeviceCode requests a device and user code from the device authorization endpoint.
+func (b *ClientAuthBrowserDriver) requestOauth2DeviceCode(ctx context.Context) (oauth2DeviceCode, error) {
+	var deviceCode oauth2DeviceCode
+	params := url.Values{}
+	params.Add("client_id", b.oauth2ClientId)
+	if len(b.oauth2Scope) > 0 {
+		params.Add("scope", b.oauth2Scope)
+	}
+
+	status, body, err := b.postOauth2Form(ctx, b.oauth2DeviceAuthUrl, params)
+	if err != nil {
+		return deviceCode, err
+	}
+	if status != http.StatusOK {
+		return deviceCode, fmt.Errorf("device authorization endpoint returned status %d: %s", status, oauth2ErrorText(body))
+	}
+	if err := json.Unmarshal(body, &deviceCode); err != nil {
+		return deviceCode, fmt.Errorf("error unmarshalling JSON: %w", err)
+	}
+	if len(deviceCode.DeviceCode) == 0 || len(deviceCode.UserCode) == 0 {
+		return deviceCode, errors.New("device authorization endpoint returned no device or user code")
+	}
+	return deviceCode, nil
+}
+
+// pollOauth2DeviceToken requests the tokens for deviceCode every interval, until the user confirmed the code or the code expires (deadline).
+// The tokens are stored in the secrets of pii.
+func (b *ClientAuthBrowserDriver) pollOauth2DeviceToken(ctx context.Context, deviceCode string, interval time.Duration, deadline time.Time, pii, buchhalterConfigDirectory string) (secrets.Oauth2Tokens, error) {
+	var tokens secrets.Oauth2Tokens
+	params := url.Values{}
+	params.Add("grant_type", oauth2DeviceGrantType)
+	params.Add("device_code", deviceCode)
+	params.Add("client_id", b.oauth2ClientId)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return tokens, ctx.Err()
+		case <-time.After(interval):
+		}
+		if time.Now().After(deadline) {
+			return tokens, errors.New("the OAuth2 device code expired before it was confirmed")
+		}
+
+		status, body, err := b.postOauth2Form(ctx, b.oauth2TokenUrl, params)
+		if err != nil {
+			return tokens, err
+		}
+		if status == http.StatusOK {
+			if err := json.Unmarshal(body, &tokens); err != nil {
+				return tokens, fmt.Errorf("error unmarshalling JSON: %w", err)
+			}
+			if err := secrets.SaveOauth2TokensToFile(pii, tokens, buchhalterConfigDirectory); err != nil {
+				return tokens, fmt.Errorf("error storing Oauth2 token to file: %w", err)
+			}
+			return tokens, nil
+		}
+
+		var tokenError oauth2TokenError
+		_ = json.Unmarshal(body, &tokenError)
+		switch tokenError.Error {
+		case "authorization_pending":
+			continue
+		case "slow_down":
+			interval += oauth2DeviceSlowDown
+			continue
+		case "access_denied":
+			return tokens, errors.New("the OAuth2 device code was denied")
+		case "expired_token":
+			return tokens, errors.New("the OAuth2 device code expired before it was confirmed")
+		}
+		return tokens, fmt.Errorf("token endpoint returned status %d: %s", status, oauth2ErrorText(body))
+	}
+}
+
+// postOauth2Form sends params form-encoded to endpoint, as the device flow requires it, and returns the status and body of the response.
+func (b *ClientAuthBrowserDriver) postOauth2Form(ctx context.Context, endpoint string, params url.Values) (int, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(params.Encode()))
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// Some providers (e.g. GitHub) respond form-encoded without it
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := b.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to send oauth2 request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, nil, fmt.Errorf("error reading oauth2 response body: %w", err)
+	}
+	return resp.StatusCode, body, nil
+}
+
+// oauth2ErrorText returns the error (and its description) of an OAuth2 error response, otherwise the body.
+func oauth2ErrorText(body []byte) string {
+	var tokenError oauth2TokenError
+	if err := json.Unmarshal(body, &tokenError); err != nil || len(tokenError.Error) == 0 {
+		return utils.Redact(strings.TrimSpace(string(body)))
+	}
+	if len(tokenError.ErrorDescription) > 0 {
+		return fmt.Sprintf("%s (%s)", tokenError.Error, tokenError.ErrorDescription)
+	}
+	return tokenError.Error
+}
@@ -0,0 +1,96 @@
+package browser
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"buchhalter/lib/secrets"
+)
+
+func TestOauth2DeviceFlow(t *testing.T) {
+	polls := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/device", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("client_id") != "buchhalter" || r.FormValue("scope") != "invoices" {
+			http.Error(w, `{"error": "invalid_client"}`, http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"device_code": "device-123", "user_code": "ABCD-EFGH", "verification_uri": "https://login.example.com/activate", "expires_in": 600, "interval": 5}`)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("grant_type") != oauth2DeviceGrantType || r.FormValue("device_code") != "device-123" {
+			http.Error(w, `{"error": "invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		polls++
+		// The user confirms the code after the second poll
+		if polls < 3 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error": "authorization_pending"}`)
+			return
+		}
+		fmt.Fprint(w, `{"access_token": "access-456", "refresh_token": "refresh-789", "token_type": "Bearer", "expires_in": 3600}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	configDirectory := t.TempDir()
+	b := &ClientAuthBrowserDriver{
+		logger:              slog.Default(),
+		httpClient:          server.Client(),
+		oauth2ClientId:      "buchhalter",
+		oauth2Scope:         "invoices",
+		oauth2DeviceAuthUrl: server.URL + "/device",
+		oauth2TokenUrl:      server.URL + "/token",
+	}
+
+	deviceCode, err := b.requestOauth2DeviceCode(context.Background())
+	if err != nil {
+		t.Fatalf("requestOauth2DeviceCode() returned error: %s", err)
+	}
+	if deviceCode.DeviceCode != "device-123" || deviceCode.UserCode != "ABCD-EFGH" || deviceCode.Interval != 5 {
+		t.Errorf("requestOauth2DeviceCode() = %+v", deviceCode)
+	}
+
+	tokens, err := b.pollOauth2DeviceToken(context.Background(), deviceCode.DeviceCode, time.Millisecond, time.Now().Add(time.Minute), "example|item", configDirectory)
+	if err != nil {
+		t.Fatalf("pollOauth2DeviceToken() returned error: %s", err)
+	}
+	if tokens.AccessToken != "access-456" || polls != 3 {
+		t.Errorf("pollOauth2DeviceToken() = %+v after %d polls; want access-456 after 3 polls", tokens, polls)
+	}
+	cached, err := secrets.GetOauthAccessTokenFromCache("example|item", configDirectory)
+	if err != nil || cached.RefreshToken != "refresh-789" {
+		t.Errorf("GetOauthAccessTokenFromCache() = %+v, %v; want the tokens of the device flow", cached, err)
+	}
+}
+
+func TestOauth2DeviceFlowErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		deadline time.Duration
+	}{
+		{"denied", `{"error": "access_denied"}`, time.Minute},
+		{"expired token", `{"error": "expired_token"}`, time.Minute},
+		{"unknown error", `{"error": "invalid_grant", "error_description": "device code unknown"}`, time.Minute},
+		{"deadline exceeded", `{"error": "authorization_pending"}`, 20 * time.Millisecond},
+	}
+
+	for _, test := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, test.response)
+		}))
+		b := &ClientAuthBrowserDriver{logger: slog.Default(), httpClient: server.Client(), oauth2ClientId: "buchhalter", oauth2TokenUrl: server.URL}
+		if _, err := b.pollOauth2DeviceToken(context.Background(), "device-123", time.Millisecond, time.Now().Add(test.deadline), "example|item", t.TempDir()); err == nil {
+			t.Errorf("%s: pollOauth2DeviceToken() returned no error", test.name)
+		}
+		server.Close()
+	}
+}
@@ -0,0 +1,331 @@
+package browser
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"buchhalter/lib/archive"
+	"buchhalter/lib/parser"
+)
+
+func TestRequestItemsPage(t *testing.T) {
+	type receivedRequest struct {
+		method        string
+		query         string
+		authorization string
+		apiKey        string
+		contentType   string
+		body          string
+	}
+	var received receivedRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = receivedRequest{
+			method:        r.Method,
+			query:         r.URL.RawQuery,
+			authorization: r.Header.Get("Authorization"),
+			apiKey:        r.Header.Get("X-Api-Token"),
+			contentType:   r.Header.Get("Content-Type"),
+			body:          string(body),
+		}
+		_, _ = w.Write([]byte(`{"items": [{"id": "1"}]}`))
+	}))
+	defer server.Close()
+
+	b := &ClientAuthBrowserDriver{logger: slog.Default(), httpClient: server.Client(), oauth2AuthToken: "secret-token"}
+	headers := map[string]string{"Authorization": "Bearer {{ token }}", "X-Api-Token": "{{ token }}"}
+
+	tests := []struct {
+		name     string
+		step     parser.Step
+		expected receivedRequest
+	}{
+		{
+			"default POST",
+			parser.Step{Headers: headers, Body: `{"token": "{{ token }}", "since": "{{ since }}"}`},
+			receivedRequest{"POST", "from=2024-03-10", "Bearer secret-token", "secret-token", "application/json", `{"token": "secret-token", "since": "2024-03-10"}`},
+		},
+		{
+			"GET without body",
+			parser.Step{Method: "GET", Headers: headers},
+			receivedRequest{"GET", "from=2024-03-10", "Bearer secret-token", "secret-token", "", ""},
+		},
+	}
+
+	for _, test := range tests {
+		jsr, stepResult := b.requestItemsPage(t.Context(), test.step, server.URL+"/invoices?from={{ since }}", []byte(test.step.Body), "2024-03-10")
+		if stepResult != nil {
+			t.Errorf("%s: requestItemsPage() returned step result %+v; want none", test.name, *stepResult)
+			continue
+		}
+		if ids := extractJsonValue(jsr, "items.id"); len(ids) != 1 || ids[0] != "1" {
+			t.Errorf("%s: requestItemsPage() returned %v; want the items of the response", test.name, jsr)
+		}
+		if received != test.expected {
+			t.Errorf("%s: request = %+v; want %+v", test.name, received, test.expected)
+		}
+	}
+}
+
+func TestItemsSince(t *testing.T) {
+	now := time.Date(2024, time.May, 10, 12, 0, 0, 0, time.UTC)
+	documentArchive := archive.NewDocumentArchive(slog.Default(), filepath.Join(t.TempDir(), "documents"), archive.LayoutSupplier)
+
+	if since := itemsSince(documentArchive, "example", time.Time{}, now); since != "2023-05-11" {
+		t.Errorf("itemsSince() without documents = %s; want 2023-05-11", since)
+	}
+	if since := itemsSince(nil, "example", time.Time{}, now); since != "2023-05-11" {
+		t.Errorf("itemsSince() without archive = %s; want 2023-05-11", since)
+	}
+	// The last run of the supplier has precedence (`--since-last-run`)
+	if since := itemsSince(documentArchive, "example", now.Add(-48*time.Hour), now); since != "2024-05-08" {
+		t.Errorf("itemsSince() with a last run = %s; want 2024-05-08", since)
+	}
+}
+
+func TestExtractJsonValue(t *testing.T) {
+	var data interface{}
+	if err := json.Unmarshal([]byte(`{
+	"invoices": [
+		{"id": "inv-1", "number": 1001, "document": {"id": "doc-1"}},
+		{"id": "inv-2", "number": 1002, "document": {"id": "doc-2"}}
+	],
+	"meta": {"next": "page-2", "ids": ["a", "b"]}
+}`), &data); err != nil {
+		t.Fatalf("error decoding response: %s", err)
+	}
+
+	tests := []struct {
+		path     string
+		expected []string
+	}{
+		// The dot notation searches the keys recursively, it can't target the nested document IDs
+		{"id", []string{"inv-1", "inv-2"}},
+		{"invoices.id", []string{"inv-1", "inv-2"}},
+		{"meta.ids", []string{"a", "b"}},
+		{"$.invoices[*].id", []string{"inv-1", "inv-2"}},
+		{"$.invoices[*].document.id", []string{"doc-1", "doc-2"}},
+		{"$.invoices[1].id", []string{"inv-2"}},
+		{"$.invoices[*].number", []string{"1001", "1002"}},
+		{"$.meta.ids", []string{"a", "b"}},
+		{"$.meta.next", []string{"page-2"}},
+		{"$.invoices[*]", nil},
+		{"$.missing[*].id", nil},
+		{"$.invoices[", nil},
+	}
+
+	for _, test := range tests {
+		if values := extractJsonValue(data, test.path); fmt.Sprint(values) != fmt.Sprint(test.expected) {
+			t.Errorf("extractJsonValue(%q) = %v; want %v", test.path, values, test.expected)
+		}
+	}
+}
+
+func TestItemFilename(t *testing.T) {
+	tests := []struct {
+		name               string
+		extractedFilename  string
+		contentDisposition string
+		expected           string
+	}{
+		{"quoted", "", `attachment; filename="Rechnung 2024-05.pdf"`, "42-Rechnung 2024-05.pdf"},
+		{"unquoted", "", "attachment; filename=invoice-42.pdf", "42-invoice-42.pdf"},
+		{"RFC 5987 encoded", "", "attachment; filename*=UTF-8''Rechnung%20M%C3%A4rz.pdf", "42-Rechnung März.pdf"},
+		{"RFC 5987 encoded with fallback", "", `attachment; filename="Rechnung Maerz.pdf"; filename*=UTF-8''Rechnung%20M%C3%A4rz.pdf`, "42-Rechnung März.pdf"},
+		{"path traversal", "", `attachment; filename="../../.bashrc"`, "42-.bashrc"},
+		{"missing header", "", "", "42.pdf"},
+		{"no filename", "", "inline", "42.pdf"},
+		{"invalid header", "", `attachment; filename="unterminated`, "42.pdf"},
+		// The filename of `extractDocumentFilenames` takes precedence
+		{"extracted filename", "2024/invoice-42.pdf", `attachment; filename="other.pdf"`, "invoice-42.pdf"},
+	}
+
+	for _, test := range tests {
+		if filename := itemFilename(test.extractedFilename, test.contentDisposition, "42"); filename != test.expected {
+			t.Errorf("%s: itemFilename(%q, %q) = %q; want %q", test.name, test.extractedFilename, test.contentDisposition, filename, test.expected)
+		}
+	}
+	if filename := itemFilename("", "", "2024/42"); filename != "2024-42.pdf" {
+		t.Errorf("itemFilename() of id with a path = %q; want %q", filename, "2024-42.pdf")
+	}
+}
+
+func TestDoRequestContentDisposition(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if contentDisposition := r.URL.Query().Get("cd"); len(contentDisposition) > 0 {
+			w.Header().Set("Content-Disposition", contentDisposition)
+		}
+		_, _ = w.Write([]byte("%PDF-1.7"))
+	}))
+	defer server.Close()
+
+	downloadsDirectory := t.TempDir()
+	b := &ClientAuthBrowserDriver{logger: slog.Default(), httpClient: server.Client(), downloadsDirectory: downloadsDirectory}
+	tests := []struct {
+		contentDisposition string
+		expected           string
+	}{
+		{`attachment; filename="Rechnung 2024-05.pdf"`, "42-Rechnung 2024-05.pdf"},
+		{"", "42.pdf"},
+	}
+
+	for _, test := range tests {
+		requestUrl := server.URL + "/documents/42?cd=" + url.QueryEscape(test.contentDisposition)
+		filename, ok, err := b.doRequest(context.Background(), requestUrl, http.MethodGet, nil, "", "42", nil)
+		if err != nil || !ok {
+			t.Fatalf("doRequest() = %t, %v; want a successful download", ok, err)
+		}
+		if filename != test.expected {
+			t.Errorf("doRequest() filename = %q; want %q", filename, test.expected)
+		}
+		if content, err := os.ReadFile(filepath.Join(downloadsDirectory, test.expected)); err != nil || string(content) != "%PDF-1.7" {
+			t.Errorf("downloaded %s = %q, %v; want the document", test.expected, content, err)
+		}
+	}
+}
+
+func TestStepOauth2RequestItemsSameContentDispositionFilename(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/items" {
+			_, _ = w.Write([]byte(`{"items": [{"id": "1"}, {"id": "2"}]}`))
+			return
+		}
+		// The API serves all documents as `invoice.pdf`
+		w.Header().Set("Content-Disposition", `attachment; filename="invoice.pdf"`)
+		_, _ = w.Write([]byte("%PDF-1.7\n" + r.URL.Path))
+	}))
+	defer server.Close()
+
+	documentsDirectory := filepath.Join(t.TempDir(), "documents")
+	documentArchive := archive.NewDocumentArchive(slog.Default(), documentsDirectory, archive.LayoutSupplier)
+	// A different document with the name of a download exists already
+	existingFile := filepath.Join(documentsDirectory, "example", "2-invoice.pdf")
+	if err := os.MkdirAll(filepath.Dir(existingFile), 0o755); err != nil {
+		t.Fatalf("error creating document directory: %s", err)
+	}
+	if err := os.WriteFile(existingFile, []byte("%PDF-1.7\nexisting"), 0o600); err != nil {
+		t.Fatalf("error writing existing document: %s", err)
+	}
+
+	b := &ClientAuthBrowserDriver{logger: slog.Default(), httpClient: server.Client(), downloadsDirectory: t.TempDir(), supplier: "example"}
+	step := parser.Step{
+		Action:                "oauth2-request-items",
+		URL:                   server.URL + "/items",
+		Method:                http.MethodGet,
+		ExtractDocumentIds:    "items.id",
+		DocumentUrl:           server.URL + "/documents/{{ id }}",
+		DocumentRequestMethod: http.MethodGet,
+	}
+	if result := b.stepOauth2RequestItems(t.Context(), step, documentArchive); result.Status != "success" {
+		t.Fatalf("stepOauth2RequestItems() failed: %s", result.Message)
+	}
+
+	expected := map[string]string{
+		"1-invoice.pdf":   "%PDF-1.7\n/documents/1",
+		"2-invoice-2.pdf": "%PDF-1.7\n/documents/2",
+	}
+	if b.newFilesCount != len(expected) || len(b.newFiles) != len(expected) {
+		t.Fatalf("stepOauth2RequestItems() downloaded %v; want %d new files", b.newFiles, len(expected))
+	}
+	for _, newFile := range b.newFiles {
+		content, err := os.ReadFile(newFile)
+		if err != nil || string(content) != expected[filepath.Base(newFile)] {
+			t.Errorf("new file %s contains %q, %v; want %q", newFile, content, err, expected[filepath.Base(newFile)])
+		}
+	}
+	if content, _ := os.ReadFile(existingFile); string(content) != "%PDF-1.7\nexisting" {
+		t.Errorf("existing document %s was overwritten with %q", existingFile, content)
+	}
+}
+
+func TestStepOauth2RequestItemsPagination(t *testing.T) {
+	tests := []struct {
+		name             string
+		maxPages         int
+		nextToken        func(page int) string
+		expectedRequests int
+		expectedFiles    []string
+	}{
+		{
+			name: "items across pages",
+			nextToken: func(page int) string {
+				if page < 3 {
+					return fmt.Sprint(page + 1)
+				}
+				return ""
+			},
+			expectedRequests: 3,
+			expectedFiles:    []string{"1.pdf", "2.pdf", "3.pdf"},
+		},
+		{
+			name:             "max pages",
+			maxPages:         2,
+			nextToken:        func(page int) string { return fmt.Sprint(page + 1) },
+			expectedRequests: 2,
+			expectedFiles:    []string{"1.pdf", "2.pdf"},
+		},
+		{
+			name:             "repeated token",
+			nextToken:        func(page int) string { return "2" },
+			expectedRequests: 2,
+			expectedFiles:    []string{"1.pdf", "2.pdf"},
+		},
+	}
+
+	for _, test := range tests {
+		itemRequests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/items" {
+				itemRequests++
+				page := 1
+				if next := r.URL.Query().Get("page"); len(next) > 0 {
+					_, _ = fmt.Sscan(next, &page)
+				}
+				_, _ = fmt.Fprintf(w, `{"items": [{"id": "%d"}], "next": "%s"}`, page, test.nextToken(page))
+				return
+			}
+			_, _ = w.Write([]byte("%PDF-1.7\n" + r.URL.Path))
+		}))
+
+		b := &ClientAuthBrowserDriver{logger: slog.Default(), httpClient: server.Client(), downloadsDirectory: t.TempDir(), supplier: "example"}
+		documentArchive := archive.NewDocumentArchive(slog.Default(), filepath.Join(t.TempDir(), "documents"), archive.LayoutSupplier)
+		step := parser.Step{
+			Action:                "oauth2-request-items",
+			URL:                   server.URL + "/items",
+			Method:                http.MethodGet,
+			ExtractDocumentIds:    "items.id",
+			DocumentUrl:           server.URL + "/documents/{{ id }}",
+			DocumentRequestMethod: http.MethodGet,
+			NextPagePath:          "next",
+			NextPageUrl:           server.URL + "/items?page={{ next }}",
+			MaxPages:              test.maxPages,
+		}
+		result := b.stepOauth2RequestItems(t.Context(), step, documentArchive)
+		server.Close()
+
+		if result.Status != "success" {
+			t.Errorf("%s: stepOauth2RequestItems() failed: %s", test.name, result.Message)
+			continue
+		}
+		if itemRequests != test.expectedRequests {
+			t.Errorf("%s: stepOauth2RequestItems() requested %d pages; want %d", test.name, itemRequests, test.expectedRequests)
+		}
+		files := []string{}
+		for _, newFile := range b.newFiles {
+			files = append(files, filepath.Base(newFile))
+		}
+		if fmt.Sprint(files) != fmt.Sprint(test.expectedFiles) {
+			t.Errorf("%s: stepOauth2RequestItems() downloaded %v; want %v", test.name, files, test.expectedFiles)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package browser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"buchhalter/lib/parser"
+	"buchhalter/lib/utils"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/chromedp"
+)
+
+const (
+	// pollInitialInterval is the time between the first checks of a `pollFor` step, it doubles after each check
+	pollInitialInterval = 500 * time.Millisecond
+	// pollMaxInterval is the longest time between the checks of a `pollFor` step, it also limits a single check
+	pollMaxInterval = 5 * time.Second
+)
+
+// stepPollFor checks for the element of step.Selector until it appears, at most for the timeout of the step (step.Value in seconds).
+// The time between the checks grows exponentially (see pollWithBackoff), e.g. for a download link shown once the portal generated the document.
+// Unlike `waitFor`, the step fails with a timeout of its own, before the step timeout aborts the recipe.
+func (b *BrowserDriver) stepPollFor(ctx context.Context, step parser.Step) utils.StepResult {
+	b.logger.Debug("Executing recipe step", "action", step.Action, "selector", step.Selector, "timeout", step.Value)
+
+	timeout, err := parser.ParsePollTimeout(step.Value)
+	if err != nil {
+		return utils.StepResult{Status: "error", Message: err.Error(), ErrorCode: utils.ErrorCodeInvalidRecipe}
+	}
+	opts := []chromedp.QueryOption{}
+	selector, opts := b.getSelectorTypeQueryOptions(step, opts)
+	opts, err = b.getFrameQueryOptions(ctx, step, opts)
+	if err != nil {
+		return utils.StepResult{Status: "error", Message: err.Error(), ErrorCode: utils.ErrorCodeSelectorNotFound}
+	}
+	// A check returns immediately, also if no element matches
+	opts = append(opts, chromedp.AtLeast(0))
+
+	pollCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var lastErr error
+	checks, err := pollWithBackoff(pollCtx, pollInitialInterval, pollMaxInterval, func(checkCtx context.Context) (bool, error) {
+		var nodes []*cdp.Node
+		if err := chromedp.Run(checkCtx, chromedp.Nodes(selector, &nodes, opts...)); err != nil {
+			if ctx.Err() != nil {
+				return false, err
+			}
+			// E.g. the page is reloading, the next check queries it again
+			if checkCtx.Err() == nil {
+				lastErr = err
+			}
+			return false, nil
+		}
+		return len(nodes) > 0, nil
+	})
+	if err == nil {
+		b.logger.Info("Element appeared while polling", "action", step.Action, "selector", step.Selector, "checks", checks)
+		return utils.StepResult{Status: "success"}
+	}
+	if !errors.Is(err, context.DeadlineExceeded) || ctx.Err() != nil {
+		return utils.StepResult{Status: "error", Message: err.Error()}
+	}
+	message := fmt.Sprintf("element `%s` did not appear within %s (%d checks)", step.Selector, timeout, checks)
+	if lastErr != nil {
+		message = fmt.Sprintf("%s, last error: %s", message, lastErr)
+	}
+	return utils.StepResult{Status: "error", Message: message, ErrorCode: utils.ErrorCodeTimeout}
+}
+
+// pollWithBackoff calls check until it returns true, the time between the calls doubles from initialInterval up to maxInterval.
+// Each call is limited to maxInterval. It returns the number of calls and the error of check or ctx (e.g. context.DeadlineExceeded).
+func pollWithBackoff(ctx context.Context, initialInterval, maxInterval time.Duration, check func(ctx context.Context) (bool, error)) (int, error) {
+	interval := initialInterval
+	checks := 0
+	for {
+		checkCtx, cancel := context.WithTimeout(ctx, maxInterval)
+		found, err := check(checkCtx)
+		cancel()
+		checks++
+		if err != nil {
+			return checks, err
+		}
+		if found {
+			return checks, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return checks, ctx.Err()
+		case <-time.After(interval):
+		}
+		interval = min(interval*2, maxInterval)
+	}
+}
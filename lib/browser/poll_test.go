@@ -0,0 +1,45 @@
+package browser
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPollWithBackoff(t *testing.T) {
+	// The element appears with the fourth check
+	calls := []time.Time{}
+	checks, err := pollWithBackoff(context.Background(), 10*time.Millisecond, 40*time.Millisecond, func(ctx context.Context) (bool, error) {
+		calls = append(calls, time.Now())
+		return len(calls) == 4, nil
+	})
+	if err != nil || checks != 4 {
+		t.Fatalf("pollWithBackoff() = %d, %v; want 4 checks without an error", checks, err)
+	}
+	// The intervals grow from 10ms to 20ms and 40ms
+	for i, minInterval := range []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond} {
+		if interval := calls[i+1].Sub(calls[i]); interval < minInterval {
+			t.Errorf("pollWithBackoff() waited %s before check %d; want at least %s", interval, i+2, minInterval)
+		}
+	}
+
+	// Without the element, the poll ends with the context
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	checks, err = pollWithBackoff(ctx, 10*time.Millisecond, 20*time.Millisecond, func(ctx context.Context) (bool, error) {
+		return false, nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) || checks < 2 {
+		t.Errorf("pollWithBackoff() = %d, %v; want several checks and context.DeadlineExceeded", checks, err)
+	}
+
+	// An error of the check ends the poll
+	checkErr := errors.New("browser closed")
+	checks, err = pollWithBackoff(context.Background(), 10*time.Millisecond, 20*time.Millisecond, func(ctx context.Context) (bool, error) {
+		return false, checkErr
+	})
+	if !errors.Is(err, checkErr) || checks != 1 {
+		t.Errorf("pollWithBackoff() = %d, %v; want 1 check with the error of the check", checks, err)
+	}
+}
@@ -0,0 +1,37 @@
+package browser
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+)
+
+// printFallbackTimeout is the time a `downloadAll` step with `printFallback` waits for a download after a click,
+// before the rendered page is printed to PDF instead.
+const printFallbackTimeout = 3 * time.Second
+
+// printPageToPDF prints the rendered page (like the "save as PDF" print dialog of the browser) into the downloads directory.
+// It returns the path of the PDF file.
+func (b *BrowserDriver) printPageToPDF(ctx context.Context, number int) (string, error) {
+	var pdf []byte
+	err := chromedp.Run(ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		var err error
+		pdf, _, err = page.PrintToPDF().WithPrintBackground(true).Do(ctx)
+		return err
+	}))
+	if err != nil {
+		return "", fmt.Errorf("error printing page to PDF: %w", err)
+	}
+
+	pdfFile := filepath.Join(b.downloadsDirectory, fmt.Sprintf("%s-print-%d.pdf", b.supplier, number))
+	if err := os.WriteFile(pdfFile, pdf, 0600); err != nil {
+		return "", fmt.Errorf("error writing printed PDF %s: %w", pdfFile, err)
+	}
+
+	return pdfFile, nil
+}
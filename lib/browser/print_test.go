@@ -0,0 +1,44 @@
+package browser
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"buchhalter/lib/parser"
+
+	"github.com/chromedp/chromedp"
+)
+
+func TestStepDownloadAllPrintFallback(t *testing.T) {
+	ctx := newFixtureBrowserContext(t)
+
+	server := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer server.Close()
+
+	if err := chromedp.Run(ctx, chromedp.Navigate(server.URL+"/print-preview.html")); err != nil {
+		t.Fatalf("error opening fixture: %s", err)
+	}
+
+	b := &BrowserDriver{logger: slog.Default(), downloadsDirectory: t.TempDir(), supplier: "example"}
+	step := parser.Step{Action: "downloadAll", Selector: "a.print", SelectorType: parser.SelectorTypeQuery, SleepDuration: 1, PrintFallback: true}
+	result := b.stepDownloadAll(ctx, step)
+	if result.Status != "success" {
+		t.Fatalf("stepDownloadAll() = %s (%s); want success", result.Status, result.Message)
+	}
+	if b.downloadedFilesCount.Load() != 1 {
+		t.Errorf("stepDownloadAll() downloaded %d files; want 1", b.downloadedFilesCount.Load())
+	}
+
+	content, err := os.ReadFile(filepath.Join(b.downloadsDirectory, "example-print-1.pdf"))
+	if err != nil {
+		t.Fatalf("printed PDF was not written: %s", err)
+	}
+	if !bytes.HasPrefix(content, []byte("%PDF-")) {
+		t.Errorf("printed file is not a PDF document")
+	}
+}
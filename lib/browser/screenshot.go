@@ -0,0 +1,71 @@
+package browser
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"buchhalter/lib/parser"
+	"buchhalter/lib/utils"
+
+	"github.com/chromedp/chromedp"
+)
+
+// screenshotTimeout limits capturing the screenshot of a step, e.g. if the page of a timed out step doesn't respond
+const screenshotTimeout = 5 * time.Second
+
+// screenshotFileNamePattern are the characters replaced in the supplier and action of screenshot file names
+var screenshotFileNamePattern = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// SetScreenshotDirectory captures a screenshot of the page after each step into directory (`--screenshots`), empty for none.
+// The screenshots are attached to the steps of the transcript, e.g. to see the page a selector wasn't found on.
+func (b *BrowserDriver) SetScreenshotDirectory(directory string) {
+	b.screenshotDirectory = directory
+}
+
+// recordStep records step n in the transcript and captures its screenshot (see SetScreenshotDirectory).
+func (b *BrowserDriver) recordStep(n int, step parser.Step, startedAt time.Time, status, message string) {
+	b.transcript.RecordStep(n, step, startedAt, time.Since(startedAt), status, message)
+	if len(b.screenshotDirectory) == 0 {
+		return
+	}
+
+	file := filepath.Join(b.screenshotDirectory, screenshotFileName(b.supplier, n, step.Action))
+	if err := b.captureScreenshot(file); err != nil {
+		// The screenshots only help diagnosing the recipe, it runs without them
+		b.logger.Warn("Error while capturing the screenshot of a step", "step", n, "action", step.Action, "screenshot", file, "error", err.Error())
+		return
+	}
+	b.logger.Debug("Captured screenshot of step", "step", n, "action", step.Action, "screenshot", file)
+	b.transcript.AttachScreenshot(file)
+}
+
+// captureScreenshot writes a screenshot of the visible part of the page into file.
+// It uses the browser context, the steps of a supplier that timed out are captured as well.
+func (b *BrowserDriver) captureScreenshot(file string) error {
+	ctx, cancel := context.WithTimeout(b.browserCtx, screenshotTimeout)
+	defer cancel()
+
+	var screenshot []byte
+	if err := chromedp.Run(ctx, chromedp.CaptureScreenshot(&screenshot)); err != nil {
+		return fmt.Errorf("error capturing screenshot: %w", err)
+	}
+	if err := utils.CreateDirectoryIfNotExists(filepath.Dir(file)); err != nil {
+		return fmt.Errorf("error creating directory of screenshot %s: %w", file, err)
+	}
+	// Like the transcript, the screenshots may show personal data of the portal
+	if err := os.WriteFile(file, screenshot, 0600); err != nil {
+		return fmt.Errorf("error writing screenshot %s: %w", file, err)
+	}
+	return nil
+}
+
+// screenshotFileName returns the file name of the screenshot of step n, e.g. `example-03-click.png`.
+func screenshotFileName(supplier string, n int, action string) string {
+	supplier = screenshotFileNamePattern.ReplaceAllString(supplier, "_")
+	action = screenshotFileNamePattern.ReplaceAllString(action, "_")
+	return fmt.Sprintf("%s-%02d-%s.png", supplier, n, action)
+}
@@ -0,0 +1,22 @@
+package browser
+
+import "testing"
+
+func TestScreenshotFileName(t *testing.T) {
+	tests := []struct {
+		supplier string
+		n        int
+		action   string
+		want     string
+	}{
+		{"example", 3, "click", "example-03-click.png"},
+		{"example", 12, "downloadAll", "example-12-downloadAll.png"},
+		{"../example co", 1, "open", "_example_co-01-open.png"},
+	}
+
+	for _, test := range tests {
+		if got := screenshotFileName(test.supplier, test.n, test.action); got != test.want {
+			t.Errorf("screenshotFileName(%q, %d, %q) = %s; want %s", test.supplier, test.n, test.action, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package browser
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"buchhalter/lib/parser"
+)
+
+// shadowQueryScript finds the first element matching a CSS selector in root,
+// including all (nested) open shadow roots below root.
+const shadowQueryScript = `(root, selector) => {
+	const deepQuery = (root, selector) => {
+		const node = root.querySelector(selector);
+		if (node) {
+			return node;
+		}
+		for (const element of root.querySelectorAll('*')) {
+			if (element.shadowRoot) {
+				const shadowNode = deepQuery(element.shadowRoot, selector);
+				if (shadowNode) {
+					return shadowNode;
+				}
+			}
+		}
+		return null;
+	};
+	return deepQuery(root, selector);
+}`
+
+// shadowSelectorExpression converts a shadow DOM piercing selector (e.g. `invoice-list >>> button.download`)
+// into a JS expression for chromedp.ByJSPath.
+//
+// The first segment is searched in the document, every following segment in the shadow root of the previous match.
+// Each segment also searches nested shadow roots, so intermediate web components can be left out.
+func shadowSelectorExpression(selector string) string {
+	segments := []string{}
+	for _, segment := range strings.Split(selector, parser.ShadowSelectorSeparator) {
+		segment = strings.TrimSpace(segment)
+		if len(segment) > 0 {
+			segments = append(segments, segment)
+		}
+	}
+
+	// json.Marshal takes care of quoting and escaping the CSS selectors
+	segmentsJSON, _ := json.Marshal(segments)
+
+	return fmt.Sprintf(`(() => {
+	const query = %s;
+	let node = document;
+	for (const [i, segment] of %s.entries()) {
+		const root = i === 0 ? node : node.shadowRoot;
+		if (!root) {
+			return null;
+		}
+		node = query(root, segment);
+		if (!node) {
+			return null;
+		}
+	}
+	return node === document ? null : node;
+})()`, shadowQueryScript, segmentsJSON)
+}
@@ -0,0 +1,57 @@
+package browser
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"buchhalter/lib/parser"
+	"buchhalter/lib/utils"
+	"buchhalter/lib/vault"
+
+	"github.com/chromedp/chromedp"
+)
+
+func TestShadowDOMSelector(t *testing.T) {
+	ctx := newFixtureBrowserContext(t)
+
+	server := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer server.Close()
+
+	if err := chromedp.Run(ctx, chromedp.Navigate(server.URL+"/shadow-dom.html")); err != nil {
+		t.Fatalf("error opening fixture: %s", err)
+	}
+
+	b := &BrowserDriver{logger: slog.Default()}
+	credentials := &vault.Credentials{Username: "jane@example.com"}
+	steps := []parser.Step{
+		{Action: "waitFor", Selector: "invoice-portal >>> login-form >>> button.login", SelectorType: parser.SelectorTypeShadow},
+		// Intermediate web components can be left out
+		{Action: "type", Selector: "invoice-portal >>> input[name=email]", SelectorType: parser.SelectorTypeShadow, Value: "{{ username }}"},
+		// The selector type is inferred from the separator
+		{Action: "click", Selector: "invoice-portal >>> button.login"},
+	}
+	for _, step := range steps {
+		var result utils.StepResult
+		switch step.Action {
+		case "waitFor":
+			result = b.stepWaitFor(ctx, step)
+		case "type":
+			result = b.stepType(ctx, step, credentials)
+		case "click":
+			result = b.stepClick(ctx, step)
+		}
+		if result.Status != "success" {
+			t.Fatalf("step %s (%s) failed: %s", step.Action, step.Selector, result.Message)
+		}
+	}
+
+	var text string
+	if err := chromedp.Run(ctx, chromedp.Text("#result", &text, chromedp.ByQuery)); err != nil {
+		t.Fatalf("error reading result: %s", err)
+	}
+	if expected := "logged in as jane@example.com"; text != expected {
+		t.Errorf("result = %q; want %q", text, expected)
+	}
+}
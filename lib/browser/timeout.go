@@ -0,0 +1,50 @@
+package browser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"buchhalter/lib/parser"
+	"buchhalter/lib/utils"
+)
+
+// errSupplierTimeout is the cause of a recipe context canceled by the time limit of the supplier (`--timeout-per-supplier`).
+var errSupplierTimeout = errors.New("supplier timeout exceeded")
+
+// supplierTimeoutContext limits ctx to the total time a supplier may take (`--timeout-per-supplier`).
+// Unlike the step timeout, the time limit covers all steps of the recipe. A timeout of zero is no limit.
+func supplierTimeoutContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeoutCause(ctx, timeout, errSupplierTimeout)
+}
+
+// supplierTimeoutExceeded reports whether ctx of supplierTimeoutContext was canceled by the time limit of the supplier.
+func supplierTimeoutExceeded(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errSupplierTimeout)
+}
+
+// supplierTimeoutResult is the result of a recipe aborted by the time limit of the supplier in step n.
+// The documents moved before the timeout are in the document archive already, so they are part of the result.
+func supplierTimeoutResult(recipe *parser.Recipe, n int, step parser.Step, timeout time.Duration, newFilesCount int, newFiles []string) utils.RecipeResult {
+	return utils.RecipeResult{
+		Status:              "error",
+		StatusText:          fmt.Sprintf("%s aborted with supplier timeout.", recipe.Supplier),
+		StatusTextFormatted: fmt.Sprintf("x %s aborted with supplier timeout.", textStyleBold(recipe.Supplier)),
+		LastStepId:          fmt.Sprintf("%s-%s-%d-%s", recipe.Supplier, recipe.Version, n, step.Action),
+		LastStepDescription: step.Description,
+		LastErrorMessage:    fmt.Sprintf("supplier timeout of %s exceeded", timeout),
+		ErrorCode:           utils.ErrorCodeTimeout,
+		NewFilesCount:       newFilesCount,
+		NewFiles:            newFiles,
+	}
+}
+
+// isLocalStep reports whether step only processes the downloaded files, without the browser.
+// These steps still run after the supplier timeout, to archive the files a `downloadAll` step downloaded before.
+func isLocalStep(step parser.Step) bool {
+	return step.Action == "transform" || step.Action == "move"
+}
@@ -0,0 +1,62 @@
+package browser
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"buchhalter/lib/archive"
+	"buchhalter/lib/parser"
+	"buchhalter/lib/utils"
+)
+
+func TestSupplierTimeoutContext(t *testing.T) {
+	ctx, cancel := supplierTimeoutContext(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	if !supplierTimeoutExceeded(ctx) {
+		t.Errorf("supplierTimeoutExceeded() = false after the timeout; want true")
+	}
+
+	// Without a timeout only the parent context ends the recipe, e.g. CTRL+C
+	parent, cancelParent := context.WithCancel(context.Background())
+	ctx, cancel = supplierTimeoutContext(parent, 0)
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Errorf("supplierTimeoutContext() without a timeout has a deadline")
+	}
+	cancelParent()
+	<-ctx.Done()
+	if supplierTimeoutExceeded(ctx) {
+		t.Errorf("supplierTimeoutExceeded() = true after canceling the parent context; want false")
+	}
+}
+
+func TestAbortWithSupplierTimeout(t *testing.T) {
+	downloadsDirectory := t.TempDir()
+	if err := os.WriteFile(filepath.Join(downloadsDirectory, "invoice-1.pdf"), []byte("%PDF-1.7\ninvoice"), 0o600); err != nil {
+		t.Fatalf("error writing download: %s", err)
+	}
+	documentArchive := archive.NewDocumentArchive(slog.Default(), filepath.Join(t.TempDir(), "documents"), archive.LayoutSupplier)
+
+	// The supplier timed out in a `downloadAll` step after the first download
+	b := &BrowserDriver{logger: slog.Default(), downloadsDirectory: downloadsDirectory, documentArchive: documentArchive, supplier: "example", supplierTimeout: time.Minute}
+	b.downloadedFilesCount.Store(1)
+	recipe := &parser.Recipe{Supplier: "example", Version: "1.0.0"}
+	step := parser.Step{Action: "downloadAll", Selector: "a.invoice"}
+	remainingSteps := []parser.Step{{Action: "click", Selector: "#logout"}, {Action: "move", Value: `.*\.pdf`}}
+
+	result, err := b.abortWithSupplierTimeout(recipe, 3, step, remainingSteps)
+	if err != nil {
+		t.Fatalf("abortWithSupplierTimeout() returned error: %s", err)
+	}
+	if result.Status != "error" || result.ErrorCode != utils.ErrorCodeTimeout || result.LastErrorMessage != "supplier timeout of 1m0s exceeded" || result.LastStepId != "example-1.0.0-3-downloadAll" {
+		t.Errorf("abortWithSupplierTimeout() = %+v; want the supplier timeout in step 3", result)
+	}
+	if result.NewFilesCount != 1 || len(result.NewFiles) != 1 || filepath.Base(result.NewFiles[0]) != "invoice-1.pdf" {
+		t.Errorf("abortWithSupplierTimeout() moved %d files %v; want invoice-1.pdf", result.NewFilesCount, result.NewFiles)
+	}
+}
@@ -0,0 +1,260 @@
+package browser
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+// tlsCertificateFetchTimeout is the maximum time to fetch the certificate of an insecure host for Chrome.
+const tlsCertificateFetchTimeout = 10 * time.Second
+
+// TLSOverride relaxes the certificate verification for a single supplier host (e.g. an internal portal with a self-signed certificate).
+// Host is a hostname with an optional port (default 443), only this port of the host is affected. Wildcards are not supported.
+// Either the host's certificate is verified against the CA in CAFile or certificate errors are ignored (Insecure).
+type TLSOverride struct {
+	Host     string `mapstructure:"host"`
+	CAFile   string `mapstructure:"ca_file"`
+	Insecure bool   `mapstructure:"insecure"`
+}
+
+type tlsHostOverride struct {
+	address  string
+	insecure bool
+	// roots are the system roots incl. the CA of the override
+	roots *x509.CertPool
+	// caCertificates are the certificates of the CA file
+	caCertificates []*x509.Certificate
+}
+
+// TLSOverrides are the validated TLS overrides of an explicit host allowlist, by the address (`host:port`) of the host.
+// A nil *TLSOverrides verifies all certificates as usual.
+type TLSOverrides struct {
+	hosts map[string]*tlsHostOverride
+}
+
+// NewTLSOverrides validates overrides and loads their CA files.
+func NewTLSOverrides(overrides []TLSOverride) (*TLSOverrides, error) {
+	if len(overrides) == 0 {
+		return nil, nil
+	}
+
+	o := &TLSOverrides{hosts: map[string]*tlsHostOverride{}}
+	for _, override := range overrides {
+		hostname, address, err := parseTLSOverrideHost(override.Host)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := o.hosts[address]; exists {
+			return nil, fmt.Errorf("TLS override for host `%s` is configured twice", address)
+		}
+		hasCAFile := len(strings.TrimSpace(override.CAFile)) > 0
+		if hasCAFile == override.Insecure {
+			return nil, fmt.Errorf("TLS override for host `%s` requires either `ca_file` or `insecure: true`", hostname)
+		}
+
+		hostOverride := &tlsHostOverride{address: address, insecure: override.Insecure}
+		if hasCAFile {
+			hostOverride.caCertificates, err = loadCACertificates(override.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("TLS override for host `%s`: %w", hostname, err)
+			}
+			hostOverride.roots, err = x509.SystemCertPool()
+			if err != nil {
+				hostOverride.roots = x509.NewCertPool()
+			}
+			for _, certificate := range hostOverride.caCertificates {
+				hostOverride.roots.AddCert(certificate)
+			}
+		}
+		o.hosts[address] = hostOverride
+	}
+
+	return o, nil
+}
+
+// parseTLSOverrideHost returns the lower case hostname and the address (incl. port) of host.
+func parseTLSOverrideHost(host string) (string, string, error) {
+	host = strings.TrimSpace(host)
+	if len(host) == 0 {
+		return "", "", errors.New("TLS override without a host")
+	}
+	if strings.Contains(host, "://") || strings.ContainsAny(host, "/*") {
+		return "", "", fmt.Errorf("TLS override host `%s` must be a plain hostname (no scheme, path or wildcard)", host)
+	}
+
+	hostname, port := host, "443"
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		hostname, port = h, p
+	}
+	hostname = strings.ToLower(hostname)
+
+	return hostname, net.JoinHostPort(hostname, port), nil
+}
+
+func loadCACertificates(caFile string) ([]*x509.Certificate, error) {
+	content, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading CA file: %w", err)
+	}
+
+	certificates := []*x509.Certificate{}
+	for rest := content; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing certificate of CA file %s: %w", caFile, err)
+		}
+		certificates = append(certificates, certificate)
+	}
+	if len(certificates) == 0 {
+		return nil, fmt.Errorf("CA file %s contains no PEM encoded certificate", caFile)
+	}
+
+	return certificates, nil
+}
+
+// HTTPClient returns an HTTP client that applies the overrides to the hosts of the allowlist.
+// All other hosts are verified as usual.
+// A clientCertificate is presented to all hosts that request one (mutual TLS of `client` recipes).
+func (o *TLSOverrides) HTTPClient(clientCertificate *tls.Certificate) *http.Client {
+	var base http.RoundTripper = http.DefaultTransport
+	certificates := []tls.Certificate{}
+	if clientCertificate != nil {
+		certificates = append(certificates, *clientCertificate)
+		baseTransport := http.DefaultTransport.(*http.Transport).Clone()
+		baseTransport.TLSClientConfig = &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			Certificates: certificates,
+		}
+		base = baseTransport
+	}
+	if o == nil {
+		if clientCertificate == nil {
+			return http.DefaultClient
+		}
+		return &http.Client{Transport: base}
+	}
+
+	transport := &tlsOverrideTransport{
+		base:  base,
+		hosts: map[string]http.RoundTripper{},
+	}
+	for address, override := range o.hosts {
+		hostTransport := http.DefaultTransport.(*http.Transport).Clone()
+		hostTransport.TLSClientConfig = &tls.Config{
+			MinVersion:         tls.VersionTLS12,
+			RootCAs:            override.roots,
+			InsecureSkipVerify: override.insecure, // #nosec G402 -- only for an allowlisted host
+			Certificates:       certificates,
+		}
+		transport.hosts[address] = hostTransport
+	}
+
+	return &http.Client{Transport: transport}
+}
+
+// tlsOverrideTransport sends the requests to the hosts of the allowlist via their own transport (with the relaxed TLS config).
+// The hosts are matched by their address, so other ports of a host are verified as usual.
+// Redirects are separate requests, so a redirect to another host is verified as usual.
+type tlsOverrideTransport struct {
+	base  http.RoundTripper
+	hosts map[string]http.RoundTripper
+}
+
+func (t *tlsOverrideTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if hostTransport, ok := t.hosts[requestAddress(req.URL)]; ok {
+		return hostTransport.RoundTrip(req)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// requestAddress returns the lower case address (incl. port) a request to u is sent to, the default port depends on the scheme.
+func requestAddress(u *url.URL) string {
+	port := u.Port()
+	if len(port) == 0 {
+		port = "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+	}
+	return net.JoinHostPort(strings.ToLower(u.Hostname()), port)
+}
+
+// ChromeFlags returns the Chrome flags to accept the certificates of the overrides.
+// Chrome can't scope certificate errors to hosts, instead the public keys of the accepted certificates are allowlisted:
+// the certificates of the CA files and the certificates the insecure hosts currently present.
+func (o *TLSOverrides) ChromeFlags(logger *slog.Logger) []chromedp.ExecAllocatorOption {
+	if o == nil {
+		return nil
+	}
+
+	spkiHashes := []string{}
+	for _, override := range o.hosts {
+		certificates := override.caCertificates
+		if override.insecure {
+			certificate, err := fetchServerCertificate(override.address)
+			if err != nil {
+				logger.Warn("Error fetching certificate of insecure TLS host, certificate errors are not ignored by Chrome", "host", override.address, "error", err)
+				continue
+			}
+			certificates = []*x509.Certificate{certificate}
+		}
+		for _, certificate := range certificates {
+			spkiHashes = append(spkiHashes, spkiHash(certificate))
+		}
+	}
+	if len(spkiHashes) == 0 {
+		return nil
+	}
+
+	return []chromedp.ExecAllocatorOption{
+		chromedp.Flag("ignore-certificate-errors-spki-list", strings.Join(spkiHashes, ",")),
+	}
+}
+
+// fetchServerCertificate returns the leaf certificate address presents, without verifying it.
+func fetchServerCertificate(address string) (*x509.Certificate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), tlsCertificateFetchTimeout)
+	defer cancel()
+
+	dialer := &tls.Dialer{Config: &tls.Config{InsecureSkipVerify: true}} // #nosec G402 -- only to read the certificate of an allowlisted host
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	certificates := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(certificates) == 0 {
+		return nil, fmt.Errorf("%s presented no certificate", address)
+	}
+	return certificates[0], nil
+}
+
+// spkiHash returns the base64 encoded SHA-256 hash of the public key of certificate, as expected by Chrome.
+func spkiHash(certificate *x509.Certificate) string {
+	sum := sha256.Sum256(certificate.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,148 @@
+package browser
+
+import (
+	"encoding/pem"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewTLSOverridesValidation(t *testing.T) {
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, []byte("not a certificate"), 0600); err != nil {
+		t.Fatalf("error writing CA file: %s", err)
+	}
+
+	tests := []struct {
+		name      string
+		overrides []TLSOverride
+	}{
+		{"empty host", []TLSOverride{{Host: " ", Insecure: true}}},
+		{"host with scheme", []TLSOverride{{Host: "https://intranet.example.com", Insecure: true}}},
+		{"wildcard host", []TLSOverride{{Host: "*.example.com", Insecure: true}}},
+		{"neither CA nor insecure", []TLSOverride{{Host: "intranet.example.com"}}},
+		{"CA and insecure", []TLSOverride{{Host: "intranet.example.com", CAFile: caFile, Insecure: true}}},
+		{"invalid CA file", []TLSOverride{{Host: "intranet.example.com", CAFile: caFile}}},
+		{"missing CA file", []TLSOverride{{Host: "intranet.example.com", CAFile: caFile + ".missing"}}},
+		{"duplicate host", []TLSOverride{{Host: "intranet.example.com", Insecure: true}, {Host: "Intranet.example.com:443", Insecure: true}}},
+	}
+
+	for _, test := range tests {
+		if _, err := NewTLSOverrides(test.overrides); err == nil {
+			t.Errorf("%s: NewTLSOverrides() returned no error; want an error", test.name)
+		}
+	}
+
+	if overrides, err := NewTLSOverrides(nil); err != nil || overrides != nil {
+		t.Errorf("NewTLSOverrides(nil) = %v, %v; want no overrides", overrides, err)
+	}
+
+	// Each port of a host is a separate override
+	overrides, err := NewTLSOverrides([]TLSOverride{{Host: "intranet.example.com", Insecure: true}, {Host: "intranet.example.com:8443", Insecure: true}})
+	if err != nil {
+		t.Fatalf("NewTLSOverrides() of two ports returned error: %s", err)
+	}
+	if len(overrides.hosts) != 2 || overrides.hosts["intranet.example.com:443"] == nil || overrides.hosts["intranet.example.com:8443"] == nil {
+		t.Errorf("NewTLSOverrides() of two ports = %v; want the addresses with port 443 and 8443", overrides.hosts)
+	}
+}
+
+func TestTLSOverridesHTTPClient(t *testing.T) {
+	// httptest serves a self-signed certificate for 127.0.0.1
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	serverUrl, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("error parsing server URL: %s", err)
+	}
+
+	// A second server on another port of the same host
+	otherPortServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer otherPortServer.Close()
+	otherPortUrl, err := url.Parse(otherPortServer.URL)
+	if err != nil {
+		t.Fatalf("error parsing server URL: %s", err)
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0600); err != nil {
+		t.Fatalf("error writing CA file: %s", err)
+	}
+
+	tests := []struct {
+		name        string
+		overrides   []TLSOverride
+		expectError bool
+	}{
+		{"no override", nil, true},
+		{"insecure host", []TLSOverride{{Host: serverUrl.Host, Insecure: true}}, false},
+		{"CA of host", []TLSOverride{{Host: serverUrl.Host, CAFile: caFile}}, false},
+		// An override applies to its port only (default 443), other ports of the host are verified as usual
+		{"insecure host without port", []TLSOverride{{Host: "127.0.0.1", Insecure: true}}, true},
+		{"insecure other port", []TLSOverride{{Host: otherPortUrl.Host, Insecure: true}}, true},
+		{"CA of other port", []TLSOverride{{Host: otherPortUrl.Host, CAFile: caFile}}, true},
+		{"insecure other host", []TLSOverride{{Host: "intranet.example.com", Insecure: true}}, true},
+		{"CA of other host", []TLSOverride{{Host: "intranet.example.com", CAFile: caFile}}, true},
+	}
+
+	for _, test := range tests {
+		overrides, err := NewTLSOverrides(test.overrides)
+		if err != nil {
+			t.Fatalf("%s: NewTLSOverrides() returned error: %s", test.name, err)
+		}
+
+		resp, err := overrides.HTTPClient(nil).Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		if test.expectError && err == nil {
+			t.Errorf("%s: request succeeded; want a certificate error", test.name)
+		}
+		if !test.expectError && err != nil {
+			t.Errorf("%s: request returned error %s; want no error", test.name, err)
+		}
+	}
+}
+
+func TestTLSOverridesChromeFlags(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	serverUrl, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("error parsing server URL: %s", err)
+	}
+
+	overrides, err := NewTLSOverrides([]TLSOverride{{Host: serverUrl.Host, Insecure: true}})
+	if err != nil {
+		t.Fatalf("NewTLSOverrides() returned error: %s", err)
+	}
+	hostOverride := overrides.hosts[serverUrl.Host]
+	if hostOverride == nil || hostOverride.address != serverUrl.Host {
+		t.Fatalf("override of host %s = %+v; want address %s", serverUrl.Host, hostOverride, serverUrl.Host)
+	}
+
+	// The public key of the certificate the host presents is allowlisted
+	certificate, err := fetchServerCertificate(hostOverride.address)
+	if err != nil {
+		t.Fatalf("fetchServerCertificate() returned error: %s", err)
+	}
+	if !strings.EqualFold(spkiHash(certificate), spkiHash(server.Certificate())) {
+		t.Errorf("fetchServerCertificate() returned another certificate than the server presents")
+	}
+	if flags := overrides.ChromeFlags(slog.Default()); len(flags) != 1 {
+		t.Errorf("ChromeFlags() returned %d flags; want 1", len(flags))
+	}
+
+	var noOverrides *TLSOverrides
+	if flags := noOverrides.ChromeFlags(slog.Default()); len(flags) != 0 {
+		t.Errorf("ChromeFlags() without overrides returned %d flags; want none", len(flags))
+	}
+}
@@ -0,0 +1,143 @@
+package browser
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"buchhalter/lib/parser"
+	"buchhalter/lib/utils"
+)
+
+// TranscriptFormatVersion is the version of the transcript format, it is only increased on incompatible changes.
+const TranscriptFormatVersion = 1
+
+// Transcript records the steps a browser recipe executed, with their results and timings (e.g. for bug reports).
+// It is a recipe file of the executed steps as well, the run can be replayed with `buchhalter sync --recipe-file`.
+// Secrets are redacted (see utils.Redact), the network traffic is not part of the transcript.
+type Transcript struct {
+	parser.Recipe
+	Transcript TranscriptRun `json:"transcript"`
+}
+
+// TranscriptRun is the run of the recipe.
+type TranscriptRun struct {
+	FormatVersion int              `json:"formatVersion"`
+	ChromeVersion string           `json:"chromeVersion,omitempty"`
+	StartedAt     time.Time        `json:"startedAt"`
+	DurationMs    int64            `json:"durationMs"`
+	Status        string           `json:"status"`
+	Steps         []TranscriptStep `json:"steps"`
+}
+
+// TranscriptStep is the result of an executed step.
+// Index is the position of the step in the recipe (starting at 1), OffsetMs the start of the step relative to the start of the run.
+type TranscriptStep struct {
+	Index        int    `json:"index"`
+	Action       string `json:"action"`
+	Selector     string `json:"selector,omitempty"`
+	SelectorType string `json:"selectorType,omitempty"`
+	Frame        string `json:"frame,omitempty"`
+	OffsetMs     int64  `json:"offsetMs"`
+	DurationMs   int64  `json:"durationMs"`
+	Status       string `json:"status"`
+	Message      string `json:"message,omitempty"`
+	// Screenshot is the file of the screenshot after the step (`--screenshots`)
+	Screenshot string `json:"screenshot,omitempty"`
+}
+
+// NewTranscript starts the transcript of a run of recipe.
+func NewTranscript(recipe parser.Recipe, startedAt time.Time) *Transcript {
+	recipe.Steps = []parser.Step{}
+	return &Transcript{
+		Recipe: recipe,
+		Transcript: TranscriptRun{
+			FormatVersion: TranscriptFormatVersion,
+			StartedAt:     startedAt.UTC(),
+			Status:        "success",
+			Steps:         []TranscriptStep{},
+		},
+	}
+}
+
+// RecordStep records an executed step with its result (`success`, `error` or `timeout`).
+func (t *Transcript) RecordStep(index int, step parser.Step, startedAt time.Time, duration time.Duration, status, message string) {
+	t.Recipe.Steps = append(t.Recipe.Steps, redactStep(step))
+	t.Transcript.Steps = append(t.Transcript.Steps, TranscriptStep{
+		Index:        index,
+		Action:       step.Action,
+		Selector:     utils.Redact(step.Selector),
+		SelectorType: step.SelectorType,
+		Frame:        step.Frame,
+		OffsetMs:     startedAt.Sub(t.Transcript.StartedAt).Milliseconds(),
+		DurationMs:   duration.Milliseconds(),
+		Status:       status,
+		Message:      utils.Redact(message),
+	})
+	if status != "success" {
+		t.Transcript.Status = status
+	}
+}
+
+// AttachScreenshot attaches the screenshot file to the last recorded step.
+func (t *Transcript) AttachScreenshot(file string) {
+	if len(t.Transcript.Steps) == 0 {
+		return
+	}
+	t.Transcript.Steps[len(t.Transcript.Steps)-1].Screenshot = file
+}
+
+// Finish records the end of the run.
+func (t *Transcript) Finish(finishedAt time.Time, chromeVersion string) {
+	t.Transcript.DurationMs = finishedAt.Sub(t.Transcript.StartedAt).Milliseconds()
+	t.Transcript.ChromeVersion = chromeVersion
+}
+
+// Write writes the transcript as JSON into file.
+// The file is only readable by the user, redaction may miss secrets it doesn't know.
+func (t *Transcript) Write(file string) error {
+	content, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding transcript: %w", err)
+	}
+	content = append(content, '\n')
+
+	if err := utils.CreateDirectoryIfNotExists(filepath.Dir(file)); err != nil {
+		return fmt.Errorf("error creating directory of transcript %s: %w", file, err)
+	}
+	if err := os.WriteFile(file, content, 0600); err != nil {
+		return fmt.Errorf("error writing transcript %s: %w", file, err)
+	}
+	return nil
+}
+
+// ReadTranscript reads a transcript written by Write.
+func ReadTranscript(file string) (*Transcript, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading transcript %s: %w", file, err)
+	}
+	var transcript Transcript
+	if err := json.Unmarshal(content, &transcript); err != nil {
+		return nil, fmt.Errorf("error parsing transcript %s: %w", file, err)
+	}
+	return &transcript, nil
+}
+
+// redactStep removes secrets from the values of step and its fallback steps.
+// Placeholders (e.g. `{{ password }}`) are kept, they are resolved when the transcript is replayed.
+func redactStep(step parser.Step) parser.Step {
+	step.URL = utils.Redact(step.URL)
+	step.Selector = utils.Redact(step.Selector)
+	step.Value = utils.Redact(step.Value)
+	if len(step.Fallback) > 0 {
+		fallback := make([]parser.Step, 0, len(step.Fallback))
+		for _, fallbackStep := range step.Fallback {
+			fallback = append(fallback, redactStep(fallbackStep))
+		}
+		step.Fallback = fallback
+	}
+	return step
+}
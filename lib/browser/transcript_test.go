@@ -0,0 +1,109 @@
+package browser
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"buchhalter/lib/parser"
+	"buchhalter/lib/utils"
+)
+
+func TestTranscriptRecordStep(t *testing.T) {
+	utils.RegisterSecret("transcript-secret-password")
+	recipe := parser.Recipe{
+		Supplier: "example",
+		Domains:  []string{"example.com"},
+		Version:  "1.0.0",
+		Type:     "browser",
+		Steps: []parser.Step{
+			{Action: "open", URL: "https://example.com/login"},
+			{Action: "type", Selector: "#password", Value: "{{ password }}"},
+			{Action: "type", Selector: "#pin", Value: "transcript-secret-password"},
+			{Action: "click", Selector: "#submit"},
+		},
+	}
+	startedAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	transcript := NewTranscript(recipe, startedAt)
+	transcript.RecordStep(1, recipe.Steps[0], startedAt, 1500*time.Millisecond, "success", "")
+	transcript.RecordStep(2, recipe.Steps[1], startedAt.Add(2*time.Second), 200*time.Millisecond, "success", "")
+	transcript.RecordStep(3, recipe.Steps[2], startedAt.Add(3*time.Second), 60*time.Second, "timeout", "no element for token=abc123")
+	transcript.Finish(startedAt.Add(64*time.Second), "126.0.6478.126")
+
+	if transcript.Transcript.Status != "timeout" || transcript.Transcript.DurationMs != 64000 || transcript.Transcript.ChromeVersion != "126.0.6478.126" {
+		t.Errorf("Transcript = %+v; want a timed out run of 64s", transcript.Transcript)
+	}
+	if len(transcript.Steps) != 3 || len(transcript.Transcript.Steps) != 3 {
+		t.Fatalf("Transcript has %d recipe steps and %d results; want the 3 executed steps", len(transcript.Steps), len(transcript.Transcript.Steps))
+	}
+	if step := transcript.Transcript.Steps[1]; step.Index != 2 || step.OffsetMs != 2000 || step.DurationMs != 200 || step.Selector != "#password" {
+		t.Errorf("Transcript step 2 = %+v; want the timing of the step", step)
+	}
+	if value := transcript.Steps[1].Value; value != "{{ password }}" {
+		t.Errorf("Transcript step 2 value = %s; want the placeholder", value)
+	}
+
+	// Registered secrets and values that look like secrets are redacted
+	encoded, err := json.Marshal(transcript)
+	if err != nil {
+		t.Fatalf("json.Marshal() returned error: %s", err)
+	}
+	for _, secret := range []string{"transcript-secret-password", "abc123"} {
+		if strings.Contains(string(encoded), secret) {
+			t.Errorf("Transcript contains the secret %s: %s", secret, encoded)
+		}
+	}
+
+	// The recipe of the original is unchanged
+	if recipe.Steps[2].Value != "transcript-secret-password" || len(recipe.Steps) != 4 {
+		t.Errorf("NewTranscript() changed the steps of the recipe")
+	}
+}
+
+func TestTranscriptWriteReplayable(t *testing.T) {
+	recipe := parser.Recipe{
+		Supplier: "example",
+		Domains:  []string{"example.com"},
+		Version:  "1.0.0",
+		Type:     "browser",
+		Steps: []parser.Step{
+			{Action: "open", URL: "https://example.com/login"},
+			{Action: "waitForApproval", Selector: "#dashboard", Value: "30", Fallback: []parser.Step{{Action: "type", Selector: "#otp", Value: "{{ totp }}"}}},
+		},
+	}
+	transcript := NewTranscript(recipe, time.Now())
+	for i, step := range recipe.Steps {
+		transcript.RecordStep(i+1, step, time.Now(), time.Second, "success", "")
+	}
+	transcript.AttachScreenshot("example-02-waitForApproval.png")
+	transcript.Finish(time.Now(), "")
+
+	file := filepath.Join(t.TempDir(), "transcripts", "example.transcript.json")
+	if err := transcript.Write(file); err != nil {
+		t.Fatalf("Write() returned error: %s", err)
+	}
+	if info, err := os.Stat(file); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Write() created %s with %v, %v; want mode 0600", file, info, err)
+	}
+
+	// The transcript is a recipe file of the executed steps
+	replayed, err := parser.ReadRecipeFile(file)
+	if err != nil {
+		t.Fatalf("ReadRecipeFile() of the transcript returned error: %s", err)
+	}
+	if replayed.Supplier != "example" || len(replayed.Steps) != 2 || len(replayed.Steps[1].Fallback) != 1 {
+		t.Errorf("ReadRecipeFile() of the transcript = %+v; want the executed steps", replayed)
+	}
+
+	read, err := ReadTranscript(file)
+	if err != nil {
+		t.Fatalf("ReadTranscript() returned error: %s", err)
+	}
+	if len(read.Transcript.Steps) != 2 || read.Transcript.Steps[0].Screenshot != "" || read.Transcript.Steps[1].Screenshot != "example-02-waitForApproval.png" {
+		t.Errorf("ReadTranscript() steps = %+v; want the screenshot of the last step", read.Transcript.Steps)
+	}
+}
@@ -0,0 +1,26 @@
+package browser
+
+import (
+	"buchhalter/lib/parser"
+
+	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/chromedp"
+)
+
+// viewportTasks returns the chromedp tasks to emulate the viewport of a recipe.
+// Without a viewport, no tasks are returned and the browser keeps its window size.
+func viewportTasks(viewport *parser.Viewport) chromedp.Tasks {
+	if viewport == nil {
+		return chromedp.Tasks{}
+	}
+
+	tasks := chromedp.Tasks{
+		emulation.SetDeviceMetricsOverride(viewport.Width, viewport.Height, viewport.DeviceScaleFactor, viewport.Mobile),
+		emulation.SetTouchEmulationEnabled(viewport.Mobile),
+	}
+	if len(viewport.UserAgent) > 0 {
+		tasks = append(tasks, emulation.SetUserAgentOverride(viewport.UserAgent))
+	}
+
+	return tasks
+}
@@ -0,0 +1,48 @@
+package browser
+
+import (
+	"testing"
+
+	"buchhalter/lib/parser"
+
+	"github.com/chromedp/chromedp"
+)
+
+func TestViewportTasks(t *testing.T) {
+	if tasks := viewportTasks(nil); len(tasks) != 0 {
+		t.Errorf("viewportTasks(nil) returned %d tasks; want 0", len(tasks))
+	}
+
+	ctx := newFixtureBrowserContext(t)
+
+	viewport := &parser.Viewport{
+		Width:             390,
+		Height:            844,
+		DeviceScaleFactor: 3,
+		Mobile:            true,
+		UserAgent:         "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) Mobile/15E148",
+	}
+	var width, height int64
+	var devicePixelRatio float64
+	var userAgent string
+	if err := chromedp.Run(ctx,
+		viewportTasks(viewport),
+		chromedp.Navigate("about:blank"),
+		chromedp.Evaluate(`window.innerWidth`, &width),
+		chromedp.Evaluate(`window.innerHeight`, &height),
+		chromedp.Evaluate(`window.devicePixelRatio`, &devicePixelRatio),
+		chromedp.Evaluate(`navigator.userAgent`, &userAgent),
+	); err != nil {
+		t.Fatalf("error applying viewport: %s", err)
+	}
+
+	if width != viewport.Width || height != viewport.Height {
+		t.Errorf("viewport = %dx%d; want %dx%d", width, height, viewport.Width, viewport.Height)
+	}
+	if devicePixelRatio != viewport.DeviceScaleFactor {
+		t.Errorf("devicePixelRatio = %f; want %f", devicePixelRatio, viewport.DeviceScaleFactor)
+	}
+	if userAgent != viewport.UserAgent {
+		t.Errorf("userAgent = %q; want %q", userAgent, viewport.UserAgent)
+	}
+}
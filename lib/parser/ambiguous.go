@@ -0,0 +1,73 @@
+package parser
+
+// Modes for recipes matched by multiple vault items (`buchhalter sync --on-ambiguous`)
+const (
+	// AmbiguousModeAll runs the recipe once per matching vault item
+	AmbiguousModeAll = "all"
+	// AmbiguousModeFirst runs the recipe only with the first matching vault item
+	AmbiguousModeFirst = "first"
+	// AmbiguousModeSkip doesn't run the recipe, until the user disambiguates the vault items
+	AmbiguousModeSkip = "skip"
+)
+
+// AmbiguousModes are all supported modes for ambiguous matches
+var AmbiguousModes = []string{AmbiguousModeAll, AmbiguousModeFirst, AmbiguousModeSkip}
+
+// IsSupportedAmbiguousMode returns true if mode is one of AmbiguousModes.
+func IsSupportedAmbiguousMode(mode string) bool {
+	switch mode {
+	case AmbiguousModeAll, AmbiguousModeFirst, AmbiguousModeSkip:
+		return true
+	}
+	return false
+}
+
+// RecipeMatch is a recipe matched by a vault item.
+type RecipeMatch struct {
+	Recipe    *Recipe
+	ItemId    string
+	ItemTitle string
+}
+
+// AmbiguousMatch is a supplier whose recipe is matched by multiple vault items.
+type AmbiguousMatch struct {
+	Supplier string
+	// Items are the matching vault items, in the order of the vault
+	Items []RecipeMatch
+}
+
+// ResolveAmbiguousMatches applies mode to all suppliers matched by multiple vault items.
+// It returns the matches to run (in their original order) and the ambiguous suppliers (in the order of their first match).
+func ResolveAmbiguousMatches(matches []RecipeMatch, mode string) ([]RecipeMatch, []AmbiguousMatch) {
+	matchesBySupplier := map[string][]RecipeMatch{}
+	suppliers := []string{}
+	for _, match := range matches {
+		if _, exists := matchesBySupplier[match.Recipe.Supplier]; !exists {
+			suppliers = append(suppliers, match.Recipe.Supplier)
+		}
+		matchesBySupplier[match.Recipe.Supplier] = append(matchesBySupplier[match.Recipe.Supplier], match)
+	}
+
+	ambiguous := []AmbiguousMatch{}
+	for _, supplier := range suppliers {
+		if len(matchesBySupplier[supplier]) > 1 {
+			ambiguous = append(ambiguous, AmbiguousMatch{Supplier: supplier, Items: matchesBySupplier[supplier]})
+		}
+	}
+	if len(ambiguous) == 0 || mode == AmbiguousModeAll {
+		return matches, ambiguous
+	}
+
+	resolved := make([]RecipeMatch, 0, len(matches))
+	seen := map[string]bool{}
+	for _, match := range matches {
+		supplier := match.Recipe.Supplier
+		if len(matchesBySupplier[supplier]) > 1 && (mode == AmbiguousModeSkip || seen[supplier]) {
+			continue
+		}
+		seen[supplier] = true
+		resolved = append(resolved, match)
+	}
+
+	return resolved, ambiguous
+}
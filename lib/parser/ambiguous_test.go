@@ -0,0 +1,71 @@
+package parser
+
+import (
+	"log/slog"
+	"reflect"
+	"testing"
+
+	"buchhalter/lib/vault"
+)
+
+func TestResolveAmbiguousMatches(t *testing.T) {
+	// Two vault items match the domains of the same recipe
+	p := NewRecipeParser(slog.Default(), t.TempDir(), t.TempDir())
+	recipe, err := p.LoadRecipeFile(writeRecipeTestFile(t, "private.json", recipeFileTestJSON))
+	if err != nil {
+		t.Fatalf("LoadRecipeFile() returned error: %s", err)
+	}
+	items := vault.Items{
+		{ID: "item-1", Title: "Private Hosting"},
+		{ID: "item-2", Title: "Private Hosting (2nd account)"},
+	}
+	urlsByItemId := map[string][]string{
+		"item-1": {"https://billing.private-hosting.example/login"},
+		"item-2": {"billing.private-hosting.example"},
+	}
+	matches := []RecipeMatch{}
+	for _, item := range items {
+		if matched := p.GetRecipeForItem(item, urlsByItemId); matched != nil {
+			matches = append(matches, RecipeMatch{Recipe: matched, ItemId: item.ID, ItemTitle: item.Title})
+		}
+	}
+	if len(matches) != 2 {
+		t.Fatalf("GetRecipeForItem() matched %d items; want both", len(matches))
+	}
+	// Another supplier with a single item is never ambiguous
+	matches = append(matches, RecipeMatch{Recipe: &Recipe{Supplier: "hetzner"}, ItemId: "item-3", ItemTitle: "Hetzner"})
+
+	tests := []struct {
+		mode     string
+		expected []string
+	}{
+		{AmbiguousModeAll, []string{"item-1", "item-2", "item-3"}},
+		{AmbiguousModeFirst, []string{"item-1", "item-3"}},
+		{AmbiguousModeSkip, []string{"item-3"}},
+	}
+	for _, test := range tests {
+		resolved, ambiguous := ResolveAmbiguousMatches(matches, test.mode)
+		itemIds := []string{}
+		for _, match := range resolved {
+			itemIds = append(itemIds, match.ItemId)
+		}
+		if !reflect.DeepEqual(itemIds, test.expected) {
+			t.Errorf("%s: ResolveAmbiguousMatches() runs %v; want %v", test.mode, itemIds, test.expected)
+		}
+		if len(ambiguous) != 1 || ambiguous[0].Supplier != recipe.Supplier || len(ambiguous[0].Items) != 2 || ambiguous[0].Items[1].ItemTitle != "Private Hosting (2nd account)" {
+			t.Errorf("%s: ResolveAmbiguousMatches() reported %+v; want the supplier %s with both items", test.mode, ambiguous, recipe.Supplier)
+		}
+	}
+
+	if resolved, ambiguous := ResolveAmbiguousMatches(matches[2:], AmbiguousModeSkip); len(resolved) != 1 || len(ambiguous) != 0 {
+		t.Errorf("ResolveAmbiguousMatches() without ambiguity = %v, %v; want the match and no ambiguity", resolved, ambiguous)
+	}
+	for _, mode := range AmbiguousModes {
+		if !IsSupportedAmbiguousMode(mode) {
+			t.Errorf("IsSupportedAmbiguousMode(%s) = false; want true", mode)
+		}
+	}
+	if IsSupportedAmbiguousMode("random") {
+		t.Errorf("IsSupportedAmbiguousMode(random) = true; want false")
+	}
+}
@@ -0,0 +1,56 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultApprovalTimeout is the time a `waitForApproval` step waits for a push approval without a configured value.
+const DefaultApprovalTimeout = 60 * time.Second
+
+// MaxApprovalTimeout is the maximum time a `waitForApproval` step waits for a push approval.
+const MaxApprovalTimeout = 5 * time.Minute
+
+// ParseApprovalTimeout parses the value of a `waitForApproval` step (the timeout in seconds).
+// An empty value means DefaultApprovalTimeout.
+func ParseApprovalTimeout(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if len(value) == 0 {
+		return DefaultApprovalTimeout, nil
+	}
+
+	seconds, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("timeout `%s` is not a number of seconds", value)
+	}
+	if seconds <= 0 {
+		return 0, fmt.Errorf("timeout %d must be greater than 0", seconds)
+	}
+	timeout := time.Duration(seconds) * time.Second
+	if timeout > MaxApprovalTimeout {
+		return 0, fmt.Errorf("timeout %d exceeds the maximum of %d seconds", seconds, int(MaxApprovalTimeout.Seconds()))
+	}
+
+	return timeout, nil
+}
+
+// validateApprovalStep checks the options of a `waitForApproval` step.
+// The fallback steps (e.g. entering a TOTP code) are validated like the steps of the recipe, they can't wait for another approval.
+func validateApprovalStep(recipe Recipe, number int, step Step) error {
+	if len(strings.TrimSpace(step.Selector)) == 0 {
+		return errors.New("the selector of the element shown after the approval is missing")
+	}
+	if _, err := ParseApprovalTimeout(step.Value); err != nil {
+		return err
+	}
+	for i, fallbackStep := range step.Fallback {
+		if fallbackStep.Action == "waitForApproval" || len(fallbackStep.Fallback) > 0 {
+			return fmt.Errorf("fallback step %d (%s) can't have fallback steps itself", i+1, fallbackStep.Action)
+		}
+	}
+
+	return ValidateRecipe(Recipe{Supplier: fmt.Sprintf("%s (fallback of step %d)", recipe.Supplier, number), Type: recipe.Type, Steps: step.Fallback})
+}
@@ -0,0 +1,70 @@
+package parser
+
+import (
+	"strings"
+
+	"buchhalter/lib/vault"
+)
+
+// Credential fields a recipe can require (see RequiredCredentials)
+const (
+	CredentialUsername = "username"
+	CredentialPassword = "password"
+)
+
+// RequiredCredentials returns the credential fields the steps of recipe use: the `{{ username }}` and `{{ password }}` placeholders,
+// the login form of `oauth2-authenticate` steps (not with the device flow) and the HTTP Basic auth of `httpLogin` steps without a body.
+// The TOTP isn't included, it is generated on demand by the step that needs it.
+func RequiredCredentials(recipe Recipe) []string {
+	required := map[string]bool{}
+	deviceFlow := UsesOauth2DeviceFlow(recipe)
+	var collect func(steps []Step)
+	collect = func(steps []Step) {
+		for _, step := range steps {
+			if (step.Action == actionOauth2Authenticate && !deviceFlow) || (step.Action == actionHTTPLogin && len(strings.TrimSpace(step.Body)) == 0) {
+				required[CredentialUsername] = true
+				required[CredentialPassword] = true
+			}
+			values := []string{step.URL, step.Value, step.Body}
+			for _, value := range step.Headers {
+				values = append(values, value)
+			}
+			for _, value := range values {
+				if strings.Contains(value, "{{ username }}") {
+					required[CredentialUsername] = true
+				}
+				if strings.Contains(value, "{{ password }}") {
+					required[CredentialPassword] = true
+				}
+			}
+			collect(step.Fallback)
+		}
+	}
+	collect(recipe.Steps)
+
+	fields := []string{}
+	for _, field := range []string{CredentialUsername, CredentialPassword} {
+		if required[field] {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// MissingCredentials returns the fields recipe requires (see RequiredCredentials) that are empty in credentials,
+// e.g. to skip a supplier whose vault item has no password instead of running a login that can't succeed.
+func MissingCredentials(recipe Recipe, credentials *vault.Credentials) []string {
+	values := map[string]string{}
+	if credentials != nil {
+		values[CredentialUsername] = credentials.Username
+		values[CredentialPassword] = credentials.Password
+	}
+
+	missing := []string{}
+	for _, field := range RequiredCredentials(recipe) {
+		if len(strings.TrimSpace(values[field])) == 0 {
+			missing = append(missing, field)
+		}
+	}
+	return missing
+}
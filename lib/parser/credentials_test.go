@@ -0,0 +1,59 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	"buchhalter/lib/vault"
+)
+
+func TestRequiredCredentials(t *testing.T) {
+	tests := []struct {
+		name     string
+		recipe   Recipe
+		expected []string
+	}{
+		{"no credentials", Recipe{Type: "browser", Steps: []Step{{Action: "open", URL: "https://example.com"}}}, []string{}},
+		{"placeholders", Recipe{Type: "browser", Steps: []Step{
+			{Action: "type", Selector: "#user", Value: "{{ username }}"},
+			{Action: "type", Selector: "#pass", Value: "{{ password }}"},
+			{Action: "type", Selector: "#otp", Value: "{{ totp }}"},
+		}}, []string{CredentialUsername, CredentialPassword}},
+		{"placeholder in a fallback step", Recipe{Type: "browser", Steps: []Step{
+			{Action: "waitForApproval", Fallback: []Step{{Action: "type", Selector: "#pass", Value: "{{ password }}"}}},
+		}}, []string{CredentialPassword}},
+		{"oauth2 login", Recipe{Type: "client", Steps: []Step{{Action: "oauth2-setup"}, {Action: "oauth2-authenticate"}}}, []string{CredentialUsername, CredentialPassword}},
+		{"oauth2 device flow", Recipe{Type: "client", Steps: []Step{deviceFlowSetupStep(), {Action: "oauth2-authenticate"}}}, []string{}},
+		{"http basic auth", Recipe{Type: "http", Steps: []Step{{Action: "httpLogin", URL: "https://example.com"}}}, []string{CredentialUsername, CredentialPassword}},
+		{"http form login", Recipe{Type: "http", Steps: []Step{{Action: "httpLogin", URL: "https://example.com/login", Body: `{"token":"{{ password }}"}`}}}, []string{CredentialPassword}},
+		{"header", Recipe{Type: "http", Steps: []Step{{Action: "httpGet", URL: "https://example.com/invoices", Headers: map[string]string{"X-Api-Key": "{{ password }}"}}}}, []string{CredentialPassword}},
+	}
+
+	for _, test := range tests {
+		if fields := RequiredCredentials(test.recipe); !reflect.DeepEqual(fields, test.expected) {
+			t.Errorf("%s: RequiredCredentials() = %v; want %v", test.name, fields, test.expected)
+		}
+	}
+}
+
+func TestMissingCredentials(t *testing.T) {
+	recipe := Recipe{Type: "browser", Steps: []Step{
+		{Action: "type", Selector: "#user", Value: "{{ username }}"},
+		{Action: "type", Selector: "#pass", Value: "{{ password }}"},
+	}}
+	tests := []struct {
+		name        string
+		credentials *vault.Credentials
+		expected    []string
+	}{
+		{"complete", &vault.Credentials{Username: "jane", Password: "s3cret"}, []string{}},
+		{"empty password", &vault.Credentials{Username: "jane", Password: "  "}, []string{CredentialPassword}},
+		{"no credentials", nil, []string{CredentialUsername, CredentialPassword}},
+	}
+
+	for _, test := range tests {
+		if missing := MissingCredentials(recipe, test.credentials); !reflect.DeepEqual(missing, test.expected) {
+			t.Errorf("%s: MissingCredentials() = %v; want %v", test.name, missing, test.expected)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package parser
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+
+	"buchhalter/lib/vault"
+)
+
+// UnmatchedItem is a vault item whose urls match no recipe domain, its recipe never runs.
+type UnmatchedItem struct {
+	ItemId    string   `json:"itemId"`
+	ItemTitle string   `json:"itemTitle"`
+	Urls      []string `json:"urls"`
+	// Candidates are the suppliers with a recipe domain of the same site (e.g. `accounts.hetzner.com` for `https://www.hetzner.com`),
+	// the url of the item probably has to be changed to one of their domains
+	Candidates []string `json:"candidates"`
+}
+
+// UnmatchedRecipe is a recipe whose domains match no vault item.
+type UnmatchedRecipe struct {
+	Supplier string   `json:"supplier"`
+	Domains  []string `json:"domains"`
+}
+
+// MatchDiagnosis are the vault items and recipes that were not matched with each other.
+type MatchDiagnosis struct {
+	UnmatchedItems   []UnmatchedItem   `json:"unmatchedItems"`
+	UnmatchedRecipes []UnmatchedRecipe `json:"unmatchedRecipes"`
+}
+
+// DiagnoseMatches returns the vault items that match no recipe and the recipes that match no vault item (see GetRecipeForItem).
+// Vault items pinned to a supplier (`buchhalter_supplier_items`) are matched with its recipe, regardless of their urls.
+// Both lists are sorted case-insensitive (by title and supplier).
+func (p *RecipeParser) DiagnoseMatches(items vault.Items, urlsByItemId map[string][]string, pins ItemPins) MatchDiagnosis {
+	diagnosis := MatchDiagnosis{UnmatchedItems: []UnmatchedItem{}, UnmatchedRecipes: []UnmatchedRecipe{}}
+
+	itemsById := make(map[string]bool, len(items))
+	for _, item := range items {
+		itemsById[item.ID] = true
+	}
+	matchedSuppliers := map[string]bool{}
+	pinnedItems := map[string]bool{}
+	for _, recipe := range p.database.Recipes {
+		if itemId, pinned := pins.ItemFor(recipe.Supplier); pinned && itemsById[itemId] {
+			matchedSuppliers[recipe.Supplier] = true
+			pinnedItems[itemId] = true
+		}
+	}
+
+	for _, item := range items {
+		if recipe := p.GetRecipeForItem(item, urlsByItemId); recipe != nil {
+			matchedSuppliers[recipe.Supplier] = true
+			continue
+		}
+		if pinnedItems[item.ID] {
+			continue
+		}
+		urls := append([]string{}, urlsByItemId[item.ID]...)
+		diagnosis.UnmatchedItems = append(diagnosis.UnmatchedItems, UnmatchedItem{
+			ItemId:     item.ID,
+			ItemTitle:  item.Title,
+			Urls:       urls,
+			Candidates: p.candidateSuppliers(urls),
+		})
+	}
+
+	for _, recipe := range p.database.Recipes {
+		if matchedSuppliers[recipe.Supplier] {
+			continue
+		}
+		diagnosis.UnmatchedRecipes = append(diagnosis.UnmatchedRecipes, UnmatchedRecipe{Supplier: recipe.Supplier, Domains: append([]string{}, recipe.Domains...)})
+	}
+
+	sort.SliceStable(diagnosis.UnmatchedItems, func(i, j int) bool {
+		return strings.ToLower(diagnosis.UnmatchedItems[i].ItemTitle) < strings.ToLower(diagnosis.UnmatchedItems[j].ItemTitle)
+	})
+	sort.SliceStable(diagnosis.UnmatchedRecipes, func(i, j int) bool {
+		return strings.ToLower(diagnosis.UnmatchedRecipes[i].Supplier) < strings.ToLower(diagnosis.UnmatchedRecipes[j].Supplier)
+	})
+
+	return diagnosis
+}
+
+// candidateSuppliers returns the suppliers (sorted) with a recipe domain of the same site as one of urls.
+func (p *RecipeParser) candidateSuppliers(urls []string) []string {
+	sites := map[string]bool{}
+	for _, itemUrl := range urls {
+		if site := siteOf(itemUrl); len(site) > 0 {
+			sites[site] = true
+		}
+	}
+
+	candidates := []string{}
+	seen := map[string]bool{}
+	for _, recipe := range p.database.Recipes {
+		for _, domain := range recipe.Domains {
+			if sites[siteOf(domain)] && !seen[recipe.Supplier] {
+				seen[recipe.Supplier] = true
+				candidates = append(candidates, recipe.Supplier)
+			}
+		}
+	}
+	sort.Strings(candidates)
+	return candidates
+}
+
+// siteOf returns the last two labels of the host of rawUrl (e.g. `hetzner.com` for `https://accounts.hetzner.com/login`).
+// Urls without a scheme (like recipe domains) are accepted, an invalid url returns an empty site.
+func siteOf(rawUrl string) string {
+	rawUrl = strings.TrimSpace(rawUrl)
+	if !strings.Contains(rawUrl, "://") {
+		rawUrl = "https://" + rawUrl
+	}
+	parsedUrl, err := url.Parse(rawUrl)
+	if err != nil {
+		return ""
+	}
+	labels := strings.Split(strings.ToLower(parsedUrl.Hostname()), ".")
+	if len(labels) < 2 {
+		return ""
+	}
+	return strings.Join(labels[len(labels)-2:], ".")
+}
@@ -0,0 +1,78 @@
+package parser
+
+import (
+	"fmt"
+	"log/slog"
+	"testing"
+
+	"buchhalter/lib/vault"
+)
+
+func TestDiagnoseMatches(t *testing.T) {
+	p := NewRecipeParser(slog.Default(), t.TempDir(), t.TempDir())
+	p.database.Recipes = []Recipe{
+		{Supplier: "hetzner", Domains: []string{"accounts.hetzner.com"}},
+		{Supplier: "digitalocean", Domains: []string{"cloud.digitalocean.com"}},
+		{Supplier: "aws", Domains: []string{"signin.aws.amazon.com"}},
+		{Supplier: "Netlify", Domains: []string{"app.netlify.com"}},
+	}
+	for _, recipe := range p.database.Recipes {
+		p.recipeBySupplier[recipe.Supplier] = recipe
+		for _, domain := range recipe.Domains {
+			p.recipeSupplierByDomain[domain] = recipe.Supplier
+		}
+	}
+	items := vault.Items{
+		{ID: "item-1", Title: "Hetzner"},
+		{ID: "item-2", Title: "hetzner website"},
+		{ID: "item-3", Title: "DigitalOcean"},
+		{ID: "item-4", Title: "Amazon"},
+		{ID: "item-5", Title: "Bank"},
+	}
+	urlsByItemId := map[string][]string{
+		"item-1": {"https://accounts.hetzner.com/login"},
+		"item-2": {"https://www.hetzner.com"},
+		"item-3": {"https://cloud.digitalocean.com/login"},
+		"item-5": {"https://bank.example.com"},
+	}
+
+	// The item of aws has no urls, but it is pinned to the supplier
+	diagnosis := p.DiagnoseMatches(items, urlsByItemId, NewItemPins(map[string]string{"aws": "item-4"}))
+
+	expectedItems := []UnmatchedItem{
+		{ItemId: "item-5", ItemTitle: "Bank", Urls: []string{"https://bank.example.com"}, Candidates: []string{}},
+		{ItemId: "item-2", ItemTitle: "hetzner website", Urls: []string{"https://www.hetzner.com"}, Candidates: []string{"hetzner"}},
+	}
+	if fmt.Sprint(diagnosis.UnmatchedItems) != fmt.Sprint(expectedItems) {
+		t.Errorf("DiagnoseMatches() unmatched items = %v; want %v", diagnosis.UnmatchedItems, expectedItems)
+	}
+	expectedRecipes := []UnmatchedRecipe{{Supplier: "Netlify", Domains: []string{"app.netlify.com"}}}
+	if fmt.Sprint(diagnosis.UnmatchedRecipes) != fmt.Sprint(expectedRecipes) {
+		t.Errorf("DiagnoseMatches() unmatched recipes = %v; want %v", diagnosis.UnmatchedRecipes, expectedRecipes)
+	}
+
+	// Without the pin, the item of aws and its recipe are unmatched
+	diagnosis = p.DiagnoseMatches(items, urlsByItemId, NewItemPins(nil))
+	if len(diagnosis.UnmatchedItems) != 3 || len(diagnosis.UnmatchedRecipes) != 2 {
+		t.Errorf("DiagnoseMatches() without pins = %v; want 3 unmatched items and 2 unmatched recipes", diagnosis)
+	}
+}
+
+func TestSiteOf(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"https://accounts.hetzner.com/login", "hetzner.com"},
+		{"accounts.hetzner.com", "hetzner.com"},
+		{"HTTP://WWW.Example.COM:8080/path", "example.com"},
+		{"localhost", ""},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if site := siteOf(test.url); site != test.expected {
+			t.Errorf("siteOf(%q) = %q; want %q", test.url, site, test.expected)
+		}
+	}
+}
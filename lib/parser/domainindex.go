@@ -0,0 +1,105 @@
+package parser
+
+import (
+	"strings"
+)
+
+// domainIndex finds the domains of the recipes that may match a url, instead of matching the url with all domains.
+// The candidates are checked with matchDomain, so the index only has to return all domains that could match (see candidates).
+type domainIndex struct {
+	// prefixes is a trie of the domains matched by prefix (DomainMatchPrefix), keyed by their characters
+	prefixes *prefixTrieNode
+	// hosts are the domains of DomainMatchSubdomain and the wildcard domains by their lower case host (without `www.` and `*.`)
+	hosts map[string][]string
+	// parents are the domains of DomainMatchSubdomain by each of their parent domains (e.g. `example.com` for `portal.example.com`)
+	parents map[string][]string
+}
+
+type prefixTrieNode struct {
+	children map[byte]*prefixTrieNode
+	// domains ending at this node
+	domains []string
+}
+
+// newDomainIndex indexes the domains of recipeSupplierByDomain with the matching modes of their recipes.
+func newDomainIndex(recipeSupplierByDomain map[string]string, recipeBySupplier map[string]Recipe) *domainIndex {
+	index := &domainIndex{
+		prefixes: &prefixTrieNode{},
+		hosts:    map[string][]string{},
+		parents:  map[string][]string{},
+	}
+	for domain, supplier := range recipeSupplierByDomain {
+		if subdomains, ok := strings.CutPrefix(domain, "*."); ok {
+			host, _ := splitDomain(subdomains)
+			index.hosts[host] = append(index.hosts[host], domain)
+			continue
+		}
+		if recipeBySupplier[supplier].DomainMatch != DomainMatchSubdomain {
+			index.prefixes.insert(domain)
+			continue
+		}
+		host, _ := splitDomain(domain)
+		index.hosts[host] = append(index.hosts[host], domain)
+		for parent := host; strings.Contains(parent, "."); {
+			_, parent, _ = strings.Cut(parent, ".")
+			index.parents[parent] = append(index.parents[parent], domain)
+		}
+	}
+	return index
+}
+
+func (n *prefixTrieNode) insert(domain string) {
+	node := n
+	for i := 0; i < len(domain); i++ {
+		if node.children == nil {
+			node.children = map[byte]*prefixTrieNode{}
+		}
+		child, ok := node.children[domain[i]]
+		if !ok {
+			child = &prefixTrieNode{}
+			node.children[domain[i]] = child
+		}
+		node = child
+	}
+	node.domains = append(node.domains, domain)
+}
+
+// collect appends the domains that are a prefix of value to domains.
+func (n *prefixTrieNode) collect(value string, domains []string) []string {
+	node := n
+	for i := 0; ; i++ {
+		domains = append(domains, node.domains...)
+		if i == len(value) {
+			return domains
+		}
+		child, ok := node.children[value[i]]
+		if !ok {
+			return domains
+		}
+		node = child
+	}
+}
+
+// candidates returns the domains that may match itemUrl, a domain might be returned more than once.
+// Prefix domains have to be a prefix of the url after an optional scheme and `www.` (see prefixMatchUrls),
+// the other domains have to be the host of the url or one of its parent domains, or a subdomain of the host (a parent domain match).
+func (i *domainIndex) candidates(itemUrl string) []string {
+	domains := []string{}
+	for _, prefixedUrl := range prefixMatchUrls(itemUrl) {
+		domains = i.prefixes.collect(prefixedUrl, domains)
+	}
+
+	host, _, ok := splitItemUrl(itemUrl)
+	if !ok {
+		return domains
+	}
+	domains = append(domains, i.parents[host]...)
+	for suffix := host; ; {
+		domains = append(domains, i.hosts[suffix]...)
+		var found bool
+		_, suffix, found = strings.Cut(suffix, ".")
+		if !found {
+			return domains
+		}
+	}
+}
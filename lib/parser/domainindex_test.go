@@ -0,0 +1,66 @@
+package parser
+
+import (
+	"testing"
+)
+
+func TestDomainIndexCandidates(t *testing.T) {
+	recipeBySupplier := map[string]Recipe{
+		"prefix":    {Supplier: "prefix", DomainMatch: DomainMatchPrefix},
+		"subdomain": {Supplier: "subdomain", DomainMatch: DomainMatchSubdomain},
+	}
+	recipeSupplierByDomain := map[string]string{
+		"example.com":            "prefix",
+		"www.example.org":        "prefix",
+		"example.net/billing":    "prefix",
+		"*.wildcard.com":         "prefix",
+		"portal.example.io":      "subdomain",
+		"console.example.dev":    "subdomain",
+		"example.de/rechnungen":  "subdomain",
+		"*.eu.example.cloud":     "subdomain",
+		"login.shop.example.biz": "subdomain",
+	}
+	index := newDomainIndex(recipeSupplierByDomain, recipeBySupplier)
+
+	itemUrls := []string{
+		"https://example.com/login",
+		"http://www.example.com",
+		"example.com.evil.org",
+		"https://www.example.org/account",
+		"https://example.org",
+		"https://example.net/billing/2024",
+		"https://example.net/account",
+		"https://eu.wildcard.com",
+		"https://wildcard.com",
+		"https://login.portal.example.io",
+		"https://example.io",
+		"https://io",
+		"HTTPS://Eu-Central-1.Console.Example.DEV/billing",
+		"https://app.example.de/rechnungen/2024",
+		"https://app.example.de/",
+		"https://fra.eu.example.cloud",
+		"https://shop.example.biz",
+		"https://example.biz",
+		"https://",
+		"not a url",
+	}
+
+	// The index has to return all domains the full scan of matchDomain matches
+	for _, itemUrl := range itemUrls {
+		candidates := map[string]bool{}
+		for _, domain := range index.candidates(itemUrl) {
+			candidates[domain] = true
+		}
+		for domain, supplier := range recipeSupplierByDomain {
+			match := matchDomain(domain, recipeBySupplier[supplier].DomainMatch, itemUrl)
+			if match != noDomainMatch && !candidates[domain] {
+				t.Errorf("candidates(%q) is missing the matching domain %s", itemUrl, domain)
+			}
+		}
+	}
+
+	// Domains of other hosts are no candidates
+	for _, domain := range index.candidates("https://unrelated.example.co.uk/login") {
+		t.Errorf("candidates() of an unrelated url returned %s", domain)
+	}
+}
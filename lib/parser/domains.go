@@ -0,0 +1,144 @@
+package parser
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Matching modes of the domains of a recipe with the urls of vault items (`domainMatch`)
+const (
+	// DomainMatchPrefix matches urls starting with a domain (after the scheme and an optional `www.`), e.g. `example.com/login` for `example.com`.
+	// It is the default of recipes without a mode.
+	DomainMatchPrefix = "prefix"
+	// DomainMatchSubdomain matches the host of urls with a domain, its subdomains and its parent domains,
+	// e.g. `login.example.com` and `example.com` for `portal.example.com`.
+	// A path of the domain (e.g. `example.com/billing`) has to be the path of the url or one of its parents (e.g. not `/billing-archive`).
+	DomainMatchSubdomain = "subdomain"
+)
+
+// DomainMatchModes are the supported values of `domainMatch`.
+var DomainMatchModes = []string{DomainMatchPrefix, DomainMatchSubdomain}
+
+// domainMatch ranks how well a url matches a domain of a recipe, a higher rank is the better match.
+type domainMatch int
+
+const (
+	noDomainMatch domainMatch = iota
+	// parentDomainMatch is a url of a parent domain (e.g. `example.com` for `portal.example.com`)
+	parentDomainMatch
+	// domainMatched is a url of the domain itself or one of its subdomains
+	domainMatched
+)
+
+// IsSupportedDomainMatch returns true if mode is a supported `domainMatch` of a recipe, an empty mode is DomainMatchPrefix.
+func IsSupportedDomainMatch(mode string) bool {
+	if len(mode) == 0 {
+		return true
+	}
+	for _, supportedMode := range DomainMatchModes {
+		if mode == supportedMode {
+			return true
+		}
+	}
+	return false
+}
+
+// validateDomain checks a domain of a recipe, a wildcard is only supported as first label (e.g. `*.example.com`).
+func validateDomain(domain string) error {
+	if len(strings.TrimSpace(domain)) == 0 {
+		return fmt.Errorf("domain is empty")
+	}
+	if strings.Contains(strings.TrimPrefix(domain, "*."), "*") {
+		return fmt.Errorf("domain `%s` has a wildcard, which is only supported as first label (e.g. `*.example.com`)", domain)
+	}
+	return nil
+}
+
+// matchDomain returns how itemUrl matches domain of a recipe with the matching mode (see DomainMatchModes).
+// A wildcard domain (e.g. `*.example.com`) only matches the subdomains, independent of the mode.
+func matchDomain(domain, mode, itemUrl string) domainMatch {
+	if subdomains, ok := strings.CutPrefix(domain, "*."); ok {
+		host, path, ok := splitItemUrl(itemUrl)
+		domainHost, domainPath := splitDomain(subdomains)
+		if ok && strings.HasSuffix(host, "."+domainHost) && matchPath(path, domainPath) {
+			return domainMatched
+		}
+		return noDomainMatch
+	}
+
+	if mode != DomainMatchSubdomain {
+		for _, prefixedUrl := range prefixMatchUrls(itemUrl) {
+			if strings.HasPrefix(prefixedUrl, domain) {
+				return domainMatched
+			}
+		}
+		return noDomainMatch
+	}
+
+	host, path, ok := splitItemUrl(itemUrl)
+	domainHost, domainPath := splitDomain(domain)
+	if !ok || !matchPath(path, domainPath) {
+		return noDomainMatch
+	}
+	switch {
+	case host == domainHost || strings.HasSuffix(host, "."+domainHost):
+		return domainMatched
+	// A single label (e.g. `com`) is no parent domain
+	case strings.Contains(host, ".") && strings.HasSuffix(domainHost, "."+host):
+		return parentDomainMatch
+	}
+	return noDomainMatch
+}
+
+// matchPath returns true if path is domainPath or below it (e.g. `/billing/2024` for `/billing`), an empty domainPath matches any path.
+func matchPath(path, domainPath string) bool {
+	domainPath = strings.TrimSuffix(domainPath, "/")
+	if len(domainPath) == 0 {
+		return true
+	}
+	return path == domainPath || strings.HasPrefix(path, domainPath+"/")
+}
+
+// prefixMatchUrls returns itemUrl with and without its scheme (`http://` or `https://`) and `www.`,
+// a domain matched by prefix (DomainMatchPrefix) has to be a prefix of one of them.
+func prefixMatchUrls(itemUrl string) []string {
+	urls := []string{itemUrl}
+	if withoutScheme, ok := strings.CutPrefix(itemUrl, "https://"); ok {
+		urls = append(urls, withoutScheme)
+	} else if withoutScheme, ok := strings.CutPrefix(itemUrl, "http://"); ok {
+		urls = append(urls, withoutScheme)
+	}
+	for _, u := range urls {
+		if withoutWWW, ok := strings.CutPrefix(u, "www."); ok {
+			urls = append(urls, withoutWWW)
+		}
+	}
+	return urls
+}
+
+// splitItemUrl returns the lower case host (without `www.`) and the path of itemUrl, urls without a scheme are accepted.
+func splitItemUrl(itemUrl string) (string, string, bool) {
+	itemUrl = strings.TrimSpace(itemUrl)
+	if !strings.Contains(itemUrl, "://") {
+		itemUrl = "https://" + itemUrl
+	}
+	parsedUrl, err := url.Parse(itemUrl)
+	if err != nil || len(parsedUrl.Hostname()) == 0 {
+		return "", "", false
+	}
+	path := parsedUrl.Path
+	if len(path) == 0 {
+		path = "/"
+	}
+	return strings.TrimPrefix(strings.ToLower(parsedUrl.Hostname()), "www."), path, true
+}
+
+// splitDomain returns the lower case host (without `www.`) and the path prefix of a domain of a recipe (empty without a path).
+func splitDomain(domain string) (string, string) {
+	host, path, found := strings.Cut(strings.TrimSpace(domain), "/")
+	if found {
+		path = "/" + path
+	}
+	return strings.TrimPrefix(strings.ToLower(host), "www."), path
+}
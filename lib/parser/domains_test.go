@@ -0,0 +1,117 @@
+package parser
+
+import (
+	"log/slog"
+	"testing"
+
+	"buchhalter/lib/vault"
+)
+
+func TestMatchDomain(t *testing.T) {
+	tests := []struct {
+		name     string
+		domain   string
+		mode     string
+		itemUrl  string
+		expected domainMatch
+	}{
+		{"prefix", "example.com", "", "https://example.com/login", domainMatched},
+		{"prefix without scheme", "example.com", DomainMatchPrefix, "example.com", domainMatched},
+		{"prefix with www", "example.com", "", "https://www.example.com/login", domainMatched},
+		{"prefix of www domain", "www.example.com", "", "https://www.example.com", domainMatched},
+		{"prefix with path", "example.com/billing", "", "https://example.com/billing/invoices", domainMatched},
+		{"prefix of other path", "example.com/billing", "", "https://example.com/account", noDomainMatch},
+		{"prefix of subdomain", "example.com", "", "https://login.example.com", noDomainMatch},
+		{"prefix of parent domain", "portal.example.com", "", "https://example.com", noDomainMatch},
+		{"subdomain itself", "example.com", DomainMatchSubdomain, "https://example.com", domainMatched},
+		{"subdomain with www", "example.com", DomainMatchSubdomain, "https://www.example.com/", domainMatched},
+		{"subdomain of domain", "example.com", DomainMatchSubdomain, "https://login.example.com/sign-in", domainMatched},
+		{"regional subdomain", "console.example.com", DomainMatchSubdomain, "https://eu-central-1.console.example.com/billing", domainMatched},
+		{"subdomain case insensitive", "example.com", DomainMatchSubdomain, "HTTPS://Login.Example.COM", domainMatched},
+		{"subdomain with trailing path", "example.com", DomainMatchSubdomain, "login.example.com/de/account?tab=invoices", domainMatched},
+		{"parent domain", "portal.example.com", DomainMatchSubdomain, "https://example.com", parentDomainMatch},
+		{"parent domain with www", "portal.example.com", DomainMatchSubdomain, "https://www.example.com", parentDomainMatch},
+		{"top level domain is no parent", "portal.example.com", DomainMatchSubdomain, "https://com", noDomainMatch},
+		{"other domain ending", "example.com", DomainMatchSubdomain, "https://myexample.com", noDomainMatch},
+		{"other domain with prefix", "example.com", DomainMatchSubdomain, "https://example.com.evil.org", noDomainMatch},
+		{"subdomain with path", "example.com/billing", DomainMatchSubdomain, "https://app.example.com/billing/2024", domainMatched},
+		{"subdomain of other path", "example.com/billing", DomainMatchSubdomain, "https://app.example.com/", noDomainMatch},
+		{"subdomain with exact path", "example.com/billing", DomainMatchSubdomain, "https://app.example.com/billing", domainMatched},
+		{"subdomain with trailing slash of path", "example.com/billing/", DomainMatchSubdomain, "https://app.example.com/billing", domainMatched},
+		{"subdomain of path with the same prefix", "example.com/billing", DomainMatchSubdomain, "https://app.example.com/billing-archive", noDomainMatch},
+		{"wildcard subdomain", "*.example.com", "", "https://eu.example.com/login", domainMatched},
+		{"wildcard subdomain of path with the same prefix", "*.example.com/billing", "", "https://eu.example.com/billing-archive", noDomainMatch},
+		{"wildcard without subdomain", "*.example.com", DomainMatchSubdomain, "https://example.com", noDomainMatch},
+		{"invalid url", "example.com", DomainMatchSubdomain, "https://", noDomainMatch},
+	}
+
+	for _, test := range tests {
+		if match := matchDomain(test.domain, test.mode, test.itemUrl); match != test.expected {
+			t.Errorf("%s: matchDomain(%q, %q, %q) = %d; want %d", test.name, test.domain, test.mode, test.itemUrl, match, test.expected)
+		}
+	}
+}
+
+func TestGetRecipeForItemBestMatch(t *testing.T) {
+	p := NewRecipeParser(slog.Default(), t.TempDir(), t.TempDir())
+	recipes := []Recipe{
+		{Supplier: "example", Domains: []string{"example.com"}, DomainMatch: DomainMatchSubdomain},
+		{Supplier: "example-portal", Domains: []string{"portal.example.com"}, DomainMatch: DomainMatchSubdomain},
+		{Supplier: "other", Domains: []string{"billing.other.org"}, DomainMatch: DomainMatchSubdomain},
+	}
+	for _, recipe := range recipes {
+		p.recipeBySupplier[recipe.Supplier] = recipe
+		for _, domain := range recipe.Domains {
+			p.recipeSupplierByDomain[domain] = recipe.Supplier
+		}
+	}
+
+	tests := []struct {
+		itemUrl  string
+		expected string
+	}{
+		// The longest matching domain wins
+		{"https://portal.example.com/login", "example-portal"},
+		{"https://eu.portal.example.com", "example-portal"},
+		{"https://www.example.com", "example"},
+		// A parent domain only matches, if no domain matches
+		{"https://other.org", "other"},
+		{"https://unknown.net", ""},
+	}
+	for _, test := range tests {
+		recipe := p.GetRecipeForItem(vault.Item{ID: "item"}, map[string][]string{"item": {test.itemUrl}})
+		supplier := ""
+		if recipe != nil {
+			supplier = recipe.Supplier
+		}
+		if supplier != test.expected {
+			t.Errorf("GetRecipeForItem(%s) = %q; want %q", test.itemUrl, supplier, test.expected)
+		}
+	}
+}
+
+func TestValidateRecipeDomains(t *testing.T) {
+	tests := []struct {
+		name        string
+		recipe      Recipe
+		expectError bool
+	}{
+		{"default mode", Recipe{Domains: []string{"example.com"}}, false},
+		{"subdomain mode", Recipe{Domains: []string{"example.com/billing"}, DomainMatch: DomainMatchSubdomain}, false},
+		{"unsupported mode", Recipe{Domains: []string{"example.com"}, DomainMatch: "suffix"}, true},
+		{"wildcard", Recipe{Domains: []string{"*.example.com"}}, false},
+		{"wildcard in the middle", Recipe{Domains: []string{"login.*.example.com"}}, true},
+		{"empty domain", Recipe{Domains: []string{" "}}, true},
+	}
+
+	for _, test := range tests {
+		test.recipe.Supplier = "example"
+		err := ValidateRecipe(test.recipe)
+		if test.expectError && err == nil {
+			t.Errorf("%s: ValidateRecipe() returned no error; want an error", test.name)
+		}
+		if !test.expectError && err != nil {
+			t.Errorf("%s: ValidateRecipe() returned error %v; want no error", test.name, err)
+		}
+	}
+}
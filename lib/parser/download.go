@@ -0,0 +1,60 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Defaults of `downloadAll` steps, friendly to the rate limits of most portals
+const (
+	DefaultDownloadConcurrency   = 2
+	DefaultDownloadSleepDuration = 1500 * time.Millisecond
+)
+
+// ValidateDownloadConcurrency checks the number of concurrent downloads (e.g. of `buchhalter_download_concurrency`).
+func ValidateDownloadConcurrency(concurrency int) error {
+	if concurrency < 1 {
+		return fmt.Errorf("concurrency %d must be at least 1", concurrency)
+	}
+	return nil
+}
+
+// ValidateMaxFiles checks the maximum number of downloaded documents of a recipe or step, `nil` (the configured default) and `0` (all documents) are valid.
+func ValidateMaxFiles(maxFiles *int) error {
+	if maxFiles != nil && *maxFiles < 0 {
+		return fmt.Errorf("maxFiles %d must not be negative", *maxFiles)
+	}
+	return nil
+}
+
+// validateDownloadStep checks the options of a `downloadAll` step.
+// Unset options (0) fall back to the defaults.
+func validateDownloadStep(step Step) error {
+	if step.Concurrency != 0 {
+		if err := ValidateDownloadConcurrency(step.Concurrency); err != nil {
+			return err
+		}
+	}
+	if step.SleepDuration < 0 {
+		return fmt.Errorf("sleepDuration %d must not be negative", step.SleepDuration)
+	}
+	return nil
+}
+
+// validateFetchDownloadStep checks the options of a `fetchDownload` step.
+// The value is the script returning the requests, headers are the static headers of all requests.
+func validateFetchDownloadStep(step Step) error {
+	if len(strings.TrimSpace(step.Value)) == 0 {
+		return fmt.Errorf("value (the script returning the download requests) is missing")
+	}
+	if step.SleepDuration < 0 {
+		return fmt.Errorf("sleepDuration %d must not be negative", step.SleepDuration)
+	}
+	for name := range step.Headers {
+		if len(strings.TrimSpace(name)) == 0 {
+			return fmt.Errorf("header name must not be empty")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// frameActions are the browser actions that can be executed inside an iframe.
+var frameActions = map[string]bool{
+	"click":         true,
+	"type":          true,
+	"waitFor":       true,
+	"downloadAll":   true,
+	"downloadHrefs": true,
+}
+
+// FrameReference is a parsed `frame` option of a recipe step.
+// An iframe is referenced either by its (zero-based) position on the page or by its name / id attribute.
+type FrameReference struct {
+	Index int
+	Name  string
+}
+
+// ParseFrameReference parses the `frame` option of a recipe step.
+// A number (e.g. `0`) references the iframe by its position, everything else by its name or id.
+func ParseFrameReference(frame string) (FrameReference, error) {
+	frame = strings.TrimSpace(frame)
+	if len(frame) == 0 {
+		return FrameReference{}, fmt.Errorf("frame reference is empty")
+	}
+
+	index, err := strconv.Atoi(frame)
+	if err != nil {
+		return FrameReference{Index: -1, Name: frame}, nil
+	}
+	if index < 0 {
+		return FrameReference{}, fmt.Errorf("frame index %d must not be negative", index)
+	}
+
+	return FrameReference{Index: index}, nil
+}
+
+// validateStepFrame checks the `frame` option of a step, if it is set.
+func validateStepFrame(step Step) error {
+	if len(step.Frame) == 0 {
+		return nil
+	}
+
+	if !frameActions[step.Action] {
+		return fmt.Errorf("action %s doesn't support the frame option", step.Action)
+	}
+
+	_, err := ParseFrameReference(step.Frame)
+	return err
+}
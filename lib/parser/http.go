@@ -0,0 +1,71 @@
+package parser
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Actions of `http` recipes, they run without a browser
+const (
+	// actionHTTPLogin sends the login form of `body` to `url` (cookies are kept for the following steps).
+	// Without a body, the following requests are sent with HTTP Basic auth.
+	actionHTTPLogin = "httpLogin"
+	// actionHTTPGet downloads the document of `url`, see DefaultHTTPGetMonths for templated urls.
+	actionHTTPGet = "httpGet"
+)
+
+// httpActions are the supported actions of `http` recipes.
+var httpActions = []string{actionHTTPLogin, actionHTTPGet, "move"}
+
+// DefaultHTTPGetMonths is the number of months a `httpGet` step with `{{ year }}` or `{{ month }}` in its url requests without `months`
+// (the current month and the months before).
+const DefaultHTTPGetMonths = 3
+
+// validateHTTPStep checks a step of a recipe, the http actions are only supported by `http` recipes and vice versa.
+func validateHTTPStep(recipe Recipe, step Step) error {
+	isHTTPAction := step.Action == actionHTTPLogin || step.Action == actionHTTPGet
+	if recipe.Type != "http" {
+		if isHTTPAction {
+			return fmt.Errorf("action %s is only supported by http recipes", step.Action)
+		}
+		if step.Months != 0 {
+			return fmt.Errorf("`months` is only supported by %s", actionHTTPGet)
+		}
+		return nil
+	}
+
+	supported := false
+	for _, action := range httpActions {
+		if step.Action == action {
+			supported = true
+		}
+	}
+	if !supported {
+		return fmt.Errorf("action %s is not supported by http recipes (supported: %s)", step.Action, strings.Join(httpActions, ", "))
+	}
+	if !isHTTPAction {
+		return nil
+	}
+
+	if len(strings.TrimSpace(step.URL)) == 0 {
+		return fmt.Errorf("url is missing")
+	}
+	if step.Months < 0 {
+		return fmt.Errorf("months %d must not be negative", step.Months)
+	}
+	if step.Months != 0 && step.Action != actionHTTPGet {
+		return fmt.Errorf("`months` is only supported by %s", actionHTTPGet)
+	}
+	switch strings.ToUpper(step.Method) {
+	case "", http.MethodGet, http.MethodPost:
+	default:
+		return fmt.Errorf("method `%s` is not supported (supported: GET, POST)", step.Method)
+	}
+	for name := range step.Headers {
+		if len(strings.TrimSpace(name)) == 0 {
+			return fmt.Errorf("header name must not be empty")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package parser
+
+import (
+	"testing"
+)
+
+func TestValidateHTTPRecipe(t *testing.T) {
+	expectLogout := "Logout"
+	tests := []struct {
+		name        string
+		recipeType  string
+		steps       []Step
+		expectError bool
+	}{
+		{"form login", "http", []Step{
+			{Action: "httpLogin", URL: "https://example.com/login", Body: "user={{ username }}&pass={{ password }}", Expect: &expectLogout},
+			{Action: "httpGet", URL: "https://example.com/invoices/{{ year }}-{{ month }}.pdf", Months: 12},
+			{Action: "move", Value: ".*\\.pdf"},
+		}, false},
+		{"basic auth", "http", []Step{{Action: "httpLogin", URL: "https://example.com/", Method: "get"}, {Action: "httpGet", URL: "https://example.com/invoice.pdf"}}, false},
+		{"browser action", "http", []Step{{Action: "open", URL: "https://example.com"}}, true},
+		{"missing url", "http", []Step{{Action: "httpGet"}}, true},
+		{"unsupported method", "http", []Step{{Action: "httpGet", URL: "https://example.com/invoice.pdf", Method: "DELETE"}}, true},
+		{"negative months", "http", []Step{{Action: "httpGet", URL: "https://example.com/{{ month }}.pdf", Months: -1}}, true},
+		{"months of login", "http", []Step{{Action: "httpLogin", URL: "https://example.com/login", Months: 2}}, true},
+		{"http action in browser recipe", "browser", []Step{{Action: "httpGet", URL: "https://example.com/invoice.pdf"}}, true},
+	}
+
+	for _, test := range tests {
+		err := ValidateRecipe(Recipe{Supplier: "example", Type: test.recipeType, Steps: test.steps})
+		if test.expectError && err == nil {
+			t.Errorf("%s: ValidateRecipe() returned no error; want an error", test.name)
+		}
+		if !test.expectError && err != nil {
+			t.Errorf("%s: ValidateRecipe() returned error %v; want no error", test.name, err)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package parser
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Actions of the OAuth2 client that request a list of items (and download the documents of the items).
+// `oauth2-post-and-get-items` is the former name of `oauth2-request-items`, both are supported.
+const (
+	actionOauth2RequestItems    = "oauth2-request-items"
+	actionOauth2PostAndGetItems = "oauth2-post-and-get-items"
+
+	defaultItemsRequestMethod    = http.MethodPost
+	itemsRequestMethodsSupported = "GET, POST, PUT"
+)
+
+// IsItemsAction returns true, if action requests a list of items.
+func IsItemsAction(action string) bool {
+	return action == actionOauth2RequestItems || action == actionOauth2PostAndGetItems
+}
+
+// ItemsRequestMethod returns the HTTP method of the item requests of step (default POST).
+func ItemsRequestMethod(step Step) string {
+	method := strings.ToUpper(strings.TrimSpace(step.Method))
+	if len(method) == 0 {
+		return defaultItemsRequestMethod
+	}
+	return method
+}
+
+// ItemsRequestHasBody returns true, if the item requests of step send the body.
+func ItemsRequestHasBody(step Step) bool {
+	method := ItemsRequestMethod(step)
+	return method == http.MethodPost || method == http.MethodPut
+}
+
+// validateItemsStep checks the options of an items step.
+func validateItemsStep(step Step) error {
+	switch ItemsRequestMethod(step) {
+	case http.MethodGet, http.MethodPost, http.MethodPut:
+	default:
+		return fmt.Errorf("method `%s` is not supported (supported: %s)", step.Method, itemsRequestMethodsSupported)
+	}
+	if !ItemsRequestHasBody(step) && (len(step.Body) > 0 || len(step.NextPageBody) > 0) {
+		return fmt.Errorf("method `%s` doesn't send a body, remove `body` and `nextPageBody`", ItemsRequestMethod(step))
+	}
+	for _, path := range []string{step.ExtractDocumentIds, step.ExtractDocumentFilenames, step.NextPagePath} {
+		if IsJSONPath(path) {
+			if _, err := ParseJSONPath(path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
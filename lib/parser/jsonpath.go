@@ -0,0 +1,473 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// IsJSONPath returns true, if path of a client recipe (e.g. `extractDocumentIds`) is a JSONPath (starts with `$`).
+// Other paths use the dot notation, which searches the keys recursively.
+func IsJSONPath(path string) bool {
+	return strings.HasPrefix(strings.TrimSpace(path), "$")
+}
+
+// JSONPath is a parsed JSONPath expression, e.g. `$.invoices[*].id` or `$.data[0].pdf`.
+// Supported are child keys (`.key`, `['key']`), wildcards (`.*`, `[*]`), recursive descent (`..key`),
+// indexes (`[0]`, `[-1]`, `[0,2]`), slices (`[1:3]`) and filters with a comparison (`[?(@.status == 'paid')]`) or an existence check (`[?(@.pdf)]`).
+type JSONPath struct {
+	path     string
+	segments []jsonPathSegment
+}
+
+type jsonPathSegmentKind int
+
+const (
+	jsonPathKey jsonPathSegmentKind = iota
+	jsonPathWildcard
+	jsonPathIndexes
+	jsonPathSlice
+	jsonPathFilter
+)
+
+type jsonPathSegment struct {
+	kind jsonPathSegmentKind
+	// recursive segments (`..`) match on all levels below the current nodes
+	recursive bool
+	key       string
+	indexes   []int
+	// start and end of a slice, nil for the beginning / end of the array
+	start, end *int
+	filter     *jsonPathFilterExpression
+}
+
+// jsonPathFilterExpression is the expression of a filter: `@.path`, optionally compared with a literal.
+type jsonPathFilterExpression struct {
+	keys     []string
+	operator string
+	value    interface{}
+}
+
+// ParseJSONPath parses a JSONPath expression, see JSONPath for the supported syntax.
+func ParseJSONPath(path string) (JSONPath, error) {
+	path = strings.TrimSpace(path)
+	if !IsJSONPath(path) {
+		return JSONPath{}, fmt.Errorf("JSONPath `%s` doesn't start with `$`", path)
+	}
+
+	p := &jsonPathParser{path: path, pos: 1}
+	segments := []jsonPathSegment{}
+	for p.pos < len(path) {
+		segment, err := p.segment()
+		if err != nil {
+			return JSONPath{}, fmt.Errorf("invalid JSONPath `%s`: %w", path, err)
+		}
+		segments = append(segments, segment)
+	}
+
+	return JSONPath{path: path, segments: segments}, nil
+}
+
+// Select returns the nodes of data matching the path, in document order.
+// Keys that don't exist and indexes out of range match nothing.
+func (j JSONPath) Select(data interface{}) []interface{} {
+	nodes := []interface{}{data}
+	for _, segment := range j.segments {
+		selected := []interface{}{}
+		for _, node := range nodes {
+			if segment.recursive {
+				for _, descendant := range jsonPathDescendants(node) {
+					selected = append(selected, segment.apply(descendant)...)
+				}
+				continue
+			}
+			selected = append(selected, segment.apply(node)...)
+		}
+		nodes = selected
+	}
+	return nodes
+}
+
+// String returns the expression of the path.
+func (j JSONPath) String() string {
+	return j.path
+}
+
+// apply returns the children of node matching the segment.
+func (s jsonPathSegment) apply(node interface{}) []interface{} {
+	switch s.kind {
+	case jsonPathKey:
+		if object, ok := node.(map[string]interface{}); ok {
+			if value, ok := object[s.key]; ok {
+				return []interface{}{value}
+			}
+		}
+	case jsonPathWildcard:
+		return jsonPathChildren(node)
+	case jsonPathIndexes:
+		array, ok := node.([]interface{})
+		if !ok {
+			return nil
+		}
+		selected := []interface{}{}
+		for _, index := range s.indexes {
+			if index < 0 {
+				index += len(array)
+			}
+			if index >= 0 && index < len(array) {
+				selected = append(selected, array[index])
+			}
+		}
+		return selected
+	case jsonPathSlice:
+		array, ok := node.([]interface{})
+		if !ok {
+			return nil
+		}
+		start, end := 0, len(array)
+		if s.start != nil {
+			start = jsonPathSliceBound(*s.start, len(array))
+		}
+		if s.end != nil {
+			end = jsonPathSliceBound(*s.end, len(array))
+		}
+		if start >= end {
+			return nil
+		}
+		return append([]interface{}{}, array[start:end]...)
+	case jsonPathFilter:
+		selected := []interface{}{}
+		for _, child := range jsonPathChildren(node) {
+			if s.filter.matches(child) {
+				selected = append(selected, child)
+			}
+		}
+		return selected
+	}
+	return nil
+}
+
+func jsonPathSliceBound(bound, length int) int {
+	if bound < 0 {
+		bound += length
+	}
+	return min(max(bound, 0), length)
+}
+
+// jsonPathChildren returns the values of an object (sorted by key) or the items of an array.
+func jsonPathChildren(node interface{}) []interface{} {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		children := make([]interface{}, 0, len(v))
+		for _, key := range jsonPathSortedKeys(v) {
+			children = append(children, v[key])
+		}
+		return children
+	case []interface{}:
+		return v
+	}
+	return nil
+}
+
+// jsonPathSortedKeys returns the keys of object, sorted for a stable order of wildcards.
+func jsonPathSortedKeys(object map[string]interface{}) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// jsonPathDescendants returns node and all nodes below it, in document order.
+func jsonPathDescendants(node interface{}) []interface{} {
+	descendants := []interface{}{node}
+	for _, child := range jsonPathChildren(node) {
+		descendants = append(descendants, jsonPathDescendants(child)...)
+	}
+	return descendants
+}
+
+func (f *jsonPathFilterExpression) matches(node interface{}) bool {
+	value := node
+	for _, key := range f.keys {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if value, ok = object[key]; !ok {
+			return false
+		}
+	}
+	if len(f.operator) == 0 {
+		return value != nil
+	}
+
+	switch expected := f.value.(type) {
+	case float64:
+		actual, ok := value.(float64)
+		if !ok {
+			return f.operator == "!="
+		}
+		switch f.operator {
+		case "==":
+			return actual == expected
+		case "!=":
+			return actual != expected
+		case "<":
+			return actual < expected
+		case "<=":
+			return actual <= expected
+		case ">":
+			return actual > expected
+		case ">=":
+			return actual >= expected
+		}
+	case string:
+		actual, ok := value.(string)
+		if !ok {
+			return f.operator == "!="
+		}
+		switch f.operator {
+		case "==":
+			return actual == expected
+		case "!=":
+			return actual != expected
+		case "<":
+			return actual < expected
+		case "<=":
+			return actual <= expected
+		case ">":
+			return actual > expected
+		case ">=":
+			return actual >= expected
+		}
+	default:
+		// Booleans and null only support (in)equality
+		switch f.operator {
+		case "==":
+			return value == expected
+		case "!=":
+			return value != expected
+		}
+	}
+	return false
+}
+
+type jsonPathParser struct {
+	path string
+	pos  int
+}
+
+func (p *jsonPathParser) segment() (jsonPathSegment, error) {
+	switch {
+	case strings.HasPrefix(p.path[p.pos:], ".."):
+		p.pos += 2
+		if p.pos < len(p.path) && p.path[p.pos] == '[' {
+			segment, err := p.bracket()
+			segment.recursive = true
+			return segment, err
+		}
+		segment, err := p.dotKey()
+		segment.recursive = true
+		return segment, err
+	case p.path[p.pos] == '.':
+		p.pos++
+		return p.dotKey()
+	case p.path[p.pos] == '[':
+		return p.bracket()
+	}
+	return jsonPathSegment{}, fmt.Errorf("unexpected `%c` at position %d", p.path[p.pos], p.pos+1)
+}
+
+// dotKey parses the key of `.key` or `.*`.
+func (p *jsonPathParser) dotKey() (jsonPathSegment, error) {
+	start := p.pos
+	for p.pos < len(p.path) && p.path[p.pos] != '.' && p.path[p.pos] != '[' {
+		p.pos++
+	}
+	key := p.path[start:p.pos]
+	switch key {
+	case "":
+		return jsonPathSegment{}, fmt.Errorf("missing key at position %d", start+1)
+	case "*":
+		return jsonPathSegment{kind: jsonPathWildcard}, nil
+	}
+	return jsonPathSegment{kind: jsonPathKey, key: key}, nil
+}
+
+// bracket parses `[...]`: a quoted key, a wildcard, indexes, a slice or a filter.
+func (p *jsonPathParser) bracket() (jsonPathSegment, error) {
+	start := p.pos
+	end := p.closingBracket()
+	if end < 0 {
+		return jsonPathSegment{}, fmt.Errorf("missing `]` for `[` at position %d", start+1)
+	}
+	content := strings.TrimSpace(p.path[start+1 : end])
+	p.pos = end + 1
+
+	switch {
+	case content == "*":
+		return jsonPathSegment{kind: jsonPathWildcard}, nil
+	case strings.HasPrefix(content, "?"):
+		filter, err := parseJSONPathFilter(content)
+		if err != nil {
+			return jsonPathSegment{}, err
+		}
+		return jsonPathSegment{kind: jsonPathFilter, filter: filter}, nil
+	case strings.HasPrefix(content, "'") || strings.HasPrefix(content, `"`):
+		key, err := unquoteJSONPathString(content)
+		if err != nil {
+			return jsonPathSegment{}, err
+		}
+		return jsonPathSegment{kind: jsonPathKey, key: key}, nil
+	case strings.Contains(content, ":"):
+		bounds := strings.Split(content, ":")
+		if len(bounds) != 2 {
+			return jsonPathSegment{}, fmt.Errorf("invalid slice `[%s]` (steps are not supported)", content)
+		}
+		segment := jsonPathSegment{kind: jsonPathSlice}
+		for i, bound := range bounds {
+			bound = strings.TrimSpace(bound)
+			if len(bound) == 0 {
+				continue
+			}
+			value, err := strconv.Atoi(bound)
+			if err != nil {
+				return jsonPathSegment{}, fmt.Errorf("invalid slice `[%s]`", content)
+			}
+			if i == 0 {
+				segment.start = &value
+			} else {
+				segment.end = &value
+			}
+		}
+		return segment, nil
+	}
+
+	segment := jsonPathSegment{kind: jsonPathIndexes}
+	for _, index := range strings.Split(content, ",") {
+		value, err := strconv.Atoi(strings.TrimSpace(index))
+		if err != nil {
+			return jsonPathSegment{}, fmt.Errorf("invalid index `[%s]` (keys must be quoted)", content)
+		}
+		segment.indexes = append(segment.indexes, value)
+	}
+	return segment, nil
+}
+
+// closingBracket returns the position of the `]` closing the bracket at the current position, brackets in quoted strings are skipped.
+func (p *jsonPathParser) closingBracket() int {
+	var quote byte
+	depth := 0
+	for i := p.pos; i < len(p.path); i++ {
+		c := p.path[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+var jsonPathOperators = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+// parseJSONPathFilter parses a filter `?(@.key op literal)` or `?(@.key)`.
+func parseJSONPathFilter(content string) (*jsonPathFilterExpression, error) {
+	expression := strings.TrimSpace(strings.TrimPrefix(content, "?"))
+	if !strings.HasPrefix(expression, "(") || !strings.HasSuffix(expression, ")") {
+		return nil, fmt.Errorf("filter `[%s]` must be enclosed in parentheses", content)
+	}
+	expression = strings.TrimSpace(expression[1 : len(expression)-1])
+
+	filter := &jsonPathFilterExpression{}
+	left := expression
+	if i, operator := jsonPathOperatorIndex(expression); i >= 0 {
+		filter.operator = operator
+		left = strings.TrimSpace(expression[:i])
+		value, err := parseJSONPathLiteral(strings.TrimSpace(expression[i+len(operator):]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter `[%s]`: %w", content, err)
+		}
+		filter.value = value
+	}
+
+	if left != "@" && !strings.HasPrefix(left, "@.") {
+		return nil, fmt.Errorf("filter `[%s]` must start with `@`", content)
+	}
+	if left != "@" {
+		for _, key := range strings.Split(strings.TrimPrefix(left, "@."), ".") {
+			if len(key) == 0 {
+				return nil, fmt.Errorf("filter `[%s]` has an empty key", content)
+			}
+			filter.keys = append(filter.keys, key)
+		}
+	}
+	return filter, nil
+}
+
+// jsonPathOperatorIndex returns the position and the first comparison operator of a filter expression, -1 for none.
+func jsonPathOperatorIndex(expression string) (int, string) {
+	for i := 0; i < len(expression); i++ {
+		if expression[i] == '\'' || expression[i] == '"' {
+			// The literal is the right side, operators in quoted strings don't count
+			return -1, ""
+		}
+		for _, operator := range jsonPathOperators {
+			if strings.HasPrefix(expression[i:], operator) {
+				return i, operator
+			}
+		}
+	}
+	return -1, ""
+}
+
+// parseJSONPathLiteral parses a literal of a filter: a quoted string, a number, true, false or null.
+func parseJSONPathLiteral(literal string) (interface{}, error) {
+	switch literal {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	if strings.HasPrefix(literal, "'") || strings.HasPrefix(literal, `"`) {
+		return unquoteJSONPathString(literal)
+	}
+	number, err := strconv.ParseFloat(literal, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid literal `%s` (strings must be quoted)", literal)
+	}
+	return number, nil
+}
+
+// unquoteJSONPathString returns the value of a string in single or double quotes.
+func unquoteJSONPathString(quoted string) (string, error) {
+	if len(quoted) < 2 || quoted[0] != quoted[len(quoted)-1] {
+		return "", fmt.Errorf("unterminated string %s", quoted)
+	}
+	if quoted[0] == '\'' {
+		// strconv only supports double quotes for strings
+		quoted = `"` + strings.ReplaceAll(strings.ReplaceAll(quoted[1:len(quoted)-1], `\'`, `'`), `"`, `\"`) + `"`
+	}
+	value, err := strconv.Unquote(quoted)
+	if err != nil {
+		return "", fmt.Errorf("invalid string %s", quoted)
+	}
+	return value, nil
+}
@@ -0,0 +1,95 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+const jsonPathTestDocument = `{
+	"data": [
+		{"id": "a1", "status": "paid", "total": 10.5, "pdf": "https://example.com/a1.pdf", "lines": [{"id": "l1"}, {"id": "l2"}]},
+		{"id": "a2", "status": "open", "total": 99, "lines": []},
+		{"id": "a3", "status": "paid", "total": 120, "pdf": null, "lines": [{"id": "l3"}]}
+	],
+	"meta": {"next": "page-2", "id": "meta-id", "ids": ["x", "y"]},
+	"matrix": [[1, 2], [3, 4]],
+	"odd key": "value"
+}`
+
+func TestJSONPathSelect(t *testing.T) {
+	var data interface{}
+	if err := json.Unmarshal([]byte(jsonPathTestDocument), &data); err != nil {
+		t.Fatalf("error decoding document: %s", err)
+	}
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"$", fmt.Sprint([]interface{}{data})},
+		{"$.data[*].id", "[a1 a2 a3]"},
+		{"$.data[0].pdf", "[https://example.com/a1.pdf]"},
+		{"$.data[-1].id", "[a3]"},
+		{"$.data[0,2].id", "[a1 a3]"},
+		{"$.data[1:].id", "[a2 a3]"},
+		{"$.data[:-1].id", "[a1 a2]"},
+		{"$['odd key']", "[value]"},
+		{`$["meta"]["next"]`, "[page-2]"},
+		{"$.meta.ids", "[[x y]]"},
+		{"$.meta.*", "[meta-id [x y] page-2]"},
+		// Nested arrays
+		{"$.data[*].lines[*].id", "[l1 l2 l3]"},
+		{"$.matrix[1][0]", "[3]"},
+		{"$.matrix[*][1]", "[2 4]"},
+		// Recursive descent matches on all levels, in document order
+		{"$..id", "[a1 l1 l2 a2 a3 l3 meta-id]"},
+		{"$.data..lines[0].id", "[l1 l3]"},
+		// Filters
+		{"$.data[?(@.status == 'paid')].id", "[a1 a3]"},
+		{`$.data[?(@.status != "paid")].id`, "[a2]"},
+		{"$.data[?(@.total >= 99)].id", "[a2 a3]"},
+		{"$.data[?(@.total < 99)].id", "[a1]"},
+		{"$.data[?(@.pdf)].id", "[a1]"},
+		{"$.data[?(@.pdf == null)].id", "[a3]"},
+		{"$.data[?(@.lines)].lines[?(@.id == 'l3')].id", "[l3]"},
+		// Missing keys and indexes out of range match nothing
+		{"$.missing", "[]"},
+		{"$.data[*].missing", "[]"},
+		{"$.data[3].id", "[]"},
+		{"$.data[-4].id", "[]"},
+		{"$.meta[0]", "[]"},
+		{"$.data.id", "[]"},
+	}
+
+	for _, test := range tests {
+		path, err := ParseJSONPath(test.path)
+		if err != nil {
+			t.Errorf("ParseJSONPath(%q) returned error: %s", test.path, err)
+			continue
+		}
+		if selected := fmt.Sprint(path.Select(data)); selected != test.expected {
+			t.Errorf("JSONPath(%q).Select() = %s; want %s", test.path, selected, test.expected)
+		}
+	}
+}
+
+func TestParseJSONPathErrors(t *testing.T) {
+	for _, path := range []string{
+		"data[*].id",
+		"$.",
+		"$.data[",
+		"$.data[abc]",
+		"$.data[1:2:3]",
+		"$.data['id]",
+		"$.data[?@.id]",
+		"$.data[?(id == 'a')]",
+		"$.data[?(@.total > abc)]",
+		"$.data[?(@..id)]",
+		"$data",
+	} {
+		if _, err := ParseJSONPath(path); err == nil {
+			t.Errorf("ParseJSONPath(%q) returned no error", path)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Recipe linter
+// Heuristic checks to find brittle patterns in recipes before they break.
+
+type LintSeverity string
+
+const (
+	LintSeverityError   LintSeverity = "error"
+	LintSeverityWarning LintSeverity = "warning"
+	LintSeverityInfo    LintSeverity = "info"
+)
+
+const (
+	LintRuleMissingSelector         = "missing-selector"
+	LintRuleLongXPath               = "long-xpath"
+	LintRuleTextSearchSelector      = "text-search-selector"
+	LintRuleInferredSelectorType    = "inferred-selector-type"
+	LintRuleUnsupportedSelectorType = "unsupported-selector-type"
+	LintRuleClickWithoutWaitFor     = "click-without-waitfor"
+	LintRuleSleepTiming             = "sleep-timing"
+
+	// lintMaxXPathDepth is the number of path segments an absolute XPath may have before it is considered brittle.
+	lintMaxXPathDepth = 6
+)
+
+// LintFinding represents a single issue found by the recipe linter.
+type LintFinding struct {
+	Supplier string       `json:"supplier"`
+	Step     int          `json:"step"`
+	Action   string       `json:"action"`
+	Rule     string       `json:"rule"`
+	Severity LintSeverity `json:"severity"`
+	Message  string       `json:"message"`
+}
+
+func (f LintFinding) String() string {
+	return fmt.Sprintf("[%s] %s step %d (%s): %s", f.Severity, f.Supplier, f.Step, f.Action, f.Message)
+}
+
+// selectorActions are the browser actions that operate on a selector.
+var selectorActions = map[string]bool{
+	"click":         true,
+	"type":          true,
+	"waitFor":       true,
+	"pollFor":       true,
+	"downloadAll":   true,
+	"downloadHrefs": true,
+	"removeElement": true,
+}
+
+// LintRecipe checks a recipe for brittle patterns and returns all findings.
+// Step numbers in the findings start with 1.
+func LintRecipe(recipe Recipe) []LintFinding {
+	findings := []LintFinding{}
+
+	for i, step := range recipe.Steps {
+		newFinding := func(rule string, severity LintSeverity, message string) LintFinding {
+			return LintFinding{
+				Supplier: recipe.Supplier,
+				Step:     i + 1,
+				Action:   step.Action,
+				Rule:     rule,
+				Severity: severity,
+				Message:  message,
+			}
+		}
+
+		if selectorActions[step.Action] {
+			selector := strings.TrimSpace(step.Selector)
+			if len(selector) == 0 {
+				findings = append(findings, newFinding(LintRuleMissingSelector, LintSeverityError, "step has no selector"))
+				continue
+			}
+
+			if depth := absoluteXPathDepth(selector); depth > lintMaxXPathDepth {
+				findings = append(findings, newFinding(LintRuleLongXPath, LintSeverityWarning, fmt.Sprintf("absolute XPath with %d segments breaks on small layout changes, use a shorter relative XPath or a CSS selector", depth)))
+			}
+
+			if len(step.SelectorType) == 0 {
+				if inferredSelectorType := InferSelectorType(selector); len(inferredSelectorType) > 0 {
+					findings = append(findings, newFinding(LintRuleInferredSelectorType, LintSeverityInfo, fmt.Sprintf("selector `%s` has no selectorType, `%s` is inferred", selector, inferredSelectorType)))
+				} else {
+					findings = append(findings, newFinding(LintRuleTextSearchSelector, LintSeverityWarning, fmt.Sprintf("selector `%s` has no selectorType and falls back to a text search, which might match unintended nodes", selector)))
+				}
+			}
+		}
+
+		if !IsSupportedSelectorType(step.SelectorType) {
+			findings = append(findings, newFinding(LintRuleUnsupportedSelectorType, LintSeverityError, fmt.Sprintf("selectorType `%s` is not supported", step.SelectorType)))
+		}
+
+		if step.Action == "click" && (i == 0 || (recipe.Steps[i-1].Action != "waitFor" && recipe.Steps[i-1].Action != "pollFor")) {
+			findings = append(findings, newFinding(LintRuleClickWithoutWaitFor, LintSeverityInfo, "click is not preceded by a waitFor or pollFor step, the element might not be ready yet"))
+		}
+
+		if step.Action == "sleep" && i+1 < len(recipe.Steps) && selectorActions[recipe.Steps[i+1].Action] {
+			findings = append(findings, newFinding(LintRuleSleepTiming, LintSeverityInfo, fmt.Sprintf("sleep before a %s step could be replaced by a waitFor (or a pollFor for generated documents) on `%s`", recipe.Steps[i+1].Action, recipe.Steps[i+1].Selector)))
+		}
+	}
+
+	return findings
+}
+
+// absoluteXPathDepth returns the number of path segments of an absolute XPath (e.g. /html/body/div[2]).
+// Slashes inside predicates and string literals (e.g. `a[@href='/a/b']`) don't separate segments.
+// Relative XPaths (starting with //) and other selectors return 0.
+func absoluteXPathDepth(selector string) int {
+	if !strings.HasPrefix(selector, "/") || strings.HasPrefix(selector, "//") {
+		return 0
+	}
+
+	depth := 0
+	for _, segment := range strings.Split(stripXPathPredicates(selector), "/") {
+		if len(segment) > 0 {
+			depth++
+		}
+	}
+	return depth
+}
+
+// stripXPathPredicates returns selector without its `[...]` predicates (incl. nested ones) and quoted string literals.
+func stripXPathPredicates(selector string) string {
+	stripped := strings.Builder{}
+	predicateDepth := 0
+	var quote rune
+	for _, r := range selector {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '[':
+			predicateDepth++
+		case r == ']' && predicateDepth > 0:
+			predicateDepth--
+		case predicateDepth == 0:
+			stripped.WriteRune(r)
+		}
+	}
+	return stripped.String()
+}
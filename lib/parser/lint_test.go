@@ -0,0 +1,142 @@
+package parser
+
+import (
+	"testing"
+)
+
+func TestLintRecipe(t *testing.T) {
+	tests := []struct {
+		name          string
+		steps         []Step
+		expectedRules []string
+	}{
+		{
+			name: "clean recipe",
+			steps: []Step{
+				{Action: "open", URL: "https://example.com/login"},
+				{Action: "waitFor", Selector: "#login", SelectorType: "Query"},
+				{Action: "click", Selector: "#login", SelectorType: "Query"},
+			},
+			expectedRules: []string{},
+		},
+		{
+			name: "missing selector",
+			steps: []Step{
+				{Action: "waitFor", Selector: " ", SelectorType: "Query"},
+			},
+			expectedRules: []string{LintRuleMissingSelector},
+		},
+		{
+			name: "long absolute xpath",
+			steps: []Step{
+				{Action: "waitFor", Selector: "/html/body/div[2]/div/main/section[3]/table/tbody/tr[1]", SelectorType: "Search"},
+			},
+			expectedRules: []string{LintRuleLongXPath},
+		},
+		{
+			name: "absolute xpath with slashes in a predicate",
+			steps: []Step{
+				{Action: "waitFor", Selector: "/html/body/a[@href='/a/b/c/d/e']", SelectorType: "Search"},
+			},
+			expectedRules: []string{},
+		},
+		{
+			name: "short relative xpath",
+			steps: []Step{
+				{Action: "waitFor", Selector: "//table//tr/td/a/span/b/i", SelectorType: "Search"},
+			},
+			expectedRules: []string{},
+		},
+		{
+			name: "text search selector",
+			steps: []Step{
+				{Action: "waitFor", Selector: "Download invoice"},
+			},
+			expectedRules: []string{LintRuleTextSearchSelector},
+		},
+		{
+			name: "inferred selector type",
+			steps: []Step{
+				{Action: "waitFor", Selector: "#invoices"},
+			},
+			expectedRules: []string{LintRuleInferredSelectorType},
+		},
+		{
+			name: "unsupported selector type",
+			steps: []Step{
+				{Action: "waitFor", Selector: "//a", SelectorType: "Xpath"},
+			},
+			expectedRules: []string{LintRuleUnsupportedSelectorType},
+		},
+		{
+			name: "click without waitFor",
+			steps: []Step{
+				{Action: "open", URL: "https://example.com/login"},
+				{Action: "click", Selector: "#login", SelectorType: "Query"},
+			},
+			expectedRules: []string{LintRuleClickWithoutWaitFor},
+		},
+		{
+			name: "click after pollFor",
+			steps: []Step{
+				{Action: "pollFor", Selector: "a.download", SelectorType: "Query", Value: "120"},
+				{Action: "click", Selector: "a.download", SelectorType: "Query"},
+			},
+			expectedRules: []string{},
+		},
+		{
+			name: "sleep before selector action",
+			steps: []Step{
+				{Action: "sleep", Value: "5"},
+				{Action: "waitFor", Selector: "#invoices", SelectorType: "Query"},
+			},
+			expectedRules: []string{LintRuleSleepTiming},
+		},
+		{
+			name: "sleep at the end",
+			steps: []Step{
+				{Action: "sleep", Value: "5"},
+			},
+			expectedRules: []string{},
+		},
+	}
+
+	for _, test := range tests {
+		recipe := Recipe{Supplier: "example", Steps: test.steps}
+		findings := LintRecipe(recipe)
+
+		if len(findings) != len(test.expectedRules) {
+			t.Errorf("%s: LintRecipe() returned %d findings (%v); want %d", test.name, len(findings), findings, len(test.expectedRules))
+			continue
+		}
+		for i, finding := range findings {
+			if finding.Rule != test.expectedRules[i] {
+				t.Errorf("%s: finding %d has rule %s; want %s", test.name, i, finding.Rule, test.expectedRules[i])
+			}
+			if finding.Supplier != "example" {
+				t.Errorf("%s: finding %d has supplier %s; want example", test.name, i, finding.Supplier)
+			}
+		}
+	}
+}
+
+func TestAbsoluteXPathDepth(t *testing.T) {
+	tests := []struct {
+		selector string
+		expected int
+	}{
+		{"/html/body/div[2]", 3},
+		{"/html/body/a[@href='/a/b/c']", 3},
+		{`/html/body/a[@href="/invoices/2024/05.pdf"]/span`, 4},
+		{"/html/body/div[a[contains(@href, '/x/y')]]/a", 4},
+		{"/html/body/a[text()='1 ] /2']/b", 4},
+		{"//table//tr/td", 0},
+		{"#invoices", 0},
+	}
+
+	for _, test := range tests {
+		if depth := absoluteXPathDepth(test.selector); depth != test.expected {
+			t.Errorf("absoluteXPathDepth(%q) = %d; want %d", test.selector, depth, test.expected)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// actionOauth2Authenticate is the login step of client recipes.
+const actionOauth2Authenticate = "oauth2-authenticate"
+
+// LoginRecipe returns a copy of recipe that only runs the steps up to and including the login, e.g. to check the credentials of a supplier (`sync --login-only`).
+// The login of browser recipes is the first step with `loggedIn` (see browserLoginStep without one), the login of client recipes
+// is the `oauth2-authenticate` step and the login of http recipes is the `httpLogin` step.
+func LoginRecipe(recipe *Recipe) (*Recipe, error) {
+	loginStep := -1
+	for i, step := range recipe.Steps {
+		if step.LoggedIn || (recipe.Type == "client" && step.Action == actionOauth2Authenticate) || (recipe.Type == "http" && step.Action == actionHTTPLogin) {
+			loginStep = i
+			break
+		}
+	}
+	if loginStep < 0 && recipe.Type != "client" && recipe.Type != "http" {
+		loginStep = browserLoginStep(recipe.Steps)
+	}
+	if loginStep >= 0 {
+		loginRecipe := *recipe
+		loginRecipe.Steps = append([]Step{}, recipe.Steps[:loginStep+1]...)
+		return &loginRecipe, nil
+	}
+
+	if recipe.Type == "client" {
+		return nil, fmt.Errorf("recipe of supplier `%s` has no %s step", recipe.Supplier, actionOauth2Authenticate)
+	}
+	if recipe.Type == "http" {
+		return nil, fmt.Errorf("recipe of supplier `%s` has no %s step", recipe.Supplier, actionHTTPLogin)
+	}
+	return nil, fmt.Errorf("recipe of supplier `%s` doesn't mark the step that confirms the login (`\"loggedIn\": true`)", recipe.Supplier)
+}
+
+// browserLoginStep returns the index of the login of browser recipes without a `loggedIn` step, -1 without a login.
+// The login is the last `type` step with the password (or TOTP), followed by the click submitting it
+// and the `waitFor` or `pollFor` step after the click (e.g. on the dashboard), if there is one.
+func browserLoginStep(steps []Step) int {
+	loginStep := -1
+	for i, step := range steps {
+		if step.Action == "type" && (strings.Contains(step.Value, "{{ password }}") || strings.Contains(step.Value, "{{ totp }}")) {
+			loginStep = i
+		}
+	}
+	if loginStep < 0 {
+		return -1
+	}
+	if loginStep+1 < len(steps) && steps[loginStep+1].Action == "click" {
+		loginStep++
+	}
+	if loginStep+1 < len(steps) && (steps[loginStep+1].Action == "waitFor" || steps[loginStep+1].Action == "pollFor") {
+		loginStep++
+	}
+	return loginStep
+}
@@ -0,0 +1,123 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeDriver runs the steps of a recipe against a fake portal: the click after the password logs in,
+// steps after the login only succeed when logged in and download steps download the invoices.
+type fakeDriver struct {
+	executed   []string
+	loggedIn   bool
+	downloaded int
+}
+
+func (d *fakeDriver) run(recipe *Recipe) {
+	passwordTyped := false
+	for _, step := range recipe.Steps {
+		d.executed = append(d.executed, step.Action)
+		switch step.Action {
+		case "type":
+			passwordTyped = passwordTyped || strings.Contains(step.Value, "{{ password }}")
+		case "click":
+			d.loggedIn = d.loggedIn || passwordTyped
+		case "oauth2-authenticate", "httpLogin":
+			d.loggedIn = true
+		case "downloadAll", "oauth2-request-items", "httpGet":
+			if d.loggedIn {
+				d.downloaded++
+			}
+		}
+	}
+}
+
+// runLoginRecipe runs the login recipe of recipe with a fake driver and returns it.
+func runLoginRecipe(t *testing.T, recipe *Recipe) (*fakeDriver, error) {
+	t.Helper()
+
+	loginRecipe, err := LoginRecipe(recipe)
+	if err != nil {
+		return nil, err
+	}
+	driver := &fakeDriver{}
+	driver.run(loginRecipe)
+	return driver, nil
+}
+
+func TestLoginRecipe(t *testing.T) {
+	browserRecipe := &Recipe{Supplier: "example", Type: "browser", Steps: []Step{
+		{Action: "open", URL: "https://example.com/login"},
+		{Action: "type", Selector: "#user", Value: "{{ username }}"},
+		{Action: "type", Selector: "#pass", Value: "{{ password }}"},
+		{Action: "click", Selector: "#submit"},
+		{Action: "waitFor", Selector: "#dashboard", LoggedIn: true},
+		{Action: "open", URL: "https://example.com/invoices"},
+		{Action: "downloadAll", Selector: "a.invoice"},
+		{Action: "move"},
+	}}
+	clientRecipe := &Recipe{Supplier: "api", Type: "client", Steps: []Step{
+		{Action: "oauth2-setup"},
+		{Action: "oauth2-check-tokens"},
+		{Action: "oauth2-authenticate"},
+		{Action: "oauth2-request-items"},
+	}}
+
+	tests := []struct {
+		name    string
+		recipe  *Recipe
+		want    []string
+		wantErr string
+	}{
+		{name: "browser recipe stops at the loggedIn step", recipe: browserRecipe, want: []string{"open", "type", "type", "click", "waitFor"}},
+		{name: "client recipe stops at oauth2-authenticate", recipe: clientRecipe, want: []string{"oauth2-setup", "oauth2-check-tokens", "oauth2-authenticate"}},
+		{name: "browser recipe without login", recipe: &Recipe{Supplier: "unmarked", Type: "browser", Steps: []Step{{Action: "open"}, {Action: "downloadAll"}}}, wantErr: "loggedIn"},
+		{name: "browser recipe without loggedIn step stops after the submit", recipe: &Recipe{Supplier: "unmarked", Type: "browser", Steps: []Step{
+			{Action: "open", URL: "https://example.com/login"},
+			{Action: "type", Selector: "#user", Value: "{{ username }}"},
+			{Action: "type", Selector: "#pass", Value: "{{ password }}"},
+			{Action: "click", Selector: "#submit"},
+			{Action: "waitFor", Selector: "#dashboard"},
+			{Action: "downloadAll", Selector: "a.invoice"},
+		}}, want: []string{"open", "type", "type", "click", "waitFor"}},
+		{name: "browser recipe without loggedIn step and a TOTP", recipe: &Recipe{Supplier: "unmarked", Type: "browser", Steps: []Step{
+			{Action: "type", Selector: "#pass", Value: "{{ password }}"},
+			{Action: "click", Selector: "#submit"},
+			{Action: "type", Selector: "#code", Value: "{{ totp }}"},
+			{Action: "click", Selector: "#verify"},
+			{Action: "open", URL: "https://example.com/invoices"},
+			{Action: "downloadAll", Selector: "a.invoice"},
+		}}, want: []string{"type", "click", "type", "click"}},
+		{name: "http recipe stops at httpLogin", recipe: &Recipe{Supplier: "tiny", Type: "http", Steps: []Step{{Action: "httpLogin"}, {Action: "httpGet"}, {Action: "move"}}}, want: []string{"httpLogin"}},
+		{name: "http recipe without httpLogin", recipe: &Recipe{Supplier: "public", Type: "http", Steps: []Step{{Action: "httpGet"}, {Action: "move"}}}, wantErr: "httpLogin"},
+		{name: "client recipe without oauth2-authenticate", recipe: &Recipe{Supplier: "unmarked", Type: "client", Steps: []Step{{Action: "oauth2-request-items"}}}, wantErr: "oauth2-authenticate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driver, err := runLoginRecipe(t, tt.recipe)
+			if len(tt.wantErr) > 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("LoginRecipe() error = %v; want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoginRecipe() returned error: %s", err)
+			}
+			if !reflect.DeepEqual(driver.executed, tt.want) {
+				t.Errorf("executed steps = %v; want %v", driver.executed, tt.want)
+			}
+			// The login is checked, but no invoices are downloaded
+			if !driver.loggedIn || driver.downloaded > 0 {
+				t.Errorf("logged in = %t, downloaded %d times; want a login without downloads", driver.loggedIn, driver.downloaded)
+			}
+		})
+	}
+
+	// The steps of the recipe itself are kept
+	if len(browserRecipe.Steps) != 8 {
+		t.Errorf("LoginRecipe() modified the steps of the recipe: %d steps left", len(browserRecipe.Steps))
+	}
+}
@@ -0,0 +1,122 @@
+package parser
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"buchhalter/lib/utils"
+	"buchhalter/lib/vault"
+)
+
+// MatchCache keeps the recipes matched with the vault items by their urls (see GetRecipeForItem) between runs.
+// An entry is valid for the version of the vault item and its urls, a cache of another OICDB version is discarded.
+type MatchCache struct {
+	mu      sync.Mutex
+	file    string
+	changed bool
+	// seen are the items looked up since the cache was loaded, the other items are removed by Save (e.g. deleted vault items)
+	seen map[string]bool
+
+	OicdbVersion string                       `json:"oicdbVersion"`
+	Items        map[string]cachedRecipeMatch `json:"items"`
+}
+
+type cachedRecipeMatch struct {
+	Version  int    `json:"version"`
+	UrlsHash string `json:"urlsHash"`
+	// Supplier is the supplier of the matched recipe, empty if no recipe matches the item
+	Supplier string `json:"supplier"`
+}
+
+// LoadMatchCache reads the match cache of oicdbVersion from file.
+// Without a file or with a cache of another OICDB version, an empty cache is returned, it is stored in file by Save.
+func LoadMatchCache(file, oicdbVersion string) (*MatchCache, error) {
+	cache := &MatchCache{
+		file:         file,
+		OicdbVersion: oicdbVersion,
+		Items:        map[string]cachedRecipeMatch{},
+		seen:         map[string]bool{},
+	}
+
+	content, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return cache, nil
+	}
+	if err != nil {
+		return cache, fmt.Errorf("error reading match cache %s: %w", file, err)
+	}
+
+	stored := MatchCache{}
+	if err := json.Unmarshal(content, &stored); err != nil {
+		return cache, fmt.Errorf("error parsing match cache %s: %w", file, err)
+	}
+	if stored.OicdbVersion != oicdbVersion {
+		return cache, nil
+	}
+	for itemId, match := range stored.Items {
+		cache.Items[itemId] = match
+	}
+
+	return cache, nil
+}
+
+// supplierFor returns the cached supplier of item with urls, false if the item is not cached or has changed since.
+func (c *MatchCache) supplierFor(item vault.Item, urls []string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.seen[item.ID] = true
+	match, ok := c.Items[item.ID]
+	if !ok || match.Version != item.Version || match.UrlsHash != hashUrls(urls) {
+		return "", false
+	}
+	return match.Supplier, true
+}
+
+// store caches the supplier of the recipe matched with item, an empty supplier for no match.
+func (c *MatchCache) store(item vault.Item, urls []string, supplier string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.Items[item.ID] = cachedRecipeMatch{Version: item.Version, UrlsHash: hashUrls(urls), Supplier: supplier}
+	c.changed = true
+}
+
+// Save writes the cache to its file, if it was changed since it was loaded.
+// If items were looked up, the items that weren't are removed.
+func (c *MatchCache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for itemId := range c.Items {
+		if len(c.seen) > 0 && !c.seen[itemId] {
+			delete(c.Items, itemId)
+			c.changed = true
+		}
+	}
+	if !c.changed {
+		return nil
+	}
+	content, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding match cache: %w", err)
+	}
+	if err := utils.WriteFileAtomic(c.file, content, 0600); err != nil {
+		return fmt.Errorf("error writing match cache %s: %w", c.file, err)
+	}
+	c.changed = false
+
+	return nil
+}
+
+// hashUrls returns a hash of the urls of a vault item, so the cached urls are not readable from the cache file.
+func hashUrls(urls []string) string {
+	hash := sha256.Sum256([]byte(strings.Join(urls, "\n")))
+	return hex.EncodeToString(hash[:])
+}
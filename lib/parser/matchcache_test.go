@@ -0,0 +1,81 @@
+package parser
+
+import (
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"buchhalter/lib/vault"
+)
+
+func TestMatchCache(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "cache", "matches-vault.json")
+	urlsByItemId := map[string][]string{
+		"hetzner-item": {"https://accounts.hetzner.com/login"},
+		"other-item":   {"https://unknown.example.org"},
+	}
+	items := vault.Items{{ID: "hetzner-item", Version: 3}, {ID: "other-item", Version: 1}}
+
+	newParser := func(cache *MatchCache) *RecipeParser {
+		p := NewRecipeParser(slog.Default(), t.TempDir(), t.TempDir())
+		p.recipeBySupplier["hetzner"] = Recipe{Supplier: "hetzner", Domains: []string{"accounts.hetzner.com"}}
+		p.recipeSupplierByDomain["accounts.hetzner.com"] = "hetzner"
+		p.SetMatchCache(cache)
+		return p
+	}
+
+	cache, err := LoadMatchCache(file, "1.0.0")
+	if err != nil {
+		t.Fatalf("LoadMatchCache() returned error: %s", err)
+	}
+	p := newParser(cache)
+	for _, item := range items {
+		p.GetRecipeForItem(item, urlsByItemId)
+	}
+	if err := cache.Save(); err != nil {
+		t.Fatalf("Save() returned error: %s", err)
+	}
+
+	tests := []struct {
+		name             string
+		oicdbVersion     string
+		item             vault.Item
+		urls             []string
+		expectedSupplier string
+		expectedCached   bool
+	}{
+		{"cached match", "1.0.0", items[0], urlsByItemId["hetzner-item"], "hetzner", true},
+		{"cached item without match", "1.0.0", items[1], urlsByItemId["other-item"], "", true},
+		{"new item version", "1.0.0", vault.Item{ID: "hetzner-item", Version: 4}, urlsByItemId["hetzner-item"], "", false},
+		{"changed urls", "1.0.0", items[0], []string{"https://www.hetzner.com"}, "", false},
+		{"new OICDB version", "1.1.0", items[0], urlsByItemId["hetzner-item"], "", false},
+		{"unknown item", "1.0.0", vault.Item{ID: "new-item"}, nil, "", false},
+	}
+	for _, test := range tests {
+		loaded, err := LoadMatchCache(file, test.oicdbVersion)
+		if err != nil {
+			t.Fatalf("%s: LoadMatchCache() returned error: %s", test.name, err)
+		}
+		supplier, cached := loaded.supplierFor(test.item, test.urls)
+		if cached != test.expectedCached || supplier != test.expectedSupplier {
+			t.Errorf("%s: supplierFor() = %q, %t; want %q, %t", test.name, supplier, cached, test.expectedSupplier, test.expectedCached)
+		}
+	}
+
+	// A cached match is used without matching the urls again
+	cache, _ = LoadMatchCache(file, "1.0.0")
+	p = newParser(cache)
+	p.recipeSupplierByDomain = map[string]string{}
+	if recipe := p.GetRecipeForItem(items[0], urlsByItemId); recipe == nil || recipe.Supplier != "hetzner" {
+		t.Errorf("GetRecipeForItem() with cache = %v; want the cached recipe hetzner", recipe)
+	}
+
+	// Items that are not looked up anymore (e.g. deleted vault items) are removed
+	if err := cache.Save(); err != nil {
+		t.Fatalf("Save() returned error: %s", err)
+	}
+	cache, _ = LoadMatchCache(file, "1.0.0")
+	if _, ok := cache.Items["other-item"]; ok {
+		t.Errorf("Save() kept the item, that was not looked up")
+	}
+}
@@ -0,0 +1,30 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultNetworkIdleTimeout is the maximum time a `waitForNetworkIdle` step waits without a configured value.
+const DefaultNetworkIdleTimeout = 10 * time.Second
+
+// ParseNetworkIdleTimeout parses the value of a `waitForNetworkIdle` step (the timeout in seconds).
+// An empty value means DefaultNetworkIdleTimeout.
+func ParseNetworkIdleTimeout(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if len(value) == 0 {
+		return DefaultNetworkIdleTimeout, nil
+	}
+
+	seconds, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("timeout `%s` is not a number of seconds", value)
+	}
+	if seconds <= 0 {
+		return 0, fmt.Errorf("timeout %d must be greater than 0", seconds)
+	}
+
+	return time.Duration(seconds) * time.Second, nil
+}
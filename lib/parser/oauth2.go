@@ -0,0 +1,48 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// actionOauth2Setup configures the OAuth2 client of client recipes (`oauth2` options of the step).
+const actionOauth2Setup = "oauth2-setup"
+
+// OAuth2 flows of `oauth2-authenticate` steps (`oauth2.flow` of the oauth2-setup step)
+const (
+	// Oauth2FlowAuthorizationCode logs in via the login form of the provider in the browser (with PKCE)
+	Oauth2FlowAuthorizationCode = "authorizationCode"
+	// Oauth2FlowDevice is the device authorization grant (RFC 8628): the user confirms a code on the verification page of the provider,
+	// no login form is filled in
+	Oauth2FlowDevice = "device"
+)
+
+// Oauth2Flows are the supported OAuth2 flows.
+var Oauth2Flows = []string{Oauth2FlowAuthorizationCode, Oauth2FlowDevice}
+
+// validateOauth2SetupStep checks the OAuth2 flow of an oauth2-setup step, the device flow needs the device authorization and token endpoints.
+func validateOauth2SetupStep(step Step) error {
+	switch step.Oauth2.Flow {
+	case "", Oauth2FlowAuthorizationCode:
+		return nil
+	case Oauth2FlowDevice:
+		if len(strings.TrimSpace(step.Oauth2.DeviceAuthUrl)) == 0 {
+			return fmt.Errorf("`oauth2.deviceAuthUrl` is required by the %s flow", Oauth2FlowDevice)
+		}
+		if len(strings.TrimSpace(step.Oauth2.TokenUrl)) == 0 {
+			return fmt.Errorf("`oauth2.tokenUrl` is required by the %s flow", Oauth2FlowDevice)
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported `oauth2.flow` `%s` (supported: %s)", step.Oauth2.Flow, strings.Join(Oauth2Flows, ", "))
+}
+
+// UsesOauth2DeviceFlow returns true if the oauth2-setup step of recipe selects the device flow.
+func UsesOauth2DeviceFlow(recipe Recipe) bool {
+	for _, step := range recipe.Steps {
+		if step.Action == actionOauth2Setup && step.Oauth2.Flow == Oauth2FlowDevice {
+			return true
+		}
+	}
+	return false
+}
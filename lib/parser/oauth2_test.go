@@ -0,0 +1,40 @@
+package parser
+
+import "testing"
+
+// deviceFlowSetupStep returns an oauth2-setup step with the device flow.
+func deviceFlowSetupStep() Step {
+	step := Step{Action: "oauth2-setup"}
+	step.Oauth2.Flow = Oauth2FlowDevice
+	step.Oauth2.DeviceAuthUrl = "https://login.example.com/device"
+	step.Oauth2.TokenUrl = "https://login.example.com/token"
+	return step
+}
+
+func TestValidateOauth2SetupStep(t *testing.T) {
+	withoutDeviceUrl := deviceFlowSetupStep()
+	withoutDeviceUrl.Oauth2.DeviceAuthUrl = ""
+	withoutTokenUrl := deviceFlowSetupStep()
+	withoutTokenUrl.Oauth2.TokenUrl = " "
+	unsupported := deviceFlowSetupStep()
+	unsupported.Oauth2.Flow = "implicit"
+
+	tests := []struct {
+		name          string
+		step          Step
+		expectedError bool
+	}{
+		{"default flow", Step{Action: "oauth2-setup"}, false},
+		{"device flow", deviceFlowSetupStep(), false},
+		{"device flow without device url", withoutDeviceUrl, true},
+		{"device flow without token url", withoutTokenUrl, true},
+		{"unsupported flow", unsupported, true},
+	}
+
+	for _, test := range tests {
+		err := ValidateRecipe(Recipe{Supplier: "example", Type: "client", Steps: []Step{test.step}})
+		if (err != nil) != test.expectedError {
+			t.Errorf("%s: ValidateRecipe() = %v; want error %t", test.name, err, test.expectedError)
+		}
+	}
+}
@@ -9,10 +9,10 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strings"
 	"sync"
 
+	"buchhalter/lib/utils"
 	"buchhalter/lib/vault"
 
 	"github.com/xeipuuv/gojsonschema"
@@ -27,9 +27,16 @@ type RecipeParser struct {
 
 	recipeSupplierByDomain map[string]string
 	recipeBySupplier       map[string]Recipe
+	// domainIndex of recipeSupplierByDomain, built by GetRecipeForItem and reset whenever the recipes are loaded
+	domainIndex *domainIndex
+	// matchCache keeps the matches of GetRecipeForItem between runs, nil for none (see SetMatchCache)
+	matchCache *MatchCache
 
 	database     Database
 	OicdbVersion string
+
+	// rejectedUpdate is the validation error of an OICDB update, that was replaced with the previous version
+	rejectedUpdate error
 }
 
 type Database struct {
@@ -44,6 +51,42 @@ type Recipe struct {
 	Version  string   `json:"version"`
 	Type     string   `json:"type"`
 	Steps    []Step   `json:"steps"`
+
+	// DomainMatch is the mode matching the domains with the urls of vault items (see DomainMatchModes), `prefix` by default.
+	// A domain with a wildcard (e.g. `*.example.com`) matches all subdomains.
+	DomainMatch string `json:"domainMatch,omitempty"`
+
+	// Tags categorize the supplier (e.g. `hosting` or `saas`), to sync only some categories (`buchhalter sync --tag`)
+	Tags []string `json:"tags,omitempty"`
+
+	// RestrictDomains blocks all browser requests except to the domains of the recipe and AllowedDomains (e.g. trackers and ads).
+	// AllowedDomains are further domains the portal needs (e.g. a login or CDN domain).
+	RestrictDomains bool     `json:"restrictDomains,omitempty"`
+	AllowedDomains  []string `json:"allowedDomains,omitempty"`
+
+	// ExpectedMimeType is the type of all documents of the recipe (e.g. `application/pdf`), checked by their magic bytes before archiving.
+	// Without it, only documents with a known extension (e.g. `.pdf`) are checked, `*/*` disables the check.
+	ExpectedMimeType string `json:"expectedMimeType,omitempty"`
+
+	// Viewport emulates a screen size (and optionally a mobile device) for browser recipes
+	Viewport *Viewport `json:"viewport,omitempty"`
+
+	// Labels of the vault item fields to read the credentials from.
+	// Without a label, the default fields (username, password and the OTP field) are used.
+	UsernameField string `json:"usernameField,omitempty"`
+	PasswordField string `json:"passwordField,omitempty"`
+	TotpField     string `json:"totpField,omitempty"`
+	// TotpAdjacentWindow marks portals accepting the TOTP codes of the previous and next window (±1 step).
+	// A code about to expire is replaced by the code of the next window, instead of waiting for it.
+	TotpAdjacentWindow bool `json:"totpAdjacentWindow,omitempty"`
+
+	// ClientCertificate marks supplier APIs that require mutual TLS.
+	// The certificate is configured locally per supplier (`buchhalter_client_certificates`), only for `client` recipes.
+	ClientCertificate bool `json:"clientCertificate,omitempty"`
+
+	// MaxFiles overrides the number of documents a download step downloads (`buchhalter_max_download_files_per_receipt`), `0` downloads all of them.
+	// The option `maxFiles` of a step has precedence over the one of the recipe.
+	MaxFiles *int `json:"maxFiles,omitempty"`
 }
 
 type Step struct {
@@ -53,11 +96,30 @@ type Step struct {
 	SelectorType string `json:"selectorType,omitempty"`
 	Value        string `json:"value,omitempty"`
 	Description  string `json:"description,omitempty"`
-	When         struct {
+	// Frame targets an iframe by its (zero-based) position or its name / id attribute.
+	// Supported by click, type, waitFor and downloadAll.
+	Frame string `json:"frame,omitempty"`
+	When  struct {
 		URL string `json:"url"`
 	} `json:"when,omitempty"`
+	// SleepDuration (in milliseconds) and Concurrency (number of parallel downloads) of downloadAll steps (fetchDownload and downloadHrefs support SleepDuration).
+	// Without a value, the defaults are used (see DefaultDownloadSleepDuration and `buchhalter_download_concurrency`).
 	SleepDuration int `json:"sleepDuration,omitempty"`
-	Oauth2        struct {
+	Concurrency   int `json:"concurrency,omitempty"`
+	// PrintFallback prints the page to PDF, if a click of a downloadAll step doesn't start a download (e.g. a print preview).
+	PrintFallback bool `json:"printFallback,omitempty"`
+	// MaxFiles overrides the number of documents of downloadAll, downloadHrefs and fetchDownload steps (see Recipe.MaxFiles).
+	MaxFiles *int `json:"maxFiles,omitempty"`
+	// ViaNewTab downloads the document of the new tab a click of a downloadAll step opens (e.g. a PDF shown in a new tab instead of a download).
+	ViaNewTab bool `json:"viaNewTab,omitempty"`
+	// Fallback are the steps of a waitForApproval step to run, if the push approval isn't confirmed in time (e.g. entering a TOTP code).
+	Fallback []Step `json:"fallback,omitempty"`
+	// LoggedIn marks the step that confirms a successful login (e.g. a waitFor on the dashboard), see LoginRecipe.
+	LoggedIn bool `json:"loggedIn,omitempty"`
+	// Expect is the result a runScript step must return, otherwise the step fails with the result as message.
+	// Strings are compared as is, other results (numbers, booleans, arrays, objects) in their JSON encoding.
+	Expect *string `json:"expect,omitempty"`
+	Oauth2 struct {
 		AuthUrl            string `json:"authUrl"`
 		TokenUrl           string `json:"tokenUrl"`
 		RedirectUrl        string `json:"redirectUrl"`
@@ -65,15 +127,30 @@ type Step struct {
 		Scope              string `json:"scope"`
 		PkceMethod         string `json:"pkceMethod"`
 		PkceVerifierLength int    `json:"pkceVerifierLength"`
+		// Flow is the OAuth2 flow of `oauth2-authenticate` (see Oauth2Flows), the authorization code flow by default.
+		// The device flow requests its code from DeviceAuthUrl.
+		Flow          string `json:"flow"`
+		DeviceAuthUrl string `json:"deviceAuthUrl"`
 	}
 	ExtractDocumentIds       string            `json:"extractDocumentIds,omitempty"`
 	ExtractDocumentFilenames string            `json:"extractDocumentFilenames,omitempty"`
 	DocumentUrl              string            `json:"documentUrl,omitempty"`
 	DocumentRequestMethod    string            `json:"documentRequestMethod,omitempty"`
 	DocumentRequestHeaders   map[string]string `json:"documentRequestHeaders,omitempty"`
+	Method                   string            `json:"method,omitempty"` // HTTP method of item requests (GET, POST or PUT, default POST)
 	Body                     string            `json:"body,omitempty"`
-	Headers                  map[string]string `json:"headers,omitempty"`
+	Headers                  map[string]string `json:"headers,omitempty"` // Headers of item requests and fetchDownload steps
 	Execute                  string            `json:"execute,omitempty"`
+	// Months is the number of months a httpGet step with `{{ year }}` or `{{ month }}` in its url requests (see DefaultHTTPGetMonths).
+	Months int `json:"months,omitempty"`
+
+	// Pagination of item requests (see oauth2-request-items)
+	// NextPagePath is the path (dot notation) to the next page token in the response.
+	// NextPageUrl and NextPageBody are templates for the follow-up requests, `{{ next }}` is replaced with the token.
+	NextPagePath string `json:"nextPagePath,omitempty"`
+	NextPageUrl  string `json:"nextPageUrl,omitempty"`
+	NextPageBody string `json:"nextPageBody,omitempty"`
+	MaxPages     int    `json:"maxPages,omitempty"`
 }
 
 func NewRecipeParser(logger *slog.Logger, buchhalterConfigDirectory, buchhalterDirectory string) *RecipeParser {
@@ -88,11 +165,25 @@ func NewRecipeParser(logger *slog.Logger, buchhalterConfigDirectory, buchhalterD
 	}
 }
 
+// LoadRecipes loads the recipes of the OICDB (and the local recipes in development mode).
+// If an updated OICDB fails the validation, the previous version is restored from its backup (see RejectedUpdate).
 func (p *RecipeParser) LoadRecipes(developmentMode bool) (bool, error) {
 	validationResult, err := validateRecipes(p.configDirectory)
 	if err != nil {
-		return validationResult, err
+		restored := p.restoreOICDBBackups()
+		if !restored {
+			return validationResult, err
+		}
+		p.logger.Warn("Rejected the invalid OICDB update, restored the previous version", "error", err)
+		p.rejectedUpdate = err
+
+		validationResult, err = validateRecipes(p.configDirectory)
+		if err != nil {
+			return validationResult, err
+		}
 	}
+	// The valid OICDB is the last-known-good version for the next update
+	p.removeOICDBBackups()
 
 	dbFile, err := os.Open(filepath.Join(p.configDirectory, "oicdb.json"))
 	if err != nil {
@@ -123,6 +214,18 @@ func (p *RecipeParser) LoadRecipes(developmentMode bool) (bool, error) {
 		p.logger.Info("Loaded local recipes for suppliers", "num_recipes", len(p.database.Recipes)-numOfficialRecipes, "oicdb_version", p.OicdbVersion)
 	}
 
+	// Reject recipes with errors the JSON schema validation doesn't cover (e.g. unsupported selector types)
+	validRecipes := make([]Recipe, 0, len(p.database.Recipes))
+	for _, recipe := range p.database.Recipes {
+		if err := ValidateRecipe(recipe); err != nil {
+			p.logger.Error("Rejecting invalid recipe", "supplier", recipe.Supplier, "recipe_version", recipe.Version, "error", err)
+			continue
+		}
+		validRecipes = append(validRecipes, recipe)
+	}
+	p.database.Recipes = validRecipes
+
+	p.domainIndex = nil
 	for i := 0; i < len(p.database.Recipes); i++ {
 		for n := 0; n < len(p.database.Recipes[i].Domains); n++ {
 			p.recipeSupplierByDomain[p.database.Recipes[i].Domains[n]] = p.database.Recipes[i].Supplier
@@ -133,24 +236,104 @@ func (p *RecipeParser) LoadRecipes(developmentMode bool) (bool, error) {
 	return true, nil
 }
 
+// RejectedUpdate returns the validation error of an OICDB update rejected by LoadRecipes, nil if no update was rejected.
+func (p *RecipeParser) RejectedUpdate() error {
+	return p.rejectedUpdate
+}
+
+// oicdbFiles are the files of the OICDB in the config directory, they are backed up before an update.
+var oicdbFiles = []string{"oicdb.json", "oicdb.schema.json"}
+
+// restoreOICDBBackups restores the backups of the OICDB files, it returns true if a backup was restored.
+func (p *RecipeParser) restoreOICDBBackups() bool {
+	restoredAny := false
+	for _, oicdbFile := range oicdbFiles {
+		file := filepath.Join(p.configDirectory, oicdbFile)
+		restored, err := utils.RestoreBackup(file)
+		if err != nil {
+			p.logger.Error("Error restoring the previous version of the OICDB", "file", file, "error", err)
+			continue
+		}
+		restoredAny = restoredAny || restored
+	}
+	return restoredAny
+}
+
+func (p *RecipeParser) removeOICDBBackups() {
+	for _, oicdbFile := range oicdbFiles {
+		file := filepath.Join(p.configDirectory, oicdbFile)
+		if err := utils.RemoveBackup(file); err != nil {
+			p.logger.Warn("Error removing the backup of the OICDB", "file", file, "error", err)
+		}
+	}
+}
+
+// GetRecipes returns all loaded recipes.
+func (p *RecipeParser) GetRecipes() []Recipe {
+	return p.database.Recipes
+}
+
+// SetMatchCache caches the recipes matched by GetRecipeForItem in cache, the cache has to be of the loaded OICDB version.
+func (p *RecipeParser) SetMatchCache(cache *MatchCache) {
+	p.matchCache = cache
+}
+
+// GetRecipeForItem returns the recipe with a domain matching one of the urls of item (see DomainMatchModes), nil if no recipe matches.
+// If several domains match, the best match wins: a domain (or subdomain) match beats a parent domain match, then the longest domain wins.
+// With a match cache (see SetMatchCache), the recipe of an unchanged item is taken from the cache.
 func (p *RecipeParser) GetRecipeForItem(item vault.Item, urlsByItemId map[string][]string) *Recipe {
-	// Build regex pattern with all urls from the vault item
-	var pattern string
-	for domain := range p.recipeSupplierByDomain {
-		pattern = "^(https?://)?" + regexp.QuoteMeta(domain)
-
-		// Try to match all item urls with a recipe url (e.g. digitalocean login url) */
-		for i := 0; i < len(urlsByItemId[item.ID]); i++ {
-			matched, _ := regexp.MatchString(pattern, urlsByItemId[item.ID][i])
-			if matched {
-				// Return matching recipe
-				recipe := p.recipeBySupplier[p.recipeSupplierByDomain[domain]]
+	urls := urlsByItemId[item.ID]
+	if p.matchCache != nil {
+		if supplier, ok := p.matchCache.supplierFor(item, urls); ok {
+			if len(supplier) == 0 {
+				return nil
+			}
+			if recipe, ok := p.recipeBySupplier[supplier]; ok {
 				return &recipe
 			}
 		}
 	}
 
-	return nil
+	recipe := p.matchRecipe(urls)
+	if p.matchCache != nil {
+		supplier := ""
+		if recipe != nil {
+			supplier = recipe.Supplier
+		}
+		p.matchCache.store(item, urls, supplier)
+	}
+	return recipe
+}
+
+// matchRecipe returns the recipe of the best matching domain of the urls of an item (see GetRecipeForItem).
+func (p *RecipeParser) matchRecipe(urls []string) *Recipe {
+	if p.domainIndex == nil {
+		p.domainIndex = newDomainIndex(p.recipeSupplierByDomain, p.recipeBySupplier)
+	}
+
+	bestMatch := noDomainMatch
+	bestDomain := ""
+	// Try to match all item urls with a recipe url (e.g. digitalocean login url)
+	for _, itemUrl := range urls {
+		for _, domain := range p.domainIndex.candidates(itemUrl) {
+			mode := p.recipeBySupplier[p.recipeSupplierByDomain[domain]].DomainMatch
+			match := matchDomain(domain, mode, itemUrl)
+			if match == noDomainMatch || match < bestMatch {
+				continue
+			}
+			// Ties are decided by the domain, the order of the candidates is random
+			if match > bestMatch || len(domain) > len(bestDomain) || (len(domain) == len(bestDomain) && domain < bestDomain) {
+				bestMatch = match
+				bestDomain = domain
+			}
+		}
+	}
+
+	if bestMatch == noDomainMatch {
+		return nil
+	}
+	recipe := p.recipeBySupplier[p.recipeSupplierByDomain[bestDomain]]
+	return &recipe
 }
 
 func validateRecipes(buchhalterConfigDirectory string) (bool, error) {
@@ -177,7 +360,7 @@ func validateRecipes(buchhalterConfigDirectory string) (bool, error) {
 }
 
 func (p *RecipeParser) loadLocalRecipes(buchhalterDirectory string) error {
-	sf := "_local/recipes"
+	sf := LocalRecipesDirectory
 	recipesDir := filepath.Join(buchhalterDirectory, sf)
 	if _, err := os.Stat(recipesDir); os.IsNotExist(err) {
 		err := os.MkdirAll(recipesDir, 0755)
@@ -0,0 +1,86 @@
+package parser
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"buchhalter/lib/utils"
+)
+
+const (
+	testOICDBSchema = `{"type": "object", "required": ["version", "recipes"], "properties": {"version": {"type": "string"}, "recipes": {"type": "array"}}}`
+	testOICDB       = `{"name": "oicdb", "version": "1.0.0", "recipes": []}`
+	testOICDBUpdate = `{"name": "oicdb", "version": "1.1.0", "recipes": []}`
+	// testInvalidOICDB fails the validation with testOICDBSchema
+	testInvalidOICDB = `{"name": "oicdb", "version": 2}`
+)
+
+// writeTestOICDB writes the OICDB schema and the OICDB into configDirectory, update replaces the OICDB like an update (with a backup).
+func writeTestOICDB(t *testing.T, configDirectory, update string) {
+	t.Helper()
+
+	dbFile := filepath.Join(configDirectory, "oicdb.json")
+	if err := os.WriteFile(filepath.Join(configDirectory, "oicdb.schema.json"), []byte(testOICDBSchema), 0644); err != nil {
+		t.Fatalf("error writing OICDB schema: %s", err)
+	}
+	if err := os.WriteFile(dbFile, []byte(testOICDB), 0644); err != nil {
+		t.Fatalf("error writing OICDB: %s", err)
+	}
+	if len(update) == 0 {
+		return
+	}
+	if err := utils.BackupFile(dbFile); err != nil {
+		t.Fatalf("BackupFile() returned error: %s", err)
+	}
+	if err := os.WriteFile(dbFile, []byte(update), 0644); err != nil {
+		t.Fatalf("error writing OICDB update: %s", err)
+	}
+}
+
+func TestLoadRecipesRejectsInvalidUpdate(t *testing.T) {
+	tests := []struct {
+		name            string
+		update          string
+		expectedVersion string
+		expectedReject  bool
+	}{
+		{"no update", "", "1.0.0", false},
+		{"valid update", testOICDBUpdate, "1.1.0", false},
+		{"invalid update", testInvalidOICDB, "1.0.0", true},
+	}
+
+	for _, test := range tests {
+		configDirectory := t.TempDir()
+		writeTestOICDB(t, configDirectory, test.update)
+
+		p := NewRecipeParser(slog.Default(), configDirectory, t.TempDir())
+		if _, err := p.LoadRecipes(false); err != nil {
+			t.Fatalf("%s: LoadRecipes() returned error: %s", test.name, err)
+		}
+		if p.OicdbVersion != test.expectedVersion {
+			t.Errorf("%s: OicdbVersion = %s; want %s", test.name, p.OicdbVersion, test.expectedVersion)
+		}
+		if rejected := p.RejectedUpdate() != nil; rejected != test.expectedReject {
+			t.Errorf("%s: RejectedUpdate() = %v; want rejected %t", test.name, p.RejectedUpdate(), test.expectedReject)
+		}
+		// The loaded OICDB is the last-known-good version, no backup is kept
+		if _, err := os.Stat(filepath.Join(configDirectory, "oicdb.json"+utils.BackupFileSuffix)); !os.IsNotExist(err) {
+			t.Errorf("%s: backup of oicdb.json exists after LoadRecipes(); want it to be removed", test.name)
+		}
+	}
+}
+
+func TestLoadRecipesInvalidWithoutBackup(t *testing.T) {
+	configDirectory := t.TempDir()
+	writeTestOICDB(t, configDirectory, "")
+	if err := os.WriteFile(filepath.Join(configDirectory, "oicdb.json"), []byte(testInvalidOICDB), 0644); err != nil {
+		t.Fatalf("error writing OICDB: %s", err)
+	}
+
+	p := NewRecipeParser(slog.Default(), configDirectory, t.TempDir())
+	if _, err := p.LoadRecipes(false); err == nil {
+		t.Errorf("LoadRecipes() of an invalid OICDB without a backup returned no error")
+	}
+}
@@ -0,0 +1,85 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"buchhalter/lib/vault"
+)
+
+// ItemPins pin vault items to suppliers (see `buchhalter_supplier_items`).
+// The recipe of a pinned supplier runs only with its pinned item, the domains of the recipe aren't matched.
+// Suppliers are compared case-insensitive.
+type ItemPins map[string]string
+
+// NewItemPins returns the pins of pins (supplier => vault item ID), without empty suppliers and items.
+func NewItemPins(pins map[string]string) ItemPins {
+	itemPins := ItemPins{}
+	for supplier, itemId := range pins {
+		supplier = strings.ToLower(strings.TrimSpace(supplier))
+		itemId = strings.TrimSpace(itemId)
+		if len(supplier) > 0 && len(itemId) > 0 {
+			itemPins[supplier] = itemId
+		}
+	}
+	return itemPins
+}
+
+// ItemFor returns the vault item ID pinned to supplier.
+func (pins ItemPins) ItemFor(supplier string) (string, bool) {
+	itemId, pinned := pins[strings.ToLower(strings.TrimSpace(supplier))]
+	return itemId, pinned
+}
+
+// MatchRecipesWithPins returns the recipes to run with their vault items.
+// Pinned suppliers come first (in the order of the recipes) with their pinned item, all other recipes are matched by the urls of the vault items (see GetRecipeForItem).
+// A pin for an unknown supplier or vault item is returned as warning, the supplier is skipped instead of falling back to matching by urls.
+func (p *RecipeParser) MatchRecipesWithPins(items vault.Items, urlsByItemId map[string][]string, pins ItemPins) ([]RecipeMatch, []error) {
+	matches := []RecipeMatch{}
+	warnings := []error{}
+
+	itemsById := make(map[string]vault.Item, len(items))
+	for _, item := range items {
+		itemsById[item.ID] = item
+	}
+	knownSuppliers := map[string]bool{}
+	for i := range p.database.Recipes {
+		recipe := p.database.Recipes[i]
+		knownSuppliers[strings.ToLower(recipe.Supplier)] = true
+		itemId, pinned := pins.ItemFor(recipe.Supplier)
+		if !pinned {
+			continue
+		}
+		item, exists := itemsById[itemId]
+		if !exists {
+			warnings = append(warnings, fmt.Errorf("vault item `%s` pinned to supplier %s not found, skipping supplier", itemId, recipe.Supplier))
+			continue
+		}
+		matches = append(matches, RecipeMatch{Recipe: &recipe, ItemId: item.ID, ItemTitle: item.Title})
+	}
+
+	unknownSuppliers := []string{}
+	for supplier := range pins {
+		if !knownSuppliers[supplier] {
+			unknownSuppliers = append(unknownSuppliers, supplier)
+		}
+	}
+	sort.Strings(unknownSuppliers)
+	for _, supplier := range unknownSuppliers {
+		warnings = append(warnings, fmt.Errorf("no recipe for supplier %s with pinned vault item `%s`", supplier, pins[supplier]))
+	}
+
+	for _, item := range items {
+		recipe := p.GetRecipeForItem(item, urlsByItemId)
+		if recipe == nil {
+			continue
+		}
+		if _, pinned := pins.ItemFor(recipe.Supplier); pinned {
+			continue
+		}
+		matches = append(matches, RecipeMatch{Recipe: recipe, ItemId: item.ID, ItemTitle: item.Title})
+	}
+
+	return matches, warnings
+}
@@ -0,0 +1,62 @@
+package parser
+
+import (
+	"log/slog"
+	"reflect"
+	"testing"
+
+	"buchhalter/lib/vault"
+)
+
+func TestMatchRecipesWithPins(t *testing.T) {
+	p := NewRecipeParser(slog.Default(), t.TempDir(), t.TempDir())
+	p.database.Recipes = []Recipe{
+		{Supplier: "Hetzner", Domains: []string{"accounts.hetzner.com"}},
+		{Supplier: "digitalocean", Domains: []string{"cloud.digitalocean.com"}},
+	}
+	for _, recipe := range p.database.Recipes {
+		p.recipeBySupplier[recipe.Supplier] = recipe
+		for _, domain := range recipe.Domains {
+			p.recipeSupplierByDomain[domain] = recipe.Supplier
+		}
+	}
+	items := vault.Items{
+		{ID: "item-1", Title: "Hetzner"},
+		{ID: "item-2", Title: "Hetzner (company)"},
+		{ID: "item-3", Title: "DigitalOcean"},
+		{ID: "item-4", Title: "Hetzner SSO"},
+	}
+	urlsByItemId := map[string][]string{
+		"item-1": {"https://accounts.hetzner.com/login"},
+		"item-2": {"accounts.hetzner.com"},
+		"item-3": {"https://cloud.digitalocean.com/login"},
+	}
+
+	tests := []struct {
+		name             string
+		pins             map[string]string
+		expected         []string
+		expectedWarnings int
+	}{
+		{"no pins", nil, []string{"Hetzner:item-1", "Hetzner:item-2", "digitalocean:item-3"}, 0},
+		{"pin overrides matching", map[string]string{" hetzner ": "item-2"}, []string{"Hetzner:item-2", "digitalocean:item-3"}, 0},
+		{"pin of an item without urls", map[string]string{"HETZNER": "item-4"}, []string{"Hetzner:item-4", "digitalocean:item-3"}, 0},
+		{"pinned suppliers first", map[string]string{"digitalocean": "item-3"}, []string{"digitalocean:item-3", "Hetzner:item-1", "Hetzner:item-2"}, 0},
+		{"missing item", map[string]string{"hetzner": "item-9"}, []string{"digitalocean:item-3"}, 1},
+		{"unknown supplier", map[string]string{"aws": "item-1", "hetzner": ""}, []string{"Hetzner:item-1", "Hetzner:item-2", "digitalocean:item-3"}, 1},
+	}
+
+	for _, test := range tests {
+		matches, warnings := p.MatchRecipesWithPins(items, urlsByItemId, NewItemPins(test.pins))
+		runs := []string{}
+		for _, match := range matches {
+			runs = append(runs, match.Recipe.Supplier+":"+match.ItemId)
+		}
+		if !reflect.DeepEqual(runs, test.expected) {
+			t.Errorf("%s: MatchRecipesWithPins() runs %v; want %v", test.name, runs, test.expected)
+		}
+		if len(warnings) != test.expectedWarnings {
+			t.Errorf("%s: MatchRecipesWithPins() returned warnings %v; want %d", test.name, warnings, test.expectedWarnings)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPollTimeout is the time a `pollFor` step waits for its element without a configured value.
+const DefaultPollTimeout = 60 * time.Second
+
+// MaxPollTimeout is the maximum time a `pollFor` step waits for its element.
+const MaxPollTimeout = 5 * time.Minute
+
+// ParsePollTimeout parses the value of a `pollFor` step (the timeout in seconds).
+// An empty value means DefaultPollTimeout.
+func ParsePollTimeout(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if len(value) == 0 {
+		return DefaultPollTimeout, nil
+	}
+
+	seconds, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("timeout `%s` is not a number of seconds", value)
+	}
+	if seconds <= 0 {
+		return 0, fmt.Errorf("timeout %d must be greater than 0", seconds)
+	}
+	timeout := time.Duration(seconds) * time.Second
+	if timeout > MaxPollTimeout {
+		return 0, fmt.Errorf("timeout %d exceeds the maximum of %d seconds", seconds, int(MaxPollTimeout.Seconds()))
+	}
+
+	return timeout, nil
+}
+
+// validatePollStep checks the options of a `pollFor` step.
+func validatePollStep(step Step) error {
+	if len(strings.TrimSpace(step.Selector)) == 0 {
+		return errors.New("the selector of the element to poll for is missing")
+	}
+	if _, err := ParsePollTimeout(step.Value); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"buchhalter/lib/vault"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RecipeFileOicdbVersion is the OICDB version reported for recipes loaded from a single file.
+const RecipeFileOicdbVersion = "recipe-file"
+
+// ReadRecipeFile reads a single recipe from a JSON or YAML (.yaml, .yml) file.
+// The YAML keys are the same as the JSON keys of the OICDB.
+func ReadRecipeFile(file string) (Recipe, error) {
+	var recipe Recipe
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return recipe, fmt.Errorf("error reading recipe file %s: %w", file, err)
+	}
+
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		// YAML is converted to JSON, so both formats share the JSON keys of the recipe
+		var document interface{}
+		if err := yaml.Unmarshal(content, &document); err != nil {
+			return recipe, fmt.Errorf("error parsing recipe file %s: %w", file, err)
+		}
+		content, err = json.Marshal(document)
+		if err != nil {
+			return recipe, fmt.Errorf("error converting recipe file %s: %w", file, err)
+		}
+	}
+
+	if err := json.Unmarshal(content, &recipe); err != nil {
+		return recipe, fmt.Errorf("error parsing recipe file %s: %w", file, err)
+	}
+	if err := validateRecipeFile(recipe); err != nil {
+		return recipe, fmt.Errorf("recipe file %s is not valid: %w", file, err)
+	}
+
+	return recipe, nil
+}
+
+// validateRecipeFile checks the fields the OICDB schema requires, followed by ValidateRecipe.
+func validateRecipeFile(recipe Recipe) error {
+	if len(strings.TrimSpace(recipe.Supplier)) == 0 {
+		return errors.New("`supplier` is missing")
+	}
+	if recipe.Type != "browser" && recipe.Type != "client" && recipe.Type != "http" {
+		return fmt.Errorf("recipe %s has the unsupported type `%s` (supported: browser, client, http)", recipe.Supplier, recipe.Type)
+	}
+	if len(recipe.Steps) == 0 {
+		return fmt.Errorf("recipe %s has no steps", recipe.Supplier)
+	}
+	for i, step := range recipe.Steps {
+		if len(step.Action) == 0 {
+			return fmt.Errorf("step %d of recipe %s has no action", i+1, recipe.Supplier)
+		}
+	}
+
+	return ValidateRecipe(recipe)
+}
+
+// LoadRecipeFile loads a single recipe from a file instead of the OICDB (e.g. for the development of private recipes).
+// The recipe replaces all loaded recipes, only it is matched with vault items afterwards.
+func (p *RecipeParser) LoadRecipeFile(file string) (*Recipe, error) {
+	recipe, err := ReadRecipeFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mutex.Lock()
+	p.OicdbVersion = RecipeFileOicdbVersion
+	p.mutex.Unlock()
+	p.database = Database{Name: file, Version: RecipeFileOicdbVersion, Recipes: []Recipe{recipe}}
+	p.recipeSupplierByDomain = make(map[string]string)
+	p.domainIndex = nil
+	p.recipeBySupplier = map[string]Recipe{recipe.Supplier: recipe}
+	for _, domain := range recipe.Domains {
+		p.recipeSupplierByDomain[domain] = recipe.Supplier
+	}
+	p.logger.Info("Loaded recipe from file", "file", file, "supplier", recipe.Supplier, "recipe_version", recipe.Version)
+
+	return &recipe, nil
+}
+
+// MatchRecipeItems returns the IDs of the vault items to run recipe with.
+// With an item (ID or title), only this item is used. Otherwise, the items are matched by the domains of the recipe.
+func MatchRecipeItems(recipe Recipe, items vault.Items, urlsByItemId map[string][]string, item string) ([]string, error) {
+	item = strings.TrimSpace(item)
+	if len(item) > 0 {
+		for _, vaultItem := range items {
+			if vaultItem.ID == item || strings.EqualFold(vaultItem.Title, item) {
+				return []string{vaultItem.ID}, nil
+			}
+		}
+		return nil, fmt.Errorf("vault item `%s` not found", item)
+	}
+
+	itemIds := []string{}
+	for _, vaultItem := range items {
+		if recipeMatchesUrls(recipe, urlsByItemId[vaultItem.ID]) {
+			itemIds = append(itemIds, vaultItem.ID)
+		}
+	}
+	return itemIds, nil
+}
+
+// recipeMatchesUrls returns true if one of the urls belongs to a domain of the recipe (see GetRecipeForItem).
+func recipeMatchesUrls(recipe Recipe, urls []string) bool {
+	for _, domain := range recipe.Domains {
+		for _, url := range urls {
+			if matchDomain(domain, recipe.DomainMatch, url) != noDomainMatch {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RecipeTestFile returns the recipe file to test the recipe of supplier with (`buchhalter recipes test`).
+// The local recipe (`_local/recipes/<supplier>.json`) is preferred, otherwise the recipe of the OICDB is written into directory.
+func (p *RecipeParser) RecipeTestFile(supplier, directory string) (string, error) {
+	localFile := filepath.Join(p.storageDirectory, LocalRecipesDirectory, supplier+".json")
+	if _, err := os.Stat(localFile); err == nil {
+		p.logger.Info("Testing local recipe", "supplier", supplier, "file", localFile)
+		return localFile, nil
+	}
+
+	if _, err := p.LoadRecipes(false); err != nil {
+		return "", fmt.Errorf("error loading recipes: %w", err)
+	}
+	recipe, ok := p.recipeBySupplier[supplier]
+	if !ok {
+		return "", fmt.Errorf("no recipe found for supplier `%s` (neither in %s nor in the OICDB)", supplier, filepath.Join(p.storageDirectory, LocalRecipesDirectory))
+	}
+
+	content, err := json.MarshalIndent(recipe, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("error encoding recipe of supplier `%s`: %w", supplier, err)
+	}
+	file := filepath.Join(directory, supplier+".json")
+	if err := os.WriteFile(file, content, 0644); err != nil {
+		return "", fmt.Errorf("error writing recipe file %s: %w", file, err)
+	}
+	p.logger.Info("Testing recipe of the OICDB", "supplier", supplier, "recipe_version", recipe.Version, "file", file)
+
+	return file, nil
+}
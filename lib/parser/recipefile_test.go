@@ -0,0 +1,178 @@
+package parser
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"buchhalter/lib/vault"
+)
+
+const recipeFileTestJSON = `{
+  "supplier": "private-hosting",
+  "domains": ["billing.private-hosting.example"],
+  "version": "0.1.0",
+  "type": "browser",
+  "steps": [
+    {"action": "open", "url": "https://billing.private-hosting.example/login"},
+    {"action": "type", "selector": "#username", "value": "{{ username }}"},
+    {"action": "downloadAll", "selector": "a.invoice"}
+  ]
+}`
+
+const recipeFileTestYAML = `supplier: private-hosting
+domains:
+  - billing.private-hosting.example
+version: 0.1.0
+type: browser
+steps:
+  - action: open
+    url: https://billing.private-hosting.example/login
+  - action: type
+    selector: "#username"
+    value: "{{ username }}"
+  - action: downloadAll
+    selector: a.invoice
+`
+
+func writeRecipeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("Error writing recipe file: %s", err)
+	}
+	return file
+}
+
+func TestReadRecipeFile(t *testing.T) {
+	jsonRecipe, err := ReadRecipeFile(writeRecipeTestFile(t, "private.json", recipeFileTestJSON))
+	if err != nil {
+		t.Fatalf("ReadRecipeFile(json) returned error: %s", err)
+	}
+	yamlRecipe, err := ReadRecipeFile(writeRecipeTestFile(t, "private.yml", recipeFileTestYAML))
+	if err != nil {
+		t.Fatalf("ReadRecipeFile(yaml) returned error: %s", err)
+	}
+	if !reflect.DeepEqual(jsonRecipe, yamlRecipe) {
+		t.Errorf("ReadRecipeFile(yaml) = %+v; want %+v", yamlRecipe, jsonRecipe)
+	}
+	if jsonRecipe.Supplier != "private-hosting" || len(jsonRecipe.Steps) != 3 || jsonRecipe.Steps[1].Value != "{{ username }}" {
+		t.Errorf("ReadRecipeFile(json) = %+v; want the recipe of private-hosting", jsonRecipe)
+	}
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{"invalid json", "invalid.json", `{"supplier": `},
+		{"invalid yaml", "invalid.yaml", "supplier: [a"},
+		{"missing supplier", "missing.json", `{"type": "browser", "steps": [{"action": "open"}]}`},
+		{"unsupported type", "type.json", `{"supplier": "a", "type": "api", "steps": [{"action": "open"}]}`},
+		{"no steps", "steps.json", `{"supplier": "a", "type": "browser"}`},
+		{"step without action", "action.json", `{"supplier": "a", "type": "browser", "steps": [{"url": "https://a.example"}]}`},
+		{"unsupported selector type", "selector.json", `{"supplier": "a", "type": "browser", "steps": [{"action": "click", "selector": "a", "selectorType": "regex"}]}`},
+	}
+	for _, test := range tests {
+		if _, err := ReadRecipeFile(writeRecipeTestFile(t, test.file, test.content)); err == nil {
+			t.Errorf("%s: ReadRecipeFile() returned no error", test.name)
+		}
+	}
+
+	if _, err := ReadRecipeFile(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Errorf("ReadRecipeFile(missing file) returned no error")
+	}
+}
+
+func TestLoadRecipeFileAndMatchItems(t *testing.T) {
+	// The config directory has no OICDB, the recipe file is loaded without it
+	p := NewRecipeParser(slog.Default(), t.TempDir(), t.TempDir())
+	recipe, err := p.LoadRecipeFile(writeRecipeTestFile(t, "private.json", recipeFileTestJSON))
+	if err != nil {
+		t.Fatalf("LoadRecipeFile() returned error: %s", err)
+	}
+	if p.OicdbVersion != RecipeFileOicdbVersion {
+		t.Errorf("OicdbVersion = %s; want %s", p.OicdbVersion, RecipeFileOicdbVersion)
+	}
+	if recipes := p.GetRecipes(); len(recipes) != 1 || recipes[0].Supplier != recipe.Supplier {
+		t.Errorf("GetRecipes() = %v; want only the recipe of the file", recipes)
+	}
+
+	items := vault.Items{
+		{ID: "item-1", Title: "Private Hosting"},
+		{ID: "item-2", Title: "Private Hosting (2nd account)"},
+		{ID: "item-3", Title: "Hetzner"},
+	}
+	urlsByItemId := map[string][]string{
+		"item-1": {"https://billing.private-hosting.example/login"},
+		"item-2": {"billing.private-hosting.example"},
+		"item-3": {"https://accounts.hetzner.com"},
+	}
+	if matched := p.GetRecipeForItem(items[0], urlsByItemId); matched == nil || matched.Supplier != recipe.Supplier {
+		t.Errorf("GetRecipeForItem(item-1) = %v; want the recipe of the file", matched)
+	}
+
+	tests := []struct {
+		name          string
+		item          string
+		expected      []string
+		expectedError bool
+	}{
+		{"matched by domain", "", []string{"item-1", "item-2"}, false},
+		{"explicit ID", "item-3", []string{"item-3"}, false},
+		{"explicit title", "private hosting", []string{"item-1"}, false},
+		{"unknown item", "item-4", nil, true},
+	}
+	for _, test := range tests {
+		itemIds, err := MatchRecipeItems(*recipe, items, urlsByItemId, test.item)
+		if (err != nil) != test.expectedError {
+			t.Errorf("%s: MatchRecipeItems() returned error %v; want error %t", test.name, err, test.expectedError)
+		}
+		if !test.expectedError && !reflect.DeepEqual(itemIds, test.expected) {
+			t.Errorf("%s: MatchRecipeItems() = %v; want %v", test.name, itemIds, test.expected)
+		}
+	}
+}
+
+func TestRecipeTestFile(t *testing.T) {
+	configDirectory := t.TempDir()
+	buchhalterDirectory := t.TempDir()
+	writeTestOICDB(t, configDirectory, `{"name": "oicdb", "version": "1.0.0", "recipes": [`+recipeFileTestJSON+`]}`)
+	p := NewRecipeParser(slog.Default(), configDirectory, buchhalterDirectory)
+
+	// The recipe of the OICDB is written into the directory, as a recipe file
+	directory := t.TempDir()
+	file, err := p.RecipeTestFile("private-hosting", directory)
+	if err != nil {
+		t.Fatalf("RecipeTestFile() returned error: %s", err)
+	}
+	if file != filepath.Join(directory, "private-hosting.json") {
+		t.Errorf("RecipeTestFile() = %s; want the recipe file in %s", file, directory)
+	}
+	recipe, err := ReadRecipeFile(file)
+	if err != nil {
+		t.Fatalf("ReadRecipeFile() of the OICDB recipe returned error: %s", err)
+	}
+	if recipe.Supplier != "private-hosting" || len(recipe.Steps) != 3 {
+		t.Errorf("ReadRecipeFile() of the OICDB recipe = %+v; want the recipe of the OICDB", recipe)
+	}
+
+	// A local recipe is preferred
+	localFile := filepath.Join(buchhalterDirectory, LocalRecipesDirectory, "private-hosting.json")
+	if err := os.MkdirAll(filepath.Dir(localFile), 0755); err != nil {
+		t.Fatalf("Error creating local recipes directory: %s", err)
+	}
+	if err := os.WriteFile(localFile, []byte(recipeFileTestJSON), 0644); err != nil {
+		t.Fatalf("Error writing local recipe: %s", err)
+	}
+	if file, err := p.RecipeTestFile("private-hosting", directory); err != nil || file != localFile {
+		t.Errorf("RecipeTestFile() = %s, %v; want the local recipe %s", file, err, localFile)
+	}
+
+	if _, err := p.RecipeTestFile("unknown", directory); err == nil {
+		t.Errorf("RecipeTestFile() of an unknown supplier returned no error")
+	}
+}
@@ -0,0 +1,135 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// LocalRecipesDirectory is the directory of the local recipes within the buchhalter directory (loaded with `--dev`).
+const LocalRecipesDirectory = "_local/recipes"
+
+// ErrRecipeExists is returned by ScaffoldRecipe, if the supplier has a local recipe already.
+var ErrRecipeExists = errors.New("recipe exists already")
+
+// scaffoldSupplierPattern are the supplier names a recipe can be scaffolded for, they are used as the filename of the recipe.
+var scaffoldSupplierPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// scaffoldRecipe is the skeleton of a recipe written by ScaffoldRecipe.
+// Unlike Recipe, it only encodes the fields of the skeleton (e.g. no empty `oauth2` options).
+type scaffoldRecipe struct {
+	Supplier string         `json:"supplier"`
+	Domains  []string       `json:"domains"`
+	Version  string         `json:"version"`
+	Type     string         `json:"type"`
+	Steps    []scaffoldStep `json:"steps"`
+}
+
+type scaffoldStep struct {
+	Action       string `json:"action"`
+	URL          string `json:"url,omitempty"`
+	Selector     string `json:"selector,omitempty"`
+	SelectorType string `json:"selectorType,omitempty"`
+	Value        string `json:"value,omitempty"`
+	Description  string `json:"description,omitempty"`
+	LoggedIn     bool   `json:"loggedIn,omitempty"`
+}
+
+// newScaffoldRecipe returns a browser recipe for supplier with a login (open, type, type, click) and a download (downloadAll, move).
+// The selectors are placeholders, they have to be adapted to the portal of the supplier.
+func newScaffoldRecipe(supplier, domain string) scaffoldRecipe {
+	baseUrl := "https://" + strings.TrimSuffix(domain, "/")
+	return scaffoldRecipe{
+		Supplier: supplier,
+		Domains:  []string{domain},
+		Version:  "0.1.0",
+		Type:     "browser",
+		Steps: []scaffoldStep{
+			{Action: "open", URL: baseUrl + "/login", Description: "Open the login page"},
+			{Action: "type", Selector: "#username", SelectorType: SelectorTypeQuery, Value: "{{ username }}", Description: "Type the username"},
+			{Action: "type", Selector: "#password", SelectorType: SelectorTypeQuery, Value: "{{ password }}", Description: "Type the password"},
+			{Action: "click", Selector: "button[type=submit]", SelectorType: SelectorTypeQuery, Description: "Submit the login form"},
+			{Action: "waitFor", Selector: "#logout", SelectorType: SelectorTypeQuery, Description: "Wait for the login", LoggedIn: true},
+			{Action: "open", URL: baseUrl + "/invoices", Description: "Open the invoice list"},
+			{Action: "waitFor", Selector: "a.invoice", SelectorType: SelectorTypeQuery, Description: "Wait for the invoices"},
+			{Action: "downloadAll", Selector: "a.invoice", SelectorType: SelectorTypeQuery, Description: "Download the invoices"},
+			{Action: "move", Value: `.*\.pdf`, Description: "Move the invoices into the archive"},
+		},
+	}
+}
+
+// ScaffoldRecipe writes a skeleton browser recipe for supplier into the local recipes of buchhalterDirectory (see LocalRecipesDirectory)
+// and validates it like a recipe file. With an OICDB schema in buchhalterConfigDirectory, the recipe is validated against the schema as well.
+// Without a domain, `<supplier>.com` is used. An existing recipe is only replaced with overwrite.
+func ScaffoldRecipe(buchhalterDirectory, buchhalterConfigDirectory, supplier, domain string, overwrite bool) (string, error) {
+	if !scaffoldSupplierPattern.MatchString(supplier) {
+		return "", fmt.Errorf("supplier `%s` must only consist of lower case letters, digits, `-` and `_`", supplier)
+	}
+	domain = strings.TrimSpace(domain)
+	if len(domain) == 0 {
+		domain = supplier + ".com"
+	}
+
+	recipesDirectory := filepath.Join(buchhalterDirectory, LocalRecipesDirectory)
+	file := filepath.Join(recipesDirectory, supplier+".json")
+	if _, err := os.Stat(file); err == nil && !overwrite {
+		return file, fmt.Errorf("%s: %w", file, ErrRecipeExists)
+	}
+
+	content, err := json.MarshalIndent(newScaffoldRecipe(supplier, domain), "", "  ")
+	if err != nil {
+		return file, fmt.Errorf("error encoding recipe: %w", err)
+	}
+	if err := validateRecipeSchema(buchhalterConfigDirectory, content); err != nil {
+		return file, err
+	}
+
+	if err := os.MkdirAll(recipesDirectory, 0755); err != nil {
+		return file, fmt.Errorf("error creating local recipes directory %s: %w", recipesDirectory, err)
+	}
+	if err := os.WriteFile(file, append(content, '\n'), 0644); err != nil {
+		return file, fmt.Errorf("error writing recipe %s: %w", file, err)
+	}
+	if _, err := ReadRecipeFile(file); err != nil {
+		return file, err
+	}
+
+	return file, nil
+}
+
+// validateRecipeSchema validates a recipe against the OICDB schema of buchhalterConfigDirectory, as the only recipe of a database.
+// Without a schema (e.g. before the first sync), the recipe isn't validated.
+func validateRecipeSchema(buchhalterConfigDirectory string, recipe json.RawMessage) error {
+	schemaFile := filepath.Join(buchhalterConfigDirectory, "oicdb.schema.json")
+	if _, err := os.Stat(schemaFile); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	document, err := json.Marshal(map[string]interface{}{
+		"name":    "local",
+		"version": RecipeFileOicdbVersion,
+		"recipes": []json.RawMessage{recipe},
+	})
+	if err != nil {
+		return fmt.Errorf("error encoding recipe: %w", err)
+	}
+	result, err := gojsonschema.Validate(gojsonschema.NewReferenceLoader("file://"+schemaFile), gojsonschema.NewBytesLoader(document))
+	if err != nil {
+		return fmt.Errorf("error validating recipe against schema %s: %w", schemaFile, err)
+	}
+	if result.Valid() {
+		return nil
+	}
+
+	errorMessageParts := []string{}
+	for _, errorDescription := range result.Errors() {
+		errorMessageParts = append(errorMessageParts, errorDescription.String())
+	}
+	return fmt.Errorf("the recipe is not valid (compared to schema %s). See errors: %s", schemaFile, strings.Join(errorMessageParts, ", "))
+}
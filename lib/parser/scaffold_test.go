@@ -0,0 +1,72 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScaffoldRecipe(t *testing.T) {
+	buchhalterDirectory := t.TempDir()
+	configDirectory := t.TempDir()
+	writeTestOICDB(t, configDirectory, "")
+
+	file, err := ScaffoldRecipe(buchhalterDirectory, configDirectory, "acme", "", false)
+	if err != nil {
+		t.Fatalf("ScaffoldRecipe() returned error: %s", err)
+	}
+	if expected := filepath.Join(buchhalterDirectory, "_local", "recipes", "acme.json"); file != expected {
+		t.Errorf("ScaffoldRecipe() = %s; want %s", file, expected)
+	}
+	recipe, err := ReadRecipeFile(file)
+	if err != nil {
+		t.Fatalf("ReadRecipeFile() returned error: %s", err)
+	}
+	if recipe.Supplier != "acme" || recipe.Type != "browser" || len(recipe.Domains) != 1 || recipe.Domains[0] != "acme.com" {
+		t.Errorf("ScaffoldRecipe() wrote %+v; want a browser recipe for acme.com", recipe)
+	}
+	if _, err := LoginRecipe(&recipe); err != nil {
+		t.Errorf("LoginRecipe() of the scaffolded recipe returned error: %s", err)
+	}
+	for _, finding := range LintRecipe(recipe) {
+		if finding.Severity != LintSeverityInfo {
+			t.Errorf("LintRecipe() of the scaffolded recipe = %s; want no warnings or errors", finding)
+		}
+	}
+
+	// An existing recipe is only replaced with overwrite
+	if _, err := ScaffoldRecipe(buchhalterDirectory, configDirectory, "acme", "portal.acme.de", false); err == nil {
+		t.Errorf("ScaffoldRecipe() of an existing recipe returned no error")
+	}
+	if _, err := ScaffoldRecipe(buchhalterDirectory, configDirectory, "acme", "portal.acme.de", true); err != nil {
+		t.Errorf("ScaffoldRecipe() with overwrite returned error: %s", err)
+	}
+}
+
+func TestScaffoldRecipeInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		supplier string
+		schema   string
+	}{
+		{"supplier with path", "../acme", ""},
+		{"upper case supplier", "Acme", ""},
+		{"schema violation", "acme", `{"type": "object", "properties": {"recipes": {"type": "array", "items": {"required": ["logo"]}}}}`},
+	}
+
+	for _, test := range tests {
+		buchhalterDirectory := t.TempDir()
+		configDirectory := t.TempDir()
+		if len(test.schema) > 0 {
+			if err := os.WriteFile(filepath.Join(configDirectory, "oicdb.schema.json"), []byte(test.schema), 0644); err != nil {
+				t.Fatalf("error writing OICDB schema: %s", err)
+			}
+		}
+		if _, err := ScaffoldRecipe(buchhalterDirectory, configDirectory, test.supplier, "", false); err == nil {
+			t.Errorf("%s: ScaffoldRecipe() returned no error", test.name)
+		}
+		if _, err := os.Stat(filepath.Join(buchhalterDirectory, "_local", "recipes", "acme.json")); err == nil {
+			t.Errorf("%s: ScaffoldRecipe() wrote an invalid recipe", test.name)
+		}
+	}
+}
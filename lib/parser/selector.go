@@ -0,0 +1,170 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"buchhalter/lib/utils"
+)
+
+// Selector types supported by the browser driver.
+// See https://pkg.go.dev/github.com/chromedp/chromedp#hdr-Query_Options for more information
+const (
+	SelectorTypeJSPath   = "JSPath"
+	SelectorTypeSearch   = "Search"
+	SelectorTypeXPath    = "XPath"
+	SelectorTypeQuery    = "Query"
+	SelectorTypeID       = "ID"
+	SelectorTypeNodeID   = "NodeID"
+	SelectorTypeQueryAll = "QueryAll"
+
+	// SelectorTypeShadow is a CSS selector that pierces (open) shadow roots.
+	// Segments separated by ShadowSelectorSeparator are resolved inside the shadow root of the previous match,
+	// e.g. `invoice-list >>> button.download`.
+	SelectorTypeShadow = "Shadow"
+
+	ShadowSelectorSeparator = ">>>"
+)
+
+var supportedSelectorTypes = []string{
+	SelectorTypeJSPath,
+	SelectorTypeSearch,
+	SelectorTypeXPath,
+	SelectorTypeQuery,
+	SelectorTypeID,
+	SelectorTypeNodeID,
+	SelectorTypeQueryAll,
+	SelectorTypeShadow,
+}
+
+// InferSelectorType infers the selector type from the selector itself.
+// A `>>>` implies a shadow DOM piercing selector (Shadow),
+// a leading `#` or `.` implies a CSS selector (Query), a leading `/`, `(`, `./`, `.//` or `..` implies a XPath.
+// If no type can be inferred, an empty string is returned.
+func InferSelectorType(selector string) string {
+	selector = strings.TrimSpace(selector)
+	switch {
+	case strings.Contains(selector, ShadowSelectorSeparator):
+		return SelectorTypeShadow
+	// Relative XPaths start with a dot as well, they are checked before the CSS classes
+	case strings.HasPrefix(selector, "./"), strings.HasPrefix(selector, ".."):
+		return SelectorTypeXPath
+	case strings.HasPrefix(selector, "#"), strings.HasPrefix(selector, "."):
+		return SelectorTypeQuery
+	case strings.HasPrefix(selector, "/"), strings.HasPrefix(selector, "("):
+		return SelectorTypeXPath
+	}
+
+	return ""
+}
+
+// IsSupportedSelectorType returns true if the selector type is known to the browser driver.
+// An empty selector type is supported, it falls back to the chromedp default (or an inferred type).
+func IsSupportedSelectorType(selectorType string) bool {
+	if len(selectorType) == 0 {
+		return true
+	}
+
+	for _, supportedSelectorType := range supportedSelectorTypes {
+		if selectorType == supportedSelectorType {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateRecipe checks the recipe for errors the JSON schema doesn't cover.
+func ValidateRecipe(recipe Recipe) error {
+	if err := validateViewport(recipe.Viewport); err != nil {
+		return fmt.Errorf("recipe %s has an invalid viewport: %w", recipe.Supplier, err)
+	}
+	if recipe.ClientCertificate && recipe.Type != "client" {
+		return fmt.Errorf("recipe %s uses `clientCertificate`, which is only supported by client recipes", recipe.Supplier)
+	}
+	if !utils.IsSupportedMimeType(recipe.ExpectedMimeType) {
+		return fmt.Errorf("recipe %s has the unsupported expectedMimeType `%s` (supported: %s)", recipe.Supplier, recipe.ExpectedMimeType, strings.Join(utils.SupportedMimeTypes(), ", "))
+	}
+	if !IsSupportedDomainMatch(recipe.DomainMatch) {
+		return fmt.Errorf("recipe %s has the unsupported domainMatch `%s` (supported: %s)", recipe.Supplier, recipe.DomainMatch, strings.Join(DomainMatchModes, ", "))
+	}
+	for i, domain := range recipe.Domains {
+		if err := validateDomain(domain); err != nil {
+			return fmt.Errorf("domain %d of recipe %s is invalid: %w", i+1, recipe.Supplier, err)
+		}
+	}
+	if err := ValidateMaxFiles(recipe.MaxFiles); err != nil {
+		return fmt.Errorf("recipe %s is invalid: %w", recipe.Supplier, err)
+	}
+	for i, tag := range recipe.Tags {
+		if len(strings.TrimSpace(tag)) == 0 {
+			return fmt.Errorf("tag %d of recipe %s is empty", i+1, recipe.Supplier)
+		}
+	}
+
+	for i, step := range recipe.Steps {
+		if !IsSupportedSelectorType(step.SelectorType) {
+			return fmt.Errorf("step %d (%s) of recipe %s has the unsupported selectorType `%s` (supported: %s)", i+1, step.Action, recipe.Supplier, step.SelectorType, strings.Join(supportedSelectorTypes, ", "))
+		}
+		if err := validateStepFrame(step); err != nil {
+			return fmt.Errorf("step %d (%s) of recipe %s has an invalid frame `%s`: %w", i+1, step.Action, recipe.Supplier, step.Frame, err)
+		}
+		if step.PrintFallback && step.Action != "downloadAll" {
+			return fmt.Errorf("step %d (%s) of recipe %s uses `printFallback`, which is only supported by downloadAll", i+1, step.Action, recipe.Supplier)
+		}
+		if step.ViaNewTab && step.Action != "downloadAll" {
+			return fmt.Errorf("step %d (%s) of recipe %s uses `viaNewTab`, which is only supported by downloadAll", i+1, step.Action, recipe.Supplier)
+		}
+		if step.MaxFiles != nil && step.Action != "downloadAll" && step.Action != "downloadHrefs" && step.Action != "fetchDownload" {
+			return fmt.Errorf("step %d (%s) of recipe %s uses `maxFiles`, which is only supported by downloadAll, downloadHrefs and fetchDownload", i+1, step.Action, recipe.Supplier)
+		}
+		if err := ValidateMaxFiles(step.MaxFiles); err != nil {
+			return fmt.Errorf("step %d (%s) of recipe %s is invalid: %w", i+1, step.Action, recipe.Supplier, err)
+		}
+		if step.Expect != nil && step.Action != "runScript" && step.Action != actionHTTPLogin {
+			return fmt.Errorf("step %d (%s) of recipe %s uses `expect`, which is only supported by runScript and httpLogin", i+1, step.Action, recipe.Supplier)
+		}
+		if step.Action == "downloadAll" {
+			if err := validateDownloadStep(step); err != nil {
+				return fmt.Errorf("step %d (%s) of recipe %s is invalid: %w", i+1, step.Action, recipe.Supplier, err)
+			}
+		}
+		if step.Action == "fetchDownload" {
+			if err := validateFetchDownloadStep(step); err != nil {
+				return fmt.Errorf("step %d (%s) of recipe %s is invalid: %w", i+1, step.Action, recipe.Supplier, err)
+			}
+		}
+		if IsItemsAction(step.Action) {
+			if err := validateItemsStep(step); err != nil {
+				return fmt.Errorf("step %d (%s) of recipe %s is invalid: %w", i+1, step.Action, recipe.Supplier, err)
+			}
+		}
+		if step.Action == actionOauth2Setup {
+			if err := validateOauth2SetupStep(step); err != nil {
+				return fmt.Errorf("step %d (%s) of recipe %s is invalid: %w", i+1, step.Action, recipe.Supplier, err)
+			}
+		}
+		if err := validateHTTPStep(recipe, step); err != nil {
+			return fmt.Errorf("step %d (%s) of recipe %s is invalid: %w", i+1, step.Action, recipe.Supplier, err)
+		}
+		if len(step.Fallback) > 0 && step.Action != "waitForApproval" {
+			return fmt.Errorf("step %d (%s) of recipe %s uses `fallback`, which is only supported by waitForApproval", i+1, step.Action, recipe.Supplier)
+		}
+		if step.Action == "waitForApproval" {
+			if err := validateApprovalStep(recipe, i+1, step); err != nil {
+				return fmt.Errorf("step %d (%s) of recipe %s is invalid: %w", i+1, step.Action, recipe.Supplier, err)
+			}
+		}
+		if step.Action == "pollFor" {
+			if err := validatePollStep(step); err != nil {
+				return fmt.Errorf("step %d (%s) of recipe %s is invalid: %w", i+1, step.Action, recipe.Supplier, err)
+			}
+		}
+		if step.Action == "waitForNetworkIdle" {
+			if _, err := ParseNetworkIdleTimeout(step.Value); err != nil {
+				return fmt.Errorf("step %d (%s) of recipe %s has an invalid value: %w", i+1, step.Action, recipe.Supplier, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,211 @@
+package parser
+
+import (
+	"testing"
+)
+
+func TestInferSelectorType(t *testing.T) {
+	tests := []struct {
+		selector     string
+		expectedType string
+	}{
+		{"#login-button", SelectorTypeQuery},
+		{".invoice-list a", SelectorTypeQuery},
+		{"  #padded", SelectorTypeQuery},
+		{"//a[contains(@href, '.pdf')]", SelectorTypeXPath},
+		{"/html/body/div", SelectorTypeXPath},
+		{"(//a)[1]", SelectorTypeXPath},
+		{"./td/a", SelectorTypeXPath},
+		{".//a[contains(@href, '.pdf')]", SelectorTypeXPath},
+		{"../a", SelectorTypeXPath},
+		{"..", SelectorTypeXPath},
+		{".download", SelectorTypeQuery},
+		{"invoice-list >>> button.download", SelectorTypeShadow},
+		{"#app >>> a", SelectorTypeShadow},
+		{"Download invoice", ""},
+		{"input[name=email]", ""},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		result := InferSelectorType(test.selector)
+		if result != test.expectedType {
+			t.Errorf("InferSelectorType(%q) = %q; want %q", test.selector, result, test.expectedType)
+		}
+	}
+}
+
+func TestValidateRecipe(t *testing.T) {
+	expectOk := "ok"
+	noLimit, oneFile, negative := 0, 1, -1
+	tests := []struct {
+		name        string
+		steps       []Step
+		expectError bool
+	}{
+		{"no selector types", []Step{{Action: "open"}, {Action: "click", Selector: "Login"}}, false},
+		{"supported selector types", []Step{{Action: "click", Selector: "#a", SelectorType: "Query"}, {Action: "waitFor", Selector: "//a", SelectorType: "XPath"}}, false},
+		{"typo in selector type", []Step{{Action: "click", Selector: "//a", SelectorType: "Xpath"}}, true},
+		{"lowercase selector type", []Step{{Action: "click", Selector: "#a", SelectorType: "query"}}, true},
+		{"frame by name", []Step{{Action: "click", Selector: "#a", SelectorType: "Query", Frame: "invoices"}}, false},
+		{"frame by index", []Step{{Action: "downloadAll", Selector: "//a", SelectorType: "XPath", Frame: "1"}}, false},
+		{"frame of links", []Step{{Action: "downloadHrefs", Selector: "a.invoice", SelectorType: "Query", Frame: "invoices"}}, false},
+		{"negative frame index", []Step{{Action: "click", Selector: "#a", SelectorType: "Query", Frame: "-1"}}, true},
+		{"blank frame", []Step{{Action: "click", Selector: "#a", SelectorType: "Query", Frame: " "}}, true},
+		{"frame on unsupported action", []Step{{Action: "open", URL: "https://example.com", Frame: "0"}}, true},
+		{"download with defaults", []Step{{Action: "downloadAll"}}, false},
+		{"download with concurrency", []Step{{Action: "downloadAll", Concurrency: 1, SleepDuration: 3000}}, false},
+		{"download with negative concurrency", []Step{{Action: "downloadAll", Concurrency: -1}}, true},
+		{"download with negative sleep duration", []Step{{Action: "downloadAll", SleepDuration: -100}}, true},
+		{"download with max files", []Step{{Action: "downloadAll", MaxFiles: &oneFile}, {Action: "downloadHrefs", MaxFiles: &noLimit}}, false},
+		{"download with negative max files", []Step{{Action: "fetchDownload", Value: "[]", MaxFiles: &negative}}, true},
+		{"max files on unsupported action", []Step{{Action: "click", Selector: "#a", MaxFiles: &oneFile}}, true},
+		{"download with print fallback", []Step{{Action: "downloadAll", Selector: "a.print", PrintFallback: true}}, false},
+		{"print fallback on unsupported action", []Step{{Action: "click", Selector: "a.print", PrintFallback: true}}, true},
+		{"download via new tab", []Step{{Action: "downloadAll", Selector: "a.pdf", ViaNewTab: true}}, false},
+		{"new tab on unsupported action", []Step{{Action: "click", Selector: "a.pdf", ViaNewTab: true}}, true},
+		{"fetch download", []Step{{Action: "fetchDownload", Value: "['/api/invoices/1/pdf']", Headers: map[string]string{"Accept": "application/pdf"}}}, false},
+		{"fetch download without script", []Step{{Action: "fetchDownload", Value: " "}}, true},
+		{"fetch download with empty header name", []Step{{Action: "fetchDownload", Value: "[]", Headers: map[string]string{"": "x"}}}, true},
+		{"script with expectation", []Step{{Action: "runScript", Value: "'ok'", Expect: &expectOk}}, false},
+		{"expectation on unsupported action", []Step{{Action: "click", Selector: "#a", Expect: &expectOk}}, true},
+		{"network idle with default timeout", []Step{{Action: "waitForNetworkIdle"}}, false},
+		{"network idle with timeout", []Step{{Action: "waitForNetworkIdle", Value: "5"}}, false},
+		{"network idle with invalid timeout", []Step{{Action: "waitForNetworkIdle", Value: "5s"}}, true},
+		{"network idle with zero timeout", []Step{{Action: "waitForNetworkIdle", Value: "0"}}, true},
+		{"items with default method", []Step{{Action: "oauth2-post-and-get-items", Body: "{}"}}, false},
+		{"items with GET", []Step{{Action: "oauth2-request-items", Method: "get"}}, false},
+		{"items with unsupported method", []Step{{Action: "oauth2-request-items", Method: "DELETE"}}, true},
+		{"items with JSONPath", []Step{{Action: "oauth2-request-items", ExtractDocumentIds: "$.invoices[*].id", NextPagePath: "meta.next"}}, false},
+		{"items with invalid JSONPath", []Step{{Action: "oauth2-request-items", ExtractDocumentIds: "$.invoices[*"}}, true},
+		{"items with GET and body", []Step{{Action: "oauth2-request-items", Method: "GET", Body: "{}"}}, true},
+	}
+
+	for _, test := range tests {
+		err := ValidateRecipe(Recipe{Supplier: "example", Steps: test.steps})
+		if test.expectError && err == nil {
+			t.Errorf("%s: ValidateRecipe() returned no error; want an error", test.name)
+		}
+		if !test.expectError && err != nil {
+			t.Errorf("%s: ValidateRecipe() returned error %v; want no error", test.name, err)
+		}
+	}
+}
+
+func TestValidateRecipeViewport(t *testing.T) {
+	tests := []struct {
+		name        string
+		viewport    *Viewport
+		expectError bool
+	}{
+		{"no viewport", nil, false},
+		{"desktop viewport", &Viewport{Width: 1920, Height: 1080}, false},
+		{"mobile viewport", &Viewport{Width: 390, Height: 844, DeviceScaleFactor: 3, Mobile: true}, false},
+		{"missing height", &Viewport{Width: 1920}, true},
+		{"too wide", &Viewport{Width: 20000, Height: 1080}, true},
+		{"negative scale factor", &Viewport{Width: 390, Height: 844, DeviceScaleFactor: -1}, true},
+	}
+
+	for _, test := range tests {
+		err := ValidateRecipe(Recipe{Supplier: "example", Viewport: test.viewport})
+		if test.expectError && err == nil {
+			t.Errorf("%s: ValidateRecipe() returned no error; want an error", test.name)
+		}
+		if !test.expectError && err != nil {
+			t.Errorf("%s: ValidateRecipe() returned error %v; want no error", test.name, err)
+		}
+	}
+}
+
+func TestValidateRecipeClientCertificate(t *testing.T) {
+	tests := []struct {
+		name        string
+		recipe      Recipe
+		expectError bool
+	}{
+		{"client recipe", Recipe{Supplier: "example", Type: "client", ClientCertificate: true}, false},
+		{"browser recipe", Recipe{Supplier: "example", Type: "browser", ClientCertificate: true}, true},
+		{"browser recipe without client certificate", Recipe{Supplier: "example", Type: "browser"}, false},
+	}
+
+	for _, test := range tests {
+		err := ValidateRecipe(test.recipe)
+		if test.expectError && err == nil {
+			t.Errorf("%s: ValidateRecipe() returned no error; want an error", test.name)
+		}
+		if !test.expectError && err != nil {
+			t.Errorf("%s: ValidateRecipe() returned error %v; want no error", test.name, err)
+		}
+	}
+}
+
+func TestValidateRecipeApproval(t *testing.T) {
+	codeFallback := []Step{{Action: "click", Selector: "#use-code"}, {Action: "type", Selector: "#code", Value: "{{ totp }}"}}
+	tests := []struct {
+		name        string
+		step        Step
+		expectError bool
+	}{
+		{"approval with default timeout", Step{Action: "waitForApproval", Selector: "#dashboard"}, false},
+		{"approval with fallback", Step{Action: "waitForApproval", Selector: "#dashboard", Value: "90", Fallback: codeFallback}, false},
+		{"approval without selector", Step{Action: "waitForApproval", Value: "90"}, true},
+		{"approval with invalid timeout", Step{Action: "waitForApproval", Selector: "#dashboard", Value: "1m"}, true},
+		{"approval with too long timeout", Step{Action: "waitForApproval", Selector: "#dashboard", Value: "600"}, true},
+		{"invalid fallback step", Step{Action: "waitForApproval", Selector: "#dashboard", Fallback: []Step{{Action: "click", Selector: "//a", SelectorType: "Xpath"}}}, true},
+		{"nested approval", Step{Action: "waitForApproval", Selector: "#dashboard", Fallback: []Step{{Action: "waitForApproval", Selector: "#dashboard"}}}, true},
+		{"fallback on unsupported action", Step{Action: "waitFor", Selector: "#dashboard", Fallback: codeFallback}, true},
+	}
+
+	for _, test := range tests {
+		err := ValidateRecipe(Recipe{Supplier: "example", Steps: []Step{test.step}})
+		if test.expectError && err == nil {
+			t.Errorf("%s: ValidateRecipe() returned no error; want an error", test.name)
+		}
+		if !test.expectError && err != nil {
+			t.Errorf("%s: ValidateRecipe() returned error %s; want no error", test.name, err)
+		}
+	}
+}
+
+func TestValidateRecipePoll(t *testing.T) {
+	tests := []struct {
+		name        string
+		step        Step
+		expectError bool
+	}{
+		{"poll with default timeout", Step{Action: "pollFor", Selector: "a.download"}, false},
+		{"poll with timeout", Step{Action: "pollFor", Selector: "a.download", Value: "120"}, false},
+		{"poll without selector", Step{Action: "pollFor", Value: "120"}, true},
+		{"poll with invalid timeout", Step{Action: "pollFor", Selector: "a.download", Value: "2m"}, true},
+		{"poll with too long timeout", Step{Action: "pollFor", Selector: "a.download", Value: "600"}, true},
+	}
+
+	for _, test := range tests {
+		err := ValidateRecipe(Recipe{Supplier: "example", Steps: []Step{test.step}})
+		if test.expectError && err == nil {
+			t.Errorf("%s: ValidateRecipe() returned no error; want an error", test.name)
+		}
+		if !test.expectError && err != nil {
+			t.Errorf("%s: ValidateRecipe() returned error %s; want no error", test.name, err)
+		}
+	}
+}
+
+func TestValidateRecipeExpectedMimeType(t *testing.T) {
+	tests := []struct {
+		mimeType    string
+		expectError bool
+	}{
+		{"", false},
+		{"application/pdf", false},
+		{"*/*", false},
+		{"text/html", true},
+	}
+
+	for _, test := range tests {
+		err := ValidateRecipe(Recipe{Supplier: "example", Type: "browser", ExpectedMimeType: test.mimeType})
+		if (err != nil) != test.expectError {
+			t.Errorf("ValidateRecipe() with expectedMimeType `%s` returned error %v; want error %t", test.mimeType, err, test.expectError)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package parser
+
+import "strings"
+
+// SupplierFilter selects the suppliers to sync (see `buchhalter_suppliers_include` and `buchhalter_suppliers_exclude`).
+type SupplierFilter struct {
+	include map[string]bool
+	exclude map[string]bool
+}
+
+// NewSupplierFilter returns a filter that allows only the suppliers of include (if not empty) without the suppliers of exclude.
+// Suppliers are compared case-insensitive.
+func NewSupplierFilter(include, exclude []string) SupplierFilter {
+	return SupplierFilter{
+		include: supplierSet(include),
+		exclude: supplierSet(exclude),
+	}
+}
+
+func supplierSet(suppliers []string) map[string]bool {
+	set := map[string]bool{}
+	for _, supplier := range suppliers {
+		supplier = strings.ToLower(strings.TrimSpace(supplier))
+		if len(supplier) > 0 {
+			set[supplier] = true
+		}
+	}
+	return set
+}
+
+// Allows returns true if the recipe of supplier should run.
+func (f SupplierFilter) Allows(supplier string) bool {
+	supplier = strings.ToLower(strings.TrimSpace(supplier))
+	if f.exclude[supplier] {
+		return false
+	}
+	return len(f.include) == 0 || f.include[supplier]
+}
@@ -0,0 +1,29 @@
+package parser
+
+import "testing"
+
+func TestSupplierFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		include  []string
+		exclude  []string
+		supplier string
+		expected bool
+	}{
+		{"no lists", nil, nil, "hetzner", true},
+		{"included", []string{"hetzner", "aws"}, nil, "hetzner", true},
+		{"not included", []string{"hetzner", "aws"}, nil, "github", false},
+		{"included case-insensitive", []string{" Hetzner "}, nil, "hetzner", true},
+		{"excluded", nil, []string{"github"}, "github", false},
+		{"not excluded", nil, []string{"github"}, "hetzner", true},
+		{"exclude has precedence", []string{"hetzner"}, []string{"hetzner"}, "hetzner", false},
+		{"blank include entries are ignored", []string{""}, nil, "hetzner", true},
+	}
+
+	for _, test := range tests {
+		filter := NewSupplierFilter(test.include, test.exclude)
+		if allowed := filter.Allows(test.supplier); allowed != test.expected {
+			t.Errorf("%s: Allows(%q) = %t; want %t", test.name, test.supplier, allowed, test.expected)
+		}
+	}
+}
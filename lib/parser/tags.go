@@ -0,0 +1,32 @@
+package parser
+
+import "strings"
+
+// TagFilter selects the recipes to sync by their tags (see `buchhalter sync --tag`).
+type TagFilter struct {
+	tags map[string]bool
+}
+
+// NewTagFilter returns a filter that allows only recipes with at least one of tags, an empty list allows all recipes.
+// Tags are compared case-insensitive.
+func NewTagFilter(tags []string) TagFilter {
+	return TagFilter{tags: supplierSet(tags)}
+}
+
+// IsEmpty returns true if the filter allows all recipes.
+func (f TagFilter) IsEmpty() bool {
+	return len(f.tags) == 0
+}
+
+// Allows returns true if recipe has one of the tags of the filter.
+func (f TagFilter) Allows(recipe Recipe) bool {
+	if f.IsEmpty() {
+		return true
+	}
+	for _, tag := range recipe.Tags {
+		if f.tags[strings.ToLower(strings.TrimSpace(tag))] {
+			return true
+		}
+	}
+	return false
+}
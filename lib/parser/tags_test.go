@@ -0,0 +1,40 @@
+package parser
+
+import "testing"
+
+func TestTagFilter(t *testing.T) {
+	hosting := Recipe{Supplier: "hetzner", Tags: []string{"hosting", "EU"}}
+	saas := Recipe{Supplier: "notion", Tags: []string{"saas"}}
+	untagged := Recipe{Supplier: "private-hosting"}
+
+	tests := []struct {
+		name     string
+		tags     []string
+		recipe   Recipe
+		expected bool
+	}{
+		{"no tags", nil, untagged, true},
+		{"matching tag", []string{"hosting"}, hosting, true},
+		{"tag case-insensitive", []string{" eu "}, hosting, true},
+		{"one of multiple tags", []string{"hosting", "saas"}, saas, true},
+		{"other tag", []string{"hosting"}, saas, false},
+		{"untagged recipe", []string{"hosting"}, untagged, false},
+		{"empty tag", []string{""}, untagged, true},
+	}
+
+	for _, test := range tests {
+		filter := NewTagFilter(test.tags)
+		if allowed := filter.Allows(test.recipe); allowed != test.expected {
+			t.Errorf("%s: Allows(%s) = %t; want %t", test.name, test.recipe.Supplier, allowed, test.expected)
+		}
+	}
+}
+
+func TestValidateRecipeTags(t *testing.T) {
+	if err := ValidateRecipe(Recipe{Supplier: "example", Tags: []string{"hosting", "saas"}}); err != nil {
+		t.Errorf("ValidateRecipe() returned error %s; want no error", err)
+	}
+	if err := ValidateRecipe(Recipe{Supplier: "example", Tags: []string{"hosting", " "}}); err == nil {
+		t.Errorf("ValidateRecipe() with an empty tag returned no error; want an error")
+	}
+}
@@ -0,0 +1,37 @@
+package parser
+
+import "fmt"
+
+// viewportMaxSize is the maximum width and height of an emulated viewport (in CSS pixels).
+const viewportMaxSize = 10000
+
+// Viewport is the emulated screen of a browser recipe.
+// Some supplier portals offer simpler download flows in their mobile layout or hide elements in small windows.
+type Viewport struct {
+	Width  int64 `json:"width"`
+	Height int64 `json:"height"`
+	// DeviceScaleFactor is the device pixel ratio. 0 keeps the default of the browser.
+	DeviceScaleFactor float64 `json:"deviceScaleFactor,omitempty"`
+	// Mobile emulates a mobile device (meta viewport handling and touch events)
+	Mobile bool `json:"mobile,omitempty"`
+	// UserAgent overrides the user agent, e.g. with the one of a mobile browser
+	UserAgent string `json:"userAgent,omitempty"`
+}
+
+func validateViewport(viewport *Viewport) error {
+	if viewport == nil {
+		return nil
+	}
+
+	if viewport.Width <= 0 || viewport.Width > viewportMaxSize {
+		return fmt.Errorf("width %d must be between 1 and %d", viewport.Width, viewportMaxSize)
+	}
+	if viewport.Height <= 0 || viewport.Height > viewportMaxSize {
+		return fmt.Errorf("height %d must be between 1 and %d", viewport.Height, viewportMaxSize)
+	}
+	if viewport.DeviceScaleFactor < 0 {
+		return fmt.Errorf("deviceScaleFactor %f must not be negative", viewport.DeviceScaleFactor)
+	}
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package postprocess
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"buchhalter/lib/archive"
+	"buchhalter/lib/utils"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+)
+
+// Modes of the PDF merge post-processor
+const (
+	// MergeModeOff disables merging
+	MergeModeOff = "off"
+	// MergeModeAlongside stores the merged document next to its parts
+	MergeModeAlongside = "alongside"
+	// MergeModeReplace stores only the merged document and removes its parts
+	MergeModeReplace = "replace"
+)
+
+// PDFMerger merges the new PDF documents of a supplier per directory and month into a single document
+// named <supplier>-<YYYY-MM>.pdf. If the merged document exists already, the new documents are appended.
+type PDFMerger struct {
+	logger          *slog.Logger
+	documentArchive *archive.DocumentArchive
+	mode            string
+}
+
+func NewPDFMerger(logger *slog.Logger, documentArchive *archive.DocumentArchive, mode string) *PDFMerger {
+	return &PDFMerger{
+		logger:          logger,
+		documentArchive: documentArchive,
+		mode:            mode,
+	}
+}
+
+// IsSupportedMergeMode returns true if mode is a known mode of the PDF merge post-processor.
+func IsSupportedMergeMode(mode string) bool {
+	switch mode {
+	case MergeModeOff, MergeModeAlongside, MergeModeReplace:
+		return true
+	}
+	return false
+}
+
+func (m *PDFMerger) Name() string {
+	return "pdf-merge"
+}
+
+func (m *PDFMerger) Process(supplier string, newFiles []string) ([]string, error) {
+	if m.mode == MergeModeOff {
+		return nil, nil
+	}
+
+	groups, err := groupPDFsByMonth(newFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	groupKeys := make([]string, 0, len(groups))
+	for key := range groups {
+		groupKeys = append(groupKeys, key)
+	}
+	sort.Strings(groupKeys)
+
+	mergedFiles := []string{}
+	for _, key := range groupKeys {
+		group := groups[key]
+		mergedFile := filepath.Join(group.directory, fmt.Sprintf("%s-%s.pdf", supplier, group.month))
+
+		// A merged document of previous runs is extended
+		inputFiles := group.files
+		if _, err := os.Stat(mergedFile); err == nil {
+			inputFiles = append([]string{mergedFile}, inputFiles...)
+		}
+		// Merging a single new document into nothing doesn't make sense
+		if len(inputFiles) < 2 {
+			continue
+		}
+
+		m.logger.Info("Merging PDF documents", "supplier", supplier, "merged_file", mergedFile, "num_files", len(inputFiles))
+		if err := mergePDFs(inputFiles, mergedFile); err != nil {
+			return mergedFiles, err
+		}
+
+		m.documentArchive.RemoveFile(mergedFile)
+		if err := m.documentArchive.AddFile(mergedFile); err != nil {
+			return mergedFiles, fmt.Errorf("error adding merged document %s to document archive: %w", mergedFile, err)
+		}
+		mergedFiles = append(mergedFiles, mergedFile)
+
+		if m.mode == MergeModeReplace {
+			if err := m.removeParts(mergedFile, group.files); err != nil {
+				return mergedFiles, err
+			}
+		}
+	}
+
+	return mergedFiles, nil
+}
+
+// removeParts removes the merged documents and records their hashes in the document archive,
+// so they are not downloaded again.
+func (m *PDFMerger) removeParts(mergedFile string, parts []string) error {
+	partHashes := make([]string, 0, len(parts))
+	for _, part := range parts {
+		hash, err := archive.ComputeHash(part)
+		if err != nil {
+			return fmt.Errorf("error computing hash of %s: %w", part, err)
+		}
+		partHashes = append(partHashes, hash)
+	}
+
+	if err := m.documentArchive.RecordMergedParts(mergedFile, partHashes); err != nil {
+		return err
+	}
+
+	for _, part := range parts {
+		m.logger.Debug("Removing merged PDF document", "file", part, "merged_file", mergedFile)
+		if err := os.Remove(part); err != nil {
+			return fmt.Errorf("error removing merged document %s: %w", part, err)
+		}
+	}
+
+	return nil
+}
+
+type pdfGroup struct {
+	directory string
+	month     string
+	files     []string
+}
+
+// groupPDFsByMonth groups the PDF documents of files by their directory and the month of their modification time.
+func groupPDFsByMonth(files []string) (map[string]*pdfGroup, error) {
+	groups := map[string]*pdfGroup{}
+	for _, file := range files {
+		if strings.ToLower(filepath.Ext(file)) != ".pdf" {
+			continue
+		}
+
+		fileInfo, err := os.Stat(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading file info of %s: %w", file, err)
+		}
+
+		directory := filepath.Dir(file)
+		month := fileInfo.ModTime().Format("2006-01")
+		key := filepath.Join(directory, month)
+		if _, ok := groups[key]; !ok {
+			groups[key] = &pdfGroup{directory: directory, month: month}
+		}
+		groups[key].files = append(groups[key].files, file)
+	}
+
+	return groups, nil
+}
+
+// mergePDFs merges inputFiles into outputFile.
+// The result is written to a hidden temporary file first, so an existing outputFile stays intact on errors.
+func mergePDFs(inputFiles []string, outputFile string) error {
+	tmpFile := filepath.Join(filepath.Dir(outputFile), "."+filepath.Base(outputFile)+".tmp")
+	if err := api.MergeCreateFile(inputFiles, tmpFile, false, utils.PDFConfiguration()); err != nil {
+		_ = os.Remove(tmpFile)
+		return fmt.Errorf("error merging PDF documents into %s: %w", outputFile, err)
+	}
+
+	if err := os.Rename(tmpFile, outputFile); err != nil {
+		_ = os.Remove(tmpFile)
+		return fmt.Errorf("error moving merged PDF document to %s: %w", outputFile, err)
+	}
+
+	return nil
+}
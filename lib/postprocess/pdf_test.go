@@ -0,0 +1,176 @@
+package postprocess
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"buchhalter/lib/archive"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+)
+
+// writeTestPDF writes a minimal PDF document with a single (empty) page.
+func writeTestPDF(t *testing.T, path, title string) {
+	t.Helper()
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 200 200] >>",
+		fmt.Sprintf("<< /Title (%s) >>", title),
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xrefOffset := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info 4 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xrefOffset)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("error creating directory: %s", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("error writing PDF: %s", err)
+	}
+}
+
+func pageCount(t *testing.T, path string) int {
+	t.Helper()
+
+	pages, err := api.PageCountFile(path)
+	if err != nil {
+		t.Fatalf("error counting pages of %s: %s", path, err)
+	}
+	return pages
+}
+
+func TestMergePDFs(t *testing.T) {
+	directory := t.TempDir()
+	first := filepath.Join(directory, "first.pdf")
+	second := filepath.Join(directory, "second.pdf")
+	writeTestPDF(t, first, "first")
+	writeTestPDF(t, second, "second")
+
+	merged := filepath.Join(directory, "merged.pdf")
+	if err := mergePDFs([]string{first, second}, merged); err != nil {
+		t.Fatalf("mergePDFs() returned error: %s", err)
+	}
+	if pages := pageCount(t, merged); pages != 2 {
+		t.Errorf("merged document has %d pages; want 2", pages)
+	}
+	if _, err := os.Stat(filepath.Join(directory, ".merged.pdf.tmp")); !os.IsNotExist(err) {
+		t.Errorf("temporary file of the merge was not removed")
+	}
+}
+
+func TestPDFMergerProcess(t *testing.T) {
+	tests := []struct {
+		mode          string
+		expectedFiles []string
+	}{
+		{mode: MergeModeOff, expectedFiles: []string{"first.pdf", "notes.txt", "second.pdf"}},
+		{mode: MergeModeAlongside, expectedFiles: []string{"first.pdf", "hetzner-2024-05.pdf", "notes.txt", "second.pdf"}},
+		{mode: MergeModeReplace, expectedFiles: []string{".buchhalter-merged.json", "hetzner-2024-05.pdf", "notes.txt"}},
+	}
+
+	for _, test := range tests {
+		documentsDirectory := t.TempDir()
+		supplierDirectory := filepath.Join(documentsDirectory, "hetzner")
+		newFiles := []string{
+			filepath.Join(supplierDirectory, "first.pdf"),
+			filepath.Join(supplierDirectory, "second.pdf"),
+		}
+		writeTestPDF(t, newFiles[0], "first")
+		writeTestPDF(t, newFiles[1], "second")
+		notes := filepath.Join(supplierDirectory, "notes.txt")
+		if err := os.WriteFile(notes, []byte("not a PDF"), 0644); err != nil {
+			t.Fatalf("error writing file: %s", err)
+		}
+		newFiles = append(newFiles, notes)
+
+		modTime := time.Date(2024, time.May, 10, 12, 0, 0, 0, time.Local)
+		for _, file := range newFiles {
+			if err := os.Chtimes(file, modTime, modTime); err != nil {
+				t.Fatalf("error setting modification time: %s", err)
+			}
+		}
+
+		documentArchive := archive.NewDocumentArchive(slog.Default(), documentsDirectory, archive.LayoutSupplier)
+		if err := documentArchive.BuildArchiveIndex(); err != nil {
+			t.Fatalf("BuildArchiveIndex() returned error: %s", err)
+		}
+		// Copies of the parts (outside of the archive) to check if the archive still knows them afterwards
+		partCopies := []string{}
+		for _, file := range newFiles[:2] {
+			content, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatalf("error reading file: %s", err)
+			}
+			partCopy := filepath.Join(t.TempDir(), filepath.Base(file))
+			if err := os.WriteFile(partCopy, content, 0644); err != nil {
+				t.Fatalf("error writing file: %s", err)
+			}
+			partCopies = append(partCopies, partCopy)
+		}
+
+		merger := NewPDFMerger(slog.Default(), documentArchive, test.mode)
+		mergedFiles, err := merger.Process("hetzner", newFiles)
+		if err != nil {
+			t.Fatalf("%s: Process() returned error: %s", test.mode, err)
+		}
+
+		entries, err := os.ReadDir(supplierDirectory)
+		if err != nil {
+			t.Fatalf("error reading supplier directory: %s", err)
+		}
+		files := []string{}
+		for _, entry := range entries {
+			files = append(files, entry.Name())
+		}
+		if fmt.Sprint(files) != fmt.Sprint(test.expectedFiles) {
+			t.Errorf("%s: supplier directory contains %v; want %v", test.mode, files, test.expectedFiles)
+		}
+
+		if test.mode == MergeModeOff {
+			if len(mergedFiles) != 0 {
+				t.Errorf("%s: Process() = %v; want no merged files", test.mode, mergedFiles)
+			}
+			continue
+		}
+		if len(mergedFiles) != 1 {
+			t.Fatalf("%s: Process() = %v; want one merged file", test.mode, mergedFiles)
+		}
+		if pages := pageCount(t, mergedFiles[0]); pages != 2 {
+			t.Errorf("%s: merged document has %d pages; want 2", test.mode, pages)
+		}
+		if !documentArchive.FileExists(mergedFiles[0]) {
+			t.Errorf("%s: merged document is not part of the archive index", test.mode)
+		}
+
+		// The parts are known to the archive, even after a rebuild of its index
+		rebuiltArchive := archive.NewDocumentArchive(slog.Default(), documentsDirectory, archive.LayoutSupplier)
+		if err := rebuiltArchive.BuildArchiveIndex(); err != nil {
+			t.Fatalf("BuildArchiveIndex() returned error: %s", err)
+		}
+		for _, a := range []*archive.DocumentArchive{documentArchive, rebuiltArchive} {
+			for _, partCopy := range partCopies {
+				if !a.FileExists(partCopy) {
+					t.Errorf("%s: merged document %s is unknown to the archive", test.mode, filepath.Base(partCopy))
+				}
+			}
+		}
+	}
+}
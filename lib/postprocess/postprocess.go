@@ -0,0 +1,11 @@
+package postprocess
+
+// PostProcessor processes the new documents of a supplier after a successful recipe run.
+type PostProcessor interface {
+	// Name returns a short name of the post-processor, used in logs and status updates
+	Name() string
+
+	// Process processes the new documents (paths in the local storage) of supplier.
+	// It returns the paths of the documents created by the post-processor.
+	Process(supplier string, newFiles []string) ([]string, error)
+}
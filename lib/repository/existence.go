@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultExistenceCheckChunkSize is the default number of checksums per chunk of DocumentsExist.
+	DefaultExistenceCheckChunkSize = 100
+	// DefaultExistenceCheckConcurrency is the default number of chunks DocumentsExist checks in parallel.
+	DefaultExistenceCheckConcurrency = 4
+	// DefaultExistenceCheckTimeout is the default timeout of a single existence check request.
+	DefaultExistenceCheckTimeout = 10 * time.Second
+	// DefaultExistenceCheckAttempts is the default number of attempts of an existence check (incl. the first one).
+	DefaultExistenceCheckAttempts = 3
+	// defaultExistenceCheckBackoff is the wait time before the first retry of an existence check, it doubles with every retry
+	defaultExistenceCheckBackoff = 500 * time.Millisecond
+)
+
+// SetExistenceCheckTimeout sets the timeout of a single existence check request (a timeout <= 0 keeps the current one).
+func (c *BuchhalterAPIClient) SetExistenceCheckTimeout(timeout time.Duration) {
+	if timeout > 0 {
+		c.existenceTimeout = timeout
+	}
+}
+
+// SetExistenceCheckAttempts sets the number of attempts of an existence check (incl. the first one, at least 1).
+func (c *BuchhalterAPIClient) SetExistenceCheckAttempts(attempts int) {
+	c.existenceAttempts = max(attempts, 1)
+}
+
+// ValidateExistenceCheckOptions checks the chunk size and concurrency of DocumentsExist
+// (e.g. of `buchhalter_upload_existence_chunk_size` and `buchhalter_upload_existence_concurrency`).
+func ValidateExistenceCheckOptions(chunkSize, concurrency int) error {
+	if chunkSize < 1 {
+		return fmt.Errorf("chunk size must be at least 1, got %d", chunkSize)
+	}
+	if concurrency < 1 || concurrency > 32 {
+		return fmt.Errorf("concurrency must be between 1 and 32, got %d", concurrency)
+	}
+	return nil
+}
+
+// DocumentsExist checks the existence of documents (by checksum) in Buchhalter API.
+// The checksums are sorted, deduplicated and split into chunks of chunkSize, up to concurrency chunks are checked in parallel.
+// Buchhalter API has no batch endpoint (yet), so the checksums of a chunk are checked one by one.
+//
+// Checks failing with temporary errors (timeouts, network errors, server errors and rate limits) are retried (see SetExistenceCheckAttempts).
+//
+// The returned map contains the checksums that could be checked (checksum => exists).
+// Failed checks don't stop the other checks: their checksums are missing in the map and the errors are returned (joined, in order of the checksums).
+func (c *BuchhalterAPIClient) DocumentsExist(checksums []string, chunkSize, concurrency int) (map[string]bool, error) {
+	if err := ValidateExistenceCheckOptions(chunkSize, concurrency); err != nil {
+		return nil, err
+	}
+
+	// The team is selected once, before the chunks are checked in parallel
+	if _, err := c.teamID(); len(checksums) > 0 && err != nil {
+		return nil, err
+	}
+
+	chunks := chunkChecksums(checksums, chunkSize)
+	results := make([]map[string]bool, len(chunks))
+	errs := make([]error, len(chunks))
+
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, concurrency)
+	for i, chunk := range chunks {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int, chunk []string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			c.logger.Debug("Checking document existence of chunk", "chunk", i+1, "num_chunks", len(chunks), "num_checksums", len(chunk))
+			results[i], errs[i] = c.documentsExistChunk(chunk)
+		}(i, chunk)
+	}
+	wg.Wait()
+
+	// Merge the chunks in their order, to not depend on the scheduling of the goroutines
+	existence := map[string]bool{}
+	for _, result := range results {
+		for checksum, exists := range result {
+			existence[checksum] = exists
+		}
+	}
+
+	return existence, errors.Join(errs...)
+}
+
+// documentsExistChunk checks the existence of the documents of one chunk.
+// The result contains the successfully checked checksums, even if other checks of the chunk failed.
+func (c *BuchhalterAPIClient) documentsExistChunk(checksums []string) (map[string]bool, error) {
+	existence := make(map[string]bool, len(checksums))
+	var errs []error
+	for _, checksum := range checksums {
+		var exists bool
+		err := withRetry(context.Background(), c.existenceAttempts, c.existenceBackoff, func() error {
+			var err error
+			exists, err = c.DoesDocumentExist(checksum)
+			return err
+		}, func(attempt int, backoff time.Duration, err error) {
+			c.logger.Warn("Error checking document existence, retrying", "checksum", checksum, "attempt", attempt, "max_attempts", c.existenceAttempts, "backoff", backoff, "error", err)
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error checking existence of document %s: %w", checksum, err))
+			continue
+		}
+		existence[checksum] = exists
+	}
+
+	return existence, errors.Join(errs...)
+}
+
+// chunkChecksums returns the sorted, unique checksums in chunks of up to chunkSize checksums.
+func chunkChecksums(checksums []string, chunkSize int) [][]string {
+	unique := make([]string, 0, len(checksums))
+	seen := make(map[string]bool, len(checksums))
+	for _, checksum := range checksums {
+		if seen[checksum] {
+			continue
+		}
+		seen[checksum] = true
+		unique = append(unique, checksum)
+	}
+	sort.Strings(unique)
+
+	chunks := [][]string{}
+	for start := 0; start < len(unique); start += chunkSize {
+		end := min(start+chunkSize, len(unique))
+		chunks = append(chunks, unique[start:end])
+	}
+
+	return chunks
+}
@@ -0,0 +1,229 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type existenceMockAPI struct {
+	existing map[string]bool
+	failing  map[string]bool
+
+	inFlight    atomic.Int32
+	maxInFlight atomic.Int32
+	mu          sync.Mutex
+	requests    int
+}
+
+func (m *existenceMockAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	inFlight := m.inFlight.Add(1)
+	defer m.inFlight.Add(-1)
+	for {
+		maxInFlight := m.maxInFlight.Load()
+		if inFlight <= maxInFlight || m.maxInFlight.CompareAndSwap(maxInFlight, inFlight) {
+			break
+		}
+	}
+	m.mu.Lock()
+	m.requests++
+	m.mu.Unlock()
+
+	if r.URL.Path != "/api/cli/team-1/check" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	var payload struct {
+		FileChecksum string `json:"file_checksum"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if m.failing[payload.FileChecksum] {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	status := "new"
+	if m.existing[payload.FileChecksum] {
+		status = "exists"
+	}
+	_ = json.NewEncoder(w).Encode(DocumentCheckResponse{Status: status})
+}
+
+func newExistenceTestClient(t *testing.T, handler http.Handler) *BuchhalterAPIClient {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	c, err := NewBuchhalterAPIClient(slog.Default(), server.URL, t.TempDir(), "token", "0.0.0-test")
+	if err != nil {
+		t.Fatalf("NewBuchhalterAPIClient() returned error: %s", err)
+	}
+	c.authenticatedUser = AuthenticatedUser{Teams: []Team{{ID: "team-1"}}}
+	c.existenceBackoff = time.Millisecond
+
+	return c
+}
+
+func TestDocumentsExist(t *testing.T) {
+	api := &existenceMockAPI{existing: map[string]bool{}, failing: map[string]bool{}}
+	checksums := []string{}
+	for i := 0; i < 1000; i++ {
+		checksum := fmt.Sprintf("%064x", i)
+		checksums = append(checksums, checksum)
+		if i%3 == 0 {
+			api.existing[checksum] = true
+		}
+	}
+	// Duplicates are checked once
+	checksums = append(checksums, checksums[:10]...)
+	// Failures of single checks don't fail the rest of their chunk
+	api.failing[checksums[42]] = true
+	api.failing[checksums[777]] = true
+
+	c := newExistenceTestClient(t, api)
+	existence, err := c.DocumentsExist(checksums, 50, 4)
+
+	if err == nil {
+		t.Fatalf("DocumentsExist() returned no error; want the errors of the failed checks")
+	}
+	if !strings.Contains(err.Error(), checksums[42]) || !strings.Contains(err.Error(), checksums[777]) {
+		t.Errorf("DocumentsExist() error = %s; want the failed checksums", err)
+	}
+	// The errors are ordered by checksum
+	if strings.Index(err.Error(), checksums[42]) > strings.Index(err.Error(), checksums[777]) {
+		t.Errorf("DocumentsExist() error = %s; want the errors in order of the checksums", err)
+	}
+	if len(existence) != 998 {
+		t.Errorf("DocumentsExist() returned %d checksums; want 998", len(existence))
+	}
+	for i, checksum := range checksums[:1000] {
+		exists, ok := existence[checksum]
+		if api.failing[checksum] {
+			if ok {
+				t.Errorf("DocumentsExist() contains failed checksum %s", checksum)
+			}
+			continue
+		}
+		if !ok || exists != (i%3 == 0) {
+			t.Errorf("DocumentsExist()[%s] = %t, %t; want %t", checksum, exists, ok, i%3 == 0)
+		}
+	}
+	// The failed checks are retried twice
+	if api.requests != 1004 {
+		t.Errorf("DocumentsExist() sent %d requests; want 1004", api.requests)
+	}
+	if maxInFlight := api.maxInFlight.Load(); maxInFlight > 4 {
+		t.Errorf("DocumentsExist() sent %d requests in parallel; want at most 4", maxInFlight)
+	}
+}
+
+func TestDocumentsExistInvalidOptions(t *testing.T) {
+	c := newExistenceTestClient(t, http.NotFoundHandler())
+
+	tests := []struct {
+		chunkSize   int
+		concurrency int
+	}{
+		{0, 4},
+		{100, 0},
+		{100, 33},
+	}
+
+	for _, test := range tests {
+		if _, err := c.DocumentsExist([]string{"abc"}, test.chunkSize, test.concurrency); err == nil {
+			t.Errorf("DocumentsExist(chunkSize %d, concurrency %d) returned no error; want an error", test.chunkSize, test.concurrency)
+		}
+	}
+}
+
+// flakyExistenceAPI fails the first failures requests of every checksum with status.
+type flakyExistenceAPI struct {
+	failures int
+	status   int
+	delay    time.Duration
+
+	mu       sync.Mutex
+	requests map[string]int
+}
+
+func (m *flakyExistenceAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		FileChecksum string `json:"file_checksum"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	m.mu.Lock()
+	m.requests[payload.FileChecksum]++
+	request := m.requests[payload.FileChecksum]
+	m.mu.Unlock()
+
+	if request <= m.failures {
+		time.Sleep(m.delay)
+		w.WriteHeader(m.status)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(DocumentCheckResponse{Status: "exists"})
+}
+
+func TestDocumentsExistRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		api      *flakyExistenceAPI
+		attempts int
+		timeout  time.Duration
+		checked  bool
+		requests int
+	}{
+		{"server error", &flakyExistenceAPI{failures: 2, status: http.StatusServiceUnavailable}, 3, 0, true, 3},
+		{"rate limit", &flakyExistenceAPI{failures: 1, status: http.StatusTooManyRequests}, 3, 0, true, 2},
+		{"timeout", &flakyExistenceAPI{failures: 1, status: http.StatusOK, delay: 200 * time.Millisecond}, 2, 50 * time.Millisecond, true, 2},
+		{"attempts used up", &flakyExistenceAPI{failures: 3, status: http.StatusBadGateway}, 3, 0, false, 3},
+		{"single attempt", &flakyExistenceAPI{failures: 1, status: http.StatusInternalServerError}, 1, 0, false, 1},
+		{"client error", &flakyExistenceAPI{failures: 1, status: http.StatusUnauthorized}, 3, 0, false, 1},
+	}
+
+	for _, test := range tests {
+		test.api.requests = map[string]int{}
+		c := newExistenceTestClient(t, test.api)
+		c.SetExistenceCheckAttempts(test.attempts)
+		c.SetExistenceCheckTimeout(test.timeout)
+
+		existence, err := c.DocumentsExist([]string{"abc", "def"}, 1, 2)
+		for _, checksum := range []string{"abc", "def"} {
+			if exists, ok := existence[checksum]; ok != test.checked || (ok && !exists) {
+				t.Errorf("%s: DocumentsExist()[%s] = %t, %t; want %t, %t", test.name, checksum, exists, ok, test.checked, test.checked)
+			}
+			if requests := test.api.requests[checksum]; requests != test.requests {
+				t.Errorf("%s: DocumentsExist() sent %d requests for %s; want %d", test.name, requests, checksum, test.requests)
+			}
+		}
+		if (err == nil) != test.checked {
+			t.Errorf("%s: DocumentsExist() returned error %v", test.name, err)
+		}
+	}
+}
+
+func TestChunkChecksums(t *testing.T) {
+	chunks := chunkChecksums([]string{"d", "b", "a", "b", "e", "c"}, 2)
+	expected := [][]string{{"a", "b"}, {"c", "d"}, {"e"}}
+
+	if fmt.Sprint(chunks) != fmt.Sprint(expected) {
+		t.Errorf("chunkChecksums() = %v; want %v", chunks, expected)
+	}
+	if chunks := chunkChecksums(nil, 2); len(chunks) != 0 {
+		t.Errorf("chunkChecksums(nil) = %v; want no chunks", chunks)
+	}
+}
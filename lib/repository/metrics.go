@@ -0,0 +1,198 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// MetricsDecision is what happens with the usage metrics at the end of a sync.
+type MetricsDecision int
+
+const (
+	// MetricsDecisionSkip sends no metrics and doesn't ask (development mode or recipe file)
+	MetricsDecisionSkip MetricsDecision = iota
+	// MetricsDecisionSend sends the metrics without asking (`buchhalter_always_send_metrics`)
+	MetricsDecisionSend
+	// MetricsDecisionPrompt asks the user whether to send the metrics (see MetricsAnswers)
+	MetricsDecisionPrompt
+	// MetricsDecisionDecline sends no metrics, because nobody can answer the prompt (quiet mode)
+	MetricsDecisionDecline
+	// MetricsDecisionOptOut sends no metrics and doesn't ask, regardless of the consent (`--no-metrics` or `DO_NOT_TRACK`)
+	MetricsDecisionOptOut
+)
+
+// Answers of the metrics prompt
+const (
+	MetricsAnswerYes    = "Yes"
+	MetricsAnswerNo     = "No"
+	MetricsAnswerAlways = "Always yes (don't ask again)"
+)
+
+// MetricsAnswers are the answers of the metrics prompt, in the order they are shown
+var MetricsAnswers = []string{MetricsAnswerYes, MetricsAnswerNo, MetricsAnswerAlways}
+
+// MetricsSender sends the usage metrics of a run (see BuchhalterAPIClient.SendMetrics).
+type MetricsSender interface {
+	SendMetrics(ctx context.Context, runData RunData, cliVersion, chromeVersion, vaultVersion, oicdbVersion string) error
+}
+
+// MetricsReporterConfig are the settings of a sync the metrics decision depends on.
+type MetricsReporterConfig struct {
+	// AlwaysSend is the consent to always send the metrics (`buchhalter_always_send_metrics`)
+	AlwaysSend bool
+	// DevelopmentMode and RecipeFile runs are not part of the usage metrics (recipe files are often private recipes)
+	DevelopmentMode bool
+	RecipeFile      bool
+	// Interactive is false, if nobody can answer the prompt (quiet mode)
+	Interactive bool
+	// OptOut disables the metrics of the run, also with AlwaysSend (`--no-metrics` or `DO_NOT_TRACK`, see DoNotTrack)
+	OptOut bool
+}
+
+// DoNotTrack returns true if the `DO_NOT_TRACK` environment variable opts out of telemetry (https://consoledonottrack.com).
+// Every value except an empty value, `0` and `false` opts out.
+func DoNotTrack() bool {
+	value := strings.ToLower(strings.TrimSpace(os.Getenv("DO_NOT_TRACK")))
+	return len(value) > 0 && value != "0" && value != "false"
+}
+
+// MetricsReporter decides whether the usage metrics of a sync are sent and sends them.
+// It is independent of the UI, the UI only shows the prompt and the results.
+type MetricsReporter struct {
+	sender MetricsSender
+	config MetricsReporterConfig
+
+	// storeConsent persists the answer MetricsAnswerAlways (e.g. in the configuration file)
+	storeConsent func() error
+}
+
+// NewMetricsReporter returns a reporter sending the metrics via sender.
+func NewMetricsReporter(sender MetricsSender, config MetricsReporterConfig, storeConsent func() error) *MetricsReporter {
+	return &MetricsReporter{
+		sender:       sender,
+		config:       config,
+		storeConsent: storeConsent,
+	}
+}
+
+// Decide returns what happens with the usage metrics of the run.
+func (r *MetricsReporter) Decide() MetricsDecision {
+	switch {
+	case r.config.OptOut:
+		return MetricsDecisionOptOut
+	case r.config.DevelopmentMode || r.config.RecipeFile:
+		return MetricsDecisionSkip
+	case r.config.AlwaysSend:
+		return MetricsDecisionSend
+	case !r.config.Interactive:
+		return MetricsDecisionDecline
+	default:
+		return MetricsDecisionPrompt
+	}
+}
+
+// Send sends the usage metrics.
+// A timeout is returned as ErrMetricsTimeout (a cancellation as ErrMetricsCanceled), both are no failure of the sync.
+func (r *MetricsReporter) Send(ctx context.Context, runData RunData, cliVersion, chromeVersion, vaultVersion, oicdbVersion string) error {
+	err := r.sender.SendMetrics(ctx, runData, cliVersion, chromeVersion, vaultVersion, oicdbVersion)
+	if err != nil && !errors.Is(err, ErrMetricsTimeout) && !errors.Is(err, ErrMetricsCanceled) {
+		return fmt.Errorf("error sending usage metrics to Buchhalter API: %w", err)
+	}
+	return err
+}
+
+// Answer handles the answer of the metrics prompt (see MetricsAnswers) and returns whether the metrics were sent.
+// With MetricsAnswerAlways, the consent is stored even if the metrics endpoint timed out.
+func (r *MetricsReporter) Answer(ctx context.Context, answer string, runData RunData, cliVersion, chromeVersion, vaultVersion, oicdbVersion string) (bool, error) {
+	switch answer {
+	case MetricsAnswerYes, MetricsAnswerAlways:
+	case MetricsAnswerNo:
+		return false, nil
+	default:
+		return false, fmt.Errorf("unknown answer `%s` for sending usage metrics", answer)
+	}
+
+	sendErr := r.Send(ctx, runData, cliVersion, chromeVersion, vaultVersion, oicdbVersion)
+	if sendErr != nil && !errors.Is(sendErr, ErrMetricsTimeout) && !errors.Is(sendErr, ErrMetricsCanceled) {
+		return true, sendErr
+	}
+	if answer == MetricsAnswerAlways && r.storeConsent != nil {
+		if err := r.storeConsent(); err != nil {
+			return true, fmt.Errorf("error writing config file with value buchhalter_always_send_metrics=true: %w", err)
+		}
+	}
+
+	return true, sendErr
+}
+
+// MetricsSnapshot are the usage metrics collected by a MetricsAccumulator at one point in time.
+type MetricsSnapshot struct {
+	RunData       RunData
+	CliVersion    string
+	ChromeVersion string
+	VaultVersion  string
+	OicdbVersion  string
+}
+
+// MetricsAccumulator collects the usage metrics of a sync.
+// It is safe for concurrent use: the recipes are run in their own goroutine, while the UI sends the metrics (see Snapshot).
+type MetricsAccumulator struct {
+	mu      sync.Mutex
+	metrics MetricsSnapshot
+}
+
+// NewMetricsAccumulator returns an empty accumulator.
+func NewMetricsAccumulator() *MetricsAccumulator {
+	return &MetricsAccumulator{
+		metrics: MetricsSnapshot{RunData: RunData{}},
+	}
+}
+
+// SetCliVersion sets the version of the CLI, an empty version keeps the current one.
+func (a *MetricsAccumulator) SetCliVersion(version string) {
+	a.setVersion(&a.metrics.CliVersion, version)
+}
+
+// SetChromeVersion sets the version of Chrome, an empty version keeps the current one (e.g. of a recipe without a browser).
+func (a *MetricsAccumulator) SetChromeVersion(version string) {
+	a.setVersion(&a.metrics.ChromeVersion, version)
+}
+
+// SetVaultVersion sets the version of the credential provider, an empty version keeps the current one.
+func (a *MetricsAccumulator) SetVaultVersion(version string) {
+	a.setVersion(&a.metrics.VaultVersion, version)
+}
+
+// SetOicdbVersion sets the version of the recipe database, an empty version keeps the current one.
+func (a *MetricsAccumulator) SetOicdbVersion(version string) {
+	a.setVersion(&a.metrics.OicdbVersion, version)
+}
+
+func (a *MetricsAccumulator) setVersion(field *string, version string) {
+	if len(version) == 0 {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	*field = version
+}
+
+// AddRunData adds the result of a recipe run.
+func (a *MetricsAccumulator) AddRunData(record RunDataSupplier) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.metrics.RunData = append(a.metrics.RunData, record)
+}
+
+// Snapshot returns a copy of the collected metrics, later updates don't change it.
+func (a *MetricsAccumulator) Snapshot() MetricsSnapshot {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	snapshot := a.metrics
+	snapshot.RunData = append(RunData{}, a.metrics.RunData...)
+	return snapshot
+}
@@ -0,0 +1,177 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+type metricsSenderMock struct {
+	err   error
+	calls int
+}
+
+func (m *metricsSenderMock) SendMetrics(_ context.Context, _ RunData, _, _, _, _ string) error {
+	m.calls++
+	return m.err
+}
+
+func TestMetricsReporterDecide(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   MetricsReporterConfig
+		expected MetricsDecision
+	}{
+		{"ask", MetricsReporterConfig{Interactive: true}, MetricsDecisionPrompt},
+		{"always", MetricsReporterConfig{AlwaysSend: true, Interactive: true}, MetricsDecisionSend},
+		{"always in quiet mode", MetricsReporterConfig{AlwaysSend: true}, MetricsDecisionSend},
+		{"quiet mode", MetricsReporterConfig{}, MetricsDecisionDecline},
+		{"development mode", MetricsReporterConfig{AlwaysSend: true, DevelopmentMode: true, Interactive: true}, MetricsDecisionSkip},
+		{"recipe file", MetricsReporterConfig{RecipeFile: true, Interactive: true}, MetricsDecisionSkip},
+		{"opt-out", MetricsReporterConfig{OptOut: true, Interactive: true}, MetricsDecisionOptOut},
+		{"opt-out with consent", MetricsReporterConfig{AlwaysSend: true, OptOut: true}, MetricsDecisionOptOut},
+	}
+
+	for _, test := range tests {
+		reporter := NewMetricsReporter(&metricsSenderMock{}, test.config, nil)
+		if decision := reporter.Decide(); decision != test.expected {
+			t.Errorf("%s: Decide() = %d; want %d", test.name, decision, test.expected)
+		}
+	}
+}
+
+func TestDoNotTrack(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected bool
+	}{
+		{"", false},
+		{"0", false},
+		{"false", false},
+		{"1", true},
+		{"true", true},
+		{" yes ", true},
+	}
+
+	for _, test := range tests {
+		t.Setenv("DO_NOT_TRACK", test.value)
+		if doNotTrack := DoNotTrack(); doNotTrack != test.expected {
+			t.Errorf("DoNotTrack() with DO_NOT_TRACK=%q = %t; want %t", test.value, doNotTrack, test.expected)
+		}
+	}
+}
+
+func TestMetricsReporterAnswer(t *testing.T) {
+	timeoutErr := fmt.Errorf("%w after 5s", ErrMetricsTimeout)
+	tests := []struct {
+		name            string
+		answer          string
+		sendErr         error
+		storeErr        error
+		expectedSent    bool
+		expectedCalls   int
+		expectedStored  bool
+		expectedErr     error
+		expectedFailure bool
+	}{
+		{"yes", MetricsAnswerYes, nil, nil, true, 1, false, nil, false},
+		{"no", MetricsAnswerNo, nil, nil, false, 0, false, nil, false},
+		{"always", MetricsAnswerAlways, nil, nil, true, 1, true, nil, false},
+		{"always with timeout", MetricsAnswerAlways, timeoutErr, nil, true, 1, true, ErrMetricsTimeout, false},
+		{"yes with cancellation", MetricsAnswerYes, ErrMetricsCanceled, nil, true, 1, false, ErrMetricsCanceled, false},
+		{"always with error", MetricsAnswerAlways, errors.New("status code 500"), nil, true, 1, false, nil, true},
+		{"always with config error", MetricsAnswerAlways, nil, errors.New("read-only file system"), true, 1, true, nil, true},
+		{"unknown answer", "Maybe", nil, nil, false, 0, false, nil, true},
+	}
+
+	for _, test := range tests {
+		sender := &metricsSenderMock{err: test.sendErr}
+		stored := false
+		reporter := NewMetricsReporter(sender, MetricsReporterConfig{Interactive: true}, func() error {
+			stored = true
+			return test.storeErr
+		})
+
+		sent, err := reporter.Answer(context.Background(), test.answer, RunData{}, "1.0.0", "", "", "")
+		if sent != test.expectedSent {
+			t.Errorf("%s: Answer() sent = %t; want %t", test.name, sent, test.expectedSent)
+		}
+		if sender.calls != test.expectedCalls {
+			t.Errorf("%s: Answer() sent the metrics %d times; want %d", test.name, sender.calls, test.expectedCalls)
+		}
+		if stored != test.expectedStored {
+			t.Errorf("%s: Answer() stored the consent = %t; want %t", test.name, stored, test.expectedStored)
+		}
+		if test.expectedErr != nil && !errors.Is(err, test.expectedErr) {
+			t.Errorf("%s: Answer() returned error %v; want %v", test.name, err, test.expectedErr)
+		}
+		failed := err != nil && !errors.Is(err, ErrMetricsTimeout) && !errors.Is(err, ErrMetricsCanceled)
+		if failed != test.expectedFailure {
+			t.Errorf("%s: Answer() returned error %v; want failure %t", test.name, err, test.expectedFailure)
+		}
+	}
+}
+
+func TestMetricsReporterSend(t *testing.T) {
+	sender := &metricsSenderMock{err: errors.New("connection refused")}
+	reporter := NewMetricsReporter(sender, MetricsReporterConfig{AlwaysSend: true}, nil)
+	if err := reporter.Send(context.Background(), RunData{}, "1.0.0", "", "", ""); err == nil || errors.Is(err, ErrMetricsTimeout) {
+		t.Errorf("Send() returned error %v; want the error of the sender", err)
+	}
+
+	sender.err = ErrMetricsTimeout
+	if err := reporter.Send(context.Background(), RunData{}, "1.0.0", "", "", ""); !errors.Is(err, ErrMetricsTimeout) {
+		t.Errorf("Send() returned error %v; want ErrMetricsTimeout", err)
+	}
+}
+
+func TestMetricsAccumulatorConcurrentUpdates(t *testing.T) {
+	accumulator := NewMetricsAccumulator()
+	numRecipes := 50
+
+	// The recipes update the metrics while the UI reads snapshots, run with `-race` to detect unsynchronized access
+	var wg sync.WaitGroup
+	for i := 0; i < numRecipes; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			accumulator.SetChromeVersion(fmt.Sprintf("120.0.%d", i))
+			accumulator.AddRunData(RunDataSupplier{Supplier: fmt.Sprintf("supplier-%d", i), Status: "success"})
+		}(i)
+		go func() {
+			defer wg.Done()
+			snapshot := accumulator.Snapshot()
+			for _, record := range snapshot.RunData {
+				_ = record.Supplier
+			}
+			_ = snapshot.ChromeVersion
+		}()
+	}
+	accumulator.SetCliVersion("1.0.0")
+	accumulator.SetVaultVersion("2.0.0")
+	accumulator.SetOicdbVersion("3.0.0")
+	wg.Wait()
+
+	snapshot := accumulator.Snapshot()
+	if len(snapshot.RunData) != numRecipes {
+		t.Errorf("Snapshot() has %d run data records, expected %d", len(snapshot.RunData), numRecipes)
+	}
+	if len(snapshot.ChromeVersion) == 0 {
+		t.Errorf("Snapshot() has no Chrome version")
+	}
+	if snapshot.CliVersion != "1.0.0" || snapshot.VaultVersion != "2.0.0" || snapshot.OicdbVersion != "3.0.0" {
+		t.Errorf("Snapshot() has versions %q, %q, %q, expected 1.0.0, 2.0.0, 3.0.0", snapshot.CliVersion, snapshot.VaultVersion, snapshot.OicdbVersion)
+	}
+
+	// Empty versions keep the current ones and snapshots don't change with later updates
+	accumulator.SetCliVersion("")
+	accumulator.AddRunData(RunDataSupplier{Supplier: "late"})
+	if snapshot := accumulator.Snapshot(); snapshot.CliVersion != "1.0.0" {
+		t.Errorf("SetCliVersion(\"\") changed the version to %q", snapshot.CliVersion)
+	}
+	if len(snapshot.RunData) != numRecipes {
+		t.Errorf("earlier snapshot changed to %d run data records, expected %d", len(snapshot.RunData), numRecipes)
+	}
+}
@@ -3,7 +3,10 @@ package repository
 import (
 	"bytes"
 	"context"
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -13,7 +16,10 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sync"
 	"time"
+
+	"buchhalter/lib/utils"
 )
 
 const (
@@ -21,15 +27,45 @@ const (
 	repositoryAPIEndpoint = "/api/cli/repository"
 	metricsAPIEndpoint    = "/api/cli/metrics"
 	userAuthAPIEndpoint   = "/api/cli/sync"
+
+	// defaultMetricsTimeout is the maximum time to send metrics, a slow metrics endpoint must not delay the end of a sync
+	defaultMetricsTimeout = 3 * time.Second
+
+	// DefaultOICDBUpdateAttempts is the default number of attempts of an OICDB update check (incl. the first one).
+	DefaultOICDBUpdateAttempts = 3
+	// DefaultOICDBUpdateTimeout is the default maximum duration of the whole OICDB update phase, incl. retries.
+	DefaultOICDBUpdateTimeout = 30 * time.Second
+	// defaultUpdateBackoff is the wait time before the first retry of an OICDB update, it doubles with every retry
+	defaultUpdateBackoff = 1 * time.Second
 )
 
+// ErrMetricsTimeout is returned, if the metrics couldn't be sent in time.
+var ErrMetricsTimeout = errors.New("sending metrics timed out")
+
+// ErrMetricsCanceled is returned, if sending the metrics was canceled (e.g. the user quit the application).
+var ErrMetricsCanceled = errors.New("sending metrics was canceled")
+
+// ErrUpdateIncomplete is returned, if a downloaded OICDB file doesn't match its size or checksum (e.g. a truncated download).
+// The local file is kept, the update is retried.
+var ErrUpdateIncomplete = errors.New("downloaded update is incomplete")
+
 type BuchhalterAPIClient struct {
 	logger            *slog.Logger
 	apiHost           *url.URL
 	apiToken          string
 	authenticatedUser AuthenticatedUser
+	teamSlug          string
+	team              Team
+	// teamMu guards team, it is selected on the first use of teamID
+	teamMu            sync.Mutex
 	configDirectory   string
 	userAgent         string
+	metricsTimeout    time.Duration
+	updateAttempts    int
+	updateBackoff     time.Duration
+	existenceTimeout  time.Duration
+	existenceAttempts int
+	existenceBackoff  time.Duration
 }
 
 type Metric struct {
@@ -49,6 +85,8 @@ type RunDataSupplier struct {
 	LastErrorMessage string  `json:"lastErrorMessage,omitempty"`
 	Duration         float64 `json:"duration,omitempty"`
 	NewFilesCount    int     `json:"newFilesCount,omitempty"`
+	// ErrorCode classifies the error of a failed recipe (see utils.ErrorCode), empty on success
+	ErrorCode utils.ErrorCode `json:"errorCode,omitempty"`
 }
 
 type RunData []RunDataSupplier
@@ -102,25 +140,96 @@ func NewBuchhalterAPIClient(logger *slog.Logger, apiHost, configDirectory, apiTo
 		apiHost:         u,
 		userAgent:       fmt.Sprintf("buchhalter-cli/v%s", cliVersion),
 		apiToken:        apiToken,
+		metricsTimeout:  defaultMetricsTimeout,
+		updateAttempts:  DefaultOICDBUpdateAttempts,
+		updateBackoff:   defaultUpdateBackoff,
+
+		existenceTimeout:  DefaultExistenceCheckTimeout,
+		existenceAttempts: DefaultExistenceCheckAttempts,
+		existenceBackoff:  defaultExistenceCheckBackoff,
 	}
 
 	return c, nil
 }
 
-func (c *BuchhalterAPIClient) UpdateOpenInvoiceCollectorDBIfAvailable(currentChecksum string) error {
-	err := c.downloadFileFromAPIEndpoint(currentChecksum, repositoryAPIEndpoint, "oicdb.json")
-	return err
+// UpdateOpenInvoiceCollectorDBIfAvailable downloads the OICDB repository, if its checksum differs from currentChecksum.
+// Network errors and server errors are retried (see SetUpdateAttempts) until ctx is done.
+func (c *BuchhalterAPIClient) UpdateOpenInvoiceCollectorDBIfAvailable(ctx context.Context, currentChecksum string) error {
+	return c.withUpdateRetry(ctx, repositoryAPIEndpoint, func() error {
+		return c.downloadFileFromAPIEndpoint(ctx, currentChecksum, repositoryAPIEndpoint, "oicdb.json")
+	})
+}
+
+// UpdateOpenInvoiceCollectorDBSchemaIfAvailable downloads the OICDB schema, if its checksum differs from currentChecksum.
+// Network errors and server errors are retried (see SetUpdateAttempts) until ctx is done.
+func (c *BuchhalterAPIClient) UpdateOpenInvoiceCollectorDBSchemaIfAvailable(ctx context.Context, currentChecksum string) error {
+	return c.withUpdateRetry(ctx, schemaAPIEndpoint, func() error {
+		return c.downloadFileFromAPIEndpoint(ctx, currentChecksum, schemaAPIEndpoint, "oicdb.schema.json")
+	})
+}
+
+// SetUpdateAttempts sets the number of attempts of an OICDB update (incl. the first one, at least 1).
+func (c *BuchhalterAPIClient) SetUpdateAttempts(attempts int) {
+	c.updateAttempts = max(attempts, 1)
+}
+
+// withUpdateRetry calls update until it succeeds, the attempts are used up or ctx is done.
+// Only errors that may be temporary (network errors, server errors and rate limits) are retried, with an exponential backoff.
+func (c *BuchhalterAPIClient) withUpdateRetry(ctx context.Context, apiEndpoint string, update func() error) error {
+	return withRetry(ctx, c.updateAttempts, c.updateBackoff, update, func(attempt int, backoff time.Duration, err error) {
+		c.logger.Warn("Error checking for updates, retrying", "api_endpoint", apiEndpoint, "attempt", attempt, "max_attempts", c.updateAttempts, "backoff", backoff, "error", err)
+	})
+}
+
+// withRetry calls call until it succeeds, attempts are used up or ctx is done.
+// Only errors that may be temporary are retried (see isRetryableError), the backoff doubles with every retry.
+// onRetry is called before each retry.
+func withRetry(ctx context.Context, attempts int, backoff time.Duration, call func() error, onRetry func(attempt int, backoff time.Duration, err error)) error {
+	for attempt := 1; ; attempt++ {
+		err := call()
+		if err == nil || attempt >= attempts || !isRetryableError(err) || ctx.Err() != nil {
+			return err
+		}
+
+		onRetry(attempt, backoff, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// statusError is an unexpected status code of a request to Buchhalter API.
+type statusError struct {
+	url        string
+	statusCode int
+}
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("http request to %s failed with status code: %d", e.url, e.statusCode)
 }
 
-func (c *BuchhalterAPIClient) UpdateOpenInvoiceCollectorDBSchemaIfAvailable(currentChecksum string) error {
-	err := c.downloadFileFromAPIEndpoint(currentChecksum, schemaAPIEndpoint, "oicdb.schema.json")
-	return err
+// isRetryableError returns true for errors of requests that may be temporary.
+func isRetryableError(err error) bool {
+	var statusErr statusError
+	if errors.As(err, &statusErr) {
+		return statusErr.statusCode >= http.StatusInternalServerError || statusErr.statusCode == http.StatusTooManyRequests
+	}
+	if errors.Is(err, ErrUpdateIncomplete) {
+		return true
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
 }
 
-func (c *BuchhalterAPIClient) downloadFileFromAPIEndpoint(currentChecksum, apiEndpoint, localFileName string) error {
-	updateExists, err := c.updateExists(currentChecksum, apiEndpoint)
+// downloadFileFromAPIEndpoint downloads the file of apiEndpoint into localFileName of the config directory, if its checksum differs from currentChecksum.
+// The file is downloaded into a temporary file first, it only replaces the local file if its size and SHA-1 checksum (`x-checksum`) match.
+func (c *BuchhalterAPIClient) downloadFileFromAPIEndpoint(ctx context.Context, currentChecksum, apiEndpoint, localFileName string) error {
+	updateExists, remoteChecksum, err := c.updateExists(ctx, currentChecksum, apiEndpoint)
 	if err != nil {
-		return fmt.Errorf("you're offline - please connect to the internet for using buchhalter-cli: %w", err)
+		return fmt.Errorf("error checking for updates: %w", err)
 	}
 
 	if updateExists {
@@ -128,7 +237,6 @@ func (c *BuchhalterAPIClient) downloadFileFromAPIEndpoint(currentChecksum, apiEn
 		client := &http.Client{
 			Timeout: 10 * time.Second,
 		}
-		ctx := context.Background()
 		apiUrl, err := url.JoinPath(c.apiHost.String(), apiEndpoint)
 		if err != nil {
 			return err
@@ -148,39 +256,78 @@ func (c *BuchhalterAPIClient) downloadFileFromAPIEndpoint(currentChecksum, apiEn
 		defer resp.Body.Close()
 
 		if resp.StatusCode == http.StatusOK {
-			fileToUpdate := filepath.Join(c.configDirectory, localFileName)
-			out, err := os.Create(fileToUpdate)
-			if err != nil {
-				return fmt.Errorf("couldn't create "+localFileName+" file: %w", err)
+			// The file may have changed since the HEAD request
+			if checksum := resp.Header.Get("x-checksum"); len(checksum) > 0 {
+				remoteChecksum = checksum
 			}
-			defer out.Close()
-
-			bytesCopied, err := io.Copy(out, resp.Body)
+			fileToUpdate := filepath.Join(c.configDirectory, localFileName)
+			bytesCopied, err := writeVerifiedFile(fileToUpdate, resp.Body, resp.ContentLength, remoteChecksum)
 			if err != nil {
-				return fmt.Errorf("error copying response body to file: %w", err)
+				c.logger.Error("Error updating the local file, keeping the current file", "file", fileToUpdate, "api_endpoint", apiEndpoint, "error", err)
+				return err
 			}
 
-			c.logger.Info("Starting to update the local file ... completed", "file", fileToUpdate, "bytes_written", bytesCopied, "api_endpoint", apiEndpoint)
+			c.logger.Info("Starting to update the local file ... completed", "file", fileToUpdate, "bytes_written", bytesCopied, "checksum", remoteChecksum, "api_endpoint", apiEndpoint)
 			return nil
 		}
-		return fmt.Errorf("http request to %s failed with status code: %d", apiUrl, resp.StatusCode)
+		return statusError{url: apiUrl, statusCode: resp.StatusCode}
 	}
 
 	return nil
 }
 
-func (c *BuchhalterAPIClient) updateExists(currentChecksum, apiEndpoint string) (bool, error) {
+// writeVerifiedFile writes body into a temporary file next to file and renames it over file,
+// if its size matches contentLength (if known, i.e. not -1) and its SHA-1 checksum matches checksum.
+// The replaced file is kept as backup (see utils.BackupFile).
+func writeVerifiedFile(file string, body io.Reader, contentLength int64, checksum string) (int64, error) {
+	out, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return 0, fmt.Errorf("couldn't create temporary file for %s: %w", filepath.Base(file), err)
+	}
+	defer os.Remove(out.Name())
+
+	h := sha1.New()
+	bytesCopied, err := io.Copy(io.MultiWriter(out, h), body)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return bytesCopied, fmt.Errorf("%w: error copying response body to file: %w", ErrUpdateIncomplete, err)
+	}
+
+	if contentLength >= 0 && bytesCopied != contentLength {
+		return bytesCopied, fmt.Errorf("%w: received %d of %d bytes", ErrUpdateIncomplete, bytesCopied, contentLength)
+	}
+	if downloadedChecksum := hex.EncodeToString(h.Sum(nil)); downloadedChecksum != checksum {
+		return bytesCopied, fmt.Errorf("%w: checksum %s doesn't match the expected checksum %s", ErrUpdateIncomplete, downloadedChecksum, checksum)
+	}
+
+	// Same permissions as files created by os.Create
+	if err := os.Chmod(out.Name(), 0644); err != nil {
+		return bytesCopied, err
+	}
+	// The last-known-good file is restored, if the update is rejected (see parser.RecipeParser.LoadRecipes)
+	if err := utils.BackupFile(file); err != nil {
+		return bytesCopied, fmt.Errorf("couldn't back up %s: %w", filepath.Base(file), err)
+	}
+	if err := os.Rename(out.Name(), file); err != nil {
+		return bytesCopied, fmt.Errorf("couldn't replace %s: %w", filepath.Base(file), err)
+	}
+	return bytesCopied, nil
+}
+
+// updateExists returns true and the remote checksum, if the checksum of apiEndpoint differs from currentChecksum.
+func (c *BuchhalterAPIClient) updateExists(ctx context.Context, currentChecksum, apiEndpoint string) (bool, string, error) {
 	client := &http.Client{
 		Timeout: 10 * time.Second,
 	}
-	ctx := context.Background()
 	apiUrl, err := url.JoinPath(c.apiHost.String(), apiEndpoint)
 	if err != nil {
-		return false, err
+		return false, "", err
 	}
 	req, err := http.NewRequestWithContext(ctx, http.MethodHead, apiUrl, nil)
 	if err != nil {
-		return false, err
+		return false, "", err
 	}
 
 	req.Header.Set("User-Agent", c.userAgent)
@@ -189,7 +336,7 @@ func (c *BuchhalterAPIClient) updateExists(currentChecksum, apiEndpoint string)
 	resp, err := client.Do(req)
 	if err != nil {
 		c.logger.Error("Error sending request", "url", apiUrl, "error", err)
-		return false, fmt.Errorf("error sending request: %w", err)
+		return false, "", fmt.Errorf("error sending request: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -198,20 +345,28 @@ func (c *BuchhalterAPIClient) updateExists(currentChecksum, apiEndpoint string)
 		if checksum != "" {
 			if checksum == currentChecksum {
 				c.logger.Info("No new updates available", "local_checksum", currentChecksum, "remote_checksum", checksum, "api_endpoint", apiEndpoint)
-				return false, nil
+				return false, checksum, nil
 			}
 
 			c.logger.Info("New updates for available", "local_checksum", currentChecksum, "remote_checksum", checksum, "api_endpoint", apiEndpoint)
-			return true, nil
+			return true, checksum, nil
 		}
 
-		return false, fmt.Errorf("update failed with checksum mismatch")
+		return false, "", fmt.Errorf("update failed with checksum mismatch")
 	}
 
-	return false, fmt.Errorf("http request to %s failed with status code: %d", apiUrl, resp.StatusCode)
+	return false, "", statusError{url: apiUrl, statusCode: resp.StatusCode}
 }
 
-func (c *BuchhalterAPIClient) SendMetrics(runData RunData, cliVersion, chromeVersion, vaultVersion, oicdbVersion string) error {
+// SendMetrics sends the run data as usage metrics.
+// It is bound by the metrics timeout and canceled with ctx (e.g. on shutdown), a hung metrics endpoint never delays the exit.
+// With `DO_NOT_TRACK` (see DoNotTrack), nothing is sent, regardless of the configuration.
+func (c *BuchhalterAPIClient) SendMetrics(ctx context.Context, runData RunData, cliVersion, chromeVersion, vaultVersion, oicdbVersion string) error {
+	if DoNotTrack() {
+		c.logger.Info("Skipping usage metrics, because DO_NOT_TRACK is set")
+		return nil
+	}
+
 	runDataJSON, err := json.Marshal(runData)
 	if err != nil {
 		return fmt.Errorf("error marshalling run data: %w", err)
@@ -231,8 +386,9 @@ func (c *BuchhalterAPIClient) SendMetrics(runData RunData, cliVersion, chromeVer
 		return fmt.Errorf("error marshalling run data: %w", err)
 	}
 
-	client := &http.Client{}
-	ctx := context.Background() // Consider using a meaningful context
+	client := &http.Client{Timeout: c.metricsTimeout}
+	ctx, cancel := context.WithTimeout(ctx, c.metricsTimeout)
+	defer cancel()
 	apiUrl, err := url.JoinPath(c.apiHost.String(), metricsAPIEndpoint)
 	if err != nil {
 		return err
@@ -258,8 +414,16 @@ func (c *BuchhalterAPIClient) SendMetrics(runData RunData, cliVersion, chromeVer
 
 	resp, err := client.Do(req)
 	if err != nil {
-		c.logger.Error("Error sending request", "url", apiUrl, "error", err)
-		return fmt.Errorf("error sending request: %w", err)
+		err = c.metricsRequestError(err)
+		switch {
+		case errors.Is(err, ErrMetricsTimeout):
+			c.logger.Warn("Sending metrics timed out", "url", apiUrl, "timeout", c.metricsTimeout)
+		case errors.Is(err, ErrMetricsCanceled):
+			c.logger.Info("Sending metrics canceled", "url", apiUrl)
+		default:
+			c.logger.Error("Error sending request", "url", apiUrl, "error", err)
+		}
+		return err
 	}
 	defer resp.Body.Close()
 
@@ -270,6 +434,65 @@ func (c *BuchhalterAPIClient) SendMetrics(runData RunData, cliVersion, chromeVer
 	return fmt.Errorf("http request to %s failed with status code: %d", apiUrl, resp.StatusCode)
 }
 
+// SendCrashReport sends a (redacted) crash report to Buchhalter API, as metric of the type `crashReport`.
+// It is bound by the metrics timeout, a crashed run should end quickly.
+func (c *BuchhalterAPIClient) SendCrashReport(report utils.CrashReport) error {
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("error marshalling crash report: %w", err)
+	}
+	metricsDataJSON, err := json.Marshal(Metric{
+		MetricType: "crashReport",
+		Data:       string(reportJSON),
+		CliVersion: report.CliVersion,
+		OS:         report.OS,
+	})
+	if err != nil {
+		return fmt.Errorf("error marshalling crash report: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.metricsTimeout)
+	defer cancel()
+	apiUrl, err := url.JoinPath(c.apiHost.String(), metricsAPIEndpoint)
+	if err != nil {
+		return err
+	}
+	c.logger.Info("Sending crash report to Buchhalter SaaS", "url", apiUrl)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiUrl, bytes.NewBuffer(metricsDataJSON))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("User-Agent", c.userAgent)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	client := &http.Client{Timeout: c.metricsTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return c.metricsRequestError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("http request to %s failed with status code: %d", apiUrl, resp.StatusCode)
+	}
+	return nil
+}
+
+// metricsRequestError translates the error of a metrics request.
+// Timeouts (of the context or the client) are returned as ErrMetricsTimeout, cancellations as ErrMetricsCanceled.
+func (c *BuchhalterAPIClient) metricsRequestError(err error) error {
+	var urlError *url.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &urlError) && urlError.Timeout()):
+		return fmt.Errorf("%w after %s", ErrMetricsTimeout, c.metricsTimeout)
+	case errors.Is(err, context.Canceled):
+		return ErrMetricsCanceled
+	}
+	return fmt.Errorf("error sending request: %w", err)
+}
+
 func (c *BuchhalterAPIClient) GetAuthenticatedUser() (*CliSyncResponse, error) {
 	// If we don't have an API token, we can't authenticate
 	if len(c.apiToken) == 0 {
@@ -314,21 +537,30 @@ func (c *BuchhalterAPIClient) GetAuthenticatedUser() (*CliSyncResponse, error) {
 		return nil, err
 	}
 
-	// Store authenticated user
+	// Store authenticated user and select the team
 	c.authenticatedUser = cliSyncResponse.User
+	c.resetTeam()
+	if len(cliSyncResponse.User.Teams) > 0 || len(c.teamSlug) > 0 {
+		if _, err := c.teamID(); err != nil {
+			return nil, err
+		}
+	}
 
 	return &cliSyncResponse, nil
 }
 
+// DoesDocumentExist checks the existence of a document (by checksum) in Buchhalter API.
+// The request times out after the existence check timeout (see SetExistenceCheckTimeout), it isn't retried.
 func (c *BuchhalterAPIClient) DoesDocumentExist(documentHash string) (bool, error) {
 	client := &http.Client{
-		Timeout: 10 * time.Second,
+		Timeout: c.existenceTimeout,
 	}
 	ctx := context.Background()
 
-	// TODO How do we select the correct team?
-	// For now we just get the first one
-	teamId := c.authenticatedUser.Teams[0].ID
+	teamId, err := c.teamID()
+	if err != nil {
+		return false, err
+	}
 
 	requestPayload := struct {
 		FileChecksum string `json:"file_checksum"`
@@ -362,7 +594,7 @@ func (c *BuchhalterAPIClient) DoesDocumentExist(documentHash string) (bool, erro
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return false, fmt.Errorf("http request to %s failed with status code: %d", apiUrl, resp.StatusCode)
+		return false, statusError{url: apiUrl, statusCode: resp.StatusCode}
 	}
 
 	var checkResponse DocumentCheckResponse
@@ -426,9 +658,10 @@ func (c *BuchhalterAPIClient) UploadDocument(filePath, supplier string) error {
 		return err
 	}
 
-	// TODO How do we select the correct team?
-	// For now we just get the first one
-	teamId := c.authenticatedUser.Teams[0].ID
+	teamId, err := c.teamID()
+	if err != nil {
+		return err
+	}
 
 	apiEndpoint := fmt.Sprintf("api/cli/%s/upload", teamId)
 	apiUrl, err := url.JoinPath(c.apiHost.String(), apiEndpoint)
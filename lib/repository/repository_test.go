@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"buchhalter/lib/utils"
+)
+
+func TestSendMetricsTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A slow metrics endpoint, until the test is completed
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	c, err := NewBuchhalterAPIClient(slog.Default(), server.URL, t.TempDir(), "", "0.0.0-test")
+	if err != nil {
+		t.Fatalf("NewBuchhalterAPIClient() returned error: %s", err)
+	}
+	c.metricsTimeout = 100 * time.Millisecond
+
+	start := time.Now()
+	err = c.SendMetrics(context.Background(), RunData{{Supplier: "example", Status: "success"}}, "0.0.0-test", "", "", "")
+	if !errors.Is(err, ErrMetricsTimeout) {
+		t.Errorf("SendMetrics() returned %v; want ErrMetricsTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("SendMetrics() returned after %s; want it to give up after the metrics timeout", elapsed)
+	}
+}
+
+func TestSendMetricsCanceled(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A hung metrics endpoint, until the test is completed
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	c, err := NewBuchhalterAPIClient(slog.Default(), server.URL, t.TempDir(), "", "0.0.0-test")
+	if err != nil {
+		t.Fatalf("NewBuchhalterAPIClient() returned error: %s", err)
+	}
+	c.metricsTimeout = time.Minute
+
+	// The user quits the application while the metrics are sent
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	err = c.SendMetrics(ctx, RunData{{Supplier: "example", Status: "success"}}, "0.0.0-test", "", "", "")
+	if !errors.Is(err, ErrMetricsCanceled) {
+		t.Errorf("SendMetrics() returned %v; want ErrMetricsCanceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("SendMetrics() returned after %s; want it to stop on the cancellation", elapsed)
+	}
+}
+
+func TestSendMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != metricsAPIEndpoint || r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	c, err := NewBuchhalterAPIClient(slog.Default(), server.URL, t.TempDir(), "", "0.0.0-test")
+	if err != nil {
+		t.Fatalf("NewBuchhalterAPIClient() returned error: %s", err)
+	}
+	if err := c.SendMetrics(context.Background(), RunData{}, "0.0.0-test", "", "", ""); err != nil {
+		t.Errorf("SendMetrics() returned error: %s", err)
+	}
+}
+
+func TestSendMetricsDoNotTrack(t *testing.T) {
+	t.Setenv("DO_NOT_TRACK", "1")
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	c, err := NewBuchhalterAPIClient(slog.Default(), server.URL, t.TempDir(), "", "0.0.0-test")
+	if err != nil {
+		t.Fatalf("NewBuchhalterAPIClient() returned error: %s", err)
+	}
+	if err := c.SendMetrics(context.Background(), RunData{}, "0.0.0-test", "", "", ""); err != nil {
+		t.Errorf("SendMetrics() with DO_NOT_TRACK returned error: %s", err)
+	}
+	if requests != 0 {
+		t.Errorf("SendMetrics() with DO_NOT_TRACK sent %d requests; want none", requests)
+	}
+}
+
+func TestSendCrashReport(t *testing.T) {
+	var received Metric
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	c, err := NewBuchhalterAPIClient(slog.Default(), server.URL, t.TempDir(), "", "0.0.0-test")
+	if err != nil {
+		t.Fatalf("NewBuchhalterAPIClient() returned error: %s", err)
+	}
+	report := utils.CrashReport{CliVersion: "0.0.0-test", OS: "linux", Panic: "index out of range"}
+	if err := c.SendCrashReport(report); err != nil {
+		t.Fatalf("SendCrashReport() returned error: %s", err)
+	}
+
+	var receivedReport utils.CrashReport
+	if err := json.Unmarshal([]byte(received.Data), &receivedReport); err != nil {
+		t.Fatalf("error decoding received crash report: %s", err)
+	}
+	if received.MetricType != "crashReport" || receivedReport.Panic != report.Panic {
+		t.Errorf("SendCrashReport() sent %+v; want a crashReport metric with the report", received)
+	}
+}
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SelectTeam returns the team with slug from teams, an empty slug selects the first team.
+func SelectTeam(teams []Team, slug string) (Team, error) {
+	if len(teams) == 0 {
+		return Team{}, fmt.Errorf("the API key doesn't belong to a team")
+	}
+	if len(slug) == 0 {
+		return teams[0], nil
+	}
+
+	slugs := make([]string, 0, len(teams))
+	for _, team := range teams {
+		if strings.EqualFold(team.Slug, slug) {
+			return team, nil
+		}
+		slugs = append(slugs, team.Slug)
+	}
+	return Team{}, fmt.Errorf("team `%s` not found (available: %s)", slug, strings.Join(slugs, ", "))
+}
+
+// SetTeam sets the slug of the team documents are checked and uploaded for, an empty slug selects the first team.
+// The team is selected by GetAuthenticatedUser.
+func (c *BuchhalterAPIClient) SetTeam(slug string) {
+	c.teamMu.Lock()
+	defer c.teamMu.Unlock()
+	c.teamSlug = slug
+	c.team = Team{}
+}
+
+// Team returns the selected team, it is empty before GetAuthenticatedUser.
+func (c *BuchhalterAPIClient) Team() Team {
+	c.teamMu.Lock()
+	defer c.teamMu.Unlock()
+	return c.team
+}
+
+// resetTeam clears the selected team, e.g. for the teams of a new authenticated user.
+func (c *BuchhalterAPIClient) resetTeam() {
+	c.teamMu.Lock()
+	defer c.teamMu.Unlock()
+	c.team = Team{}
+}
+
+// teamID returns the ID of the selected team.
+// It is safe for concurrent use, e.g. by the parallel checks of DocumentsExist.
+func (c *BuchhalterAPIClient) teamID() (string, error) {
+	c.teamMu.Lock()
+	defer c.teamMu.Unlock()
+	if len(c.team.ID) > 0 {
+		return c.team.ID, nil
+	}
+	team, err := SelectTeam(c.authenticatedUser.Teams, c.teamSlug)
+	if err != nil {
+		return "", err
+	}
+	c.team = team
+	return team.ID, nil
+}
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSelectTeam(t *testing.T) {
+	teams := []Team{{ID: "1", Slug: "acme"}, {ID: "2", Slug: "example"}}
+
+	tests := []struct {
+		name    string
+		teams   []Team
+		slug    string
+		want    string
+		wantErr string
+	}{
+		{name: "first team by default", teams: teams, slug: "", want: "1"},
+		{name: "team by slug", teams: teams, slug: "example", want: "2"},
+		{name: "slug is case insensitive", teams: teams, slug: "Example", want: "2"},
+		{name: "unknown slug", teams: teams, slug: "unknown", wantErr: "available: acme, example"},
+		{name: "no teams", teams: nil, slug: "", wantErr: "doesn't belong to a team"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			team, err := SelectTeam(tt.teams, tt.slug)
+			if len(tt.wantErr) > 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("SelectTeam() error = %v; want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SelectTeam() returned error: %s", err)
+			}
+			if team.ID != tt.want {
+				t.Errorf("SelectTeam() = %s; want %s", team.ID, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetAuthenticatedUserSelectsTeam(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response := CliSyncResponse{Status: "success", User: AuthenticatedUser{ID: "user", Teams: []Team{{ID: "1", Slug: "acme"}, {ID: "2", Slug: "example"}}}}
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			t.Errorf("Encode() returned error: %s", err)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	c, err := NewBuchhalterAPIClient(slog.Default(), server.URL, t.TempDir(), "token", "0.0.0-test")
+	if err != nil {
+		t.Fatalf("NewBuchhalterAPIClient() returned error: %s", err)
+	}
+
+	c.SetTeam("example")
+	if _, err := c.GetAuthenticatedUser(); err != nil {
+		t.Fatalf("GetAuthenticatedUser() returned error: %s", err)
+	}
+	if c.Team().ID != "2" {
+		t.Errorf("Team() = %+v; want team example", c.Team())
+	}
+
+	c.SetTeam("unknown")
+	if _, err := c.GetAuthenticatedUser(); err == nil {
+		t.Errorf("GetAuthenticatedUser() with unknown team returned no error")
+	}
+}
+
+func TestTeamIDConcurrent(t *testing.T) {
+	c, err := NewBuchhalterAPIClient(slog.Default(), "https://app.buchhalter.ai", t.TempDir(), "token", "0.0.0-test")
+	if err != nil {
+		t.Fatalf("NewBuchhalterAPIClient() returned error: %s", err)
+	}
+	c.authenticatedUser = AuthenticatedUser{Teams: []Team{{ID: "1", Slug: "acme"}, {ID: "2", Slug: "example"}}}
+	c.SetTeam("example")
+
+	// The team is selected on the first use, e.g. by the parallel checks of DocumentsExist (run with -race)
+	var wg sync.WaitGroup
+	teamIDs := make([]string, 8)
+	for i := range teamIDs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			teamIDs[i], _ = c.teamID()
+		}(i)
+	}
+	wg.Wait()
+
+	for i, teamID := range teamIDs {
+		if teamID != "2" {
+			t.Errorf("teamID() of goroutine %d = %q; want 2", i, teamID)
+		}
+	}
+	if c.Team().ID != "2" {
+		t.Errorf("Team() = %+v; want team example", c.Team())
+	}
+}
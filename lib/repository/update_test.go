@@ -0,0 +1,211 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyUpdateServer answers the first failures requests with failureStatus, afterwards it serves the OICDB repository.
+type flakyUpdateServer struct {
+	failures      int32
+	failureStatus int
+	requests      atomic.Int32
+}
+
+func (s *flakyUpdateServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.requests.Add(1) <= s.failures {
+		w.WriteHeader(s.failureStatus)
+		return
+	}
+	if r.URL.Path != repositoryAPIEndpoint {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Header().Set("x-checksum", sha1Hex(updateTestRepository))
+	if r.Method == http.MethodHead {
+		return
+	}
+	_, _ = w.Write([]byte(updateTestRepository))
+}
+
+// updateTestRepository is the OICDB repository served by the update test servers.
+const updateTestRepository = `{"suppliers": []}`
+
+func sha1Hex(content string) string {
+	h := sha1.Sum([]byte(content))
+	return hex.EncodeToString(h[:])
+}
+
+func newUpdateTestClient(t *testing.T, handler http.Handler) (*BuchhalterAPIClient, string) {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	configDirectory := t.TempDir()
+	c, err := NewBuchhalterAPIClient(slog.Default(), server.URL, configDirectory, "", "0.0.0-test")
+	if err != nil {
+		t.Fatalf("NewBuchhalterAPIClient() returned error: %s", err)
+	}
+	c.updateBackoff = time.Millisecond
+
+	return c, configDirectory
+}
+
+func TestUpdateOpenInvoiceCollectorDBRetries(t *testing.T) {
+	tests := []struct {
+		name             string
+		failures         int32
+		failureStatus    int
+		attempts         int
+		expectedError    bool
+		expectedRequests int32
+	}{
+		{"no failures", 0, http.StatusServiceUnavailable, 3, false, 2},
+		{"temporary server errors", 2, http.StatusServiceUnavailable, 3, false, 4},
+		{"rate limit", 1, http.StatusTooManyRequests, 3, false, 3},
+		{"attempts exhausted", 3, http.StatusBadGateway, 3, true, 3},
+		{"single attempt", 1, http.StatusServiceUnavailable, 1, true, 1},
+		// Client errors are not temporary
+		{"not found", 1, http.StatusNotFound, 3, true, 1},
+	}
+
+	for _, test := range tests {
+		server := &flakyUpdateServer{failures: test.failures, failureStatus: test.failureStatus}
+		c, configDirectory := newUpdateTestClient(t, server)
+		c.SetUpdateAttempts(test.attempts)
+
+		err := c.UpdateOpenInvoiceCollectorDBIfAvailable(context.Background(), "local-checksum")
+		if (err != nil) != test.expectedError {
+			t.Errorf("%s: UpdateOpenInvoiceCollectorDBIfAvailable() returned error %v; want error %t", test.name, err, test.expectedError)
+		}
+		if requests := server.requests.Load(); requests != test.expectedRequests {
+			t.Errorf("%s: UpdateOpenInvoiceCollectorDBIfAvailable() sent %d requests; want %d", test.name, requests, test.expectedRequests)
+		}
+
+		content, readErr := os.ReadFile(filepath.Join(configDirectory, "oicdb.json"))
+		if !test.expectedError && (readErr != nil || string(content) != `{"suppliers": []}`) {
+			t.Errorf("%s: oicdb.json = %q, %v; want the downloaded repository", test.name, content, readErr)
+		}
+	}
+}
+
+func TestUpdateOpenInvoiceCollectorDBUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	apiHost := server.URL
+	server.Close()
+
+	c, err := NewBuchhalterAPIClient(slog.Default(), apiHost, t.TempDir(), "", "0.0.0-test")
+	if err != nil {
+		t.Fatalf("NewBuchhalterAPIClient() returned error: %s", err)
+	}
+	c.updateBackoff = time.Millisecond
+	c.SetUpdateAttempts(3)
+
+	if err := c.UpdateOpenInvoiceCollectorDBSchemaIfAvailable(context.Background(), "local-checksum"); err == nil {
+		t.Errorf("UpdateOpenInvoiceCollectorDBSchemaIfAvailable() returned no error; want a network error")
+	}
+}
+
+func TestUpdateOpenInvoiceCollectorDBTimeout(t *testing.T) {
+	server := &flakyUpdateServer{failures: 1000, failureStatus: http.StatusServiceUnavailable}
+	c, _ := newUpdateTestClient(t, server)
+	c.updateBackoff = 50 * time.Millisecond
+	c.SetUpdateAttempts(1000)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := c.UpdateOpenInvoiceCollectorDBIfAvailable(ctx, "local-checksum"); err == nil {
+		t.Errorf("UpdateOpenInvoiceCollectorDBIfAvailable() returned no error; want an error after the timeout")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("UpdateOpenInvoiceCollectorDBIfAvailable() returned after %s; want it to stop retrying after the timeout", elapsed)
+	}
+	if requests := server.requests.Load(); requests > 5 {
+		t.Errorf("UpdateOpenInvoiceCollectorDBIfAvailable() sent %d requests; want the backoff to limit the retries", requests)
+	}
+}
+
+func TestUpdateOpenInvoiceCollectorDBVerifiesDownload(t *testing.T) {
+	tests := []struct {
+		name          string
+		checksum      string
+		body          string
+		contentLength string
+		expectedError bool
+	}{
+		{name: "valid download", checksum: sha1Hex(updateTestRepository), body: updateTestRepository},
+		{name: "checksum mismatch", checksum: sha1Hex("other"), body: updateTestRepository, expectedError: true},
+		{name: "truncated download", checksum: sha1Hex(updateTestRepository), body: updateTestRepository[:5], contentLength: "17", expectedError: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, configDirectory := newUpdateTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("x-checksum", test.checksum)
+				if r.Method == http.MethodHead {
+					return
+				}
+				if len(test.contentLength) > 0 {
+					// The connection is closed before the announced length is sent
+					w.Header().Set("Content-Length", test.contentLength)
+				}
+				_, _ = w.Write([]byte(test.body))
+			}))
+			c.SetUpdateAttempts(1)
+
+			localFile := filepath.Join(configDirectory, "oicdb.json")
+			if err := os.WriteFile(localFile, []byte(`{"old": true}`), 0644); err != nil {
+				t.Fatalf("WriteFile() returned error: %s", err)
+			}
+
+			err := c.UpdateOpenInvoiceCollectorDBIfAvailable(context.Background(), "local-checksum")
+			if (err != nil) != test.expectedError {
+				t.Fatalf("UpdateOpenInvoiceCollectorDBIfAvailable() returned error %v; want error %t", err, test.expectedError)
+			}
+
+			expected := updateTestRepository
+			if test.expectedError {
+				expected = `{"old": true}`
+				if !errors.Is(err, ErrUpdateIncomplete) {
+					t.Errorf("UpdateOpenInvoiceCollectorDBIfAvailable() error = %v; want ErrUpdateIncomplete", err)
+				}
+			}
+			if content, err := os.ReadFile(localFile); err != nil || string(content) != expected {
+				t.Errorf("oicdb.json = %q, %v; want %q", content, err, expected)
+			}
+
+			// The replaced file is kept as backup
+			backup, err := os.ReadFile(localFile + ".bak")
+			if !test.expectedError && (err != nil || string(backup) != `{"old": true}`) {
+				t.Errorf("oicdb.json.bak = %q, %v; want the replaced file", backup, err)
+			}
+			if test.expectedError && err == nil {
+				t.Errorf("oicdb.json.bak exists; want no backup of a rejected download")
+			}
+
+			// No temporary files are left
+			entries, err := os.ReadDir(configDirectory)
+			if err != nil {
+				t.Fatalf("ReadDir() returned error: %s", err)
+			}
+			for _, entry := range entries {
+				if entry.Name() != "oicdb.json" && entry.Name() != "oicdb.json.bak" {
+					t.Errorf("unexpected file %s in config directory", entry.Name())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// WebhookEventSyncCompleted is the event of the webhook notification sent at the end of a sync run.
+const WebhookEventSyncCompleted = "sync.completed"
+
+// WebhookSignatureHeader is the header with the HMAC-SHA256 signature of the payload (`sha256=<hex>`), if a secret is configured.
+const WebhookSignatureHeader = "X-Buchhalter-Signature"
+
+// DefaultWebhookTimeout is the maximum time to send the webhook notification.
+const DefaultWebhookTimeout = 10 * time.Second
+
+// WebhookPayload is the JSON body of the webhook notification (`buchhalter_webhook_url`), e.g. to trigger an automation after a sync.
+// Timestamp is UTC in RFC 3339.
+type WebhookPayload struct {
+	Event           string    `json:"event"`
+	Timestamp       time.Time `json:"timestamp"`
+	CliVersion      string    `json:"cliVersion"`
+	Success         bool      `json:"success"`
+	ExitCode        int       `json:"exitCode"`
+	NewFilesCount   int       `json:"newFilesCount"`
+	FailedSuppliers []string  `json:"failedSuppliers"`
+	RunData         RunData   `json:"runData"`
+}
+
+// NewWebhookPayload composes the webhook notification of a sync run, the run succeeded with exit code 0.
+func NewWebhookPayload(cliVersion string, now time.Time, exitCode int, failedSuppliers []string, runData RunData) WebhookPayload {
+	newFilesCount := 0
+	for _, record := range runData {
+		newFilesCount += record.NewFilesCount
+	}
+	if runData == nil {
+		runData = RunData{}
+	}
+
+	return WebhookPayload{
+		Event:           WebhookEventSyncCompleted,
+		Timestamp:       now.UTC().Truncate(time.Second),
+		CliVersion:      cliVersion,
+		Success:         exitCode == 0,
+		ExitCode:        exitCode,
+		NewFilesCount:   newFilesCount,
+		FailedSuppliers: append([]string{}, failedSuppliers...),
+		RunData:         runData,
+	}
+}
+
+// SignWebhookPayload returns the value of WebhookSignatureHeader for body: the HMAC-SHA256 with secret, hex encoded.
+func SignWebhookPayload(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// SendWebhook posts payload as JSON to webhookUrl, signed with secret (if not empty).
+// Every response status other than 2xx is an error. The errors only name the host of webhookUrl, its path and query may contain a token.
+func SendWebhook(ctx context.Context, client *http.Client, webhookUrl, secret string, payload WebhookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error encoding webhook payload: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, DefaultWebhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookUrl, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", fmt.Sprintf("buchhalter-cli/v%s", payload.CliVersion))
+	if len(secret) > 0 {
+		req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(body, secret))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		// The error of the client contains the url
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("error sending webhook request to %s: %w", req.URL.Host, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook request to %s failed with status code: %d", req.URL.Host, resp.StatusCode)
+	}
+	return nil
+}
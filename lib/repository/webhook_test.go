@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"buchhalter/lib/utils"
+)
+
+func TestNewWebhookPayload(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 30, 15, 500, time.FixedZone("CEST", 2*60*60))
+	runData := RunData{{Supplier: "hetzner", Status: "success", NewFilesCount: 2}, {Supplier: "aws", Status: "error", NewFilesCount: 1, ErrorCode: utils.ErrorCodeAuthFailed}}
+
+	payload := NewWebhookPayload("1.2.3", now, 11, []string{"aws"}, runData)
+	if payload.Event != WebhookEventSyncCompleted || payload.Success || payload.ExitCode != 11 || payload.NewFilesCount != 3 {
+		t.Errorf("NewWebhookPayload() = %+v; want a failed run with 3 new files", payload)
+	}
+	if !payload.Timestamp.Equal(time.Date(2024, 5, 1, 8, 30, 15, 0, time.UTC)) || payload.Timestamp.Location() != time.UTC {
+		t.Errorf("NewWebhookPayload() timestamp = %s; want UTC without fractions", payload.Timestamp)
+	}
+	if !reflect.DeepEqual(payload.FailedSuppliers, []string{"aws"}) {
+		t.Errorf("NewWebhookPayload() failed suppliers = %v; want [aws]", payload.FailedSuppliers)
+	}
+	// Consumers distinguish the failures by their error code, successful suppliers have none
+	encodedRunData, err := json.Marshal(payload.RunData)
+	if err != nil {
+		t.Fatalf("json.Marshal() returned error: %s", err)
+	}
+	if expected := `[{"supplier":"hetzner","status":"success","newFilesCount":2},{"supplier":"aws","status":"error","newFilesCount":1,"errorCode":"auth_failed"}]`; string(encodedRunData) != expected {
+		t.Errorf("NewWebhookPayload() run data = %s; want %s", encodedRunData, expected)
+	}
+
+	// An empty run is encoded with empty lists instead of null
+	payload = NewWebhookPayload("1.2.3", now, 0, nil, nil)
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("json.Marshal() returned error: %s", err)
+	}
+	if !payload.Success || !json.Valid(encoded) || !reflect.DeepEqual(payload.RunData, RunData{}) || payload.FailedSuppliers == nil {
+		t.Errorf("NewWebhookPayload() of an empty run = %s; want a successful run with empty lists", encoded)
+	}
+}
+
+func TestSendWebhook(t *testing.T) {
+	type request struct {
+		signature   string
+		contentType string
+		body        []byte
+	}
+	requests := make(chan request, 1)
+	status := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- request{signature: r.Header.Get(WebhookSignatureHeader), contentType: r.Header.Get("Content-Type"), body: body}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	payload := NewWebhookPayload("1.2.3", time.Now(), 0, nil, RunData{{Supplier: "hetzner", Status: "success", NewFilesCount: 1}})
+	if err := SendWebhook(context.Background(), server.Client(), server.URL, "webhook-secret", payload); err != nil {
+		t.Fatalf("SendWebhook() returned error: %s", err)
+	}
+	received := <-requests
+	if received.contentType != "application/json" {
+		t.Errorf("SendWebhook() sent content type %s; want application/json", received.contentType)
+	}
+	// The receiver verifies the signature with the shared secret
+	if received.signature != SignWebhookPayload(received.body, "webhook-secret") {
+		t.Errorf("SendWebhook() sent signature %s; want the HMAC of the body", received.signature)
+	}
+	if received.signature == SignWebhookPayload(received.body, "other-secret") {
+		t.Errorf("SignWebhookPayload() doesn't depend on the secret")
+	}
+	var decoded WebhookPayload
+	if err := json.Unmarshal(received.body, &decoded); err != nil || decoded.NewFilesCount != 1 || len(decoded.RunData) != 1 {
+		t.Errorf("SendWebhook() sent %s; want the payload", received.body)
+	}
+
+	// Without a secret, no signature is sent
+	if err := SendWebhook(context.Background(), server.Client(), server.URL, "", payload); err != nil {
+		t.Fatalf("SendWebhook() without secret returned error: %s", err)
+	}
+	if received = <-requests; len(received.signature) > 0 {
+		t.Errorf("SendWebhook() without secret sent signature %s; want none", received.signature)
+	}
+
+	// The errors don't contain the token in the path of the url
+	status = http.StatusInternalServerError
+	err := SendWebhook(context.Background(), server.Client(), server.URL+"/hooks/secret-token", "", payload)
+	if err == nil {
+		t.Errorf("SendWebhook() with status 500 returned no error; want an error")
+	} else if strings.Contains(err.Error(), "secret-token") {
+		t.Errorf("SendWebhook() error = %q; want an error without the path of the url", err)
+	}
+	<-requests
+
+	server.Close()
+	if err := SendWebhook(context.Background(), server.Client(), server.URL+"/hooks/secret-token", "", payload); err == nil || strings.Contains(err.Error(), "secret-token") {
+		t.Errorf("SendWebhook() of a closed server error = %v; want an error without the path of the url", err)
+	}
+}
+
+func TestSignWebhookPayload(t *testing.T) {
+	// Reference value: echo -n '{"event":"sync.completed"}' | openssl dgst -sha256 -hmac secret
+	signature := SignWebhookPayload([]byte(`{"event":"sync.completed"}`), "secret")
+	expected := "sha256=df51b68d9ddbca0e49f98e84353e6c6e5d157df92790aef98b574c35b44e7e9f"
+	if signature != expected {
+		t.Errorf("SignWebhookPayload() = %s; want %s", signature, expected)
+	}
+}
@@ -0,0 +1,107 @@
+package secrets
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const oauth2FlowsFilename string = ".oauth2-flows.json"
+
+// Oauth2FlowTTL is the time an in-flight OAuth2 flow can be resumed.
+// Authorization codes are short-lived (RFC 6749 recommends at most 10 minutes), older flows start over.
+const Oauth2FlowTTL = 5 * time.Minute
+
+// Oauth2Flow is the state of an OAuth2 login that has not been completed by the token exchange yet.
+// Code is set once the redirect with the authorization code happened.
+type Oauth2Flow struct {
+	Verifier  string    `json:"verifier"`
+	State     string    `json:"state"`
+	Code      string    `json:"code,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type oauth2FlowsFile struct {
+	Flows map[string]Oauth2Flow `json:"flows"`
+}
+
+// SaveOauth2Flow stores the in-flight flow of id, e.g. to complete the token exchange in the next run if this run is interrupted.
+// Expired flows of other ids are removed.
+func SaveOauth2Flow(id string, flow Oauth2Flow, buchhalterConfigDirectory string) error {
+	flows, err := readOauth2FlowsFile(buchhalterConfigDirectory)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if flow.CreatedAt.IsZero() {
+		flow.CreatedAt = now
+	}
+	flows.Flows[id] = flow
+	return writeOauth2FlowsFile(flows, now, buchhalterConfigDirectory)
+}
+
+// GetOauth2Flow returns the in-flight flow of id, if it has been saved within Oauth2FlowTTL before now.
+func GetOauth2Flow(id, buchhalterConfigDirectory string, now time.Time) (Oauth2Flow, bool, error) {
+	flows, err := readOauth2FlowsFile(buchhalterConfigDirectory)
+	if err != nil {
+		return Oauth2Flow{}, false, err
+	}
+	flow, ok := flows.Flows[id]
+	if !ok || oauth2FlowExpired(flow, now) {
+		return Oauth2Flow{}, false, nil
+	}
+	return flow, true, nil
+}
+
+// DeleteOauth2Flow removes the flow of id, e.g. after the token exchange completed.
+func DeleteOauth2Flow(id, buchhalterConfigDirectory string) error {
+	flows, err := readOauth2FlowsFile(buchhalterConfigDirectory)
+	if err != nil {
+		return err
+	}
+	if _, ok := flows.Flows[id]; !ok {
+		return nil
+	}
+	delete(flows.Flows, id)
+	return writeOauth2FlowsFile(flows, time.Now(), buchhalterConfigDirectory)
+}
+
+func oauth2FlowExpired(flow Oauth2Flow, now time.Time) bool {
+	return now.Sub(flow.CreatedAt) > Oauth2FlowTTL || flow.CreatedAt.After(now)
+}
+
+func readOauth2FlowsFile(buchhalterConfigDirectory string) (oauth2FlowsFile, error) {
+	flows := oauth2FlowsFile{Flows: map[string]Oauth2Flow{}}
+
+	content, err := os.ReadFile(filepath.Join(buchhalterConfigDirectory, oauth2FlowsFilename))
+	if errors.Is(err, os.ErrNotExist) {
+		return flows, nil
+	}
+	if err != nil {
+		return flows, err
+	}
+	if err := json.Unmarshal(content, &flows); err != nil {
+		return flows, err
+	}
+	if flows.Flows == nil {
+		flows.Flows = map[string]Oauth2Flow{}
+	}
+	return flows, nil
+}
+
+// writeOauth2FlowsFile writes the flows not expired at now, the file is only readable by the user.
+func writeOauth2FlowsFile(flows oauth2FlowsFile, now time.Time, buchhalterConfigDirectory string) error {
+	for id, flow := range flows.Flows {
+		if oauth2FlowExpired(flow, now) {
+			delete(flows.Flows, id)
+		}
+	}
+
+	content, err := json.MarshalIndent(flows, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(buchhalterConfigDirectory, oauth2FlowsFilename), content, 0600)
+}
@@ -0,0 +1,80 @@
+package secrets
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOauth2FlowSaveAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	// Nothing saved yet
+	if _, ok, err := GetOauth2Flow("supplier|1", dir, now); ok || err != nil {
+		t.Fatalf("GetOauth2Flow() of an empty directory = %t, %v; want no flow", ok, err)
+	}
+
+	flow := Oauth2Flow{Verifier: "verifier", State: "state", CreatedAt: now}
+	if err := SaveOauth2Flow("supplier|1", flow, dir); err != nil {
+		t.Fatalf("SaveOauth2Flow() returned error: %s", err)
+	}
+	flow.Code = "code"
+	if err := SaveOauth2Flow("supplier|1", flow, dir); err != nil {
+		t.Fatalf("SaveOauth2Flow() returned error: %s", err)
+	}
+
+	restored, ok, err := GetOauth2Flow("supplier|1", dir, now.Add(time.Minute))
+	if err != nil || !ok {
+		t.Fatalf("GetOauth2Flow() = %t, %v; want the saved flow", ok, err)
+	}
+	if restored.Verifier != "verifier" || restored.State != "state" || restored.Code != "code" || !restored.CreatedAt.Equal(now) {
+		t.Errorf("GetOauth2Flow() = %+v; want the saved flow", restored)
+	}
+	if _, ok, _ := GetOauth2Flow("supplier|2", dir, now); ok {
+		t.Errorf("GetOauth2Flow() returned a flow of another id")
+	}
+
+	info, err := os.Stat(filepath.Join(dir, oauth2FlowsFilename))
+	if err != nil {
+		t.Fatalf("Stat() returned error: %s", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("flows file mode = %s; want -rw-------", info.Mode().Perm())
+	}
+
+	if err := DeleteOauth2Flow("supplier|1", dir); err != nil {
+		t.Fatalf("DeleteOauth2Flow() returned error: %s", err)
+	}
+	if _, ok, _ := GetOauth2Flow("supplier|1", dir, now); ok {
+		t.Errorf("GetOauth2Flow() returned a deleted flow")
+	}
+}
+
+func TestOauth2FlowExpires(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	if err := SaveOauth2Flow("expired", Oauth2Flow{Verifier: "old", CreatedAt: now.Add(-Oauth2FlowTTL - time.Second)}, dir); err != nil {
+		t.Fatalf("SaveOauth2Flow() returned error: %s", err)
+	}
+	if _, ok, _ := GetOauth2Flow("expired", dir, now); ok {
+		t.Errorf("GetOauth2Flow() returned an expired flow")
+	}
+
+	// Expired flows are removed when another flow is saved
+	if err := SaveOauth2Flow("current", Oauth2Flow{Verifier: "new"}, dir); err != nil {
+		t.Fatalf("SaveOauth2Flow() returned error: %s", err)
+	}
+	flows, err := readOauth2FlowsFile(dir)
+	if err != nil {
+		t.Fatalf("readOauth2FlowsFile() returned error: %s", err)
+	}
+	if _, ok := flows.Flows["expired"]; ok || len(flows.Flows) != 1 {
+		t.Errorf("flows file = %+v; want only the current flow", flows.Flows)
+	}
+	if _, ok, _ := GetOauth2Flow("current", dir, time.Now()); !ok {
+		t.Errorf("GetOauth2Flow() didn't return the current flow")
+	}
+}
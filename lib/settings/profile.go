@@ -0,0 +1,83 @@
+package settings
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Profile is a named set of settings in `profiles` (e.g. per client of a freelancer), selected via `--profile`.
+// Its values overlay the base configuration, empty values keep the base configuration.
+type Profile struct {
+	// Name is the key of the profile in `profiles`
+	Name string `mapstructure:"-"`
+	// Vault is the name or ID of the configured vault (`credential_provider_vaults`) to use instead of the selected vault
+	Vault string `mapstructure:"vault"`
+	// DocumentsDirectory is the directory of the documents, instead of `documents` in the buchhalter directory
+	DocumentsDirectory string `mapstructure:"documentsDirectory"`
+	// Team is the slug of the team documents are uploaded to, instead of the team of the vault
+	Team string `mapstructure:"team"`
+	// APIKeyEnv is the environment variable with the buchhalter SaaS API key, instead of the API key of the vault
+	APIKeyEnv string `mapstructure:"apiKeyEnv"`
+}
+
+// ApplyProfile overlays the profile name of `profiles` on the configuration, an empty name applies no profile.
+// The documents directory is replaced, the vault, team and API key apply to the vault of a run (see FindVault and ApplyToVault).
+// The vaults of the configuration are not changed, the vault commands write them back to the configuration file.
+func (c *Config) ApplyProfile(name string) error {
+	// The keys of the configuration file are case-insensitive
+	name = strings.ToLower(strings.TrimSpace(name))
+	if len(name) == 0 {
+		return nil
+	}
+	profile, ok := c.Profiles[name]
+	if !ok {
+		names := make([]string, 0, len(c.Profiles))
+		for profileName := range c.Profiles {
+			names = append(names, profileName)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return fmt.Errorf("unknown profile `%s`, no profiles are configured in `%s`", name, KeyProfiles)
+		}
+		return fmt.Errorf("unknown profile `%s` (configured profiles: %s)", name, strings.Join(names, ", "))
+	}
+
+	profile.Name = name
+	if documentsDirectory := strings.TrimSpace(profile.DocumentsDirectory); len(documentsDirectory) > 0 {
+		c.DocumentsDirectory = documentsDirectory
+	}
+	c.Profile = &profile
+
+	return nil
+}
+
+// FindVault returns the vault of the profile by its name (case-insensitive) or ID.
+// It returns nil, if the profile has no vault or the vault is not configured.
+func (p Profile) FindVault(vaults []Vault) *Vault {
+	vaultName := strings.TrimSpace(p.Vault)
+	if len(vaultName) == 0 {
+		return nil
+	}
+	for _, v := range vaults {
+		if v.ID == vaultName || strings.EqualFold(v.Name, vaultName) {
+			return &v
+		}
+	}
+	return nil
+}
+
+// ApplyToVault returns v with the team and the API key of the profile, lookupEnv reads the environment variable of `apiKeyEnv` (e.g. os.LookupEnv).
+func (p Profile) ApplyToVault(v Vault, lookupEnv func(string) (string, bool)) (Vault, error) {
+	if team := strings.TrimSpace(p.Team); len(team) > 0 {
+		v.BuchhalterTeam = team
+	}
+	if apiKeyEnv := strings.TrimSpace(p.APIKeyEnv); len(apiKeyEnv) > 0 {
+		apiKey, _ := lookupEnv(apiKeyEnv)
+		if apiKey = strings.TrimSpace(apiKey); len(apiKey) == 0 {
+			return v, fmt.Errorf("environment variable `%s` with the buchhalter SaaS API key of profile `%s` is not set", apiKeyEnv, p.Name)
+		}
+		v.BuchhalterAPIKey = apiKey
+	}
+	return v, nil
+}
@@ -0,0 +1,107 @@
+package settings
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyProfile(t *testing.T) {
+	configFile := `
+credential_provider_vaults:
+  - id: abc123
+    name: Buchhalter
+    buchhalterAPIKey: key
+    buchhalterTeam: acme
+    selected: true
+  - id: def456
+    name: Client ACME
+profiles:
+  acme:
+    vault: client acme
+    documentsDirectory: /home/jane/clients/acme
+    team: acme-gmbh
+    apiKeyEnv: ACME_API_KEY
+  minimal:
+    team: other
+`
+	tests := []struct {
+		profile                    string
+		expectedDocumentsDirectory string
+		expectedVault              string
+		expectError                bool
+	}{
+		{"", "/home/jane/buchhalter/documents", "", false},
+		{"acme", "/home/jane/clients/acme", "def456", false},
+		{"minimal", "/home/jane/buchhalter/documents", "", false},
+		{"ACME", "/home/jane/clients/acme", "def456", false},
+		{"unknown", "/home/jane/buchhalter/documents", "", true},
+	}
+
+	for _, test := range tests {
+		v := newTestViper(t, configFile)
+		v.Set(KeyDocumentsDirectory, "/home/jane/buchhalter/documents")
+		config, err := Load(v)
+		if err != nil {
+			t.Fatalf("Load() returned error: %s", err)
+		}
+
+		err = config.ApplyProfile(test.profile)
+		if (err != nil) != test.expectError {
+			t.Errorf("ApplyProfile(%q) returned error %v; want error %t", test.profile, err, test.expectError)
+		}
+		if config.DocumentsDirectory != test.expectedDocumentsDirectory {
+			t.Errorf("ApplyProfile(%q) DocumentsDirectory = %s; want %s", test.profile, config.DocumentsDirectory, test.expectedDocumentsDirectory)
+		}
+		if test.expectError || len(test.profile) == 0 {
+			if config.Profile != nil {
+				t.Errorf("ApplyProfile(%q) Profile = %+v; want nil", test.profile, config.Profile)
+			}
+			continue
+		}
+		if config.Profile == nil || config.Profile.Name != strings.ToLower(test.profile) {
+			t.Fatalf("ApplyProfile(%q) Profile = %+v; want the profile", test.profile, config.Profile)
+		}
+		vaultID := ""
+		if profileVault := config.Profile.FindVault(config.Vaults); profileVault != nil {
+			vaultID = profileVault.ID
+		}
+		if vaultID != test.expectedVault {
+			t.Errorf("ApplyProfile(%q) FindVault() = %q; want %q", test.profile, vaultID, test.expectedVault)
+		}
+		// The configured vaults are not changed
+		if !config.Vaults[0].Selected || config.Vaults[0].BuchhalterTeam != "acme" {
+			t.Errorf("ApplyProfile(%q) changed the vaults: %+v", test.profile, config.Vaults)
+		}
+	}
+}
+
+func TestProfileApplyToVault(t *testing.T) {
+	env := map[string]string{"ACME_API_KEY": "acme-key"}
+	lookupEnv := func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+	baseVault := Vault{ID: "abc123", Name: "Buchhalter", BuchhalterAPIKey: "key", BuchhalterTeam: "acme"}
+
+	tests := []struct {
+		name        string
+		profile     Profile
+		expected    Vault
+		expectError bool
+	}{
+		{"empty profile", Profile{Name: "empty"}, baseVault, false},
+		{"team", Profile{Name: "team", Team: "acme-gmbh"}, Vault{ID: "abc123", Name: "Buchhalter", BuchhalterAPIKey: "key", BuchhalterTeam: "acme-gmbh"}, false},
+		{"api key", Profile{Name: "key", APIKeyEnv: "ACME_API_KEY"}, Vault{ID: "abc123", Name: "Buchhalter", BuchhalterAPIKey: "acme-key", BuchhalterTeam: "acme"}, false},
+		{"missing api key", Profile{Name: "missing", APIKeyEnv: "OTHER_API_KEY"}, baseVault, true},
+	}
+
+	for _, test := range tests {
+		v, err := test.profile.ApplyToVault(baseVault, lookupEnv)
+		if (err != nil) != test.expectError {
+			t.Errorf("%s: ApplyToVault() returned error %v; want error %t", test.name, err, test.expectError)
+		}
+		if v != test.expected {
+			t.Errorf("%s: ApplyToVault() = %+v; want %+v", test.name, v, test.expected)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package settings
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"buchhalter/lib/browser"
+	"buchhalter/lib/parser"
+	"buchhalter/lib/repository"
+	"buchhalter/lib/utils"
+
+	"github.com/spf13/viper"
+)
+
+// Keys of the settings in the configuration file (~/.buchhalter/.buchhalter.yaml).
+const (
+	KeyCredentialProvider               = "credential_provider"
+	KeyCredentialProviderCliCommand     = "credential_provider_cli_command"
+	KeyCredentialProviderItemTag        = "credential_provider_item_tag"
+	KeyCredentialProviderKeePassFile    = "credential_provider_keepass_file"
+	KeyCredentialProviderKeePassKeyFile = "credential_provider_keepass_key_file"
+	KeyCredentialProviderFile           = "credential_provider_file"
+	KeyCredentialProviderVaults         = "credential_provider_vaults"
+	KeyDirectory                        = "buchhalter_directory"
+	KeyConfigDirectory                  = "buchhalter_config_directory"
+	KeyConfigFile                       = "buchhalter_config_file"
+	KeyDocumentsDirectory               = "buchhalter_documents_directory"
+	KeyMaxDownloadFilesPerReceipt       = "buchhalter_max_download_files_per_receipt"
+	KeyDownloadConcurrency              = "buchhalter_download_concurrency"
+	KeySuppliersInclude                 = "buchhalter_suppliers_include"
+	KeySuppliersExclude                 = "buchhalter_suppliers_exclude"
+	KeySupplierItems                    = "buchhalter_supplier_items"
+	KeyDocumentLayout                   = "buchhalter_document_layout"
+	KeyDedupScope                       = "buchhalter_dedup_scope"
+	KeyStagingDirectory                 = "buchhalter_staging_directory"
+	KeyKeepDownloads                    = "buchhalter_keep_downloads"
+	KeyStagingCleanupAge                = "buchhalter_staging_cleanup_age"
+	KeyUnzipMaxSizeMB                   = "buchhalter_unzip_max_size_mb"
+	KeyUnzipMaxFiles                    = "buchhalter_unzip_max_files"
+	KeyPdfMerge                         = "buchhalter_pdf_merge"
+	KeyTLSOverrides                     = "buchhalter_tls_overrides"
+	KeyClientCertificates               = "buchhalter_client_certificates"
+	KeyChromePath                       = "buchhalter_chrome_path"
+	KeyHeadless                         = "buchhalter_headless"
+	KeyHeadfulSuppliers                 = "buchhalter_headful_suppliers"
+	KeyRestrictDomains                  = "buchhalter_restrict_domains"
+	KeyAllowedDomains                   = "buchhalter_allowed_domains"
+	KeyDeniedDomains                    = "buchhalter_denied_domains"
+	KeyUploadExistenceChunkSize         = "buchhalter_upload_existence_chunk_size"
+	KeyUploadExistenceConcurrency       = "buchhalter_upload_existence_concurrency"
+	KeyUploadExistenceTimeout           = "buchhalter_upload_existence_timeout"
+	KeyUploadExistenceAttempts          = "buchhalter_upload_existence_attempts"
+	KeyAPIHost                          = "buchhalter_api_host"
+	KeyOICDBUpdateAttempts              = "buchhalter_oicdb_update_attempts"
+	KeyOICDBUpdateTimeout               = "buchhalter_oicdb_update_timeout"
+	KeyAlwaysSendMetrics                = "buchhalter_always_send_metrics"
+	KeySendCrashReports                 = "buchhalter_send_crash_reports"
+	KeyStatusFile                       = "buchhalter_status_file"
+	KeyStatusInterval                   = "buchhalter_status_interval"
+	KeyTotpClockSkew                    = "buchhalter_totp_clock_skew"
+	KeyWebhookURL                       = "buchhalter_webhook_url"
+	KeyWebhookSecret                    = "buchhalter_webhook_secret"
+	KeyProfiles                         = "profiles"
+	KeyDev                              = "dev"
+)
+
+// MaxDownloadFilesPerReceiptWarnLimit is the number of files per receipt above which Load warns,
+// the portals of the suppliers don't list that many invoices (`0` downloads all invoices).
+const MaxDownloadFilesPerReceiptWarnLimit = 100
+
+// Setting is a known setting of `buchhalter config get/set` with its default value.
+type Setting struct {
+	Key     string
+	Default interface{}
+}
+
+// Vault is a configured vault of the credential provider (`credential_provider_vaults`).
+type Vault struct {
+	ID               string `json:"id" mapstructure:"id"`
+	Name             string `json:"name" mapstructure:"name"`
+	BuchhalterAPIKey string `json:"buchhalterAPIKey" mapstructure:"buchhalterAPIKey"`
+	BuchhalterTeam   string `json:"buchhalterTeam,omitempty" mapstructure:"buchhalterTeam"`
+	Selected         bool   `json:"selected" mapstructure:"selected"`
+	// Provider is the credential provider of the vault, empty for the configured `credential_provider`
+	Provider string `json:"provider,omitempty" mapstructure:"provider"`
+}
+
+// ProviderOr returns the credential provider of the vault, defaultProvider (`credential_provider`) without one.
+func (v Vault) ProviderOr(defaultProvider string) string {
+	if len(v.Provider) > 0 {
+		return v.Provider
+	}
+	return defaultProvider
+}
+
+// Defaults returns the known settings with their default values, the directories are in homeDir.
+// `buchhalter_documents_directory` is no known setting, it is derived from `buchhalter_directory` (on purpose not documented).
+func Defaults(homeDir string) []Setting {
+	buchhalterDir := filepath.Join(homeDir, "buchhalter")
+	buchhalterConfigDir := filepath.Join(homeDir, ".buchhalter")
+
+	return []Setting{
+		{KeyCredentialProvider, "1password"},
+		{KeyCredentialProviderCliCommand, ""},
+		{KeyCredentialProviderItemTag, "buchhalter-ai"},
+		{KeyCredentialProviderKeePassFile, ""},
+		{KeyCredentialProviderKeePassKeyFile, ""},
+		{KeyCredentialProviderFile, ""},
+		{KeyCredentialProviderVaults, []Vault{}},
+		{KeyDirectory, buchhalterDir},
+		{KeyConfigDirectory, buchhalterConfigDir},
+		{KeyConfigFile, filepath.Join(buchhalterConfigDir, ".buchhalter.yaml")},
+		{KeyMaxDownloadFilesPerReceipt, 2},
+		{KeyDownloadConcurrency, parser.DefaultDownloadConcurrency},
+		{KeySuppliersInclude, []string{}},
+		{KeySuppliersExclude, []string{}},
+		{KeySupplierItems, map[string]string{}},
+		{KeyDocumentLayout, "supplier"},
+		{KeyDedupScope, "global"},
+		{KeyStagingDirectory, ""},
+		{KeyKeepDownloads, false},
+		{KeyStagingCleanupAge, "24h"},
+		{KeyUnzipMaxSizeMB, utils.DefaultUnzipMaxSizeMB},
+		{KeyUnzipMaxFiles, utils.DefaultUnzipMaxFiles},
+		{KeyPdfMerge, "off"},
+		{KeyTLSOverrides, []browser.TLSOverride{}},
+		{KeyClientCertificates, []browser.ClientCertificate{}},
+		{KeyChromePath, ""},
+		{KeyHeadless, false},
+		{KeyHeadfulSuppliers, []string{}},
+		{KeyRestrictDomains, false},
+		{KeyAllowedDomains, []string{}},
+		{KeyDeniedDomains, []string{}},
+		{KeyUploadExistenceChunkSize, repository.DefaultExistenceCheckChunkSize},
+		{KeyUploadExistenceConcurrency, repository.DefaultExistenceCheckConcurrency},
+		{KeyUploadExistenceTimeout, repository.DefaultExistenceCheckTimeout.String()},
+		{KeyUploadExistenceAttempts, repository.DefaultExistenceCheckAttempts},
+		{KeyAPIHost, "https://app.buchhalter.ai/"},
+		{KeyOICDBUpdateAttempts, repository.DefaultOICDBUpdateAttempts},
+		{KeyOICDBUpdateTimeout, repository.DefaultOICDBUpdateTimeout.String()},
+		{KeyAlwaysSendMetrics, false},
+		{KeySendCrashReports, false},
+		{KeyStatusFile, ""},
+		{KeyStatusInterval, ""},
+		{KeyTotpClockSkew, "0s"},
+		{KeyWebhookURL, ""},
+		{KeyWebhookSecret, ""},
+		{KeyProfiles, map[string]Profile{}},
+		{KeyDev, false},
+	}
+}
+
+// Warning is an unexpected value of a setting, Load corrected or kept it.
+type Warning struct {
+	Key     string
+	Value   interface{}
+	Message string
+}
+
+// Config is the configuration of buchhalter-cli, read once via Load.
+// Durations are kept as configured, they are parsed (and reported) where they are used.
+type Config struct {
+	CredentialProvider               string
+	CredentialProviderCliCommand     string
+	CredentialProviderItemTag        string
+	CredentialProviderKeePassFile    string
+	CredentialProviderKeePassKeyFile string
+	CredentialProviderFile           string
+	Vaults                           []Vault
+
+	Directory          string
+	ConfigDirectory    string
+	ConfigFile         string
+	DocumentsDirectory string
+	StagingDirectory   string
+	KeepDownloads      bool
+	StagingCleanupAge  string
+	UnzipMaxSizeMB     int
+	UnzipMaxFiles      int
+	DocumentLayout     string
+	DedupScope         string
+	PdfMerge           string
+
+	MaxDownloadFilesPerReceipt int
+	DownloadConcurrency        int
+	SuppliersInclude           []string
+	SuppliersExclude           []string
+	SupplierItems              map[string]string
+
+	TLSOverrides       []browser.TLSOverride
+	ClientCertificates []browser.ClientCertificate
+	ChromePath         string
+	Headless           bool
+	HeadfulSuppliers   []string
+	RestrictDomains    bool
+	AllowedDomains     []string
+	DeniedDomains      []string
+
+	APIHost                    string
+	UploadExistenceChunkSize   int
+	UploadExistenceConcurrency int
+	UploadExistenceTimeout     string
+	UploadExistenceAttempts    int
+	OICDBUpdateAttempts        int
+	OICDBUpdateTimeout         string
+	AlwaysSendMetrics          bool
+	SendCrashReports           bool
+
+	StatusFile     string
+	StatusInterval string
+	TotpClockSkew  string
+	WebhookURL     string
+	WebhookSecret  string
+
+	// Profiles are the named profiles of `profiles`, Profile is the one applied via ApplyProfile (nil without a profile)
+	Profiles map[string]Profile
+	Profile  *Profile
+
+	// Dev is the development mode (`--dev`)
+	Dev bool
+
+	// Warnings are the unexpected values of the configuration, they are logged by the commands
+	Warnings []Warning
+}
+
+// Load reads the configuration from v, incl. the defaults and bound flags.
+func Load(v *viper.Viper) (*Config, error) {
+	config := &Config{
+		CredentialProvider:               v.GetString(KeyCredentialProvider),
+		CredentialProviderCliCommand:     v.GetString(KeyCredentialProviderCliCommand),
+		CredentialProviderItemTag:        v.GetString(KeyCredentialProviderItemTag),
+		CredentialProviderKeePassFile:    v.GetString(KeyCredentialProviderKeePassFile),
+		CredentialProviderKeePassKeyFile: v.GetString(KeyCredentialProviderKeePassKeyFile),
+		CredentialProviderFile:           v.GetString(KeyCredentialProviderFile),
+		Vaults:                           []Vault{},
+
+		Directory:          v.GetString(KeyDirectory),
+		ConfigDirectory:    v.GetString(KeyConfigDirectory),
+		ConfigFile:         v.GetString(KeyConfigFile),
+		DocumentsDirectory: v.GetString(KeyDocumentsDirectory),
+		StagingDirectory:   v.GetString(KeyStagingDirectory),
+		KeepDownloads:      v.GetBool(KeyKeepDownloads),
+		StagingCleanupAge:  v.GetString(KeyStagingCleanupAge),
+		UnzipMaxSizeMB:     v.GetInt(KeyUnzipMaxSizeMB),
+		UnzipMaxFiles:      v.GetInt(KeyUnzipMaxFiles),
+		DocumentLayout:     v.GetString(KeyDocumentLayout),
+		DedupScope:         v.GetString(KeyDedupScope),
+		PdfMerge:           v.GetString(KeyPdfMerge),
+
+		MaxDownloadFilesPerReceipt: v.GetInt(KeyMaxDownloadFilesPerReceipt),
+		DownloadConcurrency:        v.GetInt(KeyDownloadConcurrency),
+		SuppliersInclude:           v.GetStringSlice(KeySuppliersInclude),
+		SuppliersExclude:           v.GetStringSlice(KeySuppliersExclude),
+		SupplierItems:              v.GetStringMapString(KeySupplierItems),
+
+		TLSOverrides:       []browser.TLSOverride{},
+		ClientCertificates: []browser.ClientCertificate{},
+		ChromePath:         v.GetString(KeyChromePath),
+		Headless:           v.GetBool(KeyHeadless),
+		HeadfulSuppliers:   v.GetStringSlice(KeyHeadfulSuppliers),
+		RestrictDomains:    v.GetBool(KeyRestrictDomains),
+		AllowedDomains:     v.GetStringSlice(KeyAllowedDomains),
+		DeniedDomains:      v.GetStringSlice(KeyDeniedDomains),
+
+		APIHost:                    v.GetString(KeyAPIHost),
+		UploadExistenceChunkSize:   v.GetInt(KeyUploadExistenceChunkSize),
+		UploadExistenceConcurrency: v.GetInt(KeyUploadExistenceConcurrency),
+		UploadExistenceTimeout:     v.GetString(KeyUploadExistenceTimeout),
+		UploadExistenceAttempts:    v.GetInt(KeyUploadExistenceAttempts),
+		OICDBUpdateAttempts:        v.GetInt(KeyOICDBUpdateAttempts),
+		OICDBUpdateTimeout:         v.GetString(KeyOICDBUpdateTimeout),
+		AlwaysSendMetrics:          v.GetBool(KeyAlwaysSendMetrics),
+		SendCrashReports:           v.GetBool(KeySendCrashReports),
+
+		StatusFile:     v.GetString(KeyStatusFile),
+		StatusInterval: v.GetString(KeyStatusInterval),
+		TotpClockSkew:  v.GetString(KeyTotpClockSkew),
+		WebhookURL:     v.GetString(KeyWebhookURL),
+		WebhookSecret:  v.GetString(KeyWebhookSecret),
+
+		Profiles: map[string]Profile{},
+
+		Dev: v.GetBool(KeyDev),
+
+		Warnings: []Warning{},
+	}
+	config.MaxDownloadFilesPerReceipt = config.clampMaxDownloadFilesPerReceipt(config.MaxDownloadFilesPerReceipt)
+
+	// Structured settings can only be changed in the configuration file
+	if err := v.UnmarshalKey(KeyCredentialProviderVaults, &config.Vaults); err != nil {
+		return config, fmt.Errorf("error reading configuration field `%s`: %w", KeyCredentialProviderVaults, err)
+	}
+	if err := v.UnmarshalKey(KeyTLSOverrides, &config.TLSOverrides); err != nil {
+		return config, fmt.Errorf("error reading configuration field `%s`: %w", KeyTLSOverrides, err)
+	}
+	if err := v.UnmarshalKey(KeyClientCertificates, &config.ClientCertificates); err != nil {
+		return config, fmt.Errorf("error reading configuration field `%s`: %w", KeyClientCertificates, err)
+	}
+	if err := v.UnmarshalKey(KeyProfiles, &config.Profiles); err != nil {
+		return config, fmt.Errorf("error reading configuration field `%s`: %w", KeyProfiles, err)
+	}
+
+	return config, nil
+}
+
+// clampMaxDownloadFilesPerReceipt returns the number of files per receipt to download, `0` downloads all invoices.
+// Negative values (e.g. set in the configuration file by hand) are clamped to `0`, unusually high values are kept.
+func (c *Config) clampMaxDownloadFilesPerReceipt(maxFiles int) int {
+	if maxFiles < 0 {
+		c.Warnings = append(c.Warnings, Warning{
+			Key:     KeyMaxDownloadFilesPerReceipt,
+			Value:   maxFiles,
+			Message: "Negative `" + KeyMaxDownloadFilesPerReceipt + "`, all invoices are downloaded",
+		})
+		return 0
+	}
+	if maxFiles > MaxDownloadFilesPerReceiptWarnLimit {
+		c.Warnings = append(c.Warnings, Warning{
+			Key:     KeyMaxDownloadFilesPerReceipt,
+			Value:   maxFiles,
+			Message: "Unusually high `" + KeyMaxDownloadFilesPerReceipt + "`, use `0` to download all invoices",
+		})
+	}
+	return maxFiles
+}
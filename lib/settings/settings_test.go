@@ -0,0 +1,175 @@
+package settings
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func newTestViper(t *testing.T, configFile string) *viper.Viper {
+	t.Helper()
+	v := viper.New()
+	for _, setting := range Defaults("/home/jane") {
+		v.SetDefault(setting.Key, setting.Default)
+	}
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(strings.NewReader(configFile)); err != nil {
+		t.Fatalf("error reading configuration: %s", err)
+	}
+	return v
+}
+
+func TestDefaults(t *testing.T) {
+	keys := map[string]bool{}
+	for _, setting := range Defaults("/home/jane") {
+		if keys[setting.Key] {
+			t.Errorf("Defaults() contains setting %s twice", setting.Key)
+		}
+		keys[setting.Key] = true
+	}
+	if keys[KeyDocumentsDirectory] {
+		t.Errorf("Defaults() contains %s, it is derived from %s", KeyDocumentsDirectory, KeyDirectory)
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	config, err := Load(newTestViper(t, ""))
+	if err != nil {
+		t.Fatalf("Load() returned error: %s", err)
+	}
+
+	if config.CredentialProvider != "1password" || config.CredentialProviderItemTag != "buchhalter-ai" {
+		t.Errorf("Load() credential provider = %s (tag %s); want 1password (tag buchhalter-ai)", config.CredentialProvider, config.CredentialProviderItemTag)
+	}
+	if config.Directory != filepath.Join("/home/jane", "buchhalter") {
+		t.Errorf("Load() Directory = %s; want %s", config.Directory, filepath.Join("/home/jane", "buchhalter"))
+	}
+	if config.ConfigFile != filepath.Join("/home/jane", ".buchhalter", ".buchhalter.yaml") {
+		t.Errorf("Load() ConfigFile = %s; want the file in ~/.buchhalter", config.ConfigFile)
+	}
+	if config.MaxDownloadFilesPerReceipt != 2 || config.StagingCleanupAge != "24h" || config.PdfMerge != "off" {
+		t.Errorf("Load() = %+v; want the defaults", config)
+	}
+	if len(config.Vaults) != 0 || len(config.TLSOverrides) != 0 || len(config.ClientCertificates) != 0 {
+		t.Errorf("Load() structured settings = %v, %v, %v; want none", config.Vaults, config.TLSOverrides, config.ClientCertificates)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	configFile := `
+credential_provider: keepass
+credential_provider_keepass_file: /home/jane/passwords.kdbx
+credential_provider_vaults:
+  - id: abc123
+    name: Buchhalter
+    buchhalterAPIKey: key
+    buchhalterTeam: acme
+    selected: true
+  - id: pass-work
+    name: work
+    provider: pass
+buchhalter_max_download_files_per_receipt: 5
+buchhalter_headless: true
+buchhalter_suppliers_exclude: [hetzner, aws]
+buchhalter_supplier_items:
+  hetzner: item-1
+buchhalter_tls_overrides:
+  - host: portal.example.com
+    insecure: true
+buchhalter_totp_clock_skew: 5s
+`
+	v := newTestViper(t, configFile)
+	v.Set(KeyDev, true)
+	config, err := Load(v)
+	if err != nil {
+		t.Fatalf("Load() returned error: %s", err)
+	}
+
+	if config.CredentialProvider != "keepass" || config.CredentialProviderKeePassFile != "/home/jane/passwords.kdbx" {
+		t.Errorf("Load() KeePass = %s (%s); want keepass (/home/jane/passwords.kdbx)", config.CredentialProvider, config.CredentialProviderKeePassFile)
+	}
+	expectedVaults := []Vault{
+		{ID: "abc123", Name: "Buchhalter", BuchhalterAPIKey: "key", BuchhalterTeam: "acme", Selected: true},
+		{ID: "pass-work", Name: "work", Provider: "pass"},
+	}
+	if !reflect.DeepEqual(config.Vaults, expectedVaults) {
+		t.Errorf("Load() Vaults = %+v; want %+v", config.Vaults, expectedVaults)
+	}
+	// Vaults without a provider use `credential_provider`
+	if config.Vaults[0].ProviderOr(config.CredentialProvider) != "keepass" || config.Vaults[1].ProviderOr(config.CredentialProvider) != "pass" {
+		t.Errorf("ProviderOr() = %s, %s; want keepass, pass", config.Vaults[0].ProviderOr(config.CredentialProvider), config.Vaults[1].ProviderOr(config.CredentialProvider))
+	}
+	if config.MaxDownloadFilesPerReceipt != 5 || !config.Headless || !config.Dev {
+		t.Errorf("Load() = %+v; want the configured values", config)
+	}
+	if strings.Join(config.SuppliersExclude, ",") != "hetzner,aws" {
+		t.Errorf("Load() SuppliersExclude = %v; want [hetzner aws]", config.SuppliersExclude)
+	}
+	if config.SupplierItems["hetzner"] != "item-1" {
+		t.Errorf("Load() SupplierItems = %v; want hetzner: item-1", config.SupplierItems)
+	}
+	if len(config.TLSOverrides) != 1 || config.TLSOverrides[0].Host != "portal.example.com" || !config.TLSOverrides[0].Insecure {
+		t.Errorf("Load() TLSOverrides = %+v; want the override of portal.example.com", config.TLSOverrides)
+	}
+	if config.TotpClockSkew != "5s" {
+		t.Errorf("Load() TotpClockSkew = %s; want 5s", config.TotpClockSkew)
+	}
+}
+
+func TestLoadInvalidStructuredSetting(t *testing.T) {
+	tests := []struct {
+		configFile string
+		key        string
+	}{
+		{"credential_provider_vaults: buchhalter\n", KeyCredentialProviderVaults},
+		{"buchhalter_tls_overrides: portal.example.com\n", KeyTLSOverrides},
+		{"buchhalter_client_certificates: 42\n", KeyClientCertificates},
+		{"profiles: acme\n", KeyProfiles},
+	}
+
+	for _, test := range tests {
+		_, err := Load(newTestViper(t, test.configFile))
+		if err == nil {
+			t.Errorf("Load() of invalid %s returned no error", test.key)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.key) {
+			t.Errorf("Load() error %q doesn't name the setting %s", err, test.key)
+		}
+	}
+}
+
+func TestLoadMaxDownloadFilesPerReceipt(t *testing.T) {
+	tests := []struct {
+		configFile string
+		expected   int
+		warning    bool
+	}{
+		{"", 2, false},
+		{"buchhalter_max_download_files_per_receipt: 0\n", 0, false},
+		{"buchhalter_max_download_files_per_receipt: 5\n", 5, false},
+		{"buchhalter_max_download_files_per_receipt: -3\n", 0, true},
+		{"buchhalter_max_download_files_per_receipt: 100000\n", 100000, true},
+	}
+
+	for _, test := range tests {
+		config, err := Load(newTestViper(t, test.configFile))
+		if err != nil {
+			t.Fatalf("Load(%q) returned error: %s", test.configFile, err)
+		}
+		if config.MaxDownloadFilesPerReceipt != test.expected {
+			t.Errorf("Load(%q) MaxDownloadFilesPerReceipt = %d; want %d", test.configFile, config.MaxDownloadFilesPerReceipt, test.expected)
+		}
+		if warning := len(config.Warnings) > 0; warning != test.warning {
+			t.Errorf("Load(%q) Warnings = %v; want a warning: %t", test.configFile, config.Warnings, test.warning)
+		}
+		for _, warning := range config.Warnings {
+			if warning.Key != KeyMaxDownloadFilesPerReceipt {
+				t.Errorf("Load(%q) warning of %s; want %s", test.configFile, warning.Key, KeyMaxDownloadFilesPerReceipt)
+			}
+		}
+	}
+}
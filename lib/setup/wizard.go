@@ -0,0 +1,363 @@
+package setup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"buchhalter/lib/repository"
+	"buchhalter/lib/settings"
+	"buchhalter/lib/vault"
+)
+
+// Steps of the setup wizard (`buchhalter setup`), in the order they are shown.
+// Only the steps of the chosen credential provider are shown, e.g. the file is only entered for KeePass and the credentials file.
+type Step string
+
+const (
+	StepProvider         Step = "provider"
+	StepProviderFile     Step = "providerFile"
+	StepProviderPassword Step = "providerPassword"
+	StepVault            Step = "vault"
+	StepAPIKey           Step = "apiKey"
+	StepTeam             Step = "team"
+	StepDirectory        Step = "directory"
+	StepConfirm          Step = "confirm"
+	StepDone             Step = "done"
+)
+
+// Environment are the credential providers and the Buchhalter API used by the setup wizard.
+// It is replaced by a mock in tests.
+type Environment interface {
+	// DetectProvider returns an error if the CLI of provider is not installed
+	DetectProvider(provider string) error
+	// Vaults returns the vaults of provider (a vault.VaultLister), e.g. the subtrees of pass or the groups of the KeePass database
+	Vaults(provider string, keePassConfig vault.KeePassConfig) ([]vault.Vault, error)
+	// VerifyAPIKey checks apiKey against Buchhalter API and returns the teams of a valid key
+	VerifyAPIKey(apiKey string) (bool, string, []repository.Team)
+}
+
+// ProviderChoice is a credential provider of the provider step.
+// Err is set if the provider is not installed, it can't be chosen.
+type ProviderChoice struct {
+	Provider string
+	Name     string
+	Err      error
+}
+
+// Providers are the credential providers of the wizard, in the order they are offered.
+var Providers = []string{vault.PROVIDER_1PASSWORD, vault.PROVIDER_PASS, vault.PROVIDER_KEEPASS, vault.PROVIDER_FILE}
+
+// Wizard walks through the setup of buchhalter-cli: the credential provider, the vault, the API key and the directory.
+// Nothing is written until the setup is confirmed, the changed settings are returned by Settings.
+// The steps calling the environment (ChooseProvider, SetProviderPassword and SetAPIKey) may block, e.g. on the 1Password CLI.
+type Wizard struct {
+	env     Environment
+	current *settings.Config
+	step    Step
+
+	Providers []ProviderChoice
+	Provider  string
+	// ProviderFile is the KeePass database (`credential_provider_keepass_file`) or the credentials file (`credential_provider_file`)
+	ProviderFile string
+
+	// Vaults are the vaults of the provider, Vault the chosen one.
+	// Except for 1Password, the first vault is the root vault with all items of the provider
+	Vaults []vault.Vault
+	Vault  *vault.Vault
+
+	// APIKey is the API key of the vault, empty for none. Teams are the teams of a verified API key, Team the chosen one
+	APIKey string
+	Teams  []repository.Team
+	Team   string
+
+	// Directory is the directory of the invoices (`buchhalter_directory`)
+	Directory string
+}
+
+// New returns a wizard at the provider step, prefilled with the current configuration.
+func New(env Environment, current *settings.Config) *Wizard {
+	w := &Wizard{
+		env:       env,
+		current:   current,
+		step:      StepProvider,
+		Providers: []ProviderChoice{},
+		Provider:  current.CredentialProvider,
+		Directory: current.Directory,
+	}
+	for _, provider := range Providers {
+		w.Providers = append(w.Providers, ProviderChoice{
+			Provider: provider,
+			Name:     vault.GetProviderName(provider),
+			Err:      env.DetectProvider(provider),
+		})
+	}
+	return w
+}
+
+// Step returns the current step of the wizard.
+func (w *Wizard) Step() Step {
+	return w.step
+}
+
+// ChooseProvider chooses the credential provider. The vaults of 1Password and pass are loaded via the environment,
+// KeePass and the credentials file continue with the file.
+// On errors (e.g. the provider is not installed), the wizard stays at the provider step.
+func (w *Wizard) ChooseProvider(provider string) error {
+	if w.step != StepProvider {
+		return fmt.Errorf("credential provider can't be chosen in step %s", w.step)
+	}
+	var choice *ProviderChoice
+	for i := range w.Providers {
+		if w.Providers[i].Provider == provider {
+			choice = &w.Providers[i]
+			break
+		}
+	}
+	if choice == nil {
+		return fmt.Errorf("credential provider `%s` is not supported", provider)
+	}
+	if choice.Err != nil {
+		return fmt.Errorf("%s is not installed: %w", choice.Name, choice.Err)
+	}
+
+	switch provider {
+	case vault.PROVIDER_KEEPASS:
+		w.ProviderFile = w.current.CredentialProviderKeePassFile
+		w.step = StepProviderFile
+	case vault.PROVIDER_FILE:
+		w.ProviderFile = w.current.CredentialProviderFile
+		w.step = StepProviderFile
+	default:
+		if err := w.loadVaults(provider, vault.KeePassConfig{}); err != nil {
+			return err
+		}
+	}
+	w.Provider = provider
+	return nil
+}
+
+// ChooseVault chooses the vault vaultID of the provider.
+// The API key of a configured vault is kept, unless a new one is entered.
+func (w *Wizard) ChooseVault(vaultID string) error {
+	if w.step != StepVault {
+		return fmt.Errorf("vault can't be chosen in step %s", w.step)
+	}
+	for i := range w.Vaults {
+		if w.Vaults[i].ID == vaultID {
+			w.Vault = &w.Vaults[i]
+			w.APIKey, w.Team = "", ""
+			if configuredVault := w.configuredVault(vaultID); configuredVault != nil {
+				w.APIKey = configuredVault.BuchhalterAPIKey
+				w.Team = configuredVault.BuchhalterTeam
+			}
+			w.step = StepAPIKey
+			return nil
+		}
+	}
+	return fmt.Errorf("vault `%s` not found in %s", vaultID, vault.GetProviderName(w.Provider))
+}
+
+// SetProviderFile sets the KeePass database or the credentials file, the file must exist.
+// The passphrase of the KeePass database is entered next, the credentials file has only the root vault.
+func (w *Wizard) SetProviderFile(file string) error {
+	if w.step != StepProviderFile {
+		return fmt.Errorf("file can't be set in step %s", w.step)
+	}
+	file, err := expandPath(file)
+	if err != nil {
+		return err
+	}
+	if len(file) == 0 {
+		return fmt.Errorf("no file entered")
+	}
+	if info, err := os.Stat(file); err != nil {
+		return fmt.Errorf("file %s can't be read: %w", file, err)
+	} else if info.IsDir() {
+		return fmt.Errorf("%s is a directory", file)
+	}
+	w.ProviderFile = file
+	if w.Provider == vault.PROVIDER_KEEPASS {
+		w.step = StepProviderPassword
+		return nil
+	}
+	return w.loadVaults(w.Provider, vault.KeePassConfig{})
+}
+
+// SetProviderPassword opens the KeePass database with password (empty if the database is opened with the configured key file) and loads its groups.
+// The password is not part of the settings. On errors (e.g. a wrong password), the wizard stays at the password step.
+func (w *Wizard) SetProviderPassword(password string) error {
+	if w.step != StepProviderPassword {
+		return fmt.Errorf("password can't be set in step %s", w.step)
+	}
+	return w.loadVaults(w.Provider, vault.KeePassConfig{
+		File:     w.ProviderFile,
+		KeyFile:  strings.TrimSpace(w.current.CredentialProviderKeePassKeyFile),
+		Password: password,
+	})
+}
+
+// SetAPIKey verifies the API key via the environment. Without an API key, the API key of a configured vault is kept.
+// If the API key belongs to several teams, the team is chosen next. Invalid API keys are rejected, the wizard stays at the API key step.
+func (w *Wizard) SetAPIKey(apiKey string) error {
+	if w.step != StepAPIKey {
+		return fmt.Errorf("API key can't be set in step %s", w.step)
+	}
+	apiKey = strings.TrimSpace(apiKey)
+	if len(apiKey) == 0 {
+		w.step = StepDirectory
+		return nil
+	}
+	// API keys are 64 characters long
+	if len(apiKey) != 64 {
+		return fmt.Errorf("buchhalter SaaS API Key has not the correct length (%d chars, expected a 64 char key)", len(apiKey))
+	}
+
+	valid, message, teams := w.env.VerifyAPIKey(apiKey)
+	if !valid {
+		return fmt.Errorf("buchhalter SaaS API Key is not valid: %s", message)
+	}
+	w.APIKey = apiKey
+	w.Teams = teams
+	w.Team = ""
+	switch {
+	case len(teams) > 1:
+		w.step = StepTeam
+		return nil
+	case len(teams) == 1:
+		w.Team = teams[0].Slug
+	}
+	w.step = StepDirectory
+	return nil
+}
+
+// ChooseTeam chooses the team of the API key documents are uploaded to.
+func (w *Wizard) ChooseTeam(slug string) error {
+	if w.step != StepTeam {
+		return fmt.Errorf("team can't be chosen in step %s", w.step)
+	}
+	team, err := repository.SelectTeam(w.Teams, slug)
+	if err != nil {
+		return err
+	}
+	w.Team = team.Slug
+	w.step = StepDirectory
+	return nil
+}
+
+// SetDirectory sets the directory of the invoices, an empty directory keeps the current one.
+func (w *Wizard) SetDirectory(directory string) error {
+	if w.step != StepDirectory {
+		return fmt.Errorf("directory can't be set in step %s", w.step)
+	}
+	directory, err := expandPath(directory)
+	if err != nil {
+		return err
+	}
+	if len(directory) > 0 {
+		if info, err := os.Stat(directory); err == nil && !info.IsDir() {
+			return fmt.Errorf("%s is no directory", directory)
+		}
+		w.Directory = directory
+	}
+	w.step = StepConfirm
+	return nil
+}
+
+// Confirm finishes the wizard, the settings are written afterwards.
+func (w *Wizard) Confirm() error {
+	if w.step != StepConfirm {
+		return fmt.Errorf("setup can't be confirmed in step %s", w.step)
+	}
+	w.step = StepDone
+	return nil
+}
+
+// Settings returns the settings of the configuration file changed by the wizard.
+// The chosen vault is added to the configured vaults and selected.
+func (w *Wizard) Settings() map[string]interface{} {
+	changes := map[string]interface{}{
+		settings.KeyCredentialProvider: w.Provider,
+		settings.KeyDirectory:          w.Directory,
+	}
+	switch w.Provider {
+	case vault.PROVIDER_KEEPASS:
+		changes[settings.KeyCredentialProviderKeePassFile] = w.ProviderFile
+	case vault.PROVIDER_FILE:
+		changes[settings.KeyCredentialProviderFile] = w.ProviderFile
+	}
+
+	if w.Vault != nil {
+		vaults := []settings.Vault{}
+		found := false
+		newVault := settings.Vault{ID: w.Vault.ID, Name: w.Vault.Name, BuchhalterAPIKey: w.APIKey, BuchhalterTeam: w.Team, Selected: true}
+		for _, configuredVault := range w.current.Vaults {
+			if configuredVault.ID == newVault.ID {
+				configuredVault = newVault
+				found = true
+			}
+			configuredVault.Selected = configuredVault.ID == newVault.ID
+			vaults = append(vaults, configuredVault)
+		}
+		if !found {
+			vaults = append(vaults, newVault)
+		}
+		changes[settings.KeyCredentialProviderVaults] = vaults
+	}
+	return changes
+}
+
+// loadVaults loads the vaults of provider and continues with the vault step.
+// Except for 1Password, the root vault (an empty base) is offered first. The credentials file has no vaults to list.
+func (w *Wizard) loadVaults(provider string, keePassConfig vault.KeePassConfig) error {
+	vaults := []vault.Vault{}
+	if provider != vault.PROVIDER_1PASSWORD {
+		vaults = append(vaults, RootVault(provider))
+	}
+	if provider != vault.PROVIDER_FILE {
+		providerVaults, err := w.env.Vaults(provider, keePassConfig)
+		if err != nil {
+			return err
+		}
+		vaults = append(vaults, providerVaults...)
+	}
+	if len(vaults) == 0 {
+		return fmt.Errorf("no vaults found in %s", vault.GetProviderName(provider))
+	}
+	w.Vaults = vaults
+	w.Vault = nil
+	w.step = StepVault
+	return nil
+}
+
+// RootVault returns the vault with all items of provider, e.g. the whole password store of pass.
+// Its name is the empty base.
+func RootVault(provider string) vault.Vault {
+	return vault.Vault{ID: provider, Name: ""}
+}
+
+func (w *Wizard) configuredVault(vaultID string) *settings.Vault {
+	for i := range w.current.Vaults {
+		if w.current.Vaults[i].ID == vaultID {
+			return &w.current.Vaults[i]
+		}
+	}
+	return nil
+}
+
+// expandPath returns the absolute path of path, `~/` is the home directory of the user.
+func expandPath(path string) (string, error) {
+	path = strings.TrimSpace(path)
+	if len(path) == 0 {
+		return "", nil
+	}
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("error resolving home directory: %w", err)
+		}
+		path = filepath.Join(homeDir, strings.TrimPrefix(path, "~"))
+	}
+	return filepath.Abs(path)
+}
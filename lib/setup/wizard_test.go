@@ -0,0 +1,339 @@
+package setup
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"buchhalter/lib/repository"
+	"buchhalter/lib/settings"
+	"buchhalter/lib/vault"
+)
+
+// mockEnvironment has the installed providers and their vaults, KeePass and the credentials file are always available.
+// API keys starting with `v` are valid and belong to teams.
+type mockEnvironment struct {
+	installed     map[string]bool
+	vaults        []vault.Vault
+	vaultsErr     error
+	keePassConfig vault.KeePassConfig
+	teams         []repository.Team
+	verifyCalls   int
+}
+
+func (e *mockEnvironment) DetectProvider(provider string) error {
+	if provider == vault.PROVIDER_KEEPASS || provider == vault.PROVIDER_FILE || e.installed[provider] {
+		return nil
+	}
+	return errors.New("executable not found")
+}
+
+func (e *mockEnvironment) Vaults(provider string, keePassConfig vault.KeePassConfig) ([]vault.Vault, error) {
+	e.keePassConfig = keePassConfig
+	return e.vaults, e.vaultsErr
+}
+
+func (e *mockEnvironment) VerifyAPIKey(apiKey string) (bool, string, []repository.Team) {
+	e.verifyCalls++
+	if !strings.HasPrefix(apiKey, "v") {
+		return false, "API Key is not valid", nil
+	}
+	return true, "API Key is valid", e.teams
+}
+
+func apiKey(prefix string) string {
+	return prefix + strings.Repeat("x", 64-len(prefix))
+}
+
+func TestWizard1Password(t *testing.T) {
+	env := &mockEnvironment{
+		installed: map[string]bool{vault.PROVIDER_1PASSWORD: true},
+		vaults:    []vault.Vault{{ID: "v1", Name: "Private"}, {ID: "v2", Name: "Business"}},
+		teams:     []repository.Team{{Name: "ACME", Slug: "acme"}, {Name: "Example", Slug: "example"}},
+	}
+	current := &settings.Config{
+		CredentialProvider: vault.PROVIDER_1PASSWORD,
+		Directory:          "/home/jane/buchhalter",
+		Vaults:             []settings.Vault{{ID: "v1", Name: "Private", Selected: true}},
+	}
+	w := New(env, current)
+
+	if w.Step() != StepProvider {
+		t.Fatalf("Step() = %s; want %s", w.Step(), StepProvider)
+	}
+	if err := w.ChooseProvider(vault.PROVIDER_PASS); err == nil {
+		t.Errorf("ChooseProvider() of a provider that is not installed returned no error")
+	}
+	if err := w.ChooseProvider(vault.PROVIDER_1PASSWORD); err != nil {
+		t.Fatalf("ChooseProvider() returned error: %s", err)
+	}
+	if w.Step() != StepVault || len(w.Vaults) != 2 {
+		t.Fatalf("Step() = %s with %d vaults; want %s with 2 vaults", w.Step(), len(w.Vaults), StepVault)
+	}
+
+	if err := w.ChooseVault("unknown"); err == nil {
+		t.Errorf("ChooseVault() of an unknown vault returned no error")
+	}
+	if err := w.ChooseVault("v2"); err != nil {
+		t.Fatalf("ChooseVault() returned error: %s", err)
+	}
+	if w.Step() != StepAPIKey {
+		t.Fatalf("Step() = %s; want %s", w.Step(), StepAPIKey)
+	}
+
+	// Invalid API keys are rejected, the wizard stays at the API key step
+	for _, invalidKey := range []string{"too-short", apiKey("i")} {
+		if err := w.SetAPIKey(invalidKey); err == nil {
+			t.Errorf("SetAPIKey(%q) returned no error", invalidKey)
+		}
+		if w.Step() != StepAPIKey {
+			t.Errorf("Step() after SetAPIKey(%q) = %s; want %s", invalidKey, w.Step(), StepAPIKey)
+		}
+	}
+	if env.verifyCalls != 1 {
+		t.Errorf("API keys verified %d times; want 1 (API keys with the wrong length are not verified)", env.verifyCalls)
+	}
+
+	if err := w.SetAPIKey(apiKey("v")); err != nil {
+		t.Fatalf("SetAPIKey() returned error: %s", err)
+	}
+	if w.Step() != StepTeam {
+		t.Fatalf("Step() = %s; want %s (API key of several teams)", w.Step(), StepTeam)
+	}
+	if err := w.ChooseTeam("example"); err != nil {
+		t.Fatalf("ChooseTeam() returned error: %s", err)
+	}
+
+	if w.Step() != StepDirectory {
+		t.Fatalf("Step() = %s; want %s", w.Step(), StepDirectory)
+	}
+	if err := w.SetDirectory(""); err != nil {
+		t.Fatalf("SetDirectory() returned error: %s", err)
+	}
+	if err := w.Confirm(); err != nil {
+		t.Fatalf("Confirm() returned error: %s", err)
+	}
+	if w.Step() != StepDone {
+		t.Fatalf("Step() = %s; want %s", w.Step(), StepDone)
+	}
+
+	changes := w.Settings()
+	if changes[settings.KeyCredentialProvider] != vault.PROVIDER_1PASSWORD || changes[settings.KeyDirectory] != "/home/jane/buchhalter" {
+		t.Errorf("Settings() = %v; want 1Password and the current directory", changes)
+	}
+	vaults := changes[settings.KeyCredentialProviderVaults].([]settings.Vault)
+	expected := []settings.Vault{
+		{ID: "v1", Name: "Private", Selected: false},
+		{ID: "v2", Name: "Business", BuchhalterAPIKey: apiKey("v"), BuchhalterTeam: "example", Selected: true},
+	}
+	if len(vaults) != len(expected) || vaults[0] != expected[0] || vaults[1] != expected[1] {
+		t.Errorf("Settings() vaults = %+v; want %+v", vaults, expected)
+	}
+}
+
+func TestWizardKeepsAPIKeyOfConfiguredVault(t *testing.T) {
+	env := &mockEnvironment{
+		installed: map[string]bool{vault.PROVIDER_1PASSWORD: true},
+		vaults:    []vault.Vault{{ID: "v1", Name: "Private"}},
+	}
+	current := &settings.Config{Vaults: []settings.Vault{{ID: "v1", Name: "Old name", BuchhalterAPIKey: apiKey("v"), BuchhalterTeam: "acme"}}}
+	w := New(env, current)
+
+	if err := w.ChooseProvider(vault.PROVIDER_1PASSWORD); err != nil {
+		t.Fatalf("ChooseProvider() returned error: %s", err)
+	}
+	if err := w.ChooseVault("v1"); err != nil {
+		t.Fatalf("ChooseVault() returned error: %s", err)
+	}
+	if err := w.SetAPIKey(""); err != nil {
+		t.Fatalf("SetAPIKey() without API key returned error: %s", err)
+	}
+	if env.verifyCalls != 0 {
+		t.Errorf("API keys verified %d times; want none", env.verifyCalls)
+	}
+
+	vaults := w.Settings()[settings.KeyCredentialProviderVaults].([]settings.Vault)
+	expected := settings.Vault{ID: "v1", Name: "Private", BuchhalterAPIKey: apiKey("v"), BuchhalterTeam: "acme", Selected: true}
+	if len(vaults) != 1 || vaults[0] != expected {
+		t.Errorf("Settings() vaults = %+v; want %+v", vaults, expected)
+	}
+}
+
+func TestWizard1PasswordErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		env  *mockEnvironment
+	}{
+		{"not signed in", &mockEnvironment{installed: map[string]bool{vault.PROVIDER_1PASSWORD: true}, vaultsErr: errors.New("not signed in")}},
+		{"no vaults", &mockEnvironment{installed: map[string]bool{vault.PROVIDER_1PASSWORD: true}}},
+	}
+
+	for _, test := range tests {
+		w := New(test.env, &settings.Config{})
+		if err := w.ChooseProvider(vault.PROVIDER_1PASSWORD); err == nil {
+			t.Errorf("%s: ChooseProvider() returned no error", test.name)
+		}
+		if w.Step() != StepProvider {
+			t.Errorf("%s: Step() = %s; want %s", test.name, w.Step(), StepProvider)
+		}
+	}
+}
+
+func TestWizardPass(t *testing.T) {
+	env := &mockEnvironment{
+		installed: map[string]bool{vault.PROVIDER_PASS: true},
+		vaults:    []vault.Vault{{ID: "pass-buchhalter", Name: "buchhalter"}},
+		teams:     []repository.Team{{Name: "ACME", Slug: "acme"}},
+	}
+	w := New(env, &settings.Config{Directory: "/home/jane/buchhalter"})
+
+	if err := w.ChooseProvider(vault.PROVIDER_PASS); err != nil {
+		t.Fatalf("ChooseProvider() returned error: %s", err)
+	}
+	// The root vault is offered before the subtrees of the password store
+	if w.Step() != StepVault || len(w.Vaults) != 2 || w.Vaults[0] != RootVault(vault.PROVIDER_PASS) {
+		t.Fatalf("Step() = %s with vaults %+v; want %s with the root vault and the subtree", w.Step(), w.Vaults, StepVault)
+	}
+	if err := w.ChooseVault("pass-buchhalter"); err != nil {
+		t.Fatalf("ChooseVault() returned error: %s", err)
+	}
+	if err := w.SetAPIKey(apiKey("v")); err != nil {
+		t.Fatalf("SetAPIKey() returned error: %s", err)
+	}
+	if err := w.SetDirectory(""); err != nil {
+		t.Fatalf("SetDirectory() returned error: %s", err)
+	}
+	if err := w.Confirm(); err != nil {
+		t.Fatalf("Confirm() returned error: %s", err)
+	}
+
+	changes := w.Settings()
+	if changes[settings.KeyCredentialProvider] != vault.PROVIDER_PASS {
+		t.Errorf("Settings() = %v; want pass", changes)
+	}
+	vaults := changes[settings.KeyCredentialProviderVaults].([]settings.Vault)
+	expected := settings.Vault{ID: "pass-buchhalter", Name: "buchhalter", BuchhalterAPIKey: apiKey("v"), BuchhalterTeam: "acme", Selected: true}
+	if len(vaults) != 1 || vaults[0] != expected {
+		t.Errorf("Settings() vaults = %+v; want %+v", vaults, expected)
+	}
+}
+
+func TestWizardProviderFile(t *testing.T) {
+	database := filepath.Join(t.TempDir(), "passwords.kdbx")
+	if err := os.WriteFile(database, []byte("kdbx"), 0600); err != nil {
+		t.Fatalf("error writing database: %s", err)
+	}
+	directory := t.TempDir()
+
+	for _, provider := range []string{vault.PROVIDER_KEEPASS, vault.PROVIDER_FILE} {
+		env := &mockEnvironment{vaults: []vault.Vault{{ID: "keepass-finance", Name: "Finance"}}}
+		w := New(env, &settings.Config{Directory: "/home/jane/buchhalter", CredentialProviderKeePassKeyFile: "/home/jane/passwords.key"})
+		if err := w.ChooseProvider(provider); err != nil {
+			t.Fatalf("%s: ChooseProvider() returned error: %s", provider, err)
+		}
+		if w.Step() != StepProviderFile {
+			t.Fatalf("%s: Step() = %s; want %s", provider, w.Step(), StepProviderFile)
+		}
+		if err := w.SetProviderFile(filepath.Join(directory, "missing.kdbx")); err == nil {
+			t.Errorf("%s: SetProviderFile() of a missing file returned no error", provider)
+		}
+		if err := w.SetProviderFile(database); err != nil {
+			t.Fatalf("%s: SetProviderFile() returned error: %s", provider, err)
+		}
+
+		// The groups of the KeePass database are loaded with the passphrase, the credentials file has only the root vault
+		expectedVaults := []vault.Vault{RootVault(provider)}
+		if provider == vault.PROVIDER_KEEPASS {
+			if w.Step() != StepProviderPassword {
+				t.Fatalf("%s: Step() = %s; want %s", provider, w.Step(), StepProviderPassword)
+			}
+			if err := w.SetProviderPassword("secret"); err != nil {
+				t.Fatalf("%s: SetProviderPassword() returned error: %s", provider, err)
+			}
+			expectedKeePassConfig := vault.KeePassConfig{File: database, KeyFile: "/home/jane/passwords.key", Password: "secret"}
+			if env.keePassConfig != expectedKeePassConfig {
+				t.Errorf("%s: vaults loaded with %+v; want %+v", provider, env.keePassConfig, expectedKeePassConfig)
+			}
+			expectedVaults = append(expectedVaults, env.vaults...)
+		}
+		if w.Step() != StepVault || len(w.Vaults) != len(expectedVaults) || w.Vaults[0] != expectedVaults[0] {
+			t.Fatalf("%s: Step() = %s with vaults %+v; want %s with %+v", provider, w.Step(), w.Vaults, StepVault, expectedVaults)
+		}
+
+		if err := w.ChooseVault(provider); err != nil {
+			t.Fatalf("%s: ChooseVault() of the root vault returned error: %s", provider, err)
+		}
+		if err := w.SetAPIKey(apiKey("v")); err != nil {
+			t.Fatalf("%s: SetAPIKey() returned error: %s", provider, err)
+		}
+		if err := w.SetDirectory(directory); err != nil {
+			t.Fatalf("%s: SetDirectory() returned error: %s", provider, err)
+		}
+		if err := w.Confirm(); err != nil {
+			t.Fatalf("%s: Confirm() returned error: %s", provider, err)
+		}
+
+		changes := w.Settings()
+		fileKey := settings.KeyCredentialProviderKeePassFile
+		if provider == vault.PROVIDER_FILE {
+			fileKey = settings.KeyCredentialProviderFile
+		}
+		if changes[settings.KeyCredentialProvider] != provider || changes[fileKey] != database || changes[settings.KeyDirectory] != directory {
+			t.Errorf("%s: Settings() = %v; want the provider, its file and the directory", provider, changes)
+		}
+		vaults := changes[settings.KeyCredentialProviderVaults].([]settings.Vault)
+		expected := settings.Vault{ID: provider, Name: "", BuchhalterAPIKey: apiKey("v"), Selected: true}
+		if len(vaults) != 1 || vaults[0] != expected {
+			t.Errorf("%s: Settings() vaults = %+v; want %+v", provider, vaults, expected)
+		}
+	}
+}
+
+func TestWizardKeePassPasswordError(t *testing.T) {
+	database := filepath.Join(t.TempDir(), "passwords.kdbx")
+	if err := os.WriteFile(database, []byte("kdbx"), 0600); err != nil {
+		t.Fatalf("error writing database: %s", err)
+	}
+
+	w := New(&mockEnvironment{vaultsErr: errors.New("wrong passphrase")}, &settings.Config{})
+	if err := w.ChooseProvider(vault.PROVIDER_KEEPASS); err != nil {
+		t.Fatalf("ChooseProvider() returned error: %s", err)
+	}
+	if err := w.SetProviderFile(database); err != nil {
+		t.Fatalf("SetProviderFile() returned error: %s", err)
+	}
+	if err := w.SetProviderPassword("wrong"); err == nil {
+		t.Errorf("SetProviderPassword() with a wrong passphrase returned no error")
+	}
+	if w.Step() != StepProviderPassword {
+		t.Errorf("Step() = %s; want %s", w.Step(), StepProviderPassword)
+	}
+}
+
+func TestWizardStepOrder(t *testing.T) {
+	w := New(&mockEnvironment{installed: map[string]bool{vault.PROVIDER_PASS: true}}, &settings.Config{})
+
+	// Steps can't be skipped
+	if err := w.SetDirectory("/tmp"); err == nil {
+		t.Errorf("SetDirectory() in step %s returned no error", StepProvider)
+	}
+	if err := w.Confirm(); err == nil {
+		t.Errorf("Confirm() in step %s returned no error", StepProvider)
+	}
+
+	// pass has no file, its root vault is offered without subtrees
+	if err := w.ChooseProvider(vault.PROVIDER_PASS); err != nil {
+		t.Fatalf("ChooseProvider() returned error: %s", err)
+	}
+	if w.Step() != StepVault || len(w.Vaults) != 1 {
+		t.Errorf("Step() = %s with %d vaults; want %s with the root vault", w.Step(), len(w.Vaults), StepVault)
+	}
+	if err := w.SetProviderPassword(""); err == nil {
+		t.Errorf("SetProviderPassword() in step %s returned no error", StepVault)
+	}
+	if err := w.SetAPIKey(apiKey("v")); err == nil {
+		t.Errorf("SetAPIKey() in step %s returned no error", StepVault)
+	}
+}
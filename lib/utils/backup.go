@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// BackupFileSuffix is appended to the name of the last-known-good copy of a file, that is replaced by an update (e.g. `oicdb.json.bak`).
+const BackupFileSuffix = ".bak"
+
+// BackupFile copies file to its backup before it is replaced by an update.
+// An existing backup is kept: it is the last-known-good version until the update is accepted via RemoveBackup.
+// A missing file has no backup.
+func BackupFile(file string) error {
+	backupFile := file + BackupFileSuffix
+	if _, err := os.Stat(backupFile); err == nil {
+		return nil
+	}
+
+	content, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", file, err)
+	}
+	if err := WriteFileAtomic(backupFile, content, 0644); err != nil {
+		return fmt.Errorf("error writing backup %s: %w", backupFile, err)
+	}
+
+	return nil
+}
+
+// RestoreBackup replaces file with its backup (see BackupFile), it returns false if file has no backup.
+func RestoreBackup(file string) (bool, error) {
+	backupFile := file + BackupFileSuffix
+	if _, err := os.Stat(backupFile); errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err := os.Rename(backupFile, file); err != nil {
+		return false, fmt.Errorf("error restoring backup %s: %w", backupFile, err)
+	}
+
+	return true, nil
+}
+
+// RemoveBackup removes the backup of file, once an update of file is accepted.
+func RemoveBackup(file string) error {
+	if err := os.Remove(file + BackupFileSuffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error removing backup of %s: %w", file, err)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackupFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "oicdb.json")
+
+	// A missing file has no backup
+	if err := BackupFile(file); err != nil {
+		t.Fatalf("BackupFile() of a missing file returned error: %s", err)
+	}
+	if restored, err := RestoreBackup(file); restored || err != nil {
+		t.Errorf("RestoreBackup() without a backup = %t, %v; want false, nil", restored, err)
+	}
+
+	// The backup keeps the last-known-good version over several updates
+	for _, content := range []string{"good", "update-1"} {
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatalf("error writing file: %s", err)
+		}
+		if err := BackupFile(file); err != nil {
+			t.Fatalf("BackupFile() returned error: %s", err)
+		}
+	}
+	if err := os.WriteFile(file, []byte("update-2"), 0644); err != nil {
+		t.Fatalf("error writing file: %s", err)
+	}
+
+	restored, err := RestoreBackup(file)
+	if !restored || err != nil {
+		t.Fatalf("RestoreBackup() = %t, %v; want true, nil", restored, err)
+	}
+	if content, err := os.ReadFile(file); err != nil || string(content) != "good" {
+		t.Errorf("restored file = %q, %v; want %q", content, err, "good")
+	}
+	if _, err := os.Stat(file + BackupFileSuffix); !os.IsNotExist(err) {
+		t.Errorf("backup exists after RestoreBackup(); want it to be removed")
+	}
+
+	// An accepted update removes the backup
+	if err := BackupFile(file); err != nil {
+		t.Fatalf("BackupFile() returned error: %s", err)
+	}
+	if err := RemoveBackup(file); err != nil {
+		t.Fatalf("RemoveBackup() returned error: %s", err)
+	}
+	if err := RemoveBackup(file); err != nil {
+		t.Errorf("RemoveBackup() without a backup returned error: %s", err)
+	}
+	if restored, _ := RestoreBackup(file); restored {
+		t.Errorf("RestoreBackup() after RemoveBackup() = true; want false")
+	}
+}
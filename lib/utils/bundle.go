@@ -0,0 +1,229 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// ConfigBundleFormatVersion is the version of the content of a configuration bundle.
+const ConfigBundleFormatVersion = 1
+
+// configBundleMagic starts every encrypted configuration bundle, it is authenticated with the content
+var configBundleMagic = []byte("buchhalter-config-bundle-v1\n")
+
+// Key derivation of the bundle passphrase (scrypt, see RFC 7914 for the parameters)
+const (
+	configBundleSaltSize = 16
+	configBundleScryptN  = 1 << 15
+	configBundleScryptR  = 8
+	configBundleScryptP  = 1
+	configBundleKeySize  = 32
+)
+
+// ConfigBundleExcludedFiles are the files of the configuration directory that are not bundled.
+// The OICDB is downloaded again on the first sync, in-flight OAuth2 flows expire within minutes.
+var ConfigBundleExcludedFiles = []string{"oicdb.json", "oicdb.schema.json", ".oauth2-flows.json"}
+
+// ErrConfigBundlePassphrase is returned, if a bundle can't be decrypted (wrong passphrase or modified bundle).
+var ErrConfigBundlePassphrase = errors.New("wrong passphrase or damaged configuration bundle")
+
+// ConfigBundle contains all files of the configuration directory (the configuration file incl. vaults and API keys, OAuth2 secrets, ...)
+// to move a setup to another machine. Documents are never part of a bundle.
+type ConfigBundle struct {
+	FormatVersion int       `json:"formatVersion"`
+	CliVersion    string    `json:"cliVersion"`
+	CreatedAt     time.Time `json:"createdAt"`
+	// HomeDirectory is the home directory of the exporting user, paths below it are moved to the home directory of the importing user
+	HomeDirectory string `json:"homeDirectory"`
+	// Files maps the slash separated paths (relative to the configuration directory) to the file contents
+	Files map[string][]byte `json:"files"`
+}
+
+// NewConfigBundle bundles all regular files of configDirectory, except ConfigBundleExcludedFiles.
+func NewConfigBundle(configDirectory, homeDirectory, cliVersion string, now time.Time) (ConfigBundle, error) {
+	bundle := ConfigBundle{
+		FormatVersion: ConfigBundleFormatVersion,
+		CliVersion:    cliVersion,
+		CreatedAt:     now.UTC().Truncate(time.Second),
+		HomeDirectory: homeDirectory,
+		Files:         map[string][]byte{},
+	}
+
+	err := filepath.WalkDir(configDirectory, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		relativePath, err := filepath.Rel(configDirectory, path)
+		if err != nil {
+			return err
+		}
+		relativePath = filepath.ToSlash(relativePath)
+		for _, excluded := range ConfigBundleExcludedFiles {
+			if relativePath == excluded {
+				return nil
+			}
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		bundle.Files[relativePath] = content
+		return nil
+	})
+	if err != nil {
+		return bundle, fmt.Errorf("error reading configuration directory %s: %w", configDirectory, err)
+	}
+
+	return bundle, nil
+}
+
+// FileNames returns the sorted paths of the bundled files.
+func (b ConfigBundle) FileNames() []string {
+	names := make([]string, 0, len(b.Files))
+	for name := range b.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Restore writes the bundled files into configDirectory and returns their paths.
+// Existing files with a different content are kept as backup (`<file>.bak`).
+func (b ConfigBundle) Restore(configDirectory string) ([]string, error) {
+	restored := []string{}
+	for _, name := range b.FileNames() {
+		file, err := bundleFilePath(configDirectory, name)
+		if err != nil {
+			return restored, err
+		}
+
+		existing, err := os.ReadFile(file)
+		if err == nil && !bytes.Equal(existing, b.Files[name]) {
+			if err := os.WriteFile(file+".bak", existing, 0600); err != nil {
+				return restored, fmt.Errorf("error writing backup of %s: %w", file, err)
+			}
+		}
+		if err := WriteFileAtomic(file, b.Files[name], 0600); err != nil {
+			return restored, fmt.Errorf("error restoring %s: %w", file, err)
+		}
+		restored = append(restored, file)
+	}
+
+	return restored, nil
+}
+
+// bundleFilePath returns the path of a bundled file in configDirectory.
+// Paths leaving the configuration directory (e.g. `../.bashrc`) are rejected.
+func bundleFilePath(configDirectory, name string) (string, error) {
+	if !filepath.IsLocal(filepath.FromSlash(name)) {
+		return "", fmt.Errorf("configuration bundle contains the invalid path `%s`", name)
+	}
+	return filepath.Join(configDirectory, filepath.FromSlash(name)), nil
+}
+
+// RebaseHomeDirectory moves path from the home directory oldHome to newHome.
+// Paths outside of oldHome are returned unchanged.
+func RebaseHomeDirectory(path, oldHome, newHome string) string {
+	if len(oldHome) == 0 || len(newHome) == 0 {
+		return path
+	}
+	relativePath, err := filepath.Rel(oldHome, path)
+	if err != nil || !filepath.IsAbs(path) || relativePath == ".." || strings.HasPrefix(relativePath, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return filepath.Join(newHome, relativePath)
+}
+
+// EncryptConfigBundle encrypts the bundle with a key derived from passphrase (scrypt, AES-256-GCM).
+func EncryptConfigBundle(bundle ConfigBundle, passphrase string) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("the passphrase of the configuration bundle is empty")
+	}
+	content, err := json.Marshal(bundle)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding configuration bundle: %w", err)
+	}
+
+	salt := make([]byte, configBundleSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("error generating salt: %w", err)
+	}
+	aead, err := configBundleCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("error generating nonce: %w", err)
+	}
+
+	// Layout: magic | salt | nonce | ciphertext (the magic and the salt are authenticated as well)
+	header := append(append([]byte{}, configBundleMagic...), salt...)
+	encrypted := append(append(header, nonce...), aead.Seal(nil, nonce, content, header)...)
+	return encrypted, nil
+}
+
+// DecryptConfigBundle decrypts a bundle of EncryptConfigBundle.
+// A wrong passphrase (or a modified bundle) returns ErrConfigBundlePassphrase.
+func DecryptConfigBundle(encrypted []byte, passphrase string) (ConfigBundle, error) {
+	var bundle ConfigBundle
+
+	if !bytes.HasPrefix(encrypted, configBundleMagic) {
+		return bundle, errors.New("no buchhalter configuration bundle")
+	}
+	headerSize := len(configBundleMagic) + configBundleSaltSize
+	if len(encrypted) < headerSize {
+		return bundle, errors.New("configuration bundle is truncated")
+	}
+	header, salt := encrypted[:headerSize], encrypted[len(configBundleMagic):headerSize]
+	aead, err := configBundleCipher(passphrase, salt)
+	if err != nil {
+		return bundle, err
+	}
+	if len(encrypted) < headerSize+aead.NonceSize() {
+		return bundle, errors.New("configuration bundle is truncated")
+	}
+	nonce, ciphertext := encrypted[headerSize:headerSize+aead.NonceSize()], encrypted[headerSize+aead.NonceSize():]
+
+	content, err := aead.Open(nil, nonce, ciphertext, header)
+	if err != nil {
+		return bundle, ErrConfigBundlePassphrase
+	}
+	if err := json.Unmarshal(content, &bundle); err != nil {
+		return bundle, fmt.Errorf("error decoding configuration bundle: %w", err)
+	}
+	if bundle.FormatVersion > ConfigBundleFormatVersion {
+		return bundle, fmt.Errorf("configuration bundle has the format version %d, this version of buchhalter-cli supports up to %d", bundle.FormatVersion, ConfigBundleFormatVersion)
+	}
+
+	return bundle, nil
+}
+
+func configBundleCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, configBundleScryptN, configBundleScryptR, configBundleScryptP, configBundleKeySize)
+	if err != nil {
+		return nil, fmt.Errorf("error deriving key of the configuration bundle: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing cipher of the configuration bundle: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
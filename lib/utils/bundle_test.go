@@ -0,0 +1,160 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func writeBundleTestFiles(t *testing.T, directory string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		file := filepath.Join(directory, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatalf("Error creating directory of %s: %s", name, err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+			t.Fatalf("Error writing %s: %s", name, err)
+		}
+	}
+}
+
+func TestConfigBundleRoundTrip(t *testing.T) {
+	configDirectory := t.TempDir()
+	config := `credential_provider: 1password
+credential_provider_vaults:
+    - id: abc123
+      name: Buchhalter
+      buchhalterAPIKey: secret-api-key
+      selected: true
+buchhalter_directory: /home/jane/buchhalter
+buchhalter_suppliers_exclude:
+    - aws
+`
+	writeBundleTestFiles(t, configDirectory, map[string]string{
+		".buchhalter.yaml":   config,
+		".secrets.json":      `{"secrets": [{"id": "hetzner", "accessTokens": {"accessToken": "token"}}]}`,
+		"certs/client.pem":   "-----BEGIN CERTIFICATE-----",
+		"oicdb.json":         `{"recipes": []}`,
+		"oicdb.schema.json":  `{}`,
+		"certs/oicdb.json":   "not excluded outside of the root",
+		"empty-file.txt":     "",
+		"nested/deeper/file": "nested",
+	})
+
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	bundle, err := NewConfigBundle(configDirectory, "/home/jane", "1.2.3", now)
+	if err != nil {
+		t.Fatalf("NewConfigBundle() returned error: %s", err)
+	}
+	expectedFiles := []string{".buchhalter.yaml", ".secrets.json", "certs/client.pem", "certs/oicdb.json", "empty-file.txt", "nested/deeper/file"}
+	if names := bundle.FileNames(); !reflect.DeepEqual(names, expectedFiles) {
+		t.Errorf("FileNames() = %v; want %v", names, expectedFiles)
+	}
+
+	encrypted, err := EncryptConfigBundle(bundle, "correct horse battery staple")
+	if err != nil {
+		t.Fatalf("EncryptConfigBundle() returned error: %s", err)
+	}
+	if bytes.Contains(encrypted, []byte("secret-api-key")) {
+		t.Errorf("EncryptConfigBundle() contains the API key in plain text")
+	}
+
+	decrypted, err := DecryptConfigBundle(encrypted, "correct horse battery staple")
+	if err != nil {
+		t.Fatalf("DecryptConfigBundle() returned error: %s", err)
+	}
+	if !reflect.DeepEqual(decrypted, bundle) {
+		t.Errorf("DecryptConfigBundle() = %+v; want %+v", decrypted, bundle)
+	}
+
+	// The restored files match the exported files, changed files are kept as backup
+	newConfigDirectory := t.TempDir()
+	writeBundleTestFiles(t, newConfigDirectory, map[string]string{".buchhalter.yaml": "credential_provider: pass\n"})
+	restored, err := decrypted.Restore(newConfigDirectory)
+	if err != nil {
+		t.Fatalf("Restore() returned error: %s", err)
+	}
+	if len(restored) != len(expectedFiles) {
+		t.Errorf("Restore() restored %v; want %d files", restored, len(expectedFiles))
+	}
+	restoredBundle, err := NewConfigBundle(newConfigDirectory, "/home/jane", "1.2.3", now)
+	if err != nil {
+		t.Fatalf("NewConfigBundle() of the restored directory returned error: %s", err)
+	}
+	backup := restoredBundle.Files[".buchhalter.yaml.bak"]
+	delete(restoredBundle.Files, ".buchhalter.yaml.bak")
+	if !reflect.DeepEqual(restoredBundle.Files, bundle.Files) {
+		t.Errorf("Restored files = %v; want %v", restoredBundle.FileNames(), bundle.FileNames())
+	}
+	if string(backup) != "credential_provider: pass\n" {
+		t.Errorf("Backup of the replaced config file = %q; want the previous config", backup)
+	}
+	info, err := os.Stat(filepath.Join(newConfigDirectory, ".secrets.json"))
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Restored secrets have mode %v (%v); want 0600", info, err)
+	}
+}
+
+func TestDecryptConfigBundleErrors(t *testing.T) {
+	bundle := ConfigBundle{FormatVersion: ConfigBundleFormatVersion, Files: map[string][]byte{".buchhalter.yaml": []byte("dev: false\n")}}
+	encrypted, err := EncryptConfigBundle(bundle, "passphrase")
+	if err != nil {
+		t.Fatalf("EncryptConfigBundle() returned error: %s", err)
+	}
+
+	if _, err := DecryptConfigBundle(encrypted, "wrong"); !errors.Is(err, ErrConfigBundlePassphrase) {
+		t.Errorf("DecryptConfigBundle(wrong passphrase) returned %v; want ErrConfigBundlePassphrase", err)
+	}
+	modified := append([]byte{}, encrypted...)
+	modified[len(modified)-1] ^= 0xff
+	if _, err := DecryptConfigBundle(modified, "passphrase"); !errors.Is(err, ErrConfigBundlePassphrase) {
+		t.Errorf("DecryptConfigBundle(modified bundle) returned %v; want ErrConfigBundlePassphrase", err)
+	}
+	if _, err := DecryptConfigBundle(encrypted[:len(configBundleMagic)+4], "passphrase"); err == nil {
+		t.Errorf("DecryptConfigBundle(truncated bundle) returned no error")
+	}
+	if _, err := DecryptConfigBundle([]byte("credential_provider: pass"), "passphrase"); err == nil {
+		t.Errorf("DecryptConfigBundle(no bundle) returned no error")
+	}
+	if _, err := EncryptConfigBundle(bundle, ""); err == nil {
+		t.Errorf("EncryptConfigBundle() with an empty passphrase returned no error")
+	}
+}
+
+func TestConfigBundleRestoreRejectsPathsOutside(t *testing.T) {
+	parent := t.TempDir()
+	configDirectory := filepath.Join(parent, "config")
+	bundle := ConfigBundle{Files: map[string][]byte{"../outside": []byte("x")}}
+
+	if _, err := bundle.Restore(configDirectory); err == nil {
+		t.Errorf("Restore() of a path outside the configuration directory returned no error")
+	}
+	if _, err := os.Stat(filepath.Join(parent, "outside")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Restore() wrote a file outside the configuration directory")
+	}
+}
+
+func TestRebaseHomeDirectory(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/Users/bernd/buchhalter", "/home/jane/buchhalter"},
+		{"/Users/bernd/.buchhalter/.buchhalter.yaml", "/home/jane/.buchhalter/.buchhalter.yaml"},
+		{"/Users/bernd", "/home/jane"},
+		{"/Users/bernda/buchhalter", "/Users/bernda/buchhalter"},
+		{"/mnt/invoices", "/mnt/invoices"},
+		{"relative/path", "relative/path"},
+	}
+	for _, test := range tests {
+		if rebased := RebaseHomeDirectory(test.path, "/Users/bernd", "/home/jane"); rebased != test.expected {
+			t.Errorf("RebaseHomeDirectory(%s) = %s; want %s", test.path, rebased, test.expected)
+		}
+	}
+}
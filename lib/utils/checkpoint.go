@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// SyncCheckpoint records the suppliers a sync run completed successfully, to resume an interrupted run (e.g. by CTRL+C).
+// Suppliers are keyed with the version of their recipe: after a recipe update, the supplier runs again.
+// The checkpoint is bound to a documents directory, a checkpoint of another directory is not resumed.
+type SyncCheckpoint struct {
+	mu   sync.Mutex
+	file string
+
+	DocumentsDirectory string `json:"documentsDirectory"`
+	// Completed maps the completed suppliers to the version of their recipe
+	Completed map[string]string `json:"completed"`
+}
+
+// NewSyncCheckpoint returns an empty checkpoint, stored in file with the first completed supplier.
+func NewSyncCheckpoint(file, documentsDirectory string) *SyncCheckpoint {
+	return &SyncCheckpoint{
+		file:               file,
+		DocumentsDirectory: documentsDirectory,
+		Completed:          map[string]string{},
+	}
+}
+
+// LoadSyncCheckpoint reads the checkpoint of an interrupted run from file.
+// Without a checkpoint file or with a checkpoint of another documents directory, an empty checkpoint is returned.
+func LoadSyncCheckpoint(file, documentsDirectory string) (*SyncCheckpoint, error) {
+	checkpoint := NewSyncCheckpoint(file, documentsDirectory)
+
+	content, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return checkpoint, nil
+	}
+	if err != nil {
+		return checkpoint, fmt.Errorf("error reading sync checkpoint %s: %w", file, err)
+	}
+
+	stored := SyncCheckpoint{}
+	if err := json.Unmarshal(content, &stored); err != nil {
+		return checkpoint, fmt.Errorf("error parsing sync checkpoint %s: %w", file, err)
+	}
+	if stored.DocumentsDirectory != documentsDirectory {
+		return checkpoint, nil
+	}
+	for supplier, version := range stored.Completed {
+		checkpoint.Completed[supplier] = version
+	}
+
+	return checkpoint, nil
+}
+
+// IsCompleted returns true if the supplier was completed with the same version of its recipe.
+func (c *SyncCheckpoint) IsCompleted(supplier, recipeVersion string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	version, ok := c.Completed[supplier]
+	return ok && version == recipeVersion
+}
+
+// MarkCompleted records a successfully completed supplier and writes the checkpoint file.
+func (c *SyncCheckpoint) MarkCompleted(supplier, recipeVersion string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.Completed[supplier] = recipeVersion
+	content, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding sync checkpoint: %w", err)
+	}
+	if err := WriteFileAtomic(c.file, content, 0600); err != nil {
+		return fmt.Errorf("error writing sync checkpoint %s: %w", c.file, err)
+	}
+
+	return nil
+}
+
+// Clear removes the checkpoint file, e.g. after a fully successful run.
+func (c *SyncCheckpoint) Clear() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.Completed = map[string]string{}
+	if err := os.Remove(c.file); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error removing sync checkpoint %s: %w", c.file, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSyncCheckpoint(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "checkpoints", "sync-default.json")
+
+	checkpoint := NewSyncCheckpoint(file, "/documents")
+	if err := checkpoint.MarkCompleted("hetzner", "1.0.0"); err != nil {
+		t.Fatalf("MarkCompleted() returned error: %s", err)
+	}
+	if err := checkpoint.MarkCompleted("aws", "2.1.0"); err != nil {
+		t.Fatalf("MarkCompleted() returned error: %s", err)
+	}
+
+	// The next run resumes the checkpoint
+	resumed, err := LoadSyncCheckpoint(file, "/documents")
+	if err != nil {
+		t.Fatalf("LoadSyncCheckpoint() returned error: %s", err)
+	}
+
+	tests := []struct {
+		supplier string
+		version  string
+		expected bool
+	}{
+		{"hetzner", "1.0.0", true},
+		{"aws", "2.1.0", true},
+		// The recipe was updated since the checkpoint
+		{"aws", "2.2.0", false},
+		{"github", "1.0.0", false},
+	}
+	for _, test := range tests {
+		if completed := resumed.IsCompleted(test.supplier, test.version); completed != test.expected {
+			t.Errorf("IsCompleted(%s, %s) = %t; want %t", test.supplier, test.version, completed, test.expected)
+		}
+	}
+
+	// A checkpoint of another documents directory is not resumed
+	other, err := LoadSyncCheckpoint(file, "/other-documents")
+	if err != nil {
+		t.Fatalf("LoadSyncCheckpoint() returned error: %s", err)
+	}
+	if other.IsCompleted("hetzner", "1.0.0") {
+		t.Errorf("IsCompleted() of another documents directory = true; want false")
+	}
+
+	if err := resumed.Clear(); err != nil {
+		t.Fatalf("Clear() returned error: %s", err)
+	}
+	if _, err := os.Stat(file); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Clear() kept the checkpoint file: %v", err)
+	}
+	if resumed.IsCompleted("hetzner", "1.0.0") {
+		t.Errorf("IsCompleted() after Clear() = true; want false")
+	}
+	// Clearing twice is no error
+	if err := resumed.Clear(); err != nil {
+		t.Errorf("Clear() without checkpoint file returned error: %s", err)
+	}
+}
+
+func TestLoadSyncCheckpointWithoutFile(t *testing.T) {
+	checkpoint, err := LoadSyncCheckpoint(filepath.Join(t.TempDir(), "missing.json"), "/documents")
+	if err != nil {
+		t.Fatalf("LoadSyncCheckpoint() returned error: %s", err)
+	}
+	if len(checkpoint.Completed) != 0 {
+		t.Errorf("LoadSyncCheckpoint() = %v; want an empty checkpoint", checkpoint.Completed)
+	}
+
+	invalidFile := filepath.Join(t.TempDir(), "invalid.json")
+	if err := os.WriteFile(invalidFile, []byte("{"), 0600); err != nil {
+		t.Fatalf("Error writing invalid checkpoint: %s", err)
+	}
+	checkpoint, err = LoadSyncCheckpoint(invalidFile, "/documents")
+	if err == nil {
+		t.Errorf("LoadSyncCheckpoint(invalid file) returned no error; want an error")
+	}
+	if checkpoint == nil || len(checkpoint.Completed) != 0 {
+		t.Errorf("LoadSyncCheckpoint(invalid file) = %v; want an empty checkpoint", checkpoint)
+	}
+}
@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseConfigValue converts value (e.g. of `buchhalter config set`) into the type of the default value of a setting.
+// Booleans, integers, strings and lists of strings (comma separated) are supported.
+// Settings with structured values (e.g. `credential_provider_vaults`) can't be set from a string.
+func ParseConfigValue(key string, defaultValue interface{}, value string) (interface{}, error) {
+	switch defaultValue.(type) {
+	case bool:
+		parsed, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("`%s` expects a boolean (true or false), got `%s`", key, value)
+		}
+		return parsed, nil
+	case int:
+		parsed, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("`%s` expects an integer, got `%s`", key, value)
+		}
+		return parsed, nil
+	case string:
+		return value, nil
+	case []string:
+		list := []string{}
+		for _, entry := range strings.Split(value, ",") {
+			if entry = strings.TrimSpace(entry); len(entry) > 0 {
+				list = append(list, entry)
+			}
+		}
+		return list, nil
+	default:
+		return nil, fmt.Errorf("`%s` has a structured value and can't be set via the command line, please edit the configuration file", key)
+	}
+}
+
+// FormatConfigValue returns the value of a setting as printed by `buchhalter config get`.
+// Lists and structured values are encoded as JSON.
+func FormatConfigValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool, int, int64, float64:
+		return fmt.Sprint(v)
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(encoded)
+	}
+}
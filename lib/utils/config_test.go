@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseConfigValue(t *testing.T) {
+	type structured struct {
+		Host string
+	}
+
+	tests := []struct {
+		name         string
+		defaultValue interface{}
+		value        string
+		expected     interface{}
+		expectError  bool
+	}{
+		{"bool", false, "true", true, false},
+		{"bool with spaces", true, " false ", false, false},
+		{"invalid bool", false, "yes please", nil, true},
+		{"int", 2, "5", 5, false},
+		{"negative int", 2, "-1", -1, false},
+		{"invalid int", 2, "five", nil, true},
+		{"float as int", 2, "2.5", nil, true},
+		{"string", "supplier", "year/supplier", "year/supplier", false},
+		{"list", []string{}, "aws, hetzner,,", []string{"aws", "hetzner"}, false},
+		{"empty list", []string{}, "", []string{}, false},
+		{"structured", []structured{}, "intranet.example.com", nil, true},
+	}
+
+	for _, test := range tests {
+		value, err := ParseConfigValue("setting", test.defaultValue, test.value)
+		if test.expectError {
+			if err == nil {
+				t.Errorf("%s: ParseConfigValue() = %v; want an error", test.name, value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: ParseConfigValue() returned error: %s", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(value, test.expected) {
+			t.Errorf("%s: ParseConfigValue() = %#v; want %#v", test.name, value, test.expected)
+		}
+	}
+}
+
+func TestFormatConfigValue(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{"supplier", "supplier"},
+		{true, "true"},
+		{2, "2"},
+		{[]string{"aws", "hetzner"}, `["aws","hetzner"]`},
+		{[]interface{}{map[string]interface{}{"host": "intranet.example.com"}}, `[{"host":"intranet.example.com"}]`},
+		{nil, ""},
+	}
+
+	for _, test := range tests {
+		if formatted := FormatConfigValue(test.value); formatted != test.expected {
+			t.Errorf("FormatConfigValue(%#v) = %s; want %s", test.value, formatted, test.expected)
+		}
+	}
+}
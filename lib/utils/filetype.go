@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Mime types of downloaded documents, checked by their magic bytes (see ValidateFileType)
+const (
+	MimeTypePDF  = "application/pdf"
+	MimeTypeZIP  = "application/zip"
+	MimeTypeXML  = "application/xml"
+	MimeTypePNG  = "image/png"
+	MimeTypeJPEG = "image/jpeg"
+	// MimeTypeAny disables the check
+	MimeTypeAny = "*/*"
+)
+
+// fileTypeHeaderSize is the number of bytes read to check the type of a file.
+// The PDF header may be preceded by garbage within the first 1024 bytes.
+const fileTypeHeaderSize = 1024
+
+// fileSignatures check the magic bytes of the supported mime types.
+var fileSignatures = map[string]func(header []byte) bool{
+	MimeTypePDF: func(header []byte) bool {
+		return bytes.Contains(header, []byte("%PDF-"))
+	},
+	MimeTypeZIP: func(header []byte) bool {
+		return bytes.HasPrefix(header, []byte("PK\x03\x04")) || bytes.HasPrefix(header, []byte("PK\x05\x06"))
+	},
+	MimeTypeXML: func(header []byte) bool {
+		// E-invoices (e.g. XRechnung) don't always have an XML declaration, but HTML is no XML document
+		trimmed := bytes.TrimLeft(bytes.TrimPrefix(header, []byte("\xef\xbb\xbf")), " \t\r\n")
+		return bytes.HasPrefix(trimmed, []byte("<")) && !strings.HasPrefix(http.DetectContentType(trimmed), "text/html")
+	},
+	MimeTypePNG: func(header []byte) bool {
+		return bytes.HasPrefix(header, []byte("\x89PNG\r\n\x1a\n"))
+	},
+	MimeTypeJPEG: func(header []byte) bool {
+		return bytes.HasPrefix(header, []byte("\xff\xd8\xff"))
+	},
+}
+
+// mimeTypesByExtension are the mime types checked without an expected mime type.
+var mimeTypesByExtension = map[string]string{
+	".pdf":  MimeTypePDF,
+	".zip":  MimeTypeZIP,
+	".xml":  MimeTypeXML,
+	".png":  MimeTypePNG,
+	".jpg":  MimeTypeJPEG,
+	".jpeg": MimeTypeJPEG,
+}
+
+// SupportedMimeTypes returns the mime types ValidateFileType can check.
+func SupportedMimeTypes() []string {
+	mimeTypes := []string{MimeTypeAny}
+	for mimeType := range fileSignatures {
+		mimeTypes = append(mimeTypes, mimeType)
+	}
+	sort.Strings(mimeTypes)
+	return mimeTypes
+}
+
+// IsSupportedMimeType returns true if mimeType can be expected by ValidateFileType (an empty mime type is the default).
+func IsSupportedMimeType(mimeType string) bool {
+	if len(mimeType) == 0 || mimeType == MimeTypeAny {
+		return true
+	}
+	_, ok := fileSignatures[strings.ToLower(mimeType)]
+	return ok
+}
+
+// ValidateFileType checks the magic bytes of a downloaded file, e.g. to detect an HTML error page saved as `invoice.pdf`.
+// With an expected mime type, the file must be of this type.
+// Without it, only files with a known extension (e.g. `.pdf`) are checked, all other files are accepted.
+func ValidateFileType(file, expectedMimeType string) error {
+	expectedMimeType = strings.ToLower(strings.TrimSpace(expectedMimeType))
+	if expectedMimeType == MimeTypeAny {
+		return nil
+	}
+	if len(expectedMimeType) == 0 {
+		expectedMimeType = mimeTypesByExtension[strings.ToLower(filepath.Ext(file))]
+		if len(expectedMimeType) == 0 {
+			return nil
+		}
+	}
+	matches, ok := fileSignatures[expectedMimeType]
+	if !ok {
+		return fmt.Errorf("unsupported mime type `%s` (supported: %s)", expectedMimeType, strings.Join(SupportedMimeTypes(), ", "))
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	header := make([]byte, fileTypeHeaderSize)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+	header = header[:n]
+
+	if !matches(header) {
+		if n == 0 {
+			return fmt.Errorf("file %s is empty, expected %s", filepath.Base(file), expectedMimeType)
+		}
+		return fmt.Errorf("file %s is %s, expected %s", filepath.Base(file), http.DetectContentType(header), expectedMimeType)
+	}
+	return nil
+}
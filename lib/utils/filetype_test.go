@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateFileType(t *testing.T) {
+	tests := []struct {
+		name             string
+		filename         string
+		content          string
+		expectedMimeType string
+		valid            bool
+	}{
+		{"pdf", "invoice.pdf", "%PDF-1.7\n", "", true},
+		{"pdf after garbage", "invoice.pdf", "\r\n\x00%PDF-1.4\n", "", true},
+		{"html error page as pdf", "invoice.pdf", "<!DOCTYPE html><html><body>Session expired</body></html>", "", false},
+		{"empty pdf", "invoice.PDF", "", "", false},
+		{"zip", "invoices.zip", "PK\x03\x04\x14\x00", "", true},
+		{"json error as zip", "invoices.zip", `{"error": "not found"}`, "", false},
+		{"xml e-invoice without declaration", "invoice.xml", "\xef\xbb\xbf<rsm:CrossIndustryInvoice>", "", true},
+		{"html as xml", "invoice.xml", "<html><body>Error</body></html>", "", false},
+		{"png", "invoice.png", "\x89PNG\r\n\x1a\n", "", true},
+		{"jpeg", "invoice.jpg", "\xff\xd8\xff\xe0", "", true},
+		{"unknown extension", "invoice.csv", "<html>", "", true},
+		{"expected pdf without extension", "invoice", "%PDF-1.7", MimeTypePDF, true},
+		{"expected pdf but zip", "invoice.zip", "PK\x03\x04", "application/PDF", false},
+		{"check disabled", "invoice.pdf", "<html>", MimeTypeAny, true},
+	}
+
+	for _, test := range tests {
+		file := filepath.Join(t.TempDir(), test.filename)
+		if err := os.WriteFile(file, []byte(test.content), 0600); err != nil {
+			t.Fatalf("%s: error writing file: %s", test.name, err)
+		}
+		if err := ValidateFileType(file, test.expectedMimeType); (err == nil) != test.valid {
+			t.Errorf("%s: ValidateFileType() returned %v; want valid %t", test.name, err, test.valid)
+		}
+	}
+
+	if err := ValidateFileType(filepath.Join(t.TempDir(), "invoice.pdf"), ""); err == nil {
+		t.Errorf("ValidateFileType() of a missing file returned no error")
+	}
+	if err := ValidateFileType(filepath.Join(t.TempDir(), "invoice.pdf"), "text/plain"); err == nil {
+		t.Errorf("ValidateFileType() with an unsupported mime type returned no error")
+	}
+}
+
+func TestIsSupportedMimeType(t *testing.T) {
+	for _, mimeType := range []string{"", MimeTypeAny, MimeTypePDF, "Application/Zip", MimeTypeXML} {
+		if !IsSupportedMimeType(mimeType) {
+			t.Errorf("IsSupportedMimeType(%s) = false; want true", mimeType)
+		}
+	}
+	if IsSupportedMimeType("text/html") {
+		t.Errorf("IsSupportedMimeType(text/html) = true; want false")
+	}
+}
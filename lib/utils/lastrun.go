@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// LastRuns records the start of the last successful sync per supplier, for incremental runs (`--since-last-run`).
+// The times of the previous runs are kept separately: suppliers recorded during a run don't change the cutoffs of the same run.
+type LastRuns struct {
+	mu       sync.Mutex
+	file     string
+	previous map[string]time.Time
+
+	// Suppliers maps the suppliers to the start of their last successful sync
+	Suppliers map[string]time.Time `json:"suppliers"`
+}
+
+// LoadLastRuns reads the last runs from file.
+// Without a file, empty last runs are returned, they are stored in file with the first recorded supplier.
+func LoadLastRuns(file string) (*LastRuns, error) {
+	lastRuns := &LastRuns{
+		file:      file,
+		previous:  map[string]time.Time{},
+		Suppliers: map[string]time.Time{},
+	}
+
+	content, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return lastRuns, nil
+	}
+	if err != nil {
+		return lastRuns, fmt.Errorf("error reading last runs %s: %w", file, err)
+	}
+
+	stored := LastRuns{}
+	if err := json.Unmarshal(content, &stored); err != nil {
+		return lastRuns, fmt.Errorf("error parsing last runs %s: %w", file, err)
+	}
+	for supplier, lastRun := range stored.Suppliers {
+		lastRuns.previous[supplier] = lastRun
+		lastRuns.Suppliers[supplier] = lastRun
+	}
+
+	return lastRuns, nil
+}
+
+// Since returns the start of the last successful sync of supplier before the current run.
+// It returns false, if the supplier never synced successfully.
+func (l *LastRuns) Since(supplier string) (time.Time, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	lastRun, ok := l.previous[supplier]
+	return lastRun, ok
+}
+
+// ArchivedBefore returns true if the document at path was archived (modified) before the last run of supplier.
+// Documents of suppliers without a last run and documents that can't be read are not archived before.
+func (l *LastRuns) ArchivedBefore(supplier, path string) bool {
+	lastRun, ok := l.Since(supplier)
+	if !ok {
+		return false
+	}
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return fileInfo.ModTime().Before(lastRun)
+}
+
+// Record stores start as the last successful sync of supplier and writes the file.
+func (l *LastRuns) Record(supplier string, start time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.Suppliers[supplier] = start.UTC()
+	content, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding last runs: %w", err)
+	}
+	if err := WriteFileAtomic(l.file, content, 0600); err != nil {
+		return fmt.Errorf("error writing last runs %s: %w", l.file, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLastRuns(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "last-runs-default.json")
+	start := time.Date(2024, time.May, 10, 12, 0, 0, 0, time.UTC)
+
+	lastRuns, err := LoadLastRuns(file)
+	if err != nil {
+		t.Fatalf("LoadLastRuns() without a file returned error: %s", err)
+	}
+	if err := lastRuns.Record("hetzner", start); err != nil {
+		t.Fatalf("Record() returned error: %s", err)
+	}
+	// A supplier recorded in the current run keeps the cutoff of the previous run
+	if _, ok := lastRuns.Since("hetzner"); ok {
+		t.Errorf("Since() of a supplier recorded in the current run = true; want false")
+	}
+
+	// The next run reads the recorded supplier
+	next, err := LoadLastRuns(file)
+	if err != nil {
+		t.Fatalf("LoadLastRuns() returned error: %s", err)
+	}
+	if since, ok := next.Since("hetzner"); !ok || !since.Equal(start) {
+		t.Errorf("Since(hetzner) = %s, %t; want %s, true", since, ok, start)
+	}
+	if _, ok := next.Since("aws"); ok {
+		t.Errorf("Since(aws) = true; want false")
+	}
+}
+
+func TestLastRunsArchivedBefore(t *testing.T) {
+	directory := t.TempDir()
+	lastRun := time.Now().Add(-time.Hour)
+	oldDocument := filepath.Join(directory, "old.pdf")
+	newDocument := filepath.Join(directory, "new.pdf")
+	for _, document := range []string{oldDocument, newDocument} {
+		if err := os.WriteFile(document, []byte("%PDF-1.7"), 0o600); err != nil {
+			t.Fatalf("error writing document: %s", err)
+		}
+	}
+	if err := os.Chtimes(oldDocument, lastRun.Add(-time.Hour), lastRun.Add(-time.Hour)); err != nil {
+		t.Fatalf("error changing modification time: %s", err)
+	}
+
+	lastRuns := &LastRuns{previous: map[string]time.Time{"hetzner": lastRun}}
+	tests := []struct {
+		supplier string
+		path     string
+		expected bool
+	}{
+		{"hetzner", oldDocument, true},
+		{"hetzner", newDocument, false},
+		{"hetzner", filepath.Join(directory, "missing.pdf"), false},
+		// Without a last run, all documents are new
+		{"aws", oldDocument, false},
+	}
+	for _, test := range tests {
+		if archivedBefore := lastRuns.ArchivedBefore(test.supplier, test.path); archivedBefore != test.expected {
+			t.Errorf("ArchivedBefore(%s, %s) = %t; want %t", test.supplier, filepath.Base(test.path), archivedBefore, test.expected)
+		}
+	}
+}
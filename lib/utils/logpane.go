@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LogRecord is a log record of the log pane of the interactive UI (`l`).
+// Message contains the attributes of the record, secrets are redacted (see Redact).
+type LogRecord struct {
+	Time    time.Time
+	Level   slog.Level
+	Message string
+}
+
+// String returns the record as line of the log pane.
+func (r LogRecord) String() string {
+	return fmt.Sprintf("%s %-5s %s", r.Time.Format("15:04:05"), r.Level.String(), r.Message)
+}
+
+// LogForwarder is a slog.Handler that forwards log records to a channel, in addition to the wrapped handler.
+// Records are dropped if the channel is full, logging never blocks the sync.
+type LogForwarder struct {
+	handler slog.Handler
+	records chan<- LogRecord
+	// attrs are the formatted attributes of WithAttrs, group the prefix of WithGroup
+	attrs string
+	group string
+}
+
+// NewLogForwarder returns a handler that forwards the records enabled by handler to records.
+func NewLogForwarder(handler slog.Handler, records chan<- LogRecord) *LogForwarder {
+	return &LogForwarder{handler: handler, records: records}
+}
+
+func (f *LogForwarder) Enabled(ctx context.Context, level slog.Level) bool {
+	return f.handler.Enabled(ctx, level)
+}
+
+func (f *LogForwarder) Handle(ctx context.Context, record slog.Record) error {
+	message := strings.Builder{}
+	message.WriteString(record.Message)
+	message.WriteString(f.attrs)
+	record.Attrs(func(attr slog.Attr) bool {
+		writeLogAttr(&message, f.group, attr)
+		return true
+	})
+
+	select {
+	case f.records <- LogRecord{Time: record.Time, Level: record.Level, Message: Redact(message.String())}:
+	default:
+	}
+
+	return f.handler.Handle(ctx, record)
+}
+
+func (f *LogForwarder) WithAttrs(attrs []slog.Attr) slog.Handler {
+	formatted := strings.Builder{}
+	formatted.WriteString(f.attrs)
+	for _, attr := range attrs {
+		writeLogAttr(&formatted, f.group, attr)
+	}
+	return &LogForwarder{handler: f.handler.WithAttrs(attrs), records: f.records, attrs: formatted.String(), group: f.group}
+}
+
+func (f *LogForwarder) WithGroup(name string) slog.Handler {
+	if len(name) == 0 {
+		return f
+	}
+	return &LogForwarder{handler: f.handler.WithGroup(name), records: f.records, attrs: f.attrs, group: f.group + name + "."}
+}
+
+// writeLogAttr writes attr as ` key=value`, like the text handler of slog.
+func writeLogAttr(s *strings.Builder, group string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+	if attr.Value.Kind() == slog.KindGroup {
+		prefix := group
+		if len(attr.Key) > 0 {
+			prefix += attr.Key + "."
+		}
+		for _, groupAttr := range attr.Value.Group() {
+			writeLogAttr(s, prefix, groupAttr)
+		}
+		return
+	}
+
+	value := attr.Value.String()
+	if len(value) == 0 || strings.ContainsAny(value, " \t\n\"=") {
+		value = strconv.Quote(value)
+	}
+	s.WriteString(" " + group + attr.Key + "=" + value)
+}
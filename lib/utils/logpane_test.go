@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogForwarder(t *testing.T) {
+	RegisterSecret("log-pane-secret")
+
+	output := &bytes.Buffer{}
+	records := make(chan LogRecord, 10)
+	logger := slog.New(NewLogForwarder(slog.NewTextHandler(output, nil), records))
+
+	tests := []struct {
+		name     string
+		log      func()
+		expected string
+	}{
+		{"message", func() { logger.Info("Booting up") }, "Booting up"},
+		{"attributes", func() { logger.Info("Download", "supplier", "example", "files", 2) }, "Download supplier=example files=2"},
+		{"quoted value", func() { logger.Warn("Step failed", "error", "element not found") }, `Step failed error="element not found"`},
+		{"logger attributes", func() { logger.With("supplier", "example").Info("Login") }, "Login supplier=example"},
+		{"group", func() { logger.WithGroup("recipe").Info("Loaded", "version", "1.0") }, "Loaded recipe.version=1.0"},
+		{"group attribute", func() { logger.Info("Loaded", slog.Group("recipe", "steps", 3)) }, "Loaded recipe.steps=3"},
+		{"secret", func() { logger.Info("Login", "password", "log-pane-secret") }, "Login password=[REDACTED]"},
+		{"disabled level", func() { logger.Debug("Not forwarded") }, ""},
+	}
+
+	for _, test := range tests {
+		test.log()
+		select {
+		case record := <-records:
+			if len(test.expected) == 0 {
+				t.Errorf("%s: record %q forwarded; want none", test.name, record.Message)
+			} else if record.Message != test.expected {
+				t.Errorf("%s: record.Message = %q; want %q", test.name, record.Message, test.expected)
+			}
+		default:
+			if len(test.expected) > 0 {
+				t.Errorf("%s: no record forwarded; want %q", test.name, test.expected)
+			}
+		}
+	}
+
+	// The wrapped handler gets all records, incl. the secret (the log file isn't redacted)
+	if lines := strings.Count(output.String(), "\n"); lines != len(tests)-1 {
+		t.Errorf("wrapped handler wrote %d lines; want %d", lines, len(tests)-1)
+	}
+}
+
+func TestLogForwarderFullChannel(t *testing.T) {
+	output := &bytes.Buffer{}
+	records := make(chan LogRecord, 1)
+	logger := slog.New(NewLogForwarder(slog.NewTextHandler(output, nil), records))
+
+	done := make(chan struct{})
+	go func() {
+		logger.Info("first")
+		logger.Info("second")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("logging blocks on a full channel")
+	}
+
+	if record := <-records; record.Message != "first" {
+		t.Errorf("record.Message = %q; want %q", record.Message, "first")
+	}
+	if !strings.Contains(output.String(), "second") {
+		t.Errorf("wrapped handler didn't get the dropped record")
+	}
+}
+
+func TestLogRecordString(t *testing.T) {
+	record := LogRecord{Time: time.Date(2024, 5, 1, 14, 3, 9, 0, time.UTC), Level: slog.LevelInfo, Message: "Booting up"}
+	if line := record.String(); line != "14:03:09 INFO  Booting up" {
+		t.Errorf("String() = %q; want %q", line, "14:03:09 INFO  Booting up")
+	}
+}
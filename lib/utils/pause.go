@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"context"
+	"sync"
+)
+
+// Pause pauses the progress of a sync run (`p` in the interactive UI).
+// Running steps are finished and the browser keeps running, but no further step is started until the run is resumed.
+// It is safe for concurrent use, a nil *Pause is never paused.
+type Pause struct {
+	mutex  sync.Mutex
+	paused bool
+	// resumed is closed when the run is resumed
+	resumed chan struct{}
+}
+
+// NewPause returns a pause that isn't paused.
+func NewPause() *Pause {
+	return &Pause{}
+}
+
+// Toggle pauses or resumes the run and returns true if it is paused now.
+func (p *Pause) Toggle() bool {
+	if p == nil {
+		return false
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.paused {
+		p.paused = false
+		close(p.resumed)
+		return false
+	}
+	p.paused = true
+	p.resumed = make(chan struct{})
+	return true
+}
+
+// Paused returns true if the run is paused.
+func (p *Pause) Paused() bool {
+	if p == nil {
+		return false
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.paused
+}
+
+// Wait blocks while the run is paused.
+// It returns the error of ctx if ctx is done before the run is resumed.
+func (p *Pause) Wait(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+	p.mutex.Lock()
+	if !p.paused {
+		p.mutex.Unlock()
+		return nil
+	}
+	resumed := p.resumed
+	p.mutex.Unlock()
+
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
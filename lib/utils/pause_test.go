@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPauseWait(t *testing.T) {
+	pause := NewPause()
+	if err := pause.Wait(context.Background()); err != nil {
+		t.Errorf("Wait() without pause = %v; want nil", err)
+	}
+
+	if paused := pause.Toggle(); !paused {
+		t.Fatalf("Toggle() = false; want true")
+	}
+	if !pause.Paused() {
+		t.Errorf("Paused() = false; want true")
+	}
+
+	waitResult := make(chan error, 1)
+	go func() {
+		waitResult <- pause.Wait(context.Background())
+	}()
+	select {
+	case err := <-waitResult:
+		t.Fatalf("Wait() returned %v while paused; want it to block", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if paused := pause.Toggle(); paused {
+		t.Errorf("Toggle() = true; want false")
+	}
+	select {
+	case err := <-waitResult:
+		if err != nil {
+			t.Errorf("Wait() after resume = %v; want nil", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Wait() still blocks after resume")
+	}
+}
+
+func TestPauseWaitCanceled(t *testing.T) {
+	pause := NewPause()
+	pause.Toggle()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := pause.Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Wait() with canceled context = %v; want %v", err, context.Canceled)
+	}
+}
+
+func TestRecipeProgressWaitWhilePaused(t *testing.T) {
+	tracker := NewProgressTracker(1, func(msg ViewProgressUpdateMsg) {})
+	recipeProgress := tracker.Recipe(1)
+
+	// Without a pause (e.g. in quiet mode), the recipe never waits
+	var nilPause *Pause
+	if nilPause.Toggle() || nilPause.Paused() {
+		t.Errorf("nil pause is paused; want it never to be paused")
+	}
+	if err := recipeProgress.WaitWhilePaused(context.Background()); err != nil {
+		t.Errorf("WaitWhilePaused() without pause = %v; want nil", err)
+	}
+
+	pause := NewPause()
+	tracker.SetPause(pause)
+	pause.Toggle()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := recipeProgress.WaitWhilePaused(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WaitWhilePaused() while paused = %v; want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,13 @@
+package utils
+
+import (
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// PDFConfiguration returns the pdfcpu default configuration.
+// pdfcpu would create a configuration directory in the user's config directory otherwise.
+func PDFConfiguration() *model.Configuration {
+	api.DisableConfigDir()
+	return model.NewDefaultConfiguration()
+}
@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"context"
+	"sync"
+)
+
+// ProgressTracker aggregates the step progress of all recipes of a sync run.
+//
+// Recipes report completed steps via their own RecipeProgress handle.
+// The tracker keeps the shared counters and emits the overall percentage.
+// It is safe for concurrent use, so recipes running in parallel
+// can report progress without knowing about each other.
+type ProgressTracker struct {
+	mutex sync.Mutex
+
+	totalSteps     int
+	completedSteps int
+
+	emit func(ViewProgressUpdateMsg)
+	// pause pauses the recipes before their next step, nil if the run can't be paused
+	pause *Pause
+}
+
+// RecipeProgress tracks the progress of a single recipe inside a ProgressTracker.
+type RecipeProgress struct {
+	tracker *ProgressTracker
+
+	mutex          sync.Mutex
+	stepCount      int
+	completedSteps int
+}
+
+// NewProgressTracker returns a new tracker for `totalSteps` steps.
+// `emit` is called with every progress update (e.g. `p.Send` of the bubbletea program).
+// Updates are emitted in order, the reported percentage never decreases.
+func NewProgressTracker(totalSteps int, emit func(ViewProgressUpdateMsg)) *ProgressTracker {
+	return &ProgressTracker{
+		totalSteps: totalSteps,
+		emit:       emit,
+	}
+}
+
+// SetPause sets the pause of the run, the recipes wait for it before each step (see RecipeProgress.WaitWhilePaused).
+func (t *ProgressTracker) SetPause(pause *Pause) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.pause = pause
+}
+
+// Recipe returns a progress handle for a recipe with `stepCount` steps.
+func (t *ProgressTracker) Recipe(stepCount int) *RecipeProgress {
+	return &RecipeProgress{
+		tracker:   t,
+		stepCount: stepCount,
+	}
+}
+
+// Percent returns the overall progress (0.0 - 1.0) of all recipes.
+func (t *ProgressTracker) Percent() float64 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.percent()
+}
+
+func (t *ProgressTracker) percent() float64 {
+	if t.totalSteps <= 0 {
+		return 0
+	}
+
+	percent := float64(t.completedSteps) / float64(t.totalSteps)
+	if percent > 1 {
+		percent = 1
+	}
+	return percent
+}
+
+func (t *ProgressTracker) completeSteps(n int) {
+	if n <= 0 {
+		return
+	}
+
+	// The lock is held while emitting to keep the order of the updates
+	// identical to the order of the counter changes.
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.completedSteps += n
+	if t.emit != nil {
+		t.emit(ViewProgressUpdateMsg{Percent: t.percent()})
+	}
+}
+
+// StepCompleted marks the next step of the recipe as completed.
+// Calls beyond the step count of the recipe are ignored.
+func (r *RecipeProgress) StepCompleted() {
+	r.mutex.Lock()
+	if r.completedSteps >= r.stepCount {
+		r.mutex.Unlock()
+		return
+	}
+	r.completedSteps++
+	r.mutex.Unlock()
+
+	r.tracker.completeSteps(1)
+}
+
+// Finish marks all remaining steps of the recipe as completed.
+// This is used when a recipe is aborted or skipped, so the overall progress stays consistent.
+func (r *RecipeProgress) Finish() {
+	r.mutex.Lock()
+	remainingSteps := r.stepCount - r.completedSteps
+	r.completedSteps = r.stepCount
+	r.mutex.Unlock()
+
+	r.tracker.completeSteps(remainingSteps)
+}
+
+// WaitWhilePaused blocks before the next step of the recipe while the run is paused.
+// It returns the error of ctx if ctx is done before the run is resumed (e.g. when the browser is stopped).
+func (r *RecipeProgress) WaitWhilePaused(ctx context.Context) error {
+	r.tracker.mutex.Lock()
+	pause := r.tracker.pause
+	r.tracker.mutex.Unlock()
+
+	return pause.Wait(ctx)
+}
@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestProgressTrackerConcurrentSteps(t *testing.T) {
+	const recipeCount = 20
+	const stepsPerRecipe = 15
+
+	var emitted []float64
+	tracker := NewProgressTracker(recipeCount*stepsPerRecipe, func(msg ViewProgressUpdateMsg) {
+		// emit is called while the tracker lock is held, no additional locking needed
+		emitted = append(emitted, msg.Percent)
+	})
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < recipeCount; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			recipeProgress := tracker.Recipe(stepsPerRecipe)
+			defer recipeProgress.Finish()
+
+			// Every second recipe is aborted after a few steps
+			steps := stepsPerRecipe
+			if n%2 == 0 {
+				steps = 3
+			}
+			for s := 0; s < steps; s++ {
+				recipeProgress.StepCompleted()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if percent := tracker.Percent(); percent != 1.0 {
+		t.Errorf("tracker.Percent() = %f; want 1.0", percent)
+	}
+
+	if len(emitted) == 0 {
+		t.Fatalf("no progress updates emitted")
+	}
+	for i := 1; i < len(emitted); i++ {
+		if emitted[i] < emitted[i-1] {
+			t.Errorf("progress update %d = %f is lower than the previous update %f", i, emitted[i], emitted[i-1])
+		}
+	}
+	if last := emitted[len(emitted)-1]; last != 1.0 {
+		t.Errorf("last progress update = %f; want 1.0", last)
+	}
+}
+
+func TestRecipeProgress(t *testing.T) {
+	tests := []struct {
+		name            string
+		totalSteps      int
+		stepsCompleted  int
+		finish          bool
+		expectedPercent float64
+	}{
+		{"no steps at all", 0, 0, false, 0},
+		{"half of the steps", 10, 5, false, 0.5},
+		{"more steps than in recipe", 10, 15, false, 1.0},
+		{"finished after one step", 10, 1, true, 1.0},
+	}
+
+	for _, test := range tests {
+		tracker := NewProgressTracker(test.totalSteps, nil)
+		recipeProgress := tracker.Recipe(test.totalSteps)
+		for i := 0; i < test.stepsCompleted; i++ {
+			recipeProgress.StepCompleted()
+		}
+		if test.finish {
+			recipeProgress.Finish()
+			// A second call must not count the steps again
+			recipeProgress.Finish()
+		}
+
+		if percent := tracker.Percent(); percent != test.expectedPercent {
+			t.Errorf("%s: tracker.Percent() = %f; want %f", test.name, percent, test.expectedPercent)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SupplierRunMetrics is the result of the recipe of one supplier, exported as Prometheus metrics.
+type SupplierRunMetrics struct {
+	Supplier      string
+	NewFilesCount int
+	// Duration of the recipe in seconds
+	Duration float64
+	Failed   bool
+}
+
+// PrometheusMetrics renders the metrics of a sync run in the Prometheus text exposition format
+// (e.g. for the textfile collector of the node exporter).
+// The suppliers are sorted by name, a supplier listed twice is merged (files and durations are summed, a failure wins).
+func PrometheusMetrics(suppliers []SupplierRunMetrics, lastSync time.Time, syncDuration time.Duration) string {
+	merged := map[string]*SupplierRunMetrics{}
+	names := []string{}
+	for _, supplier := range suppliers {
+		m, ok := merged[supplier.Supplier]
+		if !ok {
+			m = &SupplierRunMetrics{Supplier: supplier.Supplier}
+			merged[supplier.Supplier] = m
+			names = append(names, supplier.Supplier)
+		}
+		m.NewFilesCount += supplier.NewFilesCount
+		m.Duration += supplier.Duration
+		m.Failed = m.Failed || supplier.Failed
+	}
+	sort.Strings(names)
+
+	s := strings.Builder{}
+	writePrometheusMetric(&s, "buchhalter_documents_downloaded", "gauge", "Number of new documents downloaded per supplier in the last sync run.", names, func(name string) string {
+		return strconv.Itoa(merged[name].NewFilesCount)
+	})
+	writePrometheusMetric(&s, "buchhalter_recipe_success", "gauge", "Whether the recipe of the supplier succeeded in the last sync run (1) or not (0).", names, func(name string) string {
+		return prometheusBool(!merged[name].Failed)
+	})
+	writePrometheusMetric(&s, "buchhalter_recipe_failure", "gauge", "Whether the recipe of the supplier failed in the last sync run (1) or not (0).", names, func(name string) string {
+		return prometheusBool(merged[name].Failed)
+	})
+	writePrometheusMetric(&s, "buchhalter_recipe_duration_seconds", "gauge", "Duration of the recipe of the supplier in the last sync run.", names, func(name string) string {
+		return prometheusFloat(merged[name].Duration)
+	})
+
+	fmt.Fprintf(&s, "# HELP buchhalter_last_sync_timestamp_seconds Unix time of the end of the last sync run.\n")
+	fmt.Fprintf(&s, "# TYPE buchhalter_last_sync_timestamp_seconds gauge\n")
+	fmt.Fprintf(&s, "buchhalter_last_sync_timestamp_seconds %d\n", lastSync.Unix())
+	fmt.Fprintf(&s, "# HELP buchhalter_sync_duration_seconds Duration of the last sync run.\n")
+	fmt.Fprintf(&s, "# TYPE buchhalter_sync_duration_seconds gauge\n")
+	fmt.Fprintf(&s, "buchhalter_sync_duration_seconds %s\n", prometheusFloat(syncDuration.Seconds()))
+
+	return s.String()
+}
+
+// WritePrometheusMetrics writes the metrics atomically into file, as required by the textfile collector.
+func WritePrometheusMetrics(file, metrics string) error {
+	if err := WriteFileAtomic(file, []byte(metrics), 0644); err != nil {
+		return fmt.Errorf("error writing metrics file %s: %w", file, err)
+	}
+	return nil
+}
+
+// writePrometheusMetric writes a metric with one sample per supplier (label `supplier`).
+func writePrometheusMetric(s *strings.Builder, name, metricType, help string, suppliers []string, value func(supplier string) string) {
+	fmt.Fprintf(s, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(s, "# TYPE %s %s\n", name, metricType)
+	for _, supplier := range suppliers {
+		fmt.Fprintf(s, "%s{supplier=\"%s\"} %s\n", name, escapePrometheusLabelValue(supplier), value(supplier))
+	}
+}
+
+// escapePrometheusLabelValue escapes backslashes, double quotes and line feeds of a label value.
+func escapePrometheusLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func prometheusBool(value bool) string {
+	if value {
+		return "1"
+	}
+	return "0"
+}
+
+func prometheusFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
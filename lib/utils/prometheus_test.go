@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	suppliers := []SupplierRunMetrics{
+		{Supplier: "hetzner", NewFilesCount: 3, Duration: 12.5},
+		{Supplier: "aws", NewFilesCount: 0, Duration: 30, Failed: true},
+		{Supplier: `odd "name"\`, NewFilesCount: 1, Duration: 1},
+	}
+	lastSync := time.Date(2026, 3, 1, 6, 0, 0, 0, time.UTC)
+
+	metrics := PrometheusMetrics(suppliers, lastSync, 43500*time.Millisecond)
+
+	expected := `# HELP buchhalter_documents_downloaded Number of new documents downloaded per supplier in the last sync run.
+# TYPE buchhalter_documents_downloaded gauge
+buchhalter_documents_downloaded{supplier="aws"} 0
+buchhalter_documents_downloaded{supplier="hetzner"} 3
+buchhalter_documents_downloaded{supplier="odd \"name\"\\"} 1
+# HELP buchhalter_recipe_success Whether the recipe of the supplier succeeded in the last sync run (1) or not (0).
+# TYPE buchhalter_recipe_success gauge
+buchhalter_recipe_success{supplier="aws"} 0
+buchhalter_recipe_success{supplier="hetzner"} 1
+buchhalter_recipe_success{supplier="odd \"name\"\\"} 1
+# HELP buchhalter_recipe_failure Whether the recipe of the supplier failed in the last sync run (1) or not (0).
+# TYPE buchhalter_recipe_failure gauge
+buchhalter_recipe_failure{supplier="aws"} 1
+buchhalter_recipe_failure{supplier="hetzner"} 0
+buchhalter_recipe_failure{supplier="odd \"name\"\\"} 0
+# HELP buchhalter_recipe_duration_seconds Duration of the recipe of the supplier in the last sync run.
+# TYPE buchhalter_recipe_duration_seconds gauge
+buchhalter_recipe_duration_seconds{supplier="aws"} 30
+buchhalter_recipe_duration_seconds{supplier="hetzner"} 12.5
+buchhalter_recipe_duration_seconds{supplier="odd \"name\"\\"} 1
+# HELP buchhalter_last_sync_timestamp_seconds Unix time of the end of the last sync run.
+# TYPE buchhalter_last_sync_timestamp_seconds gauge
+buchhalter_last_sync_timestamp_seconds 1772344800
+# HELP buchhalter_sync_duration_seconds Duration of the last sync run.
+# TYPE buchhalter_sync_duration_seconds gauge
+buchhalter_sync_duration_seconds 43.5
+`
+	if metrics != expected {
+		t.Errorf("PrometheusMetrics() = %s; want %s", metrics, expected)
+	}
+}
+
+func TestPrometheusMetricsMergesSuppliers(t *testing.T) {
+	suppliers := []SupplierRunMetrics{
+		{Supplier: "aws", NewFilesCount: 2, Duration: 1},
+		{Supplier: "aws", Failed: true, Duration: 2},
+	}
+
+	metrics := PrometheusMetrics(suppliers, time.Unix(0, 0), 0)
+
+	for _, sample := range []string{
+		`buchhalter_documents_downloaded{supplier="aws"} 2` + "\n",
+		`buchhalter_recipe_failure{supplier="aws"} 1` + "\n",
+		`buchhalter_recipe_duration_seconds{supplier="aws"} 3` + "\n",
+		"buchhalter_sync_duration_seconds 0\n",
+	} {
+		if !strings.Contains("\n"+metrics, "\n"+sample) {
+			t.Errorf("PrometheusMetrics() = %s; want sample %q", metrics, sample)
+		}
+	}
+}
+
+func TestWritePrometheusMetrics(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "textfile", "buchhalter.prom")
+
+	if err := WritePrometheusMetrics(file, "buchhalter_sync_duration_seconds 1\n"); err != nil {
+		t.Fatalf("WritePrometheusMetrics() returned error: %s", err)
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("Error reading metrics file: %s", err)
+	}
+	if string(content) != "buchhalter_sync_duration_seconds 1\n" {
+		t.Errorf("WritePrometheusMetrics() wrote %q; want the metrics", content)
+	}
+	// The textfile collector reads all *.prom files, no temporary files must be left over
+	entries, _ := os.ReadDir(filepath.Dir(file))
+	if len(entries) != 1 {
+		t.Errorf("Metrics directory contains %d files; want only the metrics file", len(entries))
+	}
+}
@@ -0,0 +1,165 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// StagingMarkerFileName marks the directories of a staging directory created by buchhalter (see InitSupplierDirectories).
+// Only marked directories are removed by CleanupStagingDirectory, the marker is no download.
+const StagingMarkerFileName = ".buchhalter-staging"
+
+const (
+	stagingLockFileName = ".buchhalter.lock"
+	// The lock of a run is refreshed regularly, a lock without refresh is left over from a crashed run
+	stagingLockRefreshInterval = time.Minute
+	stagingLockStaleAfter      = 5 * time.Minute
+)
+
+// ErrStagingDirectoryLocked is returned if another run uses the staging directory.
+var ErrStagingDirectoryLocked = errors.New("staging directory is in use by another run")
+
+// StagingLock marks a staging directory as used by the current run.
+type StagingLock struct {
+	path string
+	stop chan struct{}
+	done chan struct{}
+}
+
+// LockStagingDirectory locks stagingDirectory for the current run.
+// Stale locks of crashed runs are taken over. Release the lock at the end of the run.
+func LockStagingDirectory(stagingDirectory string) (*StagingLock, error) {
+	if err := CreateDirectoryIfNotExists(stagingDirectory); err != nil {
+		return nil, fmt.Errorf("error creating staging directory %s: %w", stagingDirectory, err)
+	}
+
+	lockPath := filepath.Join(stagingDirectory, stagingLockFileName)
+	lockFile, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if errors.Is(err, fs.ErrExist) {
+		fileInfo, statErr := os.Stat(lockPath)
+		if statErr != nil {
+			return nil, fmt.Errorf("error reading lock file %s: %w", lockPath, statErr)
+		}
+		if time.Since(fileInfo.ModTime()) < stagingLockStaleAfter {
+			return nil, fmt.Errorf("%w (lock file %s)", ErrStagingDirectoryLocked, lockPath)
+		}
+		lockFile, err = os.OpenFile(lockPath, os.O_WRONLY|os.O_TRUNC, 0600)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error creating lock file %s: %w", lockPath, err)
+	}
+	_, err = lockFile.WriteString(strconv.Itoa(os.Getpid()))
+	closeErr := lockFile.Close()
+	if err = errors.Join(err, closeErr); err != nil {
+		return nil, fmt.Errorf("error writing lock file %s: %w", lockPath, err)
+	}
+
+	lock := &StagingLock{
+		path: lockPath,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go lock.refresh()
+
+	return lock, nil
+}
+
+func (l *StagingLock) refresh() {
+	defer close(l.done)
+
+	ticker := time.NewTicker(stagingLockRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case now := <-ticker.C:
+			_ = os.Chtimes(l.path, now, now)
+		}
+	}
+}
+
+// Release releases the lock of the staging directory.
+func (l *StagingLock) Release() error {
+	close(l.stop)
+	<-l.done
+
+	if err := os.Remove(l.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("error removing lock file %s: %w", l.path, err)
+	}
+	return nil
+}
+
+// CleanupStagingDirectory removes the downloads directories of stagingDirectory created by buchhalter (see StagingMarkerFileName)
+// without any modification within maxAge, left over from crashed runs. It returns the removed paths.
+// All other entries are kept, they were not created by buchhalter.
+// The staging directory must be locked by the current run (see LockStagingDirectory).
+func CleanupStagingDirectory(stagingDirectory string, maxAge time.Duration, now time.Time) ([]string, error) {
+	entries, err := os.ReadDir(stagingDirectory)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading staging directory %s: %w", stagingDirectory, err)
+	}
+
+	removed := []string{}
+	var errs []error
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		entryPath := filepath.Join(stagingDirectory, entry.Name())
+		if _, err := os.Stat(filepath.Join(entryPath, StagingMarkerFileName)); err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				errs = append(errs, fmt.Errorf("error reading marker of %s: %w", entryPath, err))
+			}
+			continue
+		}
+
+		lastModified, err := latestModification(entryPath)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if now.Sub(lastModified) < maxAge {
+			continue
+		}
+
+		if err := os.RemoveAll(entryPath); err != nil {
+			errs = append(errs, fmt.Errorf("error removing %s: %w", entryPath, err))
+			continue
+		}
+		removed = append(removed, entryPath)
+	}
+
+	return removed, errors.Join(errs...)
+}
+
+// latestModification returns the latest modification time of root and all files inside root.
+func latestModification(root string) (time.Time, error) {
+	var latest time.Time
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		fileInfo, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if fileInfo.ModTime().After(latest) {
+			latest = fileInfo.ModTime()
+		}
+		return nil
+	})
+	if err != nil {
+		return latest, fmt.Errorf("error reading modification times of %s: %w", root, err)
+	}
+
+	return latest, nil
+}
@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeStagingFile(t *testing.T, path string, modTime time.Time) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("error creating directory: %s", err)
+	}
+	if err := os.WriteFile(path, []byte("partial download"), 0644); err != nil {
+		t.Fatalf("error writing file: %s", err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("error setting modification time: %s", err)
+	}
+}
+
+func TestCleanupStagingDirectory(t *testing.T) {
+	now := time.Date(2024, time.May, 10, 12, 0, 0, 0, time.UTC)
+	stagingDirectory := t.TempDir()
+	stale := now.Add(-48 * time.Hour)
+
+	// Stale, the directory and its files are older than the max age
+	writeStagingFile(t, filepath.Join(stagingDirectory, "hetzner", "invoice.pdf.crdownload"), stale)
+	writeStagingFile(t, filepath.Join(stagingDirectory, "hetzner", StagingMarkerFileName), stale)
+	if err := os.Chtimes(filepath.Join(stagingDirectory, "hetzner"), stale, stale); err != nil {
+		t.Fatalf("error setting modification time: %s", err)
+	}
+	// Fresh, a file was modified recently although the directory is old
+	writeStagingFile(t, filepath.Join(stagingDirectory, "aws", "invoice.pdf"), now.Add(-time.Hour))
+	writeStagingFile(t, filepath.Join(stagingDirectory, "aws", StagingMarkerFileName), stale)
+	if err := os.Chtimes(filepath.Join(stagingDirectory, "aws"), stale, stale); err != nil {
+		t.Fatalf("error setting modification time: %s", err)
+	}
+	// Stale, but not created by buchhalter (e.g. the files of other programs in a shared /tmp)
+	writeStagingFile(t, filepath.Join(stagingDirectory, "download.zip"), stale)
+	writeStagingFile(t, filepath.Join(stagingDirectory, "foreign", "notes.txt"), stale)
+	if err := os.Chtimes(filepath.Join(stagingDirectory, "foreign"), stale, stale); err != nil {
+		t.Fatalf("error setting modification time: %s", err)
+	}
+	// The lock file is never removed
+	writeStagingFile(t, filepath.Join(stagingDirectory, stagingLockFileName), stale)
+
+	removed, err := CleanupStagingDirectory(stagingDirectory, 24*time.Hour, now)
+	if err != nil {
+		t.Fatalf("CleanupStagingDirectory() returned error: %s", err)
+	}
+	expected := []string{filepath.Join(stagingDirectory, "hetzner")}
+	if len(removed) != len(expected) || removed[0] != expected[0] {
+		t.Errorf("CleanupStagingDirectory() = %v; want %v", removed, expected)
+	}
+
+	for _, remaining := range []string{"aws", "download.zip", filepath.Join("foreign", "notes.txt"), stagingLockFileName} {
+		if _, err := os.Stat(filepath.Join(stagingDirectory, remaining)); err != nil {
+			t.Errorf("%s was removed, but is not stale or not created by buchhalter", remaining)
+		}
+	}
+}
+
+func TestCleanupStagingDirectoryNotExisting(t *testing.T) {
+	removed, err := CleanupStagingDirectory(filepath.Join(t.TempDir(), "missing"), time.Hour, time.Now())
+	if err != nil || len(removed) != 0 {
+		t.Errorf("CleanupStagingDirectory() = %v, %v; want nothing removed and no error", removed, err)
+	}
+}
+
+func TestLockStagingDirectory(t *testing.T) {
+	stagingDirectory := filepath.Join(t.TempDir(), "_tmp")
+
+	lock, err := LockStagingDirectory(stagingDirectory)
+	if err != nil {
+		t.Fatalf("LockStagingDirectory() returned error: %s", err)
+	}
+
+	// A second run can't lock the staging directory in use
+	if _, err := LockStagingDirectory(stagingDirectory); !errors.Is(err, ErrStagingDirectoryLocked) {
+		t.Errorf("LockStagingDirectory() of a locked staging directory returned %v; want ErrStagingDirectoryLocked", err)
+	}
+
+	if err := lock.Release(); err != nil {
+		t.Fatalf("Release() returned error: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(stagingDirectory, stagingLockFileName)); !os.IsNotExist(err) {
+		t.Errorf("lock file was not removed on release")
+	}
+
+	// Stale locks of crashed runs are taken over
+	staleTime := time.Now().Add(-2 * stagingLockStaleAfter)
+	writeStagingFile(t, filepath.Join(stagingDirectory, stagingLockFileName), staleTime)
+	lock, err = LockStagingDirectory(stagingDirectory)
+	if err != nil {
+		t.Fatalf("LockStagingDirectory() with a stale lock returned error: %s", err)
+	}
+	if err := lock.Release(); err != nil {
+		t.Fatalf("Release() returned error: %s", err)
+	}
+}
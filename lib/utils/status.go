@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// RunStatusFormatVersion is the version of the status file format.
+// It is only increased on incompatible changes, new fields can be added without a new version.
+const RunStatusFormatVersion = 1
+
+// Results of a run in the status file
+const (
+	RunResultSuccess = "success"
+	RunResultPartial = "partial"
+	RunResultFailed  = "failed"
+)
+
+// RunStatus is the content of the status file, written at the end of each sync run.
+// External monitoring (e.g. a cron check) can read it to detect failing or missing scheduled runs.
+// All times are UTC in RFC 3339.
+type RunStatus struct {
+	FormatVersion     int        `json:"formatVersion"`
+	CliVersion        string     `json:"cliVersion"`
+	LastRun           time.Time  `json:"lastRun"`
+	LastRunDuration   float64    `json:"lastRunDurationSeconds"`
+	LastResult        string     `json:"lastResult"`
+	ExitCode          int        `json:"exitCode"`
+	NewFilesCount     int        `json:"newFilesCount"`
+	FailedSuppliers   []string   `json:"failedSuppliers"`
+	LastSuccessfulRun *time.Time `json:"lastSuccessfulRun"`
+	NextExpectedRun   *time.Time `json:"nextExpectedRun"`
+	// NewFiles are the paths of the new documents by supplier, only written in verbose mode (`sync --verbose`)
+	NewFiles map[string][]string `json:"newFiles,omitempty"`
+	// ErrorCodes are the error codes of the failed recipes by supplier (see ErrorCode)
+	ErrorCodes map[string]ErrorCode `json:"errorCodes,omitempty"`
+	// MissingCredentials are the suppliers skipped because their vault items miss credentials, with the missing fields (e.g. `password`).
+	// Skipped suppliers aren't failed suppliers.
+	MissingCredentials map[string][]string `json:"missingCredentials,omitempty"`
+}
+
+// NewRunStatus composes the status of a run that started at startTime and finished at now.
+// The result is derived from the exit code: 0 is a success, an exit code with failed suppliers is partial, everything else failed.
+// The last successful run is taken from previous (the status of the previous run, may be nil) if this run wasn't successful.
+// Without an interval, no next run is expected.
+func NewRunStatus(previous *RunStatus, cliVersion string, startTime, now time.Time, exitCode, newFilesCount int, failedSuppliers []string, interval time.Duration) RunStatus {
+	status := RunStatus{
+		FormatVersion:   RunStatusFormatVersion,
+		CliVersion:      cliVersion,
+		LastRun:         now.UTC().Truncate(time.Second),
+		LastRunDuration: now.Sub(startTime).Round(time.Millisecond).Seconds(),
+		ExitCode:        exitCode,
+		NewFilesCount:   newFilesCount,
+		FailedSuppliers: append([]string{}, failedSuppliers...),
+	}
+
+	switch {
+	case exitCode == 0:
+		status.LastResult = RunResultSuccess
+	case len(failedSuppliers) > 0:
+		status.LastResult = RunResultPartial
+	default:
+		status.LastResult = RunResultFailed
+	}
+
+	if status.LastResult == RunResultSuccess {
+		lastSuccessfulRun := status.LastRun
+		status.LastSuccessfulRun = &lastSuccessfulRun
+	} else if previous != nil && previous.LastSuccessfulRun != nil {
+		lastSuccessfulRun := previous.LastSuccessfulRun.UTC()
+		status.LastSuccessfulRun = &lastSuccessfulRun
+	}
+
+	if interval > 0 {
+		nextExpectedRun := status.LastRun.Add(interval)
+		status.NextExpectedRun = &nextExpectedRun
+	}
+
+	return status
+}
+
+// ReadRunStatus reads the status file of a previous run.
+// A missing status file is no error, nil is returned instead.
+func ReadRunStatus(statusFile string) (*RunStatus, error) {
+	content, err := os.ReadFile(statusFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading status file %s: %w", statusFile, err)
+	}
+
+	var status RunStatus
+	if err := json.Unmarshal(content, &status); err != nil {
+		return nil, fmt.Errorf("error parsing status file %s: %w", statusFile, err)
+	}
+
+	return &status, nil
+}
+
+// WriteRunStatus writes the status file atomically (temporary file + rename),
+// so that monitoring never reads a partially written file.
+func WriteRunStatus(statusFile string, status RunStatus) error {
+	content, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding status file: %w", err)
+	}
+	content = append(content, '\n')
+
+	if err := WriteFileAtomic(statusFile, content, 0644); err != nil {
+		return fmt.Errorf("error writing status file %s: %w", statusFile, err)
+	}
+
+	return nil
+}
+
+// WriteFileAtomic writes content into a temporary file of the same directory and renames it to file.
+// Readers see either the previous or the new content, never a partially written file.
+func WriteFileAtomic(file string, content []byte, perm os.FileMode) error {
+	directory := filepath.Dir(file)
+	if err := CreateDirectoryIfNotExists(directory); err != nil {
+		return err
+	}
+	tmpFile, err := os.CreateTemp(directory, "."+filepath.Base(file)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write(content); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpFile.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), file)
+}
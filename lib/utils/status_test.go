@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewRunStatus(t *testing.T) {
+	startTime := time.Date(2026, 3, 1, 6, 0, 0, 0, time.UTC)
+	now := startTime.Add(90*time.Second + 250*time.Millisecond)
+	previousSuccess := time.Date(2026, 2, 28, 6, 1, 0, 0, time.UTC)
+	previous := &RunStatus{LastSuccessfulRun: &previousSuccess}
+
+	tests := []struct {
+		name                      string
+		exitCode                  int
+		failedSuppliers           []string
+		expectedResult            string
+		expectedLastSuccessfulRun time.Time
+	}{
+		{"success", 0, nil, RunResultSuccess, now.Truncate(time.Second)},
+		{"failed suppliers", 12, []string{"aws", "github"}, RunResultPartial, previousSuccess},
+		{"fatal error", 1, nil, RunResultFailed, previousSuccess},
+	}
+
+	for _, test := range tests {
+		status := NewRunStatus(previous, "1.2.3", startTime, now, test.exitCode, 4, test.failedSuppliers, 24*time.Hour)
+		if status.LastResult != test.expectedResult {
+			t.Errorf("%s: NewRunStatus().LastResult = %s; want %s", test.name, status.LastResult, test.expectedResult)
+		}
+		if status.LastSuccessfulRun == nil || !status.LastSuccessfulRun.Equal(test.expectedLastSuccessfulRun) {
+			t.Errorf("%s: NewRunStatus().LastSuccessfulRun = %v; want %s", test.name, status.LastSuccessfulRun, test.expectedLastSuccessfulRun)
+		}
+		if status.NextExpectedRun == nil || !status.NextExpectedRun.Equal(now.Truncate(time.Second).Add(24*time.Hour)) {
+			t.Errorf("%s: NewRunStatus().NextExpectedRun = %v; want 24h after the run", test.name, status.NextExpectedRun)
+		}
+		if status.LastRunDuration != 90.25 {
+			t.Errorf("%s: NewRunStatus().LastRunDuration = %f; want 90.25", test.name, status.LastRunDuration)
+		}
+		if status.FailedSuppliers == nil || len(status.FailedSuppliers) != len(test.failedSuppliers) {
+			t.Errorf("%s: NewRunStatus().FailedSuppliers = %v; want %v", test.name, status.FailedSuppliers, test.failedSuppliers)
+		}
+	}
+
+	// Without previous run and interval
+	status := NewRunStatus(nil, "1.2.3", startTime, now, 1, 0, nil, 0)
+	if status.LastSuccessfulRun != nil || status.NextExpectedRun != nil {
+		t.Errorf("NewRunStatus() = %+v; want no last successful and next expected run", status)
+	}
+}
+
+func TestWriteRunStatus(t *testing.T) {
+	statusFile := filepath.Join(t.TempDir(), "monitoring", "status.json")
+	startTime := time.Date(2026, 3, 1, 6, 0, 0, 0, time.UTC)
+	status := NewRunStatus(nil, "1.2.3", startTime, startTime.Add(2*time.Second), 11, 3, []string{"aws"}, time.Hour)
+
+	if err := WriteRunStatus(statusFile, status); err != nil {
+		t.Fatalf("WriteRunStatus() returned error: %s", err)
+	}
+
+	content, err := os.ReadFile(statusFile)
+	if err != nil {
+		t.Fatalf("Error reading status file: %s", err)
+	}
+	expected := `{
+  "formatVersion": 1,
+  "cliVersion": "1.2.3",
+  "lastRun": "2026-03-01T06:00:02Z",
+  "lastRunDurationSeconds": 2,
+  "lastResult": "partial",
+  "exitCode": 11,
+  "newFilesCount": 3,
+  "failedSuppliers": [
+    "aws"
+  ],
+  "lastSuccessfulRun": null,
+  "nextExpectedRun": "2026-03-01T07:00:02Z"
+}
+`
+	if string(content) != expected {
+		t.Errorf("WriteRunStatus() wrote %s; want %s", content, expected)
+	}
+
+	// No temporary files are left over
+	entries, err := os.ReadDir(filepath.Dir(statusFile))
+	if err != nil {
+		t.Fatalf("Error reading status directory: %s", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Status directory contains %d files; want only the status file", len(entries))
+	}
+
+	// The next run overwrites the status and keeps the last successful run
+	read, err := ReadRunStatus(statusFile)
+	if err != nil {
+		t.Fatalf("ReadRunStatus() returned error: %s", err)
+	}
+	if read.LastResult != RunResultPartial || read.ExitCode != 11 || !read.LastRun.Equal(status.LastRun) {
+		t.Errorf("ReadRunStatus() = %+v; want %+v", read, status)
+	}
+	success := NewRunStatus(read, "1.2.3", startTime.Add(time.Hour), startTime.Add(time.Hour+time.Second), 0, 0, nil, time.Hour)
+	if err := WriteRunStatus(statusFile, success); err != nil {
+		t.Fatalf("WriteRunStatus() returned error: %s", err)
+	}
+	content, _ = os.ReadFile(statusFile)
+	if !strings.Contains(string(content), `"lastResult": "success"`) || !strings.Contains(string(content), `"failedSuppliers": []`) {
+		t.Errorf("WriteRunStatus() wrote %s; want a successful run without failed suppliers", content)
+	}
+
+	// The new files are only part of the status in verbose mode
+	success.NewFiles = map[string][]string{"hetzner": {"hetzner/2026-03-01-invoice.pdf"}}
+	if err := WriteRunStatus(statusFile, success); err != nil {
+		t.Fatalf("WriteRunStatus() returned error: %s", err)
+	}
+	read, err = ReadRunStatus(statusFile)
+	if err != nil {
+		t.Fatalf("ReadRunStatus() returned error: %s", err)
+	}
+	if files := read.NewFiles["hetzner"]; len(files) != 1 || files[0] != "hetzner/2026-03-01-invoice.pdf" {
+		t.Errorf("ReadRunStatus().NewFiles = %v; want the new files of hetzner", read.NewFiles)
+	}
+}
+
+func TestReadRunStatus(t *testing.T) {
+	directory := t.TempDir()
+
+	status, err := ReadRunStatus(filepath.Join(directory, "missing.json"))
+	if status != nil || err != nil {
+		t.Errorf("ReadRunStatus(missing file) = %v, %v; want nil, nil", status, err)
+	}
+
+	invalidFile := filepath.Join(directory, "invalid.json")
+	if err := os.WriteFile(invalidFile, []byte("{"), 0600); err != nil {
+		t.Fatalf("Error writing invalid status file: %s", err)
+	}
+	if _, err := ReadRunStatus(invalidFile); err == nil {
+		t.Errorf("ReadRunStatus(invalid file) returned no error; want an error")
+	}
+}
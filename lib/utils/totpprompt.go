@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTotpPromptTimeout is the time the user has to enter a 2FA code, before the recipe fails.
+const DefaultTotpPromptTimeout = 2 * time.Minute
+
+var (
+	// ErrTotpPromptUnavailable is returned by TotpPrompt.Ask, if nobody can answer the prompt (e.g. in quiet mode).
+	ErrTotpPromptUnavailable = errors.New("no 2FA code can be entered in non-interactive mode")
+	// ErrTotpPromptCanceled is returned by TotpPrompt.Ask, if the user canceled the prompt.
+	ErrTotpPromptCanceled = errors.New("entering the 2FA code was canceled")
+	// ErrTotpPromptTimeout is returned by TotpPrompt.Ask, if no code was entered within the timeout of the prompt.
+	ErrTotpPromptTimeout = errors.New("no 2FA code entered in time")
+)
+
+// ViewTotpPromptMsg asks the user of the interactive UI for the current 2FA code of Supplier.
+// The entered code is sent on Code, an empty code cancels the prompt.
+// A message with Closed hides the prompt again (e.g. after its timeout), it has no Code.
+type ViewTotpPromptMsg struct {
+	Supplier string
+	Timeout  time.Duration
+	Code     chan<- string
+	Closed   bool
+}
+
+// TotpPrompt asks the user for the current 2FA code, if the vault has no TOTP for a supplier.
+// The recipe is blocked until the code is entered, the prompt is canceled or it times out.
+// It is safe for concurrent use, the prompts of parallel recipes are shown one after another. A nil *TotpPrompt can't ask.
+type TotpPrompt struct {
+	mutex   sync.Mutex
+	timeout time.Duration
+	// send shows the prompt in the UI (e.g. `p.Send` of the bubbletea program)
+	send func(ViewTotpPromptMsg)
+}
+
+// NewTotpPrompt returns a prompt shown via send, a timeout <= 0 uses DefaultTotpPromptTimeout.
+func NewTotpPrompt(timeout time.Duration, send func(ViewTotpPromptMsg)) *TotpPrompt {
+	if timeout <= 0 {
+		timeout = DefaultTotpPromptTimeout
+	}
+	return &TotpPrompt{timeout: timeout, send: send}
+}
+
+// Timeout returns the time the user has to enter a code, zero for a nil prompt.
+func (t *TotpPrompt) Timeout() time.Duration {
+	if t == nil {
+		return 0
+	}
+	return t.timeout
+}
+
+// Ask shows the prompt for supplier and returns the entered code (without spaces, e.g. of `123 456`).
+// It returns ErrTotpPromptCanceled, ErrTotpPromptTimeout or the error of ctx, if no code was entered.
+func (t *TotpPrompt) Ask(ctx context.Context, supplier string) (string, error) {
+	if t == nil || t.send == nil {
+		return "", ErrTotpPromptUnavailable
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	// The UI must not block on sending the code, e.g. if the prompt timed out in the meantime
+	code := make(chan string, 1)
+	t.send(ViewTotpPromptMsg{Supplier: supplier, Timeout: t.timeout, Code: code})
+
+	timer := time.NewTimer(t.timeout)
+	defer timer.Stop()
+	select {
+	case entered := <-code:
+		entered = strings.Join(strings.Fields(entered), "")
+		if len(entered) == 0 {
+			return "", ErrTotpPromptCanceled
+		}
+		return entered, nil
+	case <-timer.C:
+		t.send(ViewTotpPromptMsg{Supplier: supplier, Closed: true})
+		return "", fmt.Errorf("%w (%s)", ErrTotpPromptTimeout, t.timeout)
+	case <-ctx.Done():
+		t.send(ViewTotpPromptMsg{Supplier: supplier, Closed: true})
+		return "", ctx.Err()
+	}
+}
@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTotpPromptAsk(t *testing.T) {
+	tests := []struct {
+		name        string
+		answer      string
+		expected    string
+		expectedErr error
+	}{
+		{"code", "123456", "123456", nil},
+		{"code with spaces", " 123 456 ", "123456", nil},
+		{"canceled", "", "", ErrTotpPromptCanceled},
+	}
+
+	for _, test := range tests {
+		var shown []ViewTotpPromptMsg
+		prompt := NewTotpPrompt(time.Second, func(msg ViewTotpPromptMsg) {
+			shown = append(shown, msg)
+			if msg.Code != nil {
+				msg.Code <- test.answer
+			}
+		})
+
+		code, err := prompt.Ask(context.Background(), "hetzner")
+		if !errors.Is(err, test.expectedErr) {
+			t.Errorf("%s: Ask() returned error %v, expected %v", test.name, err, test.expectedErr)
+		}
+		if code != test.expected {
+			t.Errorf("%s: Ask() = %q, expected %q", test.name, code, test.expected)
+		}
+		if len(shown) != 1 || shown[0].Supplier != "hetzner" || shown[0].Timeout != time.Second {
+			t.Errorf("%s: Ask() showed the prompts %v, expected one prompt for hetzner", test.name, shown)
+		}
+	}
+}
+
+func TestTotpPromptAskTimeout(t *testing.T) {
+	shown := make(chan ViewTotpPromptMsg, 2)
+	prompt := NewTotpPrompt(20*time.Millisecond, func(msg ViewTotpPromptMsg) {
+		shown <- msg
+	})
+
+	if _, err := prompt.Ask(context.Background(), "hetzner"); !errors.Is(err, ErrTotpPromptTimeout) {
+		t.Errorf("Ask() without answer returned error %v, expected %v", err, ErrTotpPromptTimeout)
+	}
+	if msg := <-shown; msg.Closed || msg.Code == nil {
+		t.Errorf("first message %v is no prompt", msg)
+	}
+	if msg := <-shown; !msg.Closed {
+		t.Errorf("second message %v doesn't close the prompt", msg)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	prompt = NewTotpPrompt(time.Minute, func(msg ViewTotpPromptMsg) {})
+	if _, err := prompt.Ask(ctx, "hetzner"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Ask() with canceled context returned error %v, expected %v", err, context.Canceled)
+	}
+}
+
+func TestTotpPromptUnavailable(t *testing.T) {
+	var prompt *TotpPrompt
+	if _, err := prompt.Ask(context.Background(), "hetzner"); !errors.Is(err, ErrTotpPromptUnavailable) {
+		t.Errorf("Ask() of nil prompt returned error %v, expected %v", err, ErrTotpPromptUnavailable)
+	}
+	if timeout := prompt.Timeout(); timeout != 0 {
+		t.Errorf("Timeout() of nil prompt = %s, expected 0", timeout)
+	}
+	if timeout := NewTotpPrompt(0, nil).Timeout(); timeout != DefaultTotpPromptTimeout {
+		t.Errorf("Timeout() = %s, expected %s", timeout, DefaultTotpPromptTimeout)
+	}
+}
@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Defaults of UnzipLimits, the archives of suppliers contain a few invoices
+const (
+	DefaultUnzipMaxSizeMB = 512
+	DefaultUnzipMaxFiles  = 1000
+)
+
+// ErrUnzipLimitExceeded is returned by UnzipFile, if an archive has more files or more uncompressed data than its limits allow (e.g. a zip bomb).
+var ErrUnzipLimitExceeded = errors.New("zip file exceeds the unzip limits")
+
+// UnzipLimits limit the extraction of an archive (`buchhalter_unzip_max_size_mb` and `buchhalter_unzip_max_files`).
+// Values that aren't positive use the defaults.
+type UnzipLimits struct {
+	// MaxSizeMB is the total uncompressed size of all files in MB
+	MaxSizeMB int
+	MaxFiles  int
+}
+
+func (l UnzipLimits) maxSize() int64 {
+	if l.MaxSizeMB <= 0 {
+		return DefaultUnzipMaxSizeMB << 20
+	}
+	return int64(l.MaxSizeMB) << 20
+}
+
+func (l UnzipLimits) maxFiles() int {
+	if l.MaxFiles <= 0 {
+		return DefaultUnzipMaxFiles
+	}
+	return l.MaxFiles
+}
+
+// UnzipFile extracts the zip file source into dest, incl. the directories of the archive.
+// The archives are downloads of suppliers, so they are untrusted: Entries escaping dest (e.g. `../` or absolute paths) and symlinks
+// are rejected, and the number of files and their uncompressed size are limited by limits (see ErrUnzipLimitExceeded).
+// The limits are checked before extracting the archive by the sizes of its entries and while extracting by the written bytes.
+func UnzipFile(source, dest string, limits UnzipLimits) error {
+	read, err := zip.OpenReader(source)
+	if err != nil {
+		return err
+	}
+	defer read.Close()
+
+	maxSize, maxFiles := limits.maxSize(), limits.maxFiles()
+	files := 0
+	var declaredSize uint64
+	for _, file := range read.File {
+		if _, err := unzipPath(dest, file); err != nil {
+			return fmt.Errorf("zip file %s is not safe to extract: %w", source, err)
+		}
+		if file.Mode().IsDir() {
+			continue
+		}
+		files++
+		declaredSize += file.UncompressedSize64
+	}
+	if files > maxFiles {
+		return fmt.Errorf("zip file %s has %d files, more than the limit of %d files: %w", source, files, maxFiles, ErrUnzipLimitExceeded)
+	}
+	if declaredSize > uint64(maxSize) {
+		return fmt.Errorf("zip file %s has %d bytes uncompressed, more than the limit of %d MB: %w", source, declaredSize, maxSize>>20, ErrUnzipLimitExceeded)
+	}
+
+	remaining := maxSize
+	for _, file := range read.File {
+		name, _ := unzipPath(dest, file)
+		if file.Mode().IsDir() {
+			if err := os.MkdirAll(name, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		written, err := unzipEntry(file, name, remaining)
+		if err != nil {
+			return fmt.Errorf("error extracting %s of zip file %s: %w", file.Name, source, err)
+		}
+		remaining -= written
+	}
+
+	return nil
+}
+
+// unzipPath returns the path of file within dest, an error if the entry would be written outside of dest or is a symlink.
+func unzipPath(dest string, file *zip.File) (string, error) {
+	if file.Mode()&os.ModeSymlink != 0 {
+		return "", fmt.Errorf("entry %s is a symlink", file.Name)
+	}
+	name := filepath.FromSlash(file.Name)
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("entry %s escapes the destination directory", file.Name)
+	}
+	return filepath.Join(dest, name), nil
+}
+
+// unzipEntry writes file to name, at most maxSize bytes (the archive might contain more than the entry declares).
+func unzipEntry(file *zip.File, name string, maxSize int64) (int64, error) {
+	if err := CreateDirectoryIfNotExists(filepath.Dir(name)); err != nil {
+		return 0, err
+	}
+	open, err := file.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer open.Close()
+
+	create, err := os.Create(name)
+	if err != nil {
+		return 0, err
+	}
+	written, err := io.Copy(create, io.LimitReader(open, maxSize+1))
+	if closeErr := create.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return written, err
+	}
+	if written > maxSize {
+		_ = os.Remove(name)
+		return written, fmt.Errorf("uncompressed data exceeds the size limit: %w", ErrUnzipLimitExceeded)
+	}
+	return written, nil
+}
@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type zipEntry struct {
+	name    string
+	content []byte
+	mode    os.FileMode
+}
+
+// writeTestZip writes a zip file with entries, the names are written as is (e.g. with `../`).
+func writeTestZip(t *testing.T, entries []zipEntry) string {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), "documents.zip")
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatalf("error creating zip file: %s", err)
+	}
+	defer f.Close()
+	w := zip.NewWriter(f)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate}
+		if entry.mode != 0 {
+			header.SetMode(entry.mode)
+		}
+		fw, err := w.CreateHeader(header)
+		if err != nil {
+			t.Fatalf("error adding %s to zip file: %s", entry.name, err)
+		}
+		if _, err := fw.Write(entry.content); err != nil {
+			t.Fatalf("error writing %s to zip file: %s", entry.name, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("error closing zip file: %s", err)
+	}
+	return file
+}
+
+func TestUnzipFile(t *testing.T) {
+	source := writeTestZip(t, []zipEntry{
+		{name: "2024/01/invoice.pdf", content: []byte("%PDF-1.4 january")},
+		{name: "2024/02/invoice.pdf", content: []byte("%PDF-1.4 february")},
+		{name: "2024/empty/", mode: os.ModeDir | 0755},
+		{name: "summary.csv", content: []byte("month,amount")},
+	})
+	dest := t.TempDir()
+
+	if err := UnzipFile(source, dest, UnzipLimits{}); err != nil {
+		t.Fatalf("UnzipFile() returned error: %s", err)
+	}
+	// Files with the same name in different directories are kept both
+	expected := map[string]string{
+		"2024/01/invoice.pdf": "%PDF-1.4 january",
+		"2024/02/invoice.pdf": "%PDF-1.4 february",
+		"summary.csv":         "month,amount",
+	}
+	for name, content := range expected {
+		extracted, err := os.ReadFile(filepath.Join(dest, filepath.FromSlash(name)))
+		if err != nil || string(extracted) != content {
+			t.Errorf("UnzipFile() extracted %s = %q, %v; want %q", name, extracted, err, content)
+		}
+	}
+	if info, err := os.Stat(filepath.Join(dest, "2024", "empty")); err != nil || !info.IsDir() {
+		t.Errorf("UnzipFile() didn't create the directory 2024/empty: %v", err)
+	}
+}
+
+func TestUnzipFileRejectsMaliciousArchives(t *testing.T) {
+	bomb := bytes.Repeat([]byte{0}, 3<<20)
+	tests := []struct {
+		name          string
+		entries       []zipEntry
+		limits        UnzipLimits
+		expectedLimit bool
+	}{
+		{"parent directory", []zipEntry{{name: "invoice.pdf", content: []byte("ok")}, {name: "../evil.sh", content: []byte("rm -rf")}}, UnzipLimits{}, false},
+		{"nested parent directory", []zipEntry{{name: "invoices/../../evil.sh", content: []byte("rm -rf")}}, UnzipLimits{}, false},
+		{"absolute path", []zipEntry{{name: "/tmp/evil.sh", content: []byte("rm -rf")}}, UnzipLimits{}, false},
+		{"symlink", []zipEntry{{name: "link", content: []byte("/etc/passwd"), mode: os.ModeSymlink | 0777}}, UnzipLimits{}, false},
+		{"too many files", []zipEntry{{name: "a.pdf"}, {name: "b.pdf"}, {name: "c.pdf"}}, UnzipLimits{MaxFiles: 2}, true},
+		{"too large", []zipEntry{{name: "bomb.bin", content: bomb}}, UnzipLimits{MaxSizeMB: 2}, true},
+		{"too large in total", []zipEntry{{name: "a.bin", content: bomb[:3<<19]}, {name: "b.bin", content: bomb[:3<<19]}}, UnzipLimits{MaxSizeMB: 2}, true},
+	}
+
+	for _, test := range tests {
+		source := writeTestZip(t, test.entries)
+		parent := t.TempDir()
+		dest := filepath.Join(parent, "downloads")
+		if err := os.Mkdir(dest, 0755); err != nil {
+			t.Fatalf("error creating destination: %s", err)
+		}
+
+		err := UnzipFile(source, dest, test.limits)
+		if err == nil {
+			t.Errorf("%s: UnzipFile() returned no error", test.name)
+			continue
+		}
+		if isLimit := errors.Is(err, ErrUnzipLimitExceeded); isLimit != test.expectedLimit {
+			t.Errorf("%s: UnzipFile() = %v; want ErrUnzipLimitExceeded %t", test.name, err, test.expectedLimit)
+		}
+		// Nothing is extracted from a rejected archive, neither into dest nor next to it
+		if entries, _ := os.ReadDir(dest); len(entries) > 0 {
+			t.Errorf("%s: UnzipFile() extracted %d entries", test.name, len(entries))
+		}
+		if entries, _ := os.ReadDir(parent); len(entries) != 1 {
+			t.Errorf("%s: UnzipFile() wrote %d entries outside of the destination", test.name, len(entries)-1)
+		}
+	}
+}
+
+func TestUnzipEntryStopsAtSizeLimit(t *testing.T) {
+	// An entry may declare a smaller size than it writes, so the written bytes are limited as well
+	source := writeTestZip(t, []zipEntry{{name: "bomb.bin", content: bytes.Repeat([]byte{0}, 1024)}})
+	read, err := zip.OpenReader(source)
+	if err != nil {
+		t.Fatalf("error opening zip file: %s", err)
+	}
+	defer read.Close()
+
+	name := filepath.Join(t.TempDir(), "bomb.bin")
+	if _, err := unzipEntry(read.File[0], name, 100); !errors.Is(err, ErrUnzipLimitExceeded) {
+		t.Errorf("unzipEntry() = %v; want ErrUnzipLimitExceeded", err)
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("unzipEntry() kept the incomplete file %s", name)
+	}
+}
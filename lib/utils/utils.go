@@ -1,7 +1,6 @@
 package utils
 
 import (
-	"archive/zip"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
@@ -11,7 +10,6 @@ import (
 	"io/fs"
 	"math/big"
 	"os"
-	"path"
 	"path/filepath"
 	"strings"
 )
@@ -43,6 +41,10 @@ type RecipeResult struct {
 	LastStepDescription string
 	LastErrorMessage    string
 	NewFilesCount       int
+	// NewFiles are the paths of the new documents in the local storage
+	NewFiles []string
+	// ErrorCode classifies the error of a failed recipe, empty on success
+	ErrorCode ErrorCode
 }
 
 // StepResult represents the result of a single step execution.
@@ -50,14 +52,51 @@ type StepResult struct {
 	Status  string
 	Message string
 	Break   bool
+	// ErrorCode classifies the error of a failed step, empty if the step didn't classify it
+	ErrorCode ErrorCode
 }
 
+// ErrorCodeOrUnknown returns the error code of a failed step, ErrorCodeUnknown if the step didn't classify its error.
+func (r StepResult) ErrorCodeOrUnknown() ErrorCode {
+	if len(r.ErrorCode) == 0 {
+		return ErrorCodeUnknown
+	}
+	return r.ErrorCode
+}
+
+// ErrorCode classifies the error of a failed step or recipe.
+// Unlike the error message, the codes are stable, e.g. for dashboards and alerting by failure class.
+type ErrorCode string
+
+const (
+	// ErrorCodeAuthFailed is a failed login, e.g. wrong credentials or an expired OAuth2 token
+	ErrorCodeAuthFailed ErrorCode = "auth_failed"
+	// ErrorCodeTwoFactorRequired is a second factor that is missing or wasn't confirmed (e.g. a push approval)
+	ErrorCodeTwoFactorRequired ErrorCode = "2fa_required"
+	// ErrorCodeTimeout is a step or supplier that timed out
+	ErrorCodeTimeout ErrorCode = "timeout"
+	// ErrorCodeSelectorNotFound is an element of the page the recipe didn't find
+	ErrorCodeSelectorNotFound ErrorCode = "selector_not_found"
+	// ErrorCodeDownloadFailed is a document that couldn't be downloaded or moved to the local storage
+	ErrorCodeDownloadFailed ErrorCode = "download_failed"
+	// ErrorCodeNetwork is a page or API that couldn't be reached
+	ErrorCodeNetwork ErrorCode = "network"
+	// ErrorCodeScriptFailed is a script of the recipe that failed or returned an unexpected result
+	ErrorCodeScriptFailed ErrorCode = "script_failed"
+	// ErrorCodeInvalidRecipe is a recipe the driver can't run, e.g. an unsupported action
+	ErrorCodeInvalidRecipe ErrorCode = "invalid_recipe"
+	// ErrorCodeUnknown is an error that isn't classified
+	ErrorCodeUnknown ErrorCode = "unknown"
+)
+
 type UIActionStyle string
 
 const (
 	UIActionStyleSuccess UIActionStyle = "success"
 	UIActionStyleError   UIActionStyle = "error"
 	UIActionStyleThanks  UIActionStyle = "thanks"
+	// UIActionStyleDetail is an indented detail of the previous action (e.g. a new file in verbose mode)
+	UIActionStyleDetail UIActionStyle = "detail"
 )
 
 type UIAction struct {
@@ -65,18 +104,37 @@ type UIAction struct {
 	Style   UIActionStyle
 }
 
-func InitSupplierDirectories(buchhalterDirectory, supplier string) (string, string, error) {
-	downloadsDirectory := filepath.Join(buchhalterDirectory, "_tmp", supplier)
-	documentsDirectory := filepath.Join(buchhalterDirectory, supplier)
+// InitSupplierDirectories creates the (temporary) downloads directory of supplier inside stagingDirectory.
+// The downloads directory is marked as created by buchhalter (see StagingMarkerFileName).
+// The directories of the documents depend on the archive layout and are created by the document archive.
+func InitSupplierDirectories(stagingDirectory, supplier string) (string, error) {
+	downloadsDirectory := filepath.Join(stagingDirectory, supplier)
 	err := CreateDirectoryIfNotExists(downloadsDirectory)
 	if err != nil {
-		return "", "", err
+		return "", err
 	}
-	err = CreateDirectoryIfNotExists(documentsDirectory)
+	err = os.WriteFile(filepath.Join(downloadsDirectory, StagingMarkerFileName), nil, 0600)
 	if err != nil {
-		return downloadsDirectory, "", err
+		return "", err
 	}
-	return downloadsDirectory, documentsDirectory, nil
+	return downloadsDirectory, nil
+}
+
+// StagingDirectory returns the directory for the (temporary) downloads of the vault vaultID.
+// Without a configured directory, the downloads are staged in the `_tmp` directory of documentsDirectory (of the vault).
+// A configured directory may be shared with other programs (e.g. /tmp) and the runs of other vaults,
+// the downloads are staged in its `buchhalter/<vaultID>` subdirectory.
+func StagingDirectory(configuredDirectory, documentsDirectory, vaultID string) (string, error) {
+	configuredDirectory = strings.TrimSpace(configuredDirectory)
+	if len(configuredDirectory) == 0 {
+		return filepath.Join(documentsDirectory, "_tmp"), nil
+	}
+
+	directory, err := filepath.Abs(configuredDirectory)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(directory, "buchhalter", vaultID), nil
 }
 
 func CreateDirectoryIfNotExists(path string) error {
@@ -139,41 +197,47 @@ func CopyFile(src, dst string) (int64, error) {
 	return nBytes, err
 }
 
-func UnzipFile(source, dest string) error {
-	read, err := zip.OpenReader(source)
+// maxUniqueFileSuffix limits the suffixes CopyFileUnique tries for an existing destination
+const maxUniqueFileSuffix = 1000
+
+// CopyFileUnique copies src to dst without overwriting an existing file.
+// If dst exists, a numbered suffix is added to its name (e.g. `invoice-2.pdf`). It returns the path of the copy.
+func CopyFileUnique(src, dst string) (string, error) {
+	source, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer source.Close()
+	sourceFileStat, err := source.Stat()
 	if err != nil {
-		return err
+		return "", err
+	}
+	if !sourceFileStat.Mode().IsRegular() {
+		return "", fmt.Errorf("%s is not a regular file", src)
 	}
-	defer read.Close()
 
-	for _, file := range read.File {
-		if file.Mode().IsDir() {
-			continue
+	extension := filepath.Ext(dst)
+	base := strings.TrimSuffix(dst, extension)
+	for n := 1; n <= maxUniqueFileSuffix; n++ {
+		candidate := dst
+		if n > 1 {
+			candidate = fmt.Sprintf("%s-%d%s", base, n, extension)
 		}
-		open, err := file.Open()
-		if err != nil {
-			return err
-		}
-		// Sanitize the filename to prevent path traversal
-		name := filepath.Join(dest, filepath.Base(file.Name))
-		err = CreateDirectoryIfNotExists(path.Dir(name))
-		if err != nil {
-			return err
+		destination, err := os.OpenFile(candidate, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if errors.Is(err, fs.ErrExist) {
+			continue
 		}
-
-		create, err := os.Create(name)
 		if err != nil {
-			return err
+			return "", err
 		}
-		defer create.Close()
-
-		_, err = create.ReadFrom(open)
-		if err != nil {
-			return err
+		_, err = io.Copy(destination, source)
+		if err = errors.Join(err, destination.Close()); err != nil {
+			return "", err
 		}
+		return candidate, nil
 	}
 
-	return nil
+	return "", fmt.Errorf("not copying %s, %s and %d numbered files exist already", src, dst, maxUniqueFileSuffix-1)
 }
 
 func RandomString(length int) string {
@@ -193,11 +257,13 @@ func RandomString(length int) string {
 
 func Oauth2Pkce(length int) (string, string, error) {
 	verifier := RandomString(length)
-	hasher := sha256.New()
-	_, err := hasher.Write([]byte(verifier))
-	challenge := encode(hasher.Sum(nil))
+	return verifier, Oauth2PkceChallenge(verifier), nil
+}
 
-	return verifier, challenge, err
+// Oauth2PkceChallenge returns the S256 code challenge of verifier, e.g. of a resumed OAuth2 flow.
+func Oauth2PkceChallenge(verifier string) string {
+	hash := sha256.Sum256([]byte(verifier))
+	return encode(hash[:])
 }
 
 func encode(msg []byte) string {
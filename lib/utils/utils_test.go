@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -34,3 +36,79 @@ func TestRandomString(t *testing.T) {
 		}
 	}
 }
+
+func TestStagingDirectory(t *testing.T) {
+	documentsDirectory := filepath.Join(t.TempDir(), "documents", "default")
+	stagingDirectory := filepath.Join(t.TempDir(), "staging")
+
+	tests := []struct {
+		configuredDirectory string
+		expected            string
+	}{
+		{"", filepath.Join(documentsDirectory, "_tmp")},
+		{"  ", filepath.Join(documentsDirectory, "_tmp")},
+		{stagingDirectory, filepath.Join(stagingDirectory, "buchhalter", "vault-1")},
+	}
+
+	for _, test := range tests {
+		directory, err := StagingDirectory(test.configuredDirectory, documentsDirectory, "vault-1")
+		if err != nil {
+			t.Errorf("StagingDirectory(%q) returned error: %s", test.configuredDirectory, err)
+			continue
+		}
+		if directory != test.expected {
+			t.Errorf("StagingDirectory(%q) = %s; want %s", test.configuredDirectory, directory, test.expected)
+		}
+	}
+}
+
+func TestInitSupplierDirectories(t *testing.T) {
+	documentsDirectory := filepath.Join(t.TempDir(), "documents")
+	stagingDirectory := filepath.Join(t.TempDir(), "staging")
+
+	downloadsDirectory, err := InitSupplierDirectories(stagingDirectory, "hetzner")
+	if err != nil {
+		t.Fatalf("InitSupplierDirectories() returned error: %s", err)
+	}
+	if expected := filepath.Join(stagingDirectory, "hetzner"); downloadsDirectory != expected {
+		t.Errorf("InitSupplierDirectories() = %s; want %s", downloadsDirectory, expected)
+	}
+	if info, err := os.Stat(downloadsDirectory); err != nil || !info.IsDir() {
+		t.Errorf("downloads directory %s was not created", downloadsDirectory)
+	}
+	if _, err := os.Stat(filepath.Join(downloadsDirectory, StagingMarkerFileName)); err != nil {
+		t.Errorf("downloads directory %s was not marked as created by buchhalter", downloadsDirectory)
+	}
+
+	// Nothing is created in the documents directory
+	if _, err := os.Stat(documentsDirectory); !os.IsNotExist(err) {
+		t.Errorf("documents directory %s was created by InitSupplierDirectories()", documentsDirectory)
+	}
+}
+
+func TestCopyFileUnique(t *testing.T) {
+	directory := t.TempDir()
+	src := filepath.Join(directory, "download.pdf")
+	if err := os.WriteFile(src, []byte("new invoice"), 0644); err != nil {
+		t.Fatalf("error writing file: %s", err)
+	}
+	dst := filepath.Join(directory, "invoice.pdf")
+	if err := os.WriteFile(dst, []byte("existing invoice"), 0644); err != nil {
+		t.Fatalf("error writing file: %s", err)
+	}
+
+	copied, err := CopyFileUnique(src, dst)
+	if err != nil {
+		t.Fatalf("CopyFileUnique() returned error: %s", err)
+	}
+	if expected := filepath.Join(directory, "invoice-2.pdf"); copied != expected {
+		t.Errorf("CopyFileUnique() = %s; want %s", copied, expected)
+	}
+	// The existing file is never overwritten
+	if content, _ := os.ReadFile(dst); string(content) != "existing invoice" {
+		t.Errorf("existing file was overwritten with %q", content)
+	}
+	if content, _ := os.ReadFile(copied); string(content) != "new invoice" {
+		t.Errorf("copy contains %q; want %q", content, "new invoice")
+	}
+}
@@ -42,7 +42,7 @@ func New1PasswordProvider(binary, base, tag string, logger *slog.Logger) (*Provi
 		logger:       logger,
 	}
 
-	binaryPath, err := DetermineBinary(binary)
+	binaryPath, err := DetermineBinary(binary, BINARY_NAME_1PASSWORD)
 	if err != nil {
 		return p, err
 	}
@@ -70,6 +70,18 @@ func (p *Provider1Password) initializeVaultversion() error {
 	return nil
 }
 
+func (p *Provider1Password) GetVersion() string {
+	return p.Version
+}
+
+func (p *Provider1Password) GetVaultItems() Items {
+	return p.VaultItems
+}
+
+func (p *Provider1Password) GetUrlsByItemId() map[string][]string {
+	return p.UrlsByItemId
+}
+
 func (p *Provider1Password) LoadVaultItems() (Items, error) {
 	// Build item list command
 	// #nosec G204
@@ -107,7 +119,7 @@ func (p *Provider1Password) LoadVaultItems() (Items, error) {
 	return vaultItems, nil
 }
 
-func (p Provider1Password) GetCredentialsByItemId(itemId string) (*Credentials, error) {
+func (p Provider1Password) GetCredentialsByItemId(itemId string, fields CredentialFields) (*Credentials, error) {
 	cmdArgs := p.buildVaultCommandArguments([]string{"item", "get", itemId}, true, false)
 
 	// #nosec G204
@@ -130,10 +142,20 @@ func (p Provider1Password) GetCredentialsByItemId(itemId string) (*Credentials,
 		}
 	}
 
+	username, err := getCredentialField(item, "username", fields.Username)
+	if err != nil {
+		return nil, err
+	}
+	password, err := getCredentialField(item, "password", fields.Password)
+	if err != nil {
+		return nil, err
+	}
+
 	credentials := &Credentials{
 		Id:            itemId,
-		Username:      getValueByField(item, "username"),
-		Password:      getValueByField(item, "password"),
+		Username:      username,
+		Password:      password,
+		Fields:        fields,
 		VaultProvider: p, // Store the provider instance
 	}
 
@@ -141,21 +163,9 @@ func (p Provider1Password) GetCredentialsByItemId(itemId string) (*Credentials,
 }
 
 // GetTotpForItem fetches only the TOTP for a given item ID.
-func (p Provider1Password) GetTotpForItem(itemId string) (string, error) {
-	const totpWindowSeconds = 30
-	const minValidityThresholdSeconds = 5
-	const waitBufferSeconds = 1 // Wait 1 second into the new window
-
-	now := time.Now()
-	currentWindowConsumedSeconds := now.Unix() % totpWindowSeconds
-	remainingSecondsInWindow := totpWindowSeconds - currentWindowConsumedSeconds
-
-	if remainingSecondsInWindow < minValidityThresholdSeconds {
-		waitDuration := time.Duration(remainingSecondsInWindow+waitBufferSeconds) * time.Second
-		p.logger.Info("Current TOTP window is about to expire", "remaining_seconds", remainingSecondsInWindow, "wait_duration", waitDuration.String())
-		time.Sleep(waitDuration)
-		p.logger.Info("Waited for new TOTP window, proceeding to fetch code.")
-	}
+func (p Provider1Password) GetTotpForItem(itemId string, fields CredentialFields) (string, error) {
+	// OTP fields are generated by the 1Password CLI, always for the current window
+	fields.TotpWindow.waitForCurrentWindow(p.logger)
 
 	cmdArgs := p.buildVaultCommandArguments([]string{"item", "get", itemId}, true, false)
 
@@ -179,7 +189,7 @@ func (p Provider1Password) GetTotpForItem(itemId string) (string, error) {
 		}
 	}
 
-	return getValueByField(item, "totp"), nil
+	return getTotpCode(item, fields.Totp, time.Now())
 }
 
 func (p Provider1Password) buildVaultCommandArguments(baseCmd []string, limitVault, includeTag bool) []string {
@@ -242,6 +252,9 @@ Please read "Sign in to 1Password CLI" at https://developer.1password.com/docs/c
 		} else {
 			readableError = fmt.Errorf("%w", err)
 		}
+
+	default:
+		readableError = err
 	}
 
 	return readableError
@@ -0,0 +1,281 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// PROVIDER_FILE reads the credentials from a local JSON or YAML file (`credential_provider_file` or `sync --credentials-file`).
+	// It is meant for the development of recipes and CI, the file is never uploaded.
+	PROVIDER_FILE = "file"
+
+	// maxCredentialsFileSize limits the size of the credentials file
+	maxCredentialsFileSize = 1024 * 1024
+)
+
+// FileCredentials is an entry of the credentials file.
+// `totpSecret` is the TOTP secret (base32 or `otpauth://` URI), `url` is used to match the recipes of the supplier.
+type FileCredentials struct {
+	Supplier   string `json:"supplier"`
+	Url        string `json:"url"`
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	TotpSecret string `json:"totpSecret,omitempty"`
+}
+
+// ProviderFile provides the entries of a credentials file as items.
+// The ID and title of an item is the supplier of the entry, further entries of the same supplier get the suffix `-2`, `-3`, ...
+type ProviderFile struct {
+	file    string
+	entries map[string]FileCredentials
+	ids     []string
+
+	VaultItems   Items
+	UrlsByItemId map[string][]string
+
+	logger *slog.Logger
+}
+
+// NewFileProvider reads the credentials file.
+// The file must only be accessible by the user (e.g. `chmod 600`), the errors never contain the credentials.
+func NewFileProvider(file string, logger *slog.Logger) (*ProviderFile, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	p := &ProviderFile{
+		file:         strings.TrimSpace(file),
+		entries:      make(map[string]FileCredentials),
+		UrlsByItemId: make(map[string][]string),
+		logger:       logger,
+	}
+
+	if len(p.file) == 0 {
+		return p, ProviderNotInstalledError{
+			Code: ProviderNotInstalledErrorCode,
+			Cmd:  "credential_provider_file",
+			Err:  errors.New("no credentials file configured"),
+		}
+	}
+	info, err := os.Stat(p.file)
+	if err != nil {
+		return p, ProviderNotInstalledError{
+			Code: ProviderNotInstalledErrorCode,
+			Cmd:  p.file,
+			Err:  err,
+		}
+	}
+	if err := checkCredentialsFileMode(info); err != nil {
+		return p, ProviderConnectionError{
+			Code: ProviderConnectionErrorCode,
+			Cmd:  p.file,
+			Err:  err,
+		}
+	}
+	if info.Size() > maxCredentialsFileSize {
+		return p, ProviderResponseParsingError{
+			Code: ProviderResponseParsingErrorCode,
+			Cmd:  p.file,
+			Err:  fmt.Errorf("credentials file exceeds %d bytes", maxCredentialsFileSize),
+		}
+	}
+
+	content, err := os.ReadFile(p.file)
+	if err != nil {
+		return p, ProviderNotInstalledError{
+			Code: ProviderNotInstalledErrorCode,
+			Cmd:  p.file,
+			Err:  err,
+		}
+	}
+	entries, err := parseCredentialsFile(content, strings.ToLower(filepath.Ext(p.file)))
+	if err != nil {
+		return p, ProviderResponseParsingError{
+			Code: ProviderResponseParsingErrorCode,
+			Cmd:  p.file,
+			Err:  err,
+		}
+	}
+
+	for _, entry := range entries {
+		id := entry.Supplier
+		for n := 2; ; n++ {
+			if _, exists := p.entries[id]; !exists {
+				break
+			}
+			id = fmt.Sprintf("%s-%d", entry.Supplier, n)
+		}
+		p.entries[id] = entry
+		p.ids = append(p.ids, id)
+	}
+
+	return p, nil
+}
+
+// checkCredentialsFileMode returns an error if the group or others can access the file.
+// Windows has no Unix permissions, the check is skipped.
+func checkCredentialsFileMode(info os.FileInfo) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("credentials file must only be accessible by the user (mode %04o, expected 0600, e.g. via `chmod 600`)", info.Mode().Perm())
+	}
+	return nil
+}
+
+// parseCredentialsFile parses the list of entries, YAML (extension .yaml or .yml) or JSON.
+func parseCredentialsFile(content []byte, extension string) ([]FileCredentials, error) {
+	var entries []FileCredentials
+
+	if extension == ".yaml" || extension == ".yml" {
+		// YAML is converted to JSON, so both formats share the JSON keys
+		var document interface{}
+		if err := yaml.Unmarshal(content, &document); err != nil {
+			// YAML errors can quote the content
+			return entries, errors.New("credentials file is no valid YAML")
+		}
+		converted, err := json.Marshal(document)
+		if err != nil {
+			return entries, errors.New("credentials file is no valid YAML")
+		}
+		content = converted
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(string(content)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&entries); err != nil {
+		var syntaxError *json.SyntaxError
+		if errors.As(err, &syntaxError) {
+			return entries, fmt.Errorf("credentials file is no valid JSON (at offset %d)", syntaxError.Offset)
+		}
+		var typeError *json.UnmarshalTypeError
+		if errors.As(err, &typeError) {
+			if len(typeError.Field) == 0 {
+				return entries, errors.New("credentials file must contain a list of credentials")
+			}
+			return entries, fmt.Errorf("field `%s` of the credentials file must be a string", typeError.Field)
+		}
+		return entries, fmt.Errorf("credentials file is not valid: %w", err)
+	}
+
+	for i, entry := range entries {
+		entry.Supplier = strings.TrimSpace(entry.Supplier)
+		if len(entry.Supplier) == 0 {
+			return entries, fmt.Errorf("entry %d of the credentials file has no `supplier`", i+1)
+		}
+		if len(entry.Username) == 0 && len(entry.Password) == 0 {
+			return entries, fmt.Errorf("entry %d (%s) of the credentials file has neither `username` nor `password`", i+1, entry.Supplier)
+		}
+		entries[i] = entry
+	}
+
+	return entries, nil
+}
+
+func (p *ProviderFile) GetVersion() string {
+	return PROVIDER_FILE
+}
+
+func (p *ProviderFile) GetVaultItems() Items {
+	return p.VaultItems
+}
+
+func (p *ProviderFile) GetUrlsByItemId() map[string][]string {
+	return p.UrlsByItemId
+}
+
+// LoadVaultItems returns the entries of the credentials file, in the order of the file.
+func (p *ProviderFile) LoadVaultItems() (Items, error) {
+	var vaultItems Items
+	for _, id := range p.ids {
+		entry := p.entries[id]
+		item := Item{ID: id, Title: id}
+		urls := []string{}
+		if url := strings.TrimSpace(entry.Url); len(url) > 0 {
+			item.Urls = []ItemUrl{{Label: "website", Primary: true, Href: url}}
+			urls = append(urls, url)
+		}
+		p.UrlsByItemId[id] = urls
+		vaultItems = append(vaultItems, item)
+	}
+	p.logger.Debug("Loaded credentials from file", "file", p.file, "num_items", len(vaultItems))
+
+	p.VaultItems = vaultItems
+
+	return vaultItems, nil
+}
+
+// GetCredentialsByItemId returns the credentials of an entry, the field labels are ignored.
+func (p *ProviderFile) GetCredentialsByItemId(itemId string, fields CredentialFields) (*Credentials, error) {
+	entry, ok := p.entries[itemId]
+	if !ok {
+		return nil, ProviderResponseParsingError{
+			Code: ProviderResponseParsingErrorCode,
+			Cmd:  p.file,
+			Err:  fmt.Errorf("entry %s not found", itemId),
+		}
+	}
+
+	credentials := &Credentials{
+		Id:            itemId,
+		Username:      entry.Username,
+		Password:      entry.Password,
+		Fields:        fields,
+		VaultProvider: p, // Store the provider instance
+	}
+
+	return credentials, nil
+}
+
+// GetTotpForItem generates the current TOTP code of an entry from its `totpSecret`.
+func (p *ProviderFile) GetTotpForItem(itemId string, fields CredentialFields) (string, error) {
+	entry, ok := p.entries[itemId]
+	if !ok {
+		return "", ProviderResponseParsingError{
+			Code: ProviderResponseParsingErrorCode,
+			Cmd:  p.file,
+			Err:  fmt.Errorf("entry %s not found", itemId),
+		}
+	}
+
+	secret := strings.TrimSpace(entry.TotpSecret)
+	if len(secret) == 0 {
+		return "", fmt.Errorf("entry %s of the credentials file has no `totpSecret`: %w", itemId, ErrTotpMissing)
+	}
+	code, err := fields.TotpWindow.generate(secret, p.logger)
+	if err != nil {
+		// Parsing errors of an otpauth URI quote the URI (incl. the secret)
+		return "", fmt.Errorf("error generating TOTP of entry %s: `totpSecret` is no valid TOTP secret", itemId)
+	}
+	return code, nil
+}
+
+func (p *ProviderFile) GetHumanReadableErrorMessage(err error) error {
+	var readableError error
+
+	// The concrete (developer oriented) error message is available in err
+	switch e := err.(type) {
+	case ProviderNotInstalledError:
+		readableError = fmt.Errorf("could not read credentials file `%s`. Configure its path in `credential_provider_file` or via `--credentials-file`", p.file)
+
+	case ProviderConnectionError:
+		readableError = fmt.Errorf("credentials file `%s` can't be used: %w", p.file, e.Err)
+
+	case ProviderResponseParsingError:
+		readableError = fmt.Errorf("credentials file `%s` can't be used: %w", p.file, e.Err)
+
+	default:
+		readableError = err
+	}
+
+	return readableError
+}
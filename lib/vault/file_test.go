@@ -0,0 +1,146 @@
+package vault
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+const fileTestPassword = "pa55w0rd-in-file"
+
+func writeCredentialsFile(t *testing.T, name, content string, mode os.FileMode) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(file, []byte(content), mode); err != nil {
+		t.Fatalf("error writing credentials file: %s", err)
+	}
+	if err := os.Chmod(file, mode); err != nil {
+		t.Fatalf("error changing mode of credentials file: %s", err)
+	}
+	return file
+}
+
+func TestParseCredentialsFile(t *testing.T) {
+	tests := []struct {
+		name          string
+		content       string
+		extension     string
+		expected      []FileCredentials
+		expectedError bool
+	}{
+		{"JSON", `[{"supplier": "hetzner", "url": "https://accounts.hetzner.com", "username": "jane", "password": "` + fileTestPassword + `"}]`, ".json", []FileCredentials{{Supplier: "hetzner", Url: "https://accounts.hetzner.com", Username: "jane", Password: fileTestPassword}}, false},
+		{"YAML", "- supplier: hetzner\n  username: jane\n  password: " + fileTestPassword + "\n  totpSecret: JBSWY3DPEHPK3PXP\n", ".yaml", []FileCredentials{{Supplier: "hetzner", Username: "jane", Password: fileTestPassword, TotpSecret: "JBSWY3DPEHPK3PXP"}}, false},
+		{"empty list", `[]`, ".json", []FileCredentials{}, false},
+		{"no list", `{"supplier": "hetzner", "password": "` + fileTestPassword + `"}`, ".json", nil, true},
+		{"no supplier", `[{"username": "jane", "password": "` + fileTestPassword + `"}]`, ".json", nil, true},
+		{"no credentials", `[{"supplier": "hetzner"}]`, ".json", nil, true},
+		{"unknown field", `[{"supplier": "hetzner", "pasword": "` + fileTestPassword + `"}]`, ".json", nil, true},
+		{"invalid JSON", `[{"supplier": "hetzner", "password": "` + fileTestPassword + `"`, ".json", nil, true},
+		{"password is no string", `[{"supplier": "hetzner", "password": 4711}]`, ".json", nil, true},
+		{"invalid YAML", "- supplier: hetzner\n  password: [" + fileTestPassword + "\n", ".yml", nil, true},
+	}
+
+	for _, test := range tests {
+		entries, err := parseCredentialsFile([]byte(test.content), test.extension)
+		if (err != nil) != test.expectedError {
+			t.Errorf("%s: parseCredentialsFile() returned error %v; want error %t", test.name, err, test.expectedError)
+		}
+		if err != nil && strings.Contains(err.Error(), fileTestPassword) {
+			t.Errorf("%s: parseCredentialsFile() error %q contains the password", test.name, err)
+		}
+		if test.expectedError {
+			continue
+		}
+		if len(entries) != len(test.expected) {
+			t.Errorf("%s: parseCredentialsFile() = %+v; want %+v", test.name, entries, test.expected)
+			continue
+		}
+		for i := range entries {
+			if entries[i] != test.expected[i] {
+				t.Errorf("%s: parseCredentialsFile()[%d] = %+v; want %+v", test.name, i, entries[i], test.expected[i])
+			}
+		}
+	}
+}
+
+func TestNewFileProviderChecksMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no Unix permissions on Windows")
+	}
+	content := `[{"supplier": "hetzner", "password": "` + fileTestPassword + `"}]`
+
+	tests := []struct {
+		mode          os.FileMode
+		expectedError bool
+	}{
+		{0600, false},
+		{0400, false},
+		{0640, true},
+		{0644, true},
+		{0606, true},
+	}
+
+	for _, test := range tests {
+		file := writeCredentialsFile(t, "credentials.json", content, test.mode)
+		_, err := NewFileProvider(file, slog.Default())
+		if (err != nil) != test.expectedError {
+			t.Errorf("NewFileProvider() of mode %04o returned error %v; want error %t", test.mode, err, test.expectedError)
+		}
+	}
+}
+
+func TestFileProvider(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	content := `[
+  {"supplier": "hetzner", "url": "https://accounts.hetzner.com", "username": "jane", "password": "` + fileTestPassword + `", "totpSecret": "JBSWY3DPEHPK3PXP"},
+  {"supplier": "hetzner", "username": "john", "password": "` + fileTestPassword + `"}
+]`
+	file := writeCredentialsFile(t, "credentials.json", content, 0600)
+	p, err := NewFileProvider(file, logger)
+	if err != nil {
+		t.Fatalf("NewFileProvider() returned error: %s", err)
+	}
+
+	items, err := p.LoadVaultItems()
+	if err != nil {
+		t.Fatalf("LoadVaultItems() returned error: %s", err)
+	}
+	if len(items) != 2 || items[0].ID != "hetzner" || items[1].ID != "hetzner-2" {
+		t.Fatalf("LoadVaultItems() = %v; want the items hetzner and hetzner-2", items)
+	}
+	if urls := p.GetUrlsByItemId()["hetzner"]; len(urls) != 1 || urls[0] != "https://accounts.hetzner.com" {
+		t.Errorf("GetUrlsByItemId()[hetzner] = %v; want the url of the entry", urls)
+	}
+
+	credentials, err := p.GetCredentialsByItemId("hetzner-2", CredentialFields{})
+	if err != nil {
+		t.Fatalf("GetCredentialsByItemId() returned error: %s", err)
+	}
+	if credentials.Username != "john" || credentials.Password != fileTestPassword {
+		t.Errorf("GetCredentialsByItemId() = %s/%s; want the credentials of the second entry", credentials.Username, credentials.Password)
+	}
+	if _, err := p.GetCredentialsByItemId("unknown", CredentialFields{}); err == nil {
+		t.Errorf("GetCredentialsByItemId() of an unknown entry returned no error")
+	}
+
+	code, err := p.GetTotpForItem("hetzner", CredentialFields{TotpWindow: TotpWindow{AcceptsAdjacent: true}})
+	if err != nil {
+		t.Fatalf("GetTotpForItem() returned error: %s", err)
+	}
+	if len(code) != 6 {
+		t.Errorf("GetTotpForItem() = %q; want a 6 digit code", code)
+	}
+	if _, err := p.GetTotpForItem("hetzner-2", CredentialFields{}); err == nil {
+		t.Errorf("GetTotpForItem() of an entry without totpSecret returned no error")
+	}
+
+	if strings.Contains(logs.String(), fileTestPassword) {
+		t.Errorf("logs contain the password: %s", logs.String())
+	}
+}
@@ -0,0 +1,390 @@
+package vault
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/tobischo/gokeepasslib/v3"
+)
+
+const (
+	PROVIDER_KEEPASS = "keepass"
+)
+
+// keePassTotpFields are the fields of an entry that contain the TOTP secret, in order of preference:
+// `otp` (KeePassXC, an `otpauth://` URI) and `TOTP Seed` (KeePass 2 TOTP plugins, base32).
+var keePassTotpFields = []string{"otp", "totp seed"}
+
+// KeePassConfig is the configuration of the KeePass database.
+// The passphrase is never part of the configuration file, it is prompted (or read from the environment) on each run.
+type KeePassConfig struct {
+	// File is the path of the .kdbx database
+	File string
+	// KeyFile is the optional path of a key file
+	KeyFile string
+	// Password is the passphrase of the database, may be empty if a key file is used
+	Password string
+}
+
+// ProviderKeePass reads credentials from a local KeePass database (.kdbx, e.g. of KeePassXC).
+//
+// The database is decrypted once, when the provider is initialized.
+// Every entry in the configured group (base, incl. its subgroups) with the configured tag is an item.
+// The URL of an entry and additional URLs (`KP2A_URL*` fields) are used to match the suppliers.
+type ProviderKeePass struct {
+	file  string
+	group string
+	tag   string
+
+	Version    string
+	VaultItems Items
+
+	UrlsByItemId map[string][]string
+
+	entries map[string]keePassEntry
+	logger  *slog.Logger
+}
+
+// keePassEntry is a decrypted entry of the database.
+type keePassEntry struct {
+	Title string
+	// Group is the path of the entry's group, without the root group
+	Group []string
+	Tags  []string
+	Urls  []string
+	// Fields are all string fields of the entry (with lower case keys), incl. `username` and `password`
+	Fields map[string]string
+}
+
+func NewKeePassProvider(config KeePassConfig, base, tag string, logger *slog.Logger) (*ProviderKeePass, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	p := &ProviderKeePass{
+		file:         strings.TrimSpace(config.File),
+		group:        strings.Trim(base, "/"),
+		tag:          tag,
+		UrlsByItemId: make(map[string][]string),
+		entries:      make(map[string]keePassEntry),
+		logger:       logger,
+	}
+
+	if len(p.file) == 0 {
+		return p, ProviderNotInstalledError{
+			Code: ProviderNotInstalledErrorCode,
+			Cmd:  "credential_provider_keepass_file",
+			Err:  errors.New("no KeePass database configured"),
+		}
+	}
+	file, err := filepath.Abs(p.file)
+	if err != nil {
+		return p, ProviderNotInstalledError{
+			Code: ProviderNotInstalledErrorCode,
+			Cmd:  p.file,
+			Err:  err,
+		}
+	}
+	p.file = file
+
+	credentials, err := keePassCredentials(config)
+	if err != nil {
+		return p, ProviderConnectionError{
+			Code: ProviderConnectionErrorCode,
+			Cmd:  config.KeyFile,
+			Err:  err,
+		}
+	}
+
+	database, err := os.Open(p.file)
+	if err != nil {
+		return p, ProviderNotInstalledError{
+			Code: ProviderNotInstalledErrorCode,
+			Cmd:  p.file,
+			Err:  err,
+		}
+	}
+	defer database.Close()
+
+	db := gokeepasslib.NewDatabase()
+	db.Credentials = credentials
+	if err := gokeepasslib.NewDecoder(database).Decode(db); err != nil {
+		return p, ProviderConnectionError{
+			Code: ProviderConnectionErrorCode,
+			Cmd:  p.file,
+			Err:  err,
+		}
+	}
+	if err := db.UnlockProtectedEntries(); err != nil {
+		return p, ProviderResponseParsingError{
+			Code: ProviderResponseParsingErrorCode,
+			Cmd:  p.file,
+			Err:  err,
+		}
+	}
+	p.Version = fmt.Sprintf("KDBX %d.%d", db.Header.Signature.MajorVersion, db.Header.Signature.MinorVersion)
+
+	if db.Content != nil && db.Content.Root != nil {
+		var recycleBin gokeepasslib.UUID
+		if db.Content.Meta != nil && db.Content.Meta.RecycleBinEnabled.Bool {
+			recycleBin = db.Content.Meta.RecycleBinUUID
+		}
+		for _, rootGroup := range db.Content.Root.Groups {
+			// The root group is not part of the group path
+			p.addEntries(rootGroup, []string{}, recycleBin)
+		}
+	}
+
+	return p, nil
+}
+
+// keePassCredentials returns the composite key of the passphrase and the key file.
+func keePassCredentials(config KeePassConfig) (*gokeepasslib.DBCredentials, error) {
+	keyFile := strings.TrimSpace(config.KeyFile)
+	switch {
+	case len(keyFile) > 0 && len(config.Password) > 0:
+		return gokeepasslib.NewPasswordAndKeyCredentials(config.Password, keyFile)
+	case len(keyFile) > 0:
+		return gokeepasslib.NewKeyCredentials(keyFile)
+	default:
+		return gokeepasslib.NewPasswordCredentials(config.Password), nil
+	}
+}
+
+// addEntries adds the entries of group and its subgroups, path is the group path of the entries.
+// Deleted entries (in the recycle bin) are skipped.
+func (p *ProviderKeePass) addEntries(group gokeepasslib.Group, path []string, recycleBin gokeepasslib.UUID) {
+	for _, entry := range group.Entries {
+		id := hex.EncodeToString(entry.UUID[:])
+		p.entries[id] = newKeePassEntry(entry, path)
+	}
+	for _, subgroup := range group.Groups {
+		if subgroup.UUID == recycleBin {
+			continue
+		}
+		p.addEntries(subgroup, append(append([]string{}, path...), subgroup.Name), recycleBin)
+	}
+}
+
+func newKeePassEntry(entry gokeepasslib.Entry, group []string) keePassEntry {
+	e := keePassEntry{
+		Title:  entry.GetTitle(),
+		Group:  group,
+		Fields: map[string]string{},
+	}
+	for _, tag := range strings.FieldsFunc(entry.Tags, func(r rune) bool { return r == ';' || r == ',' }) {
+		if tag = strings.TrimSpace(tag); len(tag) > 0 {
+			e.Tags = append(e.Tags, tag)
+		}
+	}
+	for _, value := range entry.Values {
+		key := strings.ToLower(value.Key)
+		e.Fields[key] = value.Value.Content
+		if key == "url" && len(value.Value.Content) > 0 {
+			e.Urls = append([]string{value.Value.Content}, e.Urls...)
+		}
+		// Additional URLs of KeePassXC and Keepass2Android
+		if strings.HasPrefix(key, "kp2a_url") && len(value.Value.Content) > 0 {
+			e.Urls = append(e.Urls, value.Value.Content)
+		}
+	}
+
+	return e
+}
+
+// inGroup returns true if the entry is in the group with the slash separated path (or one of its subgroups).
+func (e keePassEntry) inGroup(group string) bool {
+	if len(group) == 0 {
+		return true
+	}
+	segments := strings.Split(group, "/")
+	if len(segments) > len(e.Group) {
+		return false
+	}
+	for i, segment := range segments {
+		if !strings.EqualFold(segment, e.Group[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e keePassEntry) hasTag(tag string) bool {
+	if len(tag) == 0 {
+		return true
+	}
+	for _, entryTag := range e.Tags {
+		if strings.EqualFold(entryTag, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// credentials returns the username and password of the entry, read from the fields labeled in fields.
+// An entry without a labeled field is an error.
+func (e keePassEntry) credentials(fields CredentialFields) (string, string, error) {
+	username, password := e.Fields["username"], e.Fields["password"]
+	var ok bool
+	if len(fields.Username) > 0 {
+		if username, ok = e.Fields[strings.ToLower(fields.Username)]; !ok {
+			return "", "", credentialFieldMissingError(fields.Username)
+		}
+	}
+	if len(fields.Password) > 0 {
+		if password, ok = e.Fields[strings.ToLower(fields.Password)]; !ok {
+			return "", "", credentialFieldMissingError(fields.Password)
+		}
+	}
+	return username, password, nil
+}
+
+func (p *ProviderKeePass) GetVersion() string {
+	return p.Version
+}
+
+func (p *ProviderKeePass) GetVaultItems() Items {
+	return p.VaultItems
+}
+
+func (p *ProviderKeePass) GetUrlsByItemId() map[string][]string {
+	return p.UrlsByItemId
+}
+
+// GetVaults returns the groups with entries (and their parent groups) as slash separated paths to use as base.
+func (p *ProviderKeePass) GetVaults() ([]Vault, error) {
+	groups := map[string]bool{}
+	for _, entry := range p.entries {
+		for i := range entry.Group {
+			groups[strings.Join(entry.Group[:i+1], "/")] = true
+		}
+	}
+	paths := make([]string, 0, len(groups))
+	for group := range groups {
+		paths = append(paths, group)
+	}
+	sort.Strings(paths)
+
+	vaults := make([]Vault, 0, len(paths))
+	for _, path := range paths {
+		vaults = append(vaults, Vault{ID: vaultIdFromPath(PROVIDER_KEEPASS, path), Name: path})
+	}
+
+	return vaults, nil
+}
+
+// LoadVaultItems returns the entries of the configured group with the configured tag.
+func (p *ProviderKeePass) LoadVaultItems() (Items, error) {
+	ids := make([]string, 0, len(p.entries))
+	for id := range p.entries {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var vaultItems Items
+	for _, id := range ids {
+		entry := p.entries[id]
+		if !entry.inGroup(p.group) || !entry.hasTag(p.tag) {
+			continue
+		}
+
+		item := Item{
+			ID:    id,
+			Title: entry.Title,
+			Tags:  entry.Tags,
+			Vault: Vault{ID: p.group, Name: p.group},
+		}
+		for i, url := range entry.Urls {
+			item.Urls = append(item.Urls, ItemUrl{Label: "website", Primary: i == 0, Href: url})
+		}
+		p.UrlsByItemId[id] = entry.Urls
+		vaultItems = append(vaultItems, item)
+	}
+	p.logger.Debug("Loaded items from KeePass database", "file", p.file, "group", p.group, "tag", p.tag, "num_items", len(vaultItems))
+
+	p.VaultItems = vaultItems
+
+	return vaultItems, nil
+}
+
+func (p *ProviderKeePass) GetCredentialsByItemId(itemId string, fields CredentialFields) (*Credentials, error) {
+	entry, ok := p.entries[itemId]
+	if !ok {
+		return nil, ProviderResponseParsingError{
+			Code: ProviderResponseParsingErrorCode,
+			Cmd:  p.file,
+			Err:  fmt.Errorf("entry %s not found", itemId),
+		}
+	}
+	username, password, err := entry.credentials(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials := &Credentials{
+		Id:            itemId,
+		Username:      username,
+		Password:      password,
+		Fields:        fields,
+		VaultProvider: p, // Store the provider instance
+	}
+
+	return credentials, nil
+}
+
+// GetTotpForItem generates the current TOTP code of an entry from its TOTP secret.
+// The secret is read from the field labeled in fields, the `otp` field (KeePassXC) or the `TOTP Seed` field.
+func (p *ProviderKeePass) GetTotpForItem(itemId string, fields CredentialFields) (string, error) {
+	entry, ok := p.entries[itemId]
+	if !ok {
+		return "", ProviderResponseParsingError{
+			Code: ProviderResponseParsingErrorCode,
+			Cmd:  p.file,
+			Err:  fmt.Errorf("entry %s not found", itemId),
+		}
+	}
+
+	totpFields := keePassTotpFields
+	if len(fields.Totp) > 0 {
+		totpFields = []string{strings.ToLower(fields.Totp)}
+		if _, ok := entry.Fields[totpFields[0]]; !ok {
+			return "", credentialFieldMissingError(fields.Totp)
+		}
+	}
+	for _, field := range totpFields {
+		secret := strings.TrimSpace(entry.Fields[field])
+		if len(secret) == 0 {
+			continue
+		}
+		code, err := fields.TotpWindow.generate(secret, p.logger)
+		if err != nil {
+			return "", fmt.Errorf("error generating TOTP of entry %s: %w", itemId, err)
+		}
+		return code, nil
+	}
+
+	return "", fmt.Errorf("entry %s has no TOTP secret (field %s): %w", itemId, strings.Join(totpFields, ", "), ErrTotpMissing)
+}
+
+func (p *ProviderKeePass) GetHumanReadableErrorMessage(err error) error {
+	var readableError error
+
+	// The concrete (developer oriented) error message is available in err
+	switch err.(type) {
+	case ProviderNotInstalledError:
+		readableError = fmt.Errorf("could not open KeePass database `%s`. Configure the path of your .kdbx file in `credential_provider_keepass_file`", p.file)
+
+	case ProviderConnectionError:
+		readableError = fmt.Errorf("could not decrypt KeePass database `%s`. Check the passphrase and the key file", p.file)
+
+	default:
+		readableError = err
+	}
+
+	return readableError
+}
@@ -0,0 +1,263 @@
+package vault
+
+import (
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tobischo/gokeepasslib/v3"
+	w "github.com/tobischo/gokeepasslib/v3/wrappers"
+)
+
+const keePassTestPassword = "correct horse battery staple"
+
+func newKeePassTestEntry(tags string, values map[string]string) gokeepasslib.Entry {
+	entry := gokeepasslib.NewEntry()
+	entry.Tags = tags
+	for key, value := range values {
+		entry.Values = append(entry.Values, gokeepasslib.ValueData{
+			Key:   key,
+			Value: gokeepasslib.V{Content: value, Protected: w.NewBoolWrapper(key == "Password")},
+		})
+	}
+	return entry
+}
+
+// writeKeePassTestDatabase writes a database with entries in the root group, a `buchhalter` group and the recycle bin.
+// It returns the path of the database and the IDs of the entries by title.
+func writeKeePassTestDatabase(t *testing.T) (string, map[string]string) {
+	t.Helper()
+
+	hetzner := newKeePassTestEntry("buchhalter-ai", map[string]string{
+		"Title":    "Hetzner",
+		"UserName": "jane@example.com",
+		"Password": "s3cr3t",
+		"URL":      "https://accounts.hetzner.com/login",
+		"KP2A_URL": "https://console.hetzner.cloud",
+		"otp":      "otpauth://totp/Hetzner:jane?secret=JBSWY3DPEHPK3PXP",
+	})
+	aws := newKeePassTestEntry("finance; buchhalter-ai", map[string]string{
+		"Title":        "AWS",
+		"UserName":     "jane",
+		"Password":     "aws-s3cr3t",
+		"URL":          "https://signin.aws.amazon.com",
+		"Kundennummer": "4711",
+		"TOTP Seed":    "JBSWY3DPEHPK3PXP",
+	})
+	untagged := newKeePassTestEntry("", map[string]string{"Title": "Untagged", "URL": "https://example.com"})
+	private := newKeePassTestEntry("buchhalter-ai", map[string]string{"Title": "Private", "URL": "https://private.example.com"})
+	deleted := newKeePassTestEntry("buchhalter-ai", map[string]string{"Title": "Deleted", "URL": "https://deleted.example.com"})
+
+	buchhalterGroup := gokeepasslib.NewGroup()
+	buchhalterGroup.Name = "buchhalter"
+	buchhalterGroup.Entries = []gokeepasslib.Entry{hetzner, aws, untagged}
+	recycleBin := gokeepasslib.NewGroup()
+	recycleBin.Name = "Recycle Bin"
+	recycleBin.Entries = []gokeepasslib.Entry{deleted}
+	rootGroup := gokeepasslib.NewGroup()
+	rootGroup.Name = "Passwords"
+	rootGroup.Entries = []gokeepasslib.Entry{private}
+	rootGroup.Groups = []gokeepasslib.Group{buchhalterGroup, recycleBin}
+
+	meta := gokeepasslib.NewMetaData()
+	meta.RecycleBinEnabled = w.NewBoolWrapper(true)
+	meta.RecycleBinUUID = recycleBin.UUID
+
+	db := &gokeepasslib.Database{
+		Header:      gokeepasslib.NewHeader(),
+		Credentials: gokeepasslib.NewPasswordCredentials(keePassTestPassword),
+		Content: &gokeepasslib.DBContent{
+			Meta: meta,
+			Root: &gokeepasslib.RootData{Groups: []gokeepasslib.Group{rootGroup}},
+		},
+	}
+	if err := db.LockProtectedEntries(); err != nil {
+		t.Fatalf("Error locking test database: %s", err)
+	}
+
+	file := filepath.Join(t.TempDir(), "buchhalter.kdbx")
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatalf("Error creating test database: %s", err)
+	}
+	defer f.Close()
+	if err := gokeepasslib.NewEncoder(f).Encode(db); err != nil {
+		t.Fatalf("Error writing test database: %s", err)
+	}
+
+	ids := map[string]string{}
+	for _, entry := range []gokeepasslib.Entry{hetzner, aws, untagged, private, deleted} {
+		ids[entry.GetTitle()] = hex.EncodeToString(entry.UUID[:])
+	}
+	return file, ids
+}
+
+func TestKeePassProviderLoadVaultItems(t *testing.T) {
+	file, ids := writeKeePassTestDatabase(t)
+
+	tests := []struct {
+		name     string
+		base     string
+		tag      string
+		expected []string
+	}{
+		{"group and tag", "buchhalter", "buchhalter-ai", []string{"AWS", "Hetzner"}},
+		{"group only", "buchhalter", "", []string{"AWS", "Hetzner", "Untagged"}},
+		{"tag only", "", "buchhalter-ai", []string{"AWS", "Hetzner", "Private"}},
+		{"other tag", "", "finance", []string{"AWS"}},
+		{"unknown group", "other", "", []string{}},
+	}
+
+	for _, test := range tests {
+		p, err := NewKeePassProvider(KeePassConfig{File: file, Password: keePassTestPassword}, test.base, test.tag, slog.Default())
+		if err != nil {
+			t.Fatalf("%s: NewKeePassProvider() returned error: %s", test.name, err)
+		}
+		items, err := p.LoadVaultItems()
+		if err != nil {
+			t.Fatalf("%s: LoadVaultItems() returned error: %s", test.name, err)
+		}
+
+		titles := map[string]bool{}
+		for _, item := range items {
+			titles[item.Title] = true
+		}
+		expected := map[string]bool{}
+		for _, title := range test.expected {
+			expected[title] = true
+		}
+		if !reflect.DeepEqual(titles, expected) {
+			t.Errorf("%s: LoadVaultItems() = %v; want %v", test.name, titles, expected)
+		}
+	}
+
+	p, err := NewKeePassProvider(KeePassConfig{File: file, Password: keePassTestPassword}, "buchhalter", "", slog.Default())
+	if err != nil {
+		t.Fatalf("NewKeePassProvider() returned error: %s", err)
+	}
+	if _, err := p.LoadVaultItems(); err != nil {
+		t.Fatalf("LoadVaultItems() returned error: %s", err)
+	}
+	expectedUrls := []string{"https://accounts.hetzner.com/login", "https://console.hetzner.cloud"}
+	if urls := p.GetUrlsByItemId()[ids["Hetzner"]]; !reflect.DeepEqual(urls, expectedUrls) {
+		t.Errorf("GetUrlsByItemId()[Hetzner] = %v; want %v", urls, expectedUrls)
+	}
+	if p.GetVersion() == "" {
+		t.Errorf("GetVersion() is empty; want the KDBX version")
+	}
+}
+
+func TestKeePassProviderGetVaults(t *testing.T) {
+	file, _ := writeKeePassTestDatabase(t)
+	p, err := NewKeePassProvider(KeePassConfig{File: file, Password: keePassTestPassword}, "", "", slog.Default())
+	if err != nil {
+		t.Fatalf("NewKeePassProvider() returned error: %s", err)
+	}
+
+	// Entries of the root group and the recycle bin are no vault
+	vaults, err := p.GetVaults()
+	if err != nil {
+		t.Fatalf("GetVaults() returned error: %s", err)
+	}
+	expected := []Vault{{ID: "keepass-buchhalter", Name: "buchhalter"}}
+	if !reflect.DeepEqual(vaults, expected) {
+		t.Errorf("GetVaults() = %+v; want %+v", vaults, expected)
+	}
+}
+
+func TestKeePassProviderCredentials(t *testing.T) {
+	file, ids := writeKeePassTestDatabase(t)
+	p, err := NewKeePassProvider(KeePassConfig{File: file, Password: keePassTestPassword}, "buchhalter", "", slog.Default())
+	if err != nil {
+		t.Fatalf("NewKeePassProvider() returned error: %s", err)
+	}
+
+	tests := []struct {
+		title            string
+		fields           CredentialFields
+		expectedUsername string
+		expectedPassword string
+	}{
+		{"Hetzner", CredentialFields{}, "jane@example.com", "s3cr3t"},
+		{"AWS", CredentialFields{}, "jane", "aws-s3cr3t"},
+		{"AWS", CredentialFields{Username: "kundennummer"}, "4711", "aws-s3cr3t"},
+	}
+	for _, test := range tests {
+		credentials, err := p.GetCredentialsByItemId(ids[test.title], test.fields)
+		if err != nil {
+			t.Fatalf("GetCredentialsByItemId(%s) returned error: %s", test.title, err)
+		}
+		if credentials.Username != test.expectedUsername || credentials.Password != test.expectedPassword {
+			t.Errorf("GetCredentialsByItemId(%s, %+v) = %s, %s; want %s, %s", test.title, test.fields, credentials.Username, credentials.Password, test.expectedUsername, test.expectedPassword)
+		}
+	}
+
+	expectedTotp, err := GenerateTotp("JBSWY3DPEHPK3PXP", time.Now())
+	if err != nil {
+		t.Fatalf("GenerateTotp() returned error: %s", err)
+	}
+	for _, title := range []string{"Hetzner", "AWS"} {
+		totp, err := p.GetTotpForItem(ids[title], CredentialFields{})
+		if err != nil {
+			t.Fatalf("GetTotpForItem(%s) returned error: %s", title, err)
+		}
+		// The code may change between both calls
+		if len(totp) != 6 || (totp != expectedTotp && time.Now().Unix()%30 > 1) {
+			t.Errorf("GetTotpForItem(%s) = %s; want %s", title, totp, expectedTotp)
+		}
+	}
+	if _, err := p.GetTotpForItem(ids["Untagged"], CredentialFields{}); err == nil {
+		t.Errorf("GetTotpForItem(Untagged) returned no error; want an error for a missing TOTP secret")
+	}
+	if _, err := p.GetCredentialsByItemId("unknown", CredentialFields{}); err == nil {
+		t.Errorf("GetCredentialsByItemId(unknown) returned no error; want an error")
+	}
+	// A field labeled by the recipe must exist in the entry
+	if _, err := p.GetCredentialsByItemId(ids["AWS"], CredentialFields{Password: "PIN"}); !errors.Is(err, ErrCredentialFieldMissing) {
+		t.Errorf("GetCredentialsByItemId(AWS) with a missing field error = %v; want %v", err, ErrCredentialFieldMissing)
+	}
+	if _, err := p.GetTotpForItem(ids["AWS"], CredentialFields{Totp: "Portal TOTP"}); !errors.Is(err, ErrCredentialFieldMissing) {
+		t.Errorf("GetTotpForItem(AWS) with a missing field error = %v; want %v", err, ErrCredentialFieldMissing)
+	}
+}
+
+func TestKeePassProviderErrors(t *testing.T) {
+	file, _ := writeKeePassTestDatabase(t)
+
+	tests := []struct {
+		name   string
+		config KeePassConfig
+		// expectedConnectionError is true for a ProviderConnectionError, otherwise a ProviderNotInstalledError is expected
+		expectedConnectionError bool
+	}{
+		{"no database configured", KeePassConfig{}, false},
+		{"missing database", KeePassConfig{File: filepath.Join(t.TempDir(), "missing.kdbx"), Password: keePassTestPassword}, false},
+		{"wrong passphrase", KeePassConfig{File: file, Password: "wrong"}, true},
+	}
+
+	for _, test := range tests {
+		p, err := NewKeePassProvider(test.config, "", "", slog.Default())
+		if err == nil {
+			t.Fatalf("%s: NewKeePassProvider() returned no error", test.name)
+		}
+		var connectionError ProviderConnectionError
+		var notInstalledError ProviderNotInstalledError
+		if test.expectedConnectionError && !errors.As(err, &connectionError) {
+			t.Errorf("%s: NewKeePassProvider() error = %T; want ProviderConnectionError", test.name, err)
+		}
+		if !test.expectedConnectionError && !errors.As(err, &notInstalledError) {
+			t.Errorf("%s: NewKeePassProvider() error = %T; want ProviderNotInstalledError", test.name, err)
+		}
+		// The passphrase is never part of the error messages
+		readable := p.GetHumanReadableErrorMessage(err)
+		if strings.Contains(readable.Error(), keePassTestPassword) || strings.Contains(err.Error(), keePassTestPassword) {
+			t.Errorf("%s: error messages %q / %q contain the passphrase", test.name, err, readable)
+		}
+	}
+}
@@ -0,0 +1,382 @@
+package vault
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	PROVIDER_PASS = "pass"
+
+	BINARY_NAME_PASS = "pass"
+)
+
+// passFieldAliases maps the keys of `key: value` lines in a pass entry to the credential fields.
+var passFieldAliases = map[string]string{
+	"username": "username",
+	"user":     "username",
+	"login":    "username",
+	"email":    "username",
+	"password": "password",
+	"url":      "url",
+	"website":  "url",
+	"totp":     "totp",
+}
+
+// ProviderPass reads credentials from the standard Unix password manager `pass` (or the compatible `gopass`).
+//
+// Every entry below the configured subtree (base) of the password store is an item.
+// Entries follow the pass conventions: The first line is the password, further lines are `key: value` pairs
+// (e.g. `username: ...`, `url: ...`). A line starting with `otpauth://` is used for TOTP codes (via the pass-otp extension).
+type ProviderPass struct {
+	binary         string
+	base           string
+	storeDirectory string
+
+	Version    string
+	VaultItems Items
+
+	UrlsByItemId map[string][]string
+
+	logger *slog.Logger
+}
+
+// passEntry is a parsed entry of the password store.
+type passEntry struct {
+	Username string
+	Password string
+	Urls     []string
+	Totp     string
+	// HasOtpAuth is true if the entry contains an `otpauth://` line
+	HasOtpAuth bool
+	// Fields are all `key: value` lines of the entry (with lower case keys)
+	Fields map[string]string
+}
+
+func NewPassProvider(binary, base string, logger *slog.Logger) (*ProviderPass, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	p := &ProviderPass{
+		base:         strings.Trim(base, "/"),
+		UrlsByItemId: make(map[string][]string),
+		logger:       logger,
+	}
+
+	// Same lookup as the pass script itself
+	p.storeDirectory = os.Getenv("PASSWORD_STORE_DIR")
+	if len(p.storeDirectory) == 0 {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return p, ProviderNotInstalledError{
+				Code: ProviderNotInstalledErrorCode,
+				Cmd:  "~/.password-store",
+				Err:  err,
+			}
+		}
+		p.storeDirectory = filepath.Join(homeDir, ".password-store")
+	}
+
+	binaryPath, err := DetermineBinary(binary, BINARY_NAME_PASS)
+	if err != nil {
+		return p, err
+	}
+	p.binary = binaryPath
+
+	// #nosec G204
+	cmdArgs := []string{"version"}
+	version, err := exec.Command(p.binary, cmdArgs...).Output()
+	if err != nil {
+		return p, ProviderNotInstalledError{
+			Code: ProviderNotInstalledErrorCode,
+			Cmd:  fmt.Sprintf("%s %s", p.binary, strings.Join(cmdArgs, " ")),
+			Err:  err,
+		}
+	}
+	p.Version = parsePassVersion(string(version))
+
+	return p, nil
+}
+
+func (p *ProviderPass) GetVersion() string {
+	return p.Version
+}
+
+func (p *ProviderPass) GetVaultItems() Items {
+	return p.VaultItems
+}
+
+func (p *ProviderPass) GetUrlsByItemId() map[string][]string {
+	return p.UrlsByItemId
+}
+
+// GetVaults returns the top level directories of the password store, each is a subtree to use as base.
+func (p *ProviderPass) GetVaults() ([]Vault, error) {
+	entries, err := os.ReadDir(p.storeDirectory)
+	if err != nil {
+		return nil, ProviderConnectionError{
+			Code: ProviderConnectionErrorCode,
+			Cmd:  p.storeDirectory,
+			Err:  err,
+		}
+	}
+
+	vaults := []Vault{}
+	for _, entry := range entries {
+		// Skip hidden directories like .git or .extensions
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		vaults = append(vaults, Vault{ID: vaultIdFromPath(PROVIDER_PASS, entry.Name()), Name: entry.Name()})
+	}
+
+	return vaults, nil
+}
+
+// LoadVaultItems reads all entries below the configured subtree.
+// Every entry is decrypted once to read its urls. The passwords are not kept in memory.
+func (p *ProviderPass) LoadVaultItems() (Items, error) {
+	searchDirectory := filepath.Join(p.storeDirectory, filepath.FromSlash(p.base))
+	itemIds := []string{}
+	err := filepath.WalkDir(searchDirectory, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// Skip hidden directories like .git or .extensions
+		if d.IsDir() && path != searchDirectory && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || filepath.Ext(d.Name()) != ".gpg" {
+			return nil
+		}
+
+		relativePath, err := filepath.Rel(p.storeDirectory, path)
+		if err != nil {
+			return err
+		}
+		itemIds = append(itemIds, strings.TrimSuffix(filepath.ToSlash(relativePath), ".gpg"))
+		return nil
+	})
+	if err != nil {
+		return nil, ProviderConnectionError{
+			Code: ProviderConnectionErrorCode,
+			Cmd:  searchDirectory,
+			Err:  err,
+		}
+	}
+
+	var vaultItems Items
+	for _, itemId := range itemIds {
+		entry, err := p.showEntry(itemId)
+		if err != nil {
+			return nil, err
+		}
+
+		item := Item{
+			ID:    itemId,
+			Title: filepath.Base(itemId),
+			Vault: Vault{ID: p.base, Name: p.base},
+		}
+		for i, url := range entry.Urls {
+			item.Urls = append(item.Urls, ItemUrl{Label: "website", Primary: i == 0, Href: url})
+		}
+		p.UrlsByItemId[itemId] = entry.Urls
+		vaultItems = append(vaultItems, item)
+	}
+	p.logger.Debug("Loaded items from password store", "store_directory", p.storeDirectory, "base", p.base, "num_items", len(vaultItems))
+
+	p.VaultItems = vaultItems
+
+	return vaultItems, nil
+}
+
+func (p ProviderPass) GetCredentialsByItemId(itemId string, fields CredentialFields) (*Credentials, error) {
+	entry, err := p.showEntry(itemId)
+	if err != nil {
+		return nil, err
+	}
+	entry, err = entry.withCredentialFields(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials := &Credentials{
+		Id:            itemId,
+		Username:      entry.Username,
+		Password:      entry.Password,
+		Fields:        fields,
+		VaultProvider: p, // Store the provider instance
+	}
+
+	return credentials, nil
+}
+
+// GetTotpForItem returns the current TOTP code of an entry.
+// The code is generated by the pass-otp extension (`pass otp`) based on the `otpauth://` line of the entry.
+// A `totp` field (or the field labeled in fields) with the TOTP secret is preferred, the code is generated locally from it.
+func (p ProviderPass) GetTotpForItem(itemId string, fields CredentialFields) (string, error) {
+	entry, err := p.showEntry(itemId)
+	if err != nil {
+		return "", err
+	}
+	entry, err = entry.withCredentialFields(fields)
+	if err != nil {
+		return "", err
+	}
+
+	if len(entry.Totp) > 0 {
+		code, err := fields.TotpWindow.generate(entry.Totp, p.logger)
+		if err != nil {
+			return "", fmt.Errorf("error generating TOTP of entry %s: %w", itemId, err)
+		}
+		return code, nil
+	}
+	if !entry.HasOtpAuth {
+		return "", fmt.Errorf("entry %s has neither a `totp` field nor an `otpauth://` line: %w", itemId, ErrTotpMissing)
+	}
+
+	fields.TotpWindow.waitForCurrentWindow(p.logger)
+	// #nosec G204
+	// The entry names are file names of the store, `--` ends the options before an entry name starting with `-`
+	cmdArgs := []string{"otp", "--", itemId}
+	otpResponse, err := exec.Command(p.binary, cmdArgs...).Output()
+	if err != nil {
+		return "", CommandExecutionError{
+			Code: CommandExecutionErrorCode,
+			Cmd:  fmt.Sprintf("%s %s", p.binary, strings.Join(cmdArgs, " ")),
+			Err:  err,
+		}
+	}
+
+	return strings.TrimSpace(string(otpResponse)), nil
+}
+
+func (p ProviderPass) showEntry(itemId string) (passEntry, error) {
+	// #nosec G204
+	// The entry names are file names of the store, `--` ends the options before an entry name starting with `-`
+	cmdArgs := []string{"show", "--", itemId}
+	showResponse, err := exec.Command(p.binary, cmdArgs...).Output()
+	if err != nil {
+		return passEntry{}, ProviderConnectionError{
+			Code: ProviderConnectionErrorCode,
+			Cmd:  fmt.Sprintf("%s %s", p.binary, strings.Join(cmdArgs, " ")),
+			Err:  err,
+		}
+	}
+
+	return parsePassEntry(string(showResponse)), nil
+}
+
+func (p *ProviderPass) GetHumanReadableErrorMessage(err error) error {
+	var readableError error
+
+	// The concrete (developer oriented) error message is available in err
+	switch err.(type) {
+	case ProviderNotInstalledError:
+		readableError = errors.New(`could not find out pass version. Install pass (https://www.passwordstore.org/), first`)
+
+	case ProviderConnectionError:
+		readableError = fmt.Errorf("could not read entries from password store %s. Check if the store exists and gpg can decrypt the entries", filepath.Join(p.storeDirectory, p.base))
+
+	case CommandExecutionError:
+		var cmdExecError *CommandExecutionError
+		if errors.As(err, &cmdExecError) {
+			readableError = fmt.Errorf("an error occurred while executing a command '%s': %w", cmdExecError.Cmd, cmdExecError.Err)
+		} else {
+			readableError = fmt.Errorf("%w", err)
+		}
+
+	default:
+		readableError = err
+	}
+
+	return readableError
+}
+
+// parsePassEntry parses the content of a pass entry.
+// The first line is the password, followed by `key: value` lines and optional `otpauth://` lines.
+// Unknown keys and lines without a key are ignored.
+func parsePassEntry(content string) passEntry {
+	entry := passEntry{Fields: map[string]string{}}
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	firstLine := true
+	for scanner.Scan() {
+		line := scanner.Text()
+		if firstLine {
+			entry.Password = line
+			firstLine = false
+			continue
+		}
+
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "otpauth://") {
+			entry.HasOtpAuth = true
+			continue
+		}
+
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		if _, ok := entry.Fields[key]; !ok {
+			entry.Fields[key] = value
+		}
+		switch passFieldAliases[key] {
+		case "username":
+			if len(entry.Username) == 0 {
+				entry.Username = value
+			}
+		case "password":
+			entry.Password = value
+		case "url":
+			if len(value) > 0 {
+				entry.Urls = append(entry.Urls, value)
+			}
+		case "totp":
+			entry.Totp = value
+		}
+	}
+
+	return entry
+}
+
+// withCredentialFields returns the entry with the credentials read from the `key: value` lines labeled in fields.
+// Fields without a label keep the default values, an entry without a labeled line is an error.
+func (e passEntry) withCredentialFields(fields CredentialFields) (passEntry, error) {
+	for _, field := range []struct {
+		label string
+		value *string
+	}{{fields.Username, &e.Username}, {fields.Password, &e.Password}, {fields.Totp, &e.Totp}} {
+		if len(field.label) == 0 {
+			continue
+		}
+		value, ok := e.Fields[strings.ToLower(field.label)]
+		if !ok {
+			return e, credentialFieldMissingError(field.label)
+		}
+		*field.value = value
+	}
+	return e, nil
+}
+
+// parsePassVersion extracts the version from the output of `pass version` (an ASCII art banner)
+// or `gopass version` (a single line).
+func parsePassVersion(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.Trim(line, " =|\t")
+		if strings.HasPrefix(line, "v") || strings.HasPrefix(line, "gopass") {
+			return line
+		}
+	}
+	return strings.TrimSpace(output)
+}
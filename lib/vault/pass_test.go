@@ -0,0 +1,190 @@
+package vault
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePassEntry(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected passEntry
+	}{
+		{
+			name:     "password only",
+			content:  "s3cr3t\n",
+			expected: passEntry{Password: "s3cr3t", Fields: map[string]string{}},
+		},
+		{
+			name:    "full entry",
+			content: "s3cr3t\nUsername: jane@example.com\nurl: https://accounts.hetzner.com/login\nWebsite: https://console.hetzner.cloud\nnotes: something: with colons\n",
+			expected: passEntry{
+				Username: "jane@example.com",
+				Password: "s3cr3t",
+				Urls:     []string{"https://accounts.hetzner.com/login", "https://console.hetzner.cloud"},
+				Fields: map[string]string{
+					"username": "jane@example.com",
+					"url":      "https://accounts.hetzner.com/login",
+					"website":  "https://console.hetzner.cloud",
+					"notes":    "something: with colons",
+				},
+			},
+		},
+		{
+			name:     "password field overrides first line",
+			content:  "\nlogin: jane\npassword: from-field\n",
+			expected: passEntry{Username: "jane", Password: "from-field", Fields: map[string]string{"login": "jane", "password": "from-field"}},
+		},
+		{
+			name:     "otpauth line and totp field",
+			content:  "s3cr3t\notpauth://totp/Example:jane?secret=JBSWY3DPEHPK3PXP\ntotp: JBSWY3DPEHPK3PXP\n",
+			expected: passEntry{Password: "s3cr3t", Totp: "JBSWY3DPEHPK3PXP", HasOtpAuth: true, Fields: map[string]string{"totp": "JBSWY3DPEHPK3PXP"}},
+		},
+	}
+
+	for _, test := range tests {
+		entry := parsePassEntry(test.content)
+		if !reflect.DeepEqual(entry, test.expected) {
+			t.Errorf("%s: parsePassEntry() = %+v; want %+v", test.name, entry, test.expected)
+		}
+	}
+}
+
+func TestPassEntryWithCredentialFields(t *testing.T) {
+	entry := parsePassEntry("s3cr3t\nusername: jane\nKundennummer: 4711\nPIN: 1234\n")
+
+	tests := []struct {
+		fields           CredentialFields
+		expectedUsername string
+		expectedPassword string
+	}{
+		{fields: CredentialFields{}, expectedUsername: "jane", expectedPassword: "s3cr3t"},
+		{fields: CredentialFields{Username: "kundennummer"}, expectedUsername: "4711", expectedPassword: "s3cr3t"},
+		{fields: CredentialFields{Username: "Kundennummer", Password: "PIN"}, expectedUsername: "4711", expectedPassword: "1234"},
+	}
+
+	for _, test := range tests {
+		result, err := entry.withCredentialFields(test.fields)
+		if err != nil {
+			t.Errorf("withCredentialFields(%+v) returned error: %s", test.fields, err)
+			continue
+		}
+		if result.Username != test.expectedUsername || result.Password != test.expectedPassword {
+			t.Errorf("withCredentialFields(%+v) = %q / %q; want %q / %q", test.fields, result.Username, result.Password, test.expectedUsername, test.expectedPassword)
+		}
+	}
+
+	if _, err := entry.withCredentialFields(CredentialFields{Username: "Vertragsnummer"}); !errors.Is(err, ErrCredentialFieldMissing) || !strings.Contains(err.Error(), "`Vertragsnummer`") {
+		t.Errorf("withCredentialFields() of a missing line error = %v; want %v naming the label", err, ErrCredentialFieldMissing)
+	}
+}
+
+func TestParsePassVersion(t *testing.T) {
+	passOutput := `============================================
+= pass: the standard unix password manager =
+=                                          =
+=                  v1.7.4                  =
+=                                          =
+============================================
+`
+	if version := parsePassVersion(passOutput); version != "v1.7.4" {
+		t.Errorf("parsePassVersion(pass) = %q; want %q", version, "v1.7.4")
+	}
+	if version := parsePassVersion("gopass 1.15.11 go1.22.1 linux amd64\n"); version != "gopass 1.15.11 go1.22.1 linux amd64" {
+		t.Errorf("parsePassVersion(gopass) = %q", version)
+	}
+}
+
+func TestPassProviderLoadVaultItems(t *testing.T) {
+	// A fake pass binary printing the entry from the store directory (unencrypted), the entry name must follow `--`
+	storeDirectory := t.TempDir()
+	binary := filepath.Join(t.TempDir(), "pass")
+	script := `#!/bin/sh
+[ "$1" = "version" ] && echo "v1.7.4" && exit 0
+[ "$2" = "--" ] || exit 2
+case "$1" in
+  show) cat "$PASSWORD_STORE_DIR/$3.gpg" ;;
+  otp) echo "123456" ;;
+  *) exit 1 ;;
+esac
+`
+	if err := os.WriteFile(binary, []byte(script), 0700); err != nil {
+		t.Fatalf("error writing fake pass binary: %s", err)
+	}
+
+	entries := map[string]string{
+		"buchhalter/hetzner.gpg":     "s3cr3t\nusername: jane\nurl: https://accounts.hetzner.com/login\n",
+		"buchhalter/aws/root.gpg":    "t0p\nurl: https://signin.aws.amazon.com\n",
+		"-hetzner.gpg":               "d4sh\notpauth://totp/Hetzner:jane?secret=JBSWY3DPEHPK3PXP\n",
+		"private/bank.gpg":           "not-in-subtree\n",
+		"buchhalter/.git/config.gpg": "hidden\n",
+	}
+	for name, content := range entries {
+		path := filepath.Join(storeDirectory, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatalf("error creating store directory: %s", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("error writing entry: %s", err)
+		}
+	}
+	t.Setenv("PASSWORD_STORE_DIR", storeDirectory)
+
+	p, err := NewPassProvider(binary, "buchhalter", nil)
+	if err != nil {
+		t.Fatalf("NewPassProvider() returned error: %s", err)
+	}
+	if p.GetVersion() != "v1.7.4" {
+		t.Errorf("GetVersion() = %q; want %q", p.GetVersion(), "v1.7.4")
+	}
+
+	items, err := p.LoadVaultItems()
+	if err != nil {
+		t.Fatalf("LoadVaultItems() returned error: %s", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("LoadVaultItems() returned %d items (%+v); want 2", len(items), items)
+	}
+
+	urls := p.GetUrlsByItemId()
+	if !reflect.DeepEqual(urls["buchhalter/hetzner"], []string{"https://accounts.hetzner.com/login"}) {
+		t.Errorf("urls of buchhalter/hetzner = %v", urls["buchhalter/hetzner"])
+	}
+	if !reflect.DeepEqual(urls["buchhalter/aws/root"], []string{"https://signin.aws.amazon.com"}) {
+		t.Errorf("urls of buchhalter/aws/root = %v", urls["buchhalter/aws/root"])
+	}
+
+	credentials, err := p.GetCredentialsByItemId("buchhalter/hetzner", CredentialFields{})
+	if err != nil {
+		t.Fatalf("GetCredentialsByItemId() returned error: %s", err)
+	}
+	if credentials.Username != "jane" || credentials.Password != "s3cr3t" {
+		t.Errorf("GetCredentialsByItemId() = %+v; want username jane and password s3cr3t", credentials)
+	}
+	// Entry names starting with `-` are no options of pass
+	root, err := NewPassProvider(binary, "", nil)
+	if err != nil {
+		t.Fatalf("NewPassProvider() returned error: %s", err)
+	}
+	credentials, err = root.GetCredentialsByItemId("-hetzner", CredentialFields{})
+	if err != nil || credentials.Password != "d4sh" {
+		t.Errorf("GetCredentialsByItemId(-hetzner) = %+v, %v; want password d4sh", credentials, err)
+	}
+	if code, err := root.GetTotpForItem("-hetzner", CredentialFields{}); err != nil || code != "123456" {
+		t.Errorf("GetTotpForItem(-hetzner) = %q, %v; want the code of pass otp", code, err)
+	}
+
+	vaults, err := p.GetVaults()
+	if err != nil {
+		t.Fatalf("GetVaults() returned error: %s", err)
+	}
+	expectedVaults := []Vault{{ID: "pass-buchhalter", Name: "buchhalter"}, {ID: "pass-private", Name: "private"}}
+	if !reflect.DeepEqual(vaults, expectedVaults) {
+		t.Errorf("GetVaults() = %+v; want %+v", vaults, expectedVaults)
+	}
+}
@@ -0,0 +1,165 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+const (
+	// PROVIDER_STDIN reads the credentials of a single recipe run from stdin (`sync --credentials-stdin`).
+	// It is meant for the development of recipes and can't be configured in `credential_provider`.
+	PROVIDER_STDIN = "stdin"
+
+	// StdinItemId is the ID of the only item of the stdin provider
+	StdinItemId = "stdin"
+
+	// maxStdinCredentialsSize limits the credentials read from stdin
+	maxStdinCredentialsSize = 64 * 1024
+)
+
+// totpCodePattern matches a TOTP code (instead of a TOTP secret)
+var totpCodePattern = regexp.MustCompile(`^[0-9]{6,8}$`)
+
+// StdinCredentials are the credentials passed as JSON on stdin, e.g. `{"username": "...", "password": "...", "totp": "..."}`.
+// `totp` is either a current code or the TOTP secret (base32 or `otpauth://` URI).
+type StdinCredentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Totp     string `json:"totp,omitempty"`
+}
+
+// ParseStdinCredentials reads the credentials JSON from r.
+// The errors never contain the credentials.
+func ParseStdinCredentials(r io.Reader) (StdinCredentials, error) {
+	var credentials StdinCredentials
+
+	content, err := io.ReadAll(io.LimitReader(r, maxStdinCredentialsSize+1))
+	if err != nil {
+		return credentials, fmt.Errorf("error reading credentials from stdin: %w", err)
+	}
+	if len(content) > maxStdinCredentialsSize {
+		return credentials, fmt.Errorf("credentials on stdin exceed %d bytes", maxStdinCredentialsSize)
+	}
+	if len(strings.TrimSpace(string(content))) == 0 {
+		return credentials, errors.New("no credentials on stdin, expected JSON like {\"username\": \"...\", \"password\": \"...\"}")
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(string(content)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&credentials); err != nil {
+		// Syntax errors of the JSON decoder can quote the input, unknown fields only their name
+		var syntaxError *json.SyntaxError
+		if errors.As(err, &syntaxError) {
+			return credentials, fmt.Errorf("credentials on stdin are no valid JSON (at offset %d)", syntaxError.Offset)
+		}
+		var typeError *json.UnmarshalTypeError
+		if errors.As(err, &typeError) {
+			return credentials, fmt.Errorf("field `%s` of the credentials on stdin must be a string", typeError.Field)
+		}
+		return credentials, fmt.Errorf("credentials on stdin are not valid: %w", err)
+	}
+	if len(credentials.Username) == 0 && len(credentials.Password) == 0 {
+		return credentials, errors.New("credentials on stdin have neither `username` nor `password`")
+	}
+
+	return credentials, nil
+}
+
+// ProviderStdin provides the credentials read from stdin as a single item (ID StdinItemId).
+type ProviderStdin struct {
+	credentials StdinCredentials
+
+	VaultItems   Items
+	UrlsByItemId map[string][]string
+
+	logger *slog.Logger
+}
+
+func NewStdinProvider(credentials StdinCredentials, logger *slog.Logger) *ProviderStdin {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &ProviderStdin{
+		credentials:  credentials,
+		UrlsByItemId: make(map[string][]string),
+		logger:       logger,
+	}
+}
+
+func (p *ProviderStdin) GetVersion() string {
+	return PROVIDER_STDIN
+}
+
+func (p *ProviderStdin) GetVaultItems() Items {
+	return p.VaultItems
+}
+
+func (p *ProviderStdin) GetUrlsByItemId() map[string][]string {
+	return p.UrlsByItemId
+}
+
+// LoadVaultItems returns the single item of the credentials.
+// It has no URLs, the recipe is paired with it explicitly.
+func (p *ProviderStdin) LoadVaultItems() (Items, error) {
+	p.VaultItems = Items{{ID: StdinItemId, Title: StdinItemId}}
+	p.UrlsByItemId[StdinItemId] = []string{}
+	p.logger.Debug("Loaded credentials from stdin", "has_username", len(p.credentials.Username) > 0, "has_password", len(p.credentials.Password) > 0, "has_totp", len(p.credentials.Totp) > 0)
+
+	return p.VaultItems, nil
+}
+
+// GetCredentialsByItemId returns the credentials, the field labels are ignored.
+func (p *ProviderStdin) GetCredentialsByItemId(itemId string, fields CredentialFields) (*Credentials, error) {
+	if itemId != StdinItemId {
+		return nil, ProviderResponseParsingError{
+			Code: ProviderResponseParsingErrorCode,
+			Cmd:  PROVIDER_STDIN,
+			Err:  fmt.Errorf("item %s not found", itemId),
+		}
+	}
+
+	credentials := &Credentials{
+		Id:            itemId,
+		Username:      p.credentials.Username,
+		Password:      p.credentials.Password,
+		Fields:        fields,
+		VaultProvider: p, // Store the provider instance
+	}
+
+	return credentials, nil
+}
+
+// GetTotpForItem returns the TOTP code of the credentials, generated if a TOTP secret was passed.
+func (p *ProviderStdin) GetTotpForItem(itemId string, fields CredentialFields) (string, error) {
+	if itemId != StdinItemId {
+		return "", ProviderResponseParsingError{
+			Code: ProviderResponseParsingErrorCode,
+			Cmd:  PROVIDER_STDIN,
+			Err:  fmt.Errorf("item %s not found", itemId),
+		}
+	}
+
+	totp := strings.TrimSpace(p.credentials.Totp)
+	if len(totp) == 0 {
+		return "", fmt.Errorf("no `totp` in the credentials on stdin: %w", ErrTotpMissing)
+	}
+	if totpCodePattern.MatchString(totp) {
+		return totp, nil
+	}
+	code, err := fields.TotpWindow.generate(totp, p.logger)
+	if err != nil {
+		// Parsing errors of an otpauth URI quote the URI (incl. the secret)
+		p.logger.Debug("Error generating TOTP from the credentials on stdin", "is_otpauth_uri", strings.HasPrefix(totp, "otpauth://"))
+		return "", errors.New("error generating TOTP from the credentials on stdin: `totp` is neither a code nor a valid TOTP secret")
+	}
+	return code, nil
+}
+
+func (p *ProviderStdin) GetHumanReadableErrorMessage(err error) error {
+	return err
+}
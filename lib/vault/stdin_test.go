@@ -0,0 +1,107 @@
+package vault
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+const stdinTestPassword = "pa55w0rd-on-stdin"
+
+func TestParseStdinCredentials(t *testing.T) {
+	tests := []struct {
+		name          string
+		input         string
+		expected      StdinCredentials
+		expectedError bool
+	}{
+		{"username and password", `{"username": "jane", "password": "` + stdinTestPassword + `"}`, StdinCredentials{Username: "jane", Password: stdinTestPassword}, false},
+		{"with totp", `{"username": "jane", "password": "` + stdinTestPassword + `", "totp": "123456"}` + "\n", StdinCredentials{Username: "jane", Password: stdinTestPassword, Totp: "123456"}, false},
+		{"password only", `{"password": "` + stdinTestPassword + `"}`, StdinCredentials{Password: stdinTestPassword}, false},
+		{"empty input", "  \n", StdinCredentials{}, true},
+		{"no credentials", `{}`, StdinCredentials{}, true},
+		{"invalid JSON", `{"username": "jane", "password": "` + stdinTestPassword + `"`, StdinCredentials{}, true},
+		{"unquoted password", `{"username": "jane", "password": ` + stdinTestPassword + `}`, StdinCredentials{}, true},
+		{"password is no string", `{"username": "jane", "password": 4711}`, StdinCredentials{}, true},
+		{"unknown field", `{"username": "jane", "pasword": "` + stdinTestPassword + `"}`, StdinCredentials{}, true},
+	}
+
+	for _, test := range tests {
+		credentials, err := ParseStdinCredentials(strings.NewReader(test.input))
+		if (err != nil) != test.expectedError {
+			t.Errorf("%s: ParseStdinCredentials() returned error %v; want error %t", test.name, err, test.expectedError)
+		}
+		if err != nil && strings.Contains(err.Error(), stdinTestPassword) {
+			t.Errorf("%s: ParseStdinCredentials() error %q contains the password", test.name, err)
+		}
+		if !test.expectedError && credentials != test.expected {
+			t.Errorf("%s: ParseStdinCredentials() = %+v; want %+v", test.name, credentials, test.expected)
+		}
+	}
+
+	if _, err := ParseStdinCredentials(strings.NewReader(strings.Repeat(" ", maxStdinCredentialsSize+1))); err == nil {
+		t.Errorf("ParseStdinCredentials() of too large input returned no error")
+	}
+}
+
+func TestStdinProvider(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	secret := "otpauth://totp/Example:jane?secret=JBSWY3DPEHPK3PXP"
+	p := NewStdinProvider(StdinCredentials{Username: "jane", Password: stdinTestPassword, Totp: secret}, logger)
+	items, err := p.LoadVaultItems()
+	if err != nil {
+		t.Fatalf("LoadVaultItems() returned error: %s", err)
+	}
+	if len(items) != 1 || items[0].ID != StdinItemId {
+		t.Fatalf("LoadVaultItems() = %v; want the stdin item", items)
+	}
+
+	credentials, err := p.GetCredentialsByItemId(StdinItemId, CredentialFields{Username: "kundennummer"})
+	if err != nil {
+		t.Fatalf("GetCredentialsByItemId() returned error: %s", err)
+	}
+	if credentials.Username != "jane" || credentials.Password != stdinTestPassword {
+		t.Errorf("GetCredentialsByItemId() = %s, %s; want jane and the password", credentials.Username, credentials.Password)
+	}
+	if _, err := p.GetCredentialsByItemId("other", CredentialFields{}); err == nil {
+		t.Errorf("GetCredentialsByItemId(other) returned no error")
+	}
+
+	// A TOTP secret generates the current code, a code is used as is
+	expectedTotp, err := GenerateTotp(secret, time.Now())
+	if err != nil {
+		t.Fatalf("GenerateTotp() returned error: %s", err)
+	}
+	totp, err := p.GetTotpForItem(StdinItemId, CredentialFields{})
+	if err != nil {
+		t.Fatalf("GetTotpForItem() returned error: %s", err)
+	}
+	// The code may change between both calls
+	if len(totp) != 6 || (totp != expectedTotp && time.Now().Unix()%30 > 1) {
+		t.Errorf("GetTotpForItem() = %s; want %s", totp, expectedTotp)
+	}
+	codeProvider := NewStdinProvider(StdinCredentials{Password: stdinTestPassword, Totp: "987654"}, logger)
+	if totp, err := codeProvider.GetTotpForItem(StdinItemId, CredentialFields{}); err != nil || totp != "987654" {
+		t.Errorf("GetTotpForItem() with a code = %s, %v; want 987654", totp, err)
+	}
+
+	invalidSecret := "otpauth://totp/%zz?secret=" + stdinTestPassword
+	invalidProvider := NewStdinProvider(StdinCredentials{Password: stdinTestPassword, Totp: invalidSecret}, logger)
+	if _, err := invalidProvider.GetTotpForItem(StdinItemId, CredentialFields{}); err == nil || strings.Contains(err.Error(), stdinTestPassword) {
+		t.Errorf("GetTotpForItem() with an invalid secret returned %v; want an error without the secret", err)
+	}
+	if _, err := NewStdinProvider(StdinCredentials{Password: stdinTestPassword}, logger).GetTotpForItem(StdinItemId, CredentialFields{}); err == nil {
+		t.Errorf("GetTotpForItem() without totp returned no error")
+	}
+
+	// Nothing of the credentials is logged
+	for _, secretValue := range []string{stdinTestPassword, "JBSWY3DPEHPK3PXP", "987654"} {
+		if strings.Contains(logs.String(), secretValue) {
+			t.Errorf("Logs contain the secret %q: %s", secretValue, logs.String())
+		}
+	}
+}
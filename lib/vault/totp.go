@@ -0,0 +1,142 @@
+package vault
+
+import (
+	"crypto/hmac"
+	"crypto/sha1" // #nosec G505 -- SHA1 is the default algorithm of TOTP (RFC 6238)
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"buchhalter/lib/utils"
+)
+
+// TOTP defaults of RFC 6238 and most authenticator apps
+const (
+	totpDefaultDigits    = 6
+	totpDefaultPeriod    = 30
+	totpDefaultAlgorithm = "SHA1"
+)
+
+// ErrTotpMissing is returned by GetTotpForItem, if the item has no TOTP secret (e.g. the 2FA seed isn't stored in the vault).
+var ErrTotpMissing = errors.New("no TOTP in the vault")
+
+// totpConfig is a TOTP secret with its parameters.
+type totpConfig struct {
+	secret    []byte
+	digits    int
+	period    int64
+	algorithm string
+}
+
+// GenerateTotp computes the TOTP code (RFC 6238) valid at t.
+// secret is either a base32 encoded secret (spaces, lower case and missing padding are accepted)
+// or an `otpauth://totp/...` URI with optional digits, period and algorithm parameters.
+func GenerateTotp(secret string, t time.Time) (string, error) {
+	config, err := parseTotpSecret(secret)
+	if err != nil {
+		return "", err
+	}
+
+	return generateTotp(config, t)
+}
+
+func parseTotpSecret(secret string) (totpConfig, error) {
+	config := totpConfig{
+		digits:    totpDefaultDigits,
+		period:    totpDefaultPeriod,
+		algorithm: totpDefaultAlgorithm,
+	}
+
+	// Like the password, the TOTP secret (and the secret of an otpauth URI) is redacted from crash reports
+	secret = strings.TrimSpace(secret)
+	utils.RegisterSecret(secret)
+	if strings.HasPrefix(secret, "otpauth://") {
+		otpauthUrl, err := url.Parse(secret)
+		if err != nil {
+			return config, fmt.Errorf("error parsing otpauth URI: %w", err)
+		}
+		if otpauthUrl.Host != "totp" {
+			return config, fmt.Errorf("otpauth URI of type `%s` is not supported, only `totp`", otpauthUrl.Host)
+		}
+
+		query := otpauthUrl.Query()
+		secret = query.Get("secret")
+		utils.RegisterSecret(secret)
+		if digits := query.Get("digits"); len(digits) > 0 {
+			if config.digits, err = strconv.Atoi(digits); err != nil {
+				return config, fmt.Errorf("invalid digits `%s` in otpauth URI", digits)
+			}
+		}
+		if period := query.Get("period"); len(period) > 0 {
+			if config.period, err = strconv.ParseInt(period, 10, 64); err != nil {
+				return config, fmt.Errorf("invalid period `%s` in otpauth URI", period)
+			}
+		}
+		if algorithm := query.Get("algorithm"); len(algorithm) > 0 {
+			config.algorithm = strings.ToUpper(algorithm)
+		}
+	}
+
+	// Secrets are often displayed in groups of four characters and without padding
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	secret = strings.TrimRight(secret, "=")
+	utils.RegisterSecret(secret)
+	decodedSecret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		return config, fmt.Errorf("TOTP secret is not base32 encoded: %w", err)
+	}
+	if len(decodedSecret) == 0 {
+		return config, fmt.Errorf("TOTP secret is empty")
+	}
+	config.secret = decodedSecret
+
+	if config.digits < 6 || config.digits > 10 {
+		return config, fmt.Errorf("TOTP with %d digits is not supported (supported: 6 to 10)", config.digits)
+	}
+	if config.period <= 0 {
+		return config, fmt.Errorf("TOTP period %d must be greater than 0", config.period)
+	}
+
+	return config, nil
+}
+
+func generateTotp(config totpConfig, t time.Time) (string, error) {
+	var newHash func() hash.Hash
+	switch config.algorithm {
+	case "SHA1":
+		newHash = sha1.New
+	case "SHA256":
+		newHash = sha256.New
+	case "SHA512":
+		newHash = sha512.New
+	default:
+		return "", fmt.Errorf("TOTP algorithm `%s` is not supported (supported: SHA1, SHA256, SHA512)", config.algorithm)
+	}
+
+	// HOTP (RFC 4226) with the number of periods since the unix epoch as counter
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(t.Unix()/config.period)) // #nosec G115 -- times before 1970 aren't relevant
+
+	mac := hmac.New(newHash, config.secret)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation
+	offset := sum[len(sum)-1] & 0x0f
+	code := int64(binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff)
+
+	modulo := int64(1)
+	for i := 0; i < config.digits; i++ {
+		modulo *= 10
+	}
+
+	return fmt.Sprintf("%0*d", config.digits, code%modulo), nil
+}
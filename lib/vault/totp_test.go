@@ -0,0 +1,109 @@
+package vault
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"buchhalter/lib/utils"
+)
+
+func TestGenerateTotpRFC6238(t *testing.T) {
+	// Test vectors of RFC 6238, Appendix B (8 digits)
+	secrets := map[string]string{
+		"SHA1":   "12345678901234567890",
+		"SHA256": "12345678901234567890123456789012",
+		"SHA512": "1234567890123456789012345678901234567890123456789012345678901234",
+	}
+	tests := []struct {
+		unixTime  int64
+		algorithm string
+		expected  string
+	}{
+		{59, "SHA1", "94287082"},
+		{59, "SHA256", "46119246"},
+		{59, "SHA512", "90693936"},
+		{1111111109, "SHA1", "07081804"},
+		{1111111109, "SHA256", "68084774"},
+		{1111111109, "SHA512", "25091201"},
+		{1111111111, "SHA1", "14050471"},
+		{1111111111, "SHA256", "67062674"},
+		{1111111111, "SHA512", "99943326"},
+		{1234567890, "SHA1", "89005924"},
+		{1234567890, "SHA256", "91819424"},
+		{1234567890, "SHA512", "93441116"},
+		{2000000000, "SHA1", "69279037"},
+		{2000000000, "SHA256", "90698825"},
+		{2000000000, "SHA512", "38618901"},
+		{20000000000, "SHA1", "65353130"},
+		{20000000000, "SHA256", "77737706"},
+		{20000000000, "SHA512", "47863826"},
+	}
+
+	for _, test := range tests {
+		secret := base32.StdEncoding.EncodeToString([]byte(secrets[test.algorithm]))
+		otpauthUri := "otpauth://totp/Example:jane?secret=" + secret + "&digits=8&algorithm=" + test.algorithm
+
+		code, err := GenerateTotp(otpauthUri, time.Unix(test.unixTime, 0))
+		if err != nil {
+			t.Errorf("%s at %d: GenerateTotp() returned error: %s", test.algorithm, test.unixTime, err)
+			continue
+		}
+		if code != test.expected {
+			t.Errorf("%s at %d: GenerateTotp() = %s; want %s", test.algorithm, test.unixTime, code, test.expected)
+		}
+	}
+}
+
+func TestGenerateTotpSecretFormats(t *testing.T) {
+	at := time.Unix(1111111109, 0)
+	// 6 digit code of the RFC 6238 SHA1 secret at 1111111109
+	expected := "081804"
+
+	tests := []struct {
+		name   string
+		secret string
+	}{
+		{"base32", "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"},
+		{"lower case", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq"},
+		{"grouped", "GEZD GNBV GY3T QOJQ GEZD GNBV GY3T QOJQ"},
+		{"surrounding whitespace", "  GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ\n"},
+		{"otpauth URI", "otpauth://totp/Example:jane?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&issuer=Example"},
+	}
+
+	for _, test := range tests {
+		code, err := GenerateTotp(test.secret, at)
+		if err != nil {
+			t.Errorf("%s: GenerateTotp() returned error: %s", test.name, err)
+			continue
+		}
+		if code != expected {
+			t.Errorf("%s: GenerateTotp() = %s; want %s", test.name, code, expected)
+		}
+		// The secret is redacted from crash reports
+		if redacted := utils.Redact("totp seed " + test.secret); strings.Contains(redacted, "GEZDGNBV") || strings.Contains(redacted, "gezdgnbv") {
+			t.Errorf("%s: Redact() = %q; want the TOTP secret redacted", test.name, redacted)
+		}
+	}
+}
+
+func TestGenerateTotpInvalidSecrets(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+	}{
+		{"empty", ""},
+		{"not base32", "not-a-secret!"},
+		{"hotp URI", "otpauth://hotp/Example:jane?secret=GEZDGNBVGY3TQOJQ&counter=1"},
+		{"unsupported algorithm", "otpauth://totp/Example:jane?secret=GEZDGNBVGY3TQOJQ&algorithm=MD5"},
+		{"too many digits", "otpauth://totp/Example:jane?secret=GEZDGNBVGY3TQOJQ&digits=12"},
+		{"zero period", "otpauth://totp/Example:jane?secret=GEZDGNBVGY3TQOJQ&period=0"},
+	}
+
+	for _, test := range tests {
+		if code, err := GenerateTotp(test.secret, time.Now()); err == nil {
+			t.Errorf("%s: GenerateTotp() = %s; want an error", test.name, code)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package vault
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const (
+	// totpMinValidity is the minimum time a code must stay valid to be typed and submitted in the portal
+	totpMinValidity = 5 * time.Second
+	// totpWaitBuffer is the time waited into a new window
+	totpWaitBuffer = time.Second
+
+	// MaxTotpClockSkew is the maximum clock skew tolerance (`buchhalter_totp_clock_skew`).
+	// With the default period of 30 seconds, a larger tolerance leaves too little time to use a code.
+	MaxTotpClockSkew = 10 * time.Second
+)
+
+// TotpWindow decides for which TOTP window (period) a code is generated.
+// Codes about to expire are rejected by the portal once it is submitted, especially if the clock of the portal is ahead.
+type TotpWindow struct {
+	// ClockSkew is the tolerated difference between the local clock and the clock of the portal
+	ClockSkew time.Duration
+	// AcceptsAdjacent is set if the portal accepts the codes of the previous and next window (±1 step),
+	// a code of the next window is used instead of waiting for it.
+	AcceptsAdjacent bool
+}
+
+// ValidateTotpClockSkew returns an error if skew can't be used as clock skew tolerance.
+func ValidateTotpClockSkew(skew time.Duration) error {
+	if skew < 0 || skew > MaxTotpClockSkew {
+		return fmt.Errorf("clock skew tolerance must be between 0s and %s", MaxTotpClockSkew)
+	}
+	return nil
+}
+
+// Select returns how long to wait before the code is generated at now and the time to generate the code for.
+// A code must be valid for totpMinValidity at the portal, even if its clock is off by up to ClockSkew in either direction.
+func (w TotpWindow) Select(now time.Time, period time.Duration) (time.Duration, time.Time) {
+	elapsed := time.Duration(now.UnixNano() % period.Nanoseconds())
+	remaining := period - elapsed
+
+	if remaining-w.ClockSkew < totpMinValidity {
+		if w.AcceptsAdjacent {
+			// Accepted as next window now and as current window after the portal changed the window
+			return 0, now.Add(period)
+		}
+		wait := remaining + w.ClockSkew + totpWaitBuffer
+		return wait, now.Add(wait)
+	}
+	if elapsed < w.ClockSkew && !w.AcceptsAdjacent {
+		// A portal clock behind may still be in the previous window
+		wait := w.ClockSkew - elapsed
+		return wait, now.Add(wait)
+	}
+
+	return 0, now
+}
+
+// generate generates the code of secret for the window of Select, it waits for the window if needed.
+func (w TotpWindow) generate(secret string, logger *slog.Logger) (string, error) {
+	config, err := parseTotpSecret(secret)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	wait, at := w.Select(now, time.Duration(config.period)*time.Second)
+	if at.Sub(now) > wait {
+		logger.Info("Current TOTP window is about to expire, using the code of the next window", "clock_skew", w.ClockSkew.String())
+	}
+	w.sleep(wait, logger)
+
+	return generateTotp(config, at)
+}
+
+// waitForCurrentWindow waits until a code of the current window, generated by the CLI of a provider, is valid long enough.
+// The code can't be generated for the next window, so AcceptsAdjacent is ignored.
+func (w TotpWindow) waitForCurrentWindow(logger *slog.Logger) {
+	current := TotpWindow{ClockSkew: w.ClockSkew}
+	wait, _ := current.Select(time.Now(), totpDefaultPeriod*time.Second)
+	w.sleep(wait, logger)
+}
+
+func (w TotpWindow) sleep(wait time.Duration, logger *slog.Logger) {
+	if wait <= 0 {
+		return
+	}
+	logger.Info("Waiting for a new TOTP window", "wait_duration", wait.String(), "clock_skew", w.ClockSkew.String())
+	time.Sleep(wait)
+}
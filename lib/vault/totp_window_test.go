@@ -0,0 +1,72 @@
+package vault
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTotpWindowSelect(t *testing.T) {
+	period := 30 * time.Second
+	windowStart := time.Unix(1111111080, 0)
+	tests := []struct {
+		name         string
+		window       TotpWindow
+		elapsed      time.Duration
+		expectedWait time.Duration
+		expectedAt   time.Duration
+	}{
+		{"valid long enough", TotpWindow{}, 10 * time.Second, 0, 10 * time.Second},
+		{"about to expire", TotpWindow{}, 27 * time.Second, 4 * time.Second, 31 * time.Second},
+		{"about to expire with skew", TotpWindow{ClockSkew: 3 * time.Second}, 23 * time.Second, 11 * time.Second, 34 * time.Second},
+		{"valid long enough with skew", TotpWindow{ClockSkew: 3 * time.Second}, 10 * time.Second, 0, 10 * time.Second},
+		{"new window with skew", TotpWindow{ClockSkew: 3 * time.Second}, time.Second, 2 * time.Second, 3 * time.Second},
+		{"about to expire with adjacent window", TotpWindow{ClockSkew: 3 * time.Second, AcceptsAdjacent: true}, 27 * time.Second, 0, 57 * time.Second},
+		{"new window with adjacent window", TotpWindow{ClockSkew: 3 * time.Second, AcceptsAdjacent: true}, time.Second, 0, time.Second},
+	}
+
+	for _, test := range tests {
+		now := windowStart.Add(test.elapsed)
+		wait, at := test.window.Select(now, period)
+		if wait != test.expectedWait {
+			t.Errorf("%s: Select() wait = %s; want %s", test.name, wait, test.expectedWait)
+		}
+		if expectedAt := windowStart.Add(test.expectedAt); !at.Equal(expectedAt) {
+			t.Errorf("%s: Select() at = %s; want %s", test.name, at.Sub(windowStart), test.expectedAt)
+		}
+	}
+}
+
+func TestTotpWindowSelectAdjacentCode(t *testing.T) {
+	// The code of the next window is the code the portal expects after the window changed
+	secret := "JBSWY3DPEHPK3PXP"
+	now := time.Unix(1111111080+28, 0)
+	_, at := TotpWindow{AcceptsAdjacent: true}.Select(now, 30*time.Second)
+
+	code, err := GenerateTotp(secret, at)
+	if err != nil {
+		t.Fatalf("GenerateTotp() returned error: %s", err)
+	}
+	expected, _ := GenerateTotp(secret, time.Unix(1111111110+1, 0))
+	if code != expected {
+		t.Errorf("Select() returned the code %s; want %s of the next window", code, expected)
+	}
+}
+
+func TestValidateTotpClockSkew(t *testing.T) {
+	tests := []struct {
+		skew  time.Duration
+		valid bool
+	}{
+		{0, true},
+		{5 * time.Second, true},
+		{MaxTotpClockSkew, true},
+		{MaxTotpClockSkew + time.Second, false},
+		{-time.Second, false},
+	}
+
+	for _, test := range tests {
+		if err := ValidateTotpClockSkew(test.skew); (err == nil) != test.valid {
+			t.Errorf("ValidateTotpClockSkew(%s) returned %v; want valid %t", test.skew, err, test.valid)
+		}
+	}
+}
@@ -23,12 +23,8 @@ type Item struct {
 	CreatedAt             time.Time `json:"created_at"`
 	UpdatedAt             time.Time `json:"updated_at"`
 	AdditionalInformation string    `json:"additional_information"`
-	Urls                  []struct {
-		Label   string `json:"label"`
-		Primary bool   `json:"primary,omitempty"`
-		Href    string `json:"href"`
-	} `json:"urls"`
-	Sections []struct {
+	Urls                  []ItemUrl `json:"urls"`
+	Sections              []struct {
 		ID    string `json:"id"`
 		Label string `json:"label,omitempty"`
 	} `json:"sections"`
@@ -52,11 +48,30 @@ type Item struct {
 	} `json:"fields"`
 }
 
+type ItemUrl struct {
+	Label   string `json:"label"`
+	Primary bool   `json:"primary,omitempty"`
+	Href    string `json:"href"`
+}
+
+// CredentialFields are the labels of the item fields to read the credentials from (e.g. "Kundennummer").
+// Empty labels fall back to the default fields of the provider.
+type CredentialFields struct {
+	Username string
+	Password string
+	Totp     string
+
+	// TotpWindow decides for which window TOTP codes are generated
+	TotpWindow TotpWindow
+}
+
 type Credentials struct {
 	Id       string
 	Username string
 	Password string
 	Totp     string // This will be populated on-demand
+	// Fields are the field labels the credentials were read from, used to fetch the TOTP on-demand
+	Fields CredentialFields
 	// TODO Get rid of interface{}
 	VaultProvider interface{} // To store the vault provider instance (e.g., *Provider1Password)
 }
@@ -7,22 +7,87 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"time"
 )
 
-func GetProvider(provider, binary, base, tag string, logger *slog.Logger) (*Provider1Password, error) {
+// Provider is a credential provider (password manager) to read the credentials for suppliers from.
+type Provider interface {
+	// LoadVaultItems loads all items of the configured vault (and tag)
+	LoadVaultItems() (Items, error)
+	GetCredentialsByItemId(itemId string, fields CredentialFields) (*Credentials, error)
+	GetTotpForItem(itemId string, fields CredentialFields) (string, error)
+	GetHumanReadableErrorMessage(err error) error
+
+	// GetVersion returns the version of the provider CLI
+	GetVersion() string
+	// GetVaultItems returns the items read by LoadVaultItems
+	GetVaultItems() Items
+	// GetUrlsByItemId returns the urls of all items read by LoadVaultItems
+	GetUrlsByItemId() map[string][]string
+}
+
+// VaultLister is a provider with several vaults to choose from (see `buchhalter vault add`).
+type VaultLister interface {
+	// GetVaults returns the vaults, the name of a vault is the base of GetProvider
+	GetVaults() ([]Vault, error)
+}
+
+// providerNames are the human readable names of the supported providers
+var providerNames = map[string]string{
+	PROVIDER_1PASSWORD: "1Password",
+	PROVIDER_PASS:      "pass",
+	PROVIDER_KEEPASS:   "KeePass",
+	PROVIDER_FILE:      "credentials file",
+}
+
+// GetProvider initializes the credential provider.
+// keePassConfig is only used by the KeePass provider, credentialsFile only by the file provider.
+// On errors, a provider is returned as well to translate the error via GetHumanReadableErrorMessage.
+func GetProvider(provider, binary, base, tag string, keePassConfig KeePassConfig, credentialsFile string, logger *slog.Logger) (Provider, error) {
 	switch provider {
 	case PROVIDER_1PASSWORD:
 		return New1PasswordProvider(binary, base, tag, logger)
+	case PROVIDER_PASS:
+		return NewPassProvider(binary, base, logger)
+	case PROVIDER_KEEPASS:
+		return NewKeePassProvider(keePassConfig, base, tag, logger)
+	case PROVIDER_FILE:
+		return NewFileProvider(credentialsFile, logger)
 	}
 
 	return nil, fmt.Errorf("provider %s not supported", provider)
 }
 
-// DetermineBinary determines the binary to use for the 1Password CLI.
+// IsSupportedProvider returns true if provider can be initialized via GetProvider.
+func IsSupportedProvider(provider string) bool {
+	_, ok := providerNames[provider]
+	return ok
+}
+
+// GetProviderName returns the human readable name of a provider (e.g. 1Password).
+func GetProviderName(provider string) string {
+	if name, ok := providerNames[provider]; ok {
+		return name
+	}
+	return provider
+}
+
+// vaultIdPattern matches the characters that are replaced in the IDs of vaults derived from a path.
+var vaultIdPattern = regexp.MustCompile(`[^a-z0-9]+`)
+
+// vaultIdFromPath returns a file name safe ID for the vault of provider at the slash separated path (e.g. `pass-work-invoices`).
+// The vault ID is part of the file names of the sync state.
+func vaultIdFromPath(provider, path string) string {
+	id := strings.Trim(vaultIdPattern.ReplaceAllString(strings.ToLower(path), "-"), "-")
+	return provider + "-" + id
+}
+
+// DetermineBinary determines the binary to use for a provider CLI.
 // If the binaryPath is set, it will check if the binary exists and is executable.
-// If the binaryPath is empty, it will try to find the binary using the which command.
-func DetermineBinary(binaryPath string) (string, error) {
+// If the binaryPath is empty, it will try to find the binary binaryName using the which command.
+func DetermineBinary(binaryPath, binaryName string) (string, error) {
 	var err error
 
 	// Configured binary
@@ -52,11 +117,11 @@ func DetermineBinary(binaryPath string) (string, error) {
 
 	// Find binary
 	// TODO Check if this works on Windows or if we need to limit it to Linux and macOS
-	whichOutput, err := exec.Command("which", BINARY_NAME_1PASSWORD).Output()
+	whichOutput, err := exec.Command("which", binaryName).Output()
 	if err != nil {
 		return "", CommandExecutionError{
 			Code: CommandExecutionErrorCode,
-			Cmd:  fmt.Sprintf("which %s", BINARY_NAME_1PASSWORD),
+			Cmd:  fmt.Sprintf("which %s", binaryName),
 			Err:  err,
 		}
 	}
@@ -65,14 +130,72 @@ func DetermineBinary(binaryPath string) (string, error) {
 	if len(foundBinary) == 0 {
 		return "", ProviderNotInstalledError{
 			Code: ProviderNotInstalledErrorCode,
-			Cmd:  BINARY_NAME_1PASSWORD,
-			Err:  fmt.Errorf("could not find executable \"%s\"", BINARY_NAME_1PASSWORD),
+			Cmd:  binaryName,
+			Err:  fmt.Errorf("could not find executable \"%s\"", binaryName),
 		}
 	}
 
 	return foundBinary, nil
 }
 
+// ErrCredentialFieldMissing is returned if the item has no field with the label configured by the recipe (e.g. `usernameField`).
+var ErrCredentialFieldMissing = errors.New("credential field missing")
+
+// credentialFieldMissingError returns the error of the missing field labeled fieldLabel.
+func credentialFieldMissingError(fieldLabel string) error {
+	return fmt.Errorf("%w: the vault item has no field `%s`", ErrCredentialFieldMissing, fieldLabel)
+}
+
+// getCredentialField returns the value of the field labeled fieldLabel.
+// Without a label, the default field fieldName is used (see getValueByField).
+// Labels are matched case-insensitive against the label and the id of a field, an item without the field is an error.
+func getCredentialField(item Item, fieldName, fieldLabel string) (string, error) {
+	if len(fieldLabel) == 0 {
+		return getValueByField(item, fieldName), nil
+	}
+
+	for n := 0; n < len(item.Fields); n++ {
+		if !strings.EqualFold(item.Fields[n].Label, fieldLabel) && item.Fields[n].ID != fieldLabel {
+			continue
+		}
+		if item.Fields[n].Type == "OTP" && fieldName == "totp" {
+			return item.Fields[n].Totp, nil
+		}
+		return item.Fields[n].Value, nil
+	}
+
+	return "", credentialFieldMissingError(fieldLabel)
+}
+
+// getTotpCode returns the current TOTP code of item.
+// With a label, a field that is not OTP-typed contains the TOTP secret (base32 or `otpauth://` URI),
+// the code is generated locally from it.
+func getTotpCode(item Item, fieldLabel string, now time.Time) (string, error) {
+	if len(fieldLabel) == 0 {
+		return getValueByField(item, "totp"), nil
+	}
+
+	for n := 0; n < len(item.Fields); n++ {
+		if !strings.EqualFold(item.Fields[n].Label, fieldLabel) && item.Fields[n].ID != fieldLabel {
+			continue
+		}
+		if item.Fields[n].Type == "OTP" {
+			return item.Fields[n].Totp, nil
+		}
+		if len(item.Fields[n].Value) == 0 {
+			return "", nil
+		}
+
+		code, err := GenerateTotp(item.Fields[n].Value, now)
+		if err != nil {
+			return "", fmt.Errorf("error generating TOTP from field `%s`: %w", fieldLabel, err)
+		}
+		return code, nil
+	}
+
+	return "", credentialFieldMissingError(fieldLabel)
+}
+
 func getValueByField(item Item, fieldName string) string {
 	for n := 0; n < len(item.Fields); n++ {
 		if item.Fields[n].Type == "OTP" && fieldName == "totp" {
@@ -0,0 +1,120 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetCredentialField(t *testing.T) {
+	itemJson := `{
+		"id": "abc",
+		"fields": [
+			{"id": "username", "type": "STRING", "purpose": "USERNAME", "label": "username", "value": "jane@example.com"},
+			{"id": "password", "type": "CONCEALED", "purpose": "PASSWORD", "label": "password", "value": "s3cr3t"},
+			{"id": "vdx3kh2", "type": "STRING", "label": "Kundennummer", "value": "4711"},
+			{"id": "one-time password", "type": "OTP", "label": "one-time password", "value": "otpauth://totp/default", "totp": "123456"},
+			{"id": "p4bb6fm", "type": "OTP", "label": "Portal OTP", "value": "otpauth://totp/portal", "totp": "654321"}
+		]
+	}`
+	var item Item
+	if err := json.Unmarshal([]byte(itemJson), &item); err != nil {
+		t.Fatalf("error parsing item: %s", err)
+	}
+
+	tests := []struct {
+		fieldName  string
+		fieldLabel string
+		expected   string
+	}{
+		{fieldName: "username", fieldLabel: "", expected: "jane@example.com"},
+		{fieldName: "password", fieldLabel: "", expected: "s3cr3t"},
+		{fieldName: "totp", fieldLabel: "", expected: "123456"},
+		{fieldName: "username", fieldLabel: "Kundennummer", expected: "4711"},
+		{fieldName: "username", fieldLabel: "kundennummer", expected: "4711"},
+		{fieldName: "username", fieldLabel: "vdx3kh2", expected: "4711"},
+		{fieldName: "totp", fieldLabel: "Portal OTP", expected: "654321"},
+	}
+
+	for _, test := range tests {
+		value, err := getCredentialField(item, test.fieldName, test.fieldLabel)
+		if err != nil {
+			t.Errorf("getCredentialField(%q, %q) returned error: %s", test.fieldName, test.fieldLabel, err)
+			continue
+		}
+		if value != test.expected {
+			t.Errorf("getCredentialField(%q, %q) = %q; want %q", test.fieldName, test.fieldLabel, value, test.expected)
+		}
+	}
+
+	// A missing field isn't an empty credential, the error names the label
+	if _, err := getCredentialField(item, "password", "PIN"); !errors.Is(err, ErrCredentialFieldMissing) || !strings.Contains(err.Error(), "`PIN`") {
+		t.Errorf("getCredentialField() of a missing field error = %v; want %v naming the label", err, ErrCredentialFieldMissing)
+	}
+}
+
+func TestGetTotpCode(t *testing.T) {
+	itemJson := `{
+		"id": "abc",
+		"fields": [
+			{"id": "one-time password", "type": "OTP", "label": "one-time password", "value": "otpauth://totp/default", "totp": "123456"},
+			{"id": "k2f7d1a", "type": "CONCEALED", "label": "TOTP Secret", "value": "GEZD GNBV GY3T QOJQ GEZD GNBV GY3T QOJQ"},
+			{"id": "m1x9q3z", "type": "STRING", "label": "Broken Secret", "value": "not-a-secret!"}
+		]
+	}`
+	var item Item
+	if err := json.Unmarshal([]byte(itemJson), &item); err != nil {
+		t.Fatalf("error parsing item: %s", err)
+	}
+	// RFC 6238 SHA1 secret at 1111111109
+	now := time.Unix(1111111109, 0)
+
+	tests := []struct {
+		fieldLabel  string
+		expected    string
+		expectError bool
+	}{
+		{fieldLabel: "", expected: "123456"},
+		{fieldLabel: "one-time password", expected: "123456"},
+		{fieldLabel: "totp secret", expected: "081804"},
+		{fieldLabel: "missing", expectError: true},
+		{fieldLabel: "Broken Secret", expectError: true},
+	}
+
+	for _, test := range tests {
+		code, err := getTotpCode(item, test.fieldLabel, now)
+		if test.expectError {
+			if err == nil {
+				t.Errorf("getTotpCode(%q) = %q; want an error", test.fieldLabel, code)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("getTotpCode(%q) returned error: %s", test.fieldLabel, err)
+			continue
+		}
+		if code != test.expected {
+			t.Errorf("getTotpCode(%q) = %q; want %q", test.fieldLabel, code, test.expected)
+		}
+	}
+}
+
+func TestVaultIdFromPath(t *testing.T) {
+	tests := []struct {
+		provider string
+		path     string
+		expected string
+	}{
+		{PROVIDER_PASS, "buchhalter", "pass-buchhalter"},
+		{PROVIDER_KEEPASS, "Finance/Invoices 2024", "keepass-finance-invoices-2024"},
+		{PROVIDER_KEEPASS, "../Büro/", "keepass-b-ro"},
+	}
+
+	for _, test := range tests {
+		if id := vaultIdFromPath(test.provider, test.path); id != test.expected {
+			t.Errorf("vaultIdFromPath(%q, %q) = %q; want %q", test.provider, test.path, id, test.expected)
+		}
+	}
+}